@@ -18,7 +18,7 @@ FROM alpine:3.21 AS consumer
 
 RUN apk update \
     && apk upgrade \
-    && apk add --no-cache ca-certificates tzdata \
+    && apk add --no-cache ca-certificates tzdata git \
     && update-ca-certificates 2>/dev/null || true \
     && rm -rf /var/cache/apk/*
 
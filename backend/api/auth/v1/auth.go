@@ -8,7 +8,7 @@ import (
 
 type AuthGetReq struct {
 	KBID       string            `json:"kb_id,omitempty"  query:"kb_id"`
-	SourceType consts.SourceType `query:"source_type"  json:"source_type" validate:"required,oneof=github"`
+	SourceType consts.SourceType `query:"source_type"  json:"source_type" validate:"required,oneof=github saml oidc"`
 }
 
 type AuthGetResp struct {
@@ -17,6 +17,19 @@ type AuthGetResp struct {
 	Proxy        string            `json:"proxy"`
 	SourceType   consts.SourceType `json:"source_type"`
 	Auths        []AuthItem        `json:"auths"`
+
+	Issuer      string   `json:"issuer,omitempty"`
+	Scopes      []string `json:"scopes,omitempty"`
+	GroupsClaim string   `json:"groups_claim,omitempty"`
+
+	IdPMetadataURL string `json:"idp_metadata_url,omitempty"`
+	IdPMetadata    string `json:"idp_metadata,omitempty"`
+	// SP endpoints to register in the IdP, empty until the kb has a base url
+	SPEntityID    string `json:"sp_entity_id,omitempty"`
+	SPACSURL      string `json:"sp_acs_url,omitempty"`
+	SPCertificate string `json:"sp_certificate,omitempty"`
+	// OIDC redirect uri to register in the IdP, empty until the kb has a base url
+	RedirectURI string `json:"redirect_uri,omitempty"`
 }
 
 type AuthItem struct {
@@ -31,10 +44,18 @@ type AuthItem struct {
 
 type AuthSetReq struct {
 	KBID         string            `json:"kb_id,omitempty"`
-	SourceType   consts.SourceType `query:"source_type"  json:"source_type" validate:"required,oneof=github"`
+	SourceType   consts.SourceType `query:"source_type"  json:"source_type" validate:"required,oneof=github saml oidc"`
 	ClientID     string            `json:"client_id"`
 	ClientSecret string            `json:"client_secret"`
 	Proxy        string            `json:"proxy"`
+
+	Issuer      string   `json:"issuer"`
+	Scopes      []string `json:"scopes"`
+	GroupsClaim string   `json:"groups_claim"`
+
+	// either the url or the content of the IdP metadata is required for SAML
+	IdPMetadataURL string `json:"idp_metadata_url"`
+	IdPMetadata    string `json:"idp_metadata"`
 }
 
 type AuthSetResp struct{}
@@ -33,3 +33,36 @@ type GitHubCallbackReq struct {
 
 type GitHubCallbackResp struct {
 }
+
+type AuthOIDCReq struct {
+	KbID        string `json:"kb_id"`
+	RedirectUrl string `json:"redirect_url"`
+}
+
+type AuthOIDCResp struct {
+	Url string `json:"url"`
+}
+
+type OIDCCallbackReq struct {
+	Code  string `json:"code" query:"code"`
+	State string `json:"state" query:"state"`
+}
+
+type AuthSAMLReq struct {
+	KbID        string `json:"kb_id"`
+	RedirectUrl string `json:"redirect_url"`
+}
+
+type AuthSAMLResp struct {
+	Url string `json:"url"`
+}
+
+type SAMLMetadataReq struct {
+	KbID string `param:"kb_id" validate:"required"`
+}
+
+type SAMLACSReq struct {
+	KbID         string `param:"kb_id" validate:"required"`
+	SAMLResponse string `form:"SAMLResponse" validate:"required"`
+	RelayState   string `form:"RelayState" validate:"required"`
+}
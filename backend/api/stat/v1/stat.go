@@ -79,3 +79,17 @@ type StatSourceItem struct {
 	ConversionRate float64 `json:"conversion_rate"`
 	Estimated      bool    `json:"estimated"`
 }
+
+type StatAnswerCacheReq struct {
+	KbID string         `json:"kb_id" query:"kb_id" validate:"required"`
+	Day  consts.StatDay `json:"day" query:"day" validate:"omitempty,oneof=1 7 30 90"`
+}
+
+type StatAnswerCacheResp struct {
+	Lookups  int64   `json:"lookups"`
+	Hits     int64   `json:"hits"`
+	HitRatio float64 `json:"hit_ratio" gorm:"-"`
+	// SavedTokens estimates the tokens the hits saved, what the cached answers cost
+	SavedTokens int64 `json:"saved_tokens"`
+	Entries     int64 `json:"entries" gorm:"-"`
+}
@@ -0,0 +1,91 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/pkg/webauthn"
+)
+
+type TwoFactorLoginReq struct {
+	ChallengeToken string                 `json:"challenge_token" validate:"required"`
+	Method         domain.TwoFactorMethod `json:"method" validate:"required,oneof=totp webauthn recovery_code"`
+	// Code is the TOTP code or the recovery code
+	Code string `json:"code"`
+	// Credential is the result of navigator.credentials.get for the webauthn method
+	Credential *webauthn.AssertionResponse `json:"credential"`
+}
+
+type TwoFactorChallengeReq struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+}
+
+type TwoFactorLoginSetupTOTPReq struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+type TwoFactorLoginSetupWebAuthnReq struct {
+	ChallengeToken string                        `json:"challenge_token" validate:"required"`
+	Name           string                        `json:"name" validate:"max=64"`
+	Credential     *webauthn.AttestationResponse `json:"credential" validate:"required"`
+}
+
+// TwoFactorSetupLoginResp is returned when the enrollment required by the 2FA policy
+// completes a login.
+type TwoFactorSetupLoginResp struct {
+	Token         string   `json:"token"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorStatusResp struct {
+	TOTPEnabled bool `json:"totp_enabled"`
+	// WebAuthnCredentials are the security keys and passkeys of the user
+	WebAuthnCredentials []WebAuthnCredentialResp `json:"webauthn_credentials"`
+	RecoveryCodesLeft   int                      `json:"recovery_codes_left"`
+	// Required is set when the 2FA policy does not allow the user to remove the last factor
+	Required bool `json:"required"`
+}
+
+type WebAuthnCredentialResp struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	RPID       string     `json:"rp_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type TOTPSetupResp struct {
+	// Secret is the key to type into authenticator apps unable to scan URL
+	Secret string `json:"secret"`
+	// URL is the otpauth url to render as a QR code
+	URL string `json:"url"`
+}
+
+type EnableTOTPReq struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// RecoveryCodesResp returns the recovery codes in clear text, only once. It is empty when a
+// factor is added to a user who already has recovery codes.
+type RecoveryCodesResp struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorPasswordReq struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type RegisterWebAuthnReq struct {
+	Name       string                        `json:"name" validate:"max=64"`
+	Credential *webauthn.AttestationResponse `json:"credential" validate:"required"`
+}
+
+type DeleteWebAuthnCredentialReq struct {
+	ID       string `json:"id" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type ResetTwoFactorReq struct {
+	UserID string `json:"user_id" validate:"required"`
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
 )
 
 type CreateUserReq struct {
@@ -34,6 +35,10 @@ type UserListItemResp struct {
 	Role       consts.UserRole `json:"role"`
 	LastAccess *time.Time      `json:"last_access"`
 	CreatedAt  *time.Time      `json:"created_at"`
+	// SourceType is the IdP of users provisioned by admin SSO
+	SourceType consts.SourceType `json:"source_type"`
+	// TwoFactorEnabled is set for users with TOTP or a security key enrolled
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
 }
 
 type LoginReq struct {
@@ -41,8 +46,17 @@ type LoginReq struct {
 	Password string `json:"password" validate:"required"`
 }
 
+// LoginResp carries the token of the user, or the challenge of the second factor when
+// the password alone is not enough: the token is then returned by the 2FA login apis.
 type LoginResp struct {
 	Token string `json:"token"`
+	// TwoFactorRequired asks for one of Methods at /api/v1/user/login/2fa
+	TwoFactorRequired bool                     `json:"two_factor_required,omitempty"`
+	Methods           []domain.TwoFactorMethod `json:"methods,omitempty"`
+	// TwoFactorSetupRequired asks the admin to enroll a second factor, as required by the
+	// 2FA policy, with the /api/v1/user/login/2fa setup apis
+	TwoFactorSetupRequired bool   `json:"two_factor_setup_required,omitempty"`
+	ChallengeToken         string `json:"challenge_token,omitempty"`
 }
 
 type UserListResp struct {
@@ -57,3 +71,28 @@ type ResetPasswordReq struct {
 type DeleteUserReq struct {
 	UserID string `json:"user_id" query:"user_id" validate:"required"`
 }
+
+type SSOInfoResp struct {
+	Enabled              bool              `json:"enabled"`
+	SourceType           consts.SourceType `json:"source_type"`
+	DisablePasswordLogin bool              `json:"disable_password_login"`
+}
+
+type SSOLoginURLResp struct {
+	URL string `json:"url"`
+}
+
+type SSOCallbackReq struct {
+	State  string `query:"state" validate:"required"`
+	Code   string `query:"code"`
+	Ticket string `query:"ticket"`
+}
+
+type SSOExchangeReq struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type SSOLDAPLoginReq struct {
+	Account  string `json:"account" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
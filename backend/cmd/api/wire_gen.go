@@ -60,7 +60,7 @@ func createApp() (*App, error) {
 	if err != nil {
 		return nil, err
 	}
-	ragService, err := rag.NewRAGService(configConfig, logger)
+	ragService, err := rag.NewRAGService(configConfig, db, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -75,14 +75,22 @@ func createApp() (*App, error) {
 	kbRepo := cache2.NewKBRepo(cacheCache)
 	appRepository := pg2.NewAppRepository(db, logger)
 	pushUsecase := usecase.NewPushUsecase(appRepository, knowledgeBaseRepository, logger)
-	knowledgeBaseUsecase, err := usecase.NewKnowledgeBaseUsecase(knowledgeBaseRepository, nodeRepository, ragRepository, userRepository, apiTokenRepo, ragService, kbRepo, pushUsecase, logger, configConfig)
+	webhookRepository := pg2.NewWebhookRepository(db, logger)
+	mqWebhookRepository := mq2.NewWebhookRepository(mqProducer)
+	webhookUsecase := usecase.NewWebhookUsecase(webhookRepository, mqWebhookRepository, logger)
+	nodeReviewRepository := pg2.NewNodeReviewRepository(db, logger)
+	nodeReviewUsecase := usecase.NewNodeReviewUsecase(nodeReviewRepository, nodeRepository, knowledgeBaseRepository, logger)
+	answerCacheRepo := pg2.NewAnswerCacheRepo(db, logger)
+	knowledgeBaseUsecase, err := usecase.NewKnowledgeBaseUsecase(knowledgeBaseRepository, nodeRepository, ragRepository, userRepository, apiTokenRepo, answerCacheRepo, ragService, kbRepo, pushUsecase, webhookUsecase, nodeReviewUsecase, logger, configConfig)
 	if err != nil {
 		return nil, err
 	}
-	shareAuthMiddleware := middleware.NewShareAuthMiddleware(logger, knowledgeBaseUsecase)
+	authRepo := pg2.NewAuthRepo(db, logger, cacheCache)
+	shareAuthMiddleware := middleware.NewShareAuthMiddleware(logger, knowledgeBaseUsecase, authRepo)
 	captchaCaptcha := captcha.NewCaptcha()
 	baseHandler := handler.NewBaseHandler(echo, logger, configConfig, authMiddleware, shareAuthMiddleware, captchaCaptcha)
-	userUsecase, err := usecase.NewUserUsecase(userRepository, logger, configConfig)
+	systemSettingRepo := pg2.NewSystemSettingRepo(db, logger)
+	userUsecase, err := usecase.NewUserUsecase(userRepository, systemSettingRepo, cacheCache, logger, configConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -90,16 +98,15 @@ func createApp() (*App, error) {
 	conversationRepository := pg2.NewConversationRepository(db, logger)
 	modelRepository := pg2.NewModelRepository(db, logger)
 	promptRepo := pg2.NewPromptRepo(db, logger)
-	llmUsecase := usecase.NewLLMUsecase(configConfig, ragService, conversationRepository, knowledgeBaseRepository, nodeRepository, modelRepository, promptRepo, logger)
+	retrievalSettingRepo := pg2.NewRetrievalSettingRepo(db, logger)
+	llmUsecase := usecase.NewLLMUsecase(configConfig, ragService, conversationRepository, knowledgeBaseRepository, nodeRepository, modelRepository, promptRepo, retrievalSettingRepo, logger)
 	knowledgeBaseHandler := v1.NewKnowledgeBaseHandler(baseHandler, echo, knowledgeBaseUsecase, llmUsecase, pg2.NewBlockWordRepo(db, logger), authMiddleware, logger)
 	minioClient, err := s3.NewMinioClient(configConfig)
 	if err != nil {
 		return nil, err
 	}
-	authRepo := pg2.NewAuthRepo(db, logger, cacheCache)
-	systemSettingRepo := pg2.NewSystemSettingRepo(db, logger)
 	modelUsecase := usecase.NewModelUsecase(modelRepository, nodeRepository, ragRepository, ragService, logger, configConfig, knowledgeBaseRepository, systemSettingRepo)
-	nodeUsecase := usecase.NewNodeUsecase(nodeRepository, appRepository, ragRepository, userRepository, knowledgeBaseRepository, llmUsecase, ragService, logger, minioClient, modelRepository, authRepo, modelUsecase)
+	nodeUsecase := usecase.NewNodeUsecase(nodeRepository, appRepository, ragRepository, userRepository, knowledgeBaseRepository, llmUsecase, ragService, logger, minioClient, modelRepository, authRepo, modelUsecase, webhookUsecase, nodeReviewUsecase)
 	nodeHandler := v1.NewNodeHandler(baseHandler, echo, nodeUsecase, authMiddleware, logger)
 	geoRepo := cache2.NewGeoCache(cacheCache, db, logger)
 	ipdbIPDB, err := ipdb.NewIPDB(configConfig, logger)
@@ -107,13 +114,15 @@ func createApp() (*App, error) {
 		return nil, err
 	}
 	ipAddressRepo := ipdb2.NewIPAddressRepo(ipdbIPDB, logger)
-	conversationUsecase := usecase.NewConversationUsecase(conversationRepository, nodeRepository, geoRepo, logger, ipAddressRepo, authRepo)
+	handoffRepository := pg2.NewHandoffRepository(db, logger)
+	handoffUsecase := usecase.NewHandoffUsecase(handoffRepository, conversationRepository, appRepository, webhookUsecase, pushUsecase, logger)
+	conversationUsecase := usecase.NewConversationUsecase(conversationRepository, nodeRepository, geoRepo, logger, ipAddressRepo, authRepo, webhookUsecase, handoffUsecase)
 	blockWordRepo := pg2.NewBlockWordRepo(db, logger)
-	chatUsecase, err := usecase.NewChatUsecase(llmUsecase, knowledgeBaseRepository, conversationUsecase, modelUsecase, appRepository, blockWordRepo, nodeRepository, authRepo, logger)
+	chatUsecase, err := usecase.NewChatUsecase(llmUsecase, knowledgeBaseRepository, conversationUsecase, modelUsecase, appRepository, blockWordRepo, nodeRepository, answerCacheRepo, authRepo, logger)
 	if err != nil {
 		return nil, err
 	}
-	appUsecase := usecase.NewAppUsecase(appRepository, authRepo, nodeRepository, knowledgeBaseRepository, nodeUsecase, logger, configConfig, chatUsecase, pushUsecase, cacheCache)
+	appUsecase := usecase.NewAppUsecase(appRepository, authRepo, nodeRepository, knowledgeBaseRepository, nodeUsecase, logger, configConfig, chatUsecase, pushUsecase, handoffUsecase, cacheCache)
 	appHandler := v1.NewAppHandler(echo, baseHandler, logger, authMiddleware, appUsecase, modelUsecase, conversationUsecase, configConfig)
 	fileUsecase := usecase.NewFileUsecase(logger, minioClient, configConfig, systemSettingRepo)
 	fileHandler := v1.NewFileHandler(echo, baseHandler, logger, authMiddleware, minioClient, configConfig, fileUsecase)
@@ -131,29 +140,72 @@ func createApp() (*App, error) {
 	creationUsecase := usecase.NewCreationUsecase(logger, llmUsecase, modelUsecase)
 	creationHandler := v1.NewCreationHandler(echo, baseHandler, logger, creationUsecase)
 	statRepository := pg2.NewStatRepository(db, cacheCache)
-	statUseCase := usecase.NewStatUseCase(statRepository, nodeRepository, conversationRepository, appRepository, ipAddressRepo, geoRepo, authRepo, knowledgeBaseRepository, logger)
+	statUseCase := usecase.NewStatUseCase(statRepository, nodeRepository, conversationRepository, appRepository, ipAddressRepo, geoRepo, authRepo, knowledgeBaseRepository, answerCacheRepo, logger)
 	statHandler := v1.NewStatHandler(baseHandler, echo, statUseCase, logger, authMiddleware)
 	commentRepository := pg2.NewCommentRepository(db, logger)
-	commentUsecase := usecase.NewCommentUsecase(commentRepository, logger, nodeRepository, ipAddressRepo, authRepo)
+	commentUsecase := usecase.NewCommentUsecase(commentRepository, logger, nodeRepository, ipAddressRepo, authRepo, webhookUsecase)
 	commentHandler := v1.NewCommentHandler(echo, baseHandler, logger, authMiddleware, commentUsecase)
 	authUsecase, err := usecase.NewAuthUsecase(authRepo, logger, knowledgeBaseRepository, cacheCache)
 	if err != nil {
 		return nil, err
 	}
 	authV1Handler := v1.NewAuthV1Handler(echo, baseHandler, logger, authUsecase)
+	webhookHandler := v1.NewWebhookHandler(echo, baseHandler, logger, authMiddleware, webhookUsecase)
+	gitSyncRepository := pg2.NewGitSyncRepository(db, logger)
+	gitSyncUsecase := usecase.NewGitSyncUsecase(gitSyncRepository, nodeRepository, knowledgeBaseRepository, nodeUsecase, cacheCache, logger)
+	gitSyncHandler := v1.NewGitSyncHandler(echo, baseHandler, logger, authMiddleware, gitSyncUsecase)
+	kbArchiveRepository := pg2.NewKBArchiveRepository(db, logger)
+	mqKBArchiveRepository := mq2.NewKBArchiveRepository(mqProducer)
+	kbArchiveUsecase := usecase.NewKBArchiveUsecase(kbArchiveRepository, knowledgeBaseRepository, mqKBArchiveRepository, ragRepository, minioClient, logger)
+	kbArchiveHandler := v1.NewKBArchiveHandler(echo, baseHandler, logger, authMiddleware, kbArchiveUsecase, knowledgeBaseUsecase)
+	releaseScheduleRepository := pg2.NewReleaseScheduleRepository(db, logger)
+	mqReleaseScheduleRepository := mq2.NewReleaseScheduleRepository(mqProducer)
+	releaseScheduleUsecase := usecase.NewReleaseScheduleUsecase(releaseScheduleRepository, nodeRepository, mqReleaseScheduleRepository, ragRepository, knowledgeBaseUsecase, logger)
+	releaseScheduleHandler, err := v1.NewReleaseScheduleHandler(echo, baseHandler, logger, authMiddleware, releaseScheduleUsecase, pushUsecase, mqConsumer)
+	if err != nil {
+		return nil, err
+	}
+	nodeReviewHandler := v1.NewNodeReviewHandler(echo, baseHandler, logger, authMiddleware, nodeReviewUsecase)
+	nodeCollabRepository := mq2.NewNodeCollabRepository(mqProducer)
+	nodeCollabUsecase := usecase.NewNodeCollabUsecase(nodeRepository, userRepository, nodeCollabRepository, logger)
+	nodeCollabHandler, err := v1.NewNodeCollabHandler(echo, baseHandler, logger, authMiddleware, nodeCollabUsecase, mqConsumer)
+	if err != nil {
+		return nil, err
+	}
+	ragEvalRepository := pg2.NewRAGEvalRepository(db, logger)
+	mqRAGEvalRepository := mq2.NewRAGEvalRepository(mqProducer)
+	ragEvalUsecase := usecase.NewRAGEvalUsecase(ragEvalRepository, mqRAGEvalRepository, promptRepo, modelRepository, llmUsecase, modelUsecase, logger)
+	ragEvalHandler := v1.NewRAGEvalHandler(echo, baseHandler, logger, authMiddleware, ragEvalUsecase)
+	knowledgeGapRepository := pg2.NewKnowledgeGapRepository(db, logger)
+	knowledgeGapUsecase := usecase.NewKnowledgeGapUsecase(knowledgeGapRepository, llmUsecase, modelUsecase, nodeUsecase, logger)
+	knowledgeGapHandler := v1.NewKnowledgeGapHandler(echo, baseHandler, logger, authMiddleware, knowledgeGapUsecase)
+	handoffHandler := v1.NewHandoffHandler(echo, baseHandler, logger, authMiddleware, handoffUsecase)
+	ldapSyncRepository := pg2.NewLDAPSyncRepository(db, logger)
+	ldapSyncUsecase := usecase.NewLDAPSyncUsecase(ldapSyncRepository, authRepo, knowledgeBaseRepository, cacheCache, logger)
+	ldapSyncHandler := v1.NewLDAPSyncHandler(echo, baseHandler, logger, authMiddleware, ldapSyncUsecase)
 	apiHandlers := &v1.APIHandlers{
-		UserHandler:          userHandler,
-		KnowledgeBaseHandler: knowledgeBaseHandler,
-		NodeHandler:          nodeHandler,
-		AppHandler:           appHandler,
-		FileHandler:          fileHandler,
-		ModelHandler:         modelHandler,
-		ConversationHandler:  conversationHandler,
-		CrawlerHandler:       crawlerHandler,
-		CreationHandler:      creationHandler,
-		StatHandler:          statHandler,
-		CommentHandler:       commentHandler,
-		AuthV1Handler:        authV1Handler,
+		UserHandler:            userHandler,
+		KnowledgeBaseHandler:   knowledgeBaseHandler,
+		NodeHandler:            nodeHandler,
+		AppHandler:             appHandler,
+		FileHandler:            fileHandler,
+		ModelHandler:           modelHandler,
+		ConversationHandler:    conversationHandler,
+		CrawlerHandler:         crawlerHandler,
+		CreationHandler:        creationHandler,
+		StatHandler:            statHandler,
+		CommentHandler:         commentHandler,
+		AuthV1Handler:          authV1Handler,
+		WebhookHandler:         webhookHandler,
+		GitSyncHandler:         gitSyncHandler,
+		KBArchiveHandler:       kbArchiveHandler,
+		ReleaseScheduleHandler: releaseScheduleHandler,
+		NodeReviewHandler:      nodeReviewHandler,
+		NodeCollabHandler:      nodeCollabHandler,
+		RAGEvalHandler:         ragEvalHandler,
+		KnowledgeGapHandler:    knowledgeGapHandler,
+		HandoffHandler:         handoffHandler,
+		LDAPSyncHandler:        ldapSyncHandler,
 	}
 	mcpRepository := pg2.NewMCPRepository(db, logger)
 	apiCallAuditRepo := pg2.NewAPICallAuditRepo(db, logger)
@@ -172,9 +224,12 @@ func createApp() (*App, error) {
 	wechatAppUsecase := usecase.NewWechatAppUsecase(logger, appUsecase, chatUsecase, wechatRepository, authRepo, appRepository)
 	shareWechatHandler := share.NewShareWechatHandler(echo, baseHandler, logger, appUsecase, conversationUsecase, wechatUsecase, wecomUsecase, wechatAppUsecase)
 	shareCaptchaHandler := share.NewShareCaptchaHandler(baseHandler, echo, logger)
-	shareMCPHandler := share.NewShareMCPHandler(echo, baseHandler, logger, appUsecase, mcpRepository)
+	mcpUsecase := usecase.NewMCPUsecase(llmUsecase, chatUsecase, nodeUsecase, knowledgeBaseRepository, nodeRepository, logger)
+	shareMCPHandler := share.NewShareMCPHandler(echo, baseHandler, logger, appUsecase, mcpUsecase, mcpRepository, apiTokenRepo, cacheCache)
 	openapiV1Handler := share.NewOpenapiV1Handler(echo, baseHandler, logger, authUsecase, appUsecase)
 	shareCommonHandler := share.NewShareCommonHandler(echo, baseHandler, logger, appUsecase, fileUsecase)
+	scimUsecase := usecase.NewSCIMUsecase(authRepo, knowledgeBaseRepository, logger)
+	shareSCIMHandler := share.NewShareSCIMHandler(echo, baseHandler, logger, scimUsecase, apiTokenRepo)
 	shareHandler := &share.ShareHandler{
 		ShareNodeHandler:         shareNodeHandler,
 		ShareAppHandler:          shareAppHandler,
@@ -187,6 +242,7 @@ func createApp() (*App, error) {
 		ShareWechatHandler:       shareWechatHandler,
 		ShareCaptchaHandler:      shareCaptchaHandler,
 		ShareMCPHandler:          shareMCPHandler,
+		ShareSCIMHandler:         shareSCIMHandler,
 		OpenapiV1Handler:         openapiV1Handler,
 		ShareCommonHandler:       shareCommonHandler,
 	}
@@ -35,11 +35,11 @@ func createApp() (*App, error) {
 	if err != nil {
 		return nil, err
 	}
-	ragService, err := rag.NewRAGService(configConfig, logger)
+	db, err := pg.NewDB(configConfig)
 	if err != nil {
 		return nil, err
 	}
-	db, err := pg.NewDB(configConfig)
+	ragService, err := rag.NewRAGService(configConfig, db, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -48,13 +48,17 @@ func createApp() (*App, error) {
 	conversationRepository := pg2.NewConversationRepository(db, logger)
 	modelRepository := pg2.NewModelRepository(db, logger)
 	promptRepo := pg2.NewPromptRepo(db, logger)
-	llmUsecase := usecase.NewLLMUsecase(configConfig, ragService, conversationRepository, knowledgeBaseRepository, nodeRepository, modelRepository, promptRepo, logger)
+	retrievalSettingRepo := pg2.NewRetrievalSettingRepo(db, logger)
+	llmUsecase := usecase.NewLLMUsecase(configConfig, ragService, conversationRepository, knowledgeBaseRepository, nodeRepository, modelRepository, promptRepo, retrievalSettingRepo, logger)
 	mqProducer, err := mq.NewMQProducer(configConfig, logger)
 	if err != nil {
 		return nil, err
 	}
 	ragRepository := mq2.NewRAGRepository(mqProducer)
 	systemSettingRepo := pg2.NewSystemSettingRepo(db, logger)
+	webhookRepository := pg2.NewWebhookRepository(db, logger)
+	mqWebhookRepository := mq2.NewWebhookRepository(mqProducer)
+	webhookUsecase := usecase.NewWebhookUsecase(webhookRepository, mqWebhookRepository, logger)
 	modelUsecase := usecase.NewModelUsecase(modelRepository, nodeRepository, ragRepository, ragService, logger, configConfig, knowledgeBaseRepository, systemSettingRepo)
 	ragmqHandler, err := mq3.NewRAGMQHandler(mqConsumer, logger, ragService, nodeRepository, knowledgeBaseRepository, llmUsecase, modelUsecase)
 	if err != nil {
@@ -77,15 +81,52 @@ func createApp() (*App, error) {
 	ipAddressRepo := ipdb2.NewIPAddressRepo(ipdbIPDB, logger)
 	geoRepo := cache2.NewGeoCache(cacheCache, db, logger)
 	authRepo := pg2.NewAuthRepo(db, logger, cacheCache)
-	statUseCase := usecase.NewStatUseCase(statRepository, nodeRepository, conversationRepository, appRepository, ipAddressRepo, geoRepo, authRepo, knowledgeBaseRepository, logger)
+	answerCacheRepo := pg2.NewAnswerCacheRepo(db, logger)
+	statUseCase := usecase.NewStatUseCase(statRepository, nodeRepository, conversationRepository, appRepository, ipAddressRepo, geoRepo, authRepo, knowledgeBaseRepository, answerCacheRepo, logger)
 	navRepository := pg2.NewNavRepository(db, logger)
 	userRepository := pg2.NewUserRepository(db, logger)
 	minioClient, err := s3.NewMinioClient(configConfig)
 	if err != nil {
 		return nil, err
 	}
-	nodeUsecase := usecase.NewNodeUsecase(nodeRepository, navRepository, appRepository, ragRepository, userRepository, knowledgeBaseRepository, llmUsecase, ragService, logger, minioClient, modelRepository, authRepo, modelUsecase)
-	cronHandler, err := mq3.NewCronHandler(logger, statRepository, nodeRepository, statUseCase, nodeUsecase)
+	nodeReviewRepository := pg2.NewNodeReviewRepository(db, logger)
+	nodeReviewUsecase := usecase.NewNodeReviewUsecase(nodeReviewRepository, nodeRepository, knowledgeBaseRepository, logger)
+	nodeUsecase := usecase.NewNodeUsecase(nodeRepository, navRepository, appRepository, ragRepository, userRepository, knowledgeBaseRepository, llmUsecase, ragService, logger, minioClient, modelRepository, authRepo, modelUsecase, webhookUsecase, nodeReviewUsecase)
+	gitSyncRepository := pg2.NewGitSyncRepository(db, logger)
+	gitSyncUsecase := usecase.NewGitSyncUsecase(gitSyncRepository, nodeRepository, knowledgeBaseRepository, nodeUsecase, cacheCache, logger)
+	releaseScheduleRepository := pg2.NewReleaseScheduleRepository(db, logger)
+	mqReleaseScheduleRepository := mq2.NewReleaseScheduleRepository(mqProducer)
+	apiTokenRepo := pg2.NewAPITokenRepo(db, logger, cacheCache)
+	kbRepo := cache2.NewKBRepo(cacheCache)
+	pushUsecase := usecase.NewPushUsecase(appRepository, knowledgeBaseRepository, logger)
+	knowledgeBaseUsecase, err := usecase.NewKnowledgeBaseUsecase(knowledgeBaseRepository, nodeRepository, ragRepository, userRepository, apiTokenRepo, answerCacheRepo, ragService, kbRepo, pushUsecase, webhookUsecase, nodeReviewUsecase, logger, configConfig)
+	if err != nil {
+		return nil, err
+	}
+	releaseScheduleUsecase := usecase.NewReleaseScheduleUsecase(releaseScheduleRepository, nodeRepository, mqReleaseScheduleRepository, ragRepository, knowledgeBaseUsecase, logger)
+	knowledgeGapRepository := pg2.NewKnowledgeGapRepository(db, logger)
+	knowledgeGapUsecase := usecase.NewKnowledgeGapUsecase(knowledgeGapRepository, llmUsecase, modelUsecase, nodeUsecase, logger)
+	ldapSyncRepository := pg2.NewLDAPSyncRepository(db, logger)
+	ldapSyncUsecase := usecase.NewLDAPSyncUsecase(ldapSyncRepository, authRepo, knowledgeBaseRepository, cacheCache, logger)
+	kbArchiveRepository := pg2.NewKBArchiveRepository(db, logger)
+	mqKBArchiveRepository := mq2.NewKBArchiveRepository(mqProducer)
+	kbArchiveUsecase := usecase.NewKBArchiveUsecase(kbArchiveRepository, knowledgeBaseRepository, mqKBArchiveRepository, ragRepository, minioClient, logger)
+	cronHandler, err := mq3.NewCronHandler(logger, statRepository, nodeRepository, statUseCase, nodeUsecase, webhookRepository, gitSyncUsecase, releaseScheduleUsecase, conversationRepository, knowledgeGapUsecase, ldapSyncUsecase, kbArchiveUsecase)
+	if err != nil {
+		return nil, err
+	}
+	webhookMQHandler, err := mq3.NewWebhookMQHandler(mqConsumer, logger, webhookUsecase)
+	if err != nil {
+		return nil, err
+	}
+	kbArchiveMQHandler, err := mq3.NewKBArchiveMQHandler(mqConsumer, logger, kbArchiveUsecase)
+	if err != nil {
+		return nil, err
+	}
+	ragEvalRepository := pg2.NewRAGEvalRepository(db, logger)
+	mqRAGEvalRepository := mq2.NewRAGEvalRepository(mqProducer)
+	ragEvalUsecase := usecase.NewRAGEvalUsecase(ragEvalRepository, mqRAGEvalRepository, promptRepo, modelRepository, llmUsecase, modelUsecase, logger)
+	ragEvalMQHandler, err := mq3.NewRAGEvalMQHandler(mqConsumer, logger, ragEvalUsecase)
 	if err != nil {
 		return nil, err
 	}
@@ -93,6 +134,9 @@ func createApp() (*App, error) {
 		RAGMQHandler:        ragmqHandler,
 		RagDocUpdateHandler: ragDocUpdateHandler,
 		StatCronHandler:     cronHandler,
+		WebhookMQHandler:    webhookMQHandler,
+		KBArchiveMQHandler:  kbArchiveMQHandler,
+		RAGEvalMQHandler:    ragEvalMQHandler,
 	}
 	app := &App{
 		MQConsumer:      mqConsumer,
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+)
+
+const usage = `usage:
+  kbarchive export -kb <kb id> -o <file.zip>
+  kbarchive import -f <file.zip> -mode new -user <admin user id> -hosts <h1,h2> -ports <p1,p2> [-ssl-ports <p1,p2>] [-name <name>]
+  kbarchive import -f <file.zip> -mode merge -kb <kb id>`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	app, err := createApp()
+	if err != nil {
+		panic(err)
+	}
+	switch os.Args[1] {
+	case "export":
+		err = app.export(os.Args[2:])
+	case "import":
+		err = app.importArchive(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		app.Logger.Error("kbarchive failed", log.Error(err))
+		os.Exit(1)
+	}
+}
+
+func (app *App) export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	kbID := fs.String("kb", "", "knowledge base id")
+	output := fs.String("o", "", "output file")
+	_ = fs.Parse(args)
+	if *kbID == "" || *output == "" {
+		return fmt.Errorf("-kb and -o are required")
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := app.KBArchiveUsecase.Export(context.Background(), *kbID, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	app.Logger.Info("kb exported", log.String("kb_id", *kbID), log.String("file", *output))
+	return nil
+}
+
+func (app *App) importArchive(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("f", "", "archive file")
+	mode := fs.String("mode", string(domain.KBImportModeNew), "new or merge")
+	kbID := fs.String("kb", "", "target knowledge base id, merge mode")
+	name := fs.String("name", "", "knowledge base name, new mode, defaults to the archived name")
+	userID := fs.String("user", "", "admin user id creating the knowledge base, new mode")
+	hosts := fs.String("hosts", "", "comma separated knowledge base hosts, new mode")
+	ports := fs.String("ports", "", "comma separated knowledge base ports, new mode")
+	sslPorts := fs.String("ssl-ports", "", "comma separated knowledge base ssl ports, new mode")
+	_ = fs.Parse(args)
+	if *file == "" {
+		return fmt.Errorf("-f is required")
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	manifest, err := app.KBArchiveUsecase.ReadManifest(f, stat.Size())
+	if err != nil {
+		return fmt.Errorf("invalid archive: %w", err)
+	}
+
+	ctx := context.Background()
+	switch domain.KBImportMode(*mode) {
+	case domain.KBImportModeNew:
+		if *userID == "" || *hosts == "" || (*ports == "" && *sslPorts == "") {
+			return fmt.Errorf("-user, -hosts and -ports or -ssl-ports are required in new mode")
+		}
+		req := &domain.CreateKnowledgeBaseReq{
+			Name:  *name,
+			Hosts: splitList(*hosts),
+			MaxKB: domain.GetBaseEditionLimitation(ctx).MaxKb,
+		}
+		if req.Name == "" {
+			req.Name = manifest.KBName
+		}
+		if req.Ports, err = splitPorts(*ports); err != nil {
+			return err
+		}
+		if req.SSLPorts, err = splitPorts(*sslPorts); err != nil {
+			return err
+		}
+		ctx = context.WithValue(ctx, domain.CtxAuthInfoKey, &domain.CtxAuthInfo{UserId: *userID})
+		if *kbID, err = app.KnowledgeBaseUsecase.CreateKnowledgeBase(ctx, req); err != nil {
+			return fmt.Errorf("create knowledge base failed: %w", err)
+		}
+		app.Logger.Info("kb created", log.String("kb_id", *kbID))
+	case domain.KBImportModeMerge:
+		if *kbID == "" {
+			return fmt.Errorf("-kb is required in merge mode")
+		}
+		if _, err := app.KnowledgeBaseUsecase.GetKnowledgeBase(ctx, *kbID); err != nil {
+			return fmt.Errorf("get knowledge base failed: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", *mode)
+	}
+
+	result, err := app.KBArchiveUsecase.Import(ctx, *kbID, domain.KBImportMode(*mode), f, stat.Size(), func(stage string, percent int) {
+		app.Logger.Info("kb import progress", log.String("stage", stage), log.Int("progress", percent))
+	})
+	if err != nil {
+		return err
+	}
+	app.Logger.Info("kb imported", log.String("kb_id", *kbID), log.Any("result", result))
+	return nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func splitPorts(s string) ([]int, error) {
+	var ports []int
+	for _, item := range splitList(s) {
+		port, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", item)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
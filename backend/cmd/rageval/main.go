@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+)
+
+const usage = `usage:
+  rageval import -kb <kb id> -f <cases.json> (-dataset <dataset id> | -name <new dataset name>)
+  rageval run -kb <kb id> -dataset <dataset id> [-prompt-version <n>] [-model <model id>] [-scorer llm|embedding] [-k <top k>]
+  rageval runs -kb <kb id> [-dataset <dataset id>] [-n <count>]`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	app, err := createApp()
+	if err != nil {
+		panic(err)
+	}
+	switch os.Args[1] {
+	case "import":
+		err = app.importCases(os.Args[2:])
+	case "run":
+		err = app.run(os.Args[2:])
+	case "runs":
+		err = app.listRuns(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		app.Logger.Error("rageval failed", log.Error(err))
+		os.Exit(1)
+	}
+}
+
+// importCases reads a json array of domain.RAGEvalCaseInput.
+func (app *App) importCases(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	kbID := fs.String("kb", "", "knowledge base id")
+	datasetID := fs.String("dataset", "", "dataset id to add the cases to")
+	name := fs.String("name", "", "name of a new dataset to create for the cases")
+	file := fs.String("f", "", "json file with the cases")
+	_ = fs.Parse(args)
+	if *kbID == "" || *file == "" || (*datasetID == "") == (*name == "") {
+		return fmt.Errorf("-kb, -f and one of -dataset or -name are required")
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	var cases []*domain.RAGEvalCaseInput
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return fmt.Errorf("invalid cases file: %w", err)
+	}
+	for i, c := range cases {
+		if c.Question == "" {
+			return fmt.Errorf("case %d has no question", i+1)
+		}
+	}
+	if len(cases) == 0 {
+		return domain.ErrRAGEvalDatasetEmpty
+	}
+
+	ctx := context.Background()
+	if *name != "" {
+		dataset, err := app.RAGEvalUsecase.CreateDataset(ctx, &domain.CreateRAGEvalDatasetReq{KBID: *kbID, Name: *name}, "")
+		if err != nil {
+			return err
+		}
+		*datasetID = dataset.ID
+		app.Logger.Info("rag eval dataset created", log.String("dataset_id", dataset.ID))
+	}
+	added, err := app.RAGEvalUsecase.AddCases(ctx, &domain.AddRAGEvalCasesReq{KBID: *kbID, DatasetID: *datasetID, Cases: cases})
+	if err != nil {
+		return err
+	}
+	app.Logger.Info("rag eval cases imported", log.String("dataset_id", *datasetID), log.Int("count", len(added)))
+	return nil
+}
+
+// run evaluates in this process instead of queueing the run for the consumer.
+func (app *App) run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	kbID := fs.String("kb", "", "knowledge base id")
+	datasetID := fs.String("dataset", "", "dataset id")
+	promptVersion := fs.Int("prompt-version", 0, "saved prompt version, 0 uses the current prompt")
+	modelID := fs.String("model", "", "chat model id, defaults to the chat model")
+	scorer := fs.String("scorer", string(domain.RAGEvalScorerLLM), "answer scorer, llm or embedding")
+	topK := fs.Int("k", domain.RAGEvalDefaultTopK, "k of recall@k")
+	_ = fs.Parse(args)
+	if *kbID == "" || *datasetID == "" {
+		return fmt.Errorf("-kb and -dataset are required")
+	}
+	switch domain.RAGEvalScorer(*scorer) {
+	case domain.RAGEvalScorerLLM, domain.RAGEvalScorerEmbedding:
+	default:
+		return fmt.Errorf("unknown scorer %q", *scorer)
+	}
+	if *promptVersion < 0 || *topK < 1 {
+		return fmt.Errorf("-prompt-version must not be negative and -k must be positive")
+	}
+
+	ctx := context.Background()
+	run, err := app.RAGEvalUsecase.NewRun(ctx, &domain.CreateRAGEvalRunReq{
+		KBID:          *kbID,
+		DatasetID:     *datasetID,
+		PromptVersion: *promptVersion,
+		ModelID:       *modelID,
+		Scorer:        domain.RAGEvalScorer(*scorer),
+		TopK:          *topK,
+	}, "")
+	if err != nil {
+		return err
+	}
+	app.Logger.Info("rag eval run started", log.String("run_id", run.ID), log.Int("prompt_version", run.PromptVersion), log.String("model", run.ModelName))
+	if err := app.RAGEvalUsecase.ExecuteRun(ctx, run.ID); err != nil {
+		return err
+	}
+	detail, err := app.RAGEvalUsecase.GetRun(ctx, *kbID, run.ID)
+	if err != nil {
+		return err
+	}
+	if detail.Run.Status == domain.RAGEvalRunStatusFailed {
+		return fmt.Errorf("run %s failed: %s", run.ID, detail.Run.Error)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "QUESTION\tRECALL\tSCORE\tERROR")
+	for _, result := range detail.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", truncate(result.Question, 40), formatScore(result.Recall), formatScore(result.AnswerScore), result.Error)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	printMetrics(detail.Run)
+	return nil
+}
+
+func (app *App) listRuns(args []string) error {
+	fs := flag.NewFlagSet("runs", flag.ExitOnError)
+	kbID := fs.String("kb", "", "knowledge base id")
+	datasetID := fs.String("dataset", "", "dataset id, all datasets when empty")
+	count := fs.Int("n", 20, "number of runs")
+	_ = fs.Parse(args)
+	if *kbID == "" || *count < 1 {
+		return fmt.Errorf("-kb is required and -n must be positive")
+	}
+
+	resp, err := app.RAGEvalUsecase.ListRuns(context.Background(), &domain.RAGEvalRunListReq{
+		KBID:      *kbID,
+		DatasetID: *datasetID,
+		Pager:     domain.Pager{Page: 1, PageSize: *count},
+	})
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tCREATED\tDATASET\tPROMPT\tMODEL\tSCORER\tSTATUS\tRECALL@K\tHIT RATE\tSCORE\tFAILED")
+	for _, run := range resp.Data {
+		fmt.Fprintf(w, "%s\t%s\t%s\tv%d\t%s\t%s\t%s\t%s@%d\t%s\t%s\t%d/%d\n",
+			run.ID, run.CreatedAt.Format("2006-01-02 15:04"), run.DatasetID, run.PromptVersion, run.ModelName, run.Scorer, run.Status,
+			formatScore(run.Metrics.Recall), run.TopK, formatScore(run.Metrics.HitRate), formatScore(run.Metrics.AnswerScore),
+			run.Metrics.Failed, run.Metrics.Cases)
+	}
+	return w.Flush()
+}
+
+func printMetrics(run *domain.RAGEvalRun) {
+	fmt.Printf("\nrun %s: prompt v%d, model %s, scorer %s\n", run.ID, run.PromptVersion, run.ModelName, run.Scorer)
+	fmt.Printf("recall@%d %s, hit rate %s, answer score %s, failed %d/%d, %dms per case\n",
+		run.TopK, formatScore(run.Metrics.Recall), formatScore(run.Metrics.HitRate), formatScore(run.Metrics.AnswerScore),
+		run.Metrics.Failed, run.Metrics.Cases, run.Metrics.DurationMS)
+}
+
+func formatScore(score *float64) string {
+	if score == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", *score)
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
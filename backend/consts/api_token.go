@@ -0,0 +1,18 @@
+package consts
+
+// APITokenScope limits what an api token may call on top of its kb permission. Only the apis
+// declaring a scope accept tokens at all. A token without scopes predates them and may call
+// every api declaring one its permission allows.
+type APITokenScope string
+
+const (
+	APITokenScopeNodeRead  APITokenScope = "node:read"
+	APITokenScopeNodeWrite APITokenScope = "node:write"
+	APITokenScopePublish   APITokenScope = "publish"
+	APITokenScopeChat      APITokenScope = "chat" // OpenAI-compatible completions, embeddings and models
+	APITokenScopeMCP       APITokenScope = "mcp"
+	APITokenScopeStats     APITokenScope = "stats"
+	// APITokenScopeSCIM allows an IdP to provision the readers and auth groups of the kb,
+	// it is never implied by a token without scopes.
+	APITokenScopeSCIM APITokenScope = "scim"
+)
@@ -3,7 +3,7 @@ package consts
 type SourceType string
 
 var (
-	BotSourceTypes = []SourceType{SourceTypeWidget, SourceTypeDingtalkBot, SourceTypeFeishuBot, SourceTypeLarkBot, SourceTypeWechatBot, SourceTypeWechatServiceBot, SourceTypeDiscordBot, SourceTypeWechatOfficialAccount}
+	BotSourceTypes = []SourceType{SourceTypeWidget, SourceTypeDingtalkBot, SourceTypeFeishuBot, SourceTypeLarkBot, SourceTypeWechatBot, SourceTypeWechatServiceBot, SourceTypeDiscordBot, SourceTypeWechatOfficialAccount, SourceTypeSlackBot}
 )
 
 const (
@@ -14,6 +14,9 @@ const (
 	SourceTypeGitHub                SourceType = "github"
 	SourceTypeCAS                   SourceType = "cas"
 	SourceTypeLDAP                  SourceType = "ldap"
+	SourceTypeSAML                  SourceType = "saml"
+	SourceTypeOIDC                  SourceType = "oidc"
+	SourceTypeSCIM                  SourceType = "scim" // auth groups pushed by an IdP over SCIM
 	SourceTypeWidget                SourceType = "widget"
 	SourceTypeDingtalkBot           SourceType = "dingtalk_bot"
 	SourceTypeFeishuBot             SourceType = "feishu_bot"
@@ -25,6 +28,7 @@ const (
 	SourceTypeWechatOfficialAccount SourceType = "wechat_official_account"
 	SourceTypeOpenAIAPI             SourceType = "openai_api"
 	SourceTypeMcpServer             SourceType = "mcp_server"
+	SourceTypeSlackBot              SourceType = "slack_bot"
 )
 
 func (s SourceType) Name() string {
@@ -49,6 +53,8 @@ func (s SourceType) Name() string {
 		return "微信公众号"
 	case SourceTypeMcpServer:
 		return "MCP 服务器"
+	case SourceTypeSlackBot:
+		return "Slack 机器人"
 	default:
 		return ""
 	}
@@ -5,4 +5,6 @@ type SystemSettingKey string
 const (
 	SystemSettingModelMode SystemSettingKey = "model_setting_mode"
 	SystemSettingUpload    SystemSettingKey = "upload"
+	SystemSettingAdminSSO  SystemSettingKey = "admin_sso"
+	SystemSettingTwoFactor SystemSettingKey = "two_factor_policy"
 )
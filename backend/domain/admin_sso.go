@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/chaitin/panda-wiki/consts"
+)
+
+var (
+	ErrPasswordLoginDisabled = errors.New("password login is disabled, please log in with SSO")
+	ErrSSOUserNotAllowed     = errors.New("the user is in no group allowed into the admin console")
+)
+
+// AdminSSOSetting is the system setting of the admin console login through an enterprise
+// IdP. Users are provisioned on their first login and their role and kb permissions are
+// synced from the groups of the IdP on every login.
+type AdminSSOSetting struct {
+	Enabled    bool              `json:"enabled"`
+	SourceType consts.SourceType `json:"source_type" validate:"omitempty,oneof=ldap oauth cas"`
+	// BaseURL is the url of the admin console, the OAuth and CAS callbacks are served under it
+	BaseURL string `json:"base_url" validate:"omitempty,url"`
+	// DisablePasswordLogin rejects local password logins, and the tokens issued by them,
+	// except for the built-in admin account which is kept to recover from IdP outages.
+	DisablePasswordLogin bool `json:"disable_password_login"`
+
+	LDAP  AdminSSOLDAPConfig  `json:"ldap"`
+	OAuth AdminSSOOAuthConfig `json:"oauth"`
+	CAS   AdminSSOCASConfig   `json:"cas"`
+
+	// DefaultRole is given to users matching no role mapping, they are denied when empty.
+	DefaultRole    consts.UserRole         `json:"default_role" validate:"omitempty,oneof=admin user"`
+	RoleMappings   []AdminSSORoleMapping   `json:"role_mappings" validate:"dive"`
+	KBPermMappings []AdminSSOKBPermMapping `json:"kb_perm_mappings" validate:"dive"`
+}
+
+type AdminSSOLDAPConfig struct {
+	ServerURL     string `json:"server_url"`
+	BindDN        string `json:"bind_dn"`
+	BindPassword  string `json:"bind_password"`
+	UserBaseDN    string `json:"user_base_dn"`
+	UserFilter    string `json:"user_filter"`
+	UserIDAttr    string `json:"user_id_attr"`
+	UserNameAttr  string `json:"user_name_attr"`
+	UserEmailAttr string `json:"user_email_attr"`
+	GroupAttr     string `json:"group_attr"` // defaults to memberOf, groups are matched by DN
+}
+
+type AdminSSOOAuthConfig struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	AuthorizeURL string   `json:"authorize_url"`
+	TokenURL     string   `json:"token_url"`
+	UserInfoURL  string   `json:"user_info_url"`
+	IDField      string   `json:"id_field"`
+	NameField    string   `json:"name_field"`
+	EmailField   string   `json:"email_field"`
+	GroupsField  string   `json:"groups_field"`
+}
+
+type AdminSSOCASConfig struct {
+	ServerURL string `json:"server_url"`
+	Version   string `json:"version" validate:"omitempty,oneof=2 3"` // groups are only released by CAS 3
+}
+
+type AdminSSORoleMapping struct {
+	Group string          `json:"group" validate:"required"`
+	Role  consts.UserRole `json:"role" validate:"required,oneof=admin user"`
+}
+
+type AdminSSOKBPermMapping struct {
+	Group string                  `json:"group" validate:"required"`
+	KBID  string                  `json:"kb_id" validate:"required"`
+	Perm  consts.UserKBPermission `json:"perm" validate:"required,oneof=full_control doc_manage data_operate"`
+}
+
+// kbPermRank orders the kb permissions so that the strongest one of several groups wins.
+var kbPermRank = map[consts.UserKBPermission]int{
+	consts.UserKBPermissionDataOperate: 1,
+	consts.UserKBPermissionDocManage:   2,
+	consts.UserKBPermissionFullControl: 3,
+}
+
+// ResolveGroups maps the IdP groups of a user to its role and kb permissions, groups are
+// matched case-insensitively. ok is false when the user is not allowed into the console.
+func (s *AdminSSOSetting) ResolveGroups(groups []string) (role consts.UserRole, kbPerms map[string]consts.UserKBPermission, ok bool) {
+	inGroup := func(name string) bool {
+		for _, group := range groups {
+			if strings.EqualFold(strings.TrimSpace(group), strings.TrimSpace(name)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, mapping := range s.RoleMappings {
+		if !inGroup(mapping.Group) {
+			continue
+		}
+		if mapping.Role == consts.UserRoleAdmin || role == "" {
+			role = mapping.Role
+		}
+	}
+	if role == "" {
+		role = s.DefaultRole
+	}
+	if role == "" {
+		return "", nil, false
+	}
+
+	kbPerms = make(map[string]consts.UserKBPermission)
+	if role == consts.UserRoleAdmin {
+		// admins have every permission
+		return role, kbPerms, true
+	}
+	for _, mapping := range s.KBPermMappings {
+		if inGroup(mapping.Group) && kbPermRank[mapping.Perm] > kbPermRank[kbPerms[mapping.KBID]] {
+			kbPerms[mapping.KBID] = mapping.Perm
+		}
+	}
+	return role, kbPerms, true
+}
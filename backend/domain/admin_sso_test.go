@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaitin/panda-wiki/consts"
+)
+
+func TestAdminSSOSettingResolveGroups(t *testing.T) {
+	setting := AdminSSOSetting{
+		RoleMappings: []AdminSSORoleMapping{
+			{Group: "wiki-editors", Role: consts.UserRoleUser},
+			{Group: "cn=wiki-admins,ou=groups,dc=example,dc=com", Role: consts.UserRoleAdmin},
+		},
+		KBPermMappings: []AdminSSOKBPermMapping{
+			{Group: "wiki-editors", KBID: "kb1", Perm: consts.UserKBPermissionDocManage},
+			{Group: "wiki-ops", KBID: "kb1", Perm: consts.UserKBPermissionDataOperate},
+			{Group: "wiki-ops", KBID: "kb2", Perm: consts.UserKBPermissionDataOperate},
+			{Group: "kb2-owners", KBID: "kb2", Perm: consts.UserKBPermissionFullControl},
+		},
+	}
+
+	role, kbPerms, ok := setting.ResolveGroups([]string{"WIKI-EDITORS", "wiki-ops"})
+	require.True(t, ok)
+	require.Equal(t, consts.UserRoleUser, role)
+	require.Equal(t, map[string]consts.UserKBPermission{
+		"kb1": consts.UserKBPermissionDocManage,
+		"kb2": consts.UserKBPermissionDataOperate,
+	}, kbPerms)
+
+	role, kbPerms, ok = setting.ResolveGroups([]string{"wiki-editors", "CN=wiki-admins,ou=groups,dc=example,dc=com"})
+	require.True(t, ok)
+	require.Equal(t, consts.UserRoleAdmin, role)
+	require.Empty(t, kbPerms)
+
+	_, _, ok = setting.ResolveGroups([]string{"kb2-owners"})
+	require.False(t, ok, "no role mapping and no default role")
+
+	setting.DefaultRole = consts.UserRoleUser
+	role, kbPerms, ok = setting.ResolveGroups([]string{"kb2-owners"})
+	require.True(t, ok)
+	require.Equal(t, consts.UserRoleUser, role)
+	require.Equal(t, map[string]consts.UserKBPermission{"kb2": consts.UserKBPermissionFullControl}, kbPerms)
+}
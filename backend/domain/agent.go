@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/samber/lo"
+)
+
+// AgentSettings turns on agent mode for an app. In agent mode the question is rewritten with
+// the conversation history and split into sub-queries, and the model may search the kb, open
+// nodes and list children over several rounds before it answers.
+type AgentSettings struct {
+	IsEnabled bool `json:"is_enabled"`
+	// MaxSteps bounds the tool calls of one answer, 0 uses AgentDefaultMaxSteps
+	MaxSteps int `json:"max_steps"`
+}
+
+const (
+	AgentDefaultMaxSteps = 6
+	AgentMaxSteps        = 12
+	AgentMaxSubQueries   = 4
+	// AgentHistoryMessages is how many previous messages the rewrite sees
+	AgentHistoryMessages = 10
+)
+
+// Steps is MaxSteps bounded to [1, AgentMaxSteps].
+func (s AgentSettings) Steps() int {
+	if s.MaxSteps <= 0 {
+		return AgentDefaultMaxSteps
+	}
+	return min(s.MaxSteps, AgentMaxSteps)
+}
+
+const (
+	AgentOpenNodeToolName     = "open_node"
+	AgentListChildrenToolName = "list_children"
+)
+
+type AgentStepType string
+
+const (
+	AgentStepRewrite      AgentStepType = "rewrite"
+	AgentStepSearch       AgentStepType = "search"
+	AgentStepOpenNode     AgentStepType = "open_node"
+	AgentStepListChildren AgentStepType = "list_children"
+)
+
+// AgentStep is sent in "agent_step" events so clients can show what the agent does before
+// the answer streams.
+type AgentStep struct {
+	Index int           `json:"index"`
+	Type  AgentStepType `json:"type"`
+	// Query is the rewritten question of a rewrite step and the query of a search step
+	Query      string   `json:"query,omitempty"`
+	SubQueries []string `json:"sub_queries,omitempty"`
+	NodeID     string   `json:"node_id,omitempty"`
+	NodeName   string   `json:"node_name,omitempty"`
+	// Results is the number of documents found or children listed
+	Results int    `json:"results"`
+	Error   string `json:"error,omitempty"`
+}
+
+// AgentRewrite is the answer of the model to AgentRewritePrompt.
+type AgentRewrite struct {
+	Question   string   `json:"question"`
+	SubQueries []string `json:"sub_queries"`
+}
+
+// ParseAgentRewrite reads the rewrite answer of the model. Answers that are not json fall
+// back to the original question, the question is always searched when there are no
+// sub-queries.
+func ParseAgentRewrite(content, question string) *AgentRewrite {
+	rewrite := &AgentRewrite{}
+	content = strings.TrimSpace(content)
+	if start, end := strings.Index(content, "{"), strings.LastIndex(content, "}"); start >= 0 && end > start {
+		if err := json.Unmarshal([]byte(content[start:end+1]), rewrite); err != nil {
+			rewrite = &AgentRewrite{}
+		}
+	}
+	rewrite.Question = strings.TrimSpace(rewrite.Question)
+	if rewrite.Question == "" {
+		rewrite.Question = question
+	}
+	subQueries := lo.Uniq(lo.Filter(lo.Map(rewrite.SubQueries, func(query string, _ int) string {
+		return strings.TrimSpace(query)
+	}), func(query string, _ int) bool { return query != "" }))
+	if len(subQueries) == 0 {
+		subQueries = []string{rewrite.Question}
+	}
+	rewrite.SubQueries = subQueries[:min(len(subQueries), AgentMaxSubQueries)]
+	return rewrite
+}
+
+type AgentNodeArguments struct {
+	NodeID string `json:"node_id"`
+}
+
+// AgentToolInfos describes the tools of agent mode to the model.
+func AgentToolInfos() []*schema.ToolInfo {
+	return []*schema.ToolInfo{
+		KBSearchToolInfo(),
+		{
+			Name: AgentOpenNodeToolName,
+			Desc: "Open a document of the knowledge base by its ID and read its full content. Use it when a search result looks relevant but its excerpt is not enough.",
+			ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+				"node_id": {
+					Type:     schema.String,
+					Desc:     "the ID of the document",
+					Required: true,
+				},
+			}),
+		},
+		{
+			Name: AgentListChildrenToolName,
+			Desc: "List the documents and folders directly under a folder of the knowledge base. Use it to browse related documents.",
+			ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+				"node_id": {
+					Type: schema.String,
+					Desc: "the ID of the folder, empty for the top level of the knowledge base",
+				},
+			}),
+		},
+	}
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAgentRewrite(t *testing.T) {
+	rewrite := ParseAgentRewrite("```json\n{\"question\": \" 第二个方案怎么部署？ \", \"sub_queries\": [\"方案二 部署\", \"\", \"方案二 部署\", \"方案二 依赖\"]}\n```", "那第二个呢")
+	assert.Equal(t, "第二个方案怎么部署？", rewrite.Question)
+	assert.Equal(t, []string{"方案二 部署", "方案二 依赖"}, rewrite.SubQueries)
+
+	// answers that are not json fall back to the question
+	rewrite = ParseAgentRewrite("sorry", "那第二个呢")
+	assert.Equal(t, "那第二个呢", rewrite.Question)
+	assert.Equal(t, []string{"那第二个呢"}, rewrite.SubQueries)
+
+	rewrite = ParseAgentRewrite(`{"question": "q", "sub_queries": ["a", "b", "c", "d", "e"]}`, "x")
+	assert.Len(t, rewrite.SubQueries, AgentMaxSubQueries)
+
+	rewrite = ParseAgentRewrite(`{"question": "q"}`, "x")
+	assert.Equal(t, []string{"q"}, rewrite.SubQueries)
+}
+
+func TestAgentSettingsSteps(t *testing.T) {
+	assert.Equal(t, AgentDefaultMaxSteps, AgentSettings{}.Steps())
+	assert.Equal(t, 3, AgentSettings{MaxSteps: 3}.Steps())
+	assert.Equal(t, AgentMaxSteps, AgentSettings{MaxSteps: 100}.Steps())
+}
@@ -0,0 +1,144 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// AnswerCacheSettings turns on the semantic answer cache for an app. The first question of a
+// conversation is answered from the cache when a question of the same kb and auth groups
+// is similar enough and none of the nodes it was answered from changed since.
+type AnswerCacheSettings struct {
+	IsEnabled bool `json:"is_enabled"`
+	// Threshold is the least cosine similarity of the question embeddings, 0 uses
+	// AnswerCacheDefaultThreshold
+	Threshold float64 `json:"threshold"`
+}
+
+const (
+	AnswerCacheDefaultThreshold = 0.95
+	AnswerCacheMinThreshold     = 0.8
+	// AnswerCacheMaxEntries bounds the entries of one kb and auth groups, the least recently
+	// used go first
+	AnswerCacheMaxEntries = 1000
+	AnswerCacheTTL        = 7 * 24 * time.Hour
+)
+
+// MinSimilarity is Threshold bounded to [AnswerCacheMinThreshold, 1].
+func (s AnswerCacheSettings) MinSimilarity() float64 {
+	if s.Threshold <= 0 {
+		return AnswerCacheDefaultThreshold
+	}
+	return min(max(s.Threshold, AnswerCacheMinThreshold), 1)
+}
+
+// AnswerCacheGroupKey is the key of the auth groups a question was asked with, answers are
+// only shared between users who can read the same documents.
+func AnswerCacheGroupKey(groupIDs []int) string {
+	ids := slices.Clone(groupIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return strings.Join(parts, ",")
+}
+
+// table: answer_cache_entries
+type AnswerCacheEntry struct {
+	ID       string `json:"id" gorm:"primaryKey"`
+	KBID     string `json:"kb_id" gorm:"index"`
+	GroupKey string `json:"group_key"`
+	Question string `json:"question"`
+	// Embedding of the question, only compared in SQL and never read back
+	Embedding AnswerCacheEmbedding `json:"-" gorm:"type:vector;->:false;<-:create"`
+	Answer    string               `json:"answer"`
+	// NodeIDs are the nodes the answer was based on, a release of any of them drops the entry
+	NodeIDs    pq.StringArray        `json:"node_ids" gorm:"type:text[]"`
+	References AnswerCacheReferences `json:"references" gorm:"type:jsonb"`
+	Citations  AnswerCitations       `json:"citations" gorm:"type:jsonb"`
+	// TotalTokens is what the answer cost, each hit saves about as much
+	TotalTokens int64     `json:"total_tokens"`
+	HitCount    int64     `json:"hit_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastHitAt   time.Time `json:"last_hit_at"`
+}
+
+func (AnswerCacheEntry) TableName() string {
+	return "answer_cache_entries"
+}
+
+// AnswerCacheReferences are the chunk results sent with a cached answer.
+type AnswerCacheReferences []*NodeContentChunkSSE
+
+func (r AnswerCacheReferences) Value() (driver.Value, error) {
+	if r == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(r)
+}
+
+func (r *AnswerCacheReferences) Scan(value any) error {
+	if value == nil {
+		*r = nil
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New(fmt.Sprint("invalid answer cache references value type:", value))
+	}
+	return json.Unmarshal(b, r)
+}
+
+// AnswerCacheReferencesOf keeps what the chunk results of rankedNodes show.
+func AnswerCacheReferencesOf(rankedNodes []*RankedNodeChunks) AnswerCacheReferences {
+	references := make(AnswerCacheReferences, 0, len(rankedNodes))
+	for _, node := range rankedNodes {
+		references = append(references, &NodeContentChunkSSE{
+			NodeID:        node.NodeID,
+			Name:          node.NodeName,
+			Summary:       node.NodeSummary,
+			NodePathNames: node.NodePathNames,
+		})
+	}
+	return references
+}
+
+// AnswerCacheEmbedding is an embedding stored as a pgvector vector.
+type AnswerCacheEmbedding []float32
+
+// Value is the text form of the vector, "[1,2,3]".
+func (e AnswerCacheEmbedding) Value() (driver.Value, error) {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, v := range e {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(v), 'f', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String(), nil
+}
+
+// table: answer_cache_stats, one row per kb and day
+type AnswerCacheStat struct {
+	KBID        string    `json:"kb_id" gorm:"primaryKey"`
+	Day         time.Time `json:"day" gorm:"primaryKey;type:date"`
+	Lookups     int64     `json:"lookups"`
+	Hits        int64     `json:"hits"`
+	SavedTokens int64     `json:"saved_tokens"`
+}
+
+func (AnswerCacheStat) TableName() string {
+	return "answer_cache_stats"
+}
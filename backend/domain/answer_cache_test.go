@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnswerCacheGroupKey(t *testing.T) {
+	assert.Equal(t, "", AnswerCacheGroupKey(nil))
+	assert.Equal(t, "1,3,7", AnswerCacheGroupKey([]int{7, 1, 3, 7}))
+}
+
+func TestAnswerCacheMinSimilarity(t *testing.T) {
+	assert.Equal(t, AnswerCacheDefaultThreshold, AnswerCacheSettings{}.MinSimilarity())
+	assert.Equal(t, AnswerCacheMinThreshold, AnswerCacheSettings{Threshold: 0.5}.MinSimilarity())
+	assert.Equal(t, 0.9, AnswerCacheSettings{Threshold: 0.9}.MinSimilarity())
+	assert.Equal(t, 1.0, AnswerCacheSettings{Threshold: 2}.MinSimilarity())
+}
+
+func TestAnswerCacheEmbeddingValue(t *testing.T) {
+	value, err := AnswerCacheEmbedding{1, -0.5, 0.125}.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "[1,-0.5,0.125]", value)
+
+	value, err = AnswerCacheEmbedding(nil).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "[]", value)
+}
@@ -3,22 +3,34 @@ package domain
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"slices"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/chaitin/panda-wiki/consts"
 )
 
 type APIToken struct {
-	ID                 string                  `json:"id" gorm:"primaryKey"`
-	Name               string                  `json:"name" gorm:"not null"`
-	UserID             string                  `json:"user_id" gorm:"not null"`
-	Token              string                  `json:"token" gorm:"uniqueIndex;not null"`
+	ID     string `json:"id" gorm:"primaryKey"`
+	Name   string `json:"name" gorm:"not null"`
+	UserID string `json:"user_id" gorm:"not null"`
+	// only the hash of the token is stored, the token itself is shown once
+	TokenHash   string `json:"token_hash" gorm:"uniqueIndex;not null"`
+	TokenPrefix string `json:"token_prefix" gorm:"not null;default:''"`
+	// after a rotation the previous token keeps working until PreviousExpiresAt
+	PreviousTokenHash  string                  `json:"previous_token_hash" gorm:"not null;default:''"`
+	PreviousExpiresAt  *time.Time              `json:"previous_expires_at"`
 	KbId               string                  `json:"kb_id" gorm:"not null"`
 	Permission         consts.UserKBPermission `json:"permission" gorm:"not null"`
+	Scopes             pq.StringArray          `json:"scopes" gorm:"type:text[];not null;default:'{}'"`
+	ExpiresAt          *time.Time              `json:"expires_at"`
 	RateLimitPerMinute int                     `json:"rate_limit_per_minute" gorm:"not null;default:0"`
 	DailyQuota         int                     `json:"daily_quota" gorm:"not null;default:0"`
+	MonthlyTokenQuota  int64                   `json:"monthly_token_quota" gorm:"not null;default:0"`
 	CreatedAt          time.Time               `json:"created_at"`
 	UpdatedAt          time.Time               `json:"updated_at"`
 }
@@ -27,12 +39,53 @@ func (APIToken) TableName() string {
 	return "api_tokens"
 }
 
+// Valid reports whether the token presented with hash is usable at now.
+func (t *APIToken) Valid(hash string, now time.Time) bool {
+	if t.ExpiresAt != nil && !now.Before(*t.ExpiresAt) {
+		return false
+	}
+	if hash == t.TokenHash {
+		return true
+	}
+	return t.PreviousTokenHash != "" && hash == t.PreviousTokenHash &&
+		t.PreviousExpiresAt != nil && now.Before(*t.PreviousExpiresAt)
+}
+
+// HasScope reports whether the token may call routes of scope.
+func (t *APIToken) HasScope(scope consts.APITokenScope) bool {
+	if slices.Contains(t.Scopes, string(scope)) {
+		return true
+	}
+	return len(t.Scopes) == 0 && scope != consts.APITokenScopeSCIM
+}
+
+func (t *APIToken) ToListItem() *APITokenListItem {
+	return &APITokenListItem{
+		ID:                 t.ID,
+		Name:               t.Name,
+		TokenPrefix:        t.TokenPrefix,
+		Permission:         t.Permission,
+		Scopes:             append([]string{}, t.Scopes...),
+		ExpiresAt:          t.ExpiresAt,
+		PreviousExpiresAt:  t.PreviousExpiresAt,
+		RateLimitPerMinute: t.RateLimitPerMinute,
+		DailyQuota:         t.DailyQuota,
+		MonthlyTokenQuota:  t.MonthlyTokenQuota,
+		CreatedAt:          t.CreatedAt,
+		UpdatedAt:          t.UpdatedAt,
+	}
+}
+
 type CreateAPITokenReq struct {
-	KBID               string                  `json:"kb_id" validate:"required"`
-	Name               string                  `json:"name" validate:"required"`
-	Permission         consts.UserKBPermission `json:"permission" validate:"required,oneof=full_control doc_manage data_operate"`
-	RateLimitPerMinute int                     `json:"rate_limit_per_minute" validate:"gte=0"`
-	DailyQuota         int                     `json:"daily_quota" validate:"gte=0"`
+	KBID       string                  `json:"kb_id" validate:"required"`
+	Name       string                  `json:"name" validate:"required"`
+	Permission consts.UserKBPermission `json:"permission" validate:"required,oneof=full_control doc_manage data_operate"`
+	// empty scopes allow everything the permission allows
+	Scopes             []consts.APITokenScope `json:"scopes" validate:"omitempty,dive,oneof=node:read node:write publish chat mcp stats scim"`
+	ExpiresAt          *time.Time             `json:"expires_at,omitempty"`
+	RateLimitPerMinute int                    `json:"rate_limit_per_minute" validate:"gte=0"`
+	DailyQuota         int                    `json:"daily_quota" validate:"gte=0"`
+	MonthlyTokenQuota  int64                  `json:"monthly_token_quota" validate:"gte=0"`
 }
 
 type APITokenListReq struct {
@@ -40,12 +93,18 @@ type APITokenListReq struct {
 }
 
 type APITokenListItem struct {
-	ID                 string                  `json:"id"`
-	Name               string                  `json:"name"`
-	Token              string                  `json:"token"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Token is only returned when the token is created or rotated
+	Token              string                  `json:"token,omitempty"`
+	TokenPrefix        string                  `json:"token_prefix"`
 	Permission         consts.UserKBPermission `json:"permission"`
+	Scopes             []string                `json:"scopes"`
+	ExpiresAt          *time.Time              `json:"expires_at"`
+	PreviousExpiresAt  *time.Time              `json:"previous_expires_at"`
 	RateLimitPerMinute int                     `json:"rate_limit_per_minute"`
 	DailyQuota         int                     `json:"daily_quota"`
+	MonthlyTokenQuota  int64                   `json:"monthly_token_quota"`
 	CreatedAt          time.Time               `json:"created_at"`
 	UpdatedAt          time.Time               `json:"updated_at"`
 }
@@ -55,12 +114,16 @@ type UpdateAPITokenReq struct {
 	KBID               string                   `json:"kb_id" validate:"required"`
 	Name               *string                  `json:"name,omitempty"`
 	Permission         *consts.UserKBPermission `json:"permission,omitempty" validate:"omitempty,oneof=full_control doc_manage data_operate"`
+	Scopes             *[]consts.APITokenScope  `json:"scopes,omitempty" validate:"omitempty,dive,oneof=node:read node:write publish chat mcp stats scim"`
+	ExpiresAt          *time.Time               `json:"expires_at,omitempty"`
 	RateLimitPerMinute *int                     `json:"rate_limit_per_minute,omitempty" validate:"omitempty,gte=0"`
 	DailyQuota         *int                     `json:"daily_quota,omitempty" validate:"omitempty,gte=0"`
+	MonthlyTokenQuota  *int64                   `json:"monthly_token_quota,omitempty" validate:"omitempty,gte=0"`
 }
 
 func (r UpdateAPITokenReq) HasUpdates() bool {
-	return r.Name != nil || r.Permission != nil || r.RateLimitPerMinute != nil || r.DailyQuota != nil
+	return r.Name != nil || r.Permission != nil || r.Scopes != nil || r.ExpiresAt != nil ||
+		r.RateLimitPerMinute != nil || r.DailyQuota != nil || r.MonthlyTokenQuota != nil
 }
 
 type DeleteAPITokenReq struct {
@@ -68,6 +131,35 @@ type DeleteAPITokenReq struct {
 	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
 }
 
+type RotateAPITokenReq struct {
+	ID   string `json:"id" validate:"required"`
+	KBID string `json:"kb_id" validate:"required"`
+	// OverlapMinutes keeps the previous token working for at most 7 days, 0 revokes it at once
+	OverlapMinutes int `json:"overlap_minutes" validate:"gte=0,lte=10080"`
+}
+
+type APITokenUsageReq struct {
+	KBID    string `json:"kb_id" query:"kb_id" validate:"required"`
+	TokenID string `json:"token_id" query:"token_id"`
+	// Interval buckets the usage by day or month
+	Interval string    `json:"interval" query:"interval" validate:"omitempty,oneof=day month"`
+	Start    time.Time `json:"start" query:"start" validate:"required"`
+	End      time.Time `json:"end" query:"end" validate:"required,gtfield=Start"`
+}
+
+type APITokenUsageItem struct {
+	Period           time.Time `json:"period"`
+	TokenID          string    `json:"token_id"`
+	TokenName        string    `json:"token_name"`
+	Endpoint         string    `json:"endpoint"`
+	Model            string    `json:"model"`
+	Calls            int64     `json:"calls"`
+	FailedCalls      int64     `json:"failed_calls"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	TotalTokens      int64     `json:"total_tokens"`
+}
+
 func GenerateAPITokenValue() (string, error) {
 	randomBytes := make([]byte, 32)
 	if _, err := rand.Read(randomBytes); err != nil {
@@ -76,11 +168,24 @@ func GenerateAPITokenValue() (string, error) {
 	return hex.EncodeToString(randomBytes), nil
 }
 
+// HashAPIToken is the form a token is stored and looked up in.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APITokenPrefix is the part of a token shown in lists so users can tell tokens apart.
+func APITokenPrefix(token string) string {
+	return token[:min(len(token), 8)]
+}
+
 type CtxAuthInfo struct {
 	IsToken    bool
 	Permission consts.UserKBPermission
 	UserId     string
 	KBId       string
+	// Token is the api token of the request when IsToken is set
+	Token *APIToken
 }
 
 type contextKey string
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaitin/panda-wiki/consts"
+)
+
+func TestAPITokenValid(t *testing.T) {
+	now := time.Now()
+	token := &APIToken{TokenHash: HashAPIToken("current")}
+	assert.True(t, token.Valid(HashAPIToken("current"), now))
+	assert.False(t, token.Valid(HashAPIToken("other"), now))
+	// an empty previous hash never matches
+	assert.False(t, token.Valid("", now))
+
+	token.ExpiresAt = lo.ToPtr(now.Add(-time.Second))
+	assert.False(t, token.Valid(HashAPIToken("current"), now))
+	token.ExpiresAt = lo.ToPtr(now.Add(time.Hour))
+	assert.True(t, token.Valid(HashAPIToken("current"), now))
+
+	// the previous token works during the rotation overlap only
+	token.PreviousTokenHash = HashAPIToken("previous")
+	token.PreviousExpiresAt = lo.ToPtr(now.Add(time.Minute))
+	assert.True(t, token.Valid(HashAPIToken("previous"), now))
+	assert.False(t, token.Valid(HashAPIToken("previous"), now.Add(2*time.Minute)))
+	token.PreviousExpiresAt = nil
+	assert.False(t, token.Valid(HashAPIToken("previous"), now))
+}
+
+func TestAPITokenHasScope(t *testing.T) {
+	token := &APIToken{}
+	assert.True(t, token.HasScope(consts.APITokenScopePublish))
+	assert.False(t, token.HasScope(consts.APITokenScopeSCIM), "scim is never implied")
+
+	token.Scopes = pq.StringArray{string(consts.APITokenScopeNodeRead), string(consts.APITokenScopeChat)}
+	assert.True(t, token.HasScope(consts.APITokenScopeNodeRead))
+	assert.True(t, token.HasScope(consts.APITokenScopeChat))
+	assert.False(t, token.HasScope(consts.APITokenScopeNodeWrite))
+	assert.False(t, token.HasScope(consts.APITokenScopeMCP))
+
+	token.Scopes = pq.StringArray{string(consts.APITokenScopeSCIM)}
+	assert.True(t, token.HasScope(consts.APITokenScopeSCIM))
+}
+
+func TestHashAPIToken(t *testing.T) {
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", HashAPIToken(""))
+	assert.Equal(t, HashAPIToken("token"), HashAPIToken("token"))
+	assert.NotEqual(t, HashAPIToken("token"), HashAPIToken("token2"))
+	assert.Equal(t, "01234567", APITokenPrefix("0123456789"))
+	assert.Equal(t, "abc", APITokenPrefix("abc"))
+}
@@ -25,6 +25,7 @@ const (
 	AppTypeWecomAIBot
 	AppTypeLarkBot
 	AppTypeMcpServer
+	AppTypeSlackBot
 )
 
 var AppTypes = []AppType{
@@ -40,6 +41,7 @@ var AppTypes = []AppType{
 	AppTypeWecomAIBot,
 	AppTypeLarkBot,
 	AppTypeMcpServer,
+	AppTypeSlackBot,
 }
 
 func (t AppType) ToSourceType() consts.SourceType {
@@ -66,6 +68,8 @@ func (t AppType) ToSourceType() consts.SourceType {
 		return consts.SourceTypeOpenAIAPI
 	case AppTypeLarkBot:
 		return consts.SourceTypeLarkBot
+	case AppTypeSlackBot:
+		return consts.SourceTypeSlackBot
 	default:
 		return ""
 	}
@@ -114,6 +118,8 @@ type AppSettings struct {
 	FeishuBotAppSecret string `json:"feishu_bot_app_secret,omitempty"`
 	// LarkBot
 	LarkBotSettings LarkBotSettings `json:"lark_bot_settings,omitempty"`
+	// SlackBot
+	SlackBotSettings SlackBotSettings `json:"slack_bot_settings,omitempty"`
 	// WechatAppBot 企业微信机器人
 	WeChatAppIsEnabled       *bool                    `json:"wechat_app_is_enabled,omitempty"`
 	WeChatAppToken           string                   `json:"wechat_app_token,omitempty"`
@@ -162,6 +168,14 @@ type AppSettings struct {
 	DocumentFeedBackIsEnabled *bool `json:"document_feedback_is_enabled,omitempty"`
 	// AI feedback
 	AIFeedbackSettings AIFeedbackSettings `json:"ai_feedback_settings"`
+	// agent mode
+	AgentSettings AgentSettings `json:"agent_settings"`
+	// semantic answer cache
+	AnswerCacheSettings AnswerCacheSettings `json:"answer_cache_settings"`
+	// grounding check of answers
+	GroundingSettings GroundingSettings `json:"grounding_settings"`
+	// human handoff of bot conversations
+	HandoffSettings HandoffSettings `json:"handoff_settings"`
 	// WebAppCustomStyle
 	WebAppCustomSettings WebAppCustomSettings `json:"web_app_custom_style"`
 	// OpenAI API Bot settings
@@ -270,6 +284,12 @@ type LarkBotSettings struct {
 	EncryptKey  string `json:"encrypt_key"`
 }
 
+type SlackBotSettings struct {
+	IsEnabled     *bool  `json:"is_enabled"`
+	BotToken      string `json:"bot_token"`
+	SigningSecret string `json:"signing_secret"`
+}
+
 type BannerConfig struct {
 	Title            string   `json:"title"`
 	TitleColor       string   `json:"title_color"`
@@ -577,6 +597,8 @@ type AppSettingsResp struct {
 	FeishuBotAppSecret string `json:"feishu_bot_app_secret,omitempty"`
 	// LarkBot
 	LarkBotSettings LarkBotSettings `json:"lark_bot_settings,omitempty"`
+	// SlackBot
+	SlackBotSettings SlackBotSettings `json:"slack_bot_settings,omitempty"`
 	// WechatAppBot
 	WeChatAppIsEnabled       *bool                    `json:"wechat_app_is_enabled,omitempty"`
 	WeChatAppToken           string                   `json:"wechat_app_token,omitempty"`
@@ -626,6 +648,14 @@ type AppSettingsResp struct {
 	DocumentFeedBackIsEnabled *bool `json:"document_feedback_is_enabled,omitempty"`
 	// AI feedback
 	AIFeedbackSettings AIFeedbackSettings `json:"ai_feedback_settings"`
+	// agent mode
+	AgentSettings AgentSettings `json:"agent_settings"`
+	// semantic answer cache
+	AnswerCacheSettings AnswerCacheSettings `json:"answer_cache_settings"`
+	// grounding check of answers
+	GroundingSettings GroundingSettings `json:"grounding_settings"`
+	// human handoff of bot conversations
+	HandoffSettings HandoffSettings `json:"handoff_settings"`
 	// WebAppCustomStyle
 	WebAppCustomSettings WebAppCustomSettings `json:"web_app_custom_style"`
 
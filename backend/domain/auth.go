@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -28,8 +30,15 @@ type Auth struct {
 	CreatedAt     time.Time         `gorm:"column:created_at;not null;default:now()" json:"created_at"`       // Timestamp when the record was created
 	UpdatedAt     time.Time         `gorm:"column:updated_at;not null;default:now()" json:"updated_at"`       // Timestamp when the record was last updated
 	UserInfo      AuthUserInfo      `json:"user_info" gorm:"type:jsonb"`
+
+	// ScimUserName is the userName of readers provisioned over SCIM.
+	ScimUserName string `gorm:"column:scim_user_name;not null;default:''" json:"scim_user_name,omitempty"`
+	// Disabled readers were deactivated by the IdP, they can not log in.
+	Disabled bool `gorm:"column:disabled;not null;default:false" json:"disabled"`
 }
 
+var ErrAuthDisabled = errors.New("the user is deactivated")
+
 func (Auth) TableName() string {
 	return "auths"
 }
@@ -85,6 +94,32 @@ type AuthSetting struct {
 	ClientID     string `json:"client_id,omitempty"`
 	ClientSecret string `json:"client_secret,omitempty"`
 	Proxy        string `json:"proxy,omitempty"`
+
+	// OIDC
+	Issuer string   `json:"issuer,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+
+	// SAML, the SP key pair is generated when the config is first saved
+	IdPMetadataURL string `json:"idp_metadata_url,omitempty"`
+	IdPMetadata    string `json:"idp_metadata,omitempty"`
+	SPCertificate  string `json:"sp_certificate,omitempty"`
+	SPPrivateKey   string `json:"sp_private_key,omitempty"`
+
+	// GroupsClaim is the OIDC claim or SAML attribute listing the groups of the user, they
+	// are mapped to the AuthGroup of the same SyncId. Group mapping is off when empty.
+	GroupsClaim string `json:"groups_claim,omitempty"`
+}
+
+// NormalizeGroupClaims trims the group claims of an IdP and drops empty and duplicate ones.
+func NormalizeGroupClaims(groups []string) []string {
+	result := make([]string, 0, len(groups))
+	for _, group := range groups {
+		group = strings.TrimSpace(group)
+		if group != "" && !slices.Contains(result, group) {
+			result = append(result, group)
+		}
+	}
+	return result
 }
 
 type AuthInfo struct {
@@ -0,0 +1,12 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeGroupClaims(t *testing.T) {
+	require.Equal(t, []string{"engineering", "wiki-admins"}, NormalizeGroupClaims([]string{" engineering", "", "wiki-admins", "engineering "}))
+	require.Empty(t, NormalizeGroupClaims(nil))
+}
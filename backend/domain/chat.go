@@ -23,6 +23,9 @@ type ChatRequest struct {
 	RemoteIP string           `json:"-"`
 	Info     ConversationInfo `json:"-"`
 	Prompt   string           `json:"-"`
+
+	// OpenAI is set by the OpenAI-compatible api, Message is then the last user message.
+	OpenAI *OpenAIChatOptions `json:"-"`
 }
 
 type ChatRagOnlyRequest struct {
@@ -36,6 +39,9 @@ type ChatRagOnlyRequest struct {
 
 type ConversationInfo struct {
 	UserInfo UserInfo `json:"user_info"`
+	// ChannelID is where the bot can push messages of the conversation, set by bots that
+	// deliver human handoff replies, see bot.MessageSender
+	ChannelID string `json:"channel_id,omitempty"`
 }
 
 type UserInfo struct {
@@ -0,0 +1,195 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AnswerCitation links one sentence of an answer to the chunk that supports it. Sentences
+// that are claims without support are kept with Supported unset, they are the unsupported
+// claims of the answer.
+type AnswerCitation struct {
+	SentenceIndex int    `json:"sentence_index"`
+	Sentence      string `json:"sentence"`
+	NodeID        string `json:"node_id,omitempty"`
+	NodeName      string `json:"node_name,omitempty"`
+	ChunkID       string `json:"chunk_id,omitempty"`
+	URL           string `json:"url,omitempty"`
+	Supported     bool   `json:"supported"`
+}
+
+type AnswerCitations []*AnswerCitation
+
+// GroundingSettings turns on the grounding check of an app's answers. The check asks the
+// chat model again after every answer, so it is off unless enabled.
+type GroundingSettings struct {
+	IsEnabled bool `json:"is_enabled"`
+}
+
+func (c AnswerCitations) Value() (driver.Value, error) {
+	if c == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(c)
+}
+
+func (c *AnswerCitations) Scan(value any) error {
+	if value == nil {
+		*c = nil
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New(fmt.Sprint("invalid answer citations value type:", value))
+	}
+	return json.Unmarshal(b, c)
+}
+
+// Ungrounded reports whether any claim of the answer is unsupported.
+func (c AnswerCitations) Ungrounded() bool {
+	for _, citation := range c {
+		if !citation.Supported {
+			return true
+		}
+	}
+	return false
+}
+
+// GroundingChunk is one retrieved chunk the answer may be grounded in, numbered from 1 in
+// the verification prompt.
+type GroundingChunk struct {
+	NodeID   string
+	NodeName string
+	ChunkID  string
+	URL      string
+	Content  string
+}
+
+const (
+	GroundingMaxChunks       = 30
+	GroundingChunkRuneLimit  = 1000
+	groundingMinSentenceRune = 4
+)
+
+// GroundingChunks flattens the retrieved documents into distinct chunks.
+func GroundingChunks(rankedNodes []*RankedNodeChunks, baseURL string) []*GroundingChunk {
+	chunks := make([]*GroundingChunk, 0)
+	seen := make(map[string]bool)
+	for _, node := range rankedNodes {
+		for _, chunk := range node.Chunks {
+			content := strings.TrimSpace(chunk.Content)
+			key := node.NodeID + "\x00" + content
+			if content == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			if runes := []rune(content); len(runes) > GroundingChunkRuneLimit {
+				content = string(runes[:GroundingChunkRuneLimit])
+			}
+			chunks = append(chunks, &GroundingChunk{
+				NodeID:   node.NodeID,
+				NodeName: node.NodeName,
+				ChunkID:  chunk.ID,
+				URL:      node.GetURL(baseURL),
+				Content:  content,
+			})
+			if len(chunks) >= GroundingMaxChunks {
+				return chunks
+			}
+		}
+	}
+	return chunks
+}
+
+var (
+	answerCitationMarkPattern = regexp.MustCompile(`,?\[\[\d+\]\([^)]*\)\]`)
+	answerSentencePattern     = regexp.MustCompile(`[^。！？!?；;\n]+[。！？!?；;]*`)
+)
+
+// AnswerSentences splits an answer into the sentences to ground. Thinking, the reference
+// list and the inline citation marks the prompt asks for are not part of them.
+func AnswerSentences(answer string) []string {
+	if strings.HasPrefix(answer, "<think>") {
+		if _, after, ok := strings.Cut(answer, "</think>"); ok {
+			answer = after
+		}
+	}
+	if i := strings.LastIndex(answer, "引用列表"); i >= 0 {
+		answer = answer[:i]
+		answer = strings.TrimRight(strings.TrimRight(answer, "# \n"), "-")
+	}
+	answer = answerCitationMarkPattern.ReplaceAllString(answer, "")
+
+	sentences := make([]string, 0)
+	for _, sentence := range answerSentencePattern.FindAllString(answer, -1) {
+		sentence = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(sentence), "#>-*0123456789. "))
+		if len([]rune(sentence)) < groundingMinSentenceRune {
+			continue
+		}
+		sentences = append(sentences, sentence)
+	}
+	return sentences
+}
+
+// GroundingJudgement is one item of the answer to GroundingPrompt. Chunk is the number of the
+// supporting chunk, 0 when none supports the sentence.
+type GroundingJudgement struct {
+	Index int   `json:"index"`
+	Chunk int   `json:"chunk"`
+	Claim *bool `json:"claim"`
+}
+
+// BuildGroundingInput numbers the chunks and sentences for GroundingPrompt.
+func BuildGroundingInput(sentences []string, chunks []*GroundingChunk) string {
+	var input strings.Builder
+	input.WriteString("<chunks>\n")
+	for i, chunk := range chunks {
+		fmt.Fprintf(&input, "[%d] %s\n%s\n\n", i+1, chunk.NodeName, chunk.Content)
+	}
+	input.WriteString("</chunks>\n\n<sentences>\n")
+	for i, sentence := range sentences {
+		fmt.Fprintf(&input, "%d. %s\n", i+1, sentence)
+	}
+	input.WriteString("</sentences>")
+	return input.String()
+}
+
+// ParseGroundingJudgements turns the answer to GroundingPrompt into citations. Sentences the
+// model skipped are not claims, sentences that are claims without a valid chunk are
+// unsupported.
+func ParseGroundingJudgements(content string, sentences []string, chunks []*GroundingChunk) (AnswerCitations, error) {
+	start, end := strings.Index(content, "["), strings.LastIndex(content, "]")
+	if start < 0 || end <= start {
+		return nil, errors.New("grounding answer has no json array")
+	}
+	var judgements []GroundingJudgement
+	if err := json.Unmarshal([]byte(content[start:end+1]), &judgements); err != nil {
+		return nil, fmt.Errorf("invalid grounding answer: %w", err)
+	}
+
+	citations := make(AnswerCitations, 0, len(judgements))
+	seen := make(map[int]bool)
+	for _, judgement := range judgements {
+		if judgement.Index < 1 || judgement.Index > len(sentences) || seen[judgement.Index] {
+			continue
+		}
+		seen[judgement.Index] = true
+		citation := &AnswerCitation{SentenceIndex: judgement.Index - 1, Sentence: sentences[judgement.Index-1]}
+		if judgement.Chunk >= 1 && judgement.Chunk <= len(chunks) {
+			chunk := chunks[judgement.Chunk-1]
+			citation.NodeID = chunk.NodeID
+			citation.NodeName = chunk.NodeName
+			citation.ChunkID = chunk.ChunkID
+			citation.URL = chunk.URL
+			citation.Supported = true
+		} else if judgement.Claim != nil && !*judgement.Claim {
+			continue
+		}
+		citations = append(citations, citation)
+	}
+	return citations, nil
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnswerSentences(t *testing.T) {
+	answer := "<think>先想一想</think>PandaWiki 支持多种模型[[1](https://wiki.example.com/node/a)]。部署需要 Docker！\n\n好的\n\n---\n### 引用列表\n1. [文档](https://wiki.example.com/node/a)"
+	require.Equal(t, []string{"PandaWiki 支持多种模型。", "部署需要 Docker！"}, AnswerSentences(answer))
+	require.Empty(t, AnswerSentences(""))
+}
+
+func TestGroundingChunks(t *testing.T) {
+	rankedNodes := []*RankedNodeChunks{
+		{NodeID: "n1", NodeName: "安装", Chunks: []*NodeContentChunk{
+			{ID: "c1", Content: " 使用 docker 安装 "},
+			{ID: "c2", Content: "使用 docker 安装"},
+			{ID: "c3", Content: ""},
+		}},
+		{NodeID: "n2", NodeName: "模型", Chunks: []*NodeContentChunk{{ID: "c4", Content: "支持多种模型"}}},
+	}
+	chunks := GroundingChunks(rankedNodes, "")
+	require.Len(t, chunks, 2)
+	require.Equal(t, "c1", chunks[0].ChunkID)
+	require.Equal(t, "使用 docker 安装", chunks[0].Content)
+	require.Equal(t, "n2", chunks[1].NodeID)
+}
+
+func TestParseGroundingJudgements(t *testing.T) {
+	sentences := []string{"PandaWiki 支持多种模型。", "部署需要 Docker！", "希望对你有帮助。"}
+	chunks := []*GroundingChunk{{NodeID: "n1", NodeName: "模型", ChunkID: "c1", URL: "https://wiki.example.com/node/n1"}}
+
+	citations, err := ParseGroundingJudgements("```json\n"+`[
+		{"index": 1, "claim": true, "chunk": 1},
+		{"index": 1, "claim": true, "chunk": 0},
+		{"index": 2, "claim": true, "chunk": 5},
+		{"index": 3, "claim": false, "chunk": 0},
+		{"index": 9, "claim": true, "chunk": 1}
+	]`+"\n```", sentences, chunks)
+	require.NoError(t, err)
+	require.Len(t, citations, 2)
+	require.True(t, citations[0].Supported)
+	require.Equal(t, "c1", citations[0].ChunkID)
+	require.Equal(t, 0, citations[0].SentenceIndex)
+	require.False(t, citations[1].Supported)
+	require.Equal(t, "部署需要 Docker！", citations[1].Sentence)
+	require.True(t, citations.Ungrounded())
+	require.False(t, citations[:1].Ungrounded())
+
+	_, err = ParseGroundingJudgements("all supported", sentences, chunks)
+	require.Error(t, err)
+}
@@ -22,6 +22,9 @@ type Conversation struct {
 	RemoteIP  string           `json:"remote_ip"`
 	Info      ConversationInfo `json:"info" gorm:"type:jsonb"`
 	CreatedAt time.Time        `json:"created_at"`
+
+	// Anonymized is set once the retention policy masked the remote ip and user info
+	Anonymized bool `json:"anonymized" gorm:"not null;default:false"`
 }
 
 type ConversationMessage struct {
@@ -50,6 +53,12 @@ type ConversationMessage struct {
 
 	// parent_id
 	ParentID string `json:"parent_id"`
+
+	// grounding of assistant answers, Ungrounded is set when a claim has no supporting chunk
+	Citations  AnswerCitations `json:"citations" gorm:"type:jsonb"`
+	Ungrounded bool            `json:"ungrounded" gorm:"not null;default:false"`
+	// RetrievedChunks is how many chunks retrieval found for an assistant answer
+	RetrievedChunks *int `json:"retrieved_chunks,omitempty"`
 }
 
 type FeedBackInfo struct {
@@ -87,6 +96,9 @@ type ConversationListReq struct {
 
 	RemoteIP *string `json:"remote_ip" query:"remote_ip"`
 
+	// Ungrounded only lists conversations with an answer that has unsupported claims
+	Ungrounded bool `json:"ungrounded" query:"ungrounded"`
+
 	Pager
 }
 
@@ -104,6 +116,8 @@ type ConversationListItem struct {
 	CreatedAt time.Time `json:"created_at"`
 
 	FeedBackInfo *FeedBackInfo `json:"feedback_info" gorm:"-"` // 用户反馈信息
+
+	Ungrounded bool `json:"ungrounded"` // 有回答包含无依据的内容
 }
 
 type ConversationDetailResp struct {
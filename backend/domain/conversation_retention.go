@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const SettingConversationRetention = "conversation_retention"
+
+type ConversationRetentionAction string
+
+const (
+	// ConversationRetentionActionDelete deletes old conversations with their messages
+	ConversationRetentionActionDelete ConversationRetentionAction = "delete"
+	// ConversationRetentionActionAnonymize keeps old conversations but masks the remote ip
+	// and the user info
+	ConversationRetentionActionAnonymize ConversationRetentionAction = "anonymize"
+)
+
+// ConversationRetentionSettings of a kb are applied daily by the consumer to the
+// conversations without messages in the last Days days.
+type ConversationRetentionSettings struct {
+	Enabled bool                        `json:"enabled"`
+	Days    int                         `json:"days" validate:"omitempty,min=1,max=3650"`
+	Action  ConversationRetentionAction `json:"action" validate:"omitempty,oneof=delete anonymize"`
+}
+
+type UpdateConversationRetentionReq struct {
+	KBID string `json:"kb_id" validate:"required"`
+	ConversationRetentionSettings
+}
+
+var ErrConversationRetentionInvalid = errors.New("retention needs days and an action when enabled")
+
+func (s *ConversationRetentionSettings) Check() error {
+	if s.Enabled && (s.Days < 1 || s.Action == "") {
+		return ErrConversationRetentionInvalid
+	}
+	return nil
+}
+
+// Before is the time conversations without newer messages are due.
+func (s *ConversationRetentionSettings) Before(now time.Time) time.Time {
+	return now.AddDate(0, 0, -s.Days)
+}
+
+type ConversationExportFormat string
+
+const (
+	ConversationExportFormatJSONL ConversationExportFormat = "jsonl"
+	ConversationExportFormatCSV   ConversationExportFormat = "csv"
+)
+
+// ConversationExportReq exports the conversations GetConversationList would list, the pager
+// is ignored.
+type ConversationExportReq struct {
+	ConversationListReq
+	Format ConversationExportFormat `json:"format" query:"format" validate:"omitempty,oneof=jsonl csv"`
+}
+
+// ConversationExportBatchSize is how many conversations are loaded at once while exporting.
+const ConversationExportBatchSize = 200
+
+// ConversationExportItem is one line of a jsonl export.
+type ConversationExportItem struct {
+	*ConversationListItem
+	Messages   []*ConversationMessage   `json:"messages"`
+	References []*ConversationReference `json:"references"`
+}
+
+// ConversationExportCSVHeader names the columns of a csv export, one row per message.
+var ConversationExportCSVHeader = []string{
+	"conversation_id", "app_name", "app_type", "subject", "remote_ip", "user_name", "user_email", "conversation_created_at",
+	"message_id", "role", "content", "model", "total_tokens", "feedback_score", "feedback_type", "feedback_content",
+	"ungrounded", "references", "created_at",
+}
+
+// WriteConversationExportCSV writes the messages of item as csv rows, the references of the
+// conversation are joined into each assistant row.
+func WriteConversationExportCSV(w *csv.Writer, item *ConversationExportItem) error {
+	references := make([]string, 0, len(item.References))
+	for _, reference := range item.References {
+		references = append(references, reference.URL)
+	}
+	for _, message := range item.Messages {
+		messageReferences := ""
+		if message.Role == schema.Assistant {
+			messageReferences = strings.Join(references, "\n")
+		}
+		row := []string{
+			item.ID, item.AppName, strconv.Itoa(int(item.AppType)), item.Subject, item.RemoteIP,
+			item.Info.UserInfo.NickName, item.Info.UserInfo.Email, item.CreatedAt.Format(time.RFC3339),
+			message.ID, string(message.Role), message.Content, message.Model, strconv.Itoa(message.TotalTokens),
+			strconv.Itoa(int(message.Info.Score)), string(message.Info.FeedbackType), message.Info.FeedbackContent,
+			strconv.FormatBool(message.Ungrounded), messageReferences, message.CreatedAt.Format(time.RFC3339),
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversationRetentionSettingsCheck(t *testing.T) {
+	assert.NoError(t, (&ConversationRetentionSettings{}).Check())
+	assert.ErrorIs(t, (&ConversationRetentionSettings{Enabled: true, Action: ConversationRetentionActionDelete}).Check(), ErrConversationRetentionInvalid)
+	assert.ErrorIs(t, (&ConversationRetentionSettings{Enabled: true, Days: 30}).Check(), ErrConversationRetentionInvalid)
+	assert.NoError(t, (&ConversationRetentionSettings{Enabled: true, Days: 30, Action: ConversationRetentionActionAnonymize}).Check())
+
+	now := time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), (&ConversationRetentionSettings{Days: 30}).Before(now))
+}
+
+func TestWriteConversationExportCSV(t *testing.T) {
+	created := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	item := &ConversationExportItem{
+		ConversationListItem: &ConversationListItem{ID: "c1", AppName: "web", AppType: AppTypeWeb, Subject: "如何部署", CreatedAt: created},
+		Messages: []*ConversationMessage{
+			{ID: "m1", Role: schema.User, Content: "如何部署", CreatedAt: created},
+			{ID: "m2", Role: schema.Assistant, Content: "使用 docker, 见文档", TotalTokens: 42, Info: FeedBackInfo{Score: Like}, CreatedAt: created},
+		},
+		References: []*ConversationReference{{URL: "https://wiki.example.com/node/a"}, {URL: "https://wiki.example.com/node/b"}},
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	require.NoError(t, WriteConversationExportCSV(w, item))
+	w.Flush()
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	for _, row := range rows {
+		assert.Len(t, row, len(ConversationExportCSVHeader))
+	}
+	assert.Equal(t, "", rows[0][17])
+	assert.Equal(t, "使用 docker, 见文档", rows[1][10])
+	assert.Equal(t, "42", rows[1][12])
+	assert.Equal(t, "https://wiki.example.com/node/a\nhttps://wiki.example.com/node/b", rows[1][17])
+}
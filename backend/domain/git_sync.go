@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrGitSyncRunning = errors.New("git sync is already running for this knowledge base")
+
+const (
+	SettingGitSync = "git_sync_settings"
+
+	DefaultGitSyncIntervalMinutes = 60
+)
+
+// GitSyncSettings configures the git repository a knowledge base is synced with.
+// Token is write-only: it is never returned and an empty value keeps the saved one.
+type GitSyncSettings struct {
+	Enabled         bool   `json:"enabled"`
+	RepoURL         string `json:"repo_url" validate:"max=2048"`
+	Branch          string `json:"branch" validate:"max=255"`
+	SubDir          string `json:"sub_dir" validate:"max=1024"`
+	Username        string `json:"username" validate:"max=255"`
+	Token           string `json:"token,omitempty" validate:"max=1024"`
+	IntervalMinutes int    `json:"interval_minutes" validate:"gte=0,lte=10080"`
+	AuthorName      string `json:"author_name" validate:"max=255"`
+	AuthorEmail     string `json:"author_email" validate:"omitempty,email"`
+}
+
+func (s *GitSyncSettings) Interval() time.Duration {
+	if s.IntervalMinutes <= 0 {
+		return DefaultGitSyncIntervalMinutes * time.Minute
+	}
+	return time.Duration(s.IntervalMinutes) * time.Minute
+}
+
+type GitSyncSettingsResp struct {
+	GitSyncSettings
+	HasToken bool `json:"has_token"`
+}
+
+type UpdateGitSyncSettingsReq struct {
+	KBID string `json:"kb_id" validate:"required"`
+	GitSyncSettings
+}
+
+type GitSyncDirection string
+
+const (
+	GitSyncDirectionImport GitSyncDirection = "import"
+	GitSyncDirectionExport GitSyncDirection = "export"
+)
+
+type GitSyncTrigger string
+
+const (
+	GitSyncTriggerManual   GitSyncTrigger = "manual"
+	GitSyncTriggerSchedule GitSyncTrigger = "schedule"
+)
+
+type GitSyncStatus string
+
+const (
+	GitSyncStatusRunning GitSyncStatus = "running"
+	GitSyncStatusSuccess GitSyncStatus = "success"
+	GitSyncStatusFailed  GitSyncStatus = "failed"
+)
+
+// GitSyncNode maps a repository path to the node it was synced to.
+// table: git_sync_nodes
+type GitSyncNode struct {
+	KBID      string    `json:"kb_id" gorm:"primaryKey"`
+	Path      string    `json:"path" gorm:"primaryKey"`
+	NodeID    string    `json:"node_id"`
+	Hash      string    `json:"hash"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (GitSyncNode) TableName() string {
+	return "git_sync_nodes"
+}
+
+type GitSyncDiffItem struct {
+	Path     string               `json:"path"`
+	NodeID   string               `json:"node_id,omitempty"`
+	Name     string               `json:"name"`
+	DiffType KBReleaseDocDiffType `json:"diff_type"`
+}
+
+// GitSyncResult is the per-file diff of a sync run.
+type GitSyncResult struct {
+	Stats KBReleaseDocDiffStats `json:"stats"`
+	Diff  []*GitSyncDiffItem    `json:"diff"`
+}
+
+func (r *GitSyncResult) Add(item *GitSyncDiffItem) {
+	switch item.DiffType {
+	case KBReleaseDocDiffAdded:
+		r.Stats.Added++
+	case KBReleaseDocDiffRemoved:
+		r.Stats.Removed++
+	case KBReleaseDocDiffChanged:
+		r.Stats.Changed++
+	case KBReleaseDocDiffUnchanged:
+		r.Stats.Unchanged++
+	}
+	r.Diff = append(r.Diff, item)
+}
+
+func (r GitSyncResult) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+func (r *GitSyncResult) Scan(value any) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("invalid git sync result type: %T", value)
+	}
+	return json.Unmarshal(bytes, r)
+}
+
+// table: git_sync_runs
+type GitSyncRun struct {
+	ID         string           `json:"id" gorm:"primaryKey"`
+	KBID       string           `json:"kb_id"`
+	Direction  GitSyncDirection `json:"direction"`
+	Trigger    GitSyncTrigger   `json:"trigger"`
+	ReleaseID  string           `json:"release_id"`
+	Commit     string           `json:"commit"`
+	Status     GitSyncStatus    `json:"status"`
+	Error      string           `json:"error"`
+	Result     GitSyncResult    `json:"result" gorm:"type:jsonb"`
+	CreatedAt  time.Time        `json:"created_at"`
+	FinishedAt *time.Time       `json:"finished_at"`
+}
+
+func (GitSyncRun) TableName() string {
+	return "git_sync_runs"
+}
+
+type GitSyncImportReq struct {
+	KBID string `json:"kb_id" validate:"required"`
+}
+
+type GitSyncExportReq struct {
+	KBID      string `json:"kb_id" validate:"required"`
+	ReleaseID string `json:"release_id" validate:"required"`
+}
+
+type GitSyncRunListReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+	Pager
+}
@@ -0,0 +1,184 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HandoffSettings escalates the conversations of a bot app to human agents. A handoff mutes
+// the AI for the user until an agent releases it, the agents answer from the admin console
+// and their replies are delivered through the bot.
+type HandoffSettings struct {
+	IsEnabled bool `json:"is_enabled"`
+	// Keywords hand the conversation off when the question contains one of them
+	Keywords []string `json:"keywords"`
+	// MinRetrievedChunks hands off answers retrieval found fewer chunks for, 0 disables it
+	MinRetrievedChunks int `json:"min_retrieved_chunks"`
+	// DislikeThreshold hands off users after that many disliked answers within
+	// HandoffDislikeWindow, 0 disables it
+	DislikeThreshold int `json:"dislike_threshold"`
+	// Notice is sent to the user while the conversation is handed off
+	Notice string `json:"notice"`
+	// NotifyChatIDs are the chats the bot pushes new handoffs to, comma separated like
+	// KBUpdatePushChatIDs
+	NotifyChatIDs string `json:"notify_chat_ids"`
+}
+
+const (
+	HandoffDefaultNotice = "已为您转接人工客服，请稍候，客服回复后将在这里通知您。"
+	HandoffReleaseNotice = "人工客服已结束本次服务，后续问题将由 AI 助手为您解答。"
+	HandoffDislikeWindow = 24 * time.Hour
+)
+
+// MatchKeyword reports whether the question asks for a human.
+func (s HandoffSettings) MatchKeyword(question string) bool {
+	question = strings.ToLower(question)
+	for _, keyword := range s.Keywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword != "" && strings.Contains(question, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// LowConfidence reports whether retrieval found too little for the answer. Answers from
+// before the chunks were recorded are never low confidence.
+func (s HandoffSettings) LowConfidence(retrievedChunks *int) bool {
+	return s.MinRetrievedChunks > 0 && retrievedChunks != nil && *retrievedChunks < s.MinRetrievedChunks
+}
+
+func (s HandoffSettings) NoticeText() string {
+	if notice := strings.TrimSpace(s.Notice); notice != "" {
+		return notice
+	}
+	return HandoffDefaultNotice
+}
+
+var (
+	ErrHandoffReleased = errors.New("the handoff was already released")
+	ErrHandoffNoSender = errors.New("the bot of this conversation is not running")
+)
+
+type HandoffReason string
+
+const (
+	HandoffReasonKeyword          HandoffReason = "keyword"
+	HandoffReasonLowConfidence    HandoffReason = "low_confidence"
+	HandoffReasonNegativeFeedback HandoffReason = "negative_feedback"
+)
+
+func (r HandoffReason) Label() string {
+	switch r {
+	case HandoffReasonKeyword:
+		return "用户请求人工"
+	case HandoffReasonLowConfidence:
+		return "检索置信度低"
+	case HandoffReasonNegativeFeedback:
+		return "多次负面反馈"
+	}
+	return string(r)
+}
+
+type HandoffStatus string
+
+const (
+	HandoffStatusPending  HandoffStatus = "pending"
+	HandoffStatusReleased HandoffStatus = "released"
+)
+
+// table: conversation_handoffs
+//
+// ConversationHandoff is a bot user waiting for a human agent. Bot conversations are created
+// per question, so a handoff follows the user in the chat of ChannelID instead, and
+// ConversationID is the conversation that triggered it.
+type ConversationHandoff struct {
+	ID             string        `json:"id" gorm:"primaryKey"`
+	KBID           string        `json:"kb_id"`
+	AppID          string        `json:"app_id"`
+	AppType        AppType       `json:"app_type"`
+	ChannelID      string        `json:"channel_id"`
+	RemoteUserID   string        `json:"remote_user_id"`
+	Nickname       string        `json:"nickname"`
+	Avatar         string        `json:"avatar"`
+	ConversationID string        `json:"conversation_id"`
+	Reason         HandoffReason `json:"reason"`
+	Question       string        `json:"question"`
+	Status         HandoffStatus `json:"status"`
+	ReleasedBy     string        `json:"released_by"`
+	ReleasedAt     *time.Time    `json:"released_at"`
+	LastMessageAt  time.Time     `json:"last_message_at"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+func (ConversationHandoff) TableName() string {
+	return "conversation_handoffs"
+}
+
+// NotifyText is pushed to the agents when the handoff is created.
+func (h *ConversationHandoff) NotifyText() string {
+	nickname := h.Nickname
+	if nickname == "" {
+		nickname = h.RemoteUserID
+	}
+	return fmt.Sprintf("🙋 用户「%s」需要人工客服\n原因：%s\n问题：%s", nickname, h.Reason.Label(), h.Question)
+}
+
+type HandoffMessageRole string
+
+const (
+	HandoffMessageRoleUser  HandoffMessageRole = "user"
+	HandoffMessageRoleAgent HandoffMessageRole = "agent"
+)
+
+// table: conversation_handoff_messages
+//
+// HandoffMessage is a message between the user and the agents while the AI is muted.
+type HandoffMessage struct {
+	ID        string             `json:"id" gorm:"primaryKey"`
+	HandoffID string             `json:"handoff_id"`
+	Role      HandoffMessageRole `json:"role"`
+	Content   string             `json:"content"`
+	// UserID is the admin user who sent an agent message
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (HandoffMessage) TableName() string {
+	return "conversation_handoff_messages"
+}
+
+type HandoffListReq struct {
+	KBID   string        `json:"kb_id" query:"kb_id" validate:"required"`
+	Status HandoffStatus `json:"status" query:"status" validate:"omitempty,oneof=pending released"`
+	Pager
+}
+
+type HandoffListResp = PaginatedResult[[]*ConversationHandoff]
+
+type HandoffReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+	ID   string `json:"id" query:"id" validate:"required"`
+}
+
+type HandoffDetailResp struct {
+	Handoff  *ConversationHandoff `json:"handoff"`
+	Messages []*HandoffMessage    `json:"messages"`
+}
+
+type HandoffReplyReq struct {
+	KBID    string `json:"kb_id" validate:"required"`
+	ID      string `json:"id" validate:"required"`
+	Content string `json:"content" validate:"required"`
+}
+
+type WebhookHandoffData struct {
+	HandoffID      string        `json:"handoff_id"`
+	ConversationID string        `json:"conversation_id"`
+	AppType        AppType       `json:"app_type"`
+	Reason         HandoffReason `json:"reason"`
+	Question       string        `json:"question,omitempty"`
+	Nickname       string        `json:"nickname,omitempty"`
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandoffSettingsMatchKeyword(t *testing.T) {
+	settings := HandoffSettings{Keywords: []string{"人工", " Agent ", ""}}
+	require.True(t, settings.MatchKeyword("我要转人工客服"))
+	require.True(t, settings.MatchKeyword("talk to an AGENT please"))
+	require.False(t, settings.MatchKeyword("如何配置 SSO"))
+	require.False(t, HandoffSettings{}.MatchKeyword("人工"))
+}
+
+func TestHandoffSettingsLowConfidence(t *testing.T) {
+	settings := HandoffSettings{MinRetrievedChunks: 2}
+	require.True(t, settings.LowConfidence(lo.ToPtr(0)))
+	require.True(t, settings.LowConfidence(lo.ToPtr(1)))
+	require.False(t, settings.LowConfidence(lo.ToPtr(2)))
+	require.False(t, settings.LowConfidence(nil))
+	require.False(t, HandoffSettings{}.LowConfidence(lo.ToPtr(0)))
+}
+
+func TestHandoffSettingsNoticeText(t *testing.T) {
+	require.Equal(t, HandoffDefaultNotice, HandoffSettings{Notice: "  "}.NoticeText())
+	require.Equal(t, "请稍候", HandoffSettings{Notice: " 请稍候 "}.NoticeText())
+}
+
+func TestConversationHandoffNotifyText(t *testing.T) {
+	handoff := &ConversationHandoff{RemoteUserID: "u1", Reason: HandoffReasonLowConfidence, Question: "如何配置 SSO"}
+	text := handoff.NotifyText()
+	require.Contains(t, text, "u1")
+	require.Contains(t, text, HandoffReasonLowConfidence.Label())
+	require.Contains(t, text, "如何配置 SSO")
+
+	handoff.Nickname = "张三"
+	require.Contains(t, handoff.NotifyText(), "张三")
+}
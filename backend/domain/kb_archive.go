@@ -0,0 +1,179 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/chaitin/panda-wiki/consts"
+)
+
+// KBArchiveVersion is bumped whenever the archive layout changes incompatibly.
+const KBArchiveVersion = 1
+
+// KBImportTimeout bounds a single import job.
+const KBImportTimeout = time.Hour
+
+// KBImportLease is how long a running import job may go without progress before
+// it is taken for abandoned by a consumer that died mid import.
+const KBImportLease = KBImportTimeout + 10*time.Minute
+
+// files inside a kb archive
+const (
+	KBArchiveManifestFile     = "manifest.json"
+	KBArchiveNodesFile        = "nodes.json"
+	KBArchiveNavsFile         = "navs.json"
+	KBArchiveNavReleasesFile  = "nav_releases.json"
+	KBArchiveAppsFile         = "apps.json"
+	KBArchiveSettingsFile     = "settings.json"
+	KBArchivePromptsFile      = "prompt_versions.json"
+	KBArchiveReleasesFile     = "releases.json"
+	KBArchiveReleaseNodesFile = "release_nodes.json"
+	KBArchiveNodeReleasesFile = "node_releases.json"
+	KBArchiveAssetsDir        = "assets/"
+)
+
+// KBArchiveSettingKeys are the kb settings carried by an archive. Settings holding
+// credentials or instance specific values are left out.
+var KBArchiveSettingKeys = []string{
+	SettingKeySystemPrompt,
+	SettingBlockWords,
+	SettingRetrieval,
+}
+
+// KBArchiveAssetPattern matches S3 asset references in node content, capturing the object key.
+var KBArchiveAssetPattern = regexp.MustCompile(`/` + Bucket + `/([^\s"'()<>\\?#]+)`)
+
+type KBArchiveManifest struct {
+	Version    int            `json:"version"`
+	KBID       string         `json:"kb_id"`
+	KBName     string         `json:"kb_name"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Counts     map[string]int `json:"counts"`
+	Assets     []string       `json:"assets"` // object keys stored under assets/
+}
+
+type KBArchiveNodeAuthGroup struct {
+	GroupName string              `json:"group_name"`
+	Perm      consts.NodePermName `json:"perm"`
+}
+
+type KBArchiveNode struct {
+	ID          string                   `json:"id"`
+	Type        NodeType                 `json:"type"`
+	Status      NodeStatus               `json:"status"`
+	Name        string                   `json:"name"`
+	Content     string                   `json:"content"`
+	Meta        NodeMeta                 `json:"meta"`
+	ParentID    string                   `json:"parent_id"`
+	Position    float64                  `json:"position"`
+	NavID       string                   `json:"nav_id"`
+	Permissions NodePermissions          `json:"permissions"`
+	AuthGroups  []KBArchiveNodeAuthGroup `json:"auth_groups,omitempty"`
+	CreatedAt   time.Time                `json:"created_at"`
+	UpdatedAt   time.Time                `json:"updated_at"`
+}
+
+type KBArchiveSetting struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// KBArchive is the decoded content of an archive, assets excluded.
+type KBArchive struct {
+	Manifest     KBArchiveManifest
+	Nodes        []*KBArchiveNode
+	Navs         []*Nav
+	NavReleases  []*NavRelease
+	Apps         []*App
+	Settings     []*KBArchiveSetting
+	Prompts      []*PromptVersion
+	Releases     []*KBRelease
+	ReleaseNodes []*KBReleaseNodeRelease
+	NodeReleases []*NodeRelease
+}
+
+type KBImportMode string
+
+const (
+	// KBImportModeNew fills a freshly created kb with everything in the archive.
+	KBImportModeNew KBImportMode = "new"
+	// KBImportModeMerge adds the archive content (nodes, navs and assets) to an existing kb
+	// as unreleased nodes, leaving its apps, settings, prompts and releases untouched.
+	KBImportModeMerge KBImportMode = "merge"
+)
+
+type KBImportJobStatus string
+
+const (
+	KBImportJobStatusPending KBImportJobStatus = "pending"
+	KBImportJobStatusRunning KBImportJobStatus = "running"
+	KBImportJobStatusSuccess KBImportJobStatus = "success"
+	KBImportJobStatusFailed  KBImportJobStatus = "failed"
+)
+
+type KBImportResult struct {
+	Nodes             int `json:"nodes"`
+	Navs              int `json:"navs"`
+	Apps              int `json:"apps"`
+	Settings          int `json:"settings"`
+	Prompts           int `json:"prompts"`
+	Releases          int `json:"releases"`
+	Assets            int `json:"assets"`
+	SkippedAuthGroups int `json:"skipped_auth_groups"`
+	MissingAssets     int `json:"missing_assets"`
+}
+
+func (r KBImportResult) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+func (r *KBImportResult) Scan(value any) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("invalid kb import result type: %T", value)
+	}
+	return json.Unmarshal(bytes, r)
+}
+
+// table: kb_import_jobs
+type KBImportJob struct {
+	ID         string            `json:"id" gorm:"primaryKey"`
+	KBID       string            `json:"kb_id"`
+	Mode       KBImportMode      `json:"mode"`
+	ArchiveKey string            `json:"-"`
+	Status     KBImportJobStatus `json:"status"`
+	Stage      string            `json:"stage"`
+	Progress   int               `json:"progress"` // 0-100
+	Error      string            `json:"error"`
+	Result     KBImportResult    `json:"result" gorm:"type:jsonb"`
+	CreatorID  string            `json:"creator_id"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	FinishedAt *time.Time        `json:"finished_at"`
+}
+
+func (KBImportJob) TableName() string {
+	return "kb_import_jobs"
+}
+
+type KBImportTask struct {
+	JobID string `json:"job_id"`
+}
+
+type KBImportReq struct {
+	Mode KBImportMode `form:"mode" validate:"required,oneof=new merge"`
+	// merge mode
+	KBID string `form:"kb_id" validate:"required_if=Mode merge"`
+	// new mode, name defaults to the archived kb name
+	Name     string   `form:"name"`
+	Hosts    []string `form:"hosts"`
+	Ports    []int    `form:"ports"`
+	SSLPorts []int    `form:"ssl_ports"`
+}
+
+type KBImportJobReq struct {
+	ID string `json:"id" query:"id" validate:"required"`
+}
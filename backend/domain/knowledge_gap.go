@@ -0,0 +1,275 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// KnowledgeGapTimeout bounds a single report, every gap asks the model for an outline.
+const KnowledgeGapTimeout = 30 * time.Minute
+
+const (
+	KnowledgeGapDefaultDays = 30
+	// KnowledgeGapMaxQuestions bounds the recent questions a report clusters
+	KnowledgeGapMaxQuestions = 2000
+	KnowledgeGapEmbedBatch   = 64
+	// KnowledgeGapClusterThreshold is the least similarity of a question to the centroid of
+	// its cluster
+	KnowledgeGapClusterThreshold = 0.82
+	// KnowledgeGapFewChunks is the most retrieved chunks of an answer that still counts as
+	// retrieval finding little
+	KnowledgeGapFewChunks = 1
+	// KnowledgeGapMinWeakRatio is the least share of weak answers in a cluster that is a gap
+	KnowledgeGapMinWeakRatio = 0.3
+	KnowledgeGapMaxGaps      = 20
+	KnowledgeGapMaxSamples   = 10
+)
+
+var ErrKnowledgeGapDrafted = errors.New("a draft was already created for this gap")
+
+type KnowledgeGapReportStatus string
+
+const (
+	KnowledgeGapReportStatusPending KnowledgeGapReportStatus = "pending"
+	KnowledgeGapReportStatusRunning KnowledgeGapReportStatus = "running"
+	KnowledgeGapReportStatusSuccess KnowledgeGapReportStatus = "success"
+	KnowledgeGapReportStatusFailed  KnowledgeGapReportStatus = "failed"
+)
+
+// table: knowledge_gap_reports
+//
+// KnowledgeGapReport mines the user questions of the last Days days for topics the kb
+// answers badly.
+type KnowledgeGapReport struct {
+	ID            string                   `json:"id" gorm:"primaryKey"`
+	KBID          string                   `json:"kb_id"`
+	Days          int                      `json:"days"`
+	Status        KnowledgeGapReportStatus `json:"status"`
+	QuestionCount int                      `json:"question_count"`
+	ClusterCount  int                      `json:"cluster_count"`
+	GapCount      int                      `json:"gap_count"`
+	Error         string                   `json:"error"`
+	CreatorID     string                   `json:"creator_id"`
+	CreatedAt     time.Time                `json:"created_at"`
+	FinishedAt    *time.Time               `json:"finished_at"`
+}
+
+func (KnowledgeGapReport) TableName() string {
+	return "knowledge_gap_reports"
+}
+
+// table: knowledge_gaps
+//
+// KnowledgeGap is a cluster of similar questions with weak answers, ranked by Score.
+type KnowledgeGap struct {
+	ID       string `json:"id" gorm:"primaryKey"`
+	ReportID string `json:"report_id" gorm:"index"`
+	KBID     string `json:"kb_id"`
+	Rank     int    `json:"rank"`
+	// Questions are samples of the cluster, the most frequent first
+	Questions     pq.StringArray `json:"questions" gorm:"type:text[]"`
+	QuestionCount int            `json:"question_count"`
+	// FewChunkCount are the answers retrieval found at most KnowledgeGapFewChunks chunks for
+	FewChunkCount   int     `json:"few_chunk_count"`
+	DislikeCount    int     `json:"dislike_count"`
+	UngroundedCount int     `json:"ungrounded_count"`
+	Score           float64 `json:"score"`
+	// Title and Outline are the document the model suggests to close the gap, markdown
+	Title   string `json:"title"`
+	Outline string `json:"outline"`
+	// NodeID is the draft node created from the outline
+	NodeID    string    `json:"node_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (KnowledgeGap) TableName() string {
+	return "knowledge_gaps"
+}
+
+type CreateKnowledgeGapReportReq struct {
+	KBID string `json:"kb_id" validate:"required"`
+	Days int    `json:"days" validate:"omitempty,min=1,max=180"`
+}
+
+type KnowledgeGapReportListReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+	Pager
+}
+
+type KnowledgeGapReportListResp = PaginatedResult[[]*KnowledgeGapReport]
+
+type KnowledgeGapReportDetailReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+	ID   string `json:"id" query:"id" validate:"required"`
+}
+
+type KnowledgeGapReportDetailResp struct {
+	Report *KnowledgeGapReport `json:"report"`
+	Gaps   []*KnowledgeGap     `json:"gaps"`
+}
+
+type CreateKnowledgeGapDraftReq struct {
+	KBID     string `json:"kb_id" validate:"required"`
+	GapID    string `json:"gap_id" validate:"required"`
+	ParentID string `json:"parent_id"`
+}
+
+// KnowledgeGapQuestion is a recent user question with how it was answered.
+type KnowledgeGapQuestion struct {
+	MessageID string `json:"message_id"`
+	Question  string `json:"question"`
+	// RetrievedChunks is unknown for answers from before it was recorded
+	RetrievedChunks *int      `json:"retrieved_chunks"`
+	Score           ScoreType `json:"score"`
+	Ungrounded      bool      `json:"ungrounded"`
+}
+
+func (q *KnowledgeGapQuestion) fewChunks() bool {
+	return q.RetrievedChunks != nil && *q.RetrievedChunks <= KnowledgeGapFewChunks
+}
+
+// Weak reports whether the answer to the question shows a gap.
+func (q *KnowledgeGapQuestion) Weak() bool {
+	return q.fewChunks() || q.Score == DisLike || q.Ungrounded
+}
+
+// ClusterEmbeddings groups the vectors greedily: each vector joins the cluster with the most
+// similar centroid if it reaches threshold, or starts a new one. It returns the indexes of
+// each cluster.
+func ClusterEmbeddings(vectors [][]float32, threshold float64) [][]int {
+	clusters := make([][]int, 0)
+	centroids := make([][]float64, 0)
+	for i, vector := range vectors {
+		best, bestScore := -1, threshold
+		for c, centroid := range centroids {
+			if score := cosine64(centroid, vector); score >= bestScore {
+				best, bestScore = c, score
+			}
+		}
+		if best < 0 {
+			centroid := make([]float64, len(vector))
+			for j, v := range vector {
+				centroid[j] = float64(v)
+			}
+			clusters = append(clusters, []int{i})
+			centroids = append(centroids, centroid)
+			continue
+		}
+		n := float64(len(clusters[best]))
+		for j := range centroids[best] {
+			centroids[best][j] = (centroids[best][j]*n + float64(vector[j])) / (n + 1)
+		}
+		clusters[best] = append(clusters[best], i)
+	}
+	return clusters
+}
+
+func cosine64(a []float64, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * float64(b[i])
+		normA += a[i] * a[i]
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// NewKnowledgeGap summarizes a cluster of questions, nil when too few of its answers are
+// weak. The score grows with the weak answers, dislikes weigh the most.
+func NewKnowledgeGap(questions []*KnowledgeGapQuestion) *KnowledgeGap {
+	if len(questions) == 0 {
+		return nil
+	}
+	gap := &KnowledgeGap{QuestionCount: len(questions)}
+	weak := 0
+	frequency := make(map[string]int)
+	for _, q := range questions {
+		if q.fewChunks() {
+			gap.FewChunkCount++
+		}
+		if q.Score == DisLike {
+			gap.DislikeCount++
+		}
+		if q.Ungrounded {
+			gap.UngroundedCount++
+		}
+		if q.Weak() {
+			weak++
+		}
+		frequency[strings.TrimSpace(q.Question)]++
+	}
+	if weak == 0 || float64(weak)/float64(len(questions)) < KnowledgeGapMinWeakRatio {
+		return nil
+	}
+	gap.Score = float64(gap.FewChunkCount) + 1.5*float64(gap.DislikeCount) + float64(gap.UngroundedCount)
+
+	samples := make([]string, 0, len(frequency))
+	for question := range frequency {
+		samples = append(samples, question)
+	}
+	slices.SortFunc(samples, func(a, b string) int {
+		if frequency[a] != frequency[b] {
+			return frequency[b] - frequency[a]
+		}
+		return strings.Compare(a, b)
+	})
+	gap.Questions = samples[:min(len(samples), KnowledgeGapMaxSamples)]
+	return gap
+}
+
+// RankKnowledgeGaps orders the gaps by score, then size, and keeps the first
+// KnowledgeGapMaxGaps.
+func RankKnowledgeGaps(gaps []*KnowledgeGap) []*KnowledgeGap {
+	slices.SortStableFunc(gaps, func(a, b *KnowledgeGap) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return b.QuestionCount - a.QuestionCount
+	})
+	gaps = gaps[:min(len(gaps), KnowledgeGapMaxGaps)]
+	for i, gap := range gaps {
+		gap.Rank = i + 1
+	}
+	return gaps
+}
+
+// KnowledgeGapOutline is the answer of the model to KnowledgeGapOutlinePrompt.
+type KnowledgeGapOutline struct {
+	Title   string `json:"title"`
+	Outline string `json:"outline"`
+}
+
+// ParseKnowledgeGapOutline reads the outline answer of the model, falling back to the most
+// frequent question as the title and the whole answer as the outline.
+func ParseKnowledgeGapOutline(content string, gap *KnowledgeGap) *KnowledgeGapOutline {
+	outline := &KnowledgeGapOutline{}
+	content = strings.TrimSpace(content)
+	if start, end := strings.Index(content, "{"), strings.LastIndex(content, "}"); start >= 0 && end > start {
+		if err := json.Unmarshal([]byte(content[start:end+1]), outline); err != nil {
+			outline = &KnowledgeGapOutline{Outline: content}
+		}
+	} else {
+		outline.Outline = content
+	}
+	outline.Title = strings.TrimSpace(outline.Title)
+	outline.Outline = strings.TrimSpace(outline.Outline)
+	if outline.Title == "" && len(gap.Questions) > 0 {
+		outline.Title = gap.Questions[0]
+	}
+	return outline
+}
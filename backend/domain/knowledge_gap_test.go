@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterEmbeddings(t *testing.T) {
+	vectors := [][]float32{
+		{1, 0, 0},
+		{0, 1, 0},
+		{0.95, 0.05, 0},
+		{0, 0.9, 0.1},
+		{0, 0, 1},
+	}
+	require.Equal(t, [][]int{{0, 2}, {1, 3}, {4}}, ClusterEmbeddings(vectors, 0.9))
+	require.Len(t, ClusterEmbeddings(vectors, 0), 1)
+	require.Empty(t, ClusterEmbeddings(nil, 0.9))
+}
+
+func TestNewKnowledgeGap(t *testing.T) {
+	t.Run("weak answers make a gap", func(t *testing.T) {
+		gap := NewKnowledgeGap([]*KnowledgeGapQuestion{
+			{Question: "如何配置 SSO", RetrievedChunks: lo.ToPtr(0)},
+			{Question: "如何配置 SSO", Score: DisLike, RetrievedChunks: lo.ToPtr(5)},
+			{Question: "SSO 怎么接入", Ungrounded: true},
+			{Question: "SSO 支持哪些协议", RetrievedChunks: lo.ToPtr(8)},
+		})
+		require.NotNil(t, gap)
+		require.Equal(t, 4, gap.QuestionCount)
+		require.Equal(t, 1, gap.FewChunkCount)
+		require.Equal(t, 1, gap.DislikeCount)
+		require.Equal(t, 1, gap.UngroundedCount)
+		require.Equal(t, 3.5, gap.Score)
+		require.Equal(t, "如何配置 SSO", gap.Questions[0])
+		require.Len(t, gap.Questions, 3)
+	})
+
+	t.Run("well answered cluster is no gap", func(t *testing.T) {
+		require.Nil(t, NewKnowledgeGap([]*KnowledgeGapQuestion{
+			{Question: "a", RetrievedChunks: lo.ToPtr(6), Score: Like},
+			{Question: "b", RetrievedChunks: lo.ToPtr(6)},
+			{Question: "c"},
+			{Question: "d", RetrievedChunks: lo.ToPtr(0)},
+		}))
+		require.Nil(t, NewKnowledgeGap(nil))
+	})
+}
+
+func TestRankKnowledgeGaps(t *testing.T) {
+	gaps := []*KnowledgeGap{
+		{ID: "a", Score: 2, QuestionCount: 3},
+		{ID: "b", Score: 5, QuestionCount: 5},
+		{ID: "c", Score: 2, QuestionCount: 8},
+	}
+	ranked := RankKnowledgeGaps(gaps)
+	require.Equal(t, []string{"b", "c", "a"}, lo.Map(ranked, func(gap *KnowledgeGap, _ int) string { return gap.ID }))
+	require.Equal(t, []int{1, 2, 3}, lo.Map(ranked, func(gap *KnowledgeGap, _ int) int { return gap.Rank }))
+
+	many := make([]*KnowledgeGap, KnowledgeGapMaxGaps+5)
+	for i := range many {
+		many[i] = &KnowledgeGap{Score: float64(i)}
+	}
+	require.Len(t, RankKnowledgeGaps(many), KnowledgeGapMaxGaps)
+}
+
+func TestParseKnowledgeGapOutline(t *testing.T) {
+	gap := &KnowledgeGap{Questions: []string{"如何配置 SSO"}}
+
+	outline := ParseKnowledgeGapOutline("```json\n{\"title\": \"SSO 配置指南\", \"outline\": \"# SSO\\n## 步骤\"}\n```", gap)
+	require.Equal(t, "SSO 配置指南", outline.Title)
+	require.Equal(t, "# SSO\n## 步骤", outline.Outline)
+
+	outline = ParseKnowledgeGapOutline("# SSO\n## 步骤", gap)
+	require.Equal(t, "如何配置 SSO", outline.Title)
+	require.Equal(t, "# SSO\n## 步骤", outline.Outline)
+
+	outline = ParseKnowledgeGapOutline("", gap)
+	require.Equal(t, "如何配置 SSO", outline.Title)
+	require.Empty(t, outline.Outline)
+}
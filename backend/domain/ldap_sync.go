@@ -0,0 +1,200 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrLDAPSyncRunning = errors.New("LDAP sync is already running for this knowledge base")
+
+const (
+	SettingLDAPSync = "ldap_sync_settings"
+
+	DefaultLDAPSyncIntervalMinutes = 60
+
+	// LDAPSyncMaxChanges caps the changes kept in a sync result, the stats still count all of them.
+	LDAPSyncMaxChanges = 1000
+)
+
+// LDAPSyncSettings configures the directory whose groups are imported into the auth groups
+// of a knowledge base. BindPassword is write-only: it is never returned and an empty value
+// keeps the saved one.
+type LDAPSyncSettings struct {
+	Enabled         bool   `json:"enabled"`
+	ServerURL       string `json:"server_url" validate:"max=2048"`
+	BindDN          string `json:"bind_dn" validate:"max=1024"`
+	BindPassword    string `json:"bind_password,omitempty" validate:"max=1024"`
+	UserBaseDN      string `json:"user_base_dn" validate:"max=1024"`
+	UserFilter      string `json:"user_filter" validate:"max=1024"`
+	UserIDAttr      string `json:"user_id_attr" validate:"max=255"`
+	UserNameAttr    string `json:"user_name_attr" validate:"max=255"`
+	UserEmailAttr   string `json:"user_email_attr" validate:"max=255"`
+	GroupBaseDN     string `json:"group_base_dn" validate:"max=1024"`
+	GroupFilter     string `json:"group_filter" validate:"max=1024"`
+	GroupNameAttr   string `json:"group_name_attr" validate:"max=255"`
+	GroupMemberAttr string `json:"group_member_attr" validate:"max=255"`
+	IntervalMinutes int    `json:"interval_minutes" validate:"gte=0,lte=10080"`
+}
+
+func (s *LDAPSyncSettings) Interval() time.Duration {
+	if s.IntervalMinutes <= 0 {
+		return DefaultLDAPSyncIntervalMinutes * time.Minute
+	}
+	return time.Duration(s.IntervalMinutes) * time.Minute
+}
+
+type LDAPSyncSettingsResp struct {
+	LDAPSyncSettings
+	HasBindPassword bool `json:"has_bind_password"`
+}
+
+type UpdateLDAPSyncSettingsReq struct {
+	KBID string `json:"kb_id" validate:"required"`
+	LDAPSyncSettings
+}
+
+type LDAPSyncTrigger string
+
+const (
+	LDAPSyncTriggerManual   LDAPSyncTrigger = "manual"
+	LDAPSyncTriggerSchedule LDAPSyncTrigger = "schedule"
+)
+
+type LDAPSyncStatus string
+
+const (
+	LDAPSyncStatusRunning LDAPSyncStatus = "running"
+	LDAPSyncStatusSuccess LDAPSyncStatus = "success"
+	LDAPSyncStatusFailed  LDAPSyncStatus = "failed"
+)
+
+type LDAPSyncChangeType string
+
+const (
+	LDAPSyncChangeUser       LDAPSyncChangeType = "user"
+	LDAPSyncChangeGroup      LDAPSyncChangeType = "group"
+	LDAPSyncChangeMembership LDAPSyncChangeType = "membership"
+)
+
+type LDAPSyncChange struct {
+	Type     LDAPSyncChangeType   `json:"type"`
+	DiffType KBReleaseDocDiffType `json:"diff_type"`
+	DN       string               `json:"dn"`
+	Name     string               `json:"name"`
+	// Group is the DN of the group of a membership change
+	Group string `json:"group,omitempty"`
+}
+
+type LDAPSyncStats struct {
+	UsersAdded         int `json:"users_added"`
+	UsersChanged       int `json:"users_changed"`
+	GroupsAdded        int `json:"groups_added"`
+	GroupsChanged      int `json:"groups_changed"`
+	GroupsRemoved      int `json:"groups_removed"`
+	MembershipsAdded   int `json:"memberships_added"`
+	MembershipsRemoved int `json:"memberships_removed"`
+}
+
+// LDAPSyncResult is the diff between the directory and the auth groups of a sync run, or
+// of a dry run when nothing was written.
+type LDAPSyncResult struct {
+	Stats     LDAPSyncStats     `json:"stats"`
+	Changes   []*LDAPSyncChange `json:"changes"`
+	Truncated bool              `json:"truncated"`
+	Warnings  []string          `json:"warnings"`
+}
+
+func (r *LDAPSyncResult) Add(change *LDAPSyncChange) {
+	switch change.Type {
+	case LDAPSyncChangeUser:
+		switch change.DiffType {
+		case KBReleaseDocDiffAdded:
+			r.Stats.UsersAdded++
+		case KBReleaseDocDiffChanged:
+			r.Stats.UsersChanged++
+		}
+	case LDAPSyncChangeGroup:
+		switch change.DiffType {
+		case KBReleaseDocDiffAdded:
+			r.Stats.GroupsAdded++
+		case KBReleaseDocDiffChanged:
+			r.Stats.GroupsChanged++
+		case KBReleaseDocDiffRemoved:
+			r.Stats.GroupsRemoved++
+		}
+	case LDAPSyncChangeMembership:
+		switch change.DiffType {
+		case KBReleaseDocDiffAdded:
+			r.Stats.MembershipsAdded++
+		case KBReleaseDocDiffRemoved:
+			r.Stats.MembershipsRemoved++
+		}
+	}
+	if len(r.Changes) >= LDAPSyncMaxChanges {
+		r.Truncated = true
+		return
+	}
+	r.Changes = append(r.Changes, change)
+}
+
+func (r LDAPSyncResult) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+func (r *LDAPSyncResult) Scan(value any) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("invalid LDAP sync result type: %T", value)
+	}
+	return json.Unmarshal(bytes, r)
+}
+
+// table: ldap_sync_runs
+type LDAPSyncRun struct {
+	ID         string          `json:"id" gorm:"primaryKey"`
+	KBID       string          `json:"kb_id"`
+	Trigger    LDAPSyncTrigger `json:"trigger"`
+	DryRun     bool            `json:"dry_run"`
+	Status     LDAPSyncStatus  `json:"status"`
+	Error      string          `json:"error"`
+	Result     LDAPSyncResult  `json:"result" gorm:"type:jsonb"`
+	CreatedAt  time.Time       `json:"created_at"`
+	FinishedAt *time.Time      `json:"finished_at"`
+}
+
+func (LDAPSyncRun) TableName() string {
+	return "ldap_sync_runs"
+}
+
+// LDAPSyncGroup is an auth group as it should be after a sync, keyed by the DN of the
+// directory group in its sync id.
+type LDAPSyncGroup struct {
+	// ID is zero for groups to create
+	ID       uint
+	DN       string
+	Name     string
+	ParentDN string
+	// MemberUnionIDs are the union ids of the readers of the group
+	MemberUnionIDs []string
+}
+
+// LDAPSyncPlan holds the writes of a sync, applied at once.
+type LDAPSyncPlan struct {
+	CreateAuths    []*Auth
+	UpdateAuths    []*Auth
+	Groups         []*LDAPSyncGroup
+	RemoveGroupIDs []uint
+}
+
+type LDAPSyncReq struct {
+	KBID   string `json:"kb_id" validate:"required"`
+	DryRun bool   `json:"dry_run"`
+}
+
+type LDAPSyncRunListReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+	Pager
+}
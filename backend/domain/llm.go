@@ -82,6 +82,63 @@ var UserQuestionFormatter = `
 </documents>
 `
 
+// OpenAIToolPrompt is appended to the system prompt when the model searches the kb with
+// the KBSearchToolName tool instead of getting the documents with the question.
+var OpenAIToolPrompt = `
+
+文档不会随问题一起提供。需要查阅知识库时，请调用 search_knowledge_base 工具，工具返回的 <documents> 就是上述步骤中的文档，可以换用不同的查询多次调用。`
+
+var OpenAIJSONObjectPrompt = `
+
+只输出一个合法的 JSON 对象，不要输出任何其它内容，也不要用代码块包裹。`
+
+var OpenAIJSONSchemaPrompt = `
+
+只输出一个符合以下 JSON Schema 的 JSON 对象，不要输出任何其它内容，也不要用代码块包裹：
+%s`
+
+// OpenAIJSONRepairPrompt asks the model to fix an answer that failed ValidateResponse.
+var OpenAIJSONRepairPrompt = `上面的回答不符合要求的 JSON 格式：%s。请重新输出，只输出 JSON。`
+
+// AgentRewritePrompt asks the model for a standalone question and its sub-queries in agent
+// mode, the conversation follows it.
+var AgentRewritePrompt = `你是知识库检索助手。请根据对话历史，把用户的最后一个问题改写成不依赖上下文、可以独立理解的完整问题，并把它拆分成用于检索知识库的子查询。
+
+要求：
+1. 补全问题中指代不明的内容，例如"它"、"第二个选项"，要替换成对话历史中对应的具体内容
+2. 简单问题只需要一个子查询，包含多个方面的复杂问题拆分成最多 4 个子查询
+3. 子查询要简短，适合检索
+4. 只输出一个 JSON 对象，不要输出任何其它内容，格式如下：
+{"question": "改写后的问题", "sub_queries": ["子查询1", "子查询2"]}`
+
+// AgentToolPrompt is appended to the system prompt in agent mode.
+var AgentToolPrompt = `
+
+问题附带的 <documents> 是根据问题初步检索到的文档。如果这些文档不足以回答问题，可以调用工具继续查阅知识库后再回答：
+- search_knowledge_base：用新的查询检索知识库
+- open_node：根据文档ID打开文档，阅读完整内容
+- list_children：列出文件夹下的文档，浏览相关文档
+工具返回的文档与 <documents> 中的文档同样可以引用。信息足够时直接回答，不要重复调用相同的工具。`
+
+// GroundingPrompt asks the model which chunk supports each sentence of an answer, the input
+// is built by BuildGroundingInput.
+var GroundingPrompt = `你是事实核查助手。下面给出编号的文档片段 <chunks> 和一个回答拆分出的编号句子 <sentences>。请逐句判断：
+1. 句子是否是事实性陈述（claim）。寒暄、过渡语、提问、"抱歉，我当前的知识不足以回答这个问题"等不是事实性陈述
+2. 对于事实性陈述，找出最能直接支持它的一个文档片段编号；没有任何片段支持，或者片段内容与句子矛盾时，编号为 0
+
+只输出一个 JSON 数组，不要输出任何其它内容，每个句子一项，格式如下：
+[{"index": 句子编号, "claim": true, "chunk": 片段编号}]`
+
+// KnowledgeGapOutlinePrompt asks the model to draft a document for a knowledge gap, the
+// questions of the gap follow it.
+var KnowledgeGapOutlinePrompt = `你是知识库文档编辑。下面是用户反复提出、但知识库没能很好回答的一组相似问题。请为知识库起草一篇能够回答这些问题的新文档：
+1. title 是文档标题，简洁明确
+2. outline 是 Markdown 格式的文档大纲，用二级、三级标题列出章节，每个章节下用一两句话说明应该写什么内容
+3. 不要编造具体的事实、数据或操作步骤，只描述文档应该覆盖的内容
+
+只输出一个 JSON 对象，不要输出任何其它内容，格式如下：
+{"title": "文档标题", "outline": "Markdown 大纲"}`
+
 // processContentWithBaseURL adds baseURL prefix to static-file URLs in content
 func processContentWithBaseURL(content, baseURL string) string {
 	if baseURL == "" {
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrMCPNodeNotFound = errors.New("node not found or not public")
+
+const MCPResourceURIPrefix = "pandawiki://node/"
+
+func MCPResourceURI(nodeID string) string {
+	return MCPResourceURIPrefix + nodeID
+}
+
+// ParseMCPResourceURI returns the node id of a pandawiki://node/{id} uri.
+func ParseMCPResourceURI(uri string) (string, bool) {
+	nodeID, ok := strings.CutPrefix(strings.TrimSpace(uri), MCPResourceURIPrefix)
+	if !ok || nodeID == "" || strings.Contains(nodeID, "/") {
+		return "", false
+	}
+	return nodeID, true
+}
+
+type MCPDoc struct {
+	NodeID    string   `json:"node_id"`
+	Name      string   `json:"name"`
+	PathNames []string `json:"path_names,omitempty"`
+	Summary   string   `json:"summary,omitempty"`
+	Snippet   string   `json:"snippet,omitempty"`
+	URL       string   `json:"url"`
+}
+
+type MCPNode struct {
+	NodeID    string    `json:"node_id"`
+	Name      string    `json:"name"`
+	Summary   string    `json:"summary,omitempty"`
+	Content   string    `json:"content"` // markdown
+	URL       string    `json:"url"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type MCPTreeNode struct {
+	NodeID   string         `json:"node_id"`
+	Name     string         `json:"name"`
+	Type     NodeType       `json:"type"`
+	Emoji    string         `json:"emoji,omitempty"`
+	Children []*MCPTreeNode `json:"children,omitempty"`
+}
+
+type MCPAnswer struct {
+	Answer     string    `json:"answer"`
+	References []*MCPDoc `json:"references"`
+}
+
+type MCPResource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType"`
+}
@@ -3,6 +3,7 @@ package domain
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -26,6 +27,8 @@ const (
 	ModelTypeAnalysisVL ModelType = "analysis-vl"
 )
 
+var ErrEmbeddingModelNotConfigured = errors.New("embedding model is not configured")
+
 type Model struct {
 	ID         string        `json:"id"`
 	Provider   ModelProvider `json:"provider"`
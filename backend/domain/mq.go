@@ -4,12 +4,22 @@ const (
 	VectorTaskTopic       = "apps.panda-wiki.vector.task"
 	AnydocTaskExportTopic = "anydoc.persistence.doc.task.export"
 	RagDocUpdateTopic     = "raglite.events.doc.update"
+	WebhookDeliveryTopic  = "apps.panda-wiki.webhook.delivery"
+	KBImportTopic         = "apps.panda-wiki.kb.import"
+	KBReleasePushTopic    = "apps.panda-wiki.kb.release.push"
+	NodeCollabTopic       = "apps.panda-wiki.node.collab"
+	RAGEvalTopic          = "apps.panda-wiki.rag.eval"
 )
 
 var TopicConsumerName = map[string]string{
 	VectorTaskTopic:       "panda-wiki-vector-consumer",
 	AnydocTaskExportTopic: "anydoc-task-export-consumer",
 	RagDocUpdateTopic:     "raglite-doc-update-consumer",
+	WebhookDeliveryTopic:  "panda-wiki-webhook-consumer",
+	KBImportTopic:         "panda-wiki-kb-import-consumer",
+	KBReleasePushTopic:    "panda-wiki-kb-release-push-consumer",
+	NodeCollabTopic:       "panda-wiki-node-collab-consumer",
+	RAGEvalTopic:          "panda-wiki-rag-eval-consumer",
 }
 
 type NodeReleaseVectorRequest struct {
@@ -33,8 +33,9 @@ const (
 )
 
 const (
-	NodeReleaseAuditActionPublish  = "publish"
-	NodeReleaseAuditActionRollback = "rollback"
+	NodeReleaseAuditActionPublish   = "publish"
+	NodeReleaseAuditActionRollback  = "rollback"
+	NodeReleaseAuditActionUnpublish = "unpublish"
 )
 
 const (
@@ -59,6 +60,7 @@ type Node struct {
 	EditorId    string          `json:"editor_id"`
 	EditTime    time.Time       `json:"edit_time"`
 	Permissions NodePermissions `json:"permissions" gorm:"type:jsonb"`
+	Version     int64           `json:"version"` // bumped by every edit, see NodeRevision
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
 }
@@ -150,6 +152,8 @@ func (d *NodeMeta) Scan(value any) error {
 }
 
 type CreateNodeReq struct {
+	// ID is the id of the new node, generated when empty
+	ID       string   `json:"-"`
 	KBID     string   `json:"kb_id" validate:"required"`
 	ParentID string   `json:"parent_id"`
 	Type     NodeType `json:"type" validate:"required,oneof=1 2"`
@@ -257,6 +261,9 @@ type UpdateNodeReq struct {
 	Summary     *string  `json:"summary"`
 	Position    *float64 `json:"position"`
 	ContentType *string  `json:"content_type"`
+	// Version the edit is based on. When the node moved on since, the edit is merged with the
+	// newer changes or rejected with a NodeConflictError. Nil overwrites unconditionally.
+	Version *int64 `json:"version"`
 }
 
 type ShareNodeListItemResp struct {
@@ -0,0 +1,131 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNodeVersionMismatch is returned by the repository when the node moved past the version an
+	// update was based on.
+	ErrNodeVersionMismatch = errors.New("node version mismatch")
+	ErrNodeConflict        = errors.New("node was changed by another editor")
+)
+
+// table: node_revisions
+//
+// NodeRevision keeps the fields of a node as of each version, the base of three-way merges.
+type NodeRevision struct {
+	ID        int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	KBID      string    `json:"kb_id"`
+	NodeID    string    `json:"node_id"`
+	Version   int64     `json:"version"`
+	Name      string    `json:"name"`
+	Content   string    `json:"content"`
+	Meta      NodeMeta  `json:"meta" gorm:"type:jsonb"`
+	EditorID  string    `json:"editor_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (NodeRevision) TableName() string {
+	return "node_revisions"
+}
+
+// NodeRevisionRetention is how long superseded revisions are kept for merging late edits.
+const NodeRevisionRetention = 30 * 24 * time.Hour
+
+// NodeRevisionCandidate is a revision past the retention with the versions it is checked against.
+type NodeRevisionCandidate struct {
+	ID        int64
+	NodeID    string
+	Version   int64
+	CreatedAt time.Time
+	// NodeVersion is the current version of the node, nil once the node is deleted
+	NodeVersion *int64
+	// LatestVersion is the newest revision kept for the node
+	LatestVersion int64
+}
+
+// Prunable reports whether the revision can be deleted. The revision of the current node version,
+// and the newest one of a node, stay however old they are: an edit based on them is merged against
+// them.
+func (c *NodeRevisionCandidate) Prunable(before time.Time) bool {
+	if !c.CreatedAt.Before(before) || c.Version >= c.LatestVersion {
+		return false
+	}
+	return c.NodeVersion == nil || *c.NodeVersion != c.Version
+}
+
+type UpdateNodeResp struct {
+	Version int64 `json:"version"`
+	// Merged is set when the edit was merged with changes made after its base version, the
+	// client should reload the node.
+	Merged bool `json:"merged"`
+}
+
+// NodeConflictError carries the current node when an edit could not be merged, so the client can
+// resolve the conflict and retry against Version.
+type NodeConflictError struct {
+	Version int64    `json:"version"`
+	Name    string   `json:"name"`
+	Content string   `json:"content"`
+	Meta    NodeMeta `json:"meta"`
+	Fields  []string `json:"fields"`
+}
+
+func (e *NodeConflictError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrNodeConflict.Error(), strings.Join(e.Fields, ", "))
+}
+
+func (e *NodeConflictError) Unwrap() error {
+	return ErrNodeConflict
+}
+
+// NodeCollabPeer is an editor connected to the collaboration channel of a node.
+type NodeCollabPeer struct {
+	ConnID   string    `json:"conn_id"`
+	KBID     string    `json:"kb_id"`
+	NodeID   string    `json:"node_id"`
+	UserID   string    `json:"user_id"`
+	Account  string    `json:"account"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+const (
+	NodeCollabEventJoin      = "join"
+	NodeCollabEventLeave     = "leave"
+	NodeCollabEventHeartbeat = "heartbeat"
+	NodeCollabEventUpdate    = "update"
+)
+
+// NodeCollabEvent is relayed between api servers over NATS so editors connected to different
+// replicas share a session.
+type NodeCollabEvent struct {
+	Type      string `json:"type"`
+	ReplicaID string `json:"replica_id"`
+	// Peer is the sender of join, leave and update events
+	Peer *NodeCollabPeer `json:"peer,omitempty"`
+	// Peers are all editors connected to the replica, sent with heartbeats
+	Peers []*NodeCollabPeer `json:"peers,omitempty"`
+	// Data is an opaque document update, e.g. a Yjs sync or awareness message
+	Data []byte `json:"data,omitempty"`
+}
+
+// NodeCollabFrame is a websocket message for an editor. Binary frames carry document updates of
+// other editors verbatim, text frames carry NodeCollabPresenceMsg.
+type NodeCollabFrame struct {
+	Binary bool
+	Data   []byte
+}
+
+type NodeCollabPresenceMsg struct {
+	Type  string            `json:"type"` // presence
+	Peers []*NodeCollabPeer `json:"peers"`
+}
+
+type NodeCollabReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+	ID   string `json:"id" query:"id" validate:"required"`
+}
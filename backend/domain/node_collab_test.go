@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeRevisionCandidatePrunable(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-NodeRevisionRetention)
+	old := before.Add(-time.Hour)
+	version := func(v int64) *int64 { return &v }
+
+	for _, c := range []struct {
+		description string
+		candidate   NodeRevisionCandidate
+		prunable    bool
+	}{
+		{"only revision of an untouched node", NodeRevisionCandidate{Version: 1, CreatedAt: old, NodeVersion: version(1), LatestVersion: 1}, false},
+		{"superseded revision", NodeRevisionCandidate{Version: 1, CreatedAt: old, NodeVersion: version(3), LatestVersion: 3}, true},
+		{"revision of the current version", NodeRevisionCandidate{Version: 2, CreatedAt: old, NodeVersion: version(2), LatestVersion: 3}, false},
+		{"newest revision ahead of the node", NodeRevisionCandidate{Version: 3, CreatedAt: old, NodeVersion: version(2), LatestVersion: 3}, false},
+		{"recent superseded revision", NodeRevisionCandidate{Version: 1, CreatedAt: now, NodeVersion: version(3), LatestVersion: 3}, false},
+		{"superseded revision of a deleted node", NodeRevisionCandidate{Version: 1, CreatedAt: old, LatestVersion: 2}, true},
+		{"newest revision of a deleted node", NodeRevisionCandidate{Version: 2, CreatedAt: old, LatestVersion: 2}, false},
+	} {
+		require.Equal(t, c.prunable, c.candidate.Prunable(before), c.description)
+	}
+}
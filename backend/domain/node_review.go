@@ -0,0 +1,149 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+)
+
+const SettingReviewWorkflow = "review_workflow"
+
+const (
+	NodeReleaseAuditActionReviewSubmit   = "review_submit"
+	NodeReleaseAuditActionReviewApprove  = "review_approve"
+	NodeReleaseAuditActionReviewReject   = "review_reject"
+	NodeReleaseAuditActionReviewWithdraw = "review_withdraw"
+)
+
+var (
+	ErrNodeReviewRequired     = errors.New("nodes need an approved review before publishing")
+	ErrNodeReviewNotRequired  = errors.New("node is not covered by the review workflow")
+	ErrNodeReviewNothingToDo  = errors.New("node has no unpublished changes")
+	ErrNodeReviewNotPending   = errors.New("review is not pending")
+	ErrNodeReviewNotReviewer  = errors.New("user is not a reviewer of the current stage")
+	ErrNodeReviewSelfApproval = errors.New("submitter can't review their own changes")
+)
+
+type ReviewWorkflowStage struct {
+	Name string `json:"name"`
+	// ReviewerIDs may review this stage besides the users with full control of the kb
+	ReviewerIDs []string `json:"reviewer_ids"`
+}
+
+type ReviewWorkflowSettings struct {
+	Enabled bool `json:"enabled"`
+	// FolderIDs limits the workflow to these subtrees, empty covers the whole kb
+	FolderIDs []string `json:"folder_ids"`
+	// Stages are passed in order, with no stages a single full control approval is needed
+	Stages []ReviewWorkflowStage `json:"stages"`
+}
+
+type UpdateReviewWorkflowSettingsReq struct {
+	KBID string `json:"kb_id" validate:"required"`
+	ReviewWorkflowSettings
+}
+
+func (s *ReviewWorkflowSettings) StageCount() int {
+	return max(len(s.Stages), 1)
+}
+
+// CanReview reports whether userID is a designated reviewer of stage.
+func (s *ReviewWorkflowSettings) CanReview(stage int, userID string) bool {
+	if stage < 0 || stage >= len(s.Stages) {
+		return false
+	}
+	return slices.Contains(s.Stages[stage].ReviewerIDs, userID)
+}
+
+type NodeReviewStatus string
+
+const (
+	NodeReviewStatusPending   NodeReviewStatus = "pending"
+	NodeReviewStatusApproved  NodeReviewStatus = "approved"
+	NodeReviewStatusRejected  NodeReviewStatus = "rejected"
+	NodeReviewStatusWithdrawn NodeReviewStatus = "withdrawn"
+	NodeReviewStatusReleased  NodeReviewStatus = "released"
+)
+
+// table: node_reviews
+type NodeReview struct {
+	ID     string           `json:"id" gorm:"primaryKey"`
+	KBID   string           `json:"kb_id"`
+	NodeID string           `json:"node_id"`
+	Status NodeReviewStatus `json:"status"`
+	// Stage is the zero based stage under review
+	Stage      int `json:"stage"`
+	StageCount int `json:"stage_count"`
+	// snapshot of the draft as submitted, Digest ties an approval to exactly this content
+	Name          string     `json:"name"`
+	Content       string     `json:"content"`
+	Meta          NodeMeta   `json:"meta" gorm:"type:jsonb"`
+	Digest        string     `json:"digest"`
+	BaseReleaseID string     `json:"base_release_id"` // latest node release when submitted
+	SubmitterID   string     `json:"submitter_id"`
+	Comment       string     `json:"comment"`
+	ReleaseID     string     `json:"release_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+}
+
+func (NodeReview) TableName() string {
+	return "node_reviews"
+}
+
+// NodeReviewDigest fingerprints the publishable fields of a node.
+func NodeReviewDigest(name, content string, meta NodeMeta) string {
+	metaBytes, _ := json.Marshal(meta)
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(content))
+	h.Write([]byte{0})
+	h.Write(metaBytes)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type NodeReviewListItem struct {
+	NodeReview
+	SubmitterAccount string `json:"submitter_account"`
+}
+
+type NodeReviewListReq struct {
+	KBID   string           `json:"kb_id" query:"kb_id" validate:"required"`
+	NodeID string           `json:"node_id" query:"node_id"`
+	Status NodeReviewStatus `json:"status" query:"status"`
+	Pager
+}
+
+type NodeReviewListResp = PaginatedResult[[]*NodeReviewListItem]
+
+type NodeReviewDetailReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+	ID   string `json:"id" query:"id" validate:"required"`
+}
+
+type NodeReviewDetailResp struct {
+	Review *NodeReviewListItem `json:"review"`
+	// Diff compares the submitted draft with the node release it was based on
+	Diff *GetNodeReleaseDiffResp `json:"diff"`
+	// Outdated is set when the node changed after submission, the approval won't cover it
+	Outdated bool                `json:"outdated"`
+	History  []*NodeReleaseAudit `json:"history"`
+}
+
+type SubmitNodeReviewReq struct {
+	KBID    string `json:"kb_id" validate:"required"`
+	NodeID  string `json:"node_id" validate:"required"`
+	Comment string `json:"comment"`
+}
+
+type NodeReviewActionReq struct {
+	KBID    string `json:"kb_id" validate:"required"`
+	ID      string `json:"id" validate:"required"`
+	Action  string `json:"action" validate:"required,oneof=approve reject withdraw"`
+	Comment string `json:"comment"`
+}
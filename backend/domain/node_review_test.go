@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeReviewDigest(t *testing.T) {
+	meta := NodeMeta{Summary: "summary"}
+	digest := NodeReviewDigest("name", "content", meta)
+	assert.Equal(t, digest, NodeReviewDigest("name", "content", meta))
+
+	assert.NotEqual(t, digest, NodeReviewDigest("name", "content!", meta))
+	assert.NotEqual(t, digest, NodeReviewDigest("name", "content", NodeMeta{Summary: "changed"}))
+	// field boundaries are part of the digest
+	assert.NotEqual(t, NodeReviewDigest("ab", "c", meta), NodeReviewDigest("a", "bc", meta))
+}
+
+func TestReviewWorkflowSettingsStages(t *testing.T) {
+	settings := &ReviewWorkflowSettings{}
+	assert.Equal(t, 1, settings.StageCount())
+	assert.False(t, settings.CanReview(0, "user"))
+
+	settings.Stages = []ReviewWorkflowStage{
+		{Name: "editor", ReviewerIDs: []string{"editor"}},
+		{Name: "legal", ReviewerIDs: []string{"legal"}},
+	}
+	assert.Equal(t, 2, settings.StageCount())
+	assert.True(t, settings.CanReview(0, "editor"))
+	assert.False(t, settings.CanReview(1, "editor"))
+	assert.True(t, settings.CanReview(1, "legal"))
+	assert.False(t, settings.CanReview(2, "legal"))
+}
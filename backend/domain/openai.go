@@ -1,9 +1,15 @@
 package domain
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
+
+	"github.com/cloudwego/eino/schema"
+	einojsonschema "github.com/eino-contrib/jsonschema"
+	"github.com/santhosh-tekuri/jsonschema/v6"
 )
 
 // OpenAI API 请求结构体
@@ -159,6 +165,7 @@ type OpenAIFunction struct {
 }
 
 type OpenAIToolCall struct {
+	Index    *int               `json:"index,omitempty"` // only set in stream deltas
 	ID       string             `json:"id" validate:"required"`
 	Type     string             `json:"type" validate:"required"`
 	Function OpenAIFunctionCall `json:"function" validate:"required"`
@@ -174,12 +181,38 @@ type OpenAIToolChoice struct {
 	Function *OpenAIFunctionChoice `json:"function,omitempty"`
 }
 
+// UnmarshalJSON 支持 "none"/"auto"/"required" 字符串或 {"type":"function",...} 对象
+func (tc *OpenAIToolChoice) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		tc.Type = str
+		tc.Function = nil
+		return nil
+	}
+
+	type toolChoice OpenAIToolChoice
+	var obj toolChoice
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("tool_choice must be string or object")
+	}
+	*tc = OpenAIToolChoice(obj)
+	return nil
+}
+
 type OpenAIFunctionChoice struct {
 	Name string `json:"name" validate:"required"`
 }
 
 type OpenAIResponseFormat struct {
-	Type string `json:"type" validate:"required"`
+	Type       string            `json:"type" validate:"required"`
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type OpenAIJSONSchema struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
 }
 
 // OpenAI API 响应结构体
@@ -221,6 +254,67 @@ type OpenAIStreamChoice struct {
 	FinishReason *string       `json:"finish_reason,omitempty"`
 }
 
+// OpenAIEmbeddingsRequest is the request of the OpenAI-compatible embeddings api, model is
+// ignored in favour of the configured embedding model.
+type OpenAIEmbeddingsRequest struct {
+	Model          string          `json:"model"`
+	Input          EmbeddingsInput `json:"input"`
+	EncodingFormat string          `json:"encoding_format,omitempty" validate:"omitempty,oneof=float base64"`
+	Dimensions     *int            `json:"dimensions,omitempty"`
+	User           string          `json:"user,omitempty"`
+}
+
+// OpenAIEmbeddingsMaxInputs caps the texts of one embeddings request, as OpenAI does.
+const OpenAIEmbeddingsMaxInputs = 2048
+
+// EmbeddingsInput 支持字符串或字符串数组, token 数组不支持
+type EmbeddingsInput []string
+
+func (in *EmbeddingsInput) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*in = EmbeddingsInput{str}
+		return nil
+	}
+	var arr []string
+	if err := json.Unmarshal(data, &arr); err == nil {
+		*in = arr
+		return nil
+	}
+	return fmt.Errorf("input must be string or array of strings")
+}
+
+type OpenAIEmbeddingsResponse struct {
+	Object string                `json:"object"`
+	Data   []OpenAIEmbedding     `json:"data"`
+	Model  string                `json:"model"`
+	Usage  OpenAIEmbeddingsUsage `json:"usage"`
+}
+
+type OpenAIEmbedding struct {
+	Object string `json:"object"`
+	Index  int    `json:"index"`
+	// Embedding is []float32, or a base64 string of little-endian float32s
+	Embedding any `json:"embedding"`
+}
+
+type OpenAIEmbeddingsUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+type OpenAIModelListResponse struct {
+	Object string        `json:"object"`
+	Data   []OpenAIModel `json:"data"`
+}
+
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
 // APICallAudit records OpenAI-compatible API call audit info.
 type APICallAudit struct {
 	KBID             string  `json:"kb_id"`
@@ -253,3 +347,250 @@ type OpenAIError struct {
 	Code    string `json:"code,omitempty"`
 	Param   string `json:"param,omitempty"`
 }
+
+const (
+	OpenAIResponseFormatText       = "text"
+	OpenAIResponseFormatJSONObject = "json_object"
+	OpenAIResponseFormatJSONSchema = "json_schema"
+
+	OpenAIToolChoiceNone     = "none"
+	OpenAIToolChoiceAuto     = "auto"
+	OpenAIToolChoiceRequired = "required"
+	OpenAIToolChoiceFunction = "function"
+
+	OpenAIFinishReasonStop      = "stop"
+	OpenAIFinishReasonToolCalls = "tool_calls"
+
+	// KBSearchToolName is the built-in tool the model calls to search the knowledge base. The
+	// server answers it, so it never shows up in the tool_calls returned to the client.
+	KBSearchToolName = "search_knowledge_base"
+)
+
+var openAIToolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// OpenAIChatOptions is the part of an OpenAI-compatible request that a plain chat has no
+// room for: the client messages with their roles, the client tools and the response format.
+type OpenAIChatOptions struct {
+	Messages   []*schema.Message
+	Tools      []*schema.ToolInfo
+	ToolChoice string
+	// ForcedTool is the function named by a {"type":"function"} tool choice.
+	ForcedTool     string
+	ResponseFormat string
+	JSONSchema     *OpenAIJSONSchema
+
+	compiledSchema *jsonschema.Schema
+}
+
+// UseTools reports whether the model gets the client tools and the kb search tool. Without
+// them the documents are retrieved before the model is called, as in a normal chat.
+func (o *OpenAIChatOptions) UseTools() bool {
+	if o.ToolChoice == OpenAIToolChoiceNone {
+		return false
+	}
+	return len(o.Tools) > 0 || o.ToolChoice != ""
+}
+
+// WantsJSON reports whether the answer must be a json document.
+func (o *OpenAIChatOptions) WantsJSON() bool {
+	return o.ResponseFormat == OpenAIResponseFormatJSONObject || o.ResponseFormat == OpenAIResponseFormatJSONSchema
+}
+
+// ValidateResponse checks an answer against the requested response format.
+func (o *OpenAIChatOptions) ValidateResponse(content string) error {
+	switch o.ResponseFormat {
+	case OpenAIResponseFormatJSONObject:
+		var object map[string]any
+		if err := json.Unmarshal([]byte(content), &object); err != nil || object == nil {
+			return fmt.Errorf("answer is not a json object")
+		}
+	case OpenAIResponseFormatJSONSchema:
+		instance, err := jsonschema.UnmarshalJSON(strings.NewReader(content))
+		if err != nil {
+			return fmt.Errorf("answer is not valid json: %w", err)
+		}
+		if err := o.compiledSchema.Validate(instance); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChatOptions converts the request for the chat usecase and returns the content of the last
+// user message as the question. Errors describe what is wrong with the request.
+func (r *OpenAICompletionsRequest) ChatOptions() (*OpenAIChatOptions, string, error) {
+	options := &OpenAIChatOptions{
+		Messages: make([]*schema.Message, 0, len(r.Messages)),
+		Tools:    make([]*schema.ToolInfo, 0, len(r.Tools)),
+	}
+	question := ""
+	for i := range r.Messages {
+		message, err := r.Messages[i].toSchemaMessage()
+		if err != nil {
+			return nil, "", fmt.Errorf("messages[%d]: %w", i, err)
+		}
+		if message.Role == schema.User && strings.TrimSpace(message.Content) != "" {
+			question = strings.TrimSpace(message.Content)
+		}
+		options.Messages = append(options.Messages, message)
+	}
+	if question == "" {
+		return nil, "", fmt.Errorf("no user message found")
+	}
+
+	toolNames := make(map[string]bool, len(r.Tools))
+	for i := range r.Tools {
+		tool, err := r.Tools[i].toToolInfo()
+		if err != nil {
+			return nil, "", fmt.Errorf("tools[%d]: %w", i, err)
+		}
+		if toolNames[tool.Name] {
+			return nil, "", fmt.Errorf("tools[%d]: duplicate tool name %q", i, tool.Name)
+		}
+		toolNames[tool.Name] = true
+		options.Tools = append(options.Tools, tool)
+	}
+
+	if r.ToolChoice != nil {
+		switch r.ToolChoice.Type {
+		case OpenAIToolChoiceNone, OpenAIToolChoiceAuto, OpenAIToolChoiceRequired:
+		case OpenAIToolChoiceFunction:
+			if r.ToolChoice.Function == nil || (!toolNames[r.ToolChoice.Function.Name] && r.ToolChoice.Function.Name != KBSearchToolName) {
+				return nil, "", fmt.Errorf("tool_choice must name one of the tools")
+			}
+			options.ForcedTool = r.ToolChoice.Function.Name
+		default:
+			return nil, "", fmt.Errorf("unsupported tool_choice %q", r.ToolChoice.Type)
+		}
+		options.ToolChoice = r.ToolChoice.Type
+	}
+
+	if r.ResponseFormat != nil {
+		switch r.ResponseFormat.Type {
+		case OpenAIResponseFormatText, OpenAIResponseFormatJSONObject:
+		case OpenAIResponseFormatJSONSchema:
+			if r.ResponseFormat.JSONSchema == nil || len(r.ResponseFormat.JSONSchema.Schema) == 0 {
+				return nil, "", fmt.Errorf("response_format.json_schema.schema is required")
+			}
+			compiled, err := compileJSONSchema(r.ResponseFormat.JSONSchema.Schema)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid response_format.json_schema.schema: %w", err)
+			}
+			options.JSONSchema = r.ResponseFormat.JSONSchema
+			options.compiledSchema = compiled
+		default:
+			return nil, "", fmt.Errorf("unsupported response_format %q", r.ResponseFormat.Type)
+		}
+		options.ResponseFormat = r.ResponseFormat.Type
+	}
+	return options, question, nil
+}
+
+func (m *OpenAIMessage) toSchemaMessage() (*schema.Message, error) {
+	content := ""
+	if m.Content != nil {
+		content = m.Content.StringWithImages()
+	}
+	switch strings.ToLower(strings.TrimSpace(m.Role)) {
+	case "system", "developer":
+		return schema.SystemMessage(content), nil
+	case "user":
+		return schema.UserMessage(content), nil
+	case "assistant":
+		var toolCalls []schema.ToolCall
+		for _, call := range m.ToolCalls {
+			toolCalls = append(toolCalls, schema.ToolCall{
+				ID:   call.ID,
+				Type: "function",
+				Function: schema.FunctionCall{
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+				},
+			})
+		}
+		return schema.AssistantMessage(content, toolCalls), nil
+	case "tool":
+		if m.ToolCallID == "" {
+			return nil, fmt.Errorf("tool message requires tool_call_id")
+		}
+		return schema.ToolMessage(content, m.ToolCallID, schema.WithToolName(m.Name)), nil
+	default:
+		return nil, fmt.Errorf("unsupported role %q", m.Role)
+	}
+}
+
+func (t *OpenAITool) toToolInfo() (*schema.ToolInfo, error) {
+	if t.Type != "function" || t.Function == nil {
+		return nil, fmt.Errorf("only function tools are supported")
+	}
+	name := t.Function.Name
+	if !openAIToolNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid function name %q", name)
+	}
+	if name == KBSearchToolName {
+		return nil, fmt.Errorf("function name %q is reserved", name)
+	}
+	info := &schema.ToolInfo{Name: name, Desc: t.Function.Description}
+	if len(t.Function.Parameters) > 0 {
+		data, err := json.Marshal(t.Function.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		var params einojsonschema.Schema
+		if err := json.Unmarshal(data, &params); err != nil {
+			return nil, fmt.Errorf("invalid parameters of %q: %w", name, err)
+		}
+		info.ParamsOneOf = schema.NewParamsOneOfByJSONSchema(&params)
+	}
+	return info, nil
+}
+
+func compileJSONSchema(doc map[string]any) (*jsonschema.Schema, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("response_format.json", resource); err != nil {
+		return nil, err
+	}
+	return compiler.Compile("response_format.json")
+}
+
+// KBSearchArguments are the arguments of the kb search tool.
+type KBSearchArguments struct {
+	Query string `json:"query"`
+}
+
+// KBSearchToolInfo describes the kb search tool to the model.
+func KBSearchToolInfo() *schema.ToolInfo {
+	return &schema.ToolInfo{
+		Name: KBSearchToolName,
+		Desc: "Search the knowledge base for documents relevant to a query. Returns the matching documents, call it again with a different query when they do not answer the question.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"query": {
+				Type:     schema.String,
+				Desc:     "a standalone search query",
+				Required: true,
+			},
+		}),
+	}
+}
+
+// NewOpenAIToolCall converts a tool call of the model for the response, index is only set
+// in stream deltas.
+func NewOpenAIToolCall(call schema.ToolCall, index *int) OpenAIToolCall {
+	return OpenAIToolCall{
+		Index: index,
+		ID:    call.ID,
+		Type:  "function",
+		Function: OpenAIFunctionCall{
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		},
+	}
+}
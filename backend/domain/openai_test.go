@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/cloudwego/eino/schema"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -184,3 +185,103 @@ func TestMessageContent_String_NoTextParts(t *testing.T) {
 	})
 	assert.Equal(t, "", mc.String())
 }
+
+func TestOpenAIToolChoice_UnmarshalJSON(t *testing.T) {
+	var choice OpenAIToolChoice
+	require.NoError(t, json.Unmarshal([]byte(`"required"`), &choice))
+	assert.Equal(t, OpenAIToolChoiceRequired, choice.Type)
+	assert.Nil(t, choice.Function)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"function","function":{"name":"get_weather"}}`), &choice))
+	assert.Equal(t, OpenAIToolChoiceFunction, choice.Type)
+	require.NotNil(t, choice.Function)
+	assert.Equal(t, "get_weather", choice.Function.Name)
+
+	assert.Error(t, json.Unmarshal([]byte(`1`), &choice))
+}
+
+func TestOpenAICompletionsRequest_ChatOptions(t *testing.T) {
+	var req OpenAICompletionsRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "wiki",
+		"messages": [
+			{"role": "system", "content": "be brief"},
+			{"role": "user", "content": "weather in Paris?"},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "sunny"}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}}}],
+		"tool_choice": "auto",
+		"response_format": {"type": "json_schema", "json_schema": {"name": "answer", "schema": {"type": "object", "properties": {"answer": {"type": "string"}}, "required": ["answer"], "additionalProperties": false}}}
+	}`), &req))
+
+	options, question, err := req.ChatOptions()
+	require.NoError(t, err)
+	assert.Equal(t, "weather in Paris?", question)
+	require.Len(t, options.Messages, 4)
+	assert.Equal(t, schema.System, options.Messages[0].Role)
+	assert.Equal(t, schema.User, options.Messages[1].Role)
+	assert.Equal(t, schema.Assistant, options.Messages[2].Role)
+	require.Len(t, options.Messages[2].ToolCalls, 1)
+	assert.Equal(t, "get_weather", options.Messages[2].ToolCalls[0].Function.Name)
+	assert.Equal(t, schema.Tool, options.Messages[3].Role)
+	assert.Equal(t, "call_1", options.Messages[3].ToolCallID)
+	require.Len(t, options.Tools, 1)
+	assert.NotNil(t, options.Tools[0].ParamsOneOf)
+	assert.True(t, options.UseTools())
+	assert.True(t, options.WantsJSON())
+
+	assert.NoError(t, options.ValidateResponse(`{"answer":"sunny"}`))
+	assert.Error(t, options.ValidateResponse(`{"answer":1}`))
+	assert.Error(t, options.ValidateResponse(`{"answer":"sunny","extra":true}`))
+	assert.Error(t, options.ValidateResponse(`sunny`))
+}
+
+func TestOpenAICompletionsRequest_ChatOptions_Invalid(t *testing.T) {
+	user := OpenAIMessage{Role: "user", Content: NewStringContent("hi")}
+	weather := OpenAITool{Type: "function", Function: &OpenAIFunction{Name: "get_weather"}}
+	tests := []struct {
+		name string
+		req  OpenAICompletionsRequest
+		err  string
+	}{
+		{"no user message", OpenAICompletionsRequest{Messages: []OpenAIMessage{{Role: "system", Content: NewStringContent("x")}}}, "no user message"},
+		{"unknown role", OpenAICompletionsRequest{Messages: []OpenAIMessage{{Role: "function"}, user}}, "unsupported role"},
+		{"tool without id", OpenAICompletionsRequest{Messages: []OpenAIMessage{user, {Role: "tool", Content: NewStringContent("x")}}}, "tool_call_id"},
+		{"reserved tool", OpenAICompletionsRequest{Messages: []OpenAIMessage{user}, Tools: []OpenAITool{{Type: "function", Function: &OpenAIFunction{Name: KBSearchToolName}}}}, "reserved"},
+		{"duplicate tool", OpenAICompletionsRequest{Messages: []OpenAIMessage{user}, Tools: []OpenAITool{weather, weather}}, "duplicate"},
+		{"unknown forced tool", OpenAICompletionsRequest{Messages: []OpenAIMessage{user}, Tools: []OpenAITool{weather}, ToolChoice: &OpenAIToolChoice{Type: "function", Function: &OpenAIFunctionChoice{Name: "other"}}}, "tool_choice"},
+		{"missing schema", OpenAICompletionsRequest{Messages: []OpenAIMessage{user}, ResponseFormat: &OpenAIResponseFormat{Type: "json_schema"}}, "schema is required"},
+		{"unknown format", OpenAICompletionsRequest{Messages: []OpenAIMessage{user}, ResponseFormat: &OpenAIResponseFormat{Type: "xml"}}, "unsupported response_format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tt.req.ChatOptions()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	// without tools the documents are retrieved up front unless a tool_choice asks for the kb tool
+	options, _, err := (&OpenAICompletionsRequest{Messages: []OpenAIMessage{user}}).ChatOptions()
+	require.NoError(t, err)
+	assert.False(t, options.UseTools())
+	options, _, err = (&OpenAICompletionsRequest{
+		Messages:   []OpenAIMessage{user},
+		ToolChoice: &OpenAIToolChoice{Type: "function", Function: &OpenAIFunctionChoice{Name: KBSearchToolName}},
+	}).ChatOptions()
+	require.NoError(t, err)
+	assert.True(t, options.UseTools())
+	assert.Equal(t, KBSearchToolName, options.ForcedTool)
+}
+
+func TestEmbeddingsInput_UnmarshalJSON(t *testing.T) {
+	var req OpenAIEmbeddingsRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"model":"m","input":"hello"}`), &req))
+	assert.Equal(t, EmbeddingsInput{"hello"}, req.Input)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"model":"m","input":["a","b"]}`), &req))
+	assert.Equal(t, EmbeddingsInput{"a", "b"}, req.Input)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"model":"m","input":[1,2,3]}`), &req))
+}
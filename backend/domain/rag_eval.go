@@ -0,0 +1,327 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RAGEvalTimeout bounds a single evaluation run.
+const RAGEvalTimeout = time.Hour
+
+const RAGEvalDefaultTopK = 5
+
+var (
+	ErrRAGEvalDatasetEmpty     = errors.New("rag eval dataset has no cases")
+	ErrRAGEvalNoEmbeddingModel = errors.New("embedding model is not configured")
+	ErrRAGEvalPromptVersion    = errors.New("prompt version not found")
+	ErrRAGEvalNotChatModel     = errors.New("model is not a chat model")
+)
+
+// RAGEvalScorer scores the answer against the expected answer.
+type RAGEvalScorer string
+
+const (
+	// RAGEvalScorerLLM asks the chat model to judge the answer
+	RAGEvalScorerLLM RAGEvalScorer = "llm"
+	// RAGEvalScorerEmbedding takes the cosine similarity of the answer embeddings
+	RAGEvalScorerEmbedding RAGEvalScorer = "embedding"
+)
+
+type RAGEvalRunStatus string
+
+const (
+	RAGEvalRunStatusPending RAGEvalRunStatus = "pending"
+	RAGEvalRunStatusRunning RAGEvalRunStatus = "running"
+	RAGEvalRunStatusSuccess RAGEvalRunStatus = "success"
+	RAGEvalRunStatusFailed  RAGEvalRunStatus = "failed"
+)
+
+// table: rag_eval_datasets
+//
+// RAGEvalDataset is a golden set of questions for a knowledge base.
+type RAGEvalDataset struct {
+	ID          string    `json:"id" gorm:"primaryKey"`
+	KBID        string    `json:"kb_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatorID   string    `json:"creator_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (RAGEvalDataset) TableName() string {
+	return "rag_eval_datasets"
+}
+
+type RAGEvalDatasetListItem struct {
+	RAGEvalDataset
+	CaseCount int64 `json:"case_count"`
+}
+
+// table: rag_eval_cases
+type RAGEvalCase struct {
+	ID              string         `json:"id" gorm:"primaryKey"`
+	KBID            string         `json:"kb_id"`
+	DatasetID       string         `json:"dataset_id"`
+	Question        string         `json:"question"`
+	ExpectedAnswer  string         `json:"expected_answer"`
+	ExpectedNodeIDs pq.StringArray `json:"expected_node_ids" gorm:"type:text[]"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+}
+
+func (RAGEvalCase) TableName() string {
+	return "rag_eval_cases"
+}
+
+// RAGEvalMetrics aggregates the results of a run. Recall is averaged over the cases with expected
+// nodes, AnswerScore over the cases with an expected answer.
+type RAGEvalMetrics struct {
+	Cases       int      `json:"cases"`
+	Failed      int      `json:"failed"`
+	Recall      *float64 `json:"recall"`
+	HitRate     *float64 `json:"hit_rate"` // share of cases with at least one expected node in the top k
+	AnswerScore *float64 `json:"answer_score"`
+	// DurationMS is the mean time of a case, retrieval and answer included
+	DurationMS    int64 `json:"duration_ms"`
+	TotalTokens   int   `json:"total_tokens"`
+	AnsweredCases int   `json:"answered_cases"`
+}
+
+func (m RAGEvalMetrics) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+func (m *RAGEvalMetrics) Scan(value any) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("invalid rag eval metrics type: %T", value)
+	}
+	return json.Unmarshal(bytes, m)
+}
+
+// table: rag_eval_runs
+//
+// RAGEvalRun runs a dataset against a prompt version and model, runs of the same dataset are
+// compared by their metrics. Questions are asked as an anonymous visitor, so only documents open
+// to everyone are retrieved.
+type RAGEvalRun struct {
+	ID        string `json:"id" gorm:"primaryKey"`
+	KBID      string `json:"kb_id"`
+	DatasetID string `json:"dataset_id"`
+	// PromptVersion is the prompt_versions version the run used, 0 when the kb never saved a prompt.
+	// Prompt is the system prompt itself, resolved when the run is created.
+	PromptVersion int              `json:"prompt_version"`
+	Prompt        string           `json:"prompt"`
+	ModelID       string           `json:"model_id"`
+	ModelName     string           `json:"model_name"`
+	Scorer        RAGEvalScorer    `json:"scorer"`
+	TopK          int              `json:"top_k"`
+	Status        RAGEvalRunStatus `json:"status"`
+	Progress      int              `json:"progress"` // 0-100
+	Error         string           `json:"error"`
+	Metrics       RAGEvalMetrics   `json:"metrics" gorm:"type:jsonb"`
+	CreatorID     string           `json:"creator_id"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	FinishedAt    *time.Time       `json:"finished_at"`
+}
+
+func (RAGEvalRun) TableName() string {
+	return "rag_eval_runs"
+}
+
+// table: rag_eval_results
+type RAGEvalResult struct {
+	ID               int64          `json:"id" gorm:"primaryKey;autoIncrement"`
+	RunID            string         `json:"run_id"`
+	CaseID           string         `json:"case_id"`
+	Question         string         `json:"question"`
+	ExpectedAnswer   string         `json:"expected_answer"`
+	ExpectedNodeIDs  pq.StringArray `json:"expected_node_ids" gorm:"type:text[]"`
+	Answer           string         `json:"answer"`
+	RetrievedNodeIDs pq.StringArray `json:"retrieved_node_ids" gorm:"type:text[]"`
+	Recall           *float64       `json:"recall"`
+	AnswerScore      *float64       `json:"answer_score"`
+	// JudgeReason is the explanation of the llm scorer
+	JudgeReason string    `json:"judge_reason"`
+	Error       string    `json:"error"`
+	TotalTokens int       `json:"total_tokens"`
+	DurationMS  int64     `json:"duration_ms"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (RAGEvalResult) TableName() string {
+	return "rag_eval_results"
+}
+
+// RAGEvalTask asks the consumer to execute a pending run.
+type RAGEvalTask struct {
+	RunID string `json:"run_id"`
+}
+
+// RecallAtK is the share of expected nodes among the first k retrieved ones. It is nil when
+// nothing is expected.
+func RecallAtK(expected, retrieved []string, k int) *float64 {
+	if len(expected) == 0 {
+		return nil
+	}
+	if k > 0 && len(retrieved) > k {
+		retrieved = retrieved[:k]
+	}
+	top := make(map[string]struct{}, len(retrieved))
+	for _, id := range retrieved {
+		top[id] = struct{}{}
+	}
+	found := 0
+	for _, id := range expected {
+		if _, ok := top[id]; ok {
+			found++
+		}
+	}
+	recall := float64(found) / float64(len(expected))
+	return &recall
+}
+
+// CosineSimilarity of two embeddings, clamped to [0, 1] so it reads like the other answer scores.
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return math.Max(0, math.Min(1, dot/(math.Sqrt(normA)*math.Sqrt(normB))))
+}
+
+// SummarizeRAGEvalResults computes the metrics of a run from its results.
+func SummarizeRAGEvalResults(results []*RAGEvalResult) RAGEvalMetrics {
+	metrics := RAGEvalMetrics{Cases: len(results)}
+	var recallSum, hitSum, scoreSum float64
+	var recallCount, scoreCount int
+	var duration int64
+	for _, result := range results {
+		if result.Error != "" {
+			metrics.Failed++
+			continue
+		}
+		metrics.AnsweredCases++
+		duration += result.DurationMS
+		metrics.TotalTokens += result.TotalTokens
+		if result.Recall != nil {
+			recallSum += *result.Recall
+			if *result.Recall > 0 {
+				hitSum++
+			}
+			recallCount++
+		}
+		if result.AnswerScore != nil {
+			scoreSum += *result.AnswerScore
+			scoreCount++
+		}
+	}
+	if metrics.AnsweredCases > 0 {
+		metrics.DurationMS = duration / int64(metrics.AnsweredCases)
+	}
+	if recallCount > 0 {
+		recall, hitRate := recallSum/float64(recallCount), hitSum/float64(recallCount)
+		metrics.Recall, metrics.HitRate = &recall, &hitRate
+	}
+	if scoreCount > 0 {
+		score := scoreSum / float64(scoreCount)
+		metrics.AnswerScore = &score
+	}
+	return metrics
+}
+
+type CreateRAGEvalDatasetReq struct {
+	KBID        string `json:"kb_id" validate:"required"`
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+}
+
+type UpdateRAGEvalDatasetReq struct {
+	ID          string `json:"id" validate:"required"`
+	KBID        string `json:"kb_id" validate:"required"`
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+}
+
+type RAGEvalDatasetListReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+}
+
+type RAGEvalDatasetReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+	ID   string `json:"id" query:"id" validate:"required"`
+}
+
+type RAGEvalCaseInput struct {
+	Question        string   `json:"question" validate:"required"`
+	ExpectedAnswer  string   `json:"expected_answer"`
+	ExpectedNodeIDs []string `json:"expected_node_ids"`
+}
+
+// AddRAGEvalCasesReq appends cases to a dataset, e.g. a golden set exported as json.
+type AddRAGEvalCasesReq struct {
+	KBID      string              `json:"kb_id" validate:"required"`
+	DatasetID string              `json:"dataset_id" validate:"required"`
+	Cases     []*RAGEvalCaseInput `json:"cases" validate:"required,min=1,dive"`
+}
+
+type UpdateRAGEvalCaseReq struct {
+	ID   string `json:"id" validate:"required"`
+	KBID string `json:"kb_id" validate:"required"`
+	RAGEvalCaseInput
+}
+
+type RAGEvalCaseListReq struct {
+	KBID      string `json:"kb_id" query:"kb_id" validate:"required"`
+	DatasetID string `json:"dataset_id" query:"dataset_id" validate:"required"`
+}
+
+type DeleteRAGEvalCaseReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+	ID   string `json:"id" query:"id" validate:"required"`
+}
+
+type CreateRAGEvalRunReq struct {
+	KBID      string `json:"kb_id" validate:"required"`
+	DatasetID string `json:"dataset_id" validate:"required"`
+	// PromptVersion replays a saved prompt version, 0 uses the current prompt
+	PromptVersion int `json:"prompt_version" validate:"min=0"`
+	// ModelID picks a configured model, empty uses the chat model
+	ModelID string        `json:"model_id"`
+	Scorer  RAGEvalScorer `json:"scorer" validate:"omitempty,oneof=llm embedding"`
+	TopK    int           `json:"top_k" validate:"omitempty,min=1,max=50"`
+}
+
+type RAGEvalRunListReq struct {
+	KBID      string `json:"kb_id" query:"kb_id" validate:"required"`
+	DatasetID string `json:"dataset_id" query:"dataset_id"`
+	Pager
+}
+
+type RAGEvalRunListResp = PaginatedResult[[]*RAGEvalRun]
+
+type RAGEvalRunDetailReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+	ID   string `json:"id" query:"id" validate:"required"`
+}
+
+type RAGEvalRunDetailResp struct {
+	Run     *RAGEvalRun      `json:"run"`
+	Results []*RAGEvalResult `json:"results"`
+}
@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecallAtK(t *testing.T) {
+	assert.Nil(t, RecallAtK(nil, []string{"a"}, 5))
+
+	assert.Equal(t, 1.0, *RecallAtK([]string{"a", "b"}, []string{"b", "c", "a"}, 3))
+	// only the first k retrieved nodes count
+	assert.Equal(t, 0.5, *RecallAtK([]string{"a", "b"}, []string{"b", "c", "a"}, 2))
+	assert.Equal(t, 0.0, *RecallAtK([]string{"a"}, nil, 5))
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	assert.InDelta(t, 1.0, CosineSimilarity([]float32{1, 2}, []float32{2, 4}), 1e-9)
+	assert.InDelta(t, 0.0, CosineSimilarity([]float32{1, 0}, []float32{0, 1}), 1e-9)
+	// opposite answers score 0, not negative
+	assert.Equal(t, 0.0, CosineSimilarity([]float32{1, 0}, []float32{-1, 0}))
+	assert.Equal(t, 0.0, CosineSimilarity([]float32{1}, []float32{1, 0}))
+}
+
+func TestSummarizeRAGEvalResults(t *testing.T) {
+	metrics := SummarizeRAGEvalResults([]*RAGEvalResult{
+		{Recall: lo.ToPtr(1.0), AnswerScore: lo.ToPtr(0.8), DurationMS: 100, TotalTokens: 10},
+		{Recall: lo.ToPtr(0.0), DurationMS: 300, TotalTokens: 20},
+		{AnswerScore: lo.ToPtr(0.4), DurationMS: 200},
+		{Recall: lo.ToPtr(1.0), Error: "timeout"},
+	})
+	assert.Equal(t, 4, metrics.Cases)
+	assert.Equal(t, 1, metrics.Failed)
+	assert.Equal(t, 3, metrics.AnsweredCases)
+	assert.InDelta(t, 0.5, *metrics.Recall, 1e-9)
+	assert.InDelta(t, 0.5, *metrics.HitRate, 1e-9)
+	assert.InDelta(t, 0.6, *metrics.AnswerScore, 1e-9)
+	assert.Equal(t, int64(200), metrics.DurationMS)
+	assert.Equal(t, 30, metrics.TotalTokens)
+
+	empty := SummarizeRAGEvalResults(nil)
+	assert.Nil(t, empty.Recall)
+	assert.Nil(t, empty.AnswerScore)
+}
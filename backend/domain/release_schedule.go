@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type ReleaseScheduleStatus string
+
+const (
+	// ReleaseScheduleStatusPending waits for publish_at.
+	ReleaseScheduleStatusPending ReleaseScheduleStatus = "pending"
+	// ReleaseScheduleStatusRunning is held while the consumer executes a due publish or unpublish.
+	ReleaseScheduleStatusRunning ReleaseScheduleStatus = "running"
+	// ReleaseScheduleStatusPublished is live, it still waits for unpublish_at when set.
+	ReleaseScheduleStatusPublished   ReleaseScheduleStatus = "published"
+	ReleaseScheduleStatusUnpublished ReleaseScheduleStatus = "unpublished"
+	ReleaseScheduleStatusCanceled    ReleaseScheduleStatus = "canceled"
+	ReleaseScheduleStatusFailed      ReleaseScheduleStatus = "failed"
+)
+
+var (
+	ErrReleaseScheduleNotPending = errors.New("release schedule is not pending")
+	ErrReleaseScheduleInvalidAt  = errors.New("unpublish_at must be later than publish_at")
+	ErrReleaseScheduleNoNodes    = errors.New("unpublish_at requires node_ids")
+)
+
+// ReleaseScheduleLease is how long a consumer may hold a schedule running. Past it the consumer is
+// taken for dead and the schedule is executed again.
+const ReleaseScheduleLease = 10 * time.Minute
+
+// table: release_schedules
+type ReleaseSchedule struct {
+	ID      string         `json:"id" gorm:"primaryKey"`
+	KBID    string         `json:"kb_id"`
+	Tag     string         `json:"tag"`
+	Message string         `json:"message"`
+	NodeIDs pq.StringArray `json:"node_ids" gorm:"type:text[]"`
+	// UnpublishAt takes the nodes offline again, for time limited notices
+	PublishAt     time.Time             `json:"publish_at"`
+	UnpublishAt   *time.Time            `json:"unpublish_at"`
+	Status        ReleaseScheduleStatus `json:"status"`
+	ReleaseID     string                `json:"release_id"`
+	Error         string                `json:"error"`
+	CreatorID     string                `json:"creator_id"`
+	CreatedAt     time.Time             `json:"created_at"`
+	UpdatedAt     time.Time             `json:"updated_at"`
+	PublishedAt   *time.Time            `json:"published_at"`
+	UnpublishedAt *time.Time            `json:"unpublished_at"`
+}
+
+func (ReleaseSchedule) TableName() string {
+	return "release_schedules"
+}
+
+// DueUnpublish reports whether a published schedule has reached its expiry. A stale running one
+// counts as published once published_at is set, its consumer died while unpublishing.
+func (s *ReleaseSchedule) DueUnpublish(now time.Time) bool {
+	published := s.Status == ReleaseScheduleStatusPublished ||
+		(s.Status == ReleaseScheduleStatusRunning && s.PublishedAt != nil)
+	return published && s.UnpublishAt != nil && !s.UnpublishAt.After(now)
+}
+
+type ReleaseScheduleListItem struct {
+	ReleaseSchedule
+	CreatorAccount string `json:"creator_account"`
+}
+
+type CreateReleaseScheduleReq struct {
+	KBID        string     `json:"kb_id" validate:"required"`
+	Message     string     `json:"message" validate:"required"`
+	Tag         string     `json:"tag" validate:"required"`
+	NodeIDs     []string   `json:"node_ids"`
+	PublishAt   time.Time  `json:"publish_at" validate:"required"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+}
+
+// UpdateReleaseScheduleReq reschedules a schedule. publish_at can only move while the schedule is
+// pending, unpublish_at also while it is published; a nil unpublish_at removes the expiry.
+type UpdateReleaseScheduleReq struct {
+	ID          string     `json:"id" validate:"required"`
+	KBID        string     `json:"kb_id" validate:"required"`
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+}
+
+type ReleaseScheduleListReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+	// all lists finished schedules too, by default only pending ones and published ones waiting to expire
+	All bool `json:"all" query:"all"`
+	Pager
+}
+
+type ReleaseScheduleListResp = PaginatedResult[[]*ReleaseScheduleListItem]
+
+// KBReleasePushEvent asks the api server, which runs the bots, to push a release
+// executed by the consumer to group chats.
+type KBReleasePushEvent struct {
+	KBID      string `json:"kb_id"`
+	ReleaseID string `json:"release_id"`
+}
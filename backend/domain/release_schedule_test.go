@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReleaseScheduleDueUnpublish(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	schedule := &ReleaseSchedule{Status: ReleaseScheduleStatusPublished, UnpublishAt: &past}
+	assert.True(t, schedule.DueUnpublish(now))
+
+	schedule.UnpublishAt = &future
+	assert.False(t, schedule.DueUnpublish(now))
+
+	schedule.UnpublishAt = nil
+	assert.False(t, schedule.DueUnpublish(now))
+
+	schedule = &ReleaseSchedule{Status: ReleaseScheduleStatusPending, UnpublishAt: &past}
+	assert.False(t, schedule.DueUnpublish(now))
+}
@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrInvalidRetrievalWeights = errors.New("vector_weight and keyword_weight cannot both be 0")
+
+const (
+	SettingRetrieval = "retrieval_settings"
+
+	DefaultRRFK = 60
+)
+
+// RetrievalSettings controls how vector and keyword hits are merged
+// by reciprocal-rank fusion. A weight of 0 disables that retriever.
+type RetrievalSettings struct {
+	VectorWeight  float64 `json:"vector_weight" validate:"gte=0,lte=10"`
+	KeywordWeight float64 `json:"keyword_weight" validate:"gte=0,lte=10"`
+	RRFK          int     `json:"rrf_k" validate:"gte=0,lte=1000"`
+}
+
+func DefaultRetrievalSettings() *RetrievalSettings {
+	return &RetrievalSettings{
+		VectorWeight:  1,
+		KeywordWeight: 1,
+		RRFK:          DefaultRRFK,
+	}
+}
+
+type UpdateRetrievalSettingsReq struct {
+	KBID string `json:"kb_id" validate:"required"`
+	RetrievalSettings
+}
+
+// Fuse merges two ranked doc id lists with weighted reciprocal-rank fusion:
+// score(d) = Σ weight / (k + rank). Docs whose fused score is 0 are dropped.
+func (s *RetrievalSettings) Fuse(vectorDocIDs, keywordDocIDs []string) []string {
+	k := s.RRFK
+	if k <= 0 {
+		k = DefaultRRFK
+	}
+	scores := make(map[string]float64)
+	order := make([]string, 0, len(vectorDocIDs)+len(keywordDocIDs))
+	add := func(docIDs []string, weight float64) {
+		seen := make(map[string]struct{}, len(docIDs))
+		rank := 0
+		for _, docID := range docIDs {
+			if _, ok := seen[docID]; ok {
+				continue
+			}
+			seen[docID] = struct{}{}
+			rank++
+			if _, ok := scores[docID]; !ok {
+				order = append(order, docID)
+			}
+			scores[docID] += weight / float64(k+rank)
+		}
+	}
+	add(vectorDocIDs, s.VectorWeight)
+	add(keywordDocIDs, s.KeywordWeight)
+
+	fused := make([]string, 0, len(order))
+	for _, docID := range order {
+		if scores[docID] > 0 {
+			fused = append(fused, docID)
+		}
+	}
+	// stable sort keeps vector order for ties
+	sort.SliceStable(fused, func(i, j int) bool {
+		return scores[fused[i]] > scores[fused[j]]
+	})
+	return fused
+}
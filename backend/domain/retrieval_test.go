@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetrievalSettingsFuse(t *testing.T) {
+	s := DefaultRetrievalSettings()
+
+	// a doc found by both retrievers outranks docs found by one
+	fused := s.Fuse([]string{"a", "b", "c"}, []string{"c", "d"})
+	assert.Equal(t, []string{"c", "a", "b", "d"}, fused)
+
+	// duplicate chunks of one doc only count its first rank
+	fused = s.Fuse([]string{"a", "a", "b"}, nil)
+	assert.Equal(t, []string{"a", "b"}, fused)
+}
+
+func TestRetrievalSettingsFuseWeights(t *testing.T) {
+	s := &RetrievalSettings{VectorWeight: 1, KeywordWeight: 3, RRFK: 60}
+	fused := s.Fuse([]string{"a", "b"}, []string{"b", "c"})
+	assert.Equal(t, []string{"b", "c", "a"}, fused)
+
+	s = &RetrievalSettings{VectorWeight: 0, KeywordWeight: 1}
+	fused = s.Fuse([]string{"a", "b"}, []string{"c"})
+	assert.Equal(t, []string{"c"}, fused)
+}
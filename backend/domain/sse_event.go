@@ -1,11 +1,20 @@
 package domain
 
+import "github.com/cloudwego/eino/schema"
+
 type SSEEvent struct {
 	Type        string               `json:"type"`
 	Content     string               `json:"content"`
 	ChunkResult *NodeContentChunkSSE `json:"chunk_result,omitempty"`
 	Usage       *SSETokenUsage       `json:"usage,omitempty"`
 	Error       string               `json:"error,omitempty"`
+	// ToolCalls are set on "tool_call" events, which only the OpenAI-compatible api emits.
+	ToolCalls []schema.ToolCall `json:"tool_calls,omitempty"`
+	// AgentStep is set on "agent_step" events of agent mode.
+	AgentStep *AgentStep `json:"agent_step,omitempty"`
+	// Citation is set on "citation" events, sent after a cached answer for each grounded
+	// sentence. The citations of a generated answer are saved to its message after "done".
+	Citation *AnswerCitation `json:"citation,omitempty"`
 }
 
 type SSETokenUsage struct {
@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrTwoFactorRequired         = errors.New("two-factor authentication is required for admin users")
+	ErrInvalidTwoFactorCode      = errors.New("invalid two-factor authentication code")
+	ErrTwoFactorChallengeExpired = errors.New("two-factor authentication challenge expired, please log in again")
+)
+
+const (
+	// RecoveryCodeCount is the number of recovery codes generated at a time, each one
+	// replaces the second factor for a single login.
+	RecoveryCodeCount = 10
+	// TwoFactorMaxAttempts is the number of wrong codes accepted for one login challenge.
+	TwoFactorMaxAttempts = 5
+)
+
+type TwoFactorMethod string
+
+const (
+	TwoFactorMethodTOTP         TwoFactorMethod = "totp"
+	TwoFactorMethodWebAuthn     TwoFactorMethod = "webauthn"
+	TwoFactorMethodRecoveryCode TwoFactorMethod = "recovery_code"
+)
+
+// TwoFactorPolicy is the system setting of the second factor of password logins.
+type TwoFactorPolicy struct {
+	// RequireForAdmins makes admin users without a second factor enroll one right after
+	// their password is verified, before a token is issued to them.
+	RequireForAdmins bool `json:"require_for_admins"`
+}
+
+// UserWebAuthnCredential is a security key or passkey registered as a second factor.
+type UserWebAuthnCredential struct {
+	ID     string `json:"id" gorm:"primaryKey"`
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	// CredentialID is the base64url credential id chosen by the authenticator
+	CredentialID string `json:"-"`
+	// PublicKey is the COSE_Key of the credential
+	PublicKey []byte `json:"-"`
+	// RPID is the relying party the credential is scoped to, the host of the admin console
+	RPID       string     `json:"rp_id" gorm:"column:rp_id"`
+	SignCount  int64      `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func (UserWebAuthnCredential) TableName() string {
+	return "user_webauthn_credentials"
+}
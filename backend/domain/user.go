@@ -3,9 +3,19 @@ package domain
 import (
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/chaitin/panda-wiki/consts"
 )
 
+// DefaultAdminAccount is the account of the built-in admin created from the admin password
+// of the config.
+const DefaultAdminAccount = "admin"
+
+// JWTClaimSSO is the claim holding the IdP of the tokens issued by admin SSO, tokens
+// without it come from a local password login.
+const JWTClaimSSO = "sso"
+
 type User struct {
 	ID         string          `json:"id" gorm:"primaryKey"`
 	Account    string          `json:"account" gorm:"uniqueIndex"`
@@ -13,6 +23,15 @@ type User struct {
 	Role       consts.UserRole `json:"role" gorm:"default:'user'"`
 	CreatedAt  time.Time       `json:"created_at"`
 	LastAccess time.Time       `json:"last_access" gorm:"default:null"`
+	// SourceType and UnionID identify the IdP user of users provisioned by admin SSO,
+	// they are empty for local users.
+	SourceType consts.SourceType `json:"source_type"`
+	UnionID    string            `json:"union_id"`
+	// TOTPSecret is the base32 key of the authenticator app, used once TOTPEnabled is set.
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// RecoveryCodes are the sha256 hashes of the unused recovery codes.
+	RecoveryCodes pq.StringArray `json:"-" gorm:"type:text[];not null;default:{}"`
 }
 
 // KBUsers 知识库用户关联表（多对多关系）
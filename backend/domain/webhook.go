@@ -0,0 +1,280 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/chaitin/panda-wiki/consts"
+)
+
+type WebhookEventType string
+
+const (
+	WebhookEventNodeCreated         WebhookEventType = "node.created"
+	WebhookEventNodeUpdated         WebhookEventType = "node.updated"
+	WebhookEventNodeDeleted         WebhookEventType = "node.deleted"
+	WebhookEventReleaseCreated      WebhookEventType = "release.created"
+	WebhookEventReleaseRolledBack   WebhookEventType = "release.rolled_back"
+	WebhookEventContributeSubmitted WebhookEventType = "contribute.submitted"
+	WebhookEventContributeAudited   WebhookEventType = "contribute.audited"
+	WebhookEventCommentCreated      WebhookEventType = "comment.created"
+	WebhookEventFeedbackNegative    WebhookEventType = "feedback.negative"
+	WebhookEventHandoffRequested    WebhookEventType = "conversation.handoff"
+)
+
+var WebhookEventTypes = []WebhookEventType{
+	WebhookEventNodeCreated,
+	WebhookEventNodeUpdated,
+	WebhookEventNodeDeleted,
+	WebhookEventReleaseCreated,
+	WebhookEventReleaseRolledBack,
+	WebhookEventContributeSubmitted,
+	WebhookEventContributeAudited,
+	WebhookEventCommentCreated,
+	WebhookEventFeedbackNegative,
+	WebhookEventHandoffRequested,
+}
+
+const (
+	WebhookHeaderEvent     = "X-PandaWiki-Event"
+	WebhookHeaderDelivery  = "X-PandaWiki-Delivery"
+	WebhookHeaderTimestamp = "X-PandaWiki-Timestamp"
+	WebhookHeaderSignature = "X-PandaWiki-Signature"
+)
+
+const (
+	// WebhookTimeout bounds a single send to the webhook url.
+	WebhookTimeout = 10 * time.Second
+	// WebhookAckWait is how long the mq waits for a delivery to be acked before
+	// redelivering it, it must stay well above WebhookTimeout so a slow endpoint
+	// is not sent the same delivery twice.
+	WebhookAckWait = 6 * WebhookTimeout
+)
+
+// WebhookRetryBackoff is the wait before each redelivery of a failed webhook.
+// A delivery is attempted at most len(WebhookRetryBackoff)+1 times.
+var WebhookRetryBackoff = []time.Duration{
+	10 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+}
+
+func WebhookMaxAttempts() int {
+	return len(WebhookRetryBackoff) + 1
+}
+
+// WebhookRetryDelay returns the wait before redelivering a delivery that has
+// been attempted delivered times.
+func WebhookRetryDelay(delivered int) time.Duration {
+	return WebhookRetryBackoff[min(max(delivered, 1), len(WebhookRetryBackoff))-1]
+}
+
+type Webhook struct {
+	ID        string         `json:"id" gorm:"primaryKey"`
+	KBID      string         `json:"kb_id"`
+	Name      string         `json:"name"`
+	URL       string         `json:"url"`
+	Secret    string         `json:"-"`
+	Events    pq.StringArray `json:"events" gorm:"type:text[]"`
+	Enabled   bool           `json:"enabled"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+func (w *Webhook) Subscribes(event WebhookEventType) bool {
+	return w.Enabled && slices.Contains(w.Events, string(event))
+}
+
+// WebhookResp is a webhook as shown in the admin console. The signing secret is write-only,
+// it is masked except in the responses of the creation and the rotation of the secret.
+type WebhookResp struct {
+	*Webhook
+	Secret string `json:"secret"`
+}
+
+func NewWebhookResp(webhook *Webhook, showSecret bool) *WebhookResp {
+	if showSecret {
+		return &WebhookResp{Webhook: webhook, Secret: webhook.Secret}
+	}
+	return &WebhookResp{Webhook: webhook, Secret: MaskWebhookSecret(webhook.Secret)}
+}
+
+// MaskWebhookSecret keeps the last 4 characters of secret for admins to tell secrets apart.
+func MaskWebhookSecret(secret string) string {
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending  WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusRetrying WebhookDeliveryStatus = "retrying"
+	WebhookDeliveryStatusSuccess  WebhookDeliveryStatus = "success"
+	WebhookDeliveryStatusFailed   WebhookDeliveryStatus = "failed"
+)
+
+type WebhookDelivery struct {
+	ID           string                `json:"id" gorm:"primaryKey"`
+	WebhookID    string                `json:"webhook_id"`
+	KBID         string                `json:"kb_id"`
+	Event        WebhookEventType      `json:"event"`
+	Payload      json.RawMessage       `json:"payload" gorm:"type:jsonb"`
+	Status       WebhookDeliveryStatus `json:"status"`
+	Attempts     int                   `json:"attempts"`
+	ResponseCode int                   `json:"response_code"`
+	ResponseBody string                `json:"response_body"`
+	Error        string                `json:"error"`
+	ReplayOf     string                `json:"replay_of"`
+	NextRetryAt  *time.Time            `json:"next_retry_at"`
+	CreatedAt    time.Time             `json:"created_at"`
+	UpdatedAt    time.Time             `json:"updated_at"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// WebhookPayload is the JSON body posted to a webhook endpoint.
+type WebhookPayload struct {
+	ID        string           `json:"id"`
+	Event     WebhookEventType `json:"event"`
+	KBID      string           `json:"kb_id"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      any              `json:"data"`
+}
+
+// WebhookDeliveryTask is the mq message that asks the consumer to send one delivery.
+type WebhookDeliveryTask struct {
+	DeliveryID string `json:"delivery_id"`
+}
+
+type WebhookNodeData struct {
+	NodeID string   `json:"node_id"`
+	Name   string   `json:"name,omitempty"`
+	Type   NodeType `json:"type,omitempty"`
+	UserID string   `json:"user_id,omitempty"`
+}
+
+type WebhookReleaseData struct {
+	ReleaseID      string   `json:"release_id"`
+	Tag            string   `json:"tag,omitempty"`
+	Message        string   `json:"message,omitempty"`
+	UserID         string   `json:"user_id,omitempty"`
+	RollbackNodeID []string `json:"rollback_node_ids,omitempty"`
+}
+
+type WebhookContributeData struct {
+	ContributeID string                  `json:"contribute_id"`
+	Type         consts.ContributeType   `json:"type,omitempty"`
+	Status       consts.ContributeStatus `json:"status"`
+	NodeID       string                  `json:"node_id,omitempty"`
+	Name         string                  `json:"name,omitempty"`
+	Reason       string                  `json:"reason,omitempty"`
+	AuditUserID  string                  `json:"audit_user_id,omitempty"`
+}
+
+type WebhookCommentData struct {
+	CommentID string        `json:"comment_id"`
+	NodeID    string        `json:"node_id"`
+	ParentID  string        `json:"parent_id,omitempty"`
+	UserName  string        `json:"user_name,omitempty"`
+	Content   string        `json:"content"`
+	Status    CommentStatus `json:"status"`
+}
+
+type WebhookFeedbackData struct {
+	ConversationID  string       `json:"conversation_id"`
+	MessageID       string       `json:"message_id"`
+	Type            FeedbackType `json:"type,omitempty"`
+	FeedbackContent string       `json:"feedback_content,omitempty"`
+}
+
+// SignWebhookPayload returns the signature header value for body:
+// "sha256=" + hex(HMAC-SHA256(secret, "<timestamp>.<body>")).
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func GenerateWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+type WebhookListReq struct {
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+}
+
+type CreateWebhookReq struct {
+	KBID    string   `json:"kb_id" validate:"required"`
+	Name    string   `json:"name" validate:"required,max=100"`
+	URL     string   `json:"url" validate:"required,url,max=2048"`
+	Secret  string   `json:"secret" validate:"omitempty,min=16,max=128"`
+	Events  []string `json:"events" validate:"required,min=1,dive,required"`
+	Enabled bool     `json:"enabled"`
+}
+
+type UpdateWebhookReq struct {
+	ID      string   `json:"id" validate:"required"`
+	KBID    string   `json:"kb_id" validate:"required"`
+	Name    *string  `json:"name,omitempty" validate:"omitempty,max=100"`
+	URL     *string  `json:"url,omitempty" validate:"omitempty,url,max=2048"`
+	Events  []string `json:"events,omitempty" validate:"omitempty,dive,required"`
+	Enabled *bool    `json:"enabled,omitempty"`
+}
+
+// RotateWebhookSecretReq replaces the signing secret, a secret is generated when none is given.
+type RotateWebhookSecretReq struct {
+	ID     string `json:"id" validate:"required"`
+	KBID   string `json:"kb_id" validate:"required"`
+	Secret string `json:"secret" validate:"omitempty,min=16,max=128"`
+}
+
+type DeleteWebhookReq struct {
+	ID   string `json:"id" query:"id" validate:"required"`
+	KBID string `json:"kb_id" query:"kb_id" validate:"required"`
+}
+
+type WebhookDeliveryListReq struct {
+	KBID      string `json:"kb_id" query:"kb_id" validate:"required"`
+	WebhookID string `json:"webhook_id" query:"webhook_id"`
+	Status    string `json:"status" query:"status" validate:"omitempty,oneof=pending retrying success failed"`
+	Pager
+}
+
+type ReplayWebhookDeliveryReq struct {
+	ID   string `json:"id" validate:"required"`
+	KBID string `json:"kb_id" validate:"required"`
+}
+
+// ValidateWebhookEvents reports the first unknown event name.
+func ValidateWebhookEvents(events []string) error {
+	for _, event := range events {
+		if !slices.Contains(WebhookEventTypes, WebhookEventType(event)) {
+			return fmt.Errorf("unknown webhook event: %s", event)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	body := []byte(`{"event":"node.created"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000."))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	assert.Equal(t, expected, SignWebhookPayload("secret", 1700000000, body))
+	assert.NotEqual(t, expected, SignWebhookPayload("secret", 1700000001, body))
+	assert.NotEqual(t, expected, SignWebhookPayload("other", 1700000000, body))
+}
+
+func TestWebhookSubscribes(t *testing.T) {
+	webhook := &Webhook{Enabled: true, Events: []string{string(WebhookEventNodeCreated)}}
+	assert.True(t, webhook.Subscribes(WebhookEventNodeCreated))
+	assert.False(t, webhook.Subscribes(WebhookEventNodeDeleted))
+
+	webhook.Enabled = false
+	assert.False(t, webhook.Subscribes(WebhookEventNodeCreated))
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	assert.Equal(t, WebhookRetryBackoff[0], WebhookRetryDelay(1))
+	assert.Equal(t, WebhookRetryBackoff[1], WebhookRetryDelay(2))
+	assert.Equal(t, WebhookRetryBackoff[len(WebhookRetryBackoff)-1], WebhookRetryDelay(WebhookMaxAttempts()))
+	assert.Equal(t, WebhookRetryBackoff[0], WebhookRetryDelay(0))
+	assert.Greater(t, WebhookAckWait, WebhookTimeout)
+}
+
+func TestValidateWebhookEvents(t *testing.T) {
+	assert.NoError(t, ValidateWebhookEvents([]string{"node.created", "feedback.negative"}))
+	assert.Error(t, ValidateWebhookEvents([]string{"node.created", "node.moved"}))
+}
+
+func TestWebhookRespMasksSecret(t *testing.T) {
+	webhook := &Webhook{ID: "1", Secret: "whsec_0123456789abcdef"}
+
+	raw, err := json.Marshal(webhook)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), webhook.Secret)
+
+	raw, err = json.Marshal(NewWebhookResp(webhook, false))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), webhook.Secret)
+	assert.Contains(t, string(raw), `"secret":"****cdef"`)
+
+	raw, err = json.Marshal(NewWebhookResp(webhook, true))
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), `"secret":"whsec_0123456789abcdef"`)
+
+	assert.Equal(t, "****", MaskWebhookSecret("short"))
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/robfig/cron/v3"
 
+	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/log"
 	"github.com/chaitin/panda-wiki/repo/pg"
 	"github.com/chaitin/panda-wiki/usecase"
@@ -17,14 +18,28 @@ type CronHandler struct {
 	nodeRepo    *pg.NodeRepository
 	statUseCase *usecase.StatUseCase
 	nodeUseCase *usecase.NodeUsecase
+	webhookRepo *pg.WebhookRepository
+	gitSync     *usecase.GitSyncUsecase
+	schedule    *usecase.ReleaseScheduleUsecase
+	convRepo    *pg.ConversationRepository
+	gapUsecase  *usecase.KnowledgeGapUsecase
+	ldapSync    *usecase.LDAPSyncUsecase
+	kbArchive   *usecase.KBArchiveUsecase
 }
 
-func NewCronHandler(logger *log.Logger, statRepo *pg.StatRepository, nodeRepo *pg.NodeRepository, statUseCase *usecase.StatUseCase, nodeUseCase *usecase.NodeUsecase) (*CronHandler, error) {
+func NewCronHandler(logger *log.Logger, statRepo *pg.StatRepository, nodeRepo *pg.NodeRepository, statUseCase *usecase.StatUseCase, nodeUseCase *usecase.NodeUsecase, webhookRepo *pg.WebhookRepository, gitSync *usecase.GitSyncUsecase, schedule *usecase.ReleaseScheduleUsecase, convRepo *pg.ConversationRepository, gapUsecase *usecase.KnowledgeGapUsecase, ldapSync *usecase.LDAPSyncUsecase, kbArchive *usecase.KBArchiveUsecase) (*CronHandler, error) {
 	h := &CronHandler{
 		statRepo:    statRepo,
 		nodeRepo:    nodeRepo,
 		statUseCase: statUseCase,
 		nodeUseCase: nodeUseCase,
+		webhookRepo: webhookRepo,
+		gitSync:     gitSync,
+		schedule:    schedule,
+		convRepo:    convRepo,
+		gapUsecase:  gapUsecase,
+		ldapSync:    ldapSync,
+		kbArchive:   kbArchive,
 		logger:      logger.WithModule("handler.mq.cron"),
 	}
 	cron := cron.New()
@@ -69,6 +84,62 @@ func NewCronHandler(logger *log.Logger, statRepo *pg.StatRepository, nodeRepo *p
 	}
 	h.logger.Info("add cron job", log.String("cron_id", "cleanup_old_node_release_backups"))
 
+	// 每天2点半执行清理30天前的节点修订记录
+	if _, err := cron.AddFunc("30 2 * * *", h.CleanupOldNodeRevisions); err != nil {
+		h.logger.Error("failed to add cron job for cleaning up old node revisions", log.Error(err))
+		return nil, err
+	}
+	h.logger.Info("add cron job", log.String("cron_id", "cleanup_old_node_revisions"))
+
+	// 每天3点执行清理30天前的webhook投递日志
+	if _, err := cron.AddFunc("0 3 * * *", h.CleanupOldWebhookDeliveries); err != nil {
+		h.logger.Error("failed to add cron job for cleaning up old webhook deliveries", log.Error(err))
+		return nil, err
+	}
+	h.logger.Info("add cron job", log.String("cron_id", "cleanup_old_webhook_deliveries"))
+
+	// 每5分钟检查并执行到期的git仓库同步
+	if _, err := cron.AddFunc("*/5 * * * *", h.SyncGitRepositories); err != nil {
+		h.logger.Error("failed to add cron job for syncing git repositories", log.Error(err))
+		return nil, err
+	}
+	h.logger.Info("add cron job", log.String("cron_id", "sync_git_repositories"))
+
+	// 每分钟执行到期的定时发布和下线
+	if _, err := cron.AddFunc("* * * * *", h.ExecuteReleaseSchedules); err != nil {
+		h.logger.Error("failed to add cron job for executing release schedules", log.Error(err))
+		return nil, err
+	}
+	h.logger.Info("add cron job", log.String("cron_id", "execute_release_schedules"))
+
+	// 每天4点按知识库的保留策略删除或匿名化过期对话
+	if _, err := cron.AddFunc("0 4 * * *", h.ApplyConversationRetention); err != nil {
+		h.logger.Error("failed to add cron job for applying conversation retention", log.Error(err))
+		return nil, err
+	}
+	h.logger.Info("add cron job", log.String("cron_id", "apply_conversation_retention"))
+
+	// 每5分钟执行待生成的知识缺口报告
+	if _, err := cron.AddFunc("*/5 * * * *", h.ExecuteKnowledgeGapReports); err != nil {
+		h.logger.Error("failed to add cron job for executing knowledge gap reports", log.Error(err))
+		return nil, err
+	}
+	h.logger.Info("add cron job", log.String("cron_id", "execute_knowledge_gap_reports"))
+
+	// 每5分钟检查并执行到期的LDAP目录同步
+	if _, err := cron.AddFunc("*/5 * * * *", h.SyncLDAPDirectories); err != nil {
+		h.logger.Error("failed to add cron job for syncing LDAP directories", log.Error(err))
+		return nil, err
+	}
+	h.logger.Info("add cron job", log.String("cron_id", "sync_ldap_directories"))
+
+	// 每10分钟将中断的知识库导入任务标记为失败
+	if _, err := cron.AddFunc("*/10 * * * *", h.FailStaleImportJobs); err != nil {
+		h.logger.Error("failed to add cron job for failing stale import jobs", log.Error(err))
+		return nil, err
+	}
+	h.logger.Info("add cron job", log.String("cron_id", "fail_stale_import_jobs"))
+
 	cron.Start()
 	h.logger.Info("start cron jobs")
 	return h, nil
@@ -132,3 +203,85 @@ func (h *CronHandler) CleanupOldNodeReleaseBackups() {
 	}
 	h.logger.Info("cleanup old node release backups successful")
 }
+
+func (h *CronHandler) CleanupOldNodeRevisions() {
+	h.logger.Info("cleanup old node revisions start")
+	before := time.Now().Add(-domain.NodeRevisionRetention)
+	if err := h.nodeRepo.DeleteOldNodeRevisions(context.Background(), before); err != nil {
+		h.logger.Error("cleanup old node revisions failed", log.Error(err))
+		return
+	}
+	h.logger.Info("cleanup old node revisions successful")
+}
+
+func (h *CronHandler) CleanupOldWebhookDeliveries() {
+	h.logger.Info("cleanup old webhook deliveries start")
+	before := time.Now().AddDate(0, 0, -30)
+	count, err := h.webhookRepo.DeleteDeliveriesBefore(context.Background(), before)
+	if err != nil {
+		h.logger.Error("cleanup old webhook deliveries failed", log.Error(err))
+		return
+	}
+	h.logger.Info("cleanup old webhook deliveries successful", log.Int64("count", count))
+}
+
+func (h *CronHandler) SyncGitRepositories() {
+	h.logger.Info("sync git repositories start")
+	if err := h.gitSync.SyncDue(context.Background()); err != nil {
+		h.logger.Error("sync git repositories failed", log.Error(err))
+		return
+	}
+	h.logger.Info("sync git repositories successful")
+}
+
+func (h *CronHandler) ExecuteReleaseSchedules() {
+	if err := h.schedule.ExecuteDue(context.Background()); err != nil {
+		h.logger.Error("execute release schedules failed", log.Error(err))
+	}
+}
+
+func (h *CronHandler) ApplyConversationRetention() {
+	h.logger.Info("apply conversation retention start")
+	ctx := context.Background()
+	settings, err := h.convRepo.ListRetentionSettings(ctx)
+	if err != nil {
+		h.logger.Error("list conversation retention settings failed", log.Error(err))
+		return
+	}
+	now := time.Now()
+	for kbID, retention := range settings {
+		var count int64
+		switch retention.Action {
+		case domain.ConversationRetentionActionDelete:
+			count, err = h.convRepo.DeleteConversationsBefore(ctx, kbID, retention.Before(now))
+		case domain.ConversationRetentionActionAnonymize:
+			count, err = h.convRepo.AnonymizeConversationsBefore(ctx, kbID, retention.Before(now))
+		}
+		if err != nil {
+			h.logger.Error("apply conversation retention failed", log.String("kb_id", kbID), log.Error(err))
+			continue
+		}
+		h.logger.Info("apply conversation retention successful", log.String("kb_id", kbID), log.String("action", string(retention.Action)), log.Int64("count", count))
+	}
+}
+
+func (h *CronHandler) ExecuteKnowledgeGapReports() {
+	if err := h.gapUsecase.ExecutePendingReports(context.Background()); err != nil {
+		h.logger.Error("execute knowledge gap reports failed", log.Error(err))
+	}
+}
+
+func (h *CronHandler) SyncLDAPDirectories() {
+	h.logger.Info("sync LDAP directories start")
+	if err := h.ldapSync.SyncDue(context.Background()); err != nil {
+		h.logger.Error("sync LDAP directories failed", log.Error(err))
+		return
+	}
+	h.logger.Info("sync LDAP directories successful")
+}
+
+func (h *CronHandler) FailStaleImportJobs() {
+	if err := h.kbArchive.FailStaleImportJobs(context.Background()); err != nil {
+		h.logger.Error("fail stale import jobs failed", log.Error(err))
+	}
+}
@@ -0,0 +1,42 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/mq"
+	"github.com/chaitin/panda-wiki/mq/types"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+type KBArchiveMQHandler struct {
+	consumer         mq.MQConsumer
+	logger           *log.Logger
+	kbArchiveUsecase *usecase.KBArchiveUsecase
+}
+
+func NewKBArchiveMQHandler(consumer mq.MQConsumer, logger *log.Logger, kbArchiveUsecase *usecase.KBArchiveUsecase) (*KBArchiveMQHandler, error) {
+	h := &KBArchiveMQHandler{
+		consumer:         consumer,
+		logger:           logger.WithModule("mq.kb_archive"),
+		kbArchiveUsecase: kbArchiveUsecase,
+	}
+	if err := consumer.RegisterHandler(domain.KBImportTopic, h.HandleKBImport); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *KBArchiveMQHandler) HandleKBImport(ctx context.Context, msg types.Message) error {
+	var task domain.KBImportTask
+	if err := json.Unmarshal(msg.GetData(), &task); err != nil {
+		h.logger.Error("unmarshal kb import task failed", log.Error(err))
+		return nil
+	}
+	if err := h.kbArchiveUsecase.RunImportJob(ctx, task.JobID); err != nil {
+		h.logger.Error("run kb import job failed", log.String("job_id", task.JobID), log.Error(err))
+	}
+	return nil
+}
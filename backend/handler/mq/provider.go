@@ -15,6 +15,9 @@ type MQHandlers struct {
 	RAGMQHandler        *RAGMQHandler
 	RagDocUpdateHandler *RagDocUpdateHandler
 	StatCronHandler     *CronHandler
+	WebhookMQHandler    *WebhookMQHandler
+	KBArchiveMQHandler  *KBArchiveMQHandler
+	RAGEvalMQHandler    *RAGEvalMQHandler
 }
 
 var ProviderSet = wire.NewSet(
@@ -28,10 +31,22 @@ var ProviderSet = wire.NewSet(
 	usecase.NewStatUseCase,
 	usecase.NewNodeUsecase,
 	usecase.NewModelUsecase,
+	usecase.NewWebhookUsecase,
+	usecase.NewGitSyncUsecase,
+	usecase.NewKBArchiveUsecase,
+	usecase.NewPushUsecase,
+	usecase.NewKnowledgeBaseUsecase,
+	usecase.NewReleaseScheduleUsecase,
+	usecase.NewNodeReviewUsecase,
+	usecase.NewRAGEvalUsecase,
+	usecase.NewLDAPSyncUsecase,
 
 	NewRAGMQHandler,
 	NewRagDocUpdateHandler,
 	NewCronHandler,
+	NewWebhookMQHandler,
+	NewKBArchiveMQHandler,
+	NewRAGEvalMQHandler,
 
 	wire.Struct(new(MQHandlers), "*"),
 )
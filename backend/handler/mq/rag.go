@@ -95,6 +95,12 @@ func (h *RAGMQHandler) HandleNodeContentVectorRequest(ctx context.Context, msg t
 		})
 		if err != nil {
 			h.logger.Error("upsert node content vector failed", log.Error(err))
+			// keep the failed document, the node rag status is synced from it
+			if docID != "" {
+				if err := h.nodeRepo.UpdateNodeReleaseDocID(ctx, request.NodeReleaseID, docID); err != nil {
+					h.logger.Error("update node doc_id failed", log.String("node_id", request.NodeReleaseID), log.Error(err))
+				}
+			}
 			return nil
 		}
 		// update node doc_id
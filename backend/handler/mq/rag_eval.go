@@ -0,0 +1,42 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/mq"
+	"github.com/chaitin/panda-wiki/mq/types"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+type RAGEvalMQHandler struct {
+	consumer       mq.MQConsumer
+	logger         *log.Logger
+	ragEvalUsecase *usecase.RAGEvalUsecase
+}
+
+func NewRAGEvalMQHandler(consumer mq.MQConsumer, logger *log.Logger, ragEvalUsecase *usecase.RAGEvalUsecase) (*RAGEvalMQHandler, error) {
+	h := &RAGEvalMQHandler{
+		consumer:       consumer,
+		logger:         logger.WithModule("mq.rag_eval"),
+		ragEvalUsecase: ragEvalUsecase,
+	}
+	if err := consumer.RegisterHandler(domain.RAGEvalTopic, h.HandleRAGEval); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *RAGEvalMQHandler) HandleRAGEval(ctx context.Context, msg types.Message) error {
+	var task domain.RAGEvalTask
+	if err := json.Unmarshal(msg.GetData(), &task); err != nil {
+		h.logger.Error("unmarshal rag eval task failed", log.Error(err))
+		return nil
+	}
+	if err := h.ragEvalUsecase.ExecuteRun(ctx, task.RunID); err != nil {
+		h.logger.Error("run rag eval failed", log.String("run_id", task.RunID), log.Error(err))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/mq"
+	"github.com/chaitin/panda-wiki/mq/types"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+type WebhookMQHandler struct {
+	consumer       mq.MQConsumer
+	logger         *log.Logger
+	webhookUsecase *usecase.WebhookUsecase
+}
+
+func NewWebhookMQHandler(consumer mq.MQConsumer, logger *log.Logger, webhookUsecase *usecase.WebhookUsecase) (*WebhookMQHandler, error) {
+	h := &WebhookMQHandler{
+		consumer:       consumer,
+		logger:         logger.WithModule("mq.webhook"),
+		webhookUsecase: webhookUsecase,
+	}
+	if err := consumer.RegisterHandler(domain.WebhookDeliveryTopic, h.HandleWebhookDelivery); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// HandleWebhookDelivery returns an error to have the message naked,
+// so JetStream redelivers it on the webhook backoff schedule.
+func (h *WebhookMQHandler) HandleWebhookDelivery(ctx context.Context, msg types.Message) error {
+	var task domain.WebhookDeliveryTask
+	if err := json.Unmarshal(msg.GetData(), &task); err != nil {
+		h.logger.Error("unmarshal webhook delivery task failed", log.Error(err))
+		return nil
+	}
+	if err := h.webhookUsecase.Deliver(ctx, task.DeliveryID); err != nil {
+		h.logger.Warn("webhook delivery failed, will retry", log.String("delivery_id", task.DeliveryID), log.Error(err))
+		return err
+	}
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 
+	"github.com/chaitin/panda-wiki/consts"
 	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/handler"
 	"github.com/chaitin/panda-wiki/log"
@@ -56,27 +57,32 @@ func NewShareChatHandler(
 		apiCallAuditRepo:    apiCallAuditRepo,
 	}
 
-	share := e.Group("share/v1/chat",
-		func(next echo.HandlerFunc) echo.HandlerFunc {
-			return func(c echo.Context) error {
-				c.Response().Header().Set("Access-Control-Allow-Origin", "*")
-				c.Response().Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-				c.Response().Header().Set("Access-Control-Allow-Headers", "Content-Type, Origin, Accept")
-				if c.Request().Method == "OPTIONS" {
-					return c.NoContent(http.StatusOK)
-				}
-				return next(c)
-			}
-		})
+	share := e.Group("share/v1/chat", allowCrossOrigin)
 	share.POST("/message", h.ChatMessage, h.ShareAuthMiddleware.Authorize)
 	share.POST("/search", h.ChatSearch, h.ShareAuthMiddleware.Authorize)
 	share.POST("/completions", h.ChatCompletions)
 	share.POST("/widget", h.ChatWidget)
 	share.POST("/widget/search", h.WidgetSearch)
 	share.POST("/feedback", h.FeedBack)
+
+	// the rest of the OpenAI-compatible api, under the same base url as /chat/completions
+	e.Match([]string{http.MethodGet, http.MethodOptions}, "share/v1/models", h.OpenAIModels, allowCrossOrigin)
+	e.Match([]string{http.MethodPost, http.MethodOptions}, "share/v1/embeddings", h.OpenAIEmbeddings, allowCrossOrigin)
 	return h
 }
 
+func allowCrossOrigin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set("Access-Control-Allow-Origin", "*")
+		c.Response().Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		c.Response().Header().Set("Access-Control-Allow-Headers", "Content-Type, Origin, Accept")
+		if c.Request().Method == "OPTIONS" {
+			return c.NoContent(http.StatusOK)
+		}
+		return next(c)
+	}
+}
+
 // ChatMessage chat message
 //
 //	@Summary		ChatMessage
@@ -353,58 +359,21 @@ func (h *ShareChatHandler) ChatCompletions(c echo.Context) error {
 		return h.sendOpenAIErrorWithAudit(c, auditMeta, "messages cannot be empty", "invalid_request_error", startedAt)
 	}
 
-	promptMessage, err := buildOpenAIChatMessage(req.Messages)
+	openAIOptions, question, err := req.ChatOptions()
 	if err != nil {
-		return h.sendOpenAIErrorWithAudit(c, auditMeta, "no user message found", "invalid_request_error", startedAt)
+		return h.sendOpenAIErrorWithAudit(c, auditMeta, err.Error(), "invalid_request_error", startedAt)
 	}
 
-	// validate api bot settings
-	appBot, err := h.appUsecase.GetOpenAIAPIAppInfo(c.Request().Context(), kbID)
-	if err != nil {
-		return h.sendOpenAIErrorWithAudit(c, auditMeta, err.Error(), "internal_error", startedAt)
-	}
-	if !appBot.Settings.OpenAIAPIBotSettings.IsEnabled {
-		return h.sendOpenAIErrorWithAudit(c, auditMeta, "API Bot is not enabled", "forbidden", startedAt)
-	}
-
-	secretKeyHeader := c.Request().Header.Get("Authorization")
-	if secretKeyHeader == "" {
-		return h.sendOpenAIErrorWithAudit(c, auditMeta, "Authorization header is required", "invalid_request_error", startedAt)
-	}
-	secretKey, found := strings.CutPrefix(secretKeyHeader, "Bearer ")
-	if !found {
-		return h.sendOpenAIErrorWithAudit(c, auditMeta, "Invalid Authorization key format", "invalid_request_error", startedAt)
-	}
-	secretKey = strings.TrimSpace(secretKey)
-	if secretKey == "" {
-		return h.sendOpenAIErrorWithAudit(c, auditMeta, "Invalid Authorization key format", "invalid_request_error", startedAt)
-	}
-
-	apiToken := h.resolveAPIToken(c.Request().Context(), secretKey, kbID)
-	if apiToken != nil {
-		tokenID := apiToken.ID
-		auditMeta.APITokenID = &tokenID
-	}
-
-	authorizedByAppSecret := appBot.Settings.OpenAIAPIBotSettings.SecretKey == secretKey
-	authorizedByAPIToken := apiToken != nil
-	if !authorizedByAppSecret && !authorizedByAPIToken {
-		return h.sendOpenAIErrorWithAudit(c, auditMeta, "Invalid Authorization key", "unauthorized", startedAt)
-	}
-
-	if authorizedByAPIToken {
-		if errorType, err := h.checkAPITokenGovernance(c.Request().Context(), apiToken, startedAt); err != nil {
-			h.logger.Warn("check api token governance failed", log.Error(err))
-		} else if errorType != "" {
-			return h.sendOpenAIErrorWithAudit(c, auditMeta, openAIGovernanceErrorMessage(errorType), errorType, startedAt)
-		}
+	if errorType, message := h.authorizeOpenAIRequest(c, &auditMeta, startedAt); errorType != "" {
+		return h.sendOpenAIErrorWithAudit(c, auditMeta, message, errorType, startedAt)
 	}
 
 	chatReq := &domain.ChatRequest{
-		Message:  promptMessage,
+		Message:  question,
 		KBID:     kbID,
 		AppType:  domain.AppTypeOpenAIAPI,
 		RemoteIP: c.RealIP(),
+		OpenAI:   openAIOptions,
 	}
 
 	// set stream response header
@@ -428,57 +397,6 @@ func (h *ShareChatHandler) ChatCompletions(c echo.Context) error {
 	}
 }
 
-func buildOpenAIChatMessage(messages []domain.OpenAIMessage) (string, error) {
-	systemMessages := make([]string, 0)
-	historyMessages := make([]string, 0)
-	lastUserMessage := ""
-
-	for idx, message := range messages {
-		content := ""
-		if message.Content != nil {
-			content = strings.TrimSpace(message.Content.StringWithImages())
-		}
-		if content == "" {
-			continue
-		}
-
-		switch strings.ToLower(strings.TrimSpace(message.Role)) {
-		case "system":
-			systemMessages = append(systemMessages, content)
-		case "user":
-			lastUserMessage = content
-			if idx != len(messages)-1 {
-				historyMessages = append(historyMessages, "user: "+content)
-			}
-		case "assistant", "tool":
-			historyMessages = append(historyMessages, message.Role+": "+content)
-		default:
-			historyMessages = append(historyMessages, message.Role+": "+content)
-		}
-	}
-
-	if lastUserMessage == "" {
-		return "", fmt.Errorf("no user message")
-	}
-
-	var builder strings.Builder
-	if len(systemMessages) > 0 {
-		builder.WriteString("System Instructions:\n")
-		builder.WriteString(strings.Join(systemMessages, "\n"))
-		builder.WriteString("\n\n")
-	}
-
-	if len(historyMessages) > 0 {
-		builder.WriteString("Conversation History:\n")
-		builder.WriteString(strings.Join(historyMessages, "\n"))
-		builder.WriteString("\n\n")
-	}
-
-	builder.WriteString("Current User Question:\n")
-	builder.WriteString(lastUserMessage)
-	return builder.String(), nil
-}
-
 func (h *ShareChatHandler) handleOpenAIStreamResponse(
 	c echo.Context,
 	eventCh <-chan domain.SSEEvent,
@@ -512,6 +430,31 @@ func (h *ShareChatHandler) handleOpenAIStreamResponse(
 				},
 			}
 
+			if err := h.writeOpenAIStreamEvent(c, streamResp); err != nil {
+				h.recordOpenAIAudit(c.Request().Context(), auditMeta, http.StatusInternalServerError, usage, "internal_error", err.Error(), startedAt)
+				return err
+			}
+		case "tool_call":
+			toolCalls := make([]domain.OpenAIToolCall, 0, len(event.ToolCalls))
+			for i, call := range event.ToolCalls {
+				index := i
+				toolCalls = append(toolCalls, domain.NewOpenAIToolCall(call, &index))
+			}
+			streamResp := domain.OpenAIStreamResponse{
+				ID:      responseID,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   auditMeta.Model,
+				Choices: []domain.OpenAIStreamChoice{
+					{
+						Index: 0,
+						Delta: domain.OpenAIMessage{
+							Role:      "assistant",
+							ToolCalls: toolCalls,
+						},
+					},
+				},
+			}
 			if err := h.writeOpenAIStreamEvent(c, streamResp); err != nil {
 				h.recordOpenAIAudit(c.Request().Context(), auditMeta, http.StatusInternalServerError, usage, "internal_error", err.Error(), startedAt)
 				return err
@@ -535,7 +478,7 @@ func (h *ShareChatHandler) handleOpenAIStreamResponse(
 					{
 						Index:        0,
 						Delta:        domain.OpenAIMessage{},
-						FinishReason: stringPtr("stop"),
+						FinishReason: stringPtr(openAIFinishReason(event)),
 					},
 				},
 			}
@@ -579,6 +522,7 @@ func (h *ShareChatHandler) handleOpenAINonStreamResponse(
 	created := time.Now().Unix()
 
 	var content string
+	var toolCalls []domain.OpenAIToolCall
 	var usage *domain.OpenAIUsage
 	for event := range eventCh {
 		switch event.Type {
@@ -586,6 +530,10 @@ func (h *ShareChatHandler) handleOpenAINonStreamResponse(
 			return h.sendOpenAIErrorWithAudit(c, auditMeta, event.Content, "internal_error", startedAt)
 		case "data":
 			content += event.Content
+		case "tool_call":
+			for _, call := range event.ToolCalls {
+				toolCalls = append(toolCalls, domain.NewOpenAIToolCall(call, nil))
+			}
 		case "usage":
 			if event.Usage != nil {
 				usage = &domain.OpenAIUsage{
@@ -605,10 +553,11 @@ func (h *ShareChatHandler) handleOpenAINonStreamResponse(
 					{
 						Index: 0,
 						Message: domain.OpenAIMessage{
-							Role:    "assistant",
-							Content: domain.NewStringContent(content),
+							Role:      "assistant",
+							Content:   domain.NewStringContent(content),
+							ToolCalls: toolCalls,
 						},
-						FinishReason: "stop",
+						FinishReason: openAIFinishReason(event),
 					},
 				},
 				Usage: usage,
@@ -665,6 +614,14 @@ func stringPtr(s string) *string {
 	return &s
 }
 
+// openAIFinishReason reads the finish reason of a "done" event.
+func openAIFinishReason(event domain.SSEEvent) string {
+	if event.Content == "" {
+		return domain.OpenAIFinishReasonStop
+	}
+	return event.Content
+}
+
 type openAIAuditMeta struct {
 	KBID       string
 	APITokenID *string
@@ -692,58 +649,119 @@ func (h *ShareChatHandler) sendOpenAIErrorWithAudit(
 	return h.sendOpenAIError(c, message, errorType)
 }
 
-func (h *ShareChatHandler) checkAPITokenGovernance(ctx context.Context, apiToken *domain.APIToken, now time.Time) (string, error) {
+// authorizeOpenAIRequest checks the bearer key of an OpenAI-compatible request, which is the
+// secret of the API bot app or an API token of the kb. It returns the error type and message
+// to answer with when the request is refused.
+func (h *ShareChatHandler) authorizeOpenAIRequest(c echo.Context, auditMeta *openAIAuditMeta, now time.Time) (string, string) {
+	ctx := c.Request().Context()
+	// validate api bot settings
+	appBot, err := h.appUsecase.GetOpenAIAPIAppInfo(ctx, auditMeta.KBID)
+	if err != nil {
+		return "internal_error", err.Error()
+	}
+	if !appBot.Settings.OpenAIAPIBotSettings.IsEnabled {
+		return "forbidden", "API Bot is not enabled"
+	}
+
+	secretKeyHeader := c.Request().Header.Get("Authorization")
+	if secretKeyHeader == "" {
+		return "invalid_request_error", "Authorization header is required"
+	}
+	secretKey, found := strings.CutPrefix(secretKeyHeader, "Bearer ")
+	if !found {
+		return "invalid_request_error", "Invalid Authorization key format"
+	}
+	secretKey = strings.TrimSpace(secretKey)
+	if secretKey == "" {
+		return "invalid_request_error", "Invalid Authorization key format"
+	}
+
+	apiToken := h.resolveAPIToken(ctx, secretKey, auditMeta.KBID)
+	if apiToken != nil {
+		tokenID := apiToken.ID
+		auditMeta.APITokenID = &tokenID
+	}
+
+	authorizedByAppSecret := appBot.Settings.OpenAIAPIBotSettings.SecretKey == secretKey
+	authorizedByAPIToken := apiToken != nil
+	if !authorizedByAppSecret && !authorizedByAPIToken {
+		return "unauthorized", "Invalid Authorization key"
+	}
+
+	// the app secret works for all endpoints, api tokens need the chat scope
+	if authorizedByAPIToken && !authorizedByAppSecret && !apiToken.HasScope(consts.APITokenScopeChat) {
+		return "forbidden", "API token does not have the chat scope"
+	}
+
+	if authorizedByAPIToken {
+		if errorType, message, err := h.checkAPITokenGovernance(ctx, apiToken, now); err != nil {
+			h.logger.Warn("check api token governance failed", log.Error(err))
+		} else if errorType != "" {
+			return errorType, message
+		}
+	}
+	return "", ""
+}
+
+// checkAPITokenGovernance counts the calls of the token to all OpenAI-compatible endpoints and
+// the llm tokens they used this month.
+func (h *ShareChatHandler) checkAPITokenGovernance(ctx context.Context, apiToken *domain.APIToken, now time.Time) (string, string, error) {
 	if apiToken == nil || h.apiCallAuditRepo == nil {
-		return "", nil
+		return "", "", nil
 	}
 
 	var (
-		minuteCount int64
-		dailyCount  int64
+		minuteCount   int64
+		dailyCount    int64
+		monthlyTokens int64
 	)
 
 	if apiToken.RateLimitPerMinute > 0 {
-		count, err := h.apiCallAuditRepo.CountByTokenSince(ctx, apiToken.ID, openAICompletionsEndpoint, now.Add(-time.Minute))
+		count, err := h.apiCallAuditRepo.CountByTokenSince(ctx, apiToken.ID, "", now.Add(-time.Minute))
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 		minuteCount = count
 	}
 
 	if apiToken.DailyQuota > 0 {
 		dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-		count, err := h.apiCallAuditRepo.CountByTokenSince(ctx, apiToken.ID, openAICompletionsEndpoint, dayStart)
+		count, err := h.apiCallAuditRepo.CountByTokenSince(ctx, apiToken.ID, "", dayStart)
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 		dailyCount = count
 	}
 
-	return evaluateAPITokenGovernanceViolation(apiToken, minuteCount, dailyCount), nil
+	if apiToken.MonthlyTokenQuota > 0 {
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		total, err := h.apiCallAuditRepo.SumTokensByTokenSince(ctx, apiToken.ID, monthStart)
+		if err != nil {
+			return "", "", err
+		}
+		monthlyTokens = total
+	}
+
+	errorType, message := evaluateAPITokenGovernanceViolation(apiToken, minuteCount, dailyCount, monthlyTokens)
+	return errorType, message, nil
 }
 
-func evaluateAPITokenGovernanceViolation(apiToken *domain.APIToken, minuteCount, dailyCount int64) string {
+// evaluateAPITokenGovernanceViolation returns the error type and message of the first limit
+// the token has reached.
+func evaluateAPITokenGovernanceViolation(apiToken *domain.APIToken, minuteCount, dailyCount, monthlyTokens int64) (string, string) {
 	if apiToken == nil {
-		return ""
+		return "", ""
 	}
 	if apiToken.RateLimitPerMinute > 0 && minuteCount >= int64(apiToken.RateLimitPerMinute) {
-		return "rate_limit_error"
+		return "rate_limit_error", "Rate limit exceeded for this API token"
 	}
 	if apiToken.DailyQuota > 0 && dailyCount >= int64(apiToken.DailyQuota) {
-		return "insufficient_quota"
+		return "insufficient_quota", "Daily quota exceeded for this API token"
 	}
-	return ""
-}
-
-func openAIGovernanceErrorMessage(errorType string) string {
-	switch errorType {
-	case "rate_limit_error":
-		return "Rate limit exceeded for this API token"
-	case "insufficient_quota":
-		return "Daily quota exceeded for this API token"
-	default:
-		return "API token governance check failed"
+	if apiToken.MonthlyTokenQuota > 0 && monthlyTokens >= apiToken.MonthlyTokenQuota {
+		return "insufficient_quota", "Monthly token quota exceeded for this API token"
 	}
+	return "", ""
 }
 
 func (h *ShareChatHandler) recordOpenAIAudit(
@@ -9,22 +9,36 @@ import (
 
 func TestEvaluateAPITokenGovernanceViolation(t *testing.T) {
 	t.Run("no token no violation", func(t *testing.T) {
-		require.Equal(t, "", evaluateAPITokenGovernanceViolation(nil, 100, 100))
+		errorType, _ := evaluateAPITokenGovernanceViolation(nil, 100, 100, 100)
+		require.Equal(t, "", errorType)
 	})
 
 	t.Run("rate limit exceeded", func(t *testing.T) {
 		token := &domain.APIToken{RateLimitPerMinute: 10, DailyQuota: 100}
-		require.Equal(t, "rate_limit_error", evaluateAPITokenGovernanceViolation(token, 10, 20))
+		errorType, _ := evaluateAPITokenGovernanceViolation(token, 10, 20, 0)
+		require.Equal(t, "rate_limit_error", errorType)
 	})
 
 	t.Run("daily quota exceeded", func(t *testing.T) {
 		token := &domain.APIToken{RateLimitPerMinute: 100, DailyQuota: 50}
-		require.Equal(t, "insufficient_quota", evaluateAPITokenGovernanceViolation(token, 10, 50))
+		errorType, _ := evaluateAPITokenGovernanceViolation(token, 10, 50, 0)
+		require.Equal(t, "insufficient_quota", errorType)
+	})
+
+	t.Run("monthly token quota exceeded", func(t *testing.T) {
+		token := &domain.APIToken{MonthlyTokenQuota: 1000}
+		errorType, message := evaluateAPITokenGovernanceViolation(token, 1, 1, 1000)
+		require.Equal(t, "insufficient_quota", errorType)
+		require.Contains(t, message, "Monthly")
+
+		errorType, _ = evaluateAPITokenGovernanceViolation(token, 1, 1, 999)
+		require.Equal(t, "", errorType)
 	})
 
 	t.Run("unlimited", func(t *testing.T) {
 		token := &domain.APIToken{RateLimitPerMinute: 0, DailyQuota: 0}
-		require.Equal(t, "", evaluateAPITokenGovernanceViolation(token, 1000, 100000))
+		errorType, _ := evaluateAPITokenGovernanceViolation(token, 1000, 100000, 1000000)
+		require.Equal(t, "", errorType)
 	})
 }
 
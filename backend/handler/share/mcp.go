@@ -1,32 +1,95 @@
 package share
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
 
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/handler"
 	"github.com/chaitin/panda-wiki/log"
 	"github.com/chaitin/panda-wiki/repo/pg"
+	"github.com/chaitin/panda-wiki/store/cache"
 	"github.com/chaitin/panda-wiki/usecase"
 )
 
 const (
 	defaultMCPToolName = "get_docs"
 	defaultMCPToolDesc = "为解决用户的问题从知识库中检索文档"
-	mcpProtocolVersion = "2024-11-05"
 	mcpResultLimit     = 5
+	mcpMaxResultLimit  = 20
+
+	mcpToolSearchDocs  = "search_docs"
+	mcpToolGetNode     = "get_node"
+	mcpToolListTree    = "list_tree"
+	mcpToolAskQuestion = "ask_question"
+
+	mcpSessionKeyPrefix = "mcp:session:"
+	mcpSessionTTL       = 24 * time.Hour
+	mcpMaxBodySize      = 1 << 20
 )
 
+// mcpProtocolVersions lists supported versions, latest first.
+var mcpProtocolVersions = []string{"2025-03-26", "2024-11-05"}
+
+// JSON-RPC and MCP error codes
+const (
+	mcpErrParse            = -32700
+	mcpErrInvalidRequest   = -32600
+	mcpErrMethodNotFound   = -32601
+	mcpErrInvalidParams    = -32602
+	mcpErrInternal         = -32000
+	mcpErrUnauthorized     = -32001
+	mcpErrResourceNotFound = -32002
+)
+
+type mcpAppUsecase interface {
+	GetMCPServerAppInfo(ctx context.Context, kbID string) (*domain.AppInfoResp, error)
+}
+
+type mcpDocUsecase interface {
+	SearchDocs(ctx context.Context, kbID, query string, limit int) ([]*domain.MCPDoc, error)
+	GetNode(ctx context.Context, kbID, nodeID string) (*domain.MCPNode, error)
+	ListTree(ctx context.Context, kbID, parentID string) ([]*domain.MCPTreeNode, error)
+	AskQuestion(ctx context.Context, kbID, question, remoteIP string) (*domain.MCPAnswer, error)
+	ListResources(ctx context.Context, kbID string, offset int) ([]*domain.MCPResource, int, error)
+}
+
+type mcpRepository interface {
+	SearchReleasedDocs(ctx context.Context, kbID, query string, limit int) ([]*pg.MCPDocSearchResult, error)
+	LogInitializeCall(ctx context.Context, sessionID, kbID, remoteIP string, req, resp any) error
+	LogToolCall(ctx context.Context, sessionID, kbID, remoteIP string, req, resp any) error
+}
+
+// mcpSessionCache is the part of the redis client the sessions are kept in.
+type mcpSessionCache interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value any, expiration time.Duration) *redis.StatusCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+}
+
 type ShareMCPHandler struct {
 	*handler.BaseHandler
 	logger     *log.Logger
-	appUsecase *usecase.AppUsecase
-	mcpRepo    *pg.MCPRepository
+	appUsecase mcpAppUsecase
+	mcpUsecase mcpDocUsecase
+	mcpRepo    mcpRepository
+	tokenRepo  *pg.APITokenRepo
+	cache      mcpSessionCache
 }
 
 func NewShareMCPHandler(
@@ -34,23 +97,44 @@ func NewShareMCPHandler(
 	baseHandler *handler.BaseHandler,
 	logger *log.Logger,
 	appUsecase *usecase.AppUsecase,
+	mcpUsecase *usecase.MCPUsecase,
 	mcpRepo *pg.MCPRepository,
+	tokenRepo *pg.APITokenRepo,
+	cache *cache.Cache,
 ) *ShareMCPHandler {
 	h := &ShareMCPHandler{
 		BaseHandler: baseHandler,
 		logger:      logger.WithModule("handler.share.mcp"),
 		appUsecase:  appUsecase,
+		mcpUsecase:  mcpUsecase,
 		mcpRepo:     mcpRepo,
+		tokenRepo:   tokenRepo,
+		cache:       cache,
 	}
 	e.POST("/mcp", h.HandleMCP)
+	e.GET("/mcp", h.HandleMCPStream)
+	e.DELETE("/mcp", h.DeleteMCPSession)
 	return h
 }
 
 type mcpJSONRPCRequest struct {
 	JSONRPC string          `json:"jsonrpc"`
-	ID      any             `json:"id,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params,omitempty"`
+	// Result and Error are set when the message is a client response
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// isNotification reports whether the message expects no response.
+// Client responses are accepted and ignored the same way.
+func (r *mcpJSONRPCRequest) isNotification() bool {
+	return len(r.ID) == 0 || r.isResponse()
+}
+
+func (r *mcpJSONRPCRequest) isResponse() bool {
+	return r.Method == "" && (len(r.Result) > 0 || len(r.Error) > 0)
 }
 
 type mcpJSONRPCResponse struct {
@@ -65,6 +149,10 @@ type mcpJSONRPCError struct {
 	Message string `json:"message"`
 }
 
+type mcpInitializeParams struct {
+	ProtocolVersion string `json:"protocolVersion"`
+}
+
 type mcpInitializeResult struct {
 	ProtocolVersion string                 `json:"protocolVersion"`
 	Capabilities    map[string]any         `json:"capabilities"`
@@ -101,152 +189,618 @@ type mcpTextContent struct {
 	Text string `json:"text"`
 }
 
+type mcpResourcesListParams struct {
+	Cursor string `json:"cursor"`
+}
+
+type mcpResourcesListResult struct {
+	Resources  []*domain.MCPResource `json:"resources"`
+	NextCursor string                `json:"nextCursor,omitempty"`
+}
+
+type mcpResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MimeType    string `json:"mimeType"`
+}
+
+type mcpResourceTemplatesListResult struct {
+	ResourceTemplates []mcpResourceTemplate `json:"resourceTemplates"`
+}
+
+type mcpResourcesReadParams struct {
+	URI string `json:"uri"`
+}
+
+type mcpResourceContent struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type mcpResourcesReadResult struct {
+	Contents []mcpResourceContent `json:"contents"`
+}
+
+type mcpSession struct {
+	KBID            string `json:"kb_id"`
+	ProtocolVersion string `json:"protocol_version"`
+}
+
+// mcpCallContext carries per-request state shared by all messages of a (batch) POST.
+type mcpCallContext struct {
+	kbID string
+	// sessionID is empty for requests served statelessly
+	sessionID string
+	remoteIP  string
+	settings  domain.MCPServerSettings
+}
+
+// HandleMCP implements the POST side of the Streamable HTTP transport.
+// The body is a single JSON-RPC message or a batch; responses are returned as
+// JSON, or as an SSE stream when the client accepts text/event-stream.
 func (h *ShareMCPHandler) HandleMCP(c echo.Context) error {
-	kbID := strings.TrimSpace(c.Request().Header.Get("X-KB-ID"))
-	if kbID == "" {
-		return c.JSON(http.StatusBadRequest, h.newJSONRPCError(nil, -32600, "X-KB-ID header is required"))
+	ctx := c.Request().Context()
+	call, errResp, status := h.authorize(c)
+	if errResp != nil {
+		return c.JSON(status, errResp)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, mcpMaxBodySize))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, h.newJSONRPCError(nil, mcpErrParse, "read request body failed"))
+	}
+	body = bytes.TrimSpace(body)
+	isBatch := len(body) > 0 && body[0] == '['
+	var messages []json.RawMessage
+	if isBatch {
+		if err := json.Unmarshal(body, &messages); err != nil {
+			return c.JSON(http.StatusBadRequest, h.newJSONRPCError(nil, mcpErrParse, "invalid JSON-RPC request"))
+		}
+		if len(messages) == 0 {
+			return c.JSON(http.StatusBadRequest, h.newJSONRPCError(nil, mcpErrInvalidRequest, "empty batch"))
+		}
+	} else {
+		messages = []json.RawMessage{body}
+	}
+
+	reqs := make([]*mcpJSONRPCRequest, len(messages))
+	hasInitialize := false
+	for i, message := range messages {
+		var req mcpJSONRPCRequest
+		if err := json.Unmarshal(message, &req); err != nil {
+			if !isBatch {
+				return c.JSON(http.StatusBadRequest, h.newJSONRPCError(nil, mcpErrParse, "invalid JSON-RPC request"))
+			}
+			req = mcpJSONRPCRequest{}
+		}
+		if !isBatch && req.JSONRPC != "2.0" {
+			return c.JSON(http.StatusBadRequest, h.newJSONRPCError(req.ID, mcpErrInvalidRequest, "invalid JSON-RPC request"))
+		}
+		reqs[i] = &req
+		hasInitialize = hasInitialize || req.Method == "initialize"
+	}
+
+	// session: initialize starts a new one, other requests must present a live one.
+	// Requests without a session header are served statelessly for older clients.
+	sessionID := h.getSessionHeader(c)
+	switch {
+	case hasInitialize:
+		if isBatch {
+			return c.JSON(http.StatusBadRequest, h.newJSONRPCError(nil, mcpErrInvalidRequest, "initialize must not be sent in a batch"))
+		}
+	case sessionID != "":
+		session, err := h.getSession(ctx, sessionID)
+		if err != nil {
+			h.logger.Error("get mcp session failed", log.Error(err), log.String("session_id", sessionID))
+			return c.JSON(http.StatusInternalServerError, h.newJSONRPCError(nil, mcpErrInternal, "failed to load mcp session"))
+		}
+		if session == nil || session.KBID != call.kbID {
+			return c.JSON(http.StatusNotFound, h.newJSONRPCError(nil, mcpErrInvalidRequest, "mcp session not found"))
+		}
+		call.sessionID = sessionID
 	}
 
-	var req mcpJSONRPCRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, h.newJSONRPCError(nil, -32700, "invalid JSON-RPC request"))
+	responses := make([]*mcpJSONRPCResponse, 0, len(reqs))
+	for _, req := range reqs {
+		if resp := h.handleMessage(ctx, call, req); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	// only a session initialize has stored is handed out
+	if call.sessionID != "" {
+		c.Response().Header().Set("Mcp-Session-Id", call.sessionID)
+	}
+	if len(responses) == 0 {
+		return c.NoContent(http.StatusAccepted)
+	}
+
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream") {
+		c.Response().Header().Set("Content-Type", "text/event-stream")
+		c.Response().Header().Set("Cache-Control", "no-cache")
+		c.Response().Header().Set("Connection", "keep-alive")
+		c.Response().WriteHeader(http.StatusOK)
+		for _, resp := range responses {
+			if err := h.writeSSEMessage(c, resp); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	if req.JSONRPC != "2.0" || strings.TrimSpace(req.Method) == "" {
-		return c.JSON(http.StatusBadRequest, h.newJSONRPCError(req.ID, -32600, "invalid JSON-RPC request"))
+	if !isBatch {
+		return c.JSON(http.StatusOK, responses[0])
+	}
+	return c.JSON(http.StatusOK, responses)
+}
+
+// HandleMCPStream is the GET side of the Streamable HTTP transport.
+// The server never sends unsolicited messages, so no standalone stream is offered.
+func (h *ShareMCPHandler) HandleMCPStream(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderAllow, "POST, DELETE")
+	return c.NoContent(http.StatusMethodNotAllowed)
+}
+
+// DeleteMCPSession terminates the session named by the Mcp-Session-Id header.
+func (h *ShareMCPHandler) DeleteMCPSession(c echo.Context) error {
+	call, errResp, status := h.authorize(c)
+	if errResp != nil {
+		return c.JSON(status, errResp)
+	}
+	sessionID := h.getSessionHeader(c)
+	if sessionID == "" {
+		return c.JSON(http.StatusBadRequest, h.newJSONRPCError(nil, mcpErrInvalidRequest, "Mcp-Session-Id header is required"))
+	}
+	ctx := c.Request().Context()
+	session, err := h.getSession(ctx, sessionID)
+	if err != nil {
+		h.logger.Error("get mcp session failed", log.Error(err), log.String("session_id", sessionID))
+		return c.JSON(http.StatusInternalServerError, h.newJSONRPCError(nil, mcpErrInternal, "failed to load mcp session"))
+	}
+	if session == nil || session.KBID != call.kbID {
+		return c.JSON(http.StatusNotFound, h.newJSONRPCError(nil, mcpErrInvalidRequest, "mcp session not found"))
+	}
+	if err := h.cache.Del(ctx, mcpSessionKeyPrefix+sessionID).Err(); err != nil {
+		h.logger.Error("delete mcp session failed", log.Error(err), log.String("session_id", sessionID))
+		return c.JSON(http.StatusInternalServerError, h.newJSONRPCError(nil, mcpErrInternal, "failed to delete mcp session"))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// authorize checks the kb header, that the mcp server is enabled and the simple auth token.
+// An api token of the kb with the mcp scope works in place of the simple auth token.
+func (h *ShareMCPHandler) authorize(c echo.Context) (*mcpCallContext, *mcpJSONRPCResponse, int) {
+	kbID := strings.TrimSpace(c.Request().Header.Get("X-KB-ID"))
+	if kbID == "" {
+		resp := h.newJSONRPCError(nil, mcpErrInvalidRequest, "X-KB-ID header is required")
+		return nil, &resp, http.StatusBadRequest
 	}
 
 	appInfo, err := h.appUsecase.GetMCPServerAppInfo(c.Request().Context(), kbID)
 	if err != nil {
 		h.logger.Error("get mcp app info failed", log.Error(err), log.String("kb_id", kbID))
-		return c.JSON(http.StatusOK, h.newJSONRPCError(req.ID, -32000, "failed to load mcp settings"))
+		resp := h.newJSONRPCError(nil, mcpErrInternal, "failed to load mcp settings")
+		return nil, &resp, http.StatusInternalServerError
 	}
 	settings := appInfo.Settings.MCPServerSettings
 	if !settings.IsEnabled {
-		return c.JSON(http.StatusForbidden, h.newJSONRPCError(req.ID, -32001, "mcp server is disabled"))
+		resp := h.newJSONRPCError(nil, mcpErrUnauthorized, "mcp server is disabled")
+		return nil, &resp, http.StatusForbidden
 	}
-	if settings.SampleAuth.Enabled && !h.validateSampleAuth(c, settings.SampleAuth.Password) {
-		return c.JSON(http.StatusUnauthorized, h.newJSONRPCError(req.ID, -32001, "unauthorized"))
+	if settings.SampleAuth.Enabled && !h.validateSampleAuth(c, settings.SampleAuth.Password) && !h.validateAPIToken(c, kbID) {
+		resp := h.newJSONRPCError(nil, mcpErrUnauthorized, "unauthorized")
+		return nil, &resp, http.StatusUnauthorized
 	}
+	return &mcpCallContext{
+		kbID:     kbID,
+		remoteIP: c.RealIP(),
+		settings: settings,
+	}, nil, http.StatusOK
+}
 
-	sessionID := h.resolveSessionID(c)
-	c.Response().Header().Set("Mcp-Session-Id", sessionID)
+// handleMessage dispatches one JSON-RPC message. It returns nil for notifications and client
+// responses, invalid messages are answered with an error even without an id.
+func (h *ShareMCPHandler) handleMessage(ctx context.Context, call *mcpCallContext, req *mcpJSONRPCRequest) *mcpJSONRPCResponse {
+	if req.JSONRPC != "2.0" || (strings.TrimSpace(req.Method) == "" && !req.isResponse()) {
+		resp := h.newJSONRPCError(req.ID, mcpErrInvalidRequest, "invalid JSON-RPC request")
+		return &resp
+	}
+	if req.isNotification() {
+		return nil
+	}
 
-	toolName, toolDesc := h.getToolSettings(settings.DocsToolSettings.Name, settings.DocsToolSettings.Desc)
+	var resp mcpJSONRPCResponse
 	switch req.Method {
 	case "initialize":
-		resp := mcpJSONRPCResponse{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-			Result: mcpInitializeResult{
-				ProtocolVersion: mcpProtocolVersion,
-				Capabilities: map[string]any{
-					"tools": map[string]any{
-						"listChanged": false,
+		resp = h.initialize(ctx, call, req)
+	case "ping":
+		resp = h.newJSONRPCResult(req.ID, map[string]any{})
+	case "tools/list":
+		resp = h.newJSONRPCResult(req.ID, mcpToolsListResult{Tools: h.listTools(call.settings)})
+	case "tools/call":
+		resp = h.callTool(ctx, call, req)
+		if err := h.mcpRepo.LogToolCall(ctx, call.sessionID, call.kbID, call.remoteIP, req, resp); err != nil {
+			h.logger.Error("log mcp tool call failed", log.Error(err), log.String("kb_id", call.kbID))
+		}
+	case "resources/list":
+		resp = h.listResources(ctx, call, req)
+	case "resources/templates/list":
+		resp = h.newJSONRPCResult(req.ID, mcpResourceTemplatesListResult{
+			ResourceTemplates: []mcpResourceTemplate{
+				{
+					URITemplate: domain.MCPResourceURIPrefix + "{node_id}",
+					Name:        "wiki document",
+					Description: "released wiki document by node id",
+					MimeType:    "text/markdown",
+				},
+			},
+		})
+	case "resources/read":
+		resp = h.readResource(ctx, call, req)
+	default:
+		resp = h.newJSONRPCError(req.ID, mcpErrMethodNotFound, "method not found")
+	}
+	return &resp
+}
+
+func (h *ShareMCPHandler) initialize(ctx context.Context, call *mcpCallContext, req *mcpJSONRPCRequest) mcpJSONRPCResponse {
+	var params mcpInitializeParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return h.newJSONRPCError(req.ID, mcpErrInvalidParams, "invalid initialize params")
+		}
+	}
+	protocolVersion := mcpProtocolVersions[0]
+	if slices.Contains(mcpProtocolVersions, params.ProtocolVersion) {
+		protocolVersion = params.ProtocolVersion
+	}
+	sessionID := uuid.NewString()
+	if err := h.saveSession(ctx, sessionID, &mcpSession{KBID: call.kbID, ProtocolVersion: protocolVersion}); err != nil {
+		h.logger.Error("save mcp session failed", log.Error(err), log.String("kb_id", call.kbID))
+		return h.newJSONRPCError(req.ID, mcpErrInternal, "failed to create mcp session")
+	}
+	call.sessionID = sessionID
+
+	resp := h.newJSONRPCResult(req.ID, mcpInitializeResult{
+		ProtocolVersion: protocolVersion,
+		Capabilities: map[string]any{
+			"tools": map[string]any{
+				"listChanged": false,
+			},
+			"resources": map[string]any{
+				"subscribe":   false,
+				"listChanged": false,
+			},
+		},
+		ServerInfo: mcpInitializeServerRef{
+			Name:    "PandaWiki MCP Server",
+			Version: "1.0.0",
+		},
+	})
+	if err := h.mcpRepo.LogInitializeCall(ctx, call.sessionID, call.kbID, call.remoteIP, req, resp); err != nil {
+		h.logger.Error("log mcp initialize call failed", log.Error(err), log.String("kb_id", call.kbID))
+	}
+	return resp
+}
+
+func (h *ShareMCPHandler) listTools(settings domain.MCPServerSettings) []mcpTool {
+	toolName, toolDesc := h.getToolSettings(settings.DocsToolSettings.Name, settings.DocsToolSettings.Desc)
+	builtinTools := []mcpTool{
+		{
+			Name:        mcpToolSearchDocs,
+			Description: "Semantic and keyword search over the released wiki docs. Returns the most relevant docs with node_id, path and a matching snippet.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"query": map[string]any{
+						"type":        "string",
+						"description": "question or keywords to search for",
+					},
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": fmt.Sprintf("max number of docs to return, default %d", mcpResultLimit),
+						"minimum":     1,
+						"maximum":     mcpMaxResultLimit,
 					},
 				},
-				ServerInfo: mcpInitializeServerRef{
-					Name:    "PandaWiki MCP Server",
-					Version: "1.0.0",
+				"required": []string{"query"},
+			},
+		},
+		{
+			Name:        mcpToolGetNode,
+			Description: "Get the full markdown content of a released wiki doc by node_id.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"node_id": map[string]any{
+						"type":        "string",
+						"description": "node id returned by search_docs or list_tree",
+					},
 				},
+				"required": []string{"node_id"},
 			},
-		}
-		if err := h.mcpRepo.LogInitializeCall(c.Request().Context(), sessionID, kbID, c.RealIP(), req, resp); err != nil {
-			h.logger.Error("log mcp initialize call failed", log.Error(err), log.String("kb_id", kbID))
-		}
-		return c.JSON(http.StatusOK, resp)
-	case "tools/list":
-		resp := mcpJSONRPCResponse{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-			Result: mcpToolsListResult{
-				Tools: []mcpTool{
-					{
-						Name:        toolName,
-						Description: toolDesc,
-						InputSchema: map[string]any{
-							"type": "object",
-							"properties": map[string]any{
-								"query": map[string]any{
-									"type":        "string",
-									"description": "keywords to search released docs",
-								},
-							},
-							"required": []string{"query"},
-						},
+		},
+		{
+			Name:        mcpToolListTree,
+			Description: "List the wiki directory tree of released folders and docs.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"parent_id": map[string]any{
+						"type":        "string",
+						"description": "only list the subtree under this folder node id, default the whole tree",
 					},
 				},
 			},
+		},
+		{
+			Name:        mcpToolAskQuestion,
+			Description: "Ask the wiki AI assistant a question. Returns an answer generated from the released docs with references.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"question": map[string]any{
+						"type":        "string",
+						"description": "the question to answer",
+					},
+				},
+				"required": []string{"question"},
+			},
+		},
+	}
+	tools := []mcpTool{
+		{
+			Name:        toolName,
+			Description: toolDesc,
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"query": map[string]any{
+						"type":        "string",
+						"description": "keywords to search released docs",
+					},
+				},
+				"required": []string{"query"},
+			},
+		},
+	}
+	// the configurable docs tool wins a name clash with a built-in tool
+	for _, tool := range builtinTools {
+		if tool.Name != toolName {
+			tools = append(tools, tool)
 		}
-		return c.JSON(http.StatusOK, resp)
-	case "tools/call":
-		var params mcpToolsCallParams
-		if len(req.Params) > 0 {
-			if err := json.Unmarshal(req.Params, &params); err != nil {
-				resp := h.newJSONRPCError(req.ID, -32602, "invalid tools/call params")
-				if logErr := h.mcpRepo.LogToolCall(c.Request().Context(), sessionID, kbID, c.RealIP(), req, resp); logErr != nil {
-					h.logger.Error("log mcp tool call failed", log.Error(logErr), log.String("kb_id", kbID))
-				}
-				return c.JSON(http.StatusOK, resp)
-			}
-		}
+	}
+	return tools
+}
 
-		if params.Name != toolName {
-			resp := h.newJSONRPCError(req.ID, -32602, fmt.Sprintf("unsupported tool: %s", params.Name))
-			if logErr := h.mcpRepo.LogToolCall(c.Request().Context(), sessionID, kbID, c.RealIP(), req, resp); logErr != nil {
-				h.logger.Error("log mcp tool call failed", log.Error(logErr), log.String("kb_id", kbID))
-			}
-			return c.JSON(http.StatusOK, resp)
+func (h *ShareMCPHandler) callTool(ctx context.Context, call *mcpCallContext, req *mcpJSONRPCRequest) mcpJSONRPCResponse {
+	var params mcpToolsCallParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return h.newJSONRPCError(req.ID, mcpErrInvalidParams, "invalid tools/call params")
 		}
+	}
 
+	toolName, _ := h.getToolSettings(call.settings.DocsToolSettings.Name, call.settings.DocsToolSettings.Desc)
+	switch params.Name {
+	case toolName:
+		return h.callGetDocs(ctx, call, req, params)
+	case mcpToolSearchDocs:
 		query := strings.TrimSpace(anyToString(params.Arguments["query"]))
 		if query == "" {
-			resp := h.newJSONRPCError(req.ID, -32602, "tools/call.arguments.query is required")
-			if logErr := h.mcpRepo.LogToolCall(c.Request().Context(), sessionID, kbID, c.RealIP(), req, resp); logErr != nil {
-				h.logger.Error("log mcp tool call failed", log.Error(logErr), log.String("kb_id", kbID))
+			return h.newJSONRPCError(req.ID, mcpErrInvalidParams, "tools/call.arguments.query is required")
+		}
+		limit := mcpResultLimit
+		if v, ok := params.Arguments["limit"]; ok {
+			n, ok := anyToInt(v)
+			if !ok || n < 1 || n > mcpMaxResultLimit {
+				return h.newJSONRPCError(req.ID, mcpErrInvalidParams, fmt.Sprintf("tools/call.arguments.limit must be an integer from 1 to %d", mcpMaxResultLimit))
 			}
-			return c.JSON(http.StatusOK, resp)
+			limit = n
 		}
-
-		docs, err := h.mcpRepo.SearchReleasedDocs(c.Request().Context(), kbID, query, mcpResultLimit)
+		docs, err := h.mcpUsecase.SearchDocs(ctx, call.kbID, query, limit)
 		if err != nil {
-			h.logger.Error("search released docs failed", log.Error(err), log.String("kb_id", kbID), log.String("query", query))
-			resp := h.newJSONRPCError(req.ID, -32000, "failed to search docs")
-			if logErr := h.mcpRepo.LogToolCall(c.Request().Context(), sessionID, kbID, c.RealIP(), req, resp); logErr != nil {
-				h.logger.Error("log mcp tool call failed", log.Error(logErr), log.String("kb_id", kbID))
+			h.logger.Error("mcp search docs failed", log.Error(err), log.String("kb_id", call.kbID), log.String("query", query))
+			return h.newToolError(req.ID, "failed to search docs")
+		}
+		return h.newToolResult(req.ID, renderMCPDocs(query, docs))
+	case mcpToolGetNode:
+		nodeID := strings.TrimSpace(anyToString(params.Arguments["node_id"]))
+		if nodeID == "" {
+			return h.newJSONRPCError(req.ID, mcpErrInvalidParams, "tools/call.arguments.node_id is required")
+		}
+		node, err := h.mcpUsecase.GetNode(ctx, call.kbID, nodeID)
+		if err != nil {
+			if errors.Is(err, domain.ErrMCPNodeNotFound) {
+				return h.newToolError(req.ID, fmt.Sprintf("node %s not found", nodeID))
 			}
-			return c.JSON(http.StatusOK, resp)
+			h.logger.Error("mcp get node failed", log.Error(err), log.String("kb_id", call.kbID), log.String("node_id", nodeID))
+			return h.newToolError(req.ID, "failed to get node")
 		}
-
-		resp := mcpJSONRPCResponse{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-			Result: mcpToolsCallResult{
-				Content: []mcpTextContent{
-					{
-						Type: "text",
-						Text: renderDocSearchResult(query, docs),
-					},
-				},
-			},
+		return h.newToolResult(req.ID, renderMCPNode(node))
+	case mcpToolListTree:
+		parentID := strings.TrimSpace(anyToString(params.Arguments["parent_id"]))
+		tree, err := h.mcpUsecase.ListTree(ctx, call.kbID, parentID)
+		if err != nil {
+			h.logger.Error("mcp list tree failed", log.Error(err), log.String("kb_id", call.kbID))
+			return h.newToolError(req.ID, "failed to list tree")
 		}
-		if err := h.mcpRepo.LogToolCall(c.Request().Context(), sessionID, kbID, c.RealIP(), req, resp); err != nil {
-			h.logger.Error("log mcp tool call failed", log.Error(err), log.String("kb_id", kbID))
+		return h.newToolResult(req.ID, renderMCPTree(tree))
+	case mcpToolAskQuestion:
+		question := strings.TrimSpace(anyToString(params.Arguments["question"]))
+		if question == "" {
+			return h.newJSONRPCError(req.ID, mcpErrInvalidParams, "tools/call.arguments.question is required")
 		}
-		return c.JSON(http.StatusOK, resp)
+		answer, err := h.mcpUsecase.AskQuestion(ctx, call.kbID, question, call.remoteIP)
+		if err != nil {
+			h.logger.Error("mcp ask question failed", log.Error(err), log.String("kb_id", call.kbID))
+			return h.newToolError(req.ID, fmt.Sprintf("failed to answer question: %s", err.Error()))
+		}
+		return h.newToolResult(req.ID, renderMCPAnswer(answer))
 	default:
-		return c.JSON(http.StatusOK, h.newJSONRPCError(req.ID, -32601, "method not found"))
+		return h.newJSONRPCError(req.ID, mcpErrInvalidParams, fmt.Sprintf("unsupported tool: %s", params.Name))
 	}
 }
 
-func (h *ShareMCPHandler) newJSONRPCError(id any, code int, message string) mcpJSONRPCResponse {
+// callGetDocs serves the configurable keyword docs tool
+func (h *ShareMCPHandler) callGetDocs(ctx context.Context, call *mcpCallContext, req *mcpJSONRPCRequest, params mcpToolsCallParams) mcpJSONRPCResponse {
+	query := strings.TrimSpace(anyToString(params.Arguments["query"]))
+	if query == "" {
+		return h.newJSONRPCError(req.ID, mcpErrInvalidParams, "tools/call.arguments.query is required")
+	}
+
+	docs, err := h.mcpRepo.SearchReleasedDocs(ctx, call.kbID, query, mcpResultLimit)
+	if err != nil {
+		h.logger.Error("search released docs failed", log.Error(err), log.String("kb_id", call.kbID), log.String("query", query))
+		return h.newJSONRPCError(req.ID, mcpErrInternal, "failed to search docs")
+	}
+	return h.newToolResult(req.ID, renderDocSearchResult(query, docs))
+}
+
+func (h *ShareMCPHandler) listResources(ctx context.Context, call *mcpCallContext, req *mcpJSONRPCRequest) mcpJSONRPCResponse {
+	var params mcpResourcesListParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return h.newJSONRPCError(req.ID, mcpErrInvalidParams, "invalid resources/list params")
+		}
+	}
+	offset := 0
+	if params.Cursor != "" {
+		var err error
+		if offset, err = strconv.Atoi(params.Cursor); err != nil || offset < 0 {
+			return h.newJSONRPCError(req.ID, mcpErrInvalidParams, "invalid cursor")
+		}
+	}
+
+	resources, next, err := h.mcpUsecase.ListResources(ctx, call.kbID, offset)
+	if err != nil {
+		h.logger.Error("mcp list resources failed", log.Error(err), log.String("kb_id", call.kbID))
+		return h.newJSONRPCError(req.ID, mcpErrInternal, "failed to list resources")
+	}
+	result := mcpResourcesListResult{Resources: resources}
+	if next > 0 {
+		result.NextCursor = strconv.Itoa(next)
+	}
+	return h.newJSONRPCResult(req.ID, result)
+}
+
+func (h *ShareMCPHandler) readResource(ctx context.Context, call *mcpCallContext, req *mcpJSONRPCRequest) mcpJSONRPCResponse {
+	var params mcpResourcesReadParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return h.newJSONRPCError(req.ID, mcpErrInvalidParams, "invalid resources/read params")
+		}
+	}
+	nodeID, ok := domain.ParseMCPResourceURI(params.URI)
+	if !ok {
+		return h.newJSONRPCError(req.ID, mcpErrInvalidParams, fmt.Sprintf("invalid resource uri: %s", params.URI))
+	}
+
+	node, err := h.mcpUsecase.GetNode(ctx, call.kbID, nodeID)
+	if err != nil {
+		if errors.Is(err, domain.ErrMCPNodeNotFound) {
+			return h.newJSONRPCError(req.ID, mcpErrResourceNotFound, fmt.Sprintf("resource not found: %s", params.URI))
+		}
+		h.logger.Error("mcp read resource failed", log.Error(err), log.String("kb_id", call.kbID), log.String("node_id", nodeID))
+		return h.newJSONRPCError(req.ID, mcpErrInternal, "failed to read resource")
+	}
+	return h.newJSONRPCResult(req.ID, mcpResourcesReadResult{
+		Contents: []mcpResourceContent{
+			{
+				URI:      domain.MCPResourceURI(node.NodeID),
+				MimeType: "text/markdown",
+				Text:     renderMCPNode(node),
+			},
+		},
+	})
+}
+
+func (h *ShareMCPHandler) getSession(ctx context.Context, sessionID string) (*mcpSession, error) {
+	key := mcpSessionKeyPrefix + sessionID
+	raw, err := h.cache.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var session mcpSession
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return nil, err
+	}
+	// sliding expiration
+	if err := h.cache.Expire(ctx, key, mcpSessionTTL).Err(); err != nil {
+		h.logger.Warn("refresh mcp session ttl failed", log.Error(err), log.String("session_id", sessionID))
+	}
+	return &session, nil
+}
+
+func (h *ShareMCPHandler) saveSession(ctx context.Context, sessionID string, session *mcpSession) error {
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return h.cache.Set(ctx, mcpSessionKeyPrefix+sessionID, raw, mcpSessionTTL).Err()
+}
+
+func (h *ShareMCPHandler) writeSSEMessage(c echo.Context, resp *mcpJSONRPCResponse) error {
+	jsonContent, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	sseMessage := fmt.Sprintf("event: message\ndata: %s\n\n", string(jsonContent))
+	if _, err := c.Response().Write([]byte(sseMessage)); err != nil {
+		return err
+	}
+	c.Response().Flush()
+	return nil
+}
+
+func (h *ShareMCPHandler) newJSONRPCResult(id json.RawMessage, result any) mcpJSONRPCResponse {
 	return mcpJSONRPCResponse{
 		JSONRPC: "2.0",
 		ID:      id,
+		Result:  result,
+	}
+}
+
+func (h *ShareMCPHandler) newToolResult(id json.RawMessage, text string) mcpJSONRPCResponse {
+	return h.newJSONRPCResult(id, mcpToolsCallResult{
+		Content: []mcpTextContent{
+			{
+				Type: "text",
+				Text: text,
+			},
+		},
+	})
+}
+
+// newToolError reports a tool execution failure inside the result so the model can see it
+func (h *ShareMCPHandler) newToolError(id json.RawMessage, text string) mcpJSONRPCResponse {
+	return h.newJSONRPCResult(id, mcpToolsCallResult{
+		Content: []mcpTextContent{
+			{
+				Type: "text",
+				Text: text,
+			},
+		},
+		IsError: true,
+	})
+}
+
+func (h *ShareMCPHandler) newJSONRPCError(id json.RawMessage, code int, message string) mcpJSONRPCResponse {
+	resp := mcpJSONRPCResponse{
+		JSONRPC: "2.0",
 		Error: &mcpJSONRPCError{
 			Code:    code,
 			Message: message,
 		},
 	}
+	if len(id) > 0 {
+		resp.ID = id
+	}
+	return resp
 }
 
 func (h *ShareMCPHandler) getToolSettings(name, desc string) (string, string) {
@@ -261,16 +815,12 @@ func (h *ShareMCPHandler) getToolSettings(name, desc string) (string, string) {
 	return toolName, toolDesc
 }
 
-func (h *ShareMCPHandler) resolveSessionID(c echo.Context) string {
+func (h *ShareMCPHandler) getSessionHeader(c echo.Context) string {
 	sessionID := strings.TrimSpace(c.Request().Header.Get("Mcp-Session-Id"))
 	if sessionID != "" {
 		return sessionID
 	}
-	sessionID = strings.TrimSpace(c.Request().Header.Get("X-MCP-Session-ID"))
-	if sessionID != "" {
-		return sessionID
-	}
-	return uuid.NewString()
+	return strings.TrimSpace(c.Request().Header.Get("X-MCP-Session-ID"))
 }
 
 func (h *ShareMCPHandler) validateSampleAuth(c echo.Context, expectedPassword string) bool {
@@ -296,6 +846,20 @@ func (h *ShareMCPHandler) validateSampleAuth(c echo.Context, expectedPassword st
 	return false
 }
 
+func (h *ShareMCPHandler) validateAPIToken(c echo.Context, kbID string) bool {
+	token, ok := strings.CutPrefix(strings.TrimSpace(c.Request().Header.Get("Authorization")), "Bearer ")
+	token = strings.TrimSpace(token)
+	if !ok || token == "" || h.tokenRepo == nil {
+		return false
+	}
+	apiToken, err := h.tokenRepo.GetByTokenWithCache(c.Request().Context(), token)
+	if err != nil {
+		h.logger.Warn("get api token for mcp failed", log.Error(err))
+		return false
+	}
+	return apiToken != nil && apiToken.KbId == kbID && apiToken.HasScope(consts.APITokenScopeMCP)
+}
+
 func anyToString(v any) string {
 	switch value := v.(type) {
 	case string:
@@ -307,6 +871,20 @@ func anyToString(v any) string {
 	}
 }
 
+func anyToInt(v any) (int, bool) {
+	switch value := v.(type) {
+	case float64:
+		return int(value), true
+	case int:
+		return value, true
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
 func renderDocSearchResult(query string, docs []*pg.MCPDocSearchResult) string {
 	if len(docs) == 0 {
 		return fmt.Sprintf("No released docs found for query: %s", query)
@@ -331,6 +909,79 @@ func renderDocSearchResult(query string, docs []*pg.MCPDocSearchResult) string {
 	return b.String()
 }
 
+func renderMCPDocs(query string, docs []*domain.MCPDoc) string {
+	if len(docs) == 0 {
+		return fmt.Sprintf("No released docs found for query: %s", query)
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Found %d released docs for query: %s\n\n", len(docs), query))
+	for i, doc := range docs {
+		b.WriteString(fmt.Sprintf("%d. %s\n", i+1, strings.TrimSpace(doc.Name)))
+		b.WriteString(fmt.Sprintf("node_id: %s\n", doc.NodeID))
+		if len(doc.PathNames) > 0 {
+			b.WriteString(fmt.Sprintf("path: %s\n", strings.Join(doc.PathNames, " / ")))
+		}
+		b.WriteString(fmt.Sprintf("url: %s\n", doc.URL))
+		if summary := compactAndTruncate(doc.Summary, 160); summary != "" {
+			b.WriteString(fmt.Sprintf("summary: %s\n", summary))
+		}
+		if snippet := compactAndTruncate(doc.Snippet, 300); snippet != "" {
+			b.WriteString(fmt.Sprintf("snippet: %s\n", snippet))
+		}
+		if i != len(docs)-1 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func renderMCPNode(node *domain.MCPNode) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("# %s\n\n", strings.TrimSpace(node.Name)))
+	b.WriteString(fmt.Sprintf("node_id: %s\nurl: %s\nupdated_at: %s\n\n", node.NodeID, node.URL, node.UpdatedAt.Format(time.RFC3339)))
+	if summary := strings.TrimSpace(node.Summary); summary != "" {
+		b.WriteString(fmt.Sprintf("> %s\n\n", compactAndTruncate(summary, 0)))
+	}
+	b.WriteString(strings.TrimSpace(node.Content))
+	return b.String()
+}
+
+func renderMCPTree(tree []*domain.MCPTreeNode) string {
+	if len(tree) == 0 {
+		return "No released docs found"
+	}
+	var b strings.Builder
+	var render func(nodes []*domain.MCPTreeNode, depth int)
+	render = func(nodes []*domain.MCPTreeNode, depth int) {
+		for _, node := range nodes {
+			icon := node.Emoji
+			if icon == "" {
+				icon = "📄"
+				if node.Type == domain.NodeTypeFolder {
+					icon = "📁"
+				}
+			}
+			b.WriteString(fmt.Sprintf("%s- %s %s (node_id: %s)\n", strings.Repeat("  ", depth), icon, strings.TrimSpace(node.Name), node.NodeID))
+			render(node.Children, depth+1)
+		}
+	}
+	render(tree, 0)
+	return b.String()
+}
+
+func renderMCPAnswer(answer *domain.MCPAnswer) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(answer.Answer))
+	if len(answer.References) > 0 {
+		b.WriteString("\n\nReferences:\n")
+		for i, ref := range answer.References {
+			b.WriteString(fmt.Sprintf("%d. %s (node_id: %s) %s\n", i+1, strings.TrimSpace(ref.Name), ref.NodeID, ref.URL))
+		}
+	}
+	return b.String()
+}
+
 func compactAndTruncate(s string, limit int) string {
 	compacted := strings.Join(strings.Fields(strings.TrimSpace(s)), " ")
 	if limit <= 0 {
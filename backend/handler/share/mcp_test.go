@@ -0,0 +1,303 @@
+package share
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/repo/pg"
+)
+
+type fakeMCPApp struct{}
+
+func (fakeMCPApp) GetMCPServerAppInfo(ctx context.Context, kbID string) (*domain.AppInfoResp, error) {
+	if kbID == "broken" {
+		return nil, errors.New("db down")
+	}
+	return &domain.AppInfoResp{Settings: domain.AppSettingsResp{
+		MCPServerSettings: domain.MCPServerSettings{IsEnabled: kbID == "kb"},
+	}}, nil
+}
+
+type fakeMCPDocs struct{}
+
+func (fakeMCPDocs) SearchDocs(ctx context.Context, kbID, query string, limit int) ([]*domain.MCPDoc, error) {
+	return []*domain.MCPDoc{{NodeID: "n1", Name: "Install guide", URL: "/node/n1", Snippet: "run the installer"}}, nil
+}
+
+func (fakeMCPDocs) GetNode(ctx context.Context, kbID, nodeID string) (*domain.MCPNode, error) {
+	if nodeID != "n1" {
+		return nil, domain.ErrMCPNodeNotFound
+	}
+	return &domain.MCPNode{NodeID: "n1", Name: "Install guide", URL: "/node/n1", Content: "run the installer"}, nil
+}
+
+func (fakeMCPDocs) ListTree(ctx context.Context, kbID, parentID string) ([]*domain.MCPTreeNode, error) {
+	return nil, nil
+}
+
+func (fakeMCPDocs) AskQuestion(ctx context.Context, kbID, question, remoteIP string) (*domain.MCPAnswer, error) {
+	return nil, errors.New("no model")
+}
+
+func (fakeMCPDocs) ListResources(ctx context.Context, kbID string, offset int) ([]*domain.MCPResource, int, error) {
+	return nil, 0, nil
+}
+
+type fakeMCPRepo struct {
+	toolCalls []string
+}
+
+func (r *fakeMCPRepo) SearchReleasedDocs(ctx context.Context, kbID, query string, limit int) ([]*pg.MCPDocSearchResult, error) {
+	return nil, nil
+}
+
+func (r *fakeMCPRepo) LogInitializeCall(ctx context.Context, sessionID, kbID, remoteIP string, req, resp any) error {
+	return nil
+}
+
+func (r *fakeMCPRepo) LogToolCall(ctx context.Context, sessionID, kbID, remoteIP string, req, resp any) error {
+	r.toolCalls = append(r.toolCalls, sessionID)
+	return nil
+}
+
+// fakeMCPSessionCache keeps the sessions in a map, setErr fails storing them.
+type fakeMCPSessionCache struct {
+	values map[string]string
+	setErr error
+}
+
+func (c *fakeMCPSessionCache) Get(ctx context.Context, key string) *redis.StringCmd {
+	value, ok := c.values[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(value, nil)
+}
+
+func (c *fakeMCPSessionCache) Set(ctx context.Context, key string, value any, expiration time.Duration) *redis.StatusCmd {
+	if c.setErr != nil {
+		return redis.NewStatusResult("", c.setErr)
+	}
+	c.values[key] = string(value.([]byte))
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (c *fakeMCPSessionCache) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	return redis.NewBoolResult(true, nil)
+}
+
+func (c *fakeMCPSessionCache) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	for _, key := range keys {
+		delete(c.values, key)
+	}
+	return redis.NewIntResult(int64(len(keys)), nil)
+}
+
+func newTestMCPServer() (*echo.Echo, *fakeMCPRepo, *fakeMCPSessionCache) {
+	repo := &fakeMCPRepo{}
+	sessions := &fakeMCPSessionCache{values: make(map[string]string)}
+	h := &ShareMCPHandler{
+		logger:     &log.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))},
+		appUsecase: fakeMCPApp{},
+		mcpUsecase: fakeMCPDocs{},
+		mcpRepo:    repo,
+		cache:      sessions,
+	}
+	e := echo.New()
+	e.POST("/mcp", h.HandleMCP)
+	e.DELETE("/mcp", h.DeleteMCPSession)
+	return e, repo, sessions
+}
+
+func postMCP(e *echo.Echo, body, sessionID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("X-KB-ID", "kb")
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+type testMCPResponse struct {
+	ID     json.RawMessage  `json:"id"`
+	Result json.RawMessage  `json:"result"`
+	Error  *mcpJSONRPCError `json:"error"`
+}
+
+func decodeMCPResponse(t *testing.T, rec *httptest.ResponseRecorder) *testMCPResponse {
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp testMCPResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return &resp
+}
+
+func decodeMCPToolResult(t *testing.T, rec *httptest.ResponseRecorder) *mcpToolsCallResult {
+	resp := decodeMCPResponse(t, rec)
+	require.Nil(t, resp.Error)
+	var result mcpToolsCallResult
+	require.NoError(t, json.Unmarshal(resp.Result, &result))
+	return &result
+}
+
+func TestMCPInitialize(t *testing.T) {
+	e, _, sessions := newTestMCPServer()
+
+	rec := postMCP(e, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`, "")
+	resp := decodeMCPResponse(t, rec)
+	require.Nil(t, resp.Error)
+	var result mcpInitializeResult
+	require.NoError(t, json.Unmarshal(resp.Result, &result))
+	require.Equal(t, "2024-11-05", result.ProtocolVersion)
+
+	sessionID := rec.Header().Get("Mcp-Session-Id")
+	require.NotEmpty(t, sessionID)
+	require.Contains(t, sessions.values, mcpSessionKeyPrefix+sessionID)
+
+	// the issued session serves the following requests
+	rec = postMCP(e, `{"jsonrpc":"2.0","id":2,"method":"ping"}`, sessionID)
+	require.Nil(t, decodeMCPResponse(t, rec).Error)
+	require.Equal(t, sessionID, rec.Header().Get("Mcp-Session-Id"))
+
+	require.Equal(t, http.StatusNotFound, postMCP(e, `{"jsonrpc":"2.0","id":3,"method":"ping"}`, "unknown").Code)
+
+	// stateless requests get no session they could not use later
+	rec = postMCP(e, `{"jsonrpc":"2.0","id":4,"method":"ping"}`, "")
+	require.Nil(t, decodeMCPResponse(t, rec).Error)
+	require.Empty(t, rec.Header().Get("Mcp-Session-Id"))
+
+	req := httptest.NewRequest(http.MethodDelete, "/mcp", nil)
+	req.Header.Set("X-KB-ID", "kb")
+	req.Header.Set("Mcp-Session-Id", sessionID)
+	deleted := httptest.NewRecorder()
+	e.ServeHTTP(deleted, req)
+	require.Equal(t, http.StatusNoContent, deleted.Code)
+	require.Equal(t, http.StatusNotFound, postMCP(e, `{"jsonrpc":"2.0","id":5,"method":"ping"}`, sessionID).Code)
+}
+
+func TestMCPSettingsNotLoaded(t *testing.T) {
+	e, _, _ := newTestMCPServer()
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("X-KB-ID", "broken")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	var resp testMCPResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, mcpErrInternal, resp.Error.Code)
+}
+
+func TestMCPInitializeSessionNotStored(t *testing.T) {
+	e, _, sessions := newTestMCPServer()
+	sessions.setErr = errors.New("redis down")
+
+	rec := postMCP(e, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`, "")
+	resp := decodeMCPResponse(t, rec)
+	require.NotNil(t, resp.Error)
+	require.Equal(t, mcpErrInternal, resp.Error.Code)
+	require.Empty(t, rec.Header().Get("Mcp-Session-Id"))
+}
+
+func TestMCPToolsList(t *testing.T) {
+	e, _, _ := newTestMCPServer()
+
+	resp := decodeMCPResponse(t, postMCP(e, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`, ""))
+	require.Nil(t, resp.Error)
+	var result mcpToolsListResult
+	require.NoError(t, json.Unmarshal(resp.Result, &result))
+	names := make([]string, 0, len(result.Tools))
+	for _, tool := range result.Tools {
+		names = append(names, tool.Name)
+	}
+	require.Equal(t, []string{defaultMCPToolName, mcpToolSearchDocs, mcpToolGetNode, mcpToolListTree, mcpToolAskQuestion}, names)
+}
+
+func TestMCPToolsCall(t *testing.T) {
+	e, repo, _ := newTestMCPServer()
+
+	result := decodeMCPToolResult(t, postMCP(e, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search_docs","arguments":{"query":"install"}}}`, ""))
+	require.False(t, result.IsError)
+	require.Contains(t, result.Content[0].Text, "node_id: n1")
+
+	result = decodeMCPToolResult(t, postMCP(e, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"get_node","arguments":{"node_id":"n1"}}}`, ""))
+	require.False(t, result.IsError)
+	require.Contains(t, result.Content[0].Text, "# Install guide")
+
+	// tool failures are results the model can read
+	result = decodeMCPToolResult(t, postMCP(e, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"get_node","arguments":{"node_id":"n2"}}}`, ""))
+	require.True(t, result.IsError)
+	require.Contains(t, result.Content[0].Text, "node n2 not found")
+
+	// bad arguments are protocol errors
+	resp := decodeMCPResponse(t, postMCP(e, `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"search_docs","arguments":{}}}`, ""))
+	require.Equal(t, mcpErrInvalidParams, resp.Error.Code)
+	resp = decodeMCPResponse(t, postMCP(e, `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"delete_kb"}}`, ""))
+	require.Equal(t, mcpErrInvalidParams, resp.Error.Code)
+	for i, limit := range []string{"0", "21", `"many"`} {
+		resp = decodeMCPResponse(t, postMCP(e, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"search_docs","arguments":{"query":"install","limit":%s}}}`, 6+i, limit), ""))
+		require.Equal(t, mcpErrInvalidParams, resp.Error.Code, limit)
+	}
+	result = decodeMCPToolResult(t, postMCP(e, `{"jsonrpc":"2.0","id":9,"method":"tools/call","params":{"name":"search_docs","arguments":{"query":"install","limit":20}}}`, ""))
+	require.False(t, result.IsError)
+
+	require.Len(t, repo.toolCalls, 9)
+}
+
+func TestMCPBatch(t *testing.T) {
+	e, _, _ := newTestMCPServer()
+	decodeBatch := func(rec *httptest.ResponseRecorder) []*testMCPResponse {
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var responses []*testMCPResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &responses))
+		return responses
+	}
+
+	// notifications and client responses are not answered
+	responses := decodeBatch(postMCP(e, `[
+		{"jsonrpc":"2.0","id":1,"method":"ping"},
+		{"jsonrpc":"2.0","method":"notifications/initialized"},
+		{"jsonrpc":"2.0","id":"c1","result":{}},
+		{"jsonrpc":"2.0","id":2,"method":"tools/list"}
+	]`, ""))
+	require.Len(t, responses, 2)
+	require.Equal(t, "1", string(responses[0].ID))
+	require.Equal(t, "2", string(responses[1].ID))
+
+	rec := postMCP(e, `[{"jsonrpc":"2.0","method":"notifications/initialized"},{"jsonrpc":"2.0","id":"c1","result":{}}]`, "")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Empty(t, rec.Body.String())
+
+	// invalid messages are answered even without an id
+	responses = decodeBatch(postMCP(e, `[1, {"id":3,"method":"ping"}, {"jsonrpc":"2.0"}]`, ""))
+	require.Len(t, responses, 3)
+	for _, resp := range responses {
+		require.Equal(t, mcpErrInvalidRequest, resp.Error.Code)
+	}
+	require.Equal(t, "3", string(responses[1].ID))
+
+	responses = decodeBatch(postMCP(e, `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","id":2,"method":"unknown"}]`, ""))
+	require.Nil(t, responses[0].Error)
+	require.Equal(t, mcpErrMethodNotFound, responses[1].Error.Code)
+
+	require.Equal(t, http.StatusBadRequest, postMCP(e, `[{"jsonrpc":"2.0","id":1,"method":"initialize"}]`, "").Code)
+	require.Equal(t, http.StatusBadRequest, postMCP(e, `[]`, "").Code)
+}
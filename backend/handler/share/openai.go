@@ -0,0 +1,189 @@
+package share
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+)
+
+const (
+	openAIModelsEndpoint     = "/share/v1/models"
+	openAIEmbeddingsEndpoint = "/share/v1/embeddings"
+)
+
+// OpenAIModels OpenAI API compatible model list
+//
+//	@Summary		OpenAIModels
+//	@Description	OpenAI API compatible model list, the chat and embedding models of the knowledge base
+//	@Tags			share_chat
+//	@Produce		json
+//	@Param			X-KB-ID	header		string	true	"Knowledge Base ID"
+//	@Success		200		{object}	domain.OpenAIModelListResponse
+//	@Failure		400		{object}	domain.OpenAIErrorResponse
+//	@Router			/share/v1/models [get]
+func (h *ShareChatHandler) OpenAIModels(c echo.Context) error {
+	startedAt := time.Now()
+	auditMeta := openAIAuditMeta{
+		KBID:      strings.TrimSpace(c.Request().Header.Get("X-KB-ID")),
+		Endpoint:  openAIModelsEndpoint,
+		RemoteIP:  c.RealIP(),
+		RequestID: h.resolveRequestID(c),
+	}
+	if auditMeta.KBID == "" {
+		return h.sendOpenAIErrorWithAudit(c, auditMeta, "X-KB-ID header is required", "invalid_request_error", startedAt)
+	}
+	if errorType, message := h.authorizeOpenAIRequest(c, &auditMeta, startedAt); errorType != "" {
+		return h.sendOpenAIErrorWithAudit(c, auditMeta, message, errorType, startedAt)
+	}
+
+	ctx := c.Request().Context()
+	resp := domain.OpenAIModelListResponse{
+		Object: "list",
+		Data:   make([]domain.OpenAIModel, 0, 2),
+	}
+	chatModel, err := h.modelUsecase.GetChatModel(ctx)
+	if err != nil {
+		h.logger.Error("get chat model failed", log.Error(err))
+		return h.sendOpenAIErrorWithAudit(c, auditMeta, "chat model is not configured", "internal_error", startedAt)
+	}
+	resp.Data = append(resp.Data, newOpenAIModel(chatModel))
+	if embeddingModel, err := h.modelUsecase.GetModelByType(ctx, domain.ModelTypeEmbedding); err == nil {
+		resp.Data = append(resp.Data, newOpenAIModel(embeddingModel))
+	}
+
+	if err := c.JSON(http.StatusOK, resp); err != nil {
+		h.recordOpenAIAudit(ctx, auditMeta, http.StatusInternalServerError, nil, "internal_error", err.Error(), startedAt)
+		return err
+	}
+	h.recordOpenAIAudit(ctx, auditMeta, http.StatusOK, nil, "", "", startedAt)
+	return nil
+}
+
+// OpenAIEmbeddings OpenAI API compatible embeddings
+//
+//	@Summary		OpenAIEmbeddings
+//	@Description	OpenAI API compatible embeddings, always computed by the embedding model of the knowledge base
+//	@Tags			share_chat
+//	@Accept			json
+//	@Produce		json
+//	@Param			X-KB-ID	header		string							true	"Knowledge Base ID"
+//	@Param			request	body		domain.OpenAIEmbeddingsRequest	true	"OpenAI API request"
+//	@Success		200		{object}	domain.OpenAIEmbeddingsResponse
+//	@Failure		400		{object}	domain.OpenAIErrorResponse
+//	@Router			/share/v1/embeddings [post]
+func (h *ShareChatHandler) OpenAIEmbeddings(c echo.Context) error {
+	startedAt := time.Now()
+	auditMeta := openAIAuditMeta{
+		KBID:      strings.TrimSpace(c.Request().Header.Get("X-KB-ID")),
+		Endpoint:  openAIEmbeddingsEndpoint,
+		RemoteIP:  c.RealIP(),
+		RequestID: h.resolveRequestID(c),
+	}
+
+	var req domain.OpenAIEmbeddingsRequest
+	if err := c.Bind(&req); err != nil {
+		h.logger.Error("parse OpenAI embeddings request failed", log.Error(err))
+		return h.sendOpenAIErrorWithAudit(c, auditMeta, "parse request failed", "invalid_request_error", startedAt)
+	}
+	auditMeta.Model = strings.TrimSpace(req.Model)
+	if auditMeta.KBID == "" {
+		return h.sendOpenAIErrorWithAudit(c, auditMeta, "X-KB-ID header is required", "invalid_request_error", startedAt)
+	}
+	if err := c.Validate(&req); err != nil {
+		h.logger.Error("validate OpenAI embeddings request failed", log.Error(err))
+		return h.sendOpenAIErrorWithAudit(c, auditMeta, "validate request failed", "invalid_request_error", startedAt)
+	}
+	if message := validateEmbeddingsInput(req.Input); message != "" {
+		return h.sendOpenAIErrorWithAudit(c, auditMeta, message, "invalid_request_error", startedAt)
+	}
+	if errorType, message := h.authorizeOpenAIRequest(c, &auditMeta, startedAt); errorType != "" {
+		return h.sendOpenAIErrorWithAudit(c, auditMeta, message, errorType, startedAt)
+	}
+
+	ctx := c.Request().Context()
+	vectors, model, promptTokens, err := h.modelUsecase.Embed(ctx, req.Input)
+	if err != nil {
+		h.logger.Error("embed OpenAI embeddings input failed", log.Error(err))
+		if errors.Is(err, domain.ErrEmbeddingModelNotConfigured) {
+			return h.sendOpenAIErrorWithAudit(c, auditMeta, err.Error(), "internal_error", startedAt)
+		}
+		return h.sendOpenAIErrorWithAudit(c, auditMeta, "embedding failed", "internal_error", startedAt)
+	}
+	if req.Dimensions != nil && len(vectors) > 0 && *req.Dimensions != len(vectors[0]) {
+		message := fmt.Sprintf("dimensions must be %d for the embedding model", len(vectors[0]))
+		return h.sendOpenAIErrorWithAudit(c, auditMeta, message, "invalid_request_error", startedAt)
+	}
+
+	usage := &domain.OpenAIUsage{PromptTokens: promptTokens, TotalTokens: promptTokens}
+	resp := domain.OpenAIEmbeddingsResponse{
+		Object: "list",
+		Data:   make([]domain.OpenAIEmbedding, 0, len(vectors)),
+		Model:  model.Model,
+		Usage:  domain.OpenAIEmbeddingsUsage{PromptTokens: promptTokens, TotalTokens: promptTokens},
+	}
+	for i, vector := range vectors {
+		embedding := domain.OpenAIEmbedding{Object: "embedding", Index: i, Embedding: vector}
+		if req.EncodingFormat == "base64" {
+			embedding.Embedding = encodeEmbeddingBase64(vector)
+		}
+		resp.Data = append(resp.Data, embedding)
+	}
+	if err := c.JSON(http.StatusOK, resp); err != nil {
+		h.recordOpenAIAudit(ctx, auditMeta, http.StatusInternalServerError, usage, "internal_error", err.Error(), startedAt)
+		return err
+	}
+	h.recordOpenAIAudit(ctx, auditMeta, http.StatusOK, usage, "", "", startedAt)
+	return nil
+}
+
+func validateEmbeddingsInput(input domain.EmbeddingsInput) string {
+	if len(input) == 0 {
+		return "input cannot be empty"
+	}
+	if len(input) > domain.OpenAIEmbeddingsMaxInputs {
+		return fmt.Sprintf("input cannot have more than %d items", domain.OpenAIEmbeddingsMaxInputs)
+	}
+	for _, text := range input {
+		if strings.TrimSpace(text) == "" {
+			return "input cannot contain empty strings"
+		}
+	}
+	return ""
+}
+
+func newOpenAIModel(model *domain.Model) domain.OpenAIModel {
+	ownedBy := string(model.Provider)
+	if ownedBy == "" {
+		ownedBy = "panda-wiki"
+	}
+	openAIModel := domain.OpenAIModel{
+		ID:      model.Model,
+		Object:  "model",
+		OwnedBy: ownedBy,
+	}
+	// models of the auto mode are not stored
+	if !model.CreatedAt.IsZero() {
+		openAIModel.Created = model.CreatedAt.Unix()
+	}
+	return openAIModel
+}
+
+// encodeEmbeddingBase64 packs the vector as little-endian float32s, the layout the OpenAI
+// clients decode.
+func encodeEmbeddingBase64(vector []float32) string {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,30 @@
+package share
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeEmbeddingBase64(t *testing.T) {
+	vector := []float32{0.5, -1.25, 3}
+	data, err := base64.StdEncoding.DecodeString(encodeEmbeddingBase64(vector))
+	require.NoError(t, err)
+	require.Len(t, data, 12)
+	for i, v := range vector {
+		require.Equal(t, v, math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:])))
+	}
+}
+
+func TestValidateEmbeddingsInput(t *testing.T) {
+	require.Equal(t, "", validateEmbeddingsInput(domain.EmbeddingsInput{"hello", "world"}))
+	require.Contains(t, validateEmbeddingsInput(nil), "empty")
+	require.Contains(t, validateEmbeddingsInput(domain.EmbeddingsInput{"hello", " "}), "empty strings")
+	tooMany := strings.Split(strings.Repeat("a,", domain.OpenAIEmbeddingsMaxInputs), ",")
+	require.Contains(t, validateEmbeddingsInput(tooMany), "more than")
+}
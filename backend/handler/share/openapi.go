@@ -15,6 +15,7 @@ import (
 	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/handler"
 	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/pkg/bot/slack"
 	"github.com/chaitin/panda-wiki/usecase"
 )
 
@@ -42,10 +43,16 @@ func NewOpenapiV1Handler(
 	OpenapiGroup := e.Group("/share/v1/openapi")
 
 	OpenapiGroup.Any("/github/callback", h.GitHubCallback)
+	OpenapiGroup.GET("/oidc/callback", h.OIDCCallback)
+	OpenapiGroup.GET("/saml/:kb_id/metadata", h.SAMLMetadata)
+	OpenapiGroup.POST("/saml/:kb_id/acs", h.SAMLACS)
 
 	// lark机器人
 	OpenapiGroup.POST("/lark/bot/:kb_id", h.LarkBot)
 
+	// slack机器人
+	OpenapiGroup.POST("/slack/bot/:kb_id", h.SlackBot)
+
 	return h
 }
 
@@ -83,6 +90,101 @@ func (h *OpenapiV1Handler) GitHubCallback(c echo.Context) error {
 	return c.Redirect(http.StatusFound, redirectUrl)
 }
 
+// OIDCCallback OIDC回调
+//
+//	@Tags			ShareOpenapi
+//	@Summary		OIDC回调
+//	@Description	OIDC回调
+//	@ID				v1-OIDCCallback
+//	@Accept			json
+//	@Produce		json
+//	@Param			param	query		v1.OIDCCallbackReq	true	"para"
+//	@Success		302
+//	@Router			/share/v1/openapi/oidc/callback [get]
+func (h *OpenapiV1Handler) OIDCCallback(c echo.Context) error {
+	ctx := context.WithValue(c.Request().Context(), consts.ContextKeyEdition, consts.GetLicenseEdition(c))
+
+	var req v1.OIDCCallbackReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if req.Code == "" {
+		return h.NewResponseWithError(c, "code is required", nil)
+	}
+
+	auth, redirectUrl, err := h.authUseCase.OIDCCallback(ctx, req)
+	if err != nil {
+		return h.NewResponseWithError(c, "handle callback failed", err)
+	}
+
+	if err := h.authUseCase.SaveNewSession(c, auth); err != nil {
+		return h.NewResponseWithError(c, "save session failed", err)
+	}
+
+	return c.Redirect(http.StatusFound, redirectUrl)
+}
+
+// SAMLMetadata SAML SP元数据
+//
+//	@Tags			ShareOpenapi
+//	@Summary		SAML SP元数据
+//	@Description	SAML SP元数据，用于在IdP中注册
+//	@ID				v1-SAMLMetadata
+//	@Produce		xml
+//	@Param			kb_id	path	string	true	"知识库ID"
+//	@Success		200
+//	@Router			/share/v1/openapi/saml/{kb_id}/metadata [get]
+func (h *OpenapiV1Handler) SAMLMetadata(c echo.Context) error {
+	var req v1.SAMLMetadataReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	metadata, err := h.authUseCase.GetSAMLMetadata(c.Request().Context(), req.KbID)
+	if err != nil {
+		return h.NewResponseWithError(c, "get saml metadata failed", err)
+	}
+	return c.Blob(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// SAMLACS SAML断言消费服务
+//
+//	@Tags			ShareOpenapi
+//	@Summary		SAML断言消费服务
+//	@Description	接收IdP以HTTP-POST绑定发送的SAMLResponse
+//	@ID				v1-SAMLACS
+//	@Accept			x-www-form-urlencoded
+//	@Param			kb_id			path		string	true	"知识库ID"
+//	@Param			SAMLResponse	formData	string	true	"SAMLResponse"
+//	@Param			RelayState		formData	string	true	"RelayState"
+//	@Success		302
+//	@Router			/share/v1/openapi/saml/{kb_id}/acs [post]
+func (h *OpenapiV1Handler) SAMLACS(c echo.Context) error {
+	ctx := context.WithValue(c.Request().Context(), consts.ContextKeyEdition, consts.GetLicenseEdition(c))
+
+	var req v1.SAMLACSReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	auth, redirectUrl, err := h.authUseCase.SAMLCallback(ctx, req)
+	if err != nil {
+		return h.NewResponseWithError(c, "handle saml response failed", err)
+	}
+
+	if err := h.authUseCase.SaveNewSession(c, auth); err != nil {
+		return h.NewResponseWithError(c, "save session failed", err)
+	}
+
+	return c.Redirect(http.StatusFound, redirectUrl)
+}
+
 // LarkBot Lark机器人请求
 //
 //	@Tags			ShareOpenapi
@@ -155,3 +257,58 @@ func (h *OpenapiV1Handler) LarkBot(c echo.Context) error {
 
 	return c.JSONBlob(eventResp.StatusCode, eventResp.Body)
 }
+
+// SlackBot Slack机器人请求
+//
+//	@Tags			ShareOpenapi
+//	@Summary		Slack机器人请求
+//	@Description	Slack Events API 回调
+//	@ID				v1-SlackBot
+//	@Accept			json
+//	@Produce		json
+//	@Param			kb_id	path		string	true	"知识库ID"
+//	@Success		200		{object}	slack.EventResponse
+//	@Router			/share/v1/openapi/slack/bot/{kb_id} [post]
+func (h *OpenapiV1Handler) SlackBot(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	kbID := c.Param("kb_id")
+	if kbID == "" {
+		h.logger.Error("kb_id is required")
+		return h.NewResponseWithError(c, "kb_id is required", nil)
+	}
+
+	appInfo, err := h.appCase.GetAppDetailByKBIDAndAppType(ctx, kbID, domain.AppTypeSlackBot)
+	if err != nil {
+		h.logger.Error("failed to get app detail", log.Error(err), log.String("kb_id", kbID))
+		return h.NewResponseWithError(c, "failed to get app detail", err)
+	}
+
+	if appInfo.Settings.SlackBotSettings.IsEnabled == nil || !*appInfo.Settings.SlackBotSettings.IsEnabled {
+		h.logger.Error("slack bot is not enabled")
+		return h.NewResponseWithError(c, "slack bot is not enabled", nil)
+	}
+
+	client, ok := h.appCase.GetSlackBotClient(appInfo.ID)
+	if !ok {
+		h.logger.Error("slack bot is not running", log.String("kb_id", kbID))
+		return h.NewResponseWithError(c, "slack bot is not running", nil)
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		h.logger.Error("failed to read request body", log.Error(err))
+		return h.NewResponseWithError(c, "failed to read request body", err)
+	}
+	defer c.Request().Body.Close()
+
+	resp, err := client.HandleEvent(c.Request().Header, body)
+	if err != nil {
+		if errors.Is(err, slack.ErrInvalidSignature) {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		h.logger.Error("failed to handle slack event", log.Error(err))
+		return c.NoContent(http.StatusBadRequest)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
@@ -19,6 +19,7 @@ type ShareHandler struct {
 	ShareWechatHandler       *ShareWechatHandler
 	ShareCaptchaHandler      *ShareCaptchaHandler
 	ShareMCPHandler          *ShareMCPHandler
+	ShareSCIMHandler         *ShareSCIMHandler
 	OpenapiV1Handler         *OpenapiV1Handler
 	ShareCommonHandler       *ShareCommonHandler
 }
@@ -38,6 +39,7 @@ var ProviderSet = wire.NewSet(
 	NewShareWechatHandler,
 	NewShareCaptchaHandler,
 	NewShareMCPHandler,
+	NewShareSCIMHandler,
 	NewShareCommonHandler,
 	NewOpenapiV1Handler,
 
@@ -0,0 +1,457 @@
+package share
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/handler"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/pkg/scim"
+	"github.com/chaitin/panda-wiki/repo/pg"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+const (
+	scimKBIDKey      = "scim_kb_id"
+	scimMaxBodySize  = 1 << 20
+	scimDocumentsURI = "https://datatracker.ietf.org/doc/html/rfc7644"
+)
+
+// ShareSCIMHandler serves the SCIM 2.0 endpoints an IdP provisions the readers and auth
+// groups of a kb with. It authenticates with an api token of the kb with the scim scope.
+type ShareSCIMHandler struct {
+	*handler.BaseHandler
+	logger    *log.Logger
+	usecase   *usecase.SCIMUsecase
+	tokenRepo *pg.APITokenRepo
+}
+
+func NewShareSCIMHandler(
+	e *echo.Echo,
+	baseHandler *handler.BaseHandler,
+	logger *log.Logger,
+	scimUsecase *usecase.SCIMUsecase,
+	tokenRepo *pg.APITokenRepo,
+) *ShareSCIMHandler {
+	h := &ShareSCIMHandler{
+		BaseHandler: baseHandler,
+		logger:      logger.WithModule("handler.share.scim"),
+		usecase:     scimUsecase,
+		tokenRepo:   tokenRepo,
+	}
+
+	group := e.Group(usecase.SCIMPath, h.authorize)
+	group.GET("/ServiceProviderConfig", h.ServiceProviderConfig)
+	group.GET("/ResourceTypes", h.ResourceTypes)
+
+	group.GET("/Users", h.ListUsers)
+	group.POST("/Users", h.CreateUser)
+	group.GET("/Users/:id", h.GetUser)
+	group.PUT("/Users/:id", h.ReplaceUser)
+	group.PATCH("/Users/:id", h.PatchUser)
+	group.DELETE("/Users/:id", h.DeleteUser)
+
+	group.GET("/Groups", h.ListGroups)
+	group.POST("/Groups", h.CreateGroup)
+	group.GET("/Groups/:id", h.GetGroup)
+	group.PUT("/Groups/:id", h.ReplaceGroup)
+	group.PATCH("/Groups/:id", h.PatchGroup)
+	group.DELETE("/Groups/:id", h.DeleteGroup)
+	return h
+}
+
+// authorize accepts the bearer api tokens with the scim scope, the kb of the token is the
+// kb provisioned.
+func (h *ShareSCIMHandler) authorize(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token, ok := strings.CutPrefix(strings.TrimSpace(c.Request().Header.Get("Authorization")), "Bearer ")
+		token = strings.TrimSpace(token)
+		if !ok || token == "" {
+			return h.scimError(c, scim.NewError(http.StatusUnauthorized, "", "bearer token is required"))
+		}
+		apiToken, err := h.tokenRepo.GetByTokenWithCache(c.Request().Context(), token)
+		if err != nil {
+			h.logger.Error("get api token for scim failed", log.Error(err))
+			return h.scimError(c, err)
+		}
+		if apiToken == nil {
+			return h.scimError(c, scim.NewError(http.StatusUnauthorized, "", "invalid token"))
+		}
+		if kbID := c.Request().Header.Get("X-KB-ID"); kbID != "" && kbID != apiToken.KbId {
+			return h.scimError(c, scim.NewError(http.StatusUnauthorized, "", "the token belongs to another knowledge base"))
+		}
+		if !apiToken.HasScope(consts.APITokenScopeSCIM) {
+			return h.scimError(c, scim.NewError(http.StatusForbidden, "", "the token has no scim scope"))
+		}
+		c.Set(scimKBIDKey, apiToken.KbId)
+		return next(c)
+	}
+}
+
+func (h *ShareSCIMHandler) kbID(c echo.Context) string {
+	kbID, _ := c.Get(scimKBIDKey).(string)
+	return kbID
+}
+
+// context carries the license edition, readers provisioned count in its limit.
+func (h *ShareSCIMHandler) context(c echo.Context) context.Context {
+	return context.WithValue(c.Request().Context(), consts.ContextKeyEdition, consts.GetLicenseEdition(c))
+}
+
+func (h *ShareSCIMHandler) respond(c echo.Context, status int, data any) error {
+	c.Response().Header().Set(echo.HeaderContentType, scim.ContentType)
+	return c.JSON(status, data)
+}
+
+func (h *ShareSCIMHandler) scimError(c echo.Context, err error) error {
+	var scimErr *scim.Error
+	if !errors.As(err, &scimErr) {
+		h.logger.Error("scim request failed", log.String("path", c.Request().URL.Path), log.Error(err))
+		scimErr = scim.NewError(http.StatusInternalServerError, "", "internal server error")
+	}
+	return h.respond(c, scimErr.StatusCode(), scimErr)
+}
+
+// bind decodes the body, IdPs send application/scim+json which echo does not bind.
+func (h *ShareSCIMHandler) bind(c echo.Context, v any) error {
+	body := io.LimitReader(c.Request().Body, scimMaxBodySize)
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		return scim.NewError(http.StatusBadRequest, scim.ErrorInvalidSyntax, "invalid json body")
+	}
+	return nil
+}
+
+func (h *ShareSCIMHandler) bindListQuery(c echo.Context) (scim.ListQuery, error) {
+	var query scim.ListQuery
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &query); err != nil {
+		return query, scim.NewError(http.StatusBadRequest, scim.ErrorInvalidValue, "invalid query parameters")
+	}
+	return query, nil
+}
+
+func (h *ShareSCIMHandler) bindPatch(c echo.Context) ([]scim.PatchOperation, error) {
+	var req scim.PatchRequest
+	if err := h.bind(c, &req); err != nil {
+		return nil, err
+	}
+	if len(req.Operations) == 0 {
+		return nil, scim.NewError(http.StatusBadRequest, scim.ErrorInvalidSyntax, "Operations are required")
+	}
+	return req.Operations, nil
+}
+
+// ServiceProviderConfig
+//
+//	@Tags			share_scim
+//	@Summary		SCIM ServiceProviderConfig
+//	@Description	SCIM 2.0 service provider configuration
+//	@ID				v1-SCIMServiceProviderConfig
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Success		200
+//	@Router			/share/v1/scim/v2/ServiceProviderConfig [get]
+func (h *ShareSCIMHandler) ServiceProviderConfig(c echo.Context) error {
+	return h.respond(c, http.StatusOK, scim.ServiceProviderConfig(scimDocumentsURI))
+}
+
+// ResourceTypes
+//
+//	@Tags			share_scim
+//	@Summary		SCIM ResourceTypes
+//	@Description	SCIM 2.0 resource types, Users and Groups
+//	@ID				v1-SCIMResourceTypes
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Success		200
+//	@Router			/share/v1/scim/v2/ResourceTypes [get]
+func (h *ShareSCIMHandler) ResourceTypes(c echo.Context) error {
+	baseURL, err := h.usecase.BaseURL(c.Request().Context(), h.kbID(c))
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	resourceTypes := scim.ResourceTypes(baseURL)
+	resources := make([]any, 0, len(resourceTypes))
+	for _, resourceType := range resourceTypes {
+		resources = append(resources, resourceType)
+	}
+	return h.respond(c, http.StatusOK, scim.ListResponse{
+		Schemas:      []string{scim.SchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// ListUsers
+//
+//	@Tags			share_scim
+//	@Summary		SCIM ListUsers
+//	@Description	List the readers of the kb, with SCIM filters and pagination
+//	@ID				v1-SCIMListUsers
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	query		scim.ListQuery	false	"list query"
+//	@Success		200		{object}	scim.ListResponse
+//	@Router			/share/v1/scim/v2/Users [get]
+func (h *ShareSCIMHandler) ListUsers(c echo.Context) error {
+	query, err := h.bindListQuery(c)
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	resp, err := h.usecase.ListUsers(c.Request().Context(), h.kbID(c), query)
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	return h.respond(c, http.StatusOK, resp)
+}
+
+// GetUser
+//
+//	@Tags			share_scim
+//	@Summary		SCIM GetUser
+//	@Description	Get a reader of the kb
+//	@ID				v1-SCIMGetUser
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			id	path		string	true	"user id"
+//	@Success		200	{object}	scim.User
+//	@Router			/share/v1/scim/v2/Users/{id} [get]
+func (h *ShareSCIMHandler) GetUser(c echo.Context) error {
+	user, err := h.usecase.GetUser(c.Request().Context(), h.kbID(c), c.Param("id"))
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	return h.respond(c, http.StatusOK, user)
+}
+
+// CreateUser
+//
+//	@Tags			share_scim
+//	@Summary		SCIM CreateUser
+//	@Description	Provision a reader of the kb
+//	@ID				v1-SCIMCreateUser
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		scim.User	true	"user"
+//	@Success		201		{object}	scim.User
+//	@Router			/share/v1/scim/v2/Users [post]
+func (h *ShareSCIMHandler) CreateUser(c echo.Context) error {
+	var req scim.User
+	if err := h.bind(c, &req); err != nil {
+		return h.scimError(c, err)
+	}
+	user, err := h.usecase.CreateUser(h.context(c), h.kbID(c), &req)
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	return h.respond(c, http.StatusCreated, user)
+}
+
+// ReplaceUser
+//
+//	@Tags			share_scim
+//	@Summary		SCIM ReplaceUser
+//	@Description	Replace a reader of the kb, an inactive reader is logged out at once
+//	@ID				v1-SCIMReplaceUser
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			id		path		string		true	"user id"
+//	@Param			body	body		scim.User	true	"user"
+//	@Success		200		{object}	scim.User
+//	@Router			/share/v1/scim/v2/Users/{id} [put]
+func (h *ShareSCIMHandler) ReplaceUser(c echo.Context) error {
+	var req scim.User
+	if err := h.bind(c, &req); err != nil {
+		return h.scimError(c, err)
+	}
+	user, err := h.usecase.ReplaceUser(c.Request().Context(), h.kbID(c), c.Param("id"), &req)
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	return h.respond(c, http.StatusOK, user)
+}
+
+// PatchUser
+//
+//	@Tags			share_scim
+//	@Summary		SCIM PatchUser
+//	@Description	Patch a reader of the kb, an inactive reader is logged out at once
+//	@ID				v1-SCIMPatchUser
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			id		path		string				true	"user id"
+//	@Param			body	body		scim.PatchRequest	true	"patch operations"
+//	@Success		200		{object}	scim.User
+//	@Router			/share/v1/scim/v2/Users/{id} [patch]
+func (h *ShareSCIMHandler) PatchUser(c echo.Context) error {
+	operations, err := h.bindPatch(c)
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	user, err := h.usecase.PatchUser(c.Request().Context(), h.kbID(c), c.Param("id"), operations)
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	return h.respond(c, http.StatusOK, user)
+}
+
+// DeleteUser
+//
+//	@Tags			share_scim
+//	@Summary		SCIM DeleteUser
+//	@Description	Deprovision a reader of the kb, the reader is logged out at once
+//	@ID				v1-SCIMDeleteUser
+//	@Security		bearerAuth
+//	@Param			id	path	string	true	"user id"
+//	@Success		204
+//	@Router			/share/v1/scim/v2/Users/{id} [delete]
+func (h *ShareSCIMHandler) DeleteUser(c echo.Context) error {
+	if err := h.usecase.DeleteUser(c.Request().Context(), h.kbID(c), c.Param("id")); err != nil {
+		return h.scimError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListGroups
+//
+//	@Tags			share_scim
+//	@Summary		SCIM ListGroups
+//	@Description	List the auth groups provisioned over SCIM, with SCIM filters and pagination
+//	@ID				v1-SCIMListGroups
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	query		scim.ListQuery	false	"list query"
+//	@Success		200		{object}	scim.ListResponse
+//	@Router			/share/v1/scim/v2/Groups [get]
+func (h *ShareSCIMHandler) ListGroups(c echo.Context) error {
+	query, err := h.bindListQuery(c)
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	resp, err := h.usecase.ListGroups(c.Request().Context(), h.kbID(c), query)
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	return h.respond(c, http.StatusOK, resp)
+}
+
+// GetGroup
+//
+//	@Tags			share_scim
+//	@Summary		SCIM GetGroup
+//	@Description	Get an auth group provisioned over SCIM
+//	@ID				v1-SCIMGetGroup
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			id	path		string	true	"group id"
+//	@Success		200	{object}	scim.Group
+//	@Router			/share/v1/scim/v2/Groups/{id} [get]
+func (h *ShareSCIMHandler) GetGroup(c echo.Context) error {
+	group, err := h.usecase.GetGroup(c.Request().Context(), h.kbID(c), c.Param("id"))
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	return h.respond(c, http.StatusOK, group)
+}
+
+// CreateGroup
+//
+//	@Tags			share_scim
+//	@Summary		SCIM CreateGroup
+//	@Description	Provision an auth group of the kb
+//	@ID				v1-SCIMCreateGroup
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		scim.Group	true	"group"
+//	@Success		201		{object}	scim.Group
+//	@Router			/share/v1/scim/v2/Groups [post]
+func (h *ShareSCIMHandler) CreateGroup(c echo.Context) error {
+	var req scim.Group
+	if err := h.bind(c, &req); err != nil {
+		return h.scimError(c, err)
+	}
+	group, err := h.usecase.CreateGroup(c.Request().Context(), h.kbID(c), &req)
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	return h.respond(c, http.StatusCreated, group)
+}
+
+// ReplaceGroup
+//
+//	@Tags			share_scim
+//	@Summary		SCIM ReplaceGroup
+//	@Description	Replace an auth group provisioned over SCIM with its members
+//	@ID				v1-SCIMReplaceGroup
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			id		path		string		true	"group id"
+//	@Param			body	body		scim.Group	true	"group"
+//	@Success		200		{object}	scim.Group
+//	@Router			/share/v1/scim/v2/Groups/{id} [put]
+func (h *ShareSCIMHandler) ReplaceGroup(c echo.Context) error {
+	var req scim.Group
+	if err := h.bind(c, &req); err != nil {
+		return h.scimError(c, err)
+	}
+	group, err := h.usecase.ReplaceGroup(c.Request().Context(), h.kbID(c), c.Param("id"), &req)
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	return h.respond(c, http.StatusOK, group)
+}
+
+// PatchGroup
+//
+//	@Tags			share_scim
+//	@Summary		SCIM PatchGroup
+//	@Description	Patch an auth group provisioned over SCIM, such as adding and removing members
+//	@ID				v1-SCIMPatchGroup
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			id		path		string				true	"group id"
+//	@Param			body	body		scim.PatchRequest	true	"patch operations"
+//	@Success		200		{object}	scim.Group
+//	@Router			/share/v1/scim/v2/Groups/{id} [patch]
+func (h *ShareSCIMHandler) PatchGroup(c echo.Context) error {
+	operations, err := h.bindPatch(c)
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	group, err := h.usecase.PatchGroup(c.Request().Context(), h.kbID(c), c.Param("id"), operations)
+	if err != nil {
+		return h.scimError(c, err)
+	}
+	return h.respond(c, http.StatusOK, group)
+}
+
+// DeleteGroup
+//
+//	@Tags			share_scim
+//	@Summary		SCIM DeleteGroup
+//	@Description	Delete an auth group provisioned over SCIM with its node permissions
+//	@ID				v1-SCIMDeleteGroup
+//	@Security		bearerAuth
+//	@Param			id	path	string	true	"group id"
+//	@Success		204
+//	@Router			/share/v1/scim/v2/Groups/{id} [delete]
+func (h *ShareSCIMHandler) DeleteGroup(c echo.Context) error {
+	if err := h.usecase.DeleteGroup(c.Request().Context(), h.kbID(c), c.Param("id")); err != nil {
+		return h.scimError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -1,6 +1,10 @@
 package v1
 
 import (
+	"fmt"
+	"net/http"
+	"net/url"
+
 	"github.com/labstack/echo/v4"
 
 	v1 "github.com/chaitin/panda-wiki/api/conversation/v1"
@@ -31,6 +35,9 @@ func NewConversationHandler(echo *echo.Echo, baseHandler *handler.BaseHandler, l
 	group.GET("/detail", handler.GetConversationDetail)
 	group.GET("/message/list", handler.GetMessageFeedBackList)
 	group.GET("/message/detail", handler.GetMessageDetail)
+	group.GET("/export", handler.ExportConversations)
+	group.GET("/retention", handler.GetRetentionSettings)
+	group.PUT("/retention", handler.UpdateRetentionSettings, handler.auth.ValidateKBUserPerm(consts.UserKBPermissionFullControl))
 
 	return handler
 }
@@ -142,3 +149,88 @@ func (h *ConversationHandler) GetMessageDetail(c echo.Context) error {
 
 	return h.NewResponseWithData(c, message)
 }
+
+// ExportConversations
+//
+//	@Summary		ExportConversations
+//	@Description	Download the conversations matching the list filters with their messages, feedback and references as jsonl or csv
+//	@Tags			conversation
+//	@Produce		octet-stream
+//	@Security		bearerAuth
+//	@Param			req	query		domain.ConversationExportReq	true	"conversation export request"
+//	@Success		200	{file}		file
+//	@Router			/api/v1/conversation/export [get]
+func (h *ConversationHandler) ExportConversations(c echo.Context) error {
+	var req domain.ConversationExportReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "validate request failed", err)
+	}
+	if req.Format == "" {
+		req.Format = domain.ConversationExportFormatJSONL
+	}
+
+	contentType := "application/x-ndjson"
+	if req.Format == domain.ConversationExportFormatCSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+	filename := fmt.Sprintf("conversations-%s.%s", req.KBID, req.Format)
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(filename)))
+	c.Response().WriteHeader(http.StatusOK)
+	if err := h.usecase.ExportConversations(c.Request().Context(), &req, c.Response()); err != nil {
+		// the headers are gone already, the client gets a truncated file
+		h.logger.Error("export conversations failed", log.String("kb_id", req.KBID), log.Error(err))
+	}
+	return nil
+}
+
+// GetRetentionSettings
+//
+//	@Summary		GetRetentionSettings
+//	@Description	Get the conversation retention policy of a knowledge base
+//	@Tags			conversation
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			kb_id	query		string	true	"knowledge base ID"
+//	@Success		200		{object}	domain.PWResponse{data=domain.ConversationRetentionSettings}
+//	@Router			/api/v1/conversation/retention [get]
+func (h *ConversationHandler) GetRetentionSettings(c echo.Context) error {
+	kbID := c.QueryParam("kb_id")
+	if kbID == "" {
+		return h.NewResponseWithError(c, "kb_id is required", nil)
+	}
+	settings, err := h.usecase.GetRetentionSettings(c.Request().Context(), kbID)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get conversation retention settings", err)
+	}
+	return h.NewResponseWithData(c, settings)
+}
+
+// UpdateRetentionSettings
+//
+//	@Summary		UpdateRetentionSettings
+//	@Description	Delete or anonymize the conversations without messages in the last days, applied daily
+//	@Tags			conversation
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.UpdateConversationRetentionReq	true	"retention settings"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/v1/conversation/retention [put]
+func (h *ConversationHandler) UpdateRetentionSettings(c echo.Context) error {
+	var req domain.UpdateConversationRetentionReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "validate request failed", err)
+	}
+	if err := h.usecase.UpdateRetentionSettings(c.Request().Context(), req.KBID, &req.ConversationRetentionSettings); err != nil {
+		return h.NewResponseWithError(c, "failed to update conversation retention settings", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
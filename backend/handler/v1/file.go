@@ -9,6 +9,7 @@ import (
 	"github.com/labstack/echo/v4"
 
 	"github.com/chaitin/panda-wiki/config"
+	"github.com/chaitin/panda-wiki/consts"
 	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/handler"
 	"github.com/chaitin/panda-wiki/log"
@@ -35,8 +36,8 @@ func NewFileHandler(echo *echo.Echo, baseHandler *handler.BaseHandler, logger *l
 		fileUsecase: fileUsecase,
 	}
 	group := echo.Group("/api/v1/file")
-	group.POST("/upload", h.Upload, h.auth.Authorize)
-	group.POST("/upload/url", h.UploadByUrl, h.auth.Authorize)
+	group.POST("/upload", h.Upload, h.auth.AuthorizeWithTokenScope(consts.APITokenScopeNodeWrite))
+	group.POST("/upload/url", h.UploadByUrl, h.auth.AuthorizeWithTokenScope(consts.APITokenScopeNodeWrite))
 	group.POST("/upload/anydoc", h.UploadAnydoc)
 	return h
 }
@@ -0,0 +1,189 @@
+package v1
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/handler"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/middleware"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+type GitSyncHandler struct {
+	*handler.BaseHandler
+	logger  *log.Logger
+	auth    middleware.AuthMiddleware
+	usecase *usecase.GitSyncUsecase
+}
+
+func NewGitSyncHandler(e *echo.Echo, baseHandler *handler.BaseHandler, logger *log.Logger, auth middleware.AuthMiddleware,
+	usecase *usecase.GitSyncUsecase) *GitSyncHandler {
+	h := &GitSyncHandler{
+		BaseHandler: baseHandler,
+		logger:      logger.WithModule("handler.v1.git_sync"),
+		auth:        auth,
+		usecase:     usecase,
+	}
+
+	group := e.Group("/api/pro/v1/git_sync", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionFullControl))
+	group.GET("/settings", h.GetGitSyncSettings)
+	group.PUT("/settings", h.UpdateGitSyncSettings)
+	group.POST("/import", h.ImportGitRepository)
+	group.POST("/export", h.ExportGitRepository)
+	group.GET("/run/list", h.GetGitSyncRunList)
+
+	return h
+}
+
+// GetGitSyncSettings
+//
+//	@Summary		GetGitSyncSettings
+//	@Description	Get git sync settings of a knowledge base, the token is never returned
+//	@Tags			git_sync
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			kb_id	query		string	true	"knowledge base ID"
+//	@Success		200		{object}	domain.PWResponse{data=domain.GitSyncSettingsResp}
+//	@Router			/api/pro/v1/git_sync/settings [get]
+func (h *GitSyncHandler) GetGitSyncSettings(c echo.Context) error {
+	kbID := c.QueryParam("kb_id")
+	if kbID == "" {
+		return h.NewResponseWithError(c, "kb_id is required", nil)
+	}
+
+	settings, err := h.usecase.GetSettings(c.Request().Context(), kbID)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get git sync settings", err)
+	}
+	return h.NewResponseWithData(c, settings)
+}
+
+// UpdateGitSyncSettings
+//
+//	@Summary		UpdateGitSyncSettings
+//	@Description	Update git sync settings, an empty token keeps the saved one
+//	@Tags			git_sync
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	body		domain.UpdateGitSyncSettingsReq	true	"Update Git Sync Settings Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/pro/v1/git_sync/settings [put]
+func (h *GitSyncHandler) UpdateGitSyncSettings(c echo.Context) error {
+	var req domain.UpdateGitSyncSettingsReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.UpdateSettings(c.Request().Context(), &req); err != nil {
+		return h.NewResponseWithError(c, "failed to update git sync settings", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// ImportGitRepository
+//
+//	@Summary		ImportGitRepository
+//	@Description	Pull the git repository into the knowledge base and return the per-file diff
+//	@Tags			git_sync
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	body		domain.GitSyncImportReq	true	"Git Sync Import Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.GitSyncRun}
+//	@Router			/api/pro/v1/git_sync/import [post]
+func (h *GitSyncHandler) ImportGitRepository(c echo.Context) error {
+	ctx := c.Request().Context()
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return h.NewResponseWithError(c, "authInfo not found in context", nil)
+	}
+
+	var req domain.GitSyncImportReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	run, err := h.usecase.Import(ctx, req.KBID, domain.GitSyncTriggerManual, authInfo.UserId)
+	if err != nil {
+		if errors.Is(err, domain.ErrGitSyncRunning) {
+			return h.NewResponseWithError(c, err.Error(), nil)
+		}
+		return h.NewResponseWithError(c, "failed to import git repository", err)
+	}
+	return h.NewResponseWithData(c, run)
+}
+
+// ExportGitRepository
+//
+//	@Summary		ExportGitRepository
+//	@Description	Commit a knowledge base release to the git repository and return the per-file diff
+//	@Tags			git_sync
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	body		domain.GitSyncExportReq	true	"Git Sync Export Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.GitSyncRun}
+//	@Router			/api/pro/v1/git_sync/export [post]
+func (h *GitSyncHandler) ExportGitRepository(c echo.Context) error {
+	var req domain.GitSyncExportReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	run, err := h.usecase.Export(c.Request().Context(), req.KBID, req.ReleaseID, domain.GitSyncTriggerManual)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return h.NewResponseWithError(c, "release not found", nil)
+		}
+		if errors.Is(err, domain.ErrGitSyncRunning) {
+			return h.NewResponseWithError(c, err.Error(), nil)
+		}
+		return h.NewResponseWithError(c, "failed to export git repository", err)
+	}
+	return h.NewResponseWithData(c, run)
+}
+
+type GitSyncRunList = domain.PaginatedResult[[]*domain.GitSyncRun]
+
+// GetGitSyncRunList
+//
+//	@Summary		GetGitSyncRunList
+//	@Description	List git sync runs, newest first
+//	@Tags			git_sync
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			req	query		domain.GitSyncRunListReq	true	"GitSyncRunListReq"
+//	@Success		200	{object}	domain.PWResponse{data=GitSyncRunList}
+//	@Router			/api/pro/v1/git_sync/run/list [get]
+func (h *GitSyncHandler) GetGitSyncRunList(c echo.Context) error {
+	var req domain.GitSyncRunListReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	runs, err := h.usecase.ListRuns(c.Request().Context(), &req)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get git sync run list", err)
+	}
+	return h.NewResponseWithData(c, runs)
+}
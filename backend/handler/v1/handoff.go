@@ -0,0 +1,169 @@
+package v1
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/handler"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/middleware"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+type HandoffHandler struct {
+	*handler.BaseHandler
+	logger  *log.Logger
+	auth    middleware.AuthMiddleware
+	usecase *usecase.HandoffUsecase
+}
+
+func NewHandoffHandler(e *echo.Echo, baseHandler *handler.BaseHandler, logger *log.Logger, auth middleware.AuthMiddleware,
+	usecase *usecase.HandoffUsecase) *HandoffHandler {
+	h := &HandoffHandler{
+		BaseHandler: baseHandler,
+		logger:      logger.WithModule("handler.v1.handoff"),
+		auth:        auth,
+		usecase:     usecase,
+	}
+
+	group := e.Group("/api/pro/v1/handoff", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionDataOperate))
+	group.GET("/list", h.GetHandoffList)
+	group.GET("/detail", h.GetHandoffDetail)
+	group.POST("/reply", h.ReplyHandoff)
+	group.POST("/release", h.ReleaseHandoff)
+
+	return h
+}
+
+// GetHandoffList
+//
+//	@Summary		GetHandoffList
+//	@Description	List the bot conversations handed off to human agents
+//	@Tags			handoff
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.HandoffListReq	true	"Handoff List Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.HandoffListResp}
+//	@Router			/api/pro/v1/handoff/list [get]
+func (h *HandoffHandler) GetHandoffList(c echo.Context) error {
+	var req domain.HandoffListReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	resp, err := h.usecase.List(c.Request().Context(), &req)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get handoff list", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+// GetHandoffDetail
+//
+//	@Summary		GetHandoffDetail
+//	@Description	Get a handoff with the messages exchanged since it started
+//	@Tags			handoff
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.HandoffReq	true	"Handoff Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.HandoffDetailResp}
+//	@Router			/api/pro/v1/handoff/detail [get]
+func (h *HandoffHandler) GetHandoffDetail(c echo.Context) error {
+	var req domain.HandoffReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	resp, err := h.usecase.Detail(c.Request().Context(), req.KBID, req.ID)
+	if err != nil {
+		return h.handoffError(c, "failed to get handoff", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+// ReplyHandoff
+//
+//	@Summary		ReplyHandoff
+//	@Description	Reply to a handed off user through the bot they talk to
+//	@Tags			handoff
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.HandoffReplyReq	true	"Handoff Reply Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.HandoffMessage}
+//	@Router			/api/pro/v1/handoff/reply [post]
+func (h *HandoffHandler) ReplyHandoff(c echo.Context) error {
+	ctx := c.Request().Context()
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return h.NewResponseWithError(c, "authInfo not found in context", nil)
+	}
+
+	var req domain.HandoffReplyReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	message, err := h.usecase.Reply(ctx, &req, authInfo.UserId)
+	if err != nil {
+		return h.handoffError(c, "failed to reply handoff", err)
+	}
+	return h.NewResponseWithData(c, message)
+}
+
+// ReleaseHandoff
+//
+//	@Summary		ReleaseHandoff
+//	@Description	Hand a handed off user back to the AI
+//	@Tags			handoff
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.HandoffReq	true	"Handoff Request"
+//	@Success		200		{object}	domain.PWResponse
+//	@Router			/api/pro/v1/handoff/release [post]
+func (h *HandoffHandler) ReleaseHandoff(c echo.Context) error {
+	ctx := c.Request().Context()
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return h.NewResponseWithError(c, "authInfo not found in context", nil)
+	}
+
+	var req domain.HandoffReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.Release(ctx, req.KBID, req.ID, authInfo.UserId); err != nil {
+		return h.handoffError(c, "failed to release handoff", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+func (h *HandoffHandler) handoffError(c echo.Context, msg string, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return h.NewResponseWithErrCode(c, domain.ErrCodeNotFound)
+	case errors.Is(err, domain.ErrHandoffReleased), errors.Is(err, domain.ErrHandoffNoSender):
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+	return h.NewResponseWithError(c, msg, err)
+}
@@ -0,0 +1,187 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/handler"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/middleware"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+type KBArchiveHandler struct {
+	*handler.BaseHandler
+	logger    *log.Logger
+	auth      middleware.AuthMiddleware
+	usecase   *usecase.KBArchiveUsecase
+	kbUsecase *usecase.KnowledgeBaseUsecase
+}
+
+func NewKBArchiveHandler(e *echo.Echo, baseHandler *handler.BaseHandler, logger *log.Logger, auth middleware.AuthMiddleware,
+	usecase *usecase.KBArchiveUsecase, kbUsecase *usecase.KnowledgeBaseUsecase) *KBArchiveHandler {
+	h := &KBArchiveHandler{
+		BaseHandler: baseHandler,
+		logger:      logger.WithModule("handler.v1.kb_archive"),
+		auth:        auth,
+		usecase:     usecase,
+		kbUsecase:   kbUsecase,
+	}
+
+	group := e.Group("/api/pro/v1/kb_archive", h.auth.Authorize)
+	group.GET("/export", h.ExportKB, h.auth.ValidateKBUserPerm(consts.UserKBPermissionFullControl))
+	group.POST("/import", h.ImportKB, h.auth.ValidateUserRole(consts.UserRoleAdmin))
+	group.GET("/import/job", h.GetKBImportJob, h.auth.ValidateUserRole(consts.UserRoleAdmin))
+
+	return h
+}
+
+// ExportKB
+//
+//	@Summary		ExportKB
+//	@Description	Download a knowledge base as a zip archive
+//	@Tags			kb_archive
+//	@Produce		application/zip
+//	@Security		bearerAuth
+//	@Param			kb_id	query		string	true	"knowledge base ID"
+//	@Success		200		{file}		file
+//	@Router			/api/pro/v1/kb_archive/export [get]
+func (h *KBArchiveHandler) ExportKB(c echo.Context) error {
+	kbID := c.QueryParam("kb_id")
+	if kbID == "" {
+		return h.NewResponseWithError(c, "kb_id is required", nil)
+	}
+
+	filename := fmt.Sprintf("panda-wiki-%s.zip", kbID)
+	c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(filename)))
+	c.Response().WriteHeader(http.StatusOK)
+	if err := h.usecase.Export(c.Request().Context(), kbID, c.Response()); err != nil {
+		// the headers are gone already, the client gets a truncated archive
+		h.logger.Error("export kb failed", log.String("kb_id", kbID), log.Error(err))
+	}
+	return nil
+}
+
+// ImportKB
+//
+//	@Summary		ImportKB
+//	@Description	Import a knowledge base archive as a new knowledge base or into an existing one, returns the import job
+//	@Tags			kb_archive
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			file		formData	file		true	"archive"
+//	@Param			mode		formData	string		true	"new or merge"
+//	@Param			kb_id		formData	string		false	"target knowledge base ID, merge mode"
+//	@Param			name		formData	string		false	"knowledge base name, new mode"
+//	@Param			hosts		formData	[]string	false	"knowledge base hosts, new mode"
+//	@Param			ports		formData	[]int		false	"knowledge base ports, new mode"
+//	@Param			ssl_ports	formData	[]int		false	"knowledge base ssl ports, new mode"
+//	@Success		200			{object}	domain.PWResponse{data=domain.KBImportJob}
+//	@Router			/api/pro/v1/kb_archive/import [post]
+func (h *KBArchiveHandler) ImportKB(c echo.Context) error {
+	ctx := c.Request().Context()
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return h.NewResponseWithError(c, "authInfo not found in context", nil)
+	}
+
+	var req domain.KBImportReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get file", err)
+	}
+	src, err := file.Open()
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to open file", err)
+	}
+	defer src.Close()
+
+	manifest, err := h.usecase.ReadManifest(src, file.Size)
+	if err != nil {
+		return h.NewResponseWithError(c, "invalid archive", err)
+	}
+
+	kbID := req.KBID
+	switch req.Mode {
+	case domain.KBImportModeNew:
+		createReq := &domain.CreateKnowledgeBaseReq{
+			Name:     lo.CoalesceOrEmpty(req.Name, manifest.KBName),
+			Hosts:    lo.Uniq(req.Hosts),
+			Ports:    lo.Uniq(req.Ports),
+			SSLPorts: lo.Uniq(req.SSLPorts),
+			MaxKB:    domain.GetBaseEditionLimitation(ctx).MaxKb,
+		}
+		if len(createReq.Hosts) == 0 {
+			return h.NewResponseWithError(c, "hosts is required", nil)
+		}
+		if len(createReq.Ports)+len(createReq.SSLPorts) == 0 {
+			return h.NewResponseWithError(c, "ports is required", nil)
+		}
+		if kbID, err = h.kbUsecase.CreateKnowledgeBase(ctx, createReq); err != nil {
+			if errors.Is(err, domain.ErrPortHostAlreadyExists) {
+				return h.NewResponseWithError(c, "端口或域名已被其他知识库占用", nil)
+			}
+			if errors.Is(err, domain.ErrSyncCaddyConfigFailed) {
+				return h.NewResponseWithError(c, "保存配置失败，请检查端口或证书配置", nil)
+			}
+			return h.NewResponseWithError(c, "failed to create knowledge base", err)
+		}
+	case domain.KBImportModeMerge:
+		if _, err := h.kbUsecase.GetKnowledgeBase(ctx, kbID); err != nil {
+			return h.NewResponseWithError(c, "knowledge base not found", err)
+		}
+	}
+
+	job, err := h.usecase.CreateImportJob(ctx, kbID, req.Mode, authInfo.UserId, io.NewSectionReader(src, 0, file.Size), file.Size)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to create import job", err)
+	}
+	return h.NewResponseWithData(c, job)
+}
+
+// GetKBImportJob
+//
+//	@Summary		GetKBImportJob
+//	@Description	Get the status and progress of a knowledge base import job
+//	@Tags			kb_archive
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			id	query		string	true	"import job ID"
+//	@Success		200	{object}	domain.PWResponse{data=domain.KBImportJob}
+//	@Router			/api/pro/v1/kb_archive/import/job [get]
+func (h *KBArchiveHandler) GetKBImportJob(c echo.Context) error {
+	var req domain.KBImportJobReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	job, err := h.usecase.GetImportJob(c.Request().Context(), req.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return h.NewResponseWithError(c, "import job not found", nil)
+		}
+		return h.NewResponseWithError(c, "failed to get import job", err)
+	}
+	return h.NewResponseWithData(c, job)
+}
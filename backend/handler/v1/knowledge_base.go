@@ -43,22 +43,23 @@ func NewKnowledgeBaseHandler(
 		auth:          auth,
 	}
 
-	group := echo.Group("/api/v1/knowledge_base", h.auth.Authorize)
-	group.POST("", h.CreateKnowledgeBase, h.auth.ValidateUserRole(consts.UserRoleAdmin))
-	group.GET("/list", h.GetKnowledgeBaseList)
-	group.GET("/detail", h.GetKnowledgeBaseDetail, h.auth.ValidateKBUserPerm(consts.UserKBPermissionNotNull))
-	group.PUT("/detail", h.UpdateKnowledgeBase, h.auth.ValidateKBUserPerm(consts.UserKBPermissionFullControl))
-	group.DELETE("/detail", h.DeleteKnowledgeBase, h.auth.ValidateUserRole(consts.UserRoleAdmin))
+	// the release apis let in api tokens, every other one is authorized for users only
+	group := echo.Group("/api/v1/knowledge_base")
+	group.POST("", h.CreateKnowledgeBase, h.auth.Authorize, h.auth.ValidateUserRole(consts.UserRoleAdmin))
+	group.GET("/list", h.GetKnowledgeBaseList, h.auth.Authorize)
+	group.GET("/detail", h.GetKnowledgeBaseDetail, h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionNotNull))
+	group.PUT("/detail", h.UpdateKnowledgeBase, h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionFullControl))
+	group.DELETE("/detail", h.DeleteKnowledgeBase, h.auth.Authorize, h.auth.ValidateUserRole(consts.UserRoleAdmin))
 
 	// user management
-	userGroup := group.Group("/user", h.auth.ValidateKBUserPerm(consts.UserKBPermissionFullControl))
+	userGroup := group.Group("/user", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionFullControl))
 	userGroup.GET("/list", h.KBUserList)
 	userGroup.POST("/invite", h.KBUserInvite)
 	userGroup.PATCH("/update", h.KBUserUpdate)
 	userGroup.DELETE("/delete", h.KBUserDelete)
 
 	// release
-	releaseGroup := group.Group("/release", h.auth.ValidateKBUserPerm(consts.UserKBPermissionDocManage))
+	releaseGroup := group.Group("/release", h.auth.AuthorizeWithTokenScope(consts.APITokenScopePublish), h.auth.ValidateKBUserPerm(consts.UserKBPermissionDocManage))
 	releaseGroup.POST("", h.CreateKBRelease)
 	releaseGroup.POST("/rollback", h.RollbackKBRelease)
 	releaseGroup.GET("/list", h.GetKBReleaseList)
@@ -72,11 +73,14 @@ func NewKnowledgeBaseHandler(
 	promptGroup.GET("/version/detail", h.GetPromptVersionDetail)
 	promptGroup.POST("/version/rollback", h.RollbackPromptVersion)
 
+	// tokens are managed from the admin console only, a token can not mint or widen tokens
 	tokenGroup := echo.Group("/api/pro/v1/token", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionFullControl))
 	tokenGroup.POST("/create", h.CreateAPIToken)
 	tokenGroup.GET("/list", h.GetAPITokenList)
 	tokenGroup.PATCH("/update", h.UpdateAPIToken)
 	tokenGroup.DELETE("/delete", h.DeleteAPIToken)
+	tokenGroup.POST("/rotate", h.RotateAPIToken)
+	tokenGroup.GET("/usage", h.GetAPITokenUsage)
 
 	contributeGroup := echo.Group("/api/pro/v1/contribute", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionDataOperate))
 	contributeGroup.GET("/list", h.GetContributeList)
@@ -87,6 +91,10 @@ func NewKnowledgeBaseHandler(
 	blockGroup.GET("", h.GetBlockWords)
 	blockGroup.POST("", h.CreateBlockWords)
 
+	retrievalGroup := echo.Group("/api/pro/v1/retrieval", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionFullControl))
+	retrievalGroup.GET("", h.GetRetrievalSettings)
+	retrievalGroup.PUT("", h.UpdateRetrievalSettings)
+
 	return h
 }
 
@@ -301,6 +309,62 @@ func (h *KnowledgeBaseHandler) CreateBlockWords(c echo.Context) error {
 	return h.NewResponseWithData(c, nil)
 }
 
+// GetRetrievalSettings
+//
+//	@Summary		Get retrieval settings
+//	@Description	Get hybrid retrieval fusion weights of a knowledge base
+//	@Tags			retrieval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			kb_id	query		string	true	"knowledge base ID"
+//	@Success		200		{object}	domain.PWResponse{data=domain.RetrievalSettings}
+//	@Router			/api/pro/v1/retrieval [get]
+func (h *KnowledgeBaseHandler) GetRetrievalSettings(c echo.Context) error {
+	kbID := c.QueryParam("kb_id")
+	if kbID == "" {
+		return h.NewResponseWithError(c, "kb id is required", nil)
+	}
+
+	settings, err := h.llmUsecase.GetRetrievalSettings(c.Request().Context(), kbID)
+	if err != nil {
+		return h.NewResponseWithError(c, "get retrieval settings failed", err)
+	}
+
+	return h.NewResponseWithData(c, settings)
+}
+
+// UpdateRetrievalSettings
+//
+//	@Summary		Update retrieval settings
+//	@Description	Update hybrid retrieval fusion weights of a knowledge base
+//	@Tags			retrieval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	body		domain.UpdateRetrievalSettingsReq	true	"retrieval settings"
+//	@Success		200		{object}	domain.PWResponse{data=domain.RetrievalSettings}
+//	@Router			/api/pro/v1/retrieval [put]
+func (h *KnowledgeBaseHandler) UpdateRetrievalSettings(c echo.Context) error {
+	var req domain.UpdateRetrievalSettingsReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	settings, err := h.llmUsecase.UpdateRetrievalSettings(c.Request().Context(), &req)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRetrievalWeights) {
+			return h.NewResponseWithError(c, err.Error(), nil)
+		}
+		return h.NewResponseWithError(c, "update retrieval settings failed", err)
+	}
+
+	return h.NewResponseWithData(c, settings)
+}
+
 // GetPromptSettings
 //
 //	@Summary		get prompt settings
@@ -576,6 +640,62 @@ func (h *KnowledgeBaseHandler) DeleteAPIToken(c echo.Context) error {
 	return h.NewResponseWithData(c, nil)
 }
 
+// RotateAPIToken
+//
+//	@Summary		轮换API Token
+//	@Description	生成新的Token值，旧Token在重叠期内仍可使用，需要full_control权限
+//	@Tags			ApiToken
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.RotateAPITokenReq	true	"Rotate API Token Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.APITokenListItem}
+//	@Router			/api/pro/v1/token/rotate [post]
+func (h *KnowledgeBaseHandler) RotateAPIToken(c echo.Context) error {
+	var req domain.RotateAPITokenReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	item, err := h.usecase.RotateAPIToken(c.Request().Context(), &req)
+	if err != nil {
+		return h.NewResponseWithError(c, "rotate api token failed", err)
+	}
+
+	return h.NewResponseWithData(c, item)
+}
+
+// GetAPITokenUsage
+//
+//	@Summary		API Token用量
+//	@Description	按天或按月统计API Token的调用次数和模型Token用量，按Token、接口和模型分组
+//	@Tags			ApiToken
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	query		domain.APITokenUsageReq	true	"API Token Usage Request"
+//	@Success		200		{object}	domain.PWResponse{data=[]domain.APITokenUsageItem}
+//	@Router			/api/pro/v1/token/usage [get]
+func (h *KnowledgeBaseHandler) GetAPITokenUsage(c echo.Context) error {
+	var req domain.APITokenUsageReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	items, err := h.usecase.GetAPITokenUsage(c.Request().Context(), &req)
+	if err != nil {
+		return h.NewResponseWithError(c, "get api token usage failed", err)
+	}
+
+	return h.NewResponseWithData(c, items)
+}
+
 // DeleteKnowledgeBase
 //
 //	@Summary		DeleteKnowledgeBase
@@ -627,6 +747,9 @@ func (h *KnowledgeBaseHandler) CreateKBRelease(c echo.Context) error {
 
 	id, err := h.usecase.CreateKBRelease(ctx, req, authInfo.UserId)
 	if err != nil {
+		if errors.Is(err, domain.ErrNodeReviewRequired) {
+			return h.NewResponseWithError(c, err.Error(), nil)
+		}
 		return h.NewResponseWithError(c, "create kb release failed", err)
 	}
 
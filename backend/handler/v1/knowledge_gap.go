@@ -0,0 +1,173 @@
+package v1
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/handler"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/middleware"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+type KnowledgeGapHandler struct {
+	*handler.BaseHandler
+	logger  *log.Logger
+	auth    middleware.AuthMiddleware
+	usecase *usecase.KnowledgeGapUsecase
+}
+
+func NewKnowledgeGapHandler(e *echo.Echo, baseHandler *handler.BaseHandler, logger *log.Logger, auth middleware.AuthMiddleware,
+	usecase *usecase.KnowledgeGapUsecase) *KnowledgeGapHandler {
+	h := &KnowledgeGapHandler{
+		BaseHandler: baseHandler,
+		logger:      logger.WithModule("handler.v1.knowledge_gap"),
+		auth:        auth,
+		usecase:     usecase,
+	}
+
+	group := e.Group("/api/pro/v1/knowledge_gap", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionDataOperate))
+	group.POST("/report", h.CreateKnowledgeGapReport)
+	group.GET("/report/list", h.GetKnowledgeGapReportList)
+	group.GET("/report/detail", h.GetKnowledgeGapReportDetail)
+
+	// drafts are documents, so they need document management instead
+	draftGroup := e.Group("/api/pro/v1/knowledge_gap", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionDocManage))
+	draftGroup.POST("/draft", h.CreateKnowledgeGapDraft)
+
+	return h
+}
+
+// CreateKnowledgeGapReport
+//
+//	@Summary		CreateKnowledgeGapReport
+//	@Description	Start a knowledge gap report over the recent user questions of a kb
+//	@Tags			knowledge_gap
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.CreateKnowledgeGapReportReq	true	"Create Knowledge Gap Report Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.KnowledgeGapReport}
+//	@Router			/api/pro/v1/knowledge_gap/report [post]
+func (h *KnowledgeGapHandler) CreateKnowledgeGapReport(c echo.Context) error {
+	ctx := c.Request().Context()
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return h.NewResponseWithError(c, "authInfo not found in context", nil)
+	}
+
+	var req domain.CreateKnowledgeGapReportReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	report, err := h.usecase.CreateReport(ctx, &req, authInfo.UserId)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to create knowledge gap report", err)
+	}
+	return h.NewResponseWithData(c, report)
+}
+
+// GetKnowledgeGapReportList
+//
+//	@Summary		GetKnowledgeGapReportList
+//	@Description	List the knowledge gap reports of a kb
+//	@Tags			knowledge_gap
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.KnowledgeGapReportListReq	true	"Knowledge Gap Report List Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.KnowledgeGapReportListResp}
+//	@Router			/api/pro/v1/knowledge_gap/report/list [get]
+func (h *KnowledgeGapHandler) GetKnowledgeGapReportList(c echo.Context) error {
+	var req domain.KnowledgeGapReportListReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	resp, err := h.usecase.ListReports(c.Request().Context(), &req)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get knowledge gap report list", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+// GetKnowledgeGapReportDetail
+//
+//	@Summary		GetKnowledgeGapReportDetail
+//	@Description	Get a knowledge gap report with its gaps ranked by score
+//	@Tags			knowledge_gap
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.KnowledgeGapReportDetailReq	true	"Knowledge Gap Report Detail Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.KnowledgeGapReportDetailResp}
+//	@Router			/api/pro/v1/knowledge_gap/report/detail [get]
+func (h *KnowledgeGapHandler) GetKnowledgeGapReportDetail(c echo.Context) error {
+	var req domain.KnowledgeGapReportDetailReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	resp, err := h.usecase.GetReport(c.Request().Context(), req.KBID, req.ID)
+	if err != nil {
+		return h.knowledgeGapError(c, "failed to get knowledge gap report", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+// CreateKnowledgeGapDraft
+//
+//	@Summary		CreateKnowledgeGapDraft
+//	@Description	Create a draft document from the outline of a knowledge gap
+//	@Tags			knowledge_gap
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.CreateKnowledgeGapDraftReq	true	"Create Knowledge Gap Draft Request"
+//	@Success		200		{object}	domain.PWResponse{data=map[string]string}
+//	@Router			/api/pro/v1/knowledge_gap/draft [post]
+func (h *KnowledgeGapHandler) CreateKnowledgeGapDraft(c echo.Context) error {
+	ctx := c.Request().Context()
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return h.NewResponseWithError(c, "authInfo not found in context", nil)
+	}
+
+	var req domain.CreateKnowledgeGapDraftReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	nodeID, err := h.usecase.CreateDraft(ctx, &req, authInfo.UserId)
+	if err != nil {
+		return h.knowledgeGapError(c, "failed to create knowledge gap draft", err)
+	}
+	return h.NewResponseWithData(c, map[string]string{"id": nodeID})
+}
+
+func (h *KnowledgeGapHandler) knowledgeGapError(c echo.Context, msg string, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return h.NewResponseWithErrCode(c, domain.ErrCodeNotFound)
+	case errors.Is(err, domain.ErrKnowledgeGapDrafted):
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+	return h.NewResponseWithError(c, msg, err)
+}
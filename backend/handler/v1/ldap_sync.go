@@ -0,0 +1,148 @@
+package v1
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/handler"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/middleware"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+type LDAPSyncHandler struct {
+	*handler.BaseHandler
+	logger  *log.Logger
+	auth    middleware.AuthMiddleware
+	usecase *usecase.LDAPSyncUsecase
+}
+
+func NewLDAPSyncHandler(e *echo.Echo, baseHandler *handler.BaseHandler, logger *log.Logger, auth middleware.AuthMiddleware,
+	usecase *usecase.LDAPSyncUsecase) *LDAPSyncHandler {
+	h := &LDAPSyncHandler{
+		BaseHandler: baseHandler,
+		logger:      logger.WithModule("handler.v1.ldap_sync"),
+		auth:        auth,
+		usecase:     usecase,
+	}
+
+	group := e.Group("/api/pro/v1/ldap_sync", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionFullControl))
+	group.GET("/settings", h.GetLDAPSyncSettings)
+	group.PUT("/settings", h.UpdateLDAPSyncSettings)
+	group.POST("/sync", h.SyncLDAPDirectory)
+	group.GET("/run/list", h.GetLDAPSyncRunList)
+
+	return h
+}
+
+// GetLDAPSyncSettings
+//
+//	@Summary		GetLDAPSyncSettings
+//	@Description	Get LDAP sync settings of a knowledge base, the bind password is never returned
+//	@Tags			ldap_sync
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			kb_id	query		string	true	"knowledge base ID"
+//	@Success		200		{object}	domain.PWResponse{data=domain.LDAPSyncSettingsResp}
+//	@Router			/api/pro/v1/ldap_sync/settings [get]
+func (h *LDAPSyncHandler) GetLDAPSyncSettings(c echo.Context) error {
+	kbID := c.QueryParam("kb_id")
+	if kbID == "" {
+		return h.NewResponseWithError(c, "kb_id is required", nil)
+	}
+
+	settings, err := h.usecase.GetSettings(c.Request().Context(), kbID)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get LDAP sync settings", err)
+	}
+	return h.NewResponseWithData(c, settings)
+}
+
+// UpdateLDAPSyncSettings
+//
+//	@Summary		UpdateLDAPSyncSettings
+//	@Description	Update LDAP sync settings, an empty bind password keeps the saved one
+//	@Tags			ldap_sync
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	body		domain.UpdateLDAPSyncSettingsReq	true	"Update LDAP Sync Settings Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/pro/v1/ldap_sync/settings [put]
+func (h *LDAPSyncHandler) UpdateLDAPSyncSettings(c echo.Context) error {
+	var req domain.UpdateLDAPSyncSettingsReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.UpdateSettings(c.Request().Context(), &req); err != nil {
+		return h.NewResponseWithError(c, "failed to update LDAP sync settings", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// SyncLDAPDirectory
+//
+//	@Summary		SyncLDAPDirectory
+//	@Description	Import the LDAP groups and their members into the auth groups and return the diff, a dry run only previews it
+//	@Tags			ldap_sync
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	body		domain.LDAPSyncReq	true	"LDAP Sync Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.LDAPSyncRun}
+//	@Router			/api/pro/v1/ldap_sync/sync [post]
+func (h *LDAPSyncHandler) SyncLDAPDirectory(c echo.Context) error {
+	var req domain.LDAPSyncReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	run, err := h.usecase.Sync(c.Request().Context(), req.KBID, domain.LDAPSyncTriggerManual, req.DryRun)
+	if err != nil {
+		if errors.Is(err, domain.ErrLDAPSyncRunning) {
+			return h.NewResponseWithError(c, err.Error(), nil)
+		}
+		return h.NewResponseWithError(c, "failed to sync LDAP directory", err)
+	}
+	return h.NewResponseWithData(c, run)
+}
+
+type LDAPSyncRunList = domain.PaginatedResult[[]*domain.LDAPSyncRun]
+
+// GetLDAPSyncRunList
+//
+//	@Summary		GetLDAPSyncRunList
+//	@Description	List LDAP sync runs including dry runs, newest first
+//	@Tags			ldap_sync
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			req	query		domain.LDAPSyncRunListReq	true	"LDAPSyncRunListReq"
+//	@Success		200	{object}	domain.PWResponse{data=LDAPSyncRunList}
+//	@Router			/api/pro/v1/ldap_sync/run/list [get]
+func (h *LDAPSyncHandler) GetLDAPSyncRunList(c echo.Context) error {
+	var req domain.LDAPSyncRunListReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	runs, err := h.usecase.ListRuns(c.Request().Context(), &req)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get LDAP sync run list", err)
+	}
+	return h.NewResponseWithData(c, runs)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/labstack/echo/v4"
 
@@ -38,7 +39,8 @@ func NewNodeHandler(
 		auth:        auth,
 	}
 
-	group := echo.Group("/api/v1/node", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionDocManage))
+	group := echo.Group("/api/v1/node", h.auth.AuthorizeWithTokenScopeByMethod(consts.APITokenScopeNodeRead, consts.APITokenScopeNodeWrite),
+		h.auth.ValidateKBUserPerm(consts.UserKBPermissionDocManage))
 	group.GET("/list", h.GetNodeList)
 	group.GET("/list/group/nav", h.NodeListGroupNav)
 	group.GET("/stats", h.NodeStats)
@@ -61,10 +63,12 @@ func NewNodeHandler(
 	group.GET("/permission", h.NodePermission)
 	group.PATCH("/permission/edit", h.NodePermissionEdit)
 
-	proGroup := echo.Group("/api/pro/v1/node", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionDocManage))
+	proGroup := echo.Group("/api/pro/v1/node", h.auth.AuthorizeWithTokenScopeByMethod(consts.APITokenScopeNodeRead, consts.APITokenScopeNodeWrite),
+		h.auth.ValidateKBUserPerm(consts.UserKBPermissionDocManage))
 	proGroup.POST("/translation/auto", h.AutoTranslateNode)
 
-	proReleaseGroup := echo.Group("/api/pro/v1/node/release", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionDocManage))
+	proReleaseGroup := echo.Group("/api/pro/v1/node/release", h.auth.AuthorizeWithTokenScope(consts.APITokenScopePublish),
+		h.auth.ValidateKBUserPerm(consts.UserKBPermissionDocManage))
 	proReleaseGroup.GET("/list", h.GetProNodeReleaseList)
 	proReleaseGroup.GET("/detail", h.GetProNodeReleaseDetail)
 	proReleaseGroup.POST("/rollback", h.RollbackProNodeRelease)
@@ -254,13 +258,13 @@ func (h *NodeHandler) NodeAction(c echo.Context) error {
 // UpdateNodeDetail
 //
 //	@Summary		Update Node Detail
-//	@Description	Update Node Detail
+//	@Description	Update Node Detail, an edit based on an outdated version is merged or fails with code 40009 and the current node
 //	@Tags			node
 //	@Accept			json
 //	@Produce		json
 //	@Security		bearerAuth
 //	@Param			body	body		domain.UpdateNodeReq	true	"Node"
-//	@Success		200		{object}	domain.Response
+//	@Success		200		{object}	domain.PWResponse{data=domain.UpdateNodeResp}
 //	@Router			/api/v1/node/detail [put]
 func (h *NodeHandler) UpdateNodeDetail(c echo.Context) error {
 	ctx := c.Request().Context()
@@ -277,10 +281,23 @@ func (h *NodeHandler) UpdateNodeDetail(c echo.Context) error {
 		return h.NewResponseWithError(c, "validate request body failed", err)
 	}
 
-	if err := h.usecase.Update(ctx, req, authInfo.UserId); err != nil {
+	resp, err := h.usecase.Update(ctx, req, authInfo.UserId)
+	if err != nil {
+		var conflict *domain.NodeConflictError
+		if errors.As(err, &conflict) {
+			return c.JSON(http.StatusOK, domain.PWResponse{
+				Success: false,
+				Message: conflict.Error(),
+				Data:    conflict,
+				Code:    domain.ErrCodeNodeConflict.Code,
+			})
+		}
+		if errors.Is(err, domain.ErrNodeConflict) {
+			return h.NewResponseWithErrCode(c, domain.ErrCodeNodeConflict)
+		}
 		return h.NewResponseWithError(c, "update node detail failed", err)
 	}
-	return h.NewResponseWithData(c, nil)
+	return h.NewResponseWithData(c, resp)
 }
 
 // MoveNode
@@ -0,0 +1,193 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/handler"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/middleware"
+	"github.com/chaitin/panda-wiki/mq"
+	"github.com/chaitin/panda-wiki/mq/types"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+const (
+	nodeCollabWriteWait  = 10 * time.Second
+	nodeCollabPongWait   = 60 * time.Second
+	nodeCollabPingPeriod = nodeCollabPongWait * 9 / 10
+	nodeCollabMaxMessage = 16 << 20
+)
+
+type NodeCollabHandler struct {
+	*handler.BaseHandler
+	logger   *log.Logger
+	auth     middleware.AuthMiddleware
+	usecase  *usecase.NodeCollabUsecase
+	upgrader websocket.Upgrader
+}
+
+func NewNodeCollabHandler(e *echo.Echo, baseHandler *handler.BaseHandler, logger *log.Logger, auth middleware.AuthMiddleware,
+	usecase *usecase.NodeCollabUsecase, consumer mq.MQConsumer) (*NodeCollabHandler, error) {
+	h := &NodeCollabHandler{
+		BaseHandler: baseHandler,
+		logger:      logger.WithModule("handler.v1.node_collab"),
+		auth:        auth,
+		usecase:     usecase,
+	}
+
+	if err := consumer.RegisterHandler(domain.NodeCollabTopic, h.handleNodeCollabEvent); err != nil {
+		return nil, err
+	}
+	go h.usecase.KeepAlive(context.Background())
+
+	group := e.Group("/api/v1/node/collab", nodeCollabTokenFromQuery, h.auth.AuthorizeWithTokenScope(consts.APITokenScopeNodeWrite), h.auth.ValidateKBUserPerm(consts.UserKBPermissionDocManage))
+	group.GET("", h.NodeCollab)
+	group.GET("/presence", h.GetNodeCollabPresence)
+
+	return h, nil
+}
+
+// nodeCollabTokenFromQuery takes the token from the query, browsers can't set headers on websocket requests.
+func nodeCollabTokenFromQuery(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if token := c.QueryParam("token"); token != "" && c.Request().Header.Get("Authorization") == "" {
+			c.Request().Header.Set("Authorization", "Bearer "+token)
+		}
+		return next(c)
+	}
+}
+
+func (h *NodeCollabHandler) handleNodeCollabEvent(ctx context.Context, msg types.Message) error {
+	var event domain.NodeCollabEvent
+	if err := json.Unmarshal(msg.GetData(), &event); err != nil {
+		h.logger.Error("unmarshal node collab event failed", log.Error(err))
+		return nil
+	}
+	h.usecase.HandleEvent(ctx, &event)
+	return nil
+}
+
+// NodeCollab
+//
+//	@Summary		NodeCollab
+//	@Description	Join the collaboration session of a node over websocket. Binary messages are document updates (Yjs sync and awareness) relayed to the other editors as they are, text messages from the server carry the editor list as domain.NodeCollabPresenceMsg. The token may be passed in the query.
+//	@Tags			node
+//	@Security		bearerAuth
+//	@Param			params	query	domain.NodeCollabReq	true	"Node Collab Request"
+//	@Param			token	query	string					false	"auth token"
+//	@Success		101
+//	@Router			/api/v1/node/collab [get]
+func (h *NodeCollabHandler) NodeCollab(c echo.Context) error {
+	ctx := c.Request().Context()
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return h.NewResponseWithError(c, "authInfo not found in context", nil)
+	}
+
+	var req domain.NodeCollabReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	conn, err := h.usecase.Join(ctx, req.KBID, req.ID, authInfo.UserId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return h.NewResponseWithErrCode(c, domain.ErrCodeNotFound)
+		}
+		return h.NewResponseWithError(c, "failed to join node collaboration", err)
+	}
+	defer h.usecase.Leave(context.Background(), conn)
+
+	ws, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// the upgrader already answered the request
+		h.logger.Warn("upgrade node collab connection failed", log.Error(err))
+		return nil
+	}
+	defer ws.Close()
+
+	go h.writeNodeCollab(ws, conn)
+
+	ws.SetReadLimit(nodeCollabMaxMessage)
+	_ = ws.SetReadDeadline(time.Now().Add(nodeCollabPongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(nodeCollabPongWait))
+	})
+	for {
+		messageType, data, err := ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				h.logger.Debug("node collab connection closed", log.String("conn_id", conn.Peer.ConnID), log.Error(err))
+			}
+			return nil
+		}
+		// text messages are reserved for the server
+		if messageType == websocket.BinaryMessage {
+			h.usecase.Relay(ctx, conn, data)
+		}
+	}
+}
+
+func (h *NodeCollabHandler) writeNodeCollab(ws *websocket.Conn, conn *usecase.NodeCollabConn) {
+	ticker := time.NewTicker(nodeCollabPingPeriod)
+	defer func() {
+		ticker.Stop()
+		ws.Close()
+	}()
+	for {
+		select {
+		case frame, ok := <-conn.Send:
+			_ = ws.SetWriteDeadline(time.Now().Add(nodeCollabWriteWait))
+			if !ok {
+				_ = ws.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			messageType := websocket.TextMessage
+			if frame.Binary {
+				messageType = websocket.BinaryMessage
+			}
+			if err := ws.WriteMessage(messageType, frame.Data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = ws.SetWriteDeadline(time.Now().Add(nodeCollabWriteWait))
+			if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// GetNodeCollabPresence
+//
+//	@Summary		GetNodeCollabPresence
+//	@Description	List who is editing a node right now
+//	@Tags			node
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.NodeCollabReq	true	"Node Collab Request"
+//	@Success		200		{object}	domain.PWResponse{data=[]domain.NodeCollabPeer}
+//	@Router			/api/v1/node/collab/presence [get]
+func (h *NodeCollabHandler) GetNodeCollabPresence(c echo.Context) error {
+	var req domain.NodeCollabReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	return h.NewResponseWithData(c, h.usecase.Presence(req.KBID, req.ID))
+}
@@ -0,0 +1,226 @@
+package v1
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/handler"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/middleware"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+type NodeReviewHandler struct {
+	*handler.BaseHandler
+	logger  *log.Logger
+	auth    middleware.AuthMiddleware
+	usecase *usecase.NodeReviewUsecase
+}
+
+func NewNodeReviewHandler(e *echo.Echo, baseHandler *handler.BaseHandler, logger *log.Logger, auth middleware.AuthMiddleware, usecase *usecase.NodeReviewUsecase) *NodeReviewHandler {
+	h := &NodeReviewHandler{
+		BaseHandler: baseHandler,
+		logger:      logger.WithModule("handler.v1.node_review"),
+		auth:        auth,
+		usecase:     usecase,
+	}
+
+	// reviewers of a stage only need doc access, the usecase checks who may act on which stage
+	group := e.Group("/api/pro/v1/node_review", h.auth.AuthorizeWithTokenScope(consts.APITokenScopePublish), h.auth.ValidateKBUserPerm(consts.UserKBPermissionDocManage))
+	group.GET("/settings", h.GetReviewWorkflowSettings)
+	group.PUT("/settings", h.UpdateReviewWorkflowSettings)
+	group.POST("", h.SubmitNodeReview)
+	group.POST("/action", h.NodeReviewAction)
+	group.GET("/list", h.GetNodeReviewList)
+	group.GET("/detail", h.GetNodeReviewDetail)
+
+	return h
+}
+
+// GetReviewWorkflowSettings
+//
+//	@Summary		GetReviewWorkflowSettings
+//	@Description	Get the review workflow of a kb
+//	@Tags			node_review
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			kb_id	query		string	true	"knowledge base ID"
+//	@Success		200		{object}	domain.PWResponse{data=domain.ReviewWorkflowSettings}
+//	@Router			/api/pro/v1/node_review/settings [get]
+func (h *NodeReviewHandler) GetReviewWorkflowSettings(c echo.Context) error {
+	kbID := c.QueryParam("kb_id")
+	if kbID == "" {
+		return h.NewResponseWithError(c, "kb_id is required", nil)
+	}
+
+	settings, err := h.usecase.GetSettings(c.Request().Context(), kbID)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get review workflow settings", err)
+	}
+	return h.NewResponseWithData(c, settings)
+}
+
+// UpdateReviewWorkflowSettings
+//
+//	@Summary		UpdateReviewWorkflowSettings
+//	@Description	Turn the review workflow on or off, limit it to folders and set its stages, requires full control
+//	@Tags			node_review
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.UpdateReviewWorkflowSettingsReq	true	"Review Workflow Settings"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/pro/v1/node_review/settings [put]
+func (h *NodeReviewHandler) UpdateReviewWorkflowSettings(c echo.Context) error {
+	var req domain.UpdateReviewWorkflowSettingsReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.UpdateSettings(c.Request().Context(), req.KBID, &req.ReviewWorkflowSettings); err != nil {
+		return h.nodeReviewError(c, "failed to update review workflow settings", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// SubmitNodeReview
+//
+//	@Summary		SubmitNodeReview
+//	@Description	Submit the draft of a node for review, replacing its open review
+//	@Tags			node_review
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.SubmitNodeReviewReq	true	"Submit Node Review Request"
+//	@Success		200		{object}	domain.PWResponse{data=string}
+//	@Router			/api/pro/v1/node_review [post]
+func (h *NodeReviewHandler) SubmitNodeReview(c echo.Context) error {
+	ctx := c.Request().Context()
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return h.NewResponseWithError(c, "authInfo not found in context", nil)
+	}
+
+	var req domain.SubmitNodeReviewReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	id, err := h.usecase.Submit(ctx, &req, authInfo.UserId)
+	if err != nil {
+		return h.nodeReviewError(c, "failed to submit node review", err)
+	}
+	return h.NewResponseWithData(c, id)
+}
+
+// NodeReviewAction
+//
+//	@Summary		NodeReviewAction
+//	@Description	Approve or reject the current stage of a review, or withdraw it
+//	@Tags			node_review
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.NodeReviewActionReq	true	"Node Review Action Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/pro/v1/node_review/action [post]
+func (h *NodeReviewHandler) NodeReviewAction(c echo.Context) error {
+	ctx := c.Request().Context()
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return h.NewResponseWithError(c, "authInfo not found in context", nil)
+	}
+
+	var req domain.NodeReviewActionReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.Act(ctx, &req, authInfo.UserId); err != nil {
+		return h.nodeReviewError(c, "failed to update node review", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// GetNodeReviewList
+//
+//	@Summary		GetNodeReviewList
+//	@Description	List the reviews of a kb, latest first
+//	@Tags			node_review
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.NodeReviewListReq	true	"Node Review List Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.NodeReviewListResp}
+//	@Router			/api/pro/v1/node_review/list [get]
+func (h *NodeReviewHandler) GetNodeReviewList(c echo.Context) error {
+	var req domain.NodeReviewListReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	resp, err := h.usecase.List(c.Request().Context(), &req)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get node review list", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+// GetNodeReviewDetail
+//
+//	@Summary		GetNodeReviewDetail
+//	@Description	Get a review with the diff against the published node and its history
+//	@Tags			node_review
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.NodeReviewDetailReq	true	"Node Review Detail Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.NodeReviewDetailResp}
+//	@Router			/api/pro/v1/node_review/detail [get]
+func (h *NodeReviewHandler) GetNodeReviewDetail(c echo.Context) error {
+	var req domain.NodeReviewDetailReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	resp, err := h.usecase.Detail(c.Request().Context(), &req)
+	if err != nil {
+		return h.nodeReviewError(c, "failed to get node review detail", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+func (h *NodeReviewHandler) nodeReviewError(c echo.Context, msg string, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return h.NewResponseWithError(c, "node review not found", nil)
+	case errors.Is(err, domain.ErrPermissionDenied),
+		errors.Is(err, domain.ErrNodeReviewNotRequired),
+		errors.Is(err, domain.ErrNodeReviewNothingToDo),
+		errors.Is(err, domain.ErrNodeReviewNotPending),
+		errors.Is(err, domain.ErrNodeReviewNotReviewer),
+		errors.Is(err, domain.ErrNodeReviewSelfApproval):
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+	return h.NewResponseWithError(c, msg, err)
+}
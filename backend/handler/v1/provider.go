@@ -9,19 +9,29 @@ import (
 )
 
 type APIHandlers struct {
-	UserHandler          *UserHandler
-	KnowledgeBaseHandler *KnowledgeBaseHandler
-	NodeHandler          *NodeHandler
-	AppHandler           *AppHandler
-	FileHandler          *FileHandler
-	ModelHandler         *ModelHandler
-	ConversationHandler  *ConversationHandler
-	CrawlerHandler       *CrawlerHandler
-	CreationHandler      *CreationHandler
-	StatHandler          *StatHandler
-	CommentHandler       *CommentHandler
-	AuthV1Handler        *AuthV1Handler
-	NavHandler           *NavHandler
+	UserHandler            *UserHandler
+	KnowledgeBaseHandler   *KnowledgeBaseHandler
+	NodeHandler            *NodeHandler
+	AppHandler             *AppHandler
+	FileHandler            *FileHandler
+	ModelHandler           *ModelHandler
+	ConversationHandler    *ConversationHandler
+	CrawlerHandler         *CrawlerHandler
+	CreationHandler        *CreationHandler
+	StatHandler            *StatHandler
+	CommentHandler         *CommentHandler
+	AuthV1Handler          *AuthV1Handler
+	NavHandler             *NavHandler
+	WebhookHandler         *WebhookHandler
+	GitSyncHandler         *GitSyncHandler
+	KBArchiveHandler       *KBArchiveHandler
+	ReleaseScheduleHandler *ReleaseScheduleHandler
+	NodeReviewHandler      *NodeReviewHandler
+	NodeCollabHandler      *NodeCollabHandler
+	RAGEvalHandler         *RAGEvalHandler
+	KnowledgeGapHandler    *KnowledgeGapHandler
+	HandoffHandler         *HandoffHandler
+	LDAPSyncHandler        *LDAPSyncHandler
 }
 
 var ProviderSet = wire.NewSet(
@@ -42,6 +52,16 @@ var ProviderSet = wire.NewSet(
 	NewCommentHandler,
 	NewAuthV1Handler,
 	NewNavHandler,
+	NewWebhookHandler,
+	NewGitSyncHandler,
+	NewKBArchiveHandler,
+	NewReleaseScheduleHandler,
+	NewNodeReviewHandler,
+	NewNodeCollabHandler,
+	NewRAGEvalHandler,
+	NewKnowledgeGapHandler,
+	NewHandoffHandler,
+	NewLDAPSyncHandler,
 
 	wire.Struct(new(APIHandlers), "*"),
 )
@@ -0,0 +1,364 @@
+package v1
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/handler"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/middleware"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+type RAGEvalHandler struct {
+	*handler.BaseHandler
+	logger  *log.Logger
+	auth    middleware.AuthMiddleware
+	usecase *usecase.RAGEvalUsecase
+}
+
+func NewRAGEvalHandler(e *echo.Echo, baseHandler *handler.BaseHandler, logger *log.Logger, auth middleware.AuthMiddleware,
+	usecase *usecase.RAGEvalUsecase) *RAGEvalHandler {
+	h := &RAGEvalHandler{
+		BaseHandler: baseHandler,
+		logger:      logger.WithModule("handler.v1.rag_eval"),
+		auth:        auth,
+		usecase:     usecase,
+	}
+
+	group := e.Group("/api/pro/v1/rag_eval", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionDataOperate))
+	group.GET("/dataset/list", h.GetRAGEvalDatasetList)
+	group.POST("/dataset", h.CreateRAGEvalDataset)
+	group.PUT("/dataset", h.UpdateRAGEvalDataset)
+	group.DELETE("/dataset", h.DeleteRAGEvalDataset)
+	group.GET("/case/list", h.GetRAGEvalCaseList)
+	group.POST("/case", h.AddRAGEvalCases)
+	group.PUT("/case", h.UpdateRAGEvalCase)
+	group.DELETE("/case", h.DeleteRAGEvalCase)
+	group.POST("/run", h.CreateRAGEvalRun)
+	group.GET("/run/list", h.GetRAGEvalRunList)
+	group.GET("/run/detail", h.GetRAGEvalRunDetail)
+
+	return h
+}
+
+// GetRAGEvalDatasetList
+//
+//	@Summary		GetRAGEvalDatasetList
+//	@Description	List the evaluation datasets of a kb
+//	@Tags			rag_eval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.RAGEvalDatasetListReq	true	"RAG Eval Dataset List Request"
+//	@Success		200		{object}	domain.PWResponse{data=[]domain.RAGEvalDatasetListItem}
+//	@Router			/api/pro/v1/rag_eval/dataset/list [get]
+func (h *RAGEvalHandler) GetRAGEvalDatasetList(c echo.Context) error {
+	var req domain.RAGEvalDatasetListReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	datasets, err := h.usecase.ListDatasets(c.Request().Context(), req.KBID)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get rag eval dataset list", err)
+	}
+	return h.NewResponseWithData(c, datasets)
+}
+
+// CreateRAGEvalDataset
+//
+//	@Summary		CreateRAGEvalDataset
+//	@Description	Create an evaluation dataset, a golden set of questions for the kb
+//	@Tags			rag_eval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.CreateRAGEvalDatasetReq	true	"Create RAG Eval Dataset Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.RAGEvalDataset}
+//	@Router			/api/pro/v1/rag_eval/dataset [post]
+func (h *RAGEvalHandler) CreateRAGEvalDataset(c echo.Context) error {
+	ctx := c.Request().Context()
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return h.NewResponseWithError(c, "authInfo not found in context", nil)
+	}
+
+	var req domain.CreateRAGEvalDatasetReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	dataset, err := h.usecase.CreateDataset(ctx, &req, authInfo.UserId)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to create rag eval dataset", err)
+	}
+	return h.NewResponseWithData(c, dataset)
+}
+
+// UpdateRAGEvalDataset
+//
+//	@Summary		UpdateRAGEvalDataset
+//	@Description	Rename an evaluation dataset
+//	@Tags			rag_eval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.UpdateRAGEvalDatasetReq	true	"Update RAG Eval Dataset Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/pro/v1/rag_eval/dataset [put]
+func (h *RAGEvalHandler) UpdateRAGEvalDataset(c echo.Context) error {
+	var req domain.UpdateRAGEvalDatasetReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.UpdateDataset(c.Request().Context(), &req); err != nil {
+		return h.ragEvalError(c, "failed to update rag eval dataset", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// DeleteRAGEvalDataset
+//
+//	@Summary		DeleteRAGEvalDataset
+//	@Description	Delete an evaluation dataset with its cases and runs
+//	@Tags			rag_eval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.RAGEvalDatasetReq	true	"RAG Eval Dataset Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/pro/v1/rag_eval/dataset [delete]
+func (h *RAGEvalHandler) DeleteRAGEvalDataset(c echo.Context) error {
+	var req domain.RAGEvalDatasetReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.DeleteDataset(c.Request().Context(), req.KBID, req.ID); err != nil {
+		return h.ragEvalError(c, "failed to delete rag eval dataset", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// GetRAGEvalCaseList
+//
+//	@Summary		GetRAGEvalCaseList
+//	@Description	List the cases of an evaluation dataset
+//	@Tags			rag_eval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.RAGEvalCaseListReq	true	"RAG Eval Case List Request"
+//	@Success		200		{object}	domain.PWResponse{data=[]domain.RAGEvalCase}
+//	@Router			/api/pro/v1/rag_eval/case/list [get]
+func (h *RAGEvalHandler) GetRAGEvalCaseList(c echo.Context) error {
+	var req domain.RAGEvalCaseListReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	cases, err := h.usecase.ListCases(c.Request().Context(), req.KBID, req.DatasetID)
+	if err != nil {
+		return h.ragEvalError(c, "failed to get rag eval case list", err)
+	}
+	return h.NewResponseWithData(c, cases)
+}
+
+// AddRAGEvalCases
+//
+//	@Summary		AddRAGEvalCases
+//	@Description	Add cases to an evaluation dataset: a question, the expected answer and the nodes expected to be retrieved
+//	@Tags			rag_eval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.AddRAGEvalCasesReq	true	"Add RAG Eval Cases Request"
+//	@Success		200		{object}	domain.PWResponse{data=[]domain.RAGEvalCase}
+//	@Router			/api/pro/v1/rag_eval/case [post]
+func (h *RAGEvalHandler) AddRAGEvalCases(c echo.Context) error {
+	var req domain.AddRAGEvalCasesReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	cases, err := h.usecase.AddCases(c.Request().Context(), &req)
+	if err != nil {
+		return h.ragEvalError(c, "failed to add rag eval cases", err)
+	}
+	return h.NewResponseWithData(c, cases)
+}
+
+// UpdateRAGEvalCase
+//
+//	@Summary		UpdateRAGEvalCase
+//	@Description	Update an evaluation case
+//	@Tags			rag_eval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.UpdateRAGEvalCaseReq	true	"Update RAG Eval Case Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/pro/v1/rag_eval/case [put]
+func (h *RAGEvalHandler) UpdateRAGEvalCase(c echo.Context) error {
+	var req domain.UpdateRAGEvalCaseReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.UpdateCase(c.Request().Context(), &req); err != nil {
+		return h.ragEvalError(c, "failed to update rag eval case", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// DeleteRAGEvalCase
+//
+//	@Summary		DeleteRAGEvalCase
+//	@Description	Delete an evaluation case
+//	@Tags			rag_eval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.DeleteRAGEvalCaseReq	true	"Delete RAG Eval Case Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/pro/v1/rag_eval/case [delete]
+func (h *RAGEvalHandler) DeleteRAGEvalCase(c echo.Context) error {
+	var req domain.DeleteRAGEvalCaseReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.DeleteCase(c.Request().Context(), req.KBID, req.ID); err != nil {
+		return h.ragEvalError(c, "failed to delete rag eval case", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// CreateRAGEvalRun
+//
+//	@Summary		CreateRAGEvalRun
+//	@Description	Run an evaluation dataset through the chat pipeline in the background, with the current or a saved prompt version and the chat or another model
+//	@Tags			rag_eval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.CreateRAGEvalRunReq	true	"Create RAG Eval Run Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.RAGEvalRun}
+//	@Router			/api/pro/v1/rag_eval/run [post]
+func (h *RAGEvalHandler) CreateRAGEvalRun(c echo.Context) error {
+	ctx := c.Request().Context()
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return h.NewResponseWithError(c, "authInfo not found in context", nil)
+	}
+
+	var req domain.CreateRAGEvalRunReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	run, err := h.usecase.CreateRun(ctx, &req, authInfo.UserId)
+	if err != nil {
+		return h.ragEvalError(c, "failed to create rag eval run", err)
+	}
+	return h.NewResponseWithData(c, run)
+}
+
+// GetRAGEvalRunList
+//
+//	@Summary		GetRAGEvalRunList
+//	@Description	List evaluation runs with their metrics, newest first, to compare prompt versions and models
+//	@Tags			rag_eval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.RAGEvalRunListReq	true	"RAG Eval Run List Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.RAGEvalRunListResp}
+//	@Router			/api/pro/v1/rag_eval/run/list [get]
+func (h *RAGEvalHandler) GetRAGEvalRunList(c echo.Context) error {
+	var req domain.RAGEvalRunListReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	resp, err := h.usecase.ListRuns(c.Request().Context(), &req)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get rag eval run list", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+// GetRAGEvalRunDetail
+//
+//	@Summary		GetRAGEvalRunDetail
+//	@Description	Get an evaluation run with the result of every case
+//	@Tags			rag_eval
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.RAGEvalRunDetailReq	true	"RAG Eval Run Detail Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.RAGEvalRunDetailResp}
+//	@Router			/api/pro/v1/rag_eval/run/detail [get]
+func (h *RAGEvalHandler) GetRAGEvalRunDetail(c echo.Context) error {
+	var req domain.RAGEvalRunDetailReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	resp, err := h.usecase.GetRun(c.Request().Context(), req.KBID, req.ID)
+	if err != nil {
+		return h.ragEvalError(c, "failed to get rag eval run", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+func (h *RAGEvalHandler) ragEvalError(c echo.Context, msg string, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return h.NewResponseWithErrCode(c, domain.ErrCodeNotFound)
+	case errors.Is(err, domain.ErrRAGEvalNoEmbeddingModel),
+		errors.Is(err, domain.ErrRAGEvalPromptVersion),
+		errors.Is(err, domain.ErrRAGEvalNotChatModel):
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+	return h.NewResponseWithError(c, msg, err)
+}
@@ -0,0 +1,189 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/handler"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/middleware"
+	"github.com/chaitin/panda-wiki/mq"
+	"github.com/chaitin/panda-wiki/mq/types"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+type ReleaseScheduleHandler struct {
+	*handler.BaseHandler
+	logger  *log.Logger
+	auth    middleware.AuthMiddleware
+	usecase *usecase.ReleaseScheduleUsecase
+	push    *usecase.PushUsecase
+}
+
+func NewReleaseScheduleHandler(e *echo.Echo, baseHandler *handler.BaseHandler, logger *log.Logger, auth middleware.AuthMiddleware,
+	usecase *usecase.ReleaseScheduleUsecase, push *usecase.PushUsecase, consumer mq.MQConsumer) (*ReleaseScheduleHandler, error) {
+	h := &ReleaseScheduleHandler{
+		BaseHandler: baseHandler,
+		logger:      logger.WithModule("handler.v1.release_schedule"),
+		auth:        auth,
+		usecase:     usecase,
+		push:        push,
+	}
+
+	// schedules are executed by the consumer, the bots run here, so the push comes back over mq
+	if err := consumer.RegisterHandler(domain.KBReleasePushTopic, h.handleKBReleasePush); err != nil {
+		return nil, err
+	}
+
+	group := e.Group("/api/pro/v1/release_schedule", h.auth.AuthorizeWithTokenScope(consts.APITokenScopePublish), h.auth.ValidateKBUserPerm(consts.UserKBPermissionDocManage))
+	group.POST("", h.CreateReleaseSchedule)
+	group.GET("/list", h.GetReleaseScheduleList)
+	group.PUT("", h.UpdateReleaseSchedule)
+	group.DELETE("", h.CancelReleaseSchedule)
+
+	return h, nil
+}
+
+func (h *ReleaseScheduleHandler) handleKBReleasePush(ctx context.Context, msg types.Message) error {
+	var event domain.KBReleasePushEvent
+	if err := json.Unmarshal(msg.GetData(), &event); err != nil {
+		h.logger.Error("unmarshal kb release push event failed", log.Error(err))
+		return nil
+	}
+	go func() {
+		pushCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		h.push.NotifyKBRelease(pushCtx, event.KBID, event.ReleaseID)
+	}()
+	return nil
+}
+
+// CreateReleaseSchedule
+//
+//	@Summary		CreateReleaseSchedule
+//	@Description	Schedule a kb release for publish_at, unpublish_at optionally takes its nodes offline again
+//	@Tags			release_schedule
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.CreateReleaseScheduleReq	true	"Create Release Schedule Request"
+//	@Success		200		{object}	domain.PWResponse{data=string}
+//	@Router			/api/pro/v1/release_schedule [post]
+func (h *ReleaseScheduleHandler) CreateReleaseSchedule(c echo.Context) error {
+	ctx := c.Request().Context()
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return h.NewResponseWithError(c, "authInfo not found in context", nil)
+	}
+
+	var req domain.CreateReleaseScheduleReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	id, err := h.usecase.Create(ctx, &req, authInfo.UserId)
+	if err != nil {
+		return h.releaseScheduleError(c, "failed to create release schedule", err)
+	}
+	return h.NewResponseWithData(c, id)
+}
+
+// GetReleaseScheduleList
+//
+//	@Summary		GetReleaseScheduleList
+//	@Description	List pending release schedules and published ones waiting to expire
+//	@Tags			release_schedule
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			params	query		domain.ReleaseScheduleListReq	true	"Release Schedule List Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.ReleaseScheduleListResp}
+//	@Router			/api/pro/v1/release_schedule/list [get]
+func (h *ReleaseScheduleHandler) GetReleaseScheduleList(c echo.Context) error {
+	var req domain.ReleaseScheduleListReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	resp, err := h.usecase.List(c.Request().Context(), &req)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get release schedule list", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+// UpdateReleaseSchedule
+//
+//	@Summary		UpdateReleaseSchedule
+//	@Description	Reschedule a pending release, or move or drop the expiry of a published one
+//	@Tags			release_schedule
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.UpdateReleaseScheduleReq	true	"Update Release Schedule Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/pro/v1/release_schedule [put]
+func (h *ReleaseScheduleHandler) UpdateReleaseSchedule(c echo.Context) error {
+	var req domain.UpdateReleaseScheduleReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.Update(c.Request().Context(), &req); err != nil {
+		return h.releaseScheduleError(c, "failed to update release schedule", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// CancelReleaseSchedule
+//
+//	@Summary		CancelReleaseSchedule
+//	@Description	Cancel a pending release, or the expiry of a published one
+//	@Tags			release_schedule
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			kb_id	query		string	true	"knowledge base ID"
+//	@Param			id		query		string	true	"release schedule ID"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/pro/v1/release_schedule [delete]
+func (h *ReleaseScheduleHandler) CancelReleaseSchedule(c echo.Context) error {
+	kbID := c.QueryParam("kb_id")
+	id := c.QueryParam("id")
+	if kbID == "" || id == "" {
+		return h.NewResponseWithError(c, "kb_id and id are required", nil)
+	}
+
+	if err := h.usecase.Cancel(c.Request().Context(), kbID, id); err != nil {
+		return h.releaseScheduleError(c, "failed to cancel release schedule", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+func (h *ReleaseScheduleHandler) releaseScheduleError(c echo.Context, msg string, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return h.NewResponseWithError(c, "release schedule not found", nil)
+	case errors.Is(err, domain.ErrReleaseScheduleNotPending),
+		errors.Is(err, domain.ErrReleaseScheduleInvalidAt),
+		errors.Is(err, domain.ErrReleaseScheduleNoNodes):
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+	return h.NewResponseWithError(c, msg, err)
+}
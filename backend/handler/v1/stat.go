@@ -27,7 +27,7 @@ func NewStatHandler(baseHandler *handler.BaseHandler, echo *echo.Echo, usecase *
 		logger:      logger.WithModule("handler.v1.stat"),
 	}
 
-	group := echo.Group("/api/v1/stat", h.auth.Authorize, auth.ValidateKBUserPerm(consts.UserKBPermissionDataOperate))
+	group := echo.Group("/api/v1/stat", auth.AuthorizeWithTokenScope(consts.APITokenScopeStats), auth.ValidateKBUserPerm(consts.UserKBPermissionDataOperate))
 
 	// 实时
 	group.GET("/instant_count", h.GetInstantCount) // instant count (30min, every 1min)
@@ -41,6 +41,7 @@ func NewStatHandler(baseHandler *handler.BaseHandler, echo *echo.Echo, usecase *
 	group.GET("/referer_hosts", h.StatRefererHosts)
 	group.GET("/browsers", h.StatBrowsers)
 	group.GET("/funnel", h.StatFunnel)
+	group.GET("/answer_cache", h.StatAnswerCache)
 	return h
 }
 
@@ -272,6 +273,39 @@ func (h *StatHandler) StatFunnel(c echo.Context) error {
 	return h.NewResponseWithData(c, resp)
 }
 
+// StatAnswerCache 答案缓存统计
+//
+//	@Summary		答案缓存统计
+//	@Description	答案缓存命中率和节省的 token 估算
+//	@Tags			stat
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			para	query		v1.StatAnswerCacheReq	true	"para"
+//	@Success		200		{object}	domain.Response{data=v1.StatAnswerCacheResp}
+//	@Router			/api/v1/stat/answer_cache [get]
+func (h *StatHandler) StatAnswerCache(c echo.Context) error {
+	var req v1.StatAnswerCacheReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request parameters", err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "validation failed", err)
+	}
+
+	if err := h.usecase.ValidateStatDay(req.Day, consts.GetLicenseEdition(c)); err != nil {
+		h.logger.Error("validate stat day failed")
+		return h.NewResponseWithErrCode(c, domain.ErrCodePermissionDenied)
+	}
+
+	resp, err := h.usecase.GetAnswerCacheStat(c.Request().Context(), req.KbID, req.Day)
+	if err != nil {
+		return h.NewResponseWithError(c, "get answer cache stat failed", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
 // GetInstantCount get instant count
 //
 //	@Summary		GetInstantCount
@@ -2,6 +2,7 @@ package v1
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
@@ -40,6 +41,12 @@ func NewUserHandler(e *echo.Echo, baseHandler *handler.BaseHandler, logger *log.
 	}
 	group := e.Group("/api/v1/user")
 	group.POST("/login", h.Login)
+	group.POST("/login/2fa", h.TwoFactorLogin)
+	group.POST("/login/2fa/webauthn/options", h.TwoFactorLoginWebAuthnOptions)
+	group.POST("/login/2fa/totp/setup", h.TwoFactorLoginTOTPSetup)
+	group.POST("/login/2fa/totp/enable", h.TwoFactorLoginTOTPEnable)
+	group.POST("/login/2fa/webauthn/register/options", h.TwoFactorLoginWebAuthnRegisterOptions)
+	group.POST("/login/2fa/webauthn/register", h.TwoFactorLoginWebAuthnRegister)
 
 	group.GET("", h.GetUserInfo, h.auth.Authorize)
 	group.GET("/list", h.ListUsers, h.auth.Authorize)
@@ -47,6 +54,27 @@ func NewUserHandler(e *echo.Echo, baseHandler *handler.BaseHandler, logger *log.
 	group.PUT("/reset_password", h.ResetPassword, h.auth.Authorize, h.auth.ValidateUserRole(consts.UserRoleAdmin))
 	group.DELETE("/delete", h.DeleteUser, h.auth.Authorize, h.auth.ValidateUserRole(consts.UserRoleAdmin))
 
+	group.GET("/sso", h.GetSSOInfo)
+	group.GET("/sso/setting", h.GetSSOSetting, h.auth.Authorize, h.auth.ValidateUserRole(consts.UserRoleAdmin))
+	group.PUT("/sso/setting", h.SetSSOSetting, h.auth.Authorize, h.auth.ValidateUserRole(consts.UserRoleAdmin))
+	group.GET("/sso/login_url", h.GetSSOLoginURL)
+	group.GET("/sso/oauth/callback", h.SSOOAuthCallback)
+	group.GET("/sso/cas/callback", h.SSOCASCallback)
+	group.POST("/sso/exchange", h.ExchangeSSOCode)
+	group.POST("/sso/ldap/login", h.SSOLDAPLogin)
+
+	group.GET("/2fa", h.GetTwoFactorStatus, h.auth.Authorize)
+	group.POST("/2fa/totp/setup", h.SetupTOTP, h.auth.Authorize)
+	group.POST("/2fa/totp/enable", h.EnableTOTP, h.auth.Authorize)
+	group.POST("/2fa/totp/disable", h.DisableTOTP, h.auth.Authorize)
+	group.POST("/2fa/recovery_codes", h.RegenerateRecoveryCodes, h.auth.Authorize)
+	group.POST("/2fa/webauthn/register/options", h.WebAuthnRegisterOptions, h.auth.Authorize)
+	group.POST("/2fa/webauthn/register", h.RegisterWebAuthn, h.auth.Authorize)
+	group.POST("/2fa/webauthn/delete", h.DeleteWebAuthnCredential, h.auth.Authorize)
+	group.GET("/2fa/policy", h.GetTwoFactorPolicy, h.auth.Authorize, h.auth.ValidateUserRole(consts.UserRoleAdmin))
+	group.PUT("/2fa/policy", h.SetTwoFactorPolicy, h.auth.Authorize, h.auth.ValidateUserRole(consts.UserRoleAdmin))
+	group.PUT("/2fa/reset", h.ResetTwoFactor, h.auth.Authorize, h.auth.ValidateUserRole(consts.UserRoleAdmin))
+
 	return h
 }
 
@@ -112,19 +140,25 @@ func (h *UserHandler) Login(c echo.Context) error {
 		return h.NewResponseWithError(c, fmt.Sprintf("账号已被锁定，请 %s 后重试", remaining.String()), nil)
 	}
 
-	token, err := h.usecase.VerifyUserAndGenerateToken(ctx, req)
+	resp, err := h.usecase.VerifyUserAndGenerateToken(ctx, req)
+	if errors.Is(err, domain.ErrPasswordLoginDisabled) {
+		return h.NewResponseWithError(c, "已禁用账号密码登录，请使用单点登录", err)
+	}
 	if err != nil {
 		h.rateLimiter.LockAttempt(ctx, ip)
 		return h.NewResponseWithError(c, "用户名或密码错误", err)
 	}
 
-	go func() {
-		if err := h.rateLimiter.ResetLoginAttempts(context.Background(), ip); err != nil {
-			h.logger.Error("failed to reset login attempts", "error", err, "ip", ip)
-		}
-	}()
+	// the attempts are reset by the 2FA login when a second factor is required
+	if resp.Token != "" {
+		go func() {
+			if err := h.rateLimiter.ResetLoginAttempts(context.Background(), ip); err != nil {
+				h.logger.Error("failed to reset login attempts", "error", err, "ip", ip)
+			}
+		}()
+	}
 
-	return h.NewResponseWithData(c, v1.LoginResp{Token: token})
+	return h.NewResponseWithData(c, resp)
 }
 
 // GetUserInfo
@@ -0,0 +1,210 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	v1 "github.com/chaitin/panda-wiki/api/user/v1"
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+)
+
+// GetSSOInfo
+//
+//	@Summary		GetSSOInfo
+//	@Description	Get the admin SSO info of the login page
+//	@Tags			user
+//	@Produce		json
+//	@Success		200	{object}	domain.PWResponse{data=v1.SSOInfoResp}
+//	@Router			/api/v1/user/sso [get]
+func (h *UserHandler) GetSSOInfo(c echo.Context) error {
+	info, err := h.usecase.GetSSOInfo(c.Request().Context())
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get sso info", err)
+	}
+	return h.NewResponseWithData(c, info)
+}
+
+// GetSSOSetting
+//
+//	@Summary		GetSSOSetting
+//	@Description	Get the admin SSO setting
+//	@Tags			user
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Success		200	{object}	domain.PWResponse{data=domain.AdminSSOSetting}
+//	@Router			/api/v1/user/sso/setting [get]
+func (h *UserHandler) GetSSOSetting(c echo.Context) error {
+	setting, err := h.usecase.GetSSOSetting(c.Request().Context())
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get sso setting", err)
+	}
+	return h.NewResponseWithData(c, setting)
+}
+
+// SetSSOSetting
+//
+//	@Summary		SetSSOSetting
+//	@Description	Set the admin SSO setting
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			body	body		domain.AdminSSOSetting	true	"admin sso setting"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/v1/user/sso/setting [put]
+func (h *UserHandler) SetSSOSetting(c echo.Context) error {
+	var req domain.AdminSSOSetting
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.SetSSOSetting(c.Request().Context(), &req); err != nil {
+		return h.NewResponseWithError(c, "failed to set sso setting", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// GetSSOLoginURL
+//
+//	@Summary		GetSSOLoginURL
+//	@Description	Get the IdP login url of OAuth and CAS admin SSO
+//	@Tags			user
+//	@Produce		json
+//	@Success		200	{object}	domain.PWResponse{data=v1.SSOLoginURLResp}
+//	@Router			/api/v1/user/sso/login_url [get]
+func (h *UserHandler) GetSSOLoginURL(c echo.Context) error {
+	loginURL, err := h.usecase.GenerateSSOLoginURL(c.Request().Context())
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get sso login url", err)
+	}
+	return h.NewResponseWithData(c, v1.SSOLoginURLResp{URL: loginURL})
+}
+
+// SSOOAuthCallback
+//
+//	@Summary		SSOOAuthCallback
+//	@Description	OAuth callback of admin SSO, redirects to the login page with a code to exchange
+//	@Tags			user
+//	@Param			param	query	v1.SSOCallbackReq	true	"callback params"
+//	@Success		302
+//	@Router			/api/v1/user/sso/oauth/callback [get]
+func (h *UserHandler) SSOOAuthCallback(c echo.Context) error {
+	return h.ssoCallback(c, consts.SourceTypeOAuth)
+}
+
+// SSOCASCallback
+//
+//	@Summary		SSOCASCallback
+//	@Description	CAS callback of admin SSO, redirects to the login page with a code to exchange
+//	@Tags			user
+//	@Param			param	query	v1.SSOCallbackReq	true	"callback params"
+//	@Success		302
+//	@Router			/api/v1/user/sso/cas/callback [get]
+func (h *UserHandler) SSOCASCallback(c echo.Context) error {
+	return h.ssoCallback(c, consts.SourceTypeCAS)
+}
+
+func (h *UserHandler) ssoCallback(c echo.Context, sourceType consts.SourceType) error {
+	var req v1.SSOCallbackReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	redirectURL, err := h.usecase.SSOCallback(c.Request().Context(), sourceType, req)
+	if err != nil {
+		return h.ssoLoginError(c, err)
+	}
+	return c.Redirect(http.StatusFound, redirectURL)
+}
+
+// ExchangeSSOCode
+//
+//	@Summary		ExchangeSSOCode
+//	@Description	Exchange the code of an admin SSO callback for the token
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.SSOExchangeReq	true	"code"
+//	@Success		200		{object}	domain.PWResponse{data=v1.LoginResp}
+//	@Router			/api/v1/user/sso/exchange [post]
+func (h *UserHandler) ExchangeSSOCode(c echo.Context) error {
+	var req v1.SSOExchangeReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	token, err := h.usecase.ExchangeSSOCode(c.Request().Context(), req.Code)
+	if err != nil {
+		return h.NewResponseWithError(c, "登录已失效，请重新登录", err)
+	}
+	return h.NewResponseWithData(c, v1.LoginResp{Token: token})
+}
+
+// SSOLDAPLogin
+//
+//	@Summary		SSOLDAPLogin
+//	@Description	Log in to the admin console with an LDAP account
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.SSOLDAPLoginReq	true	"LDAP login request"
+//	@Success		200		{object}	domain.PWResponse{data=v1.LoginResp}
+//	@Router			/api/v1/user/sso/ldap/login [post]
+func (h *UserHandler) SSOLDAPLogin(c echo.Context) error {
+	var req v1.SSOLDAPLoginReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	ctx := c.Request().Context()
+	ip := c.RealIP()
+	locked, remaining := h.rateLimiter.CheckIPLocked(ctx, ip)
+	if locked {
+		h.logger.Warn("IP is locked", "ip", ip, "remaining", remaining)
+		return h.NewResponseWithError(c, fmt.Sprintf("账号已被锁定，请 %s 后重试", remaining.String()), nil)
+	}
+
+	resp, err := h.usecase.LDAPLogin(ctx, req)
+	if errors.Is(err, domain.ErrSSOUserNotAllowed) {
+		return h.ssoLoginError(c, err)
+	}
+	if err != nil {
+		h.rateLimiter.LockAttempt(ctx, ip)
+		return h.NewResponseWithError(c, "用户名或密码错误", err)
+	}
+
+	// the attempts are reset by the 2FA login when a second factor is required
+	if resp.Token != "" {
+		go func() {
+			if err := h.rateLimiter.ResetLoginAttempts(context.Background(), ip); err != nil {
+				h.logger.Error("failed to reset login attempts", "error", err, "ip", ip)
+			}
+		}()
+	}
+
+	return h.NewResponseWithData(c, resp)
+}
+
+func (h *UserHandler) ssoLoginError(c echo.Context, err error) error {
+	if errors.Is(err, domain.ErrSSOUserNotAllowed) {
+		return h.NewResponseWithError(c, "当前账号没有管理后台的访问权限", err)
+	}
+	return h.NewResponseWithError(c, "单点登录失败", err)
+}
@@ -0,0 +1,547 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/labstack/echo/v4"
+
+	v1 "github.com/chaitin/panda-wiki/api/user/v1"
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+)
+
+// TwoFactorLogin
+//
+//	@Summary		TwoFactorLogin
+//	@Description	Complete a password login with its second factor
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.TwoFactorLoginReq	true	"TwoFactorLogin Request"
+//	@Success		200		{object}	domain.Response{data=v1.LoginResp}
+//	@Router			/api/v1/user/login/2fa [post]
+func (h *UserHandler) TwoFactorLogin(c echo.Context) error {
+	var req v1.TwoFactorLoginReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	ctx := c.Request().Context()
+	ip := c.RealIP()
+	if locked, remaining := h.rateLimiter.CheckIPLocked(ctx, ip); locked {
+		h.logger.Warn("IP is locked", "ip", ip, "remaining", remaining)
+		return h.NewResponseWithError(c, fmt.Sprintf("账号已被锁定，请 %s 后重试", remaining.String()), nil)
+	}
+
+	token, err := h.usecase.VerifyTwoFactorAndGenerateToken(ctx, req)
+	if errors.Is(err, domain.ErrTwoFactorChallengeExpired) {
+		return h.NewResponseWithError(c, "登录已过期，请重新登录", err)
+	}
+	if errors.Is(err, domain.ErrInvalidTwoFactorCode) {
+		h.rateLimiter.LockAttempt(ctx, ip)
+		return h.NewResponseWithError(c, "验证码错误", err)
+	}
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to verify second factor", err)
+	}
+
+	go func() {
+		if err := h.rateLimiter.ResetLoginAttempts(context.Background(), ip); err != nil {
+			h.logger.Error("failed to reset login attempts", "error", err, "ip", ip)
+		}
+	}()
+
+	return h.NewResponseWithData(c, v1.LoginResp{Token: token})
+}
+
+// TwoFactorLoginWebAuthnOptions
+//
+//	@Summary		TwoFactorLoginWebAuthnOptions
+//	@Description	Get the options of navigator.credentials.get to complete a password login
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.TwoFactorChallengeReq	true	"TwoFactorLoginWebAuthnOptions Request"
+//	@Success		200		{object}	domain.Response{data=webauthn.RequestOptions}
+//	@Router			/api/v1/user/login/2fa/webauthn/options [post]
+func (h *UserHandler) TwoFactorLoginWebAuthnOptions(c echo.Context) error {
+	var req v1.TwoFactorChallengeReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	options, err := h.usecase.BeginWebAuthnLogin(c.Request().Context(), req.ChallengeToken, webAuthnRPID(c))
+	if errors.Is(err, domain.ErrTwoFactorChallengeExpired) {
+		return h.NewResponseWithError(c, "登录已过期，请重新登录", err)
+	}
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get webauthn options", err)
+	}
+	return h.NewResponseWithData(c, options)
+}
+
+// TwoFactorLoginTOTPSetup
+//
+//	@Summary		TwoFactorLoginTOTPSetup
+//	@Description	Start the TOTP enrollment required by the 2FA policy during a login
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.TwoFactorChallengeReq	true	"TwoFactorLoginTOTPSetup Request"
+//	@Success		200		{object}	domain.Response{data=v1.TOTPSetupResp}
+//	@Router			/api/v1/user/login/2fa/totp/setup [post]
+func (h *UserHandler) TwoFactorLoginTOTPSetup(c echo.Context) error {
+	var req v1.TwoFactorChallengeReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	resp, err := h.usecase.LoginBeginTOTPSetup(c.Request().Context(), req.ChallengeToken)
+	if errors.Is(err, domain.ErrTwoFactorChallengeExpired) {
+		return h.NewResponseWithError(c, "登录已过期，请重新登录", err)
+	}
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to setup totp", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+// TwoFactorLoginTOTPEnable
+//
+//	@Summary		TwoFactorLoginTOTPEnable
+//	@Description	Enable the TOTP required by the 2FA policy and complete the login
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.TwoFactorLoginSetupTOTPReq	true	"TwoFactorLoginTOTPEnable Request"
+//	@Success		200		{object}	domain.Response{data=v1.TwoFactorSetupLoginResp}
+//	@Router			/api/v1/user/login/2fa/totp/enable [post]
+func (h *UserHandler) TwoFactorLoginTOTPEnable(c echo.Context) error {
+	var req v1.TwoFactorLoginSetupTOTPReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	ctx := c.Request().Context()
+	ip := c.RealIP()
+	if locked, remaining := h.rateLimiter.CheckIPLocked(ctx, ip); locked {
+		return h.NewResponseWithError(c, fmt.Sprintf("账号已被锁定，请 %s 后重试", remaining.String()), nil)
+	}
+
+	resp, err := h.usecase.LoginEnableTOTP(ctx, req)
+	if errors.Is(err, domain.ErrTwoFactorChallengeExpired) {
+		return h.NewResponseWithError(c, "登录已过期，请重新登录", err)
+	}
+	if errors.Is(err, domain.ErrInvalidTwoFactorCode) {
+		h.rateLimiter.LockAttempt(ctx, ip)
+		return h.NewResponseWithError(c, "验证码错误", err)
+	}
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to enable totp", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+// TwoFactorLoginWebAuthnRegisterOptions
+//
+//	@Summary		TwoFactorLoginWebAuthnRegisterOptions
+//	@Description	Get the options of navigator.credentials.create for the security key required by the 2FA policy during a login
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.TwoFactorChallengeReq	true	"TwoFactorLoginWebAuthnRegisterOptions Request"
+//	@Success		200		{object}	domain.Response{data=webauthn.CreationOptions}
+//	@Router			/api/v1/user/login/2fa/webauthn/register/options [post]
+func (h *UserHandler) TwoFactorLoginWebAuthnRegisterOptions(c echo.Context) error {
+	var req v1.TwoFactorChallengeReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	options, err := h.usecase.LoginBeginWebAuthnRegistration(c.Request().Context(), req.ChallengeToken, webAuthnRPID(c))
+	if errors.Is(err, domain.ErrTwoFactorChallengeExpired) {
+		return h.NewResponseWithError(c, "登录已过期，请重新登录", err)
+	}
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get webauthn options", err)
+	}
+	return h.NewResponseWithData(c, options)
+}
+
+// TwoFactorLoginWebAuthnRegister
+//
+//	@Summary		TwoFactorLoginWebAuthnRegister
+//	@Description	Register the security key required by the 2FA policy and complete the login
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.TwoFactorLoginSetupWebAuthnReq	true	"TwoFactorLoginWebAuthnRegister Request"
+//	@Success		200		{object}	domain.Response{data=v1.TwoFactorSetupLoginResp}
+//	@Router			/api/v1/user/login/2fa/webauthn/register [post]
+func (h *UserHandler) TwoFactorLoginWebAuthnRegister(c echo.Context) error {
+	var req v1.TwoFactorLoginSetupWebAuthnReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	resp, err := h.usecase.LoginRegisterWebAuthn(c.Request().Context(), req, webAuthnRPID(c))
+	if errors.Is(err, domain.ErrTwoFactorChallengeExpired) {
+		return h.NewResponseWithError(c, "登录已过期，请重新登录", err)
+	}
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to register security key", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+// GetTwoFactorStatus
+//
+//	@Summary		GetTwoFactorStatus
+//	@Description	Get the second factors of the current user
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	domain.Response{data=v1.TwoFactorStatusResp}
+//	@Router			/api/v1/user/2fa [get]
+func (h *UserHandler) GetTwoFactorStatus(c echo.Context) error {
+	authInfo, err := h.twoFactorAuthInfo(c)
+	if err != nil {
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+
+	status, err := h.usecase.GetTwoFactorStatus(c.Request().Context(), authInfo.UserId)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get two factor status", err)
+	}
+	return h.NewResponseWithData(c, status)
+}
+
+// SetupTOTP
+//
+//	@Summary		SetupTOTP
+//	@Description	Generate the TOTP secret of the current user, enabled once a code of it is verified
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	domain.Response{data=v1.TOTPSetupResp}
+//	@Router			/api/v1/user/2fa/totp/setup [post]
+func (h *UserHandler) SetupTOTP(c echo.Context) error {
+	authInfo, err := h.twoFactorAuthInfo(c)
+	if err != nil {
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+
+	resp, err := h.usecase.BeginTOTPSetup(c.Request().Context(), authInfo.UserId)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to setup totp", err)
+	}
+	return h.NewResponseWithData(c, resp)
+}
+
+// EnableTOTP
+//
+//	@Summary		EnableTOTP
+//	@Description	Enable TOTP for the current user
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.EnableTOTPReq	true	"EnableTOTP Request"
+//	@Success		200		{object}	domain.Response{data=v1.RecoveryCodesResp}
+//	@Router			/api/v1/user/2fa/totp/enable [post]
+func (h *UserHandler) EnableTOTP(c echo.Context) error {
+	var req v1.EnableTOTPReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	authInfo, err := h.twoFactorAuthInfo(c)
+	if err != nil {
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+
+	recoveryCodes, err := h.usecase.EnableTOTP(c.Request().Context(), authInfo.UserId, req.Code)
+	if errors.Is(err, domain.ErrInvalidTwoFactorCode) {
+		return h.NewResponseWithError(c, "验证码错误", err)
+	}
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to enable totp", err)
+	}
+	return h.NewResponseWithData(c, v1.RecoveryCodesResp{RecoveryCodes: recoveryCodes})
+}
+
+// DisableTOTP
+//
+//	@Summary		DisableTOTP
+//	@Description	Disable TOTP for the current user
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.TwoFactorPasswordReq	true	"DisableTOTP Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/v1/user/2fa/totp/disable [post]
+func (h *UserHandler) DisableTOTP(c echo.Context) error {
+	var req v1.TwoFactorPasswordReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	authInfo, err := h.twoFactorAuthInfo(c)
+	if err != nil {
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+
+	err = h.usecase.DisableTOTP(c.Request().Context(), authInfo.UserId, req.Password)
+	if errors.Is(err, domain.ErrTwoFactorRequired) {
+		return h.NewResponseWithError(c, "管理员必须启用双因素认证，无法移除最后一个验证方式", err)
+	}
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to disable totp", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// RegenerateRecoveryCodes
+//
+//	@Summary		RegenerateRecoveryCodes
+//	@Description	Replace the recovery codes of the current user
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.TwoFactorPasswordReq	true	"RegenerateRecoveryCodes Request"
+//	@Success		200		{object}	domain.Response{data=v1.RecoveryCodesResp}
+//	@Router			/api/v1/user/2fa/recovery_codes [post]
+func (h *UserHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	var req v1.TwoFactorPasswordReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	authInfo, err := h.twoFactorAuthInfo(c)
+	if err != nil {
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+
+	recoveryCodes, err := h.usecase.RegenerateRecoveryCodes(c.Request().Context(), authInfo.UserId, req.Password)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to regenerate recovery codes", err)
+	}
+	return h.NewResponseWithData(c, v1.RecoveryCodesResp{RecoveryCodes: recoveryCodes})
+}
+
+// WebAuthnRegisterOptions
+//
+//	@Summary		WebAuthnRegisterOptions
+//	@Description	Get the options of navigator.credentials.create for a security key of the current user
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	domain.Response{data=webauthn.CreationOptions}
+//	@Router			/api/v1/user/2fa/webauthn/register/options [post]
+func (h *UserHandler) WebAuthnRegisterOptions(c echo.Context) error {
+	authInfo, err := h.twoFactorAuthInfo(c)
+	if err != nil {
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+
+	options, err := h.usecase.BeginWebAuthnRegistration(c.Request().Context(), authInfo.UserId, webAuthnRPID(c))
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get webauthn options", err)
+	}
+	return h.NewResponseWithData(c, options)
+}
+
+// RegisterWebAuthn
+//
+//	@Summary		RegisterWebAuthn
+//	@Description	Register a security key or passkey of the current user
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.RegisterWebAuthnReq	true	"RegisterWebAuthn Request"
+//	@Success		200		{object}	domain.Response{data=v1.RecoveryCodesResp}
+//	@Router			/api/v1/user/2fa/webauthn/register [post]
+func (h *UserHandler) RegisterWebAuthn(c echo.Context) error {
+	var req v1.RegisterWebAuthnReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	authInfo, err := h.twoFactorAuthInfo(c)
+	if err != nil {
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+
+	recoveryCodes, err := h.usecase.RegisterWebAuthn(c.Request().Context(), authInfo.UserId, webAuthnRPID(c), req.Name, req.Credential)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to register security key", err)
+	}
+	return h.NewResponseWithData(c, v1.RecoveryCodesResp{RecoveryCodes: recoveryCodes})
+}
+
+// DeleteWebAuthnCredential
+//
+//	@Summary		DeleteWebAuthnCredential
+//	@Description	Remove a security key of the current user
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.DeleteWebAuthnCredentialReq	true	"DeleteWebAuthnCredential Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/v1/user/2fa/webauthn/delete [post]
+func (h *UserHandler) DeleteWebAuthnCredential(c echo.Context) error {
+	var req v1.DeleteWebAuthnCredentialReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	authInfo, err := h.twoFactorAuthInfo(c)
+	if err != nil {
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+
+	err = h.usecase.DeleteWebAuthnCredential(c.Request().Context(), authInfo.UserId, req.ID, req.Password)
+	if errors.Is(err, domain.ErrTwoFactorRequired) {
+		return h.NewResponseWithError(c, "管理员必须启用双因素认证，无法移除最后一个验证方式", err)
+	}
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to delete security key", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// GetTwoFactorPolicy
+//
+//	@Summary		GetTwoFactorPolicy
+//	@Description	Get the 2FA policy of password logins
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	domain.Response{data=domain.TwoFactorPolicy}
+//	@Router			/api/v1/user/2fa/policy [get]
+func (h *UserHandler) GetTwoFactorPolicy(c echo.Context) error {
+	policy, err := h.usecase.GetTwoFactorPolicy(c.Request().Context())
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get two factor policy", err)
+	}
+	return h.NewResponseWithData(c, policy)
+}
+
+// SetTwoFactorPolicy
+//
+//	@Summary		SetTwoFactorPolicy
+//	@Description	Update the 2FA policy of password logins
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		domain.TwoFactorPolicy	true	"SetTwoFactorPolicy Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/v1/user/2fa/policy [put]
+func (h *UserHandler) SetTwoFactorPolicy(c echo.Context) error {
+	var req domain.TwoFactorPolicy
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := h.usecase.SetTwoFactorPolicy(c.Request().Context(), &req); err != nil {
+		return h.NewResponseWithError(c, "failed to set two factor policy", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// ResetTwoFactor
+//
+//	@Summary		ResetTwoFactor
+//	@Description	Remove every second factor of a user who lost them
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		v1.ResetTwoFactorReq	true	"ResetTwoFactor Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/v1/user/2fa/reset [put]
+func (h *UserHandler) ResetTwoFactor(c echo.Context) error {
+	var req v1.ResetTwoFactorReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	authInfo, err := h.twoFactorAuthInfo(c)
+	if err != nil {
+		return h.NewResponseWithError(c, err.Error(), nil)
+	}
+	ctx := c.Request().Context()
+
+	if authInfo.UserId == req.UserID {
+		return h.NewResponseWithError(c, "无法重置自己的双因素认证", nil)
+	}
+	user, err := h.usecase.GetUser(ctx, authInfo.UserId)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get user", err)
+	}
+	targetUser, err := h.usecase.GetUser(ctx, req.UserID)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get target user", err)
+	}
+	// 与重置密码一致，只有 admin 账号可以重置其他超级管理员
+	if user.Account != domain.DefaultAdminAccount && targetUser.Role == consts.UserRoleAdmin {
+		return h.NewResponseWithError(c, "无法重置其他超级管理员的双因素认证", nil)
+	}
+
+	if err := h.usecase.ResetTwoFactor(ctx, req.UserID); err != nil {
+		return h.NewResponseWithError(c, "failed to reset two factor", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// twoFactorAuthInfo returns the auth info of the user logged in with a token of the admin
+// console, API tokens can not manage second factors.
+func (h *UserHandler) twoFactorAuthInfo(c echo.Context) (*domain.CtxAuthInfo, error) {
+	authInfo := domain.GetAuthInfoFromCtx(c.Request().Context())
+	if authInfo == nil {
+		return nil, errors.New("authInfo not found in context")
+	}
+	if authInfo.IsToken {
+		return nil, errors.New("this api not support token call")
+	}
+	return authInfo, nil
+}
+
+// webAuthnRPID returns the relying party id of security keys, the host of the admin console.
+func webAuthnRPID(c echo.Context) string {
+	host := c.Request().Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
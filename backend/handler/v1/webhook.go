@@ -0,0 +1,241 @@
+package v1
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/handler"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/middleware"
+	"github.com/chaitin/panda-wiki/usecase"
+)
+
+type WebhookHandler struct {
+	*handler.BaseHandler
+	logger  *log.Logger
+	auth    middleware.AuthMiddleware
+	usecase *usecase.WebhookUsecase
+}
+
+func NewWebhookHandler(e *echo.Echo, baseHandler *handler.BaseHandler, logger *log.Logger, auth middleware.AuthMiddleware,
+	usecase *usecase.WebhookUsecase) *WebhookHandler {
+	h := &WebhookHandler{
+		BaseHandler: baseHandler,
+		logger:      logger.WithModule("handler.v1.webhook"),
+		auth:        auth,
+		usecase:     usecase,
+	}
+
+	group := e.Group("/api/pro/v1/webhook", h.auth.Authorize, h.auth.ValidateKBUserPerm(consts.UserKBPermissionFullControl))
+	group.GET("/list", h.GetWebhookList)
+	group.POST("/create", h.CreateWebhook)
+	group.PATCH("/update", h.UpdateWebhook)
+	group.POST("/secret/rotate", h.RotateWebhookSecret)
+	group.DELETE("/delete", h.DeleteWebhook)
+	group.GET("/delivery/list", h.GetWebhookDeliveryList)
+	group.POST("/delivery/replay", h.ReplayWebhookDelivery)
+
+	return h
+}
+
+// GetWebhookList
+//
+//	@Summary		GetWebhookList
+//	@Description	List webhooks of a knowledge base
+//	@Tags			webhook
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			kb_id	query		string	true	"knowledge base ID"
+//	@Success		200		{object}	domain.PWResponse{data=[]domain.WebhookResp}
+//	@Router			/api/pro/v1/webhook/list [get]
+func (h *WebhookHandler) GetWebhookList(c echo.Context) error {
+	var req domain.WebhookListReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	webhooks, err := h.usecase.List(c.Request().Context(), req.KBID)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get webhook list", err)
+	}
+	return h.NewResponseWithData(c, webhooks)
+}
+
+// CreateWebhook
+//
+//	@Summary		CreateWebhook
+//	@Description	Create a webhook, a signing secret is generated when none is given. The secret is only shown in this response
+//	@Tags			webhook
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	body		domain.CreateWebhookReq	true	"Create Webhook Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.WebhookResp}
+//	@Router			/api/pro/v1/webhook/create [post]
+func (h *WebhookHandler) CreateWebhook(c echo.Context) error {
+	var req domain.CreateWebhookReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	webhook, err := h.usecase.Create(c.Request().Context(), &req)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to create webhook", err)
+	}
+	return h.NewResponseWithData(c, webhook)
+}
+
+// UpdateWebhook
+//
+//	@Summary		UpdateWebhook
+//	@Description	Update a webhook
+//	@Tags			webhook
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	body		domain.UpdateWebhookReq	true	"Update Webhook Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/pro/v1/webhook/update [patch]
+func (h *WebhookHandler) UpdateWebhook(c echo.Context) error {
+	var req domain.UpdateWebhookReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.Update(c.Request().Context(), &req); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return h.NewResponseWithError(c, "webhook not found", nil)
+		}
+		return h.NewResponseWithError(c, "failed to update webhook", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+// RotateWebhookSecret
+//
+//	@Summary		RotateWebhookSecret
+//	@Description	Replace the signing secret of a webhook. The new secret is only shown in this response
+//	@Tags			webhook
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	body		domain.RotateWebhookSecretReq	true	"Rotate Webhook Secret Request"
+//	@Success		200		{object}	domain.PWResponse{data=domain.WebhookResp}
+//	@Router			/api/pro/v1/webhook/secret/rotate [post]
+func (h *WebhookHandler) RotateWebhookSecret(c echo.Context) error {
+	var req domain.RotateWebhookSecretReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	webhook, err := h.usecase.RotateSecret(c.Request().Context(), &req)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return h.NewResponseWithError(c, "webhook not found", nil)
+		}
+		return h.NewResponseWithError(c, "failed to rotate webhook secret", err)
+	}
+	return h.NewResponseWithData(c, webhook)
+}
+
+// DeleteWebhook
+//
+//	@Summary		DeleteWebhook
+//	@Description	Delete a webhook and its delivery logs
+//	@Tags			webhook
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	query		domain.DeleteWebhookReq	true	"Delete Webhook Request"
+//	@Success		200		{object}	domain.Response
+//	@Router			/api/pro/v1/webhook/delete [delete]
+func (h *WebhookHandler) DeleteWebhook(c echo.Context) error {
+	var req domain.DeleteWebhookReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	if err := h.usecase.Delete(c.Request().Context(), &req); err != nil {
+		return h.NewResponseWithError(c, "failed to delete webhook", err)
+	}
+	return h.NewResponseWithData(c, nil)
+}
+
+type WebhookDeliveryList = domain.PaginatedResult[[]*domain.WebhookDelivery]
+
+// GetWebhookDeliveryList
+//
+//	@Summary		GetWebhookDeliveryList
+//	@Description	List webhook delivery logs, newest first
+//	@Tags			webhook
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			req	query		domain.WebhookDeliveryListReq			true	"WebhookDeliveryListReq"
+//	@Success		200	{object}	domain.PWResponse{data=WebhookDeliveryList}
+//	@Router			/api/pro/v1/webhook/delivery/list [get]
+func (h *WebhookHandler) GetWebhookDeliveryList(c echo.Context) error {
+	var req domain.WebhookDeliveryListReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	deliveries, err := h.usecase.ListDeliveries(c.Request().Context(), &req)
+	if err != nil {
+		return h.NewResponseWithError(c, "failed to get webhook delivery list", err)
+	}
+	return h.NewResponseWithData(c, deliveries)
+}
+
+// ReplayWebhookDelivery
+//
+//	@Summary		ReplayWebhookDelivery
+//	@Description	Send a logged delivery again as a new delivery, returns the new delivery id
+//	@Tags			webhook
+//	@Accept			json
+//	@Produce		json
+//	@Security		bearerAuth
+//	@Param			param	body		domain.ReplayWebhookDeliveryReq	true	"Replay Webhook Delivery Request"
+//	@Success		200		{object}	domain.PWResponse{data=string}
+//	@Router			/api/pro/v1/webhook/delivery/replay [post]
+func (h *WebhookHandler) ReplayWebhookDelivery(c echo.Context) error {
+	var req domain.ReplayWebhookDeliveryReq
+	if err := c.Bind(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return h.NewResponseWithError(c, "invalid request", err)
+	}
+
+	deliveryID, err := h.usecase.Replay(c.Request().Context(), &req)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return h.NewResponseWithError(c, "webhook delivery not found", nil)
+		}
+		return h.NewResponseWithError(c, "failed to replay webhook delivery", err)
+	}
+	return h.NewResponseWithData(c, deliveryID)
+}
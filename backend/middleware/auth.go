@@ -13,6 +13,8 @@ import (
 
 type AuthMiddleware interface {
 	Authorize(next echo.HandlerFunc) echo.HandlerFunc
+	AuthorizeWithTokenScope(scope consts.APITokenScope) echo.MiddlewareFunc
+	AuthorizeWithTokenScopeByMethod(read, write consts.APITokenScope) echo.MiddlewareFunc
 	ValidateUserRole(role consts.UserRole) echo.MiddlewareFunc
 	ValidateKBUserPerm(role consts.UserKBPermission) echo.MiddlewareFunc
 	ValidateLicenseEdition(edition ...consts.LicenseEdition) echo.MiddlewareFunc
@@ -24,8 +24,8 @@ type JWTMiddleware struct {
 	config         *config.Config
 	jwtMiddleware  echo.MiddlewareFunc
 	logger         *log.Logger
-	userAccessRepo *pg.UserAccessRepository
-	apiTokenRepo   *pg.APITokenRepo
+	userAccessRepo UserAccessRepository
+	apiTokenRepo   APITokenRepository
 }
 
 func NewJWTMiddleware(config *config.Config, logger *log.Logger, userAccessRepo *pg.UserAccessRepository, apiTokenRepo *pg.APITokenRepo) *JWTMiddleware {
@@ -39,28 +39,85 @@ func NewJWTMiddleware(config *config.Config, logger *log.Logger, userAccessRepo
 			})
 		},
 	})
-	return &JWTMiddleware{
+	m := &JWTMiddleware{
 		config:         config,
 		jwtMiddleware:  jwtMiddleware,
 		logger:         logger.WithModule("middleware.jwt"),
 		userAccessRepo: userAccessRepo,
-		apiTokenRepo:   apiTokenRepo,
 	}
+	if apiTokenRepo != nil {
+		m.apiTokenRepo = apiTokenRepo
+	}
+	return m
 }
 
+// Authorize authenticates admin console users. API tokens are refused: they are only let into
+// the apis declaring the scope they need with AuthorizeWithTokenScope, so an api without a
+// scope, such as the token management apis, can never be called with a token.
 func (m *JWTMiddleware) Authorize(next echo.HandlerFunc) echo.HandlerFunc {
+	return m.authorize(next, nil)
+}
+
+// AuthorizeWithTokenScope is Authorize letting in the api tokens having scope.
+func (m *JWTMiddleware) AuthorizeWithTokenScope(scope consts.APITokenScope) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return m.authorize(next, func(*http.Request) consts.APITokenScope {
+			return scope
+		})
+	}
+}
+
+// AuthorizeWithTokenScopeByMethod is Authorize letting in the api tokens having read for GET
+// and HEAD requests and write for the rest.
+func (m *JWTMiddleware) AuthorizeWithTokenScopeByMethod(read, write consts.APITokenScope) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return m.authorize(next, func(r *http.Request) consts.APITokenScope {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead:
+				return read
+			}
+			return write
+		})
+	}
+}
+
+// authorize authenticates the user of a jwt, or the api token of the request when tokenScope
+// returns the scope the api requires from tokens.
+func (m *JWTMiddleware) authorize(next echo.HandlerFunc, tokenScope func(*http.Request) consts.APITokenScope) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		authHeader := c.Request().Header.Get("Authorization")
 		if strings.HasPrefix(authHeader, "Bearer ") {
 			token := strings.TrimPrefix(authHeader, "Bearer ")
 
 			if !strings.Contains(token, ".") {
-				return m.validateAPIToken(c, token, next)
+				if tokenScope == nil {
+					m.logger.Info("api token refused by api without token scope", log.String("path", c.Path()))
+					return c.JSON(http.StatusForbidden, domain.PWResponse{
+						Success: false,
+						Message: "this api not support token call",
+					})
+				}
+				return m.validateAPIToken(c, token, tokenScope(c.Request()), next)
 			}
 		}
 
 		return m.jwtMiddleware(func(c echo.Context) error {
 			if userID, ok := m.MustGetUserID(c); ok {
+				var valid bool
+				var err error
+				if source := m.ssoSource(c); source != "" {
+					valid, err = m.userAccessRepo.ValidateSSOLogin(userID, source)
+				} else {
+					valid, err = m.userAccessRepo.ValidatePasswordLogin(userID)
+				}
+				if err != nil || !valid {
+					m.logger.Info("login token rejected", log.String("user_id", userID), log.Error(err))
+					return c.JSON(http.StatusUnauthorized, domain.PWResponse{
+						Success: false,
+						Message: "Unauthorized",
+					})
+				}
+
 				ctx := context.WithValue(c.Request().Context(), domain.CtxAuthInfoKey, &domain.CtxAuthInfo{
 					IsToken:    false,
 					Permission: consts.UserKBPermissionNull,
@@ -77,8 +134,8 @@ func (m *JWTMiddleware) Authorize(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
-// validateAPIToken validates API token and sets user context
-func (m *JWTMiddleware) validateAPIToken(c echo.Context, token string, next echo.HandlerFunc) error {
+// validateAPIToken validates API token having scope and sets user context
+func (m *JWTMiddleware) validateAPIToken(c echo.Context, token string, scope consts.APITokenScope, next echo.HandlerFunc) error {
 	if m.apiTokenRepo == nil {
 		m.logger.Debug("API token repository not available")
 		return c.JSON(http.StatusUnauthorized, domain.PWResponse{
@@ -95,12 +152,20 @@ func (m *JWTMiddleware) validateAPIToken(c echo.Context, token string, next echo
 			Message: "Unauthorized",
 		})
 	}
+	if !apiToken.HasScope(scope) {
+		m.logger.Info("api token scope denied", log.String("kb_id", apiToken.KbId), log.String("scope", string(scope)))
+		return c.JSON(http.StatusForbidden, domain.PWResponse{
+			Success: false,
+			Message: "Unauthorized token scope",
+		})
+	}
 
 	ctx := context.WithValue(c.Request().Context(), domain.CtxAuthInfoKey, &domain.CtxAuthInfo{
 		IsToken:    true,
 		Permission: apiToken.Permission,
 		UserId:     apiToken.UserID,
 		KBId:       apiToken.KbId,
+		Token:      apiToken,
 	})
 
 	req := c.Request().WithContext(ctx)
@@ -239,6 +304,20 @@ func (m *JWTMiddleware) MustGetUserID(c echo.Context) (string, bool) {
 	return id, ok
 }
 
+// ssoSource returns the IdP of a jwt issued by an admin SSO login, empty for other logins.
+func (m *JWTMiddleware) ssoSource(c echo.Context) consts.SourceType {
+	user, ok := c.Get("user").(*jwt.Token)
+	if !ok || user == nil {
+		return ""
+	}
+	claims, ok := user.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	source, _ := claims[domain.JWTClaimSSO].(string)
+	return consts.SourceType(source)
+}
+
 func GetKbID(c echo.Context) (string, error) {
 	switch c.Request().Method {
 	case http.MethodGet, http.MethodDelete:
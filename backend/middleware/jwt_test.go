@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaitin/panda-wiki/config"
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+)
+
+type fakeAPITokenRepo map[string]*domain.APIToken
+
+func (r fakeAPITokenRepo) GetByTokenWithCache(ctx context.Context, token string) (*domain.APIToken, error) {
+	return r[token], nil
+}
+
+// fakeUserAccessRepo holds the source type of the users, an SSO login is valid while its IdP
+// is sso.
+type fakeUserAccessRepo struct {
+	users map[string]consts.SourceType
+	sso   consts.SourceType
+}
+
+func (r *fakeUserAccessRepo) UpdateAccessTime(userID string) {}
+
+func (r *fakeUserAccessRepo) ValidateRole(userID string, role consts.UserRole) (bool, error) {
+	return true, nil
+}
+
+func (r *fakeUserAccessRepo) ValidateKBPerm(kbId, userId string, perm consts.UserKBPermission) (bool, error) {
+	return true, nil
+}
+
+func (r *fakeUserAccessRepo) ValidatePasswordLogin(userID string) (bool, error) {
+	source, ok := r.users[userID]
+	return ok && source == "", nil
+}
+
+func (r *fakeUserAccessRepo) ValidateSSOLogin(userID string, source consts.SourceType) (bool, error) {
+	userSource, ok := r.users[userID]
+	return ok && userSource == source && r.sso == source, nil
+}
+
+const testJWTSecret = "test-secret"
+
+func newTestJWTMiddleware(tokens fakeAPITokenRepo) *JWTMiddleware {
+	cfg := &config.Config{}
+	cfg.Auth.JWT.Secret = testJWTSecret
+	m := NewJWTMiddleware(cfg, &log.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}, nil, nil)
+	m.apiTokenRepo = tokens
+	return m
+}
+
+func signTestJWT(t *testing.T, userID string, sso consts.SourceType) string {
+	claims := jwt.MapClaims{
+		"id":  userID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if sso != "" {
+		claims[domain.JWTClaimSSO] = string(sso)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	require.NoError(t, err)
+	return token
+}
+
+func serve(e *echo.Echo, method, path, authorization string) int {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", authorization)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestAuthorizeAPITokenScope(t *testing.T) {
+	m := newTestJWTMiddleware(fakeAPITokenRepo{
+		"legacy": {ID: "1", KbId: "kb"},
+		"stats":  {ID: "2", KbId: "kb", Scopes: []string{string(consts.APITokenScopeStats)}},
+		"all": {ID: "3", KbId: "kb", Scopes: []string{
+			string(consts.APITokenScopeNodeRead), string(consts.APITokenScopeNodeWrite),
+			string(consts.APITokenScopePublish), string(consts.APITokenScopeChat),
+			string(consts.APITokenScopeMCP), string(consts.APITokenScopeStats),
+			string(consts.APITokenScopeSCIM),
+		}},
+	})
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+
+	e := echo.New()
+	// the token management apis declare no scope
+	e.POST("/api/pro/v1/token/create", ok, m.Authorize)
+	e.GET("/api/v1/stat/count", ok, m.AuthorizeWithTokenScope(consts.APITokenScopeStats))
+	e.POST("/api/v1/node/batch_move", ok, m.AuthorizeWithTokenScope(consts.APITokenScopeNodeWrite))
+	e.Any("/api/v1/node", ok, m.AuthorizeWithTokenScopeByMethod(consts.APITokenScopeNodeRead, consts.APITokenScopeNodeWrite))
+
+	for _, c := range []struct {
+		method, path, token string
+		code                int
+	}{
+		{http.MethodPost, "/api/pro/v1/token/create", "legacy", http.StatusForbidden},
+		{http.MethodPost, "/api/pro/v1/token/create", "all", http.StatusForbidden},
+		{http.MethodPost, "/api/pro/v1/token/create", "unknown", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/stat/count", "stats", http.StatusOK},
+		{http.MethodGet, "/api/v1/stat/count", "legacy", http.StatusOK},
+		{http.MethodGet, "/api/v1/stat/count", "unknown", http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/node/batch_move", "stats", http.StatusForbidden},
+		{http.MethodPost, "/api/v1/node/batch_move", "all", http.StatusOK},
+		{http.MethodGet, "/api/v1/node", "stats", http.StatusForbidden},
+		{http.MethodPost, "/api/v1/node", "stats", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/node", "all", http.StatusOK},
+	} {
+		require.Equal(t, c.code, serve(e, c.method, c.path, "Bearer "+c.token), "%s %s with %s", c.method, c.path, c.token)
+	}
+}
+
+func TestAuthorizeSSOLogin(t *testing.T) {
+	repo := &fakeUserAccessRepo{
+		users: map[string]consts.SourceType{
+			"admin": "",
+			"ldap":  consts.SourceTypeLDAP,
+			"oauth": consts.SourceTypeOAuth,
+		},
+		sso: consts.SourceTypeLDAP,
+	}
+	m := newTestJWTMiddleware(nil)
+	m.userAccessRepo = repo
+
+	e := echo.New()
+	e.GET("/api/v1/user", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, m.Authorize)
+	get := func(token string) int {
+		return serve(e, http.MethodGet, "/api/v1/user", "Bearer "+token)
+	}
+
+	ldapToken := signTestJWT(t, "ldap", consts.SourceTypeLDAP)
+	require.Equal(t, http.StatusOK, get(signTestJWT(t, "admin", "")))
+	require.Equal(t, http.StatusOK, get(ldapToken))
+	// the IdP of the token is no longer the enabled one
+	require.Equal(t, http.StatusUnauthorized, get(signTestJWT(t, "oauth", consts.SourceTypeOAuth)))
+	// a token can not claim another IdP than the one of its user
+	require.Equal(t, http.StatusUnauthorized, get(signTestJWT(t, "admin", consts.SourceTypeLDAP)))
+
+	delete(repo.users, "ldap")
+	require.Equal(t, http.StatusUnauthorized, get(ldapToken))
+
+	repo.users["ldap"] = consts.SourceTypeLDAP
+	repo.sso = ""
+	require.Equal(t, http.StatusUnauthorized, get(ldapToken))
+}
@@ -9,18 +9,21 @@ import (
 
 	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/repo/pg"
 	"github.com/chaitin/panda-wiki/usecase"
 )
 
 type ShareAuthMiddleware struct {
 	logger    *log.Logger
 	kbUsecase *usecase.KnowledgeBaseUsecase
+	authRepo  *pg.AuthRepo
 }
 
-func NewShareAuthMiddleware(logger *log.Logger, kbUsecase *usecase.KnowledgeBaseUsecase) *ShareAuthMiddleware {
+func NewShareAuthMiddleware(logger *log.Logger, kbUsecase *usecase.KnowledgeBaseUsecase, authRepo *pg.AuthRepo) *ShareAuthMiddleware {
 	return &ShareAuthMiddleware{
 		logger:    logger.WithModule("middleware.share_auth"),
 		kbUsecase: kbUsecase,
+		authRepo:  authRepo,
 	}
 }
 
@@ -118,6 +121,16 @@ func (h *ShareAuthMiddleware) Authorize(next echo.HandlerFunc) echo.HandlerFunc
 					Message: "Unauthorized",
 				})
 			}
+			// the IdP may have deprovisioned the reader since the login
+			loginAt, _ := sess.Values["login_at"].(int64)
+			revoked, err := h.authRepo.IsAuthSessionRevoked(c.Request().Context(), userId, loginAt)
+			if err != nil || revoked {
+				h.logger.Warn("session revoked", log.Any("user_id", userId), log.Error(err))
+				return c.JSON(http.StatusUnauthorized, domain.PWResponse{
+					Success: false,
+					Message: "Unauthorized",
+				})
+			}
 			c.Set("user_id", userId)
 			return next(c)
 		}
@@ -0,0 +1,13 @@
+package middleware
+
+import (
+	"github.com/chaitin/panda-wiki/consts"
+)
+
+type UserAccessRepository interface {
+	UpdateAccessTime(userID string)
+	ValidateRole(userID string, role consts.UserRole) (bool, error)
+	ValidateKBPerm(kbId, userId string, perm consts.UserKBPermission) (bool, error)
+	ValidatePasswordLogin(userID string) (bool, error)
+	ValidateSSOLogin(userID string, source consts.SourceType) (bool, error)
+}
@@ -58,7 +58,9 @@ func (c *MQConsumer) RegisterHandler(topic string, handler func(ctx context.Cont
 	c.logger.Info("registering handler for topic", log.String("topic", topic))
 
 	// 对于 anydoc.persistence.doc.task.export 主题，使用 Core NATS 订阅
-	if topic == domain.AnydocTaskExportTopic {
+	// kb release push events go to every api server, each one runs its own bots
+	// node collab events are ephemeral and fan out to every api server
+	if topic == domain.AnydocTaskExportTopic || topic == domain.KBReleasePushTopic || topic == domain.NodeCollabTopic {
 		return c.registerCoreNATSHandler(topic, handler)
 	}
 
@@ -103,6 +105,20 @@ func (c *MQConsumer) registerJetStreamHandler(topic string, handler func(ctx con
 	} else {
 		deliverPolicy = nats.DeliverAll()
 	}
+	opts := []nats.SubOpt{deliverPolicy, nats.AckExplicit(), nats.Durable(consumerName), nats.ConsumerName(consumerName)}
+	// webhook deliveries are retried by naking failed messages with the backoff
+	// delay, the ack wait only covers a consumer that died mid send
+	if topic == domain.WebhookDeliveryTopic {
+		opts = append(opts, nats.AckWait(domain.WebhookAckWait), nats.MaxDeliver(domain.WebhookMaxAttempts()))
+	}
+	// kb imports run for minutes, don't redeliver them while they are still running
+	if topic == domain.KBImportTopic {
+		opts = append(opts, nats.AckWait(domain.KBImportTimeout), nats.MaxDeliver(1))
+	}
+	// so do rag eval runs, every case is a chat completion
+	if topic == domain.RAGEvalTopic {
+		opts = append(opts, nats.AckWait(domain.RAGEvalTimeout), nats.MaxDeliver(1))
+	}
 
 	sub, err := c.js.Subscribe(topic, func(msg *nats.Msg) {
 		c.logger.Debug("received message via JetStream",
@@ -113,6 +129,9 @@ func (c *MQConsumer) registerJetStreamHandler(topic string, handler func(ctx con
 			c.logger.Error("handle message failed",
 				log.String("topic", topic),
 				log.Error(err))
+			if topic == domain.WebhookDeliveryTopic {
+				c.nakWebhookDelivery(msg)
+			}
 			return
 		}
 
@@ -121,7 +140,7 @@ func (c *MQConsumer) registerJetStreamHandler(topic string, handler func(ctx con
 				log.String("topic", topic),
 				log.Error(err))
 		}
-	}, deliverPolicy, nats.AckExplicit(), nats.Durable(consumerName), nats.ConsumerName(consumerName))
+	}, opts...)
 	if err != nil {
 		c.logger.Error("failed to subscribe to topic via JetStream",
 			log.String("topic", topic),
@@ -134,6 +153,21 @@ func (c *MQConsumer) registerJetStreamHandler(topic string, handler func(ctx con
 	return nil
 }
 
+// nakWebhookDelivery asks JetStream to redeliver a failed webhook delivery
+// after the backoff delay of its attempt.
+func (c *MQConsumer) nakWebhookDelivery(msg *nats.Msg) {
+	meta, err := msg.Metadata()
+	if err != nil {
+		c.logger.Error("failed to get message metadata", log.Error(err))
+		return
+	}
+	if err := msg.NakWithDelay(domain.WebhookRetryDelay(int(meta.NumDelivered))); err != nil {
+		c.logger.Error("failed to nak message",
+			log.String("topic", domain.WebhookDeliveryTopic),
+			log.Error(err))
+	}
+}
+
 func (c *MQConsumer) StartConsumerHandlers(ctx context.Context) error {
 	<-ctx.Done()
 	return nil
@@ -34,6 +34,18 @@ func (p *MQProducer) EnsureStreams() error {
 			name:     "scraper",
 			subjects: []string{"apps.panda-wiki.scraper.>"},
 		},
+		{
+			name:     "webhook",
+			subjects: []string{domain.WebhookDeliveryTopic},
+		},
+		{
+			name:     "kb_import",
+			subjects: []string{domain.KBImportTopic},
+		},
+		{
+			name:     "rag_eval",
+			subjects: []string{domain.RAGEvalTopic},
+		},
 	}
 
 	for _, stream := range streams {
@@ -67,6 +79,17 @@ func (p *MQProducer) EnsureStreams() error {
 			log.Any("subjects", stream.subjects))
 	}
 
+	// streams of subjects that moved to core nats, left behind by earlier versions
+	for _, name := range []string{"kb_release_push"} {
+		if _, err := p.js.StreamInfo(name); err != nil {
+			continue
+		}
+		if err := p.js.DeleteStream(name); err != nil {
+			return fmt.Errorf("failed to delete stream %s: %w", name, err)
+		}
+		p.logger.Info("deleted stream", log.String("stream", name))
+	}
+
 	return nil
 }
 
@@ -113,7 +136,14 @@ func (p *MQProducer) Produce(ctx context.Context, topic string, key string, valu
 		log.String("key", key),
 		log.Int("value_size", len(value)))
 
-	_, err := p.js.Publish(topic, value)
+	var err error
+	if topic == domain.NodeCollabTopic || topic == domain.KBReleasePushTopic {
+		// collab traffic is only useful live and release pushes fan out to every
+		// api server, they skip jetstream
+		err = p.conn.Publish(topic, value)
+	} else {
+		_, err = p.js.Publish(topic, value)
+	}
 	if err != nil {
 		p.logger.Error("failed to publish message",
 			log.String("topic", topic),
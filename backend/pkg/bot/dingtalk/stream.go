@@ -212,6 +212,55 @@ func (c *DingTalkClient) CreateAndDeliverCard(ctx context.Context, trackID strin
 	return nil
 }
 
+const (
+	dingTalkChannelGroup = "group:"
+	dingTalkChannelUser  = "user:"
+)
+
+// SendMessage sends a markdown message as the robot, the channelID is "group:<open conversation
+// id>" for group chats and "user:<staff id>" for private chats.
+func (c *DingTalkClient) SendMessage(ctx context.Context, channelID string, content string) error {
+	msgParam, _ := json.Marshal(map[string]string{"title": "PandaWiki", "text": content})
+	payload := map[string]any{
+		"robotCode": c.clientID,
+		"msgKey":    "sampleMarkdown",
+		"msgParam":  string(msgParam),
+	}
+	var url string
+	switch {
+	case strings.HasPrefix(channelID, dingTalkChannelGroup):
+		url = "https://api.dingtalk.com/v1.0/robot/groupMessages/send"
+		payload["openConversationId"] = strings.TrimPrefix(channelID, dingTalkChannelGroup)
+	case strings.HasPrefix(channelID, dingTalkChannelUser):
+		url = "https://api.dingtalk.com/v1.0/robot/oToMessages/batchSend"
+		payload["userIds"] = []string{strings.TrimPrefix(channelID, dingTalkChannelUser)}
+	default:
+		return fmt.Errorf("invalid dingtalk channel: %s", channelID)
+	}
+
+	accessToken, err := c.GetAccessToken()
+	if err != nil {
+		return fmt.Errorf("failed to get access token while sending message: %w", err)
+	}
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create dingtalk message request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-acs-dingtalk-access-token", accessToken)
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return fmt.Errorf("send dingtalk message failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("send dingtalk message failed: status %d, body: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
 func (c *DingTalkClient) startMessageCleanup() {
 	go func() {
 		ticker := time.NewTicker(time.Minute)
@@ -370,8 +419,10 @@ func (c *DingTalkClient) processMessage(ctx context.Context, data *chatbot.BotCa
 	}
 	if data.ConversationType == "2" { // 群聊
 		convInfo.UserInfo.From = domain.MessageFromGroup
+		convInfo.ChannelID = dingTalkChannelGroup + data.ConversationId
 	} else { // 单聊
 		convInfo.UserInfo.From = domain.MessageFromPrivate
+		convInfo.ChannelID = dingTalkChannelUser + data.SenderStaffId
 	}
 
 	contentCh, err := c.getQA(ctx, question, *convInfo, "")
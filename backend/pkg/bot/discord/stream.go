@@ -45,6 +45,14 @@ func (d *DiscordClient) Stop() error {
 	return d.dg.Close()
 }
 
+// SendMessage sends a message to the channel of channelID.
+func (d *DiscordClient) SendMessage(ctx context.Context, channelID string, content string) error {
+	if _, err := d.dg.ChannelMessageSend(channelID, content, discordgo.WithContext(ctx)); err != nil {
+		return fmt.Errorf("send discord message failed: %w", err)
+	}
+	return nil
+}
+
 func (d *DiscordClient) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 	if m.Author.ID == s.State.User.ID {
 		return
@@ -65,6 +73,7 @@ func (d *DiscordClient) handleMessage(s *discordgo.Session, m *discordgo.Message
 			Email:    m.Author.Email,
 			UserID:   m.Author.ID,
 		},
+		ChannelID: m.ChannelID,
 	}
 	if m.GuildID != "" {
 		info.UserInfo.From = domain.MessageFromGroup
@@ -90,7 +90,18 @@ func NewFeishuClient(ctx context.Context, cancel context.CancelFunc, clientID, c
 var cardDataTemplate = `{"schema":"2.0","header":{"title":{"content":"%s","tag":"plain_text"}},"config":{"streaming_mode":true,"summary":{"content":""}},"body":{"elements":[{"tag":"markdown","content":"%s","element_id":"markdown_1"}]}}`
 
 func (c *FeishuClient) sendTextMessage(ctx context.Context, receiveIdType string, receiveId string, text string) {
-	msgContent, _ := json.Marshal(map[string]string{"text": text})
+	if err := c.SendMessage(ctx, receiveIdType+":"+receiveId, text); err != nil {
+		c.logger.Error("failed to send fallback text message", log.Error(err))
+	}
+}
+
+// SendMessage sends a text message, the channelID is "<receive_id_type>:<receive_id>".
+func (c *FeishuClient) SendMessage(ctx context.Context, channelID string, content string) error {
+	receiveIdType, receiveId, ok := strings.Cut(channelID, ":")
+	if !ok {
+		return fmt.Errorf("invalid feishu channel: %s", channelID)
+	}
+	msgContent, _ := json.Marshal(map[string]string{"text": content})
 	resp, err := c.client.Im.Message.Create(ctx, larkim.NewCreateMessageReqBuilder().
 		ReceiveIdType(receiveIdType).
 		Body(larkim.NewCreateMessageReqBodyBuilder().
@@ -100,12 +111,12 @@ func (c *FeishuClient) sendTextMessage(ctx context.Context, receiveIdType string
 			Build()).
 		Build())
 	if err != nil {
-		c.logger.Error("failed to send fallback text message", log.Error(err))
-		return
+		return fmt.Errorf("send feishu message failed: %w", err)
 	}
 	if !resp.Success() {
-		c.logger.Error("failed to send fallback text message", log.Int("code", resp.Code), log.String("msg", resp.Msg))
+		return fmt.Errorf("send feishu message failed: %s (code: %d)", resp.Msg, resp.Code)
 	}
+	return nil
 }
 
 func (c *FeishuClient) sendQACard(ctx context.Context, receiveIdType string, receiveId string, question string, additionalInfo string) {
@@ -160,6 +171,7 @@ func (c *FeishuClient) sendQACard(ctx context.Context, receiveIdType string, rec
 		UserInfo: domain.UserInfo{
 			From: domain.MessageFromPrivate, // 默认是私聊
 		},
+		ChannelID: receiveIdType + ":" + receiveId,
 	}
 	var userOpenId string
 	if receiveIdType == "open_id" {
@@ -204,6 +204,7 @@ func (c *LarkClient) sendQACard(ctx context.Context, receiveIdType string, recei
 		UserInfo: domain.UserInfo{
 			From: domain.MessageFromPrivate,
 		},
+		ChannelID: receiveIdType + ":" + receiveId,
 	}
 	if receiveIdType == "open_id" {
 		userinfo, err := c.GetUserInfo(receiveId)
@@ -292,6 +293,30 @@ type Message struct {
 	Text string `json:"text"`
 }
 
+// SendMessage sends a text message, the channelID is "<receive_id_type>:<receive_id>".
+func (c *LarkClient) SendMessage(ctx context.Context, channelID string, content string) error {
+	receiveIdType, receiveId, ok := strings.Cut(channelID, ":")
+	if !ok {
+		return fmt.Errorf("invalid lark channel: %s", channelID)
+	}
+	msgContent, _ := json.Marshal(map[string]string{"text": content})
+	resp, err := c.client.Im.Message.Create(ctx, larkim.NewCreateMessageReqBuilder().
+		ReceiveIdType(receiveIdType).
+		Body(larkim.NewCreateMessageReqBodyBuilder().
+			MsgType("text").
+			ReceiveId(receiveId).
+			Content(string(msgContent)).
+			Build()).
+		Build())
+	if err != nil {
+		return fmt.Errorf("send lark message failed: %w", err)
+	}
+	if !resp.Success() {
+		return fmt.Errorf("send lark message failed: %s (code: %d)", resp.Msg, resp.Code)
+	}
+	return nil
+}
+
 // replaceMentions replaces mention placeholders like @_user_1 with actual user names
 func (c *LarkClient) replaceMentions(text string, mentions []*larkim.MentionEvent) string {
 	if len(mentions) == 0 {
@@ -8,3 +8,16 @@ type PushNotifier interface {
 	// SendTextMessage sends a plain text message to a group chat.
 	SendTextMessage(ctx context.Context, chatID string, content string) error
 }
+
+// MessageSender delivers a message to the chat a bot conversation came from. The channelID
+// is the domain.ConversationInfo.ChannelID the bot set for the conversation.
+type MessageSender interface {
+	SendMessage(ctx context.Context, channelID string, content string) error
+}
+
+// MessageSenderFunc adapts a send function to MessageSender.
+type MessageSenderFunc func(ctx context.Context, channelID string, content string) error
+
+func (f MessageSenderFunc) SendMessage(ctx context.Context, channelID string, content string) error {
+	return f(ctx, channelID, content)
+}
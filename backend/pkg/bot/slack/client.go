@@ -0,0 +1,390 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/pkg/bot"
+)
+
+const (
+	slackAPIURL = "https://slack.com/api/"
+
+	// slackRequestMaxAge rejects replayed callbacks, as recommended by Slack
+	slackRequestMaxAge = 5 * time.Minute
+	// slackUpdateInterval keeps the streamed answer within the chat.update rate limit
+	slackUpdateInterval = time.Second
+	slackEventTTL       = 5 * time.Minute
+
+	slackThinkingText = "稍等，让我想一想..."
+)
+
+var ErrInvalidSignature = errors.New("invalid slack request signature")
+
+// SlackClient is a Slack bot using the Events API. Slack posts events to the HTTP callback
+// registered in the router, the answers are streamed into a reply that is updated in place.
+type SlackClient struct {
+	ctx           context.Context
+	cancel        context.CancelFunc
+	botToken      string
+	signingSecret string
+	apiURL        string
+	logger        *log.Logger
+	httpClient    *http.Client
+	getQA         bot.GetQAFun
+	botUserID     string
+	eventMap      sync.Map // event_id → unix time, Slack retries callbacks it got no answer for
+}
+
+func NewSlackClient(ctx context.Context, cancel context.CancelFunc, botToken, signingSecret string, logger *log.Logger, getQA bot.GetQAFun) *SlackClient {
+	return &SlackClient{
+		ctx:           ctx,
+		cancel:        cancel,
+		botToken:      botToken,
+		signingSecret: signingSecret,
+		apiURL:        slackAPIURL,
+		logger:        logger.WithModule("bot.slack"),
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		getQA:         getQA,
+	}
+}
+
+// Start resolves the user of the bot, so its mentions can be stripped from questions and its
+// own messages ignored, then keeps the client alive until it is stopped.
+func (c *SlackClient) Start() error {
+	var auth struct {
+		UserID string `json:"user_id"`
+		Team   string `json:"team"`
+	}
+	if err := c.callForm(c.ctx, "auth.test", url.Values{}, &auth); err != nil {
+		return fmt.Errorf("failed to authenticate slack bot: %w", err)
+	}
+	c.botUserID = auth.UserID
+	c.logger.Info("slack bot client initialized (HTTP callback mode)", log.String("team", auth.Team), log.String("bot_user_id", auth.UserID))
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			c.logger.Info("slack bot client stopped")
+			return nil
+		case <-ticker.C:
+			c.eventMap.Range(func(key, value any) bool {
+				if time.Now().Unix()-value.(int64) > int64(slackEventTTL.Seconds()) {
+					c.eventMap.Delete(key)
+				}
+				return true
+			})
+		}
+	}
+}
+
+func (c *SlackClient) Stop() {
+	c.cancel()
+}
+
+// VerifySignature checks the X-Slack-Signature of a callback, it is the hex HMAC-SHA256 of
+// "v0:<timestamp>:<body>" keyed by the signing secret of the app.
+func VerifySignature(signingSecret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	signature := header.Get("X-Slack-Signature")
+	if signingSecret == "" || timestamp == "" || signature == "" {
+		return ErrInvalidSignature
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > slackRequestMaxAge || age < -slackRequestMaxAge {
+		return ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type eventEnvelope struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	EventID   string `json:"event_id"`
+	Event     *Event `json:"event"`
+}
+
+// Event is the inner event of an event callback.
+type Event struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id"`
+	Text        string `json:"text"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts"`
+}
+
+// EventResponse is the body of the answer to a callback, Challenge echoes the url
+// verification of the app.
+type EventResponse struct {
+	Challenge string `json:"challenge,omitempty"`
+}
+
+// HandleEvent verifies and handles a callback of the Events API. Questions are answered in
+// the background, Slack expects the callback to be acknowledged within 3 seconds.
+func (c *SlackClient) HandleEvent(header http.Header, body []byte) (*EventResponse, error) {
+	if err := VerifySignature(c.signingSecret, header, body, time.Now()); err != nil {
+		return nil, err
+	}
+	var envelope eventEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid slack event: %w", err)
+	}
+	switch envelope.Type {
+	case "url_verification":
+		return &EventResponse{Challenge: envelope.Challenge}, nil
+	case "event_callback":
+		if envelope.Event == nil || envelope.EventID == "" {
+			return &EventResponse{}, nil
+		}
+		if _, loaded := c.eventMap.LoadOrStore(envelope.EventID, time.Now().Unix()); loaded {
+			return &EventResponse{}, nil
+		}
+		if question, threadTS, from, ok := c.parseQuestion(envelope.Event); ok {
+			go c.answer(c.ctx, envelope.Event, question, threadTS, from)
+		}
+	}
+	return &EventResponse{}, nil
+}
+
+// parseQuestion returns the question of app mentions in channels and of direct messages.
+// Mentions are answered in their thread, direct messages only when they were sent in one.
+func (c *SlackClient) parseQuestion(event *Event) (question, threadTS string, from domain.MessageFrom, ok bool) {
+	if event.BotID != "" || event.Subtype != "" || event.User == "" || event.User == c.botUserID {
+		return "", "", 0, false
+	}
+	switch {
+	case event.Type == "app_mention":
+		threadTS = event.ThreadTS
+		if threadTS == "" {
+			threadTS = event.TS
+		}
+		from = domain.MessageFromGroup
+	case event.Type == "message" && event.ChannelType == "im":
+		threadTS = event.ThreadTS
+		from = domain.MessageFromPrivate
+	default:
+		return "", "", 0, false
+	}
+	question = strings.TrimSpace(strings.ReplaceAll(event.Text, "<@"+c.botUserID+">", ""))
+	if question == "" {
+		return "", "", 0, false
+	}
+	return question, threadTS, from, true
+}
+
+func (c *SlackClient) answer(ctx context.Context, event *Event, question, threadTS string, from domain.MessageFrom) {
+	replyTS, err := c.postMessage(ctx, event.Channel, threadTS, slackThinkingText)
+	if err != nil {
+		c.logger.Error("failed to post slack reply", log.Error(err))
+		return
+	}
+
+	info := domain.ConversationInfo{
+		UserInfo: domain.UserInfo{
+			UserID: event.User,
+			From:   from,
+		},
+		ChannelID: event.Channel,
+	}
+	if user, err := c.getUserInfo(ctx, event.User); err != nil {
+		c.logger.Warn("get slack user info failed", log.String("user", event.User), log.Error(err))
+	} else {
+		info.UserInfo.NickName = user.nickname()
+		info.UserInfo.RealName = user.RealName
+		info.UserInfo.Email = user.Profile.Email
+		info.UserInfo.Avatar = user.Profile.Image192
+	}
+
+	answerCh, err := c.getQA(ctx, question, info, "")
+	if err != nil {
+		c.logger.Error("slack client failed to get answer", log.Error(err))
+		if err := c.updateMessage(ctx, event.Channel, replyTS, "出错了，请稍后再试"); err != nil {
+			c.logger.Error("failed to update slack reply", log.Error(err))
+		}
+		return
+	}
+
+	var buf strings.Builder
+	lastUpdate := time.Now()
+	for chunk := range answerCh {
+		buf.WriteString(chunk)
+		if time.Since(lastUpdate) < slackUpdateInterval {
+			continue
+		}
+		if err := c.updateMessage(ctx, event.Channel, replyTS, ToMrkdwn(buf.String())); err != nil {
+			c.logger.Warn("failed to stream slack reply", log.Error(err))
+		}
+		lastUpdate = time.Now()
+	}
+	if err := c.updateMessage(ctx, event.Channel, replyTS, ToMrkdwn(buf.String())); err != nil {
+		c.logger.Error("failed to update slack reply", log.Error(err))
+	}
+}
+
+// SendMessage posts a message to the channel of channelID.
+func (c *SlackClient) SendMessage(ctx context.Context, channelID string, content string) error {
+	_, err := c.postMessage(ctx, channelID, "", ToMrkdwn(content))
+	return err
+}
+
+// SendTextMessage implements bot.PushNotifier, the chatID is the ID of a channel the bot
+// was invited to.
+func (c *SlackClient) SendTextMessage(ctx context.Context, chatID string, content string) error {
+	return c.SendMessage(ctx, chatID, content)
+}
+
+func (c *SlackClient) postMessage(ctx context.Context, channel, threadTS, text string) (string, error) {
+	payload := map[string]any{"channel": channel, "text": text}
+	if threadTS != "" {
+		payload["thread_ts"] = threadTS
+	}
+	var resp struct {
+		TS string `json:"ts"`
+	}
+	if err := c.callJSON(ctx, "chat.postMessage", payload, &resp); err != nil {
+		return "", err
+	}
+	return resp.TS, nil
+}
+
+func (c *SlackClient) updateMessage(ctx context.Context, channel, ts, text string) error {
+	if text == "" {
+		return nil
+	}
+	return c.callJSON(ctx, "chat.update", map[string]any{"channel": channel, "ts": ts, "text": text}, nil)
+}
+
+type slackUser struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	RealName string `json:"real_name"`
+	Profile  struct {
+		DisplayName string `json:"display_name"`
+		Email       string `json:"email"`
+		Image192    string `json:"image_192"`
+	} `json:"profile"`
+}
+
+func (u *slackUser) nickname() string {
+	for _, name := range []string{u.Profile.DisplayName, u.RealName, u.Name} {
+		if name != "" {
+			return name
+		}
+	}
+	return u.ID
+}
+
+func (c *SlackClient) getUserInfo(ctx context.Context, userID string) (*slackUser, error) {
+	var resp struct {
+		User *slackUser `json:"user"`
+	}
+	if err := c.callForm(ctx, "users.info", url.Values{"user": {userID}}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.User == nil {
+		return nil, fmt.Errorf("slack user %s not found", userID)
+	}
+	return resp.User, nil
+}
+
+// callJSON calls a write method of the Web API, the read methods only accept forms.
+func (c *SlackClient) callJSON(ctx context.Context, method string, payload any, result any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, method, bytes.NewReader(body), "application/json; charset=utf-8", result)
+}
+
+func (c *SlackClient) callForm(ctx context.Context, method string, values url.Values, result any) error {
+	return c.call(ctx, method, strings.NewReader(values.Encode()), "application/x-www-form-urlencoded", result)
+}
+
+func (c *SlackClient) call(ctx context.Context, method string, body io.Reader, contentType string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+method, body)
+	if err != nil {
+		return fmt.Errorf("create slack %s request failed: %w", method, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+c.botToken)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("slack %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read slack %s response failed: %w", method, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack %s failed: status %d, body: %s", method, resp.StatusCode, string(respBody))
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &status); err != nil {
+		return fmt.Errorf("invalid slack %s response: %w", method, err)
+	}
+	if !status.OK {
+		return fmt.Errorf("slack %s failed: %s", method, status.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+var (
+	mrkdwnImagePattern   = regexp.MustCompile(`!\[[^\]]*\]\([^)]+\)`)
+	mrkdwnLinkPattern    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mrkdwnBoldPattern    = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	mrkdwnStrikePattern  = regexp.MustCompile(`~~(.+?)~~`)
+	mrkdwnHeadingPattern = regexp.MustCompile(`(?m)^#{1,6}\s+(.+?)\s*#*$`)
+)
+
+// ToMrkdwn converts the markdown of answers to the mrkdwn of Slack messages. Images are
+// dropped as Slack does not render them inline.
+func ToMrkdwn(markdown string) string {
+	text := mrkdwnImagePattern.ReplaceAllString(markdown, "")
+	text = mrkdwnLinkPattern.ReplaceAllString(text, "<$2|$1>")
+	text = mrkdwnHeadingPattern.ReplaceAllStringFunc(text, func(heading string) string {
+		title := mrkdwnHeadingPattern.FindStringSubmatch(heading)[1]
+		return "*" + strings.ReplaceAll(title, "**", "") + "*"
+	})
+	text = mrkdwnBoldPattern.ReplaceAllString(text, "*$1*")
+	text = mrkdwnStrikePattern.ReplaceAllString(text, "~$1~")
+	return text
+}
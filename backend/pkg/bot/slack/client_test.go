@@ -0,0 +1,166 @@
+package slack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaitin/panda-wiki/domain"
+	pwlog "github.com/chaitin/panda-wiki/log"
+)
+
+const testSigningSecret = "signing-secret"
+
+func newTestLogger() *pwlog.Logger {
+	return &pwlog.Logger{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func signedHeader(secret string, body []byte, now time.Time) http.Header {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	header := http.Header{}
+	header.Set("X-Slack-Request-Timestamp", timestamp)
+	header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"type":"url_verification"}`)
+	now := time.Now()
+
+	require.NoError(t, VerifySignature(testSigningSecret, signedHeader(testSigningSecret, body, now), body, now))
+	require.ErrorIs(t, VerifySignature(testSigningSecret, signedHeader("other", body, now), body, now), ErrInvalidSignature)
+	require.ErrorIs(t, VerifySignature(testSigningSecret, signedHeader(testSigningSecret, body, now), []byte(`{}`), now), ErrInvalidSignature)
+	require.ErrorIs(t, VerifySignature(testSigningSecret, signedHeader(testSigningSecret, body, now.Add(-10*time.Minute)), body, now), ErrInvalidSignature)
+	require.ErrorIs(t, VerifySignature(testSigningSecret, http.Header{}, body, now), ErrInvalidSignature)
+}
+
+func TestToMrkdwn(t *testing.T) {
+	require.Equal(t, "*标题*\n这是 *重点* 和 ~删除~，见 <https://example.com/doc|文档>",
+		ToMrkdwn("## **标题**\n这是 **重点** 和 ~~删除~~，见 [文档](https://example.com/doc)"))
+	require.Equal(t, "图片：", ToMrkdwn("图片：![logo](https://example.com/logo.png)"))
+}
+
+func TestParseQuestion(t *testing.T) {
+	c := &SlackClient{botUserID: "UBOT"}
+
+	question, threadTS, from, ok := c.parseQuestion(&Event{Type: "app_mention", User: "U1", Text: "<@UBOT> 如何配置 SSO", TS: "1.1"})
+	require.True(t, ok)
+	require.Equal(t, "如何配置 SSO", question)
+	require.Equal(t, "1.1", threadTS)
+	require.Equal(t, domain.MessageFromGroup, from)
+
+	_, threadTS, from, ok = c.parseQuestion(&Event{Type: "message", ChannelType: "im", User: "U1", Text: "你好", TS: "2.2"})
+	require.True(t, ok)
+	require.Empty(t, threadTS)
+	require.Equal(t, domain.MessageFromPrivate, from)
+
+	_, _, _, ok = c.parseQuestion(&Event{Type: "message", ChannelType: "channel", User: "U1", Text: "你好"})
+	require.False(t, ok)
+	_, _, _, ok = c.parseQuestion(&Event{Type: "message", ChannelType: "im", BotID: "B1", Text: "你好"})
+	require.False(t, ok)
+	_, _, _, ok = c.parseQuestion(&Event{Type: "app_mention", User: "U1", Text: "<@UBOT>"})
+	require.False(t, ok)
+}
+
+func TestHandleEvent(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		posts   []map[string]any
+		updates []map[string]any
+		done    = make(chan struct{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer bot-token", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/users.info":
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "U1", r.Form.Get("user"))
+			_, _ = w.Write([]byte(`{"ok":true,"user":{"id":"U1","name":"alice","real_name":"Alice","profile":{"email":"alice@example.com"}}}`))
+		case "/chat.postMessage", "/chat.update":
+			var payload map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+			mu.Lock()
+			if r.URL.Path == "/chat.postMessage" {
+				posts = append(posts, payload)
+			} else {
+				updates = append(updates, payload)
+				close(done)
+			}
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"ok":true,"ts":"9.9"}`))
+		default:
+			t.Errorf("unexpected slack method %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	var info domain.ConversationInfo
+	getQA := func(ctx context.Context, msg string, convInfo domain.ConversationInfo, conversationID string) (chan string, error) {
+		info = convInfo
+		contentCh := make(chan string, 2)
+		contentCh <- "答案是 "
+		contentCh <- "**42**"
+		close(contentCh)
+		return contentCh, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := NewSlackClient(ctx, cancel, "bot-token", testSigningSecret, newTestLogger(), getQA)
+	c.apiURL = server.URL + "/"
+	c.botUserID = "UBOT"
+
+	t.Run("url verification", func(t *testing.T) {
+		body := []byte(`{"type":"url_verification","challenge":"abc"}`)
+		resp, err := c.HandleEvent(signedHeader(testSigningSecret, body, time.Now()), body)
+		require.NoError(t, err)
+		require.Equal(t, "abc", resp.Challenge)
+
+		_, err = c.HandleEvent(http.Header{}, body)
+		require.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("mention answered in thread", func(t *testing.T) {
+		body := []byte(`{"type":"event_callback","event_id":"Ev1","event":{"type":"app_mention","user":"U1","text":"<@UBOT> 问题","channel":"C1","ts":"1.1"}}`)
+		_, err := c.HandleEvent(signedHeader(testSigningSecret, body, time.Now()), body)
+		require.NoError(t, err)
+		// retries of the same event are ignored
+		_, err = c.HandleEvent(signedHeader(testSigningSecret, body, time.Now()), body)
+		require.NoError(t, err)
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("slack reply was not updated")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, posts, 1)
+		require.Equal(t, "C1", posts[0]["channel"])
+		require.Equal(t, "1.1", posts[0]["thread_ts"])
+		require.Len(t, updates, 1)
+		require.Equal(t, "9.9", updates[0]["ts"])
+		require.Equal(t, "答案是 *42*", updates[0]["text"])
+
+		require.Equal(t, "U1", info.UserInfo.UserID)
+		require.Equal(t, "Alice", info.UserInfo.NickName)
+		require.Equal(t, "alice@example.com", info.UserInfo.Email)
+		require.Equal(t, "C1", info.ChannelID)
+	})
+}
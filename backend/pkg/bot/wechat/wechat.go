@@ -90,7 +90,9 @@ func (cfg *WechatConfig) ProcessUrlMessage(msg ReceivedMessage, GetQA bot.GetQAF
 			UserID:   userinfo.UserID,
 			NickName: userinfo.Name,
 			From:     domain.MessageFromPrivate,
-		}}, conversationID)
+		},
+		ChannelID: msg.FromUserName,
+	}, conversationID)
 
 	if err != nil {
 		return err
@@ -138,7 +140,9 @@ func (cfg *WechatConfig) ProcessTextMessage(msg ReceivedMessage, GetQA bot.GetQA
 			UserID:   userinfo.UserID,
 			NickName: userinfo.Name,
 			From:     domain.MessageFromPrivate,
-		}}, conversationID)
+		},
+		ChannelID: msg.FromUserName,
+	}, conversationID)
 
 	if err != nil {
 		return err
@@ -254,6 +258,16 @@ func (cfg *WechatConfig) SendResponseToUser(response string, touser string, toke
 	return result.Errcode, result.Errmsg, nil
 }
 
+// SendMessage sends a markdown message to the user of channelID.
+func (cfg *WechatConfig) SendMessage(ctx context.Context, channelID string, content string) error {
+	token, err := cfg.GetAccessToken()
+	if err != nil {
+		return err
+	}
+	_, _, err = cfg.SendResponseToUser(content, channelID, token)
+	return err
+}
+
 // SendResponse
 func (cfg *WechatConfig) SendResponse(msg ReceivedMessage, content string) ([]byte, error) {
 
@@ -161,7 +161,7 @@ func (cfg *WechatServiceConfig) ProcessMessage(msgRet *MsgRet, GetQA bot.GetQAFu
 		NickName: customer.Nickname,       //用户微信的昵称
 		Avatar:   customer.Avatar,         // 用户微信的头像
 		From:     domain.MessageFromPrivate,
-	}}, conversationID)
+	}, ChannelID: openkfId + ":" + userId}, conversationID)
 	if err != nil {
 		return err
 	}
@@ -263,6 +263,20 @@ func (cfg *WechatServiceConfig) SendResponseToKfTxt(userId string, openkfId stri
 	return cfg.SendMessage(jsonData, token)
 }
 
+// SendTextMessage sends a text message to the customer, the channelID is
+// "<open_kfid>:<external_userid>".
+func (cfg *WechatServiceConfig) SendTextMessage(ctx context.Context, channelID string, content string) error {
+	openkfId, userId, ok := strings.Cut(channelID, ":")
+	if !ok {
+		return fmt.Errorf("invalid wechat service channel: %s", channelID)
+	}
+	token, err := cfg.GetAccessToken()
+	if err != nil {
+		return err
+	}
+	return cfg.SendResponseToKfTxt(userId, openkfId, MarkdowntoText(content), token)
+}
+
 func (cfg *WechatServiceConfig) SendMessage(jsonData []byte, token string) error {
 	// 发送消息给客服
 	url := fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/kf/send_msg?access_token=%s", token)
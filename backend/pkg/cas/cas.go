@@ -27,11 +27,13 @@ type Config struct {
 	ValidatePath string `json:"validate_path"` // 验证路径，默认根据版本自动选择
 	Version      string `json:"version"`       // CAS协议版本: "2" 或 "3"
 	CASUrl       string `json:"cas_url"`
+	CallbackPath string `json:"-"` // 服务回调路径，默认为前台的回调路径
 }
 
 type UserInfo struct {
 	Username   string            `json:"username"`
 	Attributes map[string]string `json:"attributes"`
+	Groups     []string          `json:"groups"` // CAS3 memberOf 或 groups 属性
 }
 
 // CAS2ServiceResponse CAS2服务验证响应结构
@@ -63,9 +65,11 @@ type AuthenticationFailure struct {
 }
 
 type CAS3Attributes struct {
-	Email     string `xml:"email"`
-	Name      string `xml:"name"`
-	AvatarURL string `xml:"avatar_url"`
+	Email     string   `xml:"email"`
+	Name      string   `xml:"name"`
+	AvatarURL string   `xml:"avatar_url"`
+	MemberOf  []string `xml:"memberOf"`
+	Groups    []string `xml:"groups"`
 }
 
 const (
@@ -106,6 +110,9 @@ func NewClient(ctx context.Context, logger *log.Logger, config Config) (*Client,
 			return nil, fmt.Errorf("invalid service URL: %w", err)
 		}
 		serviceURL.Path = callbackPath
+		if config.CallbackPath != "" {
+			serviceURL.Path = config.CallbackPath
+		}
 		config.ServiceURL = serviceURL.String()
 	}
 
@@ -218,6 +225,7 @@ func (c *Client) parseCAS3Response(body []byte) (*UserInfo, error) {
 			"name":       serviceResp.Success.Attributes.Name,
 			"avatar_url": serviceResp.Success.Attributes.AvatarURL,
 		},
+		Groups: append(serviceResp.Success.Attributes.MemberOf, serviceResp.Success.Attributes.Groups...),
 	}
 
 	// 如果没有显示名称，使用用户名
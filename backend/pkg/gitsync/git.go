@@ -0,0 +1,198 @@
+package gitsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Options describes the remote to clone and how to authenticate against it.
+type Options struct {
+	URL      string // http(s):// url
+	Branch   string // empty means the remote default branch
+	Username string // http basic auth user sent with Token, defaults to x-access-token
+	Token    string
+
+	allowLocal bool // local paths and file:// urls, for the tests
+}
+
+// Repo is a working copy cloned into a temp dir. The git binary must be on PATH.
+type Repo struct {
+	Dir    string
+	branch string
+	config []string // -c options of every git command
+}
+
+type ChangeType string
+
+const (
+	ChangeAdded    ChangeType = "added"
+	ChangeModified ChangeType = "modified"
+	ChangeDeleted  ChangeType = "deleted"
+)
+
+type Change struct {
+	Path string
+	Type ChangeType
+}
+
+// ValidateURL only accepts http(s):// remotes. Local paths and file:// urls would import the
+// files of the server itself, and transports such as ext:: or ssh can't be configured either.
+// Callers still have to keep the host off internal addresses.
+func ValidateURL(raw string) error {
+	return validateURL(raw, false)
+}
+
+func validateURL(raw string, allowLocal bool) error {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return fmt.Errorf("repository url is required")
+	}
+	if filepath.IsAbs(raw) {
+		if allowLocal {
+			return nil
+		}
+		return fmt.Errorf("local repository paths are not allowed")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid repository url: %w", err)
+	}
+	switch {
+	case u.Scheme == "http" || u.Scheme == "https":
+		if u.Host == "" {
+			return fmt.Errorf("invalid repository url: missing host")
+		}
+		if u.User != nil {
+			return fmt.Errorf("repository url must not contain credentials, use the token")
+		}
+		return nil
+	case u.Scheme == "file" && allowLocal:
+		return nil
+	default:
+		return fmt.Errorf("unsupported repository url scheme: %q", u.Scheme)
+	}
+}
+
+// Clone makes a shallow clone of opts.URL into dir. Redirects are not followed, so a remote
+// checked by the caller can't send git on to another host.
+func Clone(ctx context.Context, opts Options, dir string) (*Repo, error) {
+	if err := validateURL(opts.URL, opts.allowLocal); err != nil {
+		return nil, err
+	}
+	r := &Repo{Dir: dir, branch: opts.Branch, config: []string{"-c", "http.followRedirects=false"}}
+	if opts.Token != "" && strings.HasPrefix(opts.URL, "http") {
+		username := opts.Username
+		if username == "" {
+			username = "x-access-token"
+		}
+		// pass the token as a header so it never ends up in .git/config or error messages
+		basic := base64.StdEncoding.EncodeToString([]byte(username + ":" + opts.Token))
+		r.config = append(r.config, "-c", "http.extraHeader=Authorization: Basic "+basic)
+	}
+
+	args := []string{"clone", "--depth", "1", "--no-tags"}
+	if opts.Branch != "" {
+		args = append(args, "--branch", opts.Branch)
+	}
+	args = append(args, "--", opts.URL, dir)
+	if _, err := r.git(ctx, "", args...); err != nil {
+		return nil, err
+	}
+	if r.branch == "" {
+		branch, err := r.git(ctx, dir, "rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		r.branch = branch
+	}
+	return r, nil
+}
+
+// Head returns the commit hash of HEAD.
+func (r *Repo) Head(ctx context.Context) (string, error) {
+	return r.git(ctx, r.Dir, "rev-parse", "HEAD")
+}
+
+// CommitAll stages every change in the working tree and commits it.
+// It returns an empty commit hash when there is nothing to commit.
+func (r *Repo) CommitAll(ctx context.Context, message, authorName, authorEmail string) (string, []Change, error) {
+	if _, err := r.git(ctx, r.Dir, "add", "--all"); err != nil {
+		return "", nil, err
+	}
+	out, err := r.git(ctx, r.Dir, "diff", "--cached", "--name-status", "--no-renames", "-z")
+	if err != nil {
+		return "", nil, err
+	}
+	changes := parseNameStatus(out)
+	if len(changes) == 0 {
+		return "", nil, nil
+	}
+	if _, err := r.git(ctx, r.Dir,
+		"-c", "user.name="+authorName,
+		"-c", "user.email="+authorEmail,
+		"commit", "--no-verify", "-m", message,
+	); err != nil {
+		return "", nil, err
+	}
+	commit, err := r.Head(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	return commit, changes, nil
+}
+
+// Push pushes HEAD to the cloned branch.
+func (r *Repo) Push(ctx context.Context) error {
+	_, err := r.git(ctx, r.Dir, "push", "origin", "HEAD:refs/heads/"+r.branch)
+	return err
+}
+
+func (r *Repo) git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append(append([]string{}, r.config...), args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=true")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", subcommand(args), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func subcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-c" {
+			i++
+			continue
+		}
+		return args[i]
+	}
+	return ""
+}
+
+// parseNameStatus parses `git diff --name-status -z` output: status NUL path NUL ...
+func parseNameStatus(out string) []Change {
+	fields := strings.Split(strings.Trim(out, "\x00"), "\x00")
+	changes := make([]Change, 0, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		change := Change{Path: fields[i+1]}
+		switch fields[i] {
+		case "A":
+			change.Type = ChangeAdded
+		case "D":
+			change.Type = ChangeDeleted
+		default:
+			change.Type = ChangeModified
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
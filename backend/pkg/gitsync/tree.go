@@ -0,0 +1,193 @@
+package gitsync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const docExt = ".md"
+
+// FrontMatter is the yaml header of a markdown doc.
+type FrontMatter struct {
+	Title string   `yaml:"title,omitempty"`
+	Order *float64 `yaml:"order,omitempty"`
+	Emoji string   `yaml:"emoji,omitempty"`
+}
+
+// Entry is a folder or a markdown doc found in the repository.
+// Path is slash separated and relative to the sync root; it is the stable key of the node.
+type Entry struct {
+	Path     string
+	Parent   string // path of the parent folder, empty for the root
+	IsDir    bool
+	Name     string
+	Emoji    string
+	Position float64
+	Content  string // markdown body without front-matter
+	Hash     string // sha256 of the raw file, empty for folders
+}
+
+// Scan walks root and returns its folders and markdown docs, parents before children.
+// Hidden entries are skipped and folders without any doc are pruned. Siblings keep the
+// front-matter order as position; unordered ones follow in name order.
+func Scan(root string) ([]*Entry, error) {
+	entries, _, err := scanDir(root, "")
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func scanDir(root, rel string) ([]*Entry, bool, error) {
+	dirEntries, err := os.ReadDir(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		return nil, false, err
+	}
+
+	type sibling struct {
+		entry    *Entry
+		order    *float64
+		children []*Entry
+	}
+	siblings := make([]*sibling, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		name := de.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		p := path.Join(rel, name)
+		switch {
+		case de.IsDir():
+			children, hasDoc, err := scanDir(root, p)
+			if err != nil {
+				return nil, false, err
+			}
+			if !hasDoc {
+				continue
+			}
+			siblings = append(siblings, &sibling{
+				entry:    &Entry{Path: p, Parent: rel, IsDir: true, Name: name},
+				children: children,
+			})
+		case de.Type().IsRegular() && strings.EqualFold(path.Ext(name), docExt):
+			raw, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(p)))
+			if err != nil {
+				return nil, false, err
+			}
+			fm, body := ParseFrontMatter(raw)
+			entry := &Entry{
+				Path:    p,
+				Parent:  rel,
+				Name:    strings.TrimSuffix(name, path.Ext(name)),
+				Emoji:   fm.Emoji,
+				Content: string(body),
+				Hash:    HashContent(raw),
+			}
+			if fm.Title != "" {
+				entry.Name = fm.Title
+			}
+			siblings = append(siblings, &sibling{entry: entry, order: fm.Order})
+		}
+	}
+
+	sort.SliceStable(siblings, func(i, j int) bool {
+		a, b := siblings[i], siblings[j]
+		if (a.order == nil) != (b.order == nil) {
+			return a.order != nil
+		}
+		if a.order != nil && *a.order != *b.order {
+			return *a.order < *b.order
+		}
+		return a.entry.Path < b.entry.Path
+	})
+	var next float64
+	for _, s := range siblings {
+		if s.order != nil {
+			s.entry.Position = max(*s.order, 0)
+		} else {
+			s.entry.Position = next
+		}
+		next = s.entry.Position + 1
+	}
+
+	entries := make([]*Entry, 0, len(siblings))
+	for _, s := range siblings {
+		entries = append(entries, s.entry)
+	}
+	for _, s := range siblings {
+		entries = append(entries, s.children...)
+	}
+	return entries, len(siblings) > 0, nil
+}
+
+// ParseFrontMatter splits an optional `---` delimited yaml header from the body.
+// A malformed header is kept as part of the body.
+func ParseFrontMatter(raw []byte) (FrontMatter, []byte) {
+	var fm FrontMatter
+	data := bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	if !bytes.HasPrefix(data, []byte("---\n")) {
+		return fm, data
+	}
+	header, body, ok := bytes.Cut(data[3:], []byte("\n---"))
+	if !ok {
+		return fm, data
+	}
+	if len(body) > 0 && body[0] != '\n' {
+		return fm, data
+	}
+	if err := yaml.Unmarshal(header, &fm); err != nil {
+		return FrontMatter{}, data
+	}
+	return fm, bytes.TrimPrefix(body, []byte("\n"))
+}
+
+// RenderDoc writes a markdown doc with its front-matter header.
+func RenderDoc(fm FrontMatter, body string) ([]byte, error) {
+	header, err := yaml.Marshal(&fm)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	buf.Write(header)
+	buf.WriteString("---\n")
+	buf.WriteString(body)
+	if !strings.HasSuffix(body, "\n") {
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// FileName turns a node name into a safe file or folder name.
+func FileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '-'
+		}
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		name = "untitled"
+	}
+	return name
+}
+
+// HashContent returns the hash Scan records for a file with content raw.
+func HashContent(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,245 @@
+package ldap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/chaitin/panda-wiki/log"
+)
+
+// 分页查询的页大小，避免触发服务器的结果数量限制
+const searchPageSize = 500
+
+// 未配置组成员属性时读取的属性：groupOfNames、groupOfUniqueNames 和 posixGroup
+var defaultGroupMemberAttrs = []string{"member", "uniqueMember", "memberUid"}
+
+type GroupInfo struct {
+	DN      string   `json:"dn"`
+	Name    string   `json:"name"`
+	Members []string `json:"members"` // 成员属性的原始值，可能是用户或组的DN，也可能是 memberUid 中的用户ID
+
+	// 以下字段由 Resolve 计算
+	ParentDN string   `json:"parent_dn"` // 嵌套时所属的上级组
+	UserDNs  []string `json:"user_dns"`  // 直接成员中的用户
+}
+
+// Directory 是目录中用户和组的快照
+type Directory struct {
+	Users    []*UserInfo
+	Groups   []*GroupInfo
+	Warnings []string
+}
+
+// Snapshot 拉取用户基础DN下的全部用户和组基础DN下的全部组，并解析组的嵌套关系和成员
+func (c *Client) Snapshot() (*Directory, error) {
+	conn, err := ldap.DialURL(c.config.ServerURL)
+	if err != nil {
+		c.logger.Error("failed to connect to LDAP server", log.Error(err))
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(c.config.BindDN, c.config.BindPassword); err != nil {
+		c.logger.Error("failed to bind with admin credentials", log.Error(err))
+		return nil, fmt.Errorf("failed to bind with admin credentials: %w", err)
+	}
+
+	users, err := c.searchUsers(conn)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := c.searchGroups(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := &Directory{Users: users, Groups: groups}
+	dir.Warnings = dir.Resolve()
+	for _, warning := range dir.Warnings {
+		c.logger.Warn("resolve LDAP groups", log.String("warning", warning))
+	}
+	c.logger.Info("LDAP directory loaded",
+		log.Int("users", len(users)),
+		log.Int("groups", len(groups)))
+	return dir, nil
+}
+
+// searchUsers 用 "*" 替换用户查询过滤器中的用户名，列出全部用户
+func (c *Client) searchUsers(conn *ldap.Conn) ([]*UserInfo, error) {
+	filter := c.config.UserFilter
+	if strings.Contains(filter, "%s") {
+		filter = fmt.Sprintf(filter, "*")
+	}
+	searchResult, err := conn.SearchWithPaging(ldap.NewSearchRequest(
+		c.config.UserBaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		0,
+		false,
+		filter,
+		[]string{c.config.UserIDAttr, c.config.UserNameAttr, c.config.UserEmailAttr, c.config.GroupAttr},
+		nil,
+	), searchPageSize)
+	if err != nil {
+		c.logger.Error("users search failed", log.Error(err))
+		return nil, fmt.Errorf("users search failed: %w", err)
+	}
+
+	users := make([]*UserInfo, 0, len(searchResult.Entries))
+	for _, entry := range searchResult.Entries {
+		userInfo := &UserInfo{
+			DN:       entry.DN,
+			ID:       c.getAttributeValue(entry, c.config.UserIDAttr),
+			Username: c.getAttributeValue(entry, c.config.UserNameAttr),
+			Email:    c.getAttributeValue(entry, c.config.UserEmailAttr),
+			Groups:   entry.GetAttributeValues(c.config.GroupAttr),
+		}
+		if userInfo.Username == "" {
+			userInfo.Username = userInfo.ID
+		}
+		users = append(users, userInfo)
+	}
+	return users, nil
+}
+
+func (c *Client) searchGroups(conn *ldap.Conn) ([]*GroupInfo, error) {
+	memberAttrs := defaultGroupMemberAttrs
+	if c.config.GroupMemberAttr != "" {
+		memberAttrs = []string{c.config.GroupMemberAttr}
+	}
+	searchResult, err := conn.SearchWithPaging(ldap.NewSearchRequest(
+		c.config.GroupBaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		0,
+		false,
+		c.config.GroupFilter,
+		append([]string{c.config.GroupNameAttr}, memberAttrs...),
+		nil,
+	), searchPageSize)
+	if err != nil {
+		c.logger.Error("groups search failed", log.Error(err))
+		return nil, fmt.Errorf("groups search failed: %w", err)
+	}
+
+	groups := make([]*GroupInfo, 0, len(searchResult.Entries))
+	for _, entry := range searchResult.Entries {
+		group := &GroupInfo{
+			DN:   entry.DN,
+			Name: c.getAttributeValue(entry, c.config.GroupNameAttr),
+		}
+		if group.Name == "" {
+			group.Name = entry.DN
+		}
+		for _, attr := range memberAttrs {
+			group.Members = append(group.Members, entry.GetAttributeValues(attr)...)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// Resolve 根据组的成员计算组的嵌套关系和直接成员中的用户，返回解析时的告警。
+// 成员是另一个组时，该组嵌套在当前组下；一个组嵌套在多个组下时只保留DN排序最小的上级，
+// 形成环的嵌套被忽略。不在用户基础DN下的成员被忽略。
+func (d *Directory) Resolve() []string {
+	sort.Slice(d.Groups, func(i, j int) bool { return NormalizeDN(d.Groups[i].DN) < NormalizeDN(d.Groups[j].DN) })
+
+	usersByDN := make(map[string]*UserInfo, len(d.Users))
+	usersByID := make(map[string]*UserInfo, len(d.Users))
+	for _, user := range d.Users {
+		usersByDN[NormalizeDN(user.DN)] = user
+		if user.ID != "" {
+			usersByID[strings.ToLower(user.ID)] = user
+		}
+	}
+	groupsByDN := make(map[string]*GroupInfo, len(d.Groups))
+	for _, group := range d.Groups {
+		groupsByDN[NormalizeDN(group.DN)] = group
+	}
+
+	parents := make(map[*GroupInfo][]*GroupInfo)
+	for _, group := range d.Groups {
+		group.ParentDN = ""
+		group.UserDNs = nil
+		seen := make(map[string]bool)
+		for _, member := range group.Members {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+			var user *UserInfo
+			if strings.Contains(member, "=") {
+				key := NormalizeDN(member)
+				if child, ok := groupsByDN[key]; ok {
+					if child != group {
+						parents[child] = append(parents[child], group)
+					}
+					continue
+				}
+				user = usersByDN[key]
+			} else {
+				// posixGroup 的 memberUid 中是用户ID
+				user = usersByID[strings.ToLower(member)]
+			}
+			if user != nil && !seen[user.DN] {
+				seen[user.DN] = true
+				group.UserDNs = append(group.UserDNs, user.DN)
+			}
+		}
+	}
+
+	var warnings []string
+	for _, group := range d.Groups {
+		candidates := parents[group]
+		for _, parent := range candidates {
+			if d.isAncestor(group, parent, groupsByDN) {
+				warnings = append(warnings, fmt.Sprintf("nesting %s under %s forms a cycle, ignored", group.DN, parent.DN))
+				continue
+			}
+			group.ParentDN = parent.DN
+			break
+		}
+		if len(candidates) > 1 && group.ParentDN != "" {
+			warnings = append(warnings, fmt.Sprintf("%s is nested in %d groups, kept under %s", group.DN, len(candidates), group.ParentDN))
+		}
+	}
+	return warnings
+}
+
+// isAncestor 判断 group 是否是 target 或 target 的上级组
+func (d *Directory) isAncestor(group, target *GroupInfo, groupsByDN map[string]*GroupInfo) bool {
+	for current := target; current != nil; {
+		if current == group {
+			return true
+		}
+		if current.ParentDN == "" {
+			return false
+		}
+		current = groupsByDN[NormalizeDN(current.ParentDN)]
+	}
+	return false
+}
+
+// NormalizeDN 返回用于比较的DN形式：属性名和值转为小写，去掉分隔符两侧的空格
+func NormalizeDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(dn))
+	}
+	rdns := make([]string, 0, len(parsed.RDNs))
+	for _, rdn := range parsed.RDNs {
+		attrs := make([]string, 0, len(rdn.Attributes))
+		for _, attr := range rdn.Attributes {
+			attrs = append(attrs, strings.ToLower(attr.Type)+"="+strings.ToLower(attr.Value))
+		}
+		sort.Strings(attrs)
+		rdns = append(rdns, strings.Join(attrs, "+"))
+	}
+	return strings.Join(rdns, ",")
+}
@@ -0,0 +1,60 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectoryResolve(t *testing.T) {
+	dir := &Directory{
+		Users: []*UserInfo{
+			{DN: "uid=alice,ou=People,dc=example,dc=com", ID: "alice"},
+			{DN: "uid=bob,ou=People,dc=example,dc=com", ID: "bob"},
+			{DN: "uid=carol,ou=People,dc=example,dc=com", ID: "carol"},
+		},
+		Groups: []*GroupInfo{
+			{DN: "cn=eng,ou=Groups,dc=example,dc=com", Members: []string{
+				"UID=alice, ou=people, dc=example, dc=com",
+				"cn=backend,ou=Groups,dc=example,dc=com",
+				"uid=mallory,ou=Other,dc=example,dc=com",
+				"cn=ops,ou=Groups,dc=example,dc=com",
+			}},
+			{DN: "cn=backend,ou=Groups,dc=example,dc=com", Members: []string{
+				"uid=bob,ou=People,dc=example,dc=com",
+				"cn=eng,ou=Groups,dc=example,dc=com",
+			}},
+			{DN: "cn=all,ou=Groups,dc=example,dc=com", Members: []string{
+				"cn=ops,ou=Groups,dc=example,dc=com",
+			}},
+			{DN: "cn=ops,ou=Groups,dc=example,dc=com", Members: []string{"carol", "Bob", "carol"}},
+		},
+	}
+
+	warnings := dir.Resolve()
+	groups := make(map[string]*GroupInfo)
+	for _, group := range dir.Groups {
+		groups[group.DN] = group
+	}
+
+	require.Equal(t, "cn=eng,ou=Groups,dc=example,dc=com", groups["cn=backend,ou=Groups,dc=example,dc=com"].ParentDN)
+	require.Equal(t, []string{"uid=bob,ou=People,dc=example,dc=com"}, groups["cn=backend,ou=Groups,dc=example,dc=com"].UserDNs)
+	// eng is a member of backend as well, which would close a cycle
+	require.Empty(t, groups["cn=eng,ou=Groups,dc=example,dc=com"].ParentDN)
+	require.Equal(t, []string{"uid=alice,ou=People,dc=example,dc=com"}, groups["cn=eng,ou=Groups,dc=example,dc=com"].UserDNs)
+	require.Empty(t, groups["cn=all,ou=Groups,dc=example,dc=com"].ParentDN)
+	require.Empty(t, groups["cn=all,ou=Groups,dc=example,dc=com"].UserDNs)
+	// ops is nested in both all and eng, all sorts first
+	require.Equal(t, "cn=all,ou=Groups,dc=example,dc=com", groups["cn=ops,ou=Groups,dc=example,dc=com"].ParentDN)
+	// memberUid values are matched against the user ids
+	require.Equal(t, []string{"uid=carol,ou=People,dc=example,dc=com", "uid=bob,ou=People,dc=example,dc=com"}, groups["cn=ops,ou=Groups,dc=example,dc=com"].UserDNs)
+
+	require.Len(t, warnings, 2)
+	require.Contains(t, warnings[0], "cycle")
+	require.Contains(t, warnings[1], "nested in 2 groups")
+}
+
+func TestNormalizeDN(t *testing.T) {
+	require.Equal(t, "cn=a+uid=b,dc=example,dc=com", NormalizeDN("UID=B+CN=a, DC=Example,dc=com"))
+	require.Equal(t, "not a dn", NormalizeDN(" Not a DN "))
+}
@@ -25,20 +25,31 @@ type Config struct {
 	UserIDAttr    string `json:"user_id_attr"`    // 用户ID属性，默认 uid
 	UserNameAttr  string `json:"user_name_attr"`  // 用户名属性，默认 cn
 	UserEmailAttr string `json:"user_email_attr"` // 用户邮箱属性，默认 mail
+	GroupAttr     string `json:"group_attr"`      // 用户所属组属性，默认 memberOf
+
+	// 以下配置仅用于目录同步
+	GroupBaseDN     string `json:"group_base_dn"`     // 组基础DN，默认与 UserBaseDN 相同
+	GroupFilter     string `json:"group_filter"`      // 组查询过滤器，默认匹配 groupOfNames、groupOfUniqueNames、group 和 posixGroup
+	GroupNameAttr   string `json:"group_name_attr"`   // 组名属性，默认 cn
+	GroupMemberAttr string `json:"group_member_attr"` // 组成员属性，默认同时读取 member、uniqueMember 和 memberUid
 }
 
 type UserInfo struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	DN       string `json:"dn"` // Distinguished Name
+	ID       string   `json:"id"`
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	DN       string   `json:"dn"`     // Distinguished Name
+	Groups   []string `json:"groups"` // 用户所属组的DN
 }
 
 const (
 	defaultUserIDAttr    = "uid"
 	defaultUserNameAttr  = "cn"
 	defaultUserEmailAttr = "mail"
+	defaultGroupAttr     = "memberOf"
 	defaultUserFilter    = "(&(objectClass=person)(uid=%s))"
+	defaultGroupFilter   = "(|(objectClass=groupOfNames)(objectClass=groupOfUniqueNames)(objectClass=group)(objectClass=posixGroup))"
+	defaultGroupNameAttr = "cn"
 )
 
 // NewClient 创建LDAP客户端
@@ -56,6 +67,18 @@ func NewClient(ctx context.Context, logger *log.Logger, config Config) (*Client,
 	if config.UserFilter == "" {
 		config.UserFilter = defaultUserFilter
 	}
+	if config.GroupAttr == "" {
+		config.GroupAttr = defaultGroupAttr
+	}
+	if config.GroupBaseDN == "" {
+		config.GroupBaseDN = config.UserBaseDN
+	}
+	if config.GroupFilter == "" {
+		config.GroupFilter = defaultGroupFilter
+	}
+	if config.GroupNameAttr == "" {
+		config.GroupNameAttr = defaultGroupNameAttr
+	}
 
 	// 验证必需的配置
 	if config.ServerURL == "" {
@@ -77,6 +100,11 @@ func NewClient(ctx context.Context, logger *log.Logger, config Config) (*Client,
 
 // Authenticate 验证用户凭据并获取用户信息
 func (c *Client) Authenticate(username, password string) (*UserInfo, error) {
+	// 空密码会被服务器当作匿名绑定而成功
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("authentication failed: invalid credentials")
+	}
+
 	// 连接到LDAP服务器
 	conn, err := ldap.DialURL(c.config.ServerURL)
 	if err != nil {
@@ -118,7 +146,7 @@ func (c *Client) Authenticate(username, password string) (*UserInfo, error) {
 // searchUser 搜索用户信息
 func (c *Client) searchUser(conn *ldap.Conn, username string) (*UserInfo, error) {
 	// 构建搜索过滤器
-	filter := fmt.Sprintf(c.config.UserFilter, username)
+	filter := fmt.Sprintf(c.config.UserFilter, ldap.EscapeFilter(username))
 
 	// 构建搜索请求
 	searchRequest := ldap.NewSearchRequest(
@@ -129,7 +157,7 @@ func (c *Client) searchUser(conn *ldap.Conn, username string) (*UserInfo, error)
 		0, // 不限制搜索时间
 		false,
 		filter,
-		[]string{c.config.UserIDAttr, c.config.UserNameAttr, c.config.UserEmailAttr},
+		[]string{c.config.UserIDAttr, c.config.UserNameAttr, c.config.UserEmailAttr, c.config.GroupAttr},
 		nil,
 	)
 
@@ -164,6 +192,7 @@ func (c *Client) searchUser(conn *ldap.Conn, username string) (*UserInfo, error)
 		ID:       c.getAttributeValue(entry, c.config.UserIDAttr),
 		Username: c.getAttributeValue(entry, c.config.UserNameAttr),
 		Email:    c.getAttributeValue(entry, c.config.UserEmailAttr),
+		Groups:   entry.GetAttributeValues(c.config.GroupAttr),
 	}
 
 	// 如果没有获取到用户名，使用ID作为用户名
@@ -0,0 +1,93 @@
+// Package merge implements a line based three-way merge of text documents.
+package merge
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Merge3 merges the changes ours and theirs made to base. Hunks changed on one side only take
+// that side, hunks changed the same way on both sides are taken once. It returns false when both
+// sides changed the same hunk differently.
+func Merge3(base, ours, theirs string) (string, bool) {
+	if ours == theirs || theirs == base {
+		return ours, true
+	}
+	if ours == base {
+		return theirs, true
+	}
+
+	o, a, b := splitLines(base), splitLines(ours), splitLines(theirs)
+	matchA, matchB := matches(o, a), matches(o, b)
+
+	var result []string
+	io, ia, ib := 0, 0, 0
+	for io < len(o) || ia < len(a) || ib < len(b) {
+		// lines unchanged on both sides
+		n := 0
+		for io+n < len(o) && matchA[io+n] == ia+n && matchB[io+n] == ib+n {
+			n++
+		}
+		if n > 0 {
+			result = append(result, o[io:io+n]...)
+			io, ia, ib = io+n, ia+n, ib+n
+			continue
+		}
+
+		// the changed hunk runs up to the next base line both sides kept
+		next := io
+		for next < len(o) && (matchA[next] < 0 || matchB[next] < 0) {
+			next++
+		}
+		endA, endB := len(a), len(b)
+		if next < len(o) {
+			endA, endB = matchA[next], matchB[next]
+		}
+		hunk, ok := mergeHunk(o[io:next], a[ia:endA], b[ib:endB])
+		if !ok {
+			return "", false
+		}
+		result = append(result, hunk...)
+		io, ia, ib = next, endA, endB
+	}
+	return strings.Join(result, ""), true
+}
+
+func mergeHunk(o, a, b []string) ([]string, bool) {
+	switch {
+	case slices.Equal(a, b), slices.Equal(o, b):
+		return a, true
+	case slices.Equal(o, a):
+		return b, true
+	}
+	return nil, false
+}
+
+// matches maps each line of o to the line of x it is matched with, -1 when it was removed.
+func matches(o, x []string) []int {
+	result := make([]int, len(o))
+	for i := range result {
+		result[i] = -1
+	}
+	matcher := difflib.NewMatcherWithJunk(o, x, false, nil)
+	for _, block := range matcher.GetMatchingBlocks() {
+		for k := 0; k < block.Size; k++ {
+			result[block.A+k] = block.B + k
+		}
+	}
+	return result
+}
+
+// splitLines keeps the line endings so joining the lines restores the text.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,53 @@
+package merge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge3(t *testing.T) {
+	base := "# Title\n\nintro\n\n## Install\n\nrun make\n\n## Usage\n\nrun it\n"
+
+	// edits in different sections are combined
+	ours := "# Title\n\nnew intro\n\n## Install\n\nrun make\n\n## Usage\n\nrun it\n"
+	theirs := "# Title\n\nintro\n\n## Install\n\nrun make\n\n## Usage\n\nrun it twice\n"
+	merged, ok := Merge3(base, ours, theirs)
+	assert.True(t, ok)
+	assert.Equal(t, "# Title\n\nnew intro\n\n## Install\n\nrun make\n\n## Usage\n\nrun it twice\n", merged)
+
+	// insertions on both sides at different places
+	ours = "# Title\n\nintro\n\n## Install\n\nrun make\nrun make install\n\n## Usage\n\nrun it\n"
+	theirs = base + "\n## License\n\nMIT\n"
+	merged, ok = Merge3(base, ours, theirs)
+	assert.True(t, ok)
+	assert.Equal(t, "# Title\n\nintro\n\n## Install\n\nrun make\nrun make install\n\n## Usage\n\nrun it\n\n## License\n\nMIT\n", merged)
+
+	// the same change on both sides is taken once
+	merged, ok = Merge3(base, theirs, theirs)
+	assert.True(t, ok)
+	assert.Equal(t, theirs, merged)
+
+	// a deletion on one side and an unrelated edit on the other
+	ours = "# Title\n\n## Install\n\nrun make\n\n## Usage\n\nrun it\n"
+	theirs = "# Title\n\nintro\n\n## Install\n\nrun make\n\n## Usage\n\nrun it twice\n"
+	merged, ok = Merge3(base, ours, theirs)
+	assert.True(t, ok)
+	assert.Equal(t, "# Title\n\n## Install\n\nrun make\n\n## Usage\n\nrun it twice\n", merged)
+
+	// both sides rewrote the same line
+	ours = "# Title\n\nour intro\n\n## Install\n\nrun make\n\n## Usage\n\nrun it\n"
+	theirs = "# Title\n\ntheir intro\n\n## Install\n\nrun make\n\n## Usage\n\nrun it\n"
+	_, ok = Merge3(base, ours, theirs)
+	assert.False(t, ok)
+}
+
+func TestMerge3TrailingNewline(t *testing.T) {
+	merged, ok := Merge3("a\nb\nc", "a\nb\nc\n", "x\nb\nc")
+	assert.True(t, ok)
+	assert.Equal(t, "x\nb\nc\n", merged)
+
+	merged, ok = Merge3("", "a\n", "")
+	assert.True(t, ok)
+	assert.Equal(t, "a\n", merged)
+}
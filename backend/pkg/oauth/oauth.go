@@ -36,17 +36,24 @@ type Config struct {
 	NameField    string   `json:"name_field,omitempty"`
 	AvatarField  string   `json:"avatar_field,omitempty"`
 	EmailField   string   `json:"email_field,omitempty"`
+	GroupsField  string   `json:"groups_field,omitempty"` // gjson path of the groups of the user
+	CallbackPath string   `json:"-"`                      // defaults to the callback of the share site
 }
 type UserInfo struct {
-	ID        string `json:"id"`
-	Name      string `json:"name"`
-	Email     string `json:"email"`
-	AvatarUrl string `json:"avatar_url"`
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Email     string   `json:"email"`
+	AvatarUrl string   `json:"avatar_url"`
+	Groups    []string `json:"groups,omitempty"`
 }
 
 // NewClient 创建OAuth客户端
 func NewClient(ctx context.Context, logger *log.Logger, baseUrl string, config Config) (*Client, error) {
-	redirectURI, err := url.JoinPath(baseUrl, callbackPath)
+	path := callbackPath
+	if config.CallbackPath != "" {
+		path = config.CallbackPath
+	}
+	redirectURI, err := url.JoinPath(baseUrl, path)
 	if err != nil {
 		return nil, err
 	}
@@ -101,10 +108,17 @@ func (c *Client) GetUserInfo(code string) (*UserInfo, error) {
 		}
 	}
 
-	return &UserInfo{
+	userInfo := &UserInfo{
 		ID:        gjson.Get(jsonString, c.config.IDField).String(),
 		AvatarUrl: gjson.Get(jsonString, c.config.AvatarField).String(),
 		Name:      gjson.Get(jsonString, c.config.NameField).String(),
 		Email:     email,
-	}, nil
+	}
+	if c.config.GroupsField != "" {
+		// the field is either an array or a single group
+		for _, group := range gjson.Get(jsonString, c.config.GroupsField).Array() {
+			userInfo.Groups = append(userInfo.Groups, group.String())
+		}
+	}
+	return userInfo, nil
 }
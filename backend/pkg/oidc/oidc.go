@@ -0,0 +1,318 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+
+	"github.com/chaitin/panda-wiki/log"
+)
+
+const (
+	CallbackPath = "/share/v1/openapi/oidc/callback"
+
+	// clockSkew is tolerated on the exp, iat and nbf of ID tokens.
+	clockSkew = 3 * time.Minute
+)
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+var defaultScopes = []string{"openid", "profile", "email"}
+
+// Provider is the part of the discovery document we use.
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Client struct {
+	ctx        context.Context
+	logger     *log.Logger
+	oauth      *oauth2.Config
+	httpClient *http.Client
+	provider   *Provider
+}
+
+type UserInfo struct {
+	Subject   string
+	Name      string
+	Email     string
+	AvatarUrl string
+	Groups    []string
+}
+
+// NewClient discovers the provider of issuer, the callback is served under baseUrl.
+func NewClient(ctx context.Context, logger *log.Logger, baseUrl, issuer, clientID, clientSecret, proxyURL string, scopes []string) (*Client, error) {
+	redirectURI, err := url.JoinPath(baseUrl, CallbackPath)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	if proxyURL != "" {
+		proxyURLParsed, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		httpClient.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURLParsed)}
+		logger.Info("OIDC client configured with proxy", log.String("proxy", proxyURL))
+	}
+
+	c := &Client{
+		ctx:        context.WithValue(ctx, oauth2.HTTPClient, httpClient),
+		logger:     logger.WithModule("pkg.oidc"),
+		httpClient: httpClient,
+	}
+	if c.provider, err = c.discover(issuer); err != nil {
+		return nil, err
+	}
+
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	} else if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	c.oauth = &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  c.provider.AuthorizationEndpoint,
+			TokenURL: c.provider.TokenEndpoint,
+		},
+		RedirectURL: redirectURI,
+		Scopes:      scopes,
+	}
+	return c, nil
+}
+
+func (c *Client) discover(issuer string) (*Provider, error) {
+	issuer = strings.TrimSuffix(strings.TrimSpace(issuer), "/")
+	var provider Provider
+	if err := c.getJSON(issuer+"/.well-known/openid-configuration", &provider); err != nil {
+		return nil, fmt.Errorf("discover oidc provider failed: %w", err)
+	}
+	if strings.TrimSuffix(provider.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovered issuer %s does not match %s", provider.Issuer, issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, errors.New("incomplete oidc discovery document")
+	}
+	return &provider, nil
+}
+
+func (c *Client) getJSON(u string, v any) error {
+	resp, err := c.httpClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// GetAuthorizeURL returns the authorization code URL with a PKCE S256 challenge of verifier
+// and the nonce the ID token must carry.
+func (c *Client) GetAuthorizeURL(state, nonce, verifier string) string {
+	return c.oauth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oauth2.SetAuthURLParam("nonce", nonce))
+}
+
+// GetUserInfo exchanges the code and returns the user of the verified ID token, completed
+// with the userinfo endpoint. groupsClaim names the claim holding the groups of the user.
+func (c *Client) GetUserInfo(code, nonce, verifier, groupsClaim string) (*UserInfo, error) {
+	token, err := c.oauth.Exchange(c.ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("%w: missing from token response", ErrInvalidIDToken)
+	}
+	claims, err := c.VerifyIDToken(rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.provider.UserinfoEndpoint != "" {
+		extra, err := c.getUserInfoClaims(token, claims["sub"])
+		if err != nil {
+			c.logger.Warn("get oidc userinfo failed", log.Error(err))
+		}
+		// the ID token wins over the userinfo endpoint
+		for k, v := range extra {
+			if _, exists := claims[k]; !exists {
+				claims[k] = v
+			}
+		}
+	}
+
+	userInfo := &UserInfo{
+		Subject:   stringClaim(claims, "sub"),
+		Email:     stringClaim(claims, "email"),
+		Name:      stringClaim(claims, "name", "preferred_username", "nickname", "email"),
+		AvatarUrl: stringClaim(claims, "picture"),
+	}
+	if groupsClaim != "" {
+		userInfo.Groups = stringValues(claims[groupsClaim])
+	}
+	return userInfo, nil
+}
+
+func (c *Client) getUserInfoClaims(token *oauth2.Token, subject any) (map[string]any, error) {
+	resp, err := c.oauth.Client(c.ctx, token).Get(c.provider.UserinfoEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var claims map[string]any
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&claims); err != nil {
+		return nil, err
+	}
+	if claims["sub"] != subject {
+		return nil, errors.New("userinfo subject does not match the id token")
+	}
+	return claims, nil
+}
+
+// VerifyIDToken checks the signature of the ID token against the JWKS of the provider and
+// its issuer, audience, expiry and nonce.
+func (c *Client) VerifyIDToken(rawIDToken, nonce string) (jwt.MapClaims, error) {
+	var jwks JSONWebKeySet
+	if err := c.getJSON(c.provider.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("get jwks failed: %w", err)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, jwks.keyfunc,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(c.provider.Issuer),
+		jwt.WithAudience(c.oauth.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+	if nonce == "" || stringClaim(claims, "nonce") != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if stringClaim(claims, "sub") == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+type JSONWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func (s *JSONWebKeySet) keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	for _, key := range s.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		// a token without kid is only accepted when the provider has a single key
+		if key.Kid == kid || (kid == "" && len(s.Keys) == 1) {
+			return key.publicKey()
+		}
+	}
+	return nil, fmt.Errorf("no jwk found for kid %q", kid)
+}
+
+func (k JSONWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported jwk curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported jwk type %s", k.Kty)
+}
+
+func stringClaim(claims map[string]any, names ...string) string {
+	for _, name := range names {
+		if s, ok := claims[name].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// stringValues reads a claim that is either a string or an array of strings.
+func stringValues(v any) []string {
+	switch value := v.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
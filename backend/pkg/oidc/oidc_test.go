@@ -0,0 +1,185 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	pwlog "github.com/chaitin/panda-wiki/log"
+)
+
+type testProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	idToken  string
+	verifier string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &testProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(Provider{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize",
+			TokenEndpoint:         p.server.URL + "/token",
+			UserinfoEndpoint:      p.server.URL + "/userinfo",
+			JWKSURI:               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(JSONWebKeySet{Keys: []JSONWebKey{{
+			Kid: "key1",
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		p.verifier = r.PostForm.Get("code_verifier")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "access", "token_type": "Bearer", "id_token": p.idToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+		_ = json.NewEncoder(w).Encode(map[string]any{"sub": "user1", "email": "other@example.com", "picture": "https://example.com/a.png"})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *testProvider) sign(t *testing.T, claims jwt.MapClaims, kid string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(p.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func (p *testProvider) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":    p.server.URL,
+		"aud":    "client1",
+		"sub":    "user1",
+		"exp":    now.Add(time.Hour).Unix(),
+		"iat":    now.Unix(),
+		"nonce":  nonce,
+		"email":  "alice@example.com",
+		"name":   "Alice",
+		"groups": []string{"engineering", "wiki-admins"},
+	}
+}
+
+func newTestClient(t *testing.T, p *testProvider) *Client {
+	logger := &pwlog.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	c, err := NewClient(context.Background(), logger, "https://wiki.example.com", p.server.URL+"/", "client1", "secret1", "", nil)
+	require.NoError(t, err)
+	return c
+}
+
+func TestGetAuthorizeURL(t *testing.T) {
+	c := newTestClient(t, newTestProvider(t))
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := url.Parse(c.GetAuthorizeURL("state1", "nonce1", verifier))
+	require.NoError(t, err)
+	query := authURL.Query()
+	require.Equal(t, "state1", query.Get("state"))
+	require.Equal(t, "nonce1", query.Get("nonce"))
+	require.Equal(t, "S256", query.Get("code_challenge_method"))
+	require.Equal(t, oauth2.S256ChallengeFromVerifier(verifier), query.Get("code_challenge"))
+	require.Equal(t, "https://wiki.example.com"+CallbackPath, query.Get("redirect_uri"))
+	require.Equal(t, "openid profile email", query.Get("scope"))
+}
+
+func TestGetUserInfo(t *testing.T) {
+	p := newTestProvider(t)
+	c := newTestClient(t, p)
+	verifier := oauth2.GenerateVerifier()
+	p.idToken = p.sign(t, p.claims("nonce1"), "key1")
+
+	userInfo, err := c.GetUserInfo("code1", "nonce1", verifier, "groups")
+	require.NoError(t, err)
+	require.Equal(t, verifier, p.verifier)
+	require.Equal(t, &UserInfo{
+		Subject:   "user1",
+		Name:      "Alice",
+		Email:     "alice@example.com",
+		AvatarUrl: "https://example.com/a.png",
+		Groups:    []string{"engineering", "wiki-admins"},
+	}, userInfo)
+
+	_, err = c.GetUserInfo("code1", "nonce2", verifier, "groups")
+	require.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	p := newTestProvider(t)
+	c := newTestClient(t, p)
+
+	_, err := c.VerifyIDToken(p.sign(t, p.claims("nonce1"), "key1"), "nonce1")
+	require.NoError(t, err)
+
+	claims := p.claims("nonce1")
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	_, err = c.VerifyIDToken(p.sign(t, claims, "key1"), "nonce1")
+	require.NoError(t, err, "expiry within the clock skew")
+
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = c.VerifyIDToken(p.sign(t, claims, "key1"), "nonce1")
+	require.ErrorIs(t, err, ErrInvalidIDToken)
+
+	claims = p.claims("nonce1")
+	claims["aud"] = "client2"
+	_, err = c.VerifyIDToken(p.sign(t, claims, "key1"), "nonce1")
+	require.ErrorIs(t, err, ErrInvalidIDToken)
+
+	claims = p.claims("nonce1")
+	claims["iss"] = "https://evil.example.com"
+	_, err = c.VerifyIDToken(p.sign(t, claims, "key1"), "nonce1")
+	require.ErrorIs(t, err, ErrInvalidIDToken)
+
+	_, err = c.VerifyIDToken(p.sign(t, p.claims("nonce1"), "key2"), "nonce1")
+	require.ErrorIs(t, err, ErrInvalidIDToken)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, p.claims("nonce1"))
+	forged.Header["kid"] = "key1"
+	signed, err := forged.SignedString(other)
+	require.NoError(t, err)
+	_, err = c.VerifyIDToken(signed, "nonce1")
+	require.ErrorIs(t, err, ErrInvalidIDToken)
+
+	hmacToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, p.claims("nonce1")).SignedString([]byte("secret1"))
+	require.NoError(t, err)
+	_, err = c.VerifyIDToken(hmacToken, "nonce1")
+	require.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestStringValues(t *testing.T) {
+	require.Equal(t, []string{"a"}, stringValues("a"))
+	require.Equal(t, []string{"a", "b"}, stringValues([]any{"a", 1, "b"}))
+	require.Nil(t, stringValues(nil))
+}
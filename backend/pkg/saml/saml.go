@@ -0,0 +1,465 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	bindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	bindingPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	statusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	methodBearer    = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	nameIDFormat    = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+
+	// MaxClockSkew is tolerated between the clocks of the IdP and ours when checking the
+	// validity window of an assertion.
+	MaxClockSkew = 3 * time.Minute
+)
+
+var ErrInvalidResponse = errors.New("invalid saml response")
+
+// IdentityProvider is what is needed from the metadata of the IdP.
+type IdentityProvider struct {
+	EntityID     string
+	SSOURL       string
+	Certificates []*x509.Certificate
+}
+
+type entityDescriptor struct {
+	EntityID string `xml:"entityID,attr"`
+	IDPSSO   *struct {
+		KeyDescriptors []struct {
+			Use         string `xml:"use,attr"`
+			Certificate string `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo>X509Data>X509Certificate"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+		SingleSignOnServices []struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:metadata IDPSSODescriptor"`
+}
+
+// ParseIdPMetadata reads an EntityDescriptor, or the first IdP of an EntitiesDescriptor.
+func ParseIdPMetadata(data []byte) (*IdentityProvider, error) {
+	var root struct {
+		XMLName xml.Name
+		entityDescriptor
+		Entities []entityDescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid idp metadata: %w", err)
+	}
+	var descriptor *entityDescriptor
+	switch root.XMLName {
+	case xml.Name{Space: nsMetadata, Local: "EntityDescriptor"}:
+		descriptor = &root.entityDescriptor
+	case xml.Name{Space: nsMetadata, Local: "EntitiesDescriptor"}:
+		for i := range root.Entities {
+			if root.Entities[i].IDPSSO != nil {
+				descriptor = &root.Entities[i]
+				break
+			}
+		}
+	}
+	if descriptor == nil || descriptor.IDPSSO == nil {
+		return nil, errors.New("invalid idp metadata: no IDPSSODescriptor")
+	}
+
+	idp := &IdentityProvider{EntityID: descriptor.EntityID}
+	for _, sso := range descriptor.IDPSSO.SingleSignOnServices {
+		if sso.Binding == bindingRedirect {
+			idp.SSOURL = sso.Location
+			break
+		}
+	}
+	for _, key := range descriptor.IDPSSO.KeyDescriptors {
+		if key.Use != "" && key.Use != "signing" {
+			continue
+		}
+		der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(key.Certificate), ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid idp certificate: %w", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid idp certificate: %w", err)
+		}
+		idp.Certificates = append(idp.Certificates, cert)
+	}
+	if idp.EntityID == "" || idp.SSOURL == "" {
+		return nil, errors.New("invalid idp metadata: entityID and HTTP-Redirect SingleSignOnService are required")
+	}
+	if len(idp.Certificates) == 0 {
+		return nil, errors.New("invalid idp metadata: no signing certificate")
+	}
+	return idp, nil
+}
+
+// FetchIdPMetadata downloads the metadata of the IdP, through proxyURL when set.
+func FetchIdPMetadata(ctx context.Context, metadataURL, proxyURL string) ([]byte, error) {
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	if proxyURL != "" {
+		proxyURLParsed, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		httpClient.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURLParsed)}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch idp metadata: unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// GenerateKeyPair creates the self-signed certificate and key the SP signs AuthnRequests with.
+func GenerateKeyPair(commonName string) (certPEM, keyPEM string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	return certPEM, keyPEM, nil
+}
+
+// ServiceProvider is the SP of one knowledge base.
+type ServiceProvider struct {
+	EntityID    string
+	ACSURL      string
+	Certificate *x509.Certificate
+	Key         *rsa.PrivateKey
+	IdP         *IdentityProvider
+}
+
+func NewServiceProvider(entityID, acsURL, certPEM, keyPEM string, idp *IdentityProvider) (*ServiceProvider, error) {
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	if certBlock == nil {
+		return nil, errors.New("invalid sp certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sp certificate: %w", err)
+	}
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if keyBlock == nil {
+		return nil, errors.New("invalid sp private key")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sp private key: %w", err)
+	}
+	return &ServiceProvider{
+		EntityID:    entityID,
+		ACSURL:      acsURL,
+		Certificate: cert,
+		Key:         key,
+		IdP:         idp,
+	}, nil
+}
+
+// Metadata returns the SP metadata to be imported into the IdP.
+func (sp *ServiceProvider) Metadata() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<md:EntityDescriptor xmlns:md="%s" entityID="%s">`, nsMetadata, escapeAttr(sp.EntityID))
+	fmt.Fprintf(&buf, `<md:SPSSODescriptor AuthnRequestsSigned="true" WantAssertionsSigned="true" protocolSupportEnumeration="%s">`, nsProtocol)
+	fmt.Fprintf(&buf, `<md:KeyDescriptor use="signing"><ds:KeyInfo xmlns:ds="%s"><ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>`,
+		nsDSig, base64.StdEncoding.EncodeToString(sp.Certificate.Raw))
+	fmt.Fprintf(&buf, `<md:NameIDFormat>%s</md:NameIDFormat>`, nameIDFormat)
+	fmt.Fprintf(&buf, `<md:AssertionConsumerService Binding="%s" Location="%s" index="0" isDefault="true"/>`, bindingPOST, escapeAttr(sp.ACSURL))
+	buf.WriteString(`</md:SPSSODescriptor></md:EntityDescriptor>`)
+	return buf.Bytes()
+}
+
+// NewRequestID returns a random AuthnRequest ID, it must be kept to check the InResponseTo
+// of the response.
+func NewRequestID() string {
+	id := make([]byte, 20)
+	_, _ = rand.Read(id)
+	return "_" + hex.EncodeToString(id)
+}
+
+// AuthnRequestURL builds the HTTP-Redirect binding URL of a signed AuthnRequest.
+func (sp *ServiceProvider) AuthnRequestURL(requestID, relayState string, now time.Time) (string, error) {
+
+	request := fmt.Sprintf(`<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="%s">`+
+		`<saml:Issuer>%s</saml:Issuer><samlp:NameIDPolicy Format="%s" AllowCreate="true"/></samlp:AuthnRequest>`,
+		nsProtocol, nsAssertion, requestID, now.UTC().Format(time.RFC3339), escapeAttr(sp.IdP.SSOURL), escapeAttr(sp.ACSURL), bindingPOST,
+		escapeText(sp.EntityID), nameIDFormat)
+
+	var deflated bytes.Buffer
+	writer, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write([]byte(request)); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	// the signature covers the parameters in this exact order
+	query := "SAMLRequest=" + url.QueryEscape(base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	if relayState != "" {
+		query += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	query += "&SigAlg=" + url.QueryEscape(algRSASHA256)
+	hashed := sha256.Sum256([]byte(query))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, sp.Key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	query += "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(signature))
+
+	separator := "?"
+	if strings.Contains(sp.IdP.SSOURL, "?") {
+		separator = "&"
+	}
+	return sp.IdP.SSOURL + separator + query, nil
+}
+
+// Assertion is the validated identity asserted by the IdP.
+type Assertion struct {
+	NameID     string
+	Attributes map[string][]string
+}
+
+// Value returns the first value of the first present attribute of names.
+func (a *Assertion) Value(names ...string) string {
+	for _, name := range names {
+		for _, value := range a.Attributes[name] {
+			if value = strings.TrimSpace(value); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+type samlResponse struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	InResponseTo string   `xml:"InResponseTo,attr"`
+	Destination  string   `xml:"Destination,attr"`
+	Issuer       string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	StatusCode   struct {
+		Value string `xml:"Value,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status>StatusCode"`
+	Assertions []samlAssertion `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+}
+
+type samlAssertion struct {
+	Issuer  string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject struct {
+		NameID               string `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+		SubjectConfirmations []struct {
+			Method string `xml:"Method,attr"`
+			Data   struct {
+				Recipient    string `xml:"Recipient,attr"`
+				InResponseTo string `xml:"InResponseTo,attr"`
+				NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+			} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions *struct {
+		NotBefore            string `xml:"NotBefore,attr"`
+		NotOnOrAfter         string `xml:"NotOnOrAfter,attr"`
+		AudienceRestrictions []struct {
+			Audiences []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+	Attributes []struct {
+		Name   string   `xml:"Name,attr"`
+		Values []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement>Attribute"`
+}
+
+// ParseResponse validates the base64 encoded SAMLResponse posted to the ACS. Either the
+// response or its assertion must be signed by the IdP and only the signed bytes are read.
+func (sp *ServiceProvider) ParseResponse(encoded, requestID string, now time.Time) (*Assertion, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	root, err := parseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if !root.is(nsProtocol, "Response") {
+		return nil, fmt.Errorf("%w: not a response", ErrInvalidResponse)
+	}
+	if root.child(nsAssertion, "EncryptedAssertion") != nil {
+		return nil, fmt.Errorf("%w: encrypted assertions are not supported", ErrInvalidResponse)
+	}
+	var assertionEl *element
+	for _, c := range root.children {
+		if el, ok := c.(*element); ok && el.is(nsAssertion, "Assertion") {
+			if assertionEl != nil {
+				return nil, fmt.Errorf("%w: multiple assertions", ErrInvalidResponse)
+			}
+			assertionEl = el
+		}
+	}
+	if assertionEl == nil {
+		return nil, fmt.Errorf("%w: no assertion", ErrInvalidResponse)
+	}
+
+	var response samlResponse
+	responseSigned := root.child(nsDSig, "Signature") != nil
+	if responseSigned {
+		signed, err := verifySignature(root, sp.IdP.Certificates)
+		if err != nil {
+			return nil, err
+		}
+		if err := xml.Unmarshal(signed, &response); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+		}
+	} else if err := xml.Unmarshal(canonicalize(root, nil, nil), &response); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if assertionEl.child(nsDSig, "Signature") != nil {
+		signed, err := verifySignature(assertionEl, sp.IdP.Certificates)
+		if err != nil {
+			return nil, err
+		}
+		var assertion samlAssertion
+		if err := xml.Unmarshal(signed, &assertion); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+		}
+		response.Assertions = []samlAssertion{assertion}
+	} else if !responseSigned {
+		return nil, fmt.Errorf("%w: neither the response nor the assertion is signed", ErrInvalidSignature)
+	}
+	if len(response.Assertions) != 1 {
+		return nil, fmt.Errorf("%w: no assertion", ErrInvalidResponse)
+	}
+
+	if response.StatusCode.Value != statusSuccess {
+		return nil, fmt.Errorf("%w: status %s", ErrInvalidResponse, response.StatusCode.Value)
+	}
+	if response.Destination != "" && response.Destination != sp.ACSURL {
+		return nil, fmt.Errorf("%w: unexpected destination %s", ErrInvalidResponse, response.Destination)
+	}
+	if response.InResponseTo != requestID {
+		return nil, fmt.Errorf("%w: unexpected InResponseTo", ErrInvalidResponse)
+	}
+	if response.Issuer != "" && response.Issuer != sp.IdP.EntityID {
+		return nil, fmt.Errorf("%w: unexpected issuer %s", ErrInvalidResponse, response.Issuer)
+	}
+	return sp.validateAssertion(&response.Assertions[0], requestID, now)
+}
+
+func (sp *ServiceProvider) validateAssertion(assertion *samlAssertion, requestID string, now time.Time) (*Assertion, error) {
+	if assertion.Issuer != sp.IdP.EntityID {
+		return nil, fmt.Errorf("%w: unexpected issuer %s", ErrInvalidResponse, assertion.Issuer)
+	}
+
+	confirmed := false
+	for _, confirmation := range assertion.Subject.SubjectConfirmations {
+		if confirmation.Method != methodBearer {
+			continue
+		}
+		data := confirmation.Data
+		if data.Recipient != sp.ACSURL || (data.InResponseTo != "" && data.InResponseTo != requestID) {
+			continue
+		}
+		notOnOrAfter, err := time.Parse(time.RFC3339, data.NotOnOrAfter)
+		if err != nil || !now.Add(-MaxClockSkew).Before(notOnOrAfter) {
+			continue
+		}
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return nil, fmt.Errorf("%w: no valid bearer subject confirmation", ErrInvalidResponse)
+	}
+
+	if conditions := assertion.Conditions; conditions != nil {
+		if conditions.NotBefore != "" {
+			notBefore, err := time.Parse(time.RFC3339, conditions.NotBefore)
+			if err != nil || now.Add(MaxClockSkew).Before(notBefore) {
+				return nil, fmt.Errorf("%w: assertion is not yet valid", ErrInvalidResponse)
+			}
+		}
+		if conditions.NotOnOrAfter != "" {
+			notOnOrAfter, err := time.Parse(time.RFC3339, conditions.NotOnOrAfter)
+			if err != nil || !now.Add(-MaxClockSkew).Before(notOnOrAfter) {
+				return nil, fmt.Errorf("%w: assertion has expired", ErrInvalidResponse)
+			}
+		}
+		// every AudienceRestriction must name us
+		for _, restriction := range conditions.AudienceRestrictions {
+			matched := false
+			for _, audience := range restriction.Audiences {
+				if strings.TrimSpace(audience) == sp.EntityID {
+					matched = true
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("%w: audience mismatch", ErrInvalidResponse)
+			}
+		}
+	}
+
+	result := &Assertion{
+		NameID:     strings.TrimSpace(assertion.Subject.NameID),
+		Attributes: make(map[string][]string),
+	}
+	if result.NameID == "" {
+		return nil, fmt.Errorf("%w: no NameID", ErrInvalidResponse)
+	}
+	for _, attribute := range assertion.Attributes {
+		result.Attributes[attribute.Name] = append(result.Attributes[attribute.Name], attribute.Values...)
+	}
+	return result, nil
+}
@@ -0,0 +1,261 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testSPEntityID  = "https://wiki.example.com/share/v1/openapi/saml/kb1/metadata"
+	testACSURL      = "https://wiki.example.com/share/v1/openapi/saml/kb1/acs"
+	testIdPEntityID = "https://idp.example.com"
+	testRequestID   = "_request1"
+)
+
+type testIdP struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	certPEM, keyPEM, err := GenerateKeyPair("idp")
+	require.NoError(t, err)
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	require.NoError(t, err)
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	require.NoError(t, err)
+	return &testIdP{key: key, cert: cert}
+}
+
+func (idp *testIdP) metadata() string {
+	return fmt.Sprintf(`<?xml version="1.0"?>
+<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" xmlns:ds="http://www.w3.org/2000/09/xmldsig#" entityID="%s">
+  <IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <KeyDescriptor use="encryption"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>AAAA</ds:X509Certificate></ds:X509Data></ds:KeyInfo></KeyDescriptor>
+    <KeyDescriptor use="signing"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>
+      %s
+    </ds:X509Certificate></ds:X509Data></ds:KeyInfo></KeyDescriptor>
+    <SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/sso/post"/>
+    <SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+  </IDPSSODescriptor>
+</EntityDescriptor>`, testIdPEntityID, base64.StdEncoding.EncodeToString(idp.cert.Raw))
+}
+
+// sign fills the signature placeholder of the element with the given ID the way an IdP does.
+func (idp *testIdP) sign(t *testing.T, doc, id string) string {
+	root, err := parseDocument([]byte(doc))
+	require.NoError(t, err)
+	target := findByID(root, id)
+	require.NotNil(t, target)
+	digest := sha256.Sum256(canonicalize(target, target.child(nsDSig, "Signature"), nil))
+	doc = strings.Replace(doc, "DIGEST-"+id, base64.StdEncoding.EncodeToString(digest[:]), 1)
+
+	root, err = parseDocument([]byte(doc))
+	require.NoError(t, err)
+	signedInfo := findByID(root, id).child(nsDSig, "Signature").child(nsDSig, "SignedInfo")
+	hashed := sha256.Sum256(canonicalize(signedInfo, nil, nil))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, hashed[:])
+	require.NoError(t, err)
+	return strings.Replace(doc, "SIGNATURE-"+id, base64.StdEncoding.EncodeToString(signature), 1)
+}
+
+func findByID(e *element, id string) *element {
+	if e.attr("ID") == id {
+		return e
+	}
+	for _, c := range e.children {
+		if el, ok := c.(*element); ok {
+			if found := findByID(el, id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+func signatureTemplate(id string) string {
+	return `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo>` +
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>` +
+		`<ds:Reference URI="#` + id + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/></ds:Transforms>` +
+		`<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>` +
+		`<ds:DigestValue>DIGEST-` + id + `</ds:DigestValue></ds:Reference></ds:SignedInfo>` +
+		`<ds:SignatureValue>SIGNATURE-` + id + `</ds:SignatureValue></ds:Signature>`
+}
+
+func testResponse(now time.Time, audience string, signResponse bool) string {
+	responseSignature, assertionSignature := "", signatureTemplate("_assertion1")
+	if signResponse {
+		responseSignature, assertionSignature = signatureTemplate("_response1"), ""
+	}
+	return fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_response1" Version="2.0" IssueInstant="%[1]s" Destination="%[4]s" InResponseTo="%[5]s">
+<saml:Issuer xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">%[6]s</saml:Issuer>%[8]s
+<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="_assertion1" Version="2.0" IssueInstant="%[1]s">
+  <saml:Issuer>%[6]s</saml:Issuer>%[9]s
+  <saml:Subject>
+    <saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">alice@example.com</saml:NameID>
+    <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+      <saml:SubjectConfirmationData InResponseTo="%[5]s" NotOnOrAfter="%[3]s" Recipient="%[4]s"/>
+    </saml:SubjectConfirmation>
+  </saml:Subject>
+  <saml:Conditions NotBefore="%[2]s" NotOnOrAfter="%[3]s">
+    <saml:AudienceRestriction><saml:Audience>%[7]s</saml:Audience></saml:AudienceRestriction>
+  </saml:Conditions>
+  <saml:AttributeStatement>
+    <saml:Attribute Name="displayName"><saml:AttributeValue xsi:type="xs:string">Alice &amp; Co</saml:AttributeValue></saml:Attribute>
+    <saml:Attribute Name="groups">
+      <saml:AttributeValue xsi:type="xs:string">engineering</saml:AttributeValue>
+      <saml:AttributeValue xsi:type="xs:string">wiki-admins</saml:AttributeValue>
+    </saml:Attribute>
+  </saml:AttributeStatement>
+</saml:Assertion>
+</samlp:Response>`, now.UTC().Format(time.RFC3339), now.Add(-time.Minute).UTC().Format(time.RFC3339),
+		now.Add(5*time.Minute).UTC().Format(time.RFC3339), testACSURL, testRequestID, testIdPEntityID, audience,
+		responseSignature, assertionSignature)
+}
+
+func newTestSP(t *testing.T, idp *testIdP) *ServiceProvider {
+	identityProvider, err := ParseIdPMetadata([]byte(idp.metadata()))
+	require.NoError(t, err)
+	certPEM, keyPEM, err := GenerateKeyPair("sp")
+	require.NoError(t, err)
+	sp, err := NewServiceProvider(testSPEntityID, testACSURL, certPEM, keyPEM, identityProvider)
+	require.NoError(t, err)
+	return sp
+}
+
+func TestParseIdPMetadata(t *testing.T) {
+	idp := newTestIdP(t)
+	identityProvider, err := ParseIdPMetadata([]byte(idp.metadata()))
+	require.NoError(t, err)
+	require.Equal(t, testIdPEntityID, identityProvider.EntityID)
+	require.Equal(t, "https://idp.example.com/sso", identityProvider.SSOURL)
+	require.Len(t, identityProvider.Certificates, 1)
+	require.True(t, identityProvider.Certificates[0].Equal(idp.cert))
+
+	_, err = ParseIdPMetadata([]byte(`<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="x"/>`))
+	require.Error(t, err)
+}
+
+func TestCanonicalize(t *testing.T) {
+	root, err := parseDocument([]byte(`<a:root xmlns:a="urn:a" xmlns:b="urn:b" xmlns:unused="urn:unused"><a:child z="1" b:y="2" a="&lt;&quot;"><b:leaf>x &amp; y</b:leaf></a:child></a:root>`))
+	require.NoError(t, err)
+	child := root.children[0].(*element)
+	require.Equal(t, `<a:child xmlns:a="urn:a" xmlns:b="urn:b" a="&lt;&quot;" z="1" b:y="2"><b:leaf>x &amp; y</b:leaf></a:child>`,
+		string(canonicalize(child, nil, nil)))
+	require.Equal(t, `<a:root xmlns:a="urn:a"></a:root>`, string(canonicalize(root, child, nil)))
+	require.Equal(t, `<a:root xmlns:a="urn:a" xmlns:unused="urn:unused"></a:root>`, string(canonicalize(root, child, []string{"unused"})))
+}
+
+func TestParseResponse(t *testing.T) {
+	idp := newTestIdP(t)
+	sp := newTestSP(t, idp)
+	now := time.Now()
+	encode := func(doc string) string { return base64.StdEncoding.EncodeToString([]byte(doc)) }
+
+	for _, signResponse := range []bool{false, true} {
+		id := "_assertion1"
+		if signResponse {
+			id = "_response1"
+		}
+		doc := idp.sign(t, testResponse(now, testSPEntityID, signResponse), id)
+
+		assertion, err := sp.ParseResponse(encode(doc), testRequestID, now)
+		require.NoError(t, err)
+		require.Equal(t, "alice@example.com", assertion.NameID)
+		require.Equal(t, "Alice & Co", assertion.Value("name", "displayName"))
+		require.Equal(t, []string{"engineering", "wiki-admins"}, assertion.Attributes["groups"])
+
+		// within the clock skew
+		_, err = sp.ParseResponse(encode(doc), testRequestID, now.Add(-2*time.Minute))
+		require.NoError(t, err)
+		_, err = sp.ParseResponse(encode(doc), testRequestID, now.Add(7*time.Minute))
+		require.NoError(t, err)
+		// beyond the clock skew
+		_, err = sp.ParseResponse(encode(doc), testRequestID, now.Add(-5*time.Minute))
+		require.ErrorIs(t, err, ErrInvalidResponse)
+		_, err = sp.ParseResponse(encode(doc), testRequestID, now.Add(9*time.Minute))
+		require.ErrorIs(t, err, ErrInvalidResponse)
+
+		_, err = sp.ParseResponse(encode(doc), "_other", now)
+		require.ErrorIs(t, err, ErrInvalidResponse)
+
+		tampered := strings.Replace(doc, "wiki-admins", "root", 1)
+		_, err = sp.ParseResponse(encode(tampered), testRequestID, now)
+		require.ErrorIs(t, err, ErrInvalidSignature)
+	}
+
+	doc := idp.sign(t, testResponse(now, "https://other.example.com", false), "_assertion1")
+	_, err := sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(doc)), testRequestID, now)
+	require.ErrorIs(t, err, ErrInvalidResponse)
+
+	// signed by another key
+	doc = newTestIdP(t).sign(t, testResponse(now, testSPEntityID, false), "_assertion1")
+	_, err = sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(doc)), testRequestID, now)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	// unsigned
+	doc = strings.Replace(testResponse(now, testSPEntityID, false), signatureTemplate("_assertion1"), "", 1)
+	_, err = sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(doc)), testRequestID, now)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestAuthnRequestURL(t *testing.T) {
+	sp := newTestSP(t, newTestIdP(t))
+
+	requestID := NewRequestID()
+	authURL, err := sp.AuthnRequestURL(requestID, "state1", time.Now())
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(authURL, "https://idp.example.com/sso?SAMLRequest="))
+
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	query := parsed.Query()
+	require.Equal(t, "state1", query.Get("RelayState"))
+	require.Equal(t, algRSASHA256, query.Get("SigAlg"))
+
+	signed := parsed.RawQuery[:strings.Index(parsed.RawQuery, "&Signature=")]
+	signature, err := base64.StdEncoding.DecodeString(query.Get("Signature"))
+	require.NoError(t, err)
+	hashed := sha256.Sum256([]byte(signed))
+	require.NoError(t, rsa.VerifyPKCS1v15(sp.Certificate.PublicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], signature))
+
+	deflated, err := base64.StdEncoding.DecodeString(query.Get("SAMLRequest"))
+	require.NoError(t, err)
+	request, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	require.NoError(t, err)
+	require.Contains(t, string(request), `ID="`+requestID+`"`)
+	require.Contains(t, string(request), `AssertionConsumerServiceURL="`+testACSURL+`"`)
+	require.Contains(t, string(request), `<saml:Issuer>`+testSPEntityID+`</saml:Issuer>`)
+}
+
+func TestMetadata(t *testing.T) {
+	sp := newTestSP(t, newTestIdP(t))
+	metadata := string(sp.Metadata())
+	require.Contains(t, metadata, `entityID="`+testSPEntityID+`"`)
+	require.Contains(t, metadata, `Location="`+testACSURL+`"`)
+	require.Contains(t, metadata, base64.StdEncoding.EncodeToString(sp.Certificate.Raw))
+
+	_, err := parseDocument([]byte(metadata))
+	require.NoError(t, err)
+}
@@ -0,0 +1,389 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// The subset of XML-DSig that IdPs use for SAML: exclusive canonicalization, the enveloped
+// signature transform and RSA or ECDSA signatures over SHA-1/SHA-2 digests.
+const (
+	nsDSig = "http://www.w3.org/2000/09/xmldsig#"
+	nsXML  = "http://www.w3.org/XML/1998/namespace"
+
+	algExcC14N       = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped     = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algSHA1          = "http://www.w3.org/2000/09/xmldsig#sha1"
+	algSHA256        = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512        = "http://www.w3.org/2001/04/xmlenc#sha512"
+	algRSASHA1       = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	algRSASHA256     = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512     = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algECDSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	algInclusivePref = "InclusiveNamespaces"
+)
+
+var ErrInvalidSignature = errors.New("invalid saml signature")
+
+var digestHashes = map[string]crypto.Hash{
+	algSHA1:   crypto.SHA1,
+	algSHA256: crypto.SHA256,
+	algSHA512: crypto.SHA512,
+}
+
+var signatureHashes = map[string]crypto.Hash{
+	algRSASHA1:     crypto.SHA1,
+	algRSASHA256:   crypto.SHA256,
+	algRSASHA512:   crypto.SHA512,
+	algECDSASHA256: crypto.SHA256,
+}
+
+// element is a node of the document that keeps the prefixes as written, encoding/xml
+// resolves them away but canonicalization needs them.
+type element struct {
+	prefix   string
+	local    string
+	attrs    []xml.Attr // Name.Space is the prefix
+	children []any      // *element or string
+	parent   *element
+}
+
+func parseDocument(data []byte) (*element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var root, current *element
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid xml: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			el := &element{prefix: t.Name.Space, local: t.Name.Local, attrs: t.Attr, parent: current}
+			if current == nil {
+				if root != nil {
+					return nil, errors.New("invalid xml: multiple root elements")
+				}
+				root = el
+			} else {
+				current.children = append(current.children, el)
+			}
+			current = el
+		case xml.EndElement:
+			if current == nil || current.prefix != t.Name.Space || current.local != t.Name.Local {
+				return nil, errors.New("invalid xml: mismatched end element")
+			}
+			current = current.parent
+		case xml.CharData:
+			if current != nil {
+				current.children = append(current.children, string(t))
+			}
+		case xml.Directive:
+			return nil, errors.New("invalid xml: directives are not allowed")
+		}
+	}
+	if root == nil || current != nil {
+		return nil, errors.New("invalid xml: incomplete document")
+	}
+	return root, nil
+}
+
+// namespace resolves a prefix in the scope of the element, "" is the default namespace.
+func (e *element) namespace(prefix string) string {
+	if prefix == "xml" {
+		return nsXML
+	}
+	for el := e; el != nil; el = el.parent {
+		for _, attr := range el.attrs {
+			if (prefix == "" && attr.Name.Space == "" && attr.Name.Local == "xmlns") ||
+				(prefix != "" && attr.Name.Space == "xmlns" && attr.Name.Local == prefix) {
+				return attr.Value
+			}
+		}
+	}
+	return ""
+}
+
+func (e *element) is(namespace, local string) bool {
+	return e.local == local && e.namespace(e.prefix) == namespace
+}
+
+func (e *element) attr(name string) string {
+	for _, attr := range e.attrs {
+		if attr.Name.Space == "" && attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func (e *element) child(namespace, local string) *element {
+	for _, c := range e.children {
+		if el, ok := c.(*element); ok && el.is(namespace, local) {
+			return el
+		}
+	}
+	return nil
+}
+
+func (e *element) text() string {
+	var buf strings.Builder
+	for _, c := range e.children {
+		if s, ok := c.(string); ok {
+			buf.WriteString(s)
+		}
+	}
+	return buf.String()
+}
+
+// canonicalize serializes the element with exclusive XML canonicalization without comments,
+// leaving out the exclude element for the enveloped signature transform. The prefixes of
+// inclusive are rendered as in inclusive canonicalization.
+func canonicalize(e *element, exclude *element, inclusive []string) []byte {
+	var buf bytes.Buffer
+	writeCanonical(&buf, e, exclude, inclusive, map[string]string{})
+	return buf.Bytes()
+}
+
+func writeCanonical(buf *bytes.Buffer, e *element, exclude *element, inclusive []string, rendered map[string]string) {
+	used := []string{e.prefix}
+	for _, attr := range e.attrs {
+		if attr.Name.Space != "" && attr.Name.Space != "xmlns" && attr.Name.Space != "xml" {
+			used = append(used, attr.Name.Space)
+		}
+	}
+	for _, prefix := range inclusive {
+		if e.namespace(prefix) != "" {
+			used = append(used, prefix)
+		}
+	}
+
+	scope := make(map[string]string, len(rendered))
+	for prefix, uri := range rendered {
+		scope[prefix] = uri
+	}
+	decls := make([]string, 0)
+	for _, prefix := range used {
+		uri := e.namespace(prefix)
+		current, found := scope[prefix]
+		if found && current == uri {
+			continue
+		}
+		// an empty default namespace is only declared to undo an outer one
+		if !found && prefix == "" && uri == "" {
+			continue
+		}
+		scope[prefix] = uri
+		decls = append(decls, prefix)
+	}
+	sort.Strings(decls)
+
+	attrs := make([]xml.Attr, 0, len(e.attrs))
+	for _, attr := range e.attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	sort.SliceStable(attrs, func(i, j int) bool {
+		ni, nj := attrNamespace(e, attrs[i]), attrNamespace(e, attrs[j])
+		if ni != nj {
+			return ni < nj
+		}
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+
+	name := qualifiedName(e.prefix, e.local)
+	buf.WriteString("<" + name)
+	for _, prefix := range decls {
+		if prefix == "" {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(` xmlns:` + prefix + `="`)
+		}
+		buf.WriteString(escapeAttr(scope[prefix]))
+		buf.WriteString(`"`)
+	}
+	for _, attr := range attrs {
+		buf.WriteString(" " + qualifiedName(attr.Name.Space, attr.Name.Local) + `="` + escapeAttr(attr.Value) + `"`)
+	}
+	buf.WriteString(">")
+	for _, c := range e.children {
+		switch child := c.(type) {
+		case *element:
+			if child != exclude {
+				writeCanonical(buf, child, exclude, inclusive, scope)
+			}
+		case string:
+			buf.WriteString(escapeText(child))
+		}
+	}
+	buf.WriteString("</" + name + ">")
+}
+
+func attrNamespace(e *element, attr xml.Attr) string {
+	if attr.Name.Space == "" {
+		return ""
+	}
+	return e.namespace(attr.Name.Space)
+}
+
+func qualifiedName(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeText(s string) string { return textEscaper.Replace(s) }
+
+func escapeAttr(s string) string { return attrEscaper.Replace(s) }
+
+// verifySignature checks the enveloped signature of the element against the certificates
+// of the IdP and returns the canonical bytes of the element without its signature, which
+// are exactly what was signed and the only bytes that may be trusted.
+func verifySignature(e *element, certs []*x509.Certificate) ([]byte, error) {
+	signature := e.child(nsDSig, "Signature")
+	if signature == nil {
+		return nil, ErrInvalidSignature
+	}
+	signedInfo := signature.child(nsDSig, "SignedInfo")
+	signatureValue := signature.child(nsDSig, "SignatureValue")
+	if signedInfo == nil || signatureValue == nil {
+		return nil, ErrInvalidSignature
+	}
+
+	c14nMethod := signedInfo.child(nsDSig, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.attr("Algorithm") != algExcC14N {
+		return nil, fmt.Errorf("%w: unsupported canonicalization", ErrInvalidSignature)
+	}
+	signatureMethod := signedInfo.child(nsDSig, "SignatureMethod")
+	if signatureMethod == nil {
+		return nil, ErrInvalidSignature
+	}
+	signatureHash, supported := signatureHashes[signatureMethod.attr("Algorithm")]
+	if !supported {
+		return nil, fmt.Errorf("%w: unsupported signature method %s", ErrInvalidSignature, signatureMethod.attr("Algorithm"))
+	}
+
+	var reference *element
+	for _, c := range signedInfo.children {
+		if el, isElement := c.(*element); isElement && el.is(nsDSig, "Reference") {
+			if reference != nil {
+				return nil, fmt.Errorf("%w: multiple references", ErrInvalidSignature)
+			}
+			reference = el
+		}
+	}
+	id := e.attr("ID")
+	if reference == nil || id == "" || reference.attr("URI") != "#"+id {
+		return nil, fmt.Errorf("%w: the reference is not the signed element", ErrInvalidSignature)
+	}
+
+	var prefixes []string
+	if transforms := reference.child(nsDSig, "Transforms"); transforms != nil {
+		for _, c := range transforms.children {
+			transform, isElement := c.(*element)
+			if !isElement {
+				continue
+			}
+			switch transform.attr("Algorithm") {
+			case algEnveloped:
+			case algExcC14N:
+				prefixes = inclusivePrefixes(transform)
+			default:
+				return nil, fmt.Errorf("%w: unsupported transform %s", ErrInvalidSignature, transform.attr("Algorithm"))
+			}
+		}
+	}
+	digestMethod := reference.child(nsDSig, "DigestMethod")
+	digestValue := reference.child(nsDSig, "DigestValue")
+	if digestMethod == nil || digestValue == nil {
+		return nil, ErrInvalidSignature
+	}
+	digestHash, supported := digestHashes[digestMethod.attr("Algorithm")]
+	if !supported {
+		return nil, fmt.Errorf("%w: unsupported digest method %s", ErrInvalidSignature, digestMethod.attr("Algorithm"))
+	}
+	expectedDigest, err := base64.StdEncoding.DecodeString(strings.TrimSpace(digestValue.text()))
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	signed := canonicalize(e, signature, prefixes)
+	if !bytes.Equal(hashBytes(digestHash, signed), expectedDigest) {
+		return nil, fmt.Errorf("%w: digest mismatch", ErrInvalidSignature)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(signatureValue.text()), ""))
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	hashed := hashBytes(signatureHash, canonicalize(signedInfo, nil, inclusivePrefixes(c14nMethod)))
+	for _, cert := range certs {
+		if verifyWithKey(cert.PublicKey, signatureHash, hashed, sig) {
+			return signed, nil
+		}
+	}
+	return nil, ErrInvalidSignature
+}
+
+func inclusivePrefixes(method *element) []string {
+	for _, c := range method.children {
+		if el, isElement := c.(*element); isElement && el.local == algInclusivePref {
+			return strings.Fields(el.attr("PrefixList"))
+		}
+	}
+	return nil
+}
+
+func hashBytes(hash crypto.Hash, data []byte) []byte {
+	switch hash {
+	case crypto.SHA1:
+		sum := sha1.Sum(data)
+		return sum[:]
+	case crypto.SHA512:
+		sum := sha512.Sum512(data)
+		return sum[:]
+	default:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}
+}
+
+func verifyWithKey(key crypto.PublicKey, hash crypto.Hash, hashed, sig []byte) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, hash, hashed, sig) == nil
+	case *ecdsa.PublicKey:
+		// XML-DSig ECDSA signatures are r||s instead of ASN.1
+		if len(sig)%2 != 0 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		return ecdsa.Verify(k, hashed, r, s)
+	}
+	return false
+}
@@ -0,0 +1,488 @@
+package scim
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filter is a parsed filter expression, RFC 7644 section 3.4.2.2.
+type Filter interface {
+	// Match reports whether the JSON form of a resource matches the filter.
+	Match(resource map[string]any) bool
+}
+
+// ParseFilter parses a filter such as `userName eq "bjensen" and emails[type eq "work"]`.
+// The filter of an empty expression is nil.
+func ParseFilter(expr string) (Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, badRequest(ErrorInvalidFilter, "unexpected %q in filter", p.tokens[p.pos].text)
+	}
+	return filter, nil
+}
+
+// EqualityValue returns the value of a filter which is exactly `attr eq "value"`, it lets
+// callers narrow down the resources to load before the filter is applied.
+func EqualityValue(filter Filter, attr string) (string, bool) {
+	cmp, ok := filter.(*compareFilter)
+	if !ok || cmp.op != "eq" || len(cmp.path) != 1 || !strings.EqualFold(cmp.path[0], attr) {
+		return "", false
+	}
+	value, ok := cmp.value.(string)
+	return value, ok
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")"})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{kind: tokenLBracket, text: "["})
+			i++
+		case r == ']':
+			tokens = append(tokens, token{kind: tokenRBracket, text: "]"})
+			i++
+		case r == '"':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, badRequest(ErrorInvalidFilter, "unterminated string in filter")
+			}
+			s, err := strconv.Unquote(string(runes[i : j+1]))
+			if err != nil {
+				return nil, badRequest(ErrorInvalidFilter, "invalid string %s in filter", string(runes[i:j+1]))
+			}
+			tokens = append(tokens, token{kind: tokenString, text: s})
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`()[]"`, runes[j]); j++ {
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+var compareOps = []string{"eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le"}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *filterParser) peek() *token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *filterParser) peekKeyword(keyword string) bool {
+	t := p.peek()
+	return t != nil && t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (p *filterParser) expect(kind tokenKind, text string) error {
+	t := p.peek()
+	if t == nil || t.kind != kind {
+		return badRequest(ErrorInvalidFilter, "%q expected in filter", text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalFilter{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalFilter{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (Filter, error) {
+	if !p.peekKeyword("not") {
+		return p.parseAtom()
+	}
+	p.pos++
+	if err := p.expect(tokenLParen, "("); err != nil {
+		return nil, err
+	}
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenRParen, ")"); err != nil {
+		return nil, err
+	}
+	return &notFilter{filter: filter}, nil
+}
+
+func (p *filterParser) parseAtom() (Filter, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, badRequest(ErrorInvalidFilter, "unexpected end of filter")
+	}
+	if t.kind == tokenLParen {
+		p.pos++
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+		return filter, nil
+	}
+	if t.kind != tokenWord {
+		return nil, badRequest(ErrorInvalidFilter, "attribute expected in filter, got %q", t.text)
+	}
+	p.pos++
+	path := parseAttrPath(t.text)
+
+	if next := p.peek(); next != nil && next.kind == tokenLBracket {
+		if len(path) != 1 {
+			return nil, badRequest(ErrorInvalidFilter, "invalid value path %q", t.text)
+		}
+		p.pos++
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRBracket, "]"); err != nil {
+			return nil, err
+		}
+		return &valuePathFilter{attr: path[0], filter: filter}, nil
+	}
+
+	opToken := p.peek()
+	if opToken == nil || opToken.kind != tokenWord {
+		return nil, badRequest(ErrorInvalidFilter, "operator expected after %q", t.text)
+	}
+	p.pos++
+	op := strings.ToLower(opToken.text)
+	if op == "pr" {
+		return &presentFilter{path: path}, nil
+	}
+	if !containsFold(compareOps, op) {
+		return nil, badRequest(ErrorInvalidFilter, "unknown operator %q", opToken.text)
+	}
+
+	valueToken := p.peek()
+	if valueToken == nil {
+		return nil, badRequest(ErrorInvalidFilter, "value expected after %q", opToken.text)
+	}
+	p.pos++
+	var value any
+	switch {
+	case valueToken.kind == tokenString:
+		value = valueToken.text
+	case valueToken.kind != tokenWord:
+		return nil, badRequest(ErrorInvalidFilter, "value expected after %q", opToken.text)
+	case valueToken.text == "true" || valueToken.text == "false":
+		value = valueToken.text == "true"
+	case valueToken.text == "null":
+		value = nil
+	default:
+		n, err := strconv.ParseFloat(valueToken.text, 64)
+		if err != nil {
+			return nil, badRequest(ErrorInvalidFilter, "invalid value %q", valueToken.text)
+		}
+		value = n
+	}
+	return &compareFilter{path: path, op: op, value: value}, nil
+}
+
+// stripSchema removes the schema URN of a fully qualified attribute such as
+// urn:ietf:params:scim:schemas:core:2.0:User:name.givenName.
+func stripSchema(attr string) string {
+	if !strings.HasPrefix(strings.ToLower(attr), "urn:") {
+		return attr
+	}
+	end := len(attr)
+	if i := strings.IndexByte(attr, '['); i >= 0 {
+		end = i
+	}
+	if i := strings.LastIndexByte(attr[:end], ':'); i >= 0 {
+		return attr[i+1:]
+	}
+	return attr
+}
+
+func parseAttrPath(attr string) []string {
+	return strings.Split(stripSchema(attr), ".")
+}
+
+type logicalFilter struct {
+	or          bool
+	left, right Filter
+}
+
+func (f *logicalFilter) Match(resource map[string]any) bool {
+	if f.or {
+		return f.left.Match(resource) || f.right.Match(resource)
+	}
+	return f.left.Match(resource) && f.right.Match(resource)
+}
+
+type notFilter struct {
+	filter Filter
+}
+
+func (f *notFilter) Match(resource map[string]any) bool {
+	return !f.filter.Match(resource)
+}
+
+type presentFilter struct {
+	path []string
+}
+
+func (f *presentFilter) Match(resource map[string]any) bool {
+	for _, value := range resolve(resource, f.path) {
+		if !isEmpty(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// valuePathFilter matches resources with an item of a multi-valued attribute matching the
+// filter, such as emails[type eq "work" and value co "@example.com"].
+type valuePathFilter struct {
+	attr   string
+	filter Filter
+}
+
+func (f *valuePathFilter) Match(resource map[string]any) bool {
+	for _, item := range resolve(resource, []string{f.attr}) {
+		if m, ok := item.(map[string]any); ok && f.filter.Match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+type compareFilter struct {
+	path  []string
+	op    string
+	value any
+}
+
+func (f *compareFilter) Match(resource map[string]any) bool {
+	values := resolve(resource, f.path)
+	if len(values) == 0 {
+		return f.op == "ne" && f.value != nil
+	}
+	for _, value := range values {
+		// a multi-valued attribute compares by the value of its items, as in members eq "1"
+		if m, ok := value.(map[string]any); ok {
+			value, _ = getFold(m, "value")
+		}
+		if compare(value, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(actual any, op string, expected any) bool {
+	switch expected := expected.(type) {
+	case nil:
+		if op == "eq" {
+			return actual == nil
+		}
+		return op == "ne" && actual != nil
+	case bool:
+		b, ok := actual.(bool)
+		if op == "eq" {
+			return ok && b == expected
+		}
+		return op == "ne" && (!ok || b != expected)
+	case float64:
+		n, ok := actual.(float64)
+		if !ok {
+			return op == "ne"
+		}
+		switch op {
+		case "eq":
+			return n == expected
+		case "ne":
+			return n != expected
+		case "gt":
+			return n > expected
+		case "ge":
+			return n >= expected
+		case "lt":
+			return n < expected
+		case "le":
+			return n <= expected
+		}
+		return false
+	case string:
+		s, ok := actual.(string)
+		if !ok {
+			return op == "ne"
+		}
+		// attributes are compared case-insensitively, dates in RFC 3339 compare as strings
+		s, expected = strings.ToLower(s), strings.ToLower(expected)
+		switch op {
+		case "eq":
+			return s == expected
+		case "ne":
+			return s != expected
+		case "co":
+			return strings.Contains(s, expected)
+		case "sw":
+			return strings.HasPrefix(s, expected)
+		case "ew":
+			return strings.HasSuffix(s, expected)
+		case "gt":
+			return s > expected
+		case "ge":
+			return s >= expected
+		case "lt":
+			return s < expected
+		case "le":
+			return s <= expected
+		}
+	}
+	return false
+}
+
+// resolve returns the values of an attribute path, the items of multi-valued attributes
+// are flattened.
+func resolve(value any, path []string) []any {
+	if len(path) == 0 {
+		if items, ok := value.([]any); ok {
+			return items
+		}
+		return []any{value}
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		child, ok := getFold(v, path[0])
+		if !ok {
+			return nil
+		}
+		return resolve(child, path[1:])
+	case []any:
+		var values []any
+		for _, item := range v {
+			values = append(values, resolve(item, path)...)
+		}
+		return values
+	}
+	return nil
+}
+
+func isEmpty(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// getFold looks up an attribute case-insensitively, as attribute names are.
+func getFold(m map[string]any, key string) (any, bool) {
+	if value, ok := m[key]; ok {
+		return value, true
+	}
+	for k, value := range m {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func setFold(m map[string]any, key string, value any) {
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			m[k] = value
+			return
+		}
+	}
+	m[key] = value
+}
+
+func deleteFold(m map[string]any, key string) {
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			delete(m, k)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package scim
+
+import (
+	"strings"
+)
+
+// Patch applies the operations of a PATCH request to the JSON form of a resource,
+// RFC 7644 section 3.5.2. The resource is modified in place.
+func Patch(resource map[string]any, operations []PatchOperation) error {
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return badRequest(ErrorInvalidSyntax, "unknown patch op %q", operation.Op)
+		}
+
+		if operation.Path == "" {
+			if op == "remove" {
+				return badRequest(ErrorNoTarget, "path is required to remove")
+			}
+			// without a path the value holds the attributes to add or replace, some IdPs
+			// send sub-attribute paths such as name.givenName as its keys
+			values, ok := operation.Value.(map[string]any)
+			if !ok {
+				return badRequest(ErrorInvalidValue, "value of a patch without path must be an object")
+			}
+			for key, value := range values {
+				path, err := parsePatchPath(key)
+				if err != nil {
+					return err
+				}
+				if err := path.apply(resource, op, value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		path, err := parsePatchPath(operation.Path)
+		if err != nil {
+			return err
+		}
+		if err := path.apply(resource, op, operation.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchPath is the path of a patch operation: attr, attr.sub, attr[filter] or
+// attr[filter].sub.
+type patchPath struct {
+	attr   string
+	filter Filter
+	sub    string
+}
+
+func parsePatchPath(s string) (*patchPath, error) {
+	s = stripSchema(strings.TrimSpace(s))
+	path := &patchPath{}
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		j := strings.LastIndexByte(s, ']')
+		if j < i {
+			return nil, badRequest(ErrorInvalidPath, "invalid path %q", s)
+		}
+		filter, err := ParseFilter(s[i+1 : j])
+		if err != nil || filter == nil {
+			return nil, badRequest(ErrorInvalidPath, "invalid filter in path %q", s)
+		}
+		path.attr, path.filter = s[:i], filter
+		rest := s[j+1:]
+		if rest != "" {
+			if !strings.HasPrefix(rest, ".") {
+				return nil, badRequest(ErrorInvalidPath, "invalid path %q", s)
+			}
+			path.sub = rest[1:]
+		}
+	} else {
+		path.attr, path.sub, _ = strings.Cut(s, ".")
+	}
+	if path.attr == "" || strings.Contains(path.sub, ".") {
+		return nil, badRequest(ErrorInvalidPath, "invalid path %q", s)
+	}
+	return path, nil
+}
+
+func (p *patchPath) apply(resource map[string]any, op string, value any) error {
+	if p.filter != nil {
+		return p.applyFiltered(resource, op, value)
+	}
+	existing, exists := getFold(resource, p.attr)
+
+	if p.sub != "" {
+		switch v := existing.(type) {
+		case map[string]any:
+			if op == "remove" {
+				deleteFold(v, p.sub)
+			} else {
+				setFold(v, p.sub, value)
+			}
+		case []any:
+			// a sub-attribute of every item, as in emails.type
+			for _, item := range v {
+				if m, ok := item.(map[string]any); ok {
+					if op == "remove" {
+						deleteFold(m, p.sub)
+					} else {
+						setFold(m, p.sub, value)
+					}
+				}
+			}
+		default:
+			if op != "remove" {
+				setFold(resource, p.attr, map[string]any{p.sub: value})
+			}
+		}
+		return nil
+	}
+
+	switch op {
+	case "add":
+		items, isMulti := existing.([]any)
+		if !isMulti {
+			setFold(resource, p.attr, value)
+			return nil
+		}
+		added, ok := value.([]any)
+		if !ok {
+			added = []any{value}
+		}
+		for _, item := range added {
+			if indexOfValue(items, item) < 0 {
+				items = append(items, item)
+			}
+		}
+		setFold(resource, p.attr, items)
+	case "replace":
+		setFold(resource, p.attr, value)
+	case "remove":
+		items, isMulti := existing.([]any)
+		if !exists {
+			return nil
+		}
+		if !isMulti || value == nil {
+			deleteFold(resource, p.attr)
+			return nil
+		}
+		// some IdPs remove members by listing them in the value instead of a filter
+		removed, ok := value.([]any)
+		if !ok {
+			removed = []any{value}
+		}
+		kept := make([]any, 0, len(items))
+		for _, item := range items {
+			if indexOfValue(removed, item) < 0 {
+				kept = append(kept, item)
+			}
+		}
+		setFold(resource, p.attr, kept)
+	}
+	return nil
+}
+
+func (p *patchPath) applyFiltered(resource map[string]any, op string, value any) error {
+	existing, _ := getFold(resource, p.attr)
+	items, ok := existing.([]any)
+	if existing != nil && !ok {
+		return badRequest(ErrorInvalidPath, "%s is not multi-valued", p.attr)
+	}
+
+	kept := make([]any, 0, len(items))
+	matched := false
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok || !p.filter.Match(m) {
+			kept = append(kept, item)
+			continue
+		}
+		matched = true
+		switch {
+		case op == "remove" && p.sub == "":
+			continue
+		case op == "remove":
+			deleteFold(m, p.sub)
+		case p.sub != "":
+			setFold(m, p.sub, value)
+		case op == "replace":
+			replacement, ok := value.(map[string]any)
+			if !ok {
+				return badRequest(ErrorInvalidValue, "value of %s must be an object", p.attr)
+			}
+			m = replacement
+		default:
+			values, ok := value.(map[string]any)
+			if !ok {
+				return badRequest(ErrorInvalidValue, "value of %s must be an object", p.attr)
+			}
+			for k, v := range values {
+				setFold(m, k, v)
+			}
+		}
+		kept = append(kept, m)
+	}
+
+	if !matched {
+		if op == "remove" {
+			return nil
+		}
+		// an item is created for filters such as emails[type eq "work"].value, which IdPs
+		// send to set the work email of users without one
+		item, ok := p.newItem(value)
+		if !ok {
+			return badRequest(ErrorNoTarget, "no value of %s matches the filter", p.attr)
+		}
+		kept = append(kept, item)
+	}
+	setFold(resource, p.attr, kept)
+	return nil
+}
+
+func (p *patchPath) newItem(value any) (map[string]any, bool) {
+	cmp, ok := p.filter.(*compareFilter)
+	if !ok || cmp.op != "eq" || len(cmp.path) != 1 {
+		return nil, false
+	}
+	item := map[string]any{cmp.path[0]: cmp.value}
+	if p.sub != "" {
+		item[p.sub] = value
+		return item, true
+	}
+	values, ok := value.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	for k, v := range values {
+		item[k] = v
+	}
+	return item, true
+}
+
+// indexOfValue finds an item of a multi-valued attribute by its value sub-attribute, or by
+// equality for primitive items.
+func indexOfValue(items []any, target any) int {
+	targetValue, ok := itemValue(target)
+	if !ok {
+		return -1
+	}
+	for i, item := range items {
+		if value, ok := itemValue(item); ok && value == targetValue {
+			return i
+		}
+	}
+	return -1
+}
+
+func itemValue(item any) (any, bool) {
+	if m, ok := item.(map[string]any); ok {
+		item, ok = getFold(m, "value")
+		if !ok {
+			return nil, false
+		}
+	}
+	switch item.(type) {
+	case string, float64, bool:
+		return item, true
+	}
+	return nil, false
+}
@@ -0,0 +1,338 @@
+// Package scim implements the protocol parts of a SCIM 2.0 server (RFC 7643, RFC 7644): the
+// core User and Group resources, filters and PATCH operations. Resources are filtered and
+// patched in their JSON form so that both work the same way for every resource type.
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ContentType = "application/scim+json"
+
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	// MaxResults is the largest page of a list response.
+	MaxResults = 200
+)
+
+// scimType of errors, RFC 7644 section 3.12
+const (
+	ErrorInvalidFilter = "invalidFilter"
+	ErrorInvalidSyntax = "invalidSyntax"
+	ErrorInvalidPath   = "invalidPath"
+	ErrorInvalidValue  = "invalidValue"
+	ErrorNoTarget      = "noTarget"
+	ErrorUniqueness    = "uniqueness"
+	ErrorMutability    = "mutability"
+)
+
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func NewError(status int, scimType, detail string) *Error {
+	return &Error{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.ScimType != "" {
+		return fmt.Sprintf("scim %s %s: %s", e.Status, e.ScimType, e.Detail)
+	}
+	return fmt.Sprintf("scim %s: %s", e.Status, e.Detail)
+}
+
+func (e *Error) StatusCode() int {
+	status, err := strconv.Atoi(e.Status)
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+func badRequest(scimType, format string, args ...any) *Error {
+	return NewError(http.StatusBadRequest, scimType, fmt.Sprintf(format, args...))
+}
+
+type Meta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+}
+
+// MultiValue is an item of a multi-valued attribute such as emails or members.
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type User struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	Name        *Name        `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Emails      []MultiValue `json:"emails,omitempty"`
+	Active      *bool        `json:"active,omitempty"`
+	Groups      []MultiValue `json:"groups,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+// PrimaryEmail returns the primary email, or the first one when none is marked primary.
+func (u *User) PrimaryEmail() string {
+	for _, email := range u.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+// DisplayNameOrDefault falls back to the formatted and given names, then to the userName.
+func (u *User) DisplayNameOrDefault() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	if u.Name != nil {
+		if u.Name.Formatted != "" {
+			return u.Name.Formatted
+		}
+		if name := strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName); name != "" {
+			return name
+		}
+	}
+	return u.UserName
+}
+
+func (u *User) IsActive() bool {
+	return u.Active == nil || *u.Active
+}
+
+type Group struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+// ListQuery holds the query parameters of a list request.
+type ListQuery struct {
+	Filter             string `query:"filter"`
+	StartIndex         int    `query:"startIndex"`
+	Count              *int   `query:"count"`
+	Attributes         string `query:"attributes"`
+	ExcludedAttributes string `query:"excludedAttributes"`
+}
+
+// Page applies the filter, pagination and attribute projection of q to resources, which
+// are in their JSON form.
+func (q ListQuery) Page(resources []map[string]any) (*ListResponse, error) {
+	filter, err := ParseFilter(q.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]map[string]any, 0, len(resources))
+	for _, resource := range resources {
+		if filter == nil || filter.Match(resource) {
+			matched = append(matched, resource)
+		}
+	}
+
+	startIndex := max(q.StartIndex, 1)
+	count := MaxResults
+	if q.Count != nil {
+		count = min(max(*q.Count, 0), MaxResults)
+	}
+	start := min(startIndex-1, len(matched))
+	end := min(start+count, len(matched))
+
+	resp := &ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(matched),
+		StartIndex:   startIndex,
+		ItemsPerPage: end - start,
+		Resources:    make([]any, 0, end-start),
+	}
+	for _, resource := range matched[start:end] {
+		resp.Resources = append(resp.Resources, Project(resource, q.Attributes, q.ExcludedAttributes))
+	}
+	return resp, nil
+}
+
+// alwaysReturned attributes are kept by attribute projections.
+var alwaysReturned = []string{"schemas", "id", "meta"}
+
+// Project keeps the comma separated attributes of the resource, or drops the excluded ones.
+// Only top-level attributes are projected.
+func Project(resource map[string]any, attributes, excludedAttributes string) map[string]any {
+	if attributes == "" && excludedAttributes == "" {
+		return resource
+	}
+	result := make(map[string]any, len(resource))
+	for key, value := range resource {
+		if containsFold(alwaysReturned, key) {
+			result[key] = value
+			continue
+		}
+		if attributes != "" {
+			if containsFold(topLevelNames(attributes), key) {
+				result[key] = value
+			}
+			continue
+		}
+		if !containsFold(topLevelNames(excludedAttributes), key) {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+func topLevelNames(attributes string) []string {
+	var names []string
+	for _, attr := range strings.Split(attributes, ",") {
+		attr = stripSchema(strings.TrimSpace(attr))
+		name, _, _ := strings.Cut(attr, ".")
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToMap returns the JSON form of a resource.
+func ToMap(resource any) (map[string]any, error) {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FromMap decodes the JSON form of a resource into v. Boolean attributes sent as strings,
+// as some IdPs do for active, are accepted.
+func FromMap(m map[string]any, v any) error {
+	for key, value := range m {
+		if s, ok := value.(string); ok && strings.EqualFold(key, "active") {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return badRequest(ErrorInvalidValue, "active must be a boolean")
+			}
+			m[key] = b
+		}
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return badRequest(ErrorInvalidValue, "%s", err)
+	}
+	return nil
+}
+
+// ServiceProviderConfig describes the features of this implementation.
+func ServiceProviderConfig(documentationURI string) map[string]any {
+	supported := func(b bool) map[string]any { return map[string]any{"supported": b} }
+	return map[string]any{
+		"schemas":          []string{SchemaServiceProviderConfig},
+		"documentationUri": documentationURI,
+		"patch":            supported(true),
+		"bulk":             map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]any{"supported": true, "maxResults": MaxResults},
+		"changePassword":   supported(false),
+		"sort":             supported(false),
+		"etag":             supported(false),
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with an API token of the knowledge base with the scim scope",
+			"primary":     true,
+		}},
+	}
+}
+
+// ResourceTypes lists the User and Group resource types served under baseURL.
+func ResourceTypes(baseURL string) []map[string]any {
+	resourceType := func(id, endpoint, schema string) map[string]any {
+		return map[string]any{
+			"schemas":  []string{SchemaResourceType},
+			"id":       id,
+			"name":     id,
+			"endpoint": endpoint,
+			"schema":   schema,
+			"meta":     map[string]any{"resourceType": "ResourceType", "location": baseURL + "/ResourceTypes/" + id},
+		}
+	}
+	return []map[string]any{
+		resourceType("User", "/Users", SchemaUser),
+		resourceType("Group", "/Groups", SchemaGroup),
+	}
+}
@@ -0,0 +1,144 @@
+package scim
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, s string) map[string]any {
+	t.Helper()
+	var m map[string]any
+	require.NoError(t, json.Unmarshal([]byte(s), &m))
+	return m
+}
+
+const testUser = `{
+	"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+	"id": "12",
+	"externalId": "e-12",
+	"userName": "bjensen@example.com",
+	"name": {"givenName": "Barbara", "familyName": "Jensen"},
+	"emails": [
+		{"value": "bjensen@example.com", "type": "work", "primary": true},
+		{"value": "babs@home.org", "type": "home"}
+	],
+	"active": true,
+	"meta": {"resourceType": "User", "lastModified": "2026-05-01T10:00:00Z"}
+}`
+
+func TestFilter(t *testing.T) {
+	user := decode(t, testUser)
+	cases := []struct {
+		filter string
+		match  bool
+	}{
+		{`userName eq "BJENSEN@example.com"`, true},
+		{`userName ne "bjensen@example.com"`, false},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName sw "bjen"`, true},
+		{`name.familyName co "ens"`, true},
+		{`emails.value ew "home.org"`, true},
+		{`emails eq "babs@home.org"`, true},
+		{`emails[type eq "work" and value co "example"]`, true},
+		{`emails[type eq "other"]`, false},
+		{`active eq true and not (externalId pr)`, false},
+		{`(userName eq "x" or externalId eq "e-12") and active eq true`, true},
+		{`meta.lastModified gt "2026-01-01T00:00:00Z"`, true},
+		{`title pr`, false},
+		{`title ne "x"`, true},
+	}
+	for _, c := range cases {
+		filter, err := ParseFilter(c.filter)
+		require.NoError(t, err, c.filter)
+		require.Equal(t, c.match, filter.Match(user), c.filter)
+	}
+
+	for _, invalid := range []string{`userName`, `userName eq`, `userName xx "a"`, `(userName eq "a"`, `userName eq "a`, `emails[type eq "work"`} {
+		_, err := ParseFilter(invalid)
+		require.Error(t, err, invalid)
+		require.Equal(t, ErrorInvalidFilter, err.(*Error).ScimType, invalid)
+	}
+
+	filter, err := ParseFilter(`userName eq "bjensen"`)
+	require.NoError(t, err)
+	value, ok := EqualityValue(filter, "username")
+	require.True(t, ok)
+	require.Equal(t, "bjensen", value)
+	filter, err = ParseFilter(`userName eq "bjensen" and active eq true`)
+	require.NoError(t, err)
+	_, ok = EqualityValue(filter, "userName")
+	require.False(t, ok)
+}
+
+func TestPatch(t *testing.T) {
+	user := decode(t, testUser)
+	err := Patch(user, []PatchOperation{
+		{Op: "Replace", Path: `emails[type eq "work"].value`, Value: "barbara@example.com"},
+		{Op: "replace", Value: map[string]any{"active": "False", "name.givenName": "Babs"}},
+		{Op: "remove", Path: `emails[type eq "home"]`},
+		{Op: "add", Path: "displayName", Value: "Babs Jensen"},
+	})
+	require.NoError(t, err)
+
+	var u User
+	require.NoError(t, FromMap(user, &u))
+	require.Equal(t, "barbara@example.com", u.PrimaryEmail())
+	require.Len(t, u.Emails, 1)
+	require.False(t, u.IsActive())
+	require.Equal(t, "Babs", u.Name.GivenName)
+	require.Equal(t, "Babs Jensen", u.DisplayNameOrDefault())
+
+	// an item is created when no item matches a simple filter
+	require.NoError(t, Patch(user, []PatchOperation{{Op: "add", Path: `emails[type eq "home"].value`, Value: "babs@home.org"}}))
+	require.NoError(t, FromMap(user, &u))
+	require.Equal(t, []MultiValue{
+		{Value: "barbara@example.com", Type: "work", Primary: true},
+		{Value: "babs@home.org", Type: "home"},
+	}, u.Emails)
+
+	group := decode(t, `{"displayName": "Eng", "members": [{"value": "1"}, {"value": "2"}]}`)
+	err = Patch(group, []PatchOperation{
+		{Op: "add", Path: "members", Value: []any{map[string]any{"value": "2"}, map[string]any{"value": "3"}}},
+		{Op: "remove", Path: `members[value eq "1"]`},
+		{Op: "remove", Path: "members", Value: []any{map[string]any{"value": "3"}}},
+		{Op: "replace", Path: "displayName", Value: "Engineering"},
+	})
+	require.NoError(t, err)
+	var g Group
+	require.NoError(t, FromMap(group, &g))
+	require.Equal(t, "Engineering", g.DisplayName)
+	require.Equal(t, []MultiValue{{Value: "2"}}, g.Members)
+
+	require.NoError(t, Patch(group, []PatchOperation{{Op: "remove", Path: "members"}}))
+	var emptied Group
+	require.NoError(t, FromMap(group, &emptied))
+	require.Empty(t, emptied.Members)
+
+	for _, ops := range [][]PatchOperation{
+		{{Op: "move", Path: "displayName"}},
+		{{Op: "remove"}},
+		{{Op: "replace", Path: `members[value eq "9"]`, Value: "x"}},
+		{{Op: "add", Path: "members[value eq"}},
+	} {
+		require.Error(t, Patch(decode(t, `{"members": []}`), ops))
+	}
+}
+
+func TestListQueryPage(t *testing.T) {
+	var resources []map[string]any
+	for _, name := range []string{"a", "b", "c", "ab"} {
+		resources = append(resources, map[string]any{"id": name, "displayName": name, "members": []any{}})
+	}
+	count := 1
+	resp, err := ListQuery{Filter: `displayName sw "a"`, StartIndex: 2, Count: &count, ExcludedAttributes: "members"}.Page(resources)
+	require.NoError(t, err)
+	require.Equal(t, 2, resp.TotalResults)
+	require.Equal(t, 1, resp.ItemsPerPage)
+	require.Equal(t, []any{map[string]any{"id": "ab", "displayName": "ab"}}, resp.Resources)
+
+	resp, err = ListQuery{StartIndex: 10}.Page(resources)
+	require.NoError(t, err)
+	require.Equal(t, 4, resp.TotalResults)
+	require.Empty(t, resp.Resources)
+}
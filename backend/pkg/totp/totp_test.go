@@ -0,0 +1,66 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// the SHA1 secret of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// the last 6 digits of the 8 digit codes of RFC 6238 appendix B
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		code, err := Code(rfcSecret, Step(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		require.Equal(t, want, code, unix)
+	}
+
+	_, err := Code("not base32!", 1)
+	require.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step, ok := Validate(rfcSecret, "005924", now)
+	require.True(t, ok)
+	require.Equal(t, Step(now), step)
+
+	// the previous period is still accepted, two periods later it is not
+	step, ok = Validate(rfcSecret, "005 924", now.Add(Period*time.Second))
+	require.True(t, ok)
+	require.Equal(t, Step(now), step)
+	_, ok = Validate(rfcSecret, "005924", now.Add(2*Period*time.Second))
+	require.False(t, ok)
+
+	for _, code := range []string{"", "00592", "0059244", "123456"} {
+		_, ok = Validate(rfcSecret, code, now)
+		require.False(t, ok, code)
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	require.Len(t, secret, 32)
+	_, err = Code(secret, 1)
+	require.NoError(t, err)
+
+	u, err := url.Parse(URL("PandaWiki", "admin@example.com", secret))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", u.Scheme)
+	require.Equal(t, "totp", u.Host)
+	require.Equal(t, "/PandaWiki:admin@example.com", u.Path)
+	require.Equal(t, secret, u.Query().Get("secret"))
+	require.Equal(t, "PandaWiki", u.Query().Get("issuer"))
+}
@@ -0,0 +1,418 @@
+// Package webauthn verifies WebAuthn registrations and assertions of security keys and
+// passkeys used as a second factor (https://www.w3.org/TR/webauthn-2/). Attestation
+// statements are not verified: credentials are requested with the "none" conveyance, so
+// the authenticator model is not checked.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+)
+
+const (
+	// Timeout is the time in milliseconds the browser waits for the authenticator.
+	Timeout = 120000
+
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+
+	flagUserPresent  = 0x01
+	flagAttestedData = 0x40
+
+	// COSE algorithms, https://www.iana.org/assignments/cose/cose.xhtml
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+var ErrVerification = errors.New("webauthn verification failed")
+
+// Bytes is a byte string encoded in base64url in JSON, as expected by
+// PublicKeyCredential.parseCreationOptionsFromJSON and produced by PublicKeyCredential.toJSON.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// DecodeString decodes base64url with or without padding.
+func DecodeString(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+type RelyingParty struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type User struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are the options of navigator.credentials.create.
+type CreationOptions struct {
+	RP                     RelyingParty           `json:"rp"`
+	User                   User                   `json:"user"`
+	Challenge              Bytes                  `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the options of navigator.credentials.get.
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+func NewCreationOptions(rp RelyingParty, user User, challenge []byte, excludeIDs [][]byte) *CreationOptions {
+	return &CreationOptions{
+		RP:        rp,
+		User:      user,
+		Challenge: challenge,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            Timeout,
+		ExcludeCredentials: descriptors(excludeIDs),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "discouraged",
+			UserVerification: "discouraged",
+		},
+		Attestation: "none",
+	}
+}
+
+func NewRequestOptions(rpID string, challenge []byte, allowIDs [][]byte) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout,
+		RPID:             rpID,
+		AllowCredentials: descriptors(allowIDs),
+		UserVerification: "discouraged",
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	result := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return result
+}
+
+// AttestationResponse is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.create.
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AttestationObject Bytes `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.get.
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AuthenticatorData Bytes `json:"authenticatorData"`
+		Signature         Bytes `json:"signature"`
+		UserHandle        Bytes `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// Credential is a registered public key credential.
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE_Key of the credential
+	PublicKey []byte
+	SignCount uint32
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// verifyClientData checks the client data of a ceremony against the challenge it was given
+// and the relying party id, the origin must be the rp id or one of its subdomains.
+func verifyClientData(raw []byte, ceremony string, challenge []byte, rpID string) error {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("%w: invalid client data: %v", ErrVerification, err)
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: unexpected client data type %q", ErrVerification, data.Type)
+	}
+	got, err := DecodeString(data.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrVerification)
+	}
+	origin, err := url.Parse(data.Origin)
+	if err != nil {
+		return fmt.Errorf("%w: invalid origin %q", ErrVerification, data.Origin)
+	}
+	host := origin.Hostname()
+	if host != rpID && !strings.HasSuffix(host, "."+rpID) {
+		return fmt.Errorf("%w: origin %q does not belong to %q", ErrVerification, data.Origin, rpID)
+	}
+	// browsers only expose WebAuthn to secure contexts, plain http is only possible on localhost
+	if origin.Scheme != "https" && !(origin.Scheme == "http" && host == "localhost") {
+		return fmt.Errorf("%w: insecure origin %q", ErrVerification, data.Origin)
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrVerification)
+	}
+	result := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if result.flags&flagAttestedData == 0 {
+		return result, nil
+	}
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrVerification)
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return nil, fmt.Errorf("%w: credential id too short", ErrVerification)
+	}
+	result.credentialID, rest = rest[:idLen], rest[idLen:]
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid credential public key: %v", ErrVerification, err)
+	}
+	result.publicKey = rest[:len(rest)-len(after)]
+	return result, nil
+}
+
+func (d *authenticatorData) verify(rpID string) error {
+	hash := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(d.rpIDHash, hash[:]) {
+		return fmt.Errorf("%w: rp id hash mismatch", ErrVerification)
+	}
+	if d.flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user not present", ErrVerification)
+	}
+	return nil
+}
+
+// VerifyRegistration verifies the credential created for challenge and returns it.
+func VerifyRegistration(resp *AttestationResponse, challenge []byte, rpID string) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type %q", ErrVerification, resp.Type)
+	}
+	if err := verifyClientData(resp.Response.ClientDataJSON, typeCreate, challenge, rpID); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid attestation object: %v", ErrVerification, err)
+	}
+	attestation, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid attestation object", ErrVerification)
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object without authenticator data", ErrVerification)
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := authData.verify(rpID); err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential", ErrVerification)
+	}
+	if len(resp.RawID) > 0 && !bytes.Equal(resp.RawID, authData.credentialID) {
+		return nil, fmt.Errorf("%w: credential id mismatch", ErrVerification)
+	}
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion verifies the signature of the credential over challenge and returns the
+// new signature counter of the authenticator.
+func VerifyAssertion(resp *AssertionResponse, challenge []byte, rpID string, credential *Credential) (uint32, error) {
+	if resp.Type != "public-key" {
+		return 0, fmt.Errorf("%w: unexpected credential type %q", ErrVerification, resp.Type)
+	}
+	if !bytes.Equal(resp.RawID, credential.ID) {
+		return 0, fmt.Errorf("%w: credential id mismatch", ErrVerification)
+	}
+	if err := verifyClientData(resp.Response.ClientDataJSON, typeGet, challenge, rpID); err != nil {
+		return 0, err
+	}
+	authData, err := parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := authData.verify(rpID); err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, resp.Response.Signature) {
+		return 0, fmt.Errorf("%w: invalid signature", ErrVerification)
+	}
+
+	// a counter that does not increase reveals a cloned authenticator, authenticators
+	// without a counter always report zero
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, fmt.Errorf("%w: signature counter did not increase", ErrVerification)
+	}
+	return authData.signCount, nil
+}
+
+type publicKey struct {
+	key crypto.PublicKey
+}
+
+func (k *publicKey) verify(data, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	}
+	return false
+}
+
+// parsePublicKey parses a COSE_Key (RFC 9053) of the supported algorithms.
+func parsePublicKey(raw []byte) (*publicKey, error) {
+	decoded, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid public key: %v", ErrVerification, err)
+	}
+	params, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid public key", ErrVerification)
+	}
+	kty, _ := params[int64(1)].(int64)
+	alg, _ := params[int64(3)].(int64)
+	crv, _ := params[int64(-1)].(int64)
+	x, _ := params[int64(-2)].([]byte)
+	y, _ := params[int64(-3)].([]byte)
+
+	switch {
+	case kty == 2 && alg == AlgES256 && crv == 1:
+		if len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: invalid P-256 key", ErrVerification)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		// reject points off the curve by going through the checked encoding
+		if _, err := key.ECDH(); err != nil {
+			return nil, fmt.Errorf("%w: invalid P-256 key", ErrVerification)
+		}
+		return &publicKey{key: key}, nil
+	case kty == 1 && alg == AlgEdDSA && crv == 6:
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid Ed25519 key", ErrVerification)
+		}
+		return &publicKey{key: ed25519.PublicKey(x)}, nil
+	case kty == 3 && alg == AlgRS256:
+		n, _ := params[int64(-1)].([]byte)
+		e, _ := params[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: invalid RSA key", ErrVerification)
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &publicKey{key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}}, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported public key type %d with algorithm %d", ErrVerification, kty, alg)
+}
@@ -0,0 +1,205 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// encodeCBOR is the encoder of the items decodeCBOR supports, to play the authenticator.
+func encodeCBOR(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 1<<16:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case map[any]any:
+		keys := make([]any, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return string(encodeCBOR(keys[i])) < string(encodeCBOR(keys[j])) })
+		out := head(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(out, encodeCBOR(k)...)
+			out = append(out, encodeCBOR(v[k])...)
+		}
+		return out
+	}
+	panic("unsupported")
+}
+
+const (
+	testRPID   = "wiki.example.com"
+	testOrigin = "https://wiki.example.com"
+)
+
+func authData(rpID string, flags byte, signCount uint32, credentialID, publicKey []byte) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	data := append(hash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+	if credentialID != nil {
+		data = append(data, make([]byte, 16)...) // aaguid
+		data = binary.BigEndian.AppendUint16(data, uint16(len(credentialID)))
+		data = append(data, credentialID...)
+		data = append(data, publicKey...)
+	}
+	return data
+}
+
+func clientDataJSON(t *testing.T, ceremony string, challenge []byte, origin string) []byte {
+	data, err := json.Marshal(map[string]any{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+	require.NoError(t, err)
+	return data
+}
+
+func register(t *testing.T, credentialID, publicKey, challenge []byte, origin, rpID string) *AttestationResponse {
+	resp := &AttestationResponse{ID: base64.RawURLEncoding.EncodeToString(credentialID), RawID: credentialID, Type: "public-key"}
+	resp.Response.ClientDataJSON = clientDataJSON(t, typeCreate, challenge, origin)
+	resp.Response.AttestationObject = encodeCBOR(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": authData(rpID, flagUserPresent|flagAttestedData, 0, credentialID, publicKey),
+	})
+	return resp
+}
+
+func assert(t *testing.T, credentialID, challenge []byte, signCount uint32, sign func([]byte) []byte) *AssertionResponse {
+	resp := &AssertionResponse{ID: base64.RawURLEncoding.EncodeToString(credentialID), RawID: credentialID, Type: "public-key"}
+	resp.Response.ClientDataJSON = clientDataJSON(t, typeGet, challenge, testOrigin)
+	resp.Response.AuthenticatorData = authData(testRPID, flagUserPresent, signCount, nil, nil)
+	hash := sha256.Sum256(resp.Response.ClientDataJSON)
+	resp.Response.Signature = sign(append(append([]byte(nil), resp.Response.AuthenticatorData...), hash[:]...))
+	return resp
+}
+
+func TestES256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	coseKey := encodeCBOR(map[any]any{
+		1:  2,
+		3:  AlgES256,
+		-1: 1,
+		-2: key.X.FillBytes(make([]byte, 32)),
+		-3: key.Y.FillBytes(make([]byte, 32)),
+	})
+	credentialID := []byte("credential-1")
+	challenge := []byte("registration-challenge")
+
+	// the options round trip through the JSON the browser helpers expect
+	options, err := json.Marshal(NewCreationOptions(RelyingParty{ID: testRPID, Name: "PandaWiki"}, User{ID: []byte("u1"), Name: "admin", DisplayName: "admin"}, challenge, [][]byte{[]byte("old")}))
+	require.NoError(t, err)
+	require.Contains(t, string(options), `"challenge":"cmVnaXN0cmF0aW9uLWNoYWxsZW5nZQ"`)
+	require.Contains(t, string(options), `"excludeCredentials":[{"type":"public-key","id":"b2xk"}]`)
+
+	credential, err := VerifyRegistration(register(t, credentialID, coseKey, challenge, testOrigin, testRPID), challenge, testRPID)
+	require.NoError(t, err)
+	require.Equal(t, credentialID, credential.ID)
+	require.Equal(t, coseKey, credential.PublicKey)
+
+	for _, c := range []struct {
+		challenge   []byte
+		origin      string
+		rpID        string
+		expectedRP  string
+		description string
+	}{
+		{[]byte("other"), testOrigin, testRPID, testRPID, "challenge"},
+		{challenge, "https://evil.example.org", testRPID, testRPID, "origin"},
+		{challenge, "http://wiki.example.com", testRPID, testRPID, "insecure origin"},
+		{challenge, testOrigin, "example.com", testRPID, "rp id hash"},
+	} {
+		_, err := VerifyRegistration(register(t, credentialID, coseKey, c.challenge, c.origin, c.rpID), challenge, c.expectedRP)
+		require.ErrorIs(t, err, ErrVerification, c.description)
+	}
+
+	sign := func(data []byte) []byte {
+		digest := sha256.Sum256(data)
+		signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		return signature
+	}
+	challenge = []byte("login-challenge")
+	count, err := VerifyAssertion(assert(t, credentialID, challenge, 5, sign), challenge, testRPID, credential)
+	require.NoError(t, err)
+	require.Equal(t, uint32(5), count)
+
+	credential.SignCount = count
+	_, err = VerifyAssertion(assert(t, credentialID, challenge, 5, sign), challenge, testRPID, credential)
+	require.ErrorIs(t, err, ErrVerification, "replayed counter")
+
+	resp := assert(t, credentialID, challenge, 6, sign)
+	resp.Response.Signature[len(resp.Response.Signature)-1] ^= 0xff
+	_, err = VerifyAssertion(resp, challenge, testRPID, credential)
+	require.ErrorIs(t, err, ErrVerification, "tampered signature")
+
+	_, err = VerifyAssertion(assert(t, []byte("credential-2"), challenge, 6, sign), challenge, testRPID, credential)
+	require.ErrorIs(t, err, ErrVerification, "other credential")
+}
+
+func TestEdDSA(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	coseKey := encodeCBOR(map[any]any{1: 1, 3: AlgEdDSA, -1: 6, -2: []byte(pub)})
+	credentialID := []byte("credential-ed")
+	challenge := []byte("challenge")
+
+	credential, err := VerifyRegistration(register(t, credentialID, coseKey, challenge, testOrigin, testRPID), challenge, testRPID)
+	require.NoError(t, err)
+
+	// authenticators without a counter keep reporting zero
+	sign := func(data []byte) []byte { return ed25519.Sign(priv, data) }
+	for range 2 {
+		count, err := VerifyAssertion(assert(t, credentialID, challenge, 0, sign), challenge, testRPID, credential)
+		require.NoError(t, err)
+		require.Zero(t, count)
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	value, rest, err := decodeCBOR(append(encodeCBOR(map[any]any{"a": []byte{1}, -300: 70000}), 0xff))
+	require.NoError(t, err)
+	require.Equal(t, map[any]any{"a": []byte{1}, int64(-300): int64(70000)}, value)
+	require.Equal(t, []byte{0xff}, rest)
+
+	for _, data := range [][]byte{
+		{},
+		{0x42, 0x01},       // byte string shorter than its length
+		{0x9f},             // indefinite length array
+		{0xa1, 0x80, 0x01}, // array as map key
+		{0xfb, 0, 0, 0, 0, 0, 0, 0, 0},
+	} {
+		_, _, err := decodeCBOR(data)
+		require.Error(t, err, data)
+	}
+}
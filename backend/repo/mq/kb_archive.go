@@ -0,0 +1,25 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/mq"
+)
+
+type KBArchiveRepository struct {
+	producer mq.MQProducer
+}
+
+func NewKBArchiveRepository(producer mq.MQProducer) *KBArchiveRepository {
+	return &KBArchiveRepository{producer: producer}
+}
+
+func (r *KBArchiveRepository) AsyncImport(ctx context.Context, jobID string) error {
+	taskBytes, err := json.Marshal(&domain.KBImportTask{JobID: jobID})
+	if err != nil {
+		return err
+	}
+	return r.producer.Produce(ctx, domain.KBImportTopic, "", taskBytes)
+}
@@ -0,0 +1,26 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/mq"
+)
+
+type NodeCollabRepository struct {
+	producer mq.MQProducer
+}
+
+func NewNodeCollabRepository(producer mq.MQProducer) *NodeCollabRepository {
+	return &NodeCollabRepository{producer: producer}
+}
+
+// Publish relays a collaboration event to the other api servers.
+func (r *NodeCollabRepository) Publish(ctx context.Context, event *domain.NodeCollabEvent) error {
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return r.producer.Produce(ctx, domain.NodeCollabTopic, "", eventBytes)
+}
@@ -12,4 +12,9 @@ var ProviderSet = wire.NewSet(
 
 	cache.ProviderSet,
 	NewRAGRepository,
+	NewWebhookRepository,
+	NewKBArchiveRepository,
+	NewReleaseScheduleRepository,
+	NewNodeCollabRepository,
+	NewRAGEvalRepository,
 )
@@ -0,0 +1,25 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/mq"
+)
+
+type RAGEvalRepository struct {
+	producer mq.MQProducer
+}
+
+func NewRAGEvalRepository(producer mq.MQProducer) *RAGEvalRepository {
+	return &RAGEvalRepository{producer: producer}
+}
+
+func (r *RAGEvalRepository) AsyncRun(ctx context.Context, runID string) error {
+	taskBytes, err := json.Marshal(&domain.RAGEvalTask{RunID: runID})
+	if err != nil {
+		return err
+	}
+	return r.producer.Produce(ctx, domain.RAGEvalTopic, "", taskBytes)
+}
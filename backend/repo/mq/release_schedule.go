@@ -0,0 +1,26 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/mq"
+)
+
+type ReleaseScheduleRepository struct {
+	producer mq.MQProducer
+}
+
+func NewReleaseScheduleRepository(producer mq.MQProducer) *ReleaseScheduleRepository {
+	return &ReleaseScheduleRepository{producer: producer}
+}
+
+// AsyncPushRelease hands a release executed by the consumer to the api servers for group chat push.
+func (r *ReleaseScheduleRepository) AsyncPushRelease(ctx context.Context, kbID, releaseID string) error {
+	eventBytes, err := json.Marshal(&domain.KBReleasePushEvent{KBID: kbID, ReleaseID: releaseID})
+	if err != nil {
+		return err
+	}
+	return r.producer.Produce(ctx, domain.KBReleasePushTopic, "", eventBytes)
+}
@@ -0,0 +1,30 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/mq"
+)
+
+type WebhookRepository struct {
+	producer mq.MQProducer
+}
+
+func NewWebhookRepository(producer mq.MQProducer) *WebhookRepository {
+	return &WebhookRepository{producer: producer}
+}
+
+func (r *WebhookRepository) AsyncDeliver(ctx context.Context, deliveryIDs []string) error {
+	for _, deliveryID := range deliveryIDs {
+		taskBytes, err := json.Marshal(&domain.WebhookDeliveryTask{DeliveryID: deliveryID})
+		if err != nil {
+			return err
+		}
+		if err := r.producer.Produce(ctx, domain.WebhookDeliveryTopic, "", taskBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	v1 "github.com/chaitin/panda-wiki/api/stat/v1"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
+)
+
+// answerCacheSchema adds the embeddings on startup instead of in a versioned migration, like
+// the pgvector RAG schema, so that deployments without the vector extension keep working with
+// the answer cache off.
+var answerCacheSchema = []string{
+	`CREATE EXTENSION IF NOT EXISTS vector`,
+	`ALTER TABLE answer_cache_entries ADD COLUMN IF NOT EXISTS embedding vector`,
+}
+
+// answerCacheIndexMaxDims is the most dimensions an hnsw index supports.
+const answerCacheIndexMaxDims = 2000
+
+type AnswerCacheRepo struct {
+	db     *pg.DB
+	logger *log.Logger
+	// enabled is false when the vector extension is not available
+	enabled bool
+	// indexedDims holds the embedding dimensions having an index
+	indexedDims sync.Map
+}
+
+func NewAnswerCacheRepo(db *pg.DB, logger *log.Logger) *AnswerCacheRepo {
+	r := &AnswerCacheRepo{
+		db:      db,
+		logger:  logger.WithModule("repo.pg.answer_cache"),
+		enabled: true,
+	}
+	for _, stmt := range answerCacheSchema {
+		if err := db.Exec(stmt).Error; err != nil {
+			r.logger.Warn("the answer cache requires the vector extension, it is disabled", log.Error(err))
+			r.enabled = false
+			break
+		}
+	}
+	return r
+}
+
+// Enabled reports whether entries can be stored and looked up.
+func (r *AnswerCacheRepo) Enabled() bool {
+	return r.enabled
+}
+
+// FindSimilar returns the id and similarity of the entry of the kb and auth groups created
+// since the given time whose question is the nearest to embedding, gorm.ErrRecordNotFound
+// when none reaches minSimilarity.
+func (r *AnswerCacheRepo) FindSimilar(ctx context.Context, kbID, groupKey string, since time.Time, embedding []float32, minSimilarity float64) (string, float64, error) {
+	if !r.enabled {
+		return "", 0, gorm.ErrRecordNotFound
+	}
+	// the embeddings of another model can not be compared, and the cast to the dimensions
+	// of the query lets the index of those be used
+	dims := len(embedding)
+	distance := fmt.Sprintf("embedding::vector(%d) <=> ?::vector(%d)", dims, dims)
+	vector := domain.AnswerCacheEmbedding(embedding)
+	var match struct {
+		ID       string
+		Distance float64
+	}
+	err := r.db.WithContext(ctx).
+		Model(&domain.AnswerCacheEntry{}).
+		Select("id, "+distance+" AS distance", vector).
+		Where("kb_id = ? AND group_key = ? AND created_at >= ?", kbID, groupKey, since).
+		Where(fmt.Sprintf("vector_dims(embedding) = %d", dims)).
+		Where(distance+" <= ?", vector, 1-minSimilarity).
+		Order(gorm.Expr(distance, vector)).
+		Limit(1).
+		Take(&match).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			err = fmt.Errorf("find similar answer cache entry failed: %w", err)
+		}
+		return "", 0, err
+	}
+	return match.ID, 1 - match.Distance, nil
+}
+
+// ensureEmbeddingIndex creates the index of the embeddings with dims dimensions, an hnsw
+// index needs the dimensions of the vectors and the embedding model may change.
+func (r *AnswerCacheRepo) ensureEmbeddingIndex(ctx context.Context, dims int) {
+	if dims == 0 || dims > answerCacheIndexMaxDims {
+		return
+	}
+	if _, ok := r.indexedDims.Load(dims); ok {
+		return
+	}
+	if err := r.db.WithContext(ctx).Exec(fmt.Sprintf(
+		"CREATE INDEX IF NOT EXISTS idx_answer_cache_entries_embedding_%d ON answer_cache_entries "+
+			"USING hnsw ((embedding::vector(%d)) vector_cosine_ops) WHERE vector_dims(embedding) = %d",
+		dims, dims, dims)).Error; err != nil {
+		r.logger.Warn("create answer cache embedding index failed", log.Int("dims", dims), log.Error(err))
+		return
+	}
+	r.indexedDims.Store(dims, true)
+}
+
+func (r *AnswerCacheRepo) Get(ctx context.Context, id string) (*domain.AnswerCacheEntry, error) {
+	var entry domain.AnswerCacheEntry
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// IsStale reports whether a node of the entry was released again or deleted after the entry
+// was created.
+func (r *AnswerCacheRepo) IsStale(ctx context.Context, entry *domain.AnswerCacheEntry) (bool, error) {
+	if len(entry.NodeIDs) == 0 {
+		return false, nil
+	}
+	var released bool
+	if err := r.db.WithContext(ctx).
+		Raw("SELECT EXISTS (SELECT 1 FROM node_releases WHERE node_id = ANY(?) AND created_at > ?)", entry.NodeIDs, entry.CreatedAt).
+		Scan(&released).Error; err != nil {
+		return false, fmt.Errorf("check answer cache node releases failed: %w", err)
+	}
+	if released {
+		return true, nil
+	}
+	var count int64
+	if err := r.db.WithContext(ctx).
+		Model(&domain.Node{}).
+		Where("id = ANY(?)", entry.NodeIDs).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("count answer cache nodes failed: %w", err)
+	}
+	return count < int64(len(entry.NodeIDs)), nil
+}
+
+// Create stores the entry and drops the least recently used entries over
+// domain.AnswerCacheMaxEntries.
+func (r *AnswerCacheRepo) Create(ctx context.Context, entry *domain.AnswerCacheEntry) error {
+	if !r.enabled {
+		return nil
+	}
+	r.ensureEmbeddingIndex(ctx, len(entry.Embedding))
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(entry).Error; err != nil {
+			return fmt.Errorf("create answer cache entry failed: %w", err)
+		}
+		keep := tx.Model(&domain.AnswerCacheEntry{}).
+			Select("id").
+			Where("kb_id = ? AND group_key = ?", entry.KBID, entry.GroupKey).
+			Order("last_hit_at DESC").
+			Limit(domain.AnswerCacheMaxEntries)
+		if err := tx.
+			Where("kb_id = ? AND group_key = ? AND id NOT IN (?)", entry.KBID, entry.GroupKey, keep).
+			Delete(&domain.AnswerCacheEntry{}).Error; err != nil {
+			return fmt.Errorf("trim answer cache failed: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *AnswerCacheRepo) Delete(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&domain.AnswerCacheEntry{}).Error
+}
+
+// DeleteByNodeIDs drops the entries answered from any of the nodes.
+func (r *AnswerCacheRepo) DeleteByNodeIDs(ctx context.Context, kbID string, nodeIDs []string) error {
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ? AND node_ids && ?", kbID, pq.StringArray(nodeIDs)).
+		Delete(&domain.AnswerCacheEntry{}).Error; err != nil {
+		return fmt.Errorf("delete answer cache entries failed: %w", err)
+	}
+	return nil
+}
+
+// RecordLookup counts a lookup in the stats of the day, hits also count the entry hit.
+func (r *AnswerCacheRepo) RecordLookup(ctx context.Context, kbID string, hit *domain.AnswerCacheEntry) error {
+	stat := &domain.AnswerCacheStat{KBID: kbID, Day: time.Now().Truncate(24 * time.Hour), Lookups: 1}
+	if hit != nil {
+		stat.Hits = 1
+		stat.SavedTokens = hit.TotalTokens
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "kb_id"}, {Name: "day"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"lookups":      gorm.Expr("answer_cache_stats.lookups + ?", stat.Lookups),
+				"hits":         gorm.Expr("answer_cache_stats.hits + ?", stat.Hits),
+				"saved_tokens": gorm.Expr("answer_cache_stats.saved_tokens + ?", stat.SavedTokens),
+			}),
+		}).Create(stat).Error; err != nil {
+			return fmt.Errorf("record answer cache lookup failed: %w", err)
+		}
+		if hit == nil {
+			return nil
+		}
+		result := tx.Model(&domain.AnswerCacheEntry{}).
+			Where("id = ?", hit.ID).
+			Updates(map[string]any{
+				"hit_count":   gorm.Expr("hit_count + 1"),
+				"last_hit_at": time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("update answer cache hit failed: %w", result.Error)
+		}
+		return nil
+	})
+}
+
+// GetStat sums the lookups of the kb since the given time.
+func (r *AnswerCacheRepo) GetStat(ctx context.Context, kbID string, since time.Time) (*v1.StatAnswerCacheResp, error) {
+	stat := &v1.StatAnswerCacheResp{}
+	if err := r.db.WithContext(ctx).
+		Model(&domain.AnswerCacheStat{}).
+		Select("COALESCE(SUM(lookups), 0) AS lookups, COALESCE(SUM(hits), 0) AS hits, COALESCE(SUM(saved_tokens), 0) AS saved_tokens").
+		Where("kb_id = ? AND day >= ?", kbID, since.Truncate(24*time.Hour)).
+		Scan(stat).Error; err != nil {
+		return nil, fmt.Errorf("get answer cache stat failed: %w", err)
+	}
+	if err := r.db.WithContext(ctx).
+		Model(&domain.AnswerCacheEntry{}).
+		Where("kb_id = ?", kbID).
+		Count(&stat.Entries).Error; err != nil {
+		return nil, fmt.Errorf("count answer cache entries failed: %w", err)
+	}
+	if stat.Lookups > 0 {
+		stat.HitRatio = float64(stat.Hits) / float64(stat.Lookups)
+	}
+	return stat, nil
+}
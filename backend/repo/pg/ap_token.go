@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/lib/pq"
+	"github.com/samber/lo"
 	"gorm.io/gorm"
 
+	"github.com/chaitin/panda-wiki/consts"
 	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/log"
 	"github.com/chaitin/panda-wiki/store/cache"
@@ -29,20 +32,28 @@ func NewAPITokenRepo(db *pg.DB, logger *log.Logger, cache *cache.Cache) *APIToke
 	}
 }
 
+// GetByTokenWithCache looks the token up by its hash, it returns nil for unknown, expired and
+// rotated-out tokens.
 func (r *APITokenRepo) GetByTokenWithCache(ctx context.Context, token string) (*domain.APIToken, error) {
-	cacheKey := apiTokenCacheKey(token)
+	hash := domain.HashAPIToken(token)
+	cacheKey := apiTokenCacheKey(hash)
 
 	cachedData, err := r.cache.Get(ctx, cacheKey).Result()
 	if err == nil && cachedData != "" {
 		var apiToken domain.APIToken
 		if err := json.Unmarshal([]byte(cachedData), &apiToken); err == nil {
+			if !apiToken.Valid(hash, time.Now()) {
+				return nil, nil
+			}
 			return &apiToken, nil
 		}
 	}
 
 	// 缓存未命中，从数据库查询
 	var apiToken domain.APIToken
-	if err := r.db.WithContext(ctx).Where("token = ?", token).First(&apiToken).Error; err != nil {
+	if err := r.db.WithContext(ctx).
+		Where("token_hash = ? OR (previous_token_hash = ? AND previous_token_hash <> '')", hash, hash).
+		First(&apiToken).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -55,6 +66,9 @@ func (r *APITokenRepo) GetByTokenWithCache(ctx context.Context, token string) (*
 		}
 	}
 
+	if !apiToken.Valid(hash, time.Now()) {
+		return nil, nil
+	}
 	return &apiToken, nil
 }
 
@@ -105,12 +119,21 @@ func (r *APITokenRepo) Update(ctx context.Context, req *domain.UpdateAPITokenReq
 	if req.Permission != nil {
 		updateMap["permission"] = *req.Permission
 	}
+	if req.Scopes != nil {
+		updateMap["scopes"] = pq.StringArray(lo.Map(*req.Scopes, func(scope consts.APITokenScope, _ int) string { return string(scope) }))
+	}
+	if req.ExpiresAt != nil {
+		updateMap["expires_at"] = *req.ExpiresAt
+	}
 	if req.RateLimitPerMinute != nil {
 		updateMap["rate_limit_per_minute"] = *req.RateLimitPerMinute
 	}
 	if req.DailyQuota != nil {
 		updateMap["daily_quota"] = *req.DailyQuota
 	}
+	if req.MonthlyTokenQuota != nil {
+		updateMap["monthly_token_quota"] = *req.MonthlyTokenQuota
+	}
 	if len(updateMap) == 0 {
 		return nil
 	}
@@ -122,7 +145,7 @@ func (r *APITokenRepo) Update(ctx context.Context, req *domain.UpdateAPITokenReq
 		return fmt.Errorf("update api token failed: %w", err)
 	}
 
-	if err := r.invalidateTokenCache(ctx, currentToken.Token); err != nil {
+	if err := r.invalidateTokenCache(ctx, currentToken); err != nil {
 		return err
 	}
 	return nil
@@ -143,22 +166,95 @@ func (r *APITokenRepo) Delete(ctx context.Context, id, kbID, userID string) erro
 		return fmt.Errorf("delete api token failed: %w", err)
 	}
 
-	if err := r.invalidateTokenCache(ctx, currentToken.Token); err != nil {
+	if err := r.invalidateTokenCache(ctx, currentToken); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *APITokenRepo) invalidateTokenCache(ctx context.Context, token string) error {
-	if token == "" || r.cache == nil {
+// Rotate replaces the token hash, the previous token keeps working until previousExpiresAt
+// when it is set.
+func (r *APITokenRepo) Rotate(ctx context.Context, id, kbID, userID, tokenHash, tokenPrefix string, previousExpiresAt *time.Time) (*domain.APIToken, error) {
+	currentToken, err := r.GetByID(ctx, id, kbID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if currentToken == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	previousTokenHash := ""
+	if previousExpiresAt != nil {
+		previousTokenHash = currentToken.TokenHash
+	}
+	if err := r.db.WithContext(ctx).
+		Model(&domain.APIToken{}).
+		Where("id = ? AND kb_id = ? AND user_id = ?", id, kbID, userID).
+		Updates(map[string]any{
+			"token_hash":          tokenHash,
+			"token_prefix":        tokenPrefix,
+			"previous_token_hash": previousTokenHash,
+			"previous_expires_at": previousExpiresAt,
+			"updated_at":          time.Now(),
+		}).Error; err != nil {
+		return nil, fmt.Errorf("rotate api token failed: %w", err)
+	}
+	if err := r.invalidateTokenCache(ctx, currentToken); err != nil {
+		return nil, err
+	}
+	return r.GetByID(ctx, id, kbID, userID)
+}
+
+// UsageReport sums the audited calls of the tokens of userID in the kb per interval, token,
+// endpoint and model.
+func (r *APITokenRepo) UsageReport(ctx context.Context, req *domain.APITokenUsageReq, userID string) ([]*domain.APITokenUsageItem, error) {
+	items := make([]*domain.APITokenUsageItem, 0)
+	query := r.db.WithContext(ctx).
+		Table("api_call_audits").
+		Select(`date_trunc(?, api_call_audits.created_at) AS period,
+			api_call_audits.api_token_id AS token_id,
+			api_tokens.name AS token_name,
+			api_call_audits.endpoint,
+			api_call_audits.model,
+			COUNT(*) AS calls,
+			COUNT(*) FILTER (WHERE api_call_audits.status_code >= 400) AS failed_calls,
+			COALESCE(SUM(api_call_audits.prompt_tokens), 0) AS prompt_tokens,
+			COALESCE(SUM(api_call_audits.completion_tokens), 0) AS completion_tokens,
+			COALESCE(SUM(api_call_audits.total_tokens), 0) AS total_tokens`, req.Interval).
+		Joins("JOIN api_tokens ON api_tokens.id = api_call_audits.api_token_id").
+		Where("api_tokens.kb_id = ? AND api_tokens.user_id = ?", req.KBID, userID).
+		Where("api_call_audits.created_at >= ? AND api_call_audits.created_at < ?", req.Start, req.End)
+	if req.TokenID != "" {
+		query = query.Where("api_call_audits.api_token_id = ?", req.TokenID)
+	}
+	if err := query.
+		Group("period, api_call_audits.api_token_id, api_tokens.name, api_call_audits.endpoint, api_call_audits.model").
+		Order("period ASC, token_name ASC, api_call_audits.endpoint ASC").
+		Scan(&items).Error; err != nil {
+		return nil, fmt.Errorf("api token usage report failed: %w", err)
+	}
+	return items, nil
+}
+
+func (r *APITokenRepo) invalidateTokenCache(ctx context.Context, apiToken *domain.APIToken) error {
+	if r.cache == nil {
+		return nil
+	}
+	keys := make([]string, 0, 2)
+	for _, hash := range []string{apiToken.TokenHash, apiToken.PreviousTokenHash} {
+		if hash != "" {
+			keys = append(keys, apiTokenCacheKey(hash))
+		}
+	}
+	if len(keys) == 0 {
 		return nil
 	}
-	if err := r.cache.Del(ctx, apiTokenCacheKey(token)).Err(); err != nil {
+	if err := r.cache.Del(ctx, keys...).Err(); err != nil {
 		return fmt.Errorf("invalidate api token cache failed: %w", err)
 	}
 	return nil
 }
 
-func apiTokenCacheKey(token string) string {
-	return fmt.Sprintf("api_token:%s", token)
+func apiTokenCacheKey(tokenHash string) string {
+	return fmt.Sprintf("api_token:%s", tokenHash)
 }
@@ -45,3 +45,16 @@ func (r *APICallAuditRepo) CountByTokenSince(ctx context.Context, apiTokenID, en
 	}
 	return count, nil
 }
+
+// SumTokensByTokenSince sums the llm tokens billed to the api token since the given time.
+func (r *APICallAuditRepo) SumTokensByTokenSince(ctx context.Context, apiTokenID string, since time.Time) (int64, error) {
+	var total int64
+	if err := r.db.WithContext(ctx).
+		Model(&domain.APICallAudit{}).
+		Select("COALESCE(SUM(total_tokens), 0)").
+		Where("api_token_id = ? AND created_at >= ?", apiTokenID, since).
+		Scan(&total).Error; err != nil {
+		return 0, fmt.Errorf("sum api call audit tokens failed: %w", err)
+	}
+	return total, nil
+}
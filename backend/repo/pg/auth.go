@@ -312,6 +312,9 @@ func (r *AuthRepo) GetOrCreateAuth(ctx context.Context, auth *domain.Auth, sourc
 			}
 			return err
 		}
+		if existing.Disabled {
+			return domain.ErrAuthDisabled
+		}
 
 		updateMap := map[string]interface{}{
 			"last_login_time": time.Now(),
@@ -337,3 +340,70 @@ func (r *AuthRepo) GetOrCreateAuth(ctx context.Context, auth *domain.Auth, sourc
 
 	return auth, nil
 }
+
+// SyncAuthGroups makes the auth a member of exactly the groups of sourceType in the kb whose
+// SyncId is in syncIDs, the missing groups are created at the root. Groups of other sources
+// are left alone.
+func (r *AuthRepo) SyncAuthGroups(ctx context.Context, kbID string, authID uint, sourceType consts.SourceType, syncIDs []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// serialize concurrent logins so that a group is created once
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", fmt.Sprintf("auth_groups:%s:%s", kbID, sourceType)).Error; err != nil {
+			return err
+		}
+
+		var groups []domain.AuthGroup
+		if err := tx.Where("kb_id = ? AND source_type = ?", kbID, sourceType).Find(&groups).Error; err != nil {
+			return err
+		}
+		existing := lo.SliceToMap(groups, func(g domain.AuthGroup) (string, domain.AuthGroup) { return g.SyncId, g })
+
+		var maxPosition float64
+		if err := tx.Model(&domain.AuthGroup{}).Where("kb_id = ?", kbID).
+			Select("COALESCE(MAX(position), 0)").Scan(&maxPosition).Error; err != nil {
+			return err
+		}
+
+		keep := make([]uint, 0, len(syncIDs))
+		for _, syncID := range syncIDs {
+			if group, ok := existing[syncID]; ok {
+				keep = append(keep, group.ID)
+				continue
+			}
+			maxPosition += 1000
+			group := &domain.AuthGroup{
+				Name:       lo.Substring(syncID, 0, 100),
+				KbID:       kbID,
+				Position:   maxPosition,
+				AuthIDs:    []int64{int64(authID)},
+				SyncId:     syncID,
+				SourceType: sourceType,
+			}
+			if err := tx.Create(group).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(keep) > 0 {
+			if err := tx.Model(&domain.AuthGroup{}).
+				Where("id IN (?)", keep).
+				Where("NOT (? = ANY(COALESCE(auth_ids, '{}')))", authID).
+				Updates(map[string]any{
+					"auth_ids":   gorm.Expr("array_append(COALESCE(auth_ids, '{}'), ?)", authID),
+					"updated_at": time.Now(),
+				}).Error; err != nil {
+				return err
+			}
+		}
+
+		query := tx.Model(&domain.AuthGroup{}).
+			Where("kb_id = ? AND source_type = ?", kbID, sourceType).
+			Where("? = ANY(auth_ids)", authID)
+		if len(keep) > 0 {
+			query = query.Where("id NOT IN (?)", keep)
+		}
+		return query.Updates(map[string]any{
+			"auth_ids":   gorm.Expr("array_remove(auth_ids, ?)", authID),
+			"updated_at": time.Now(),
+		}).Error
+	})
+}
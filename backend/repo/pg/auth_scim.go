@@ -0,0 +1,186 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+)
+
+const (
+	authRevokedKeyPrefix = "auth_revoked:"
+	// authRevokedTTL outlives the share sessions, which last 30 days
+	authRevokedTTL = 31 * 24 * time.Hour
+)
+
+// ListAuthsBySource lists the readers of a login source of the kb, narrowed down to the
+// given union id or SCIM userName when not empty.
+func (r *AuthRepo) ListAuthsBySource(ctx context.Context, kbID string, sourceType consts.SourceType, unionID, scimUserName string) ([]domain.Auth, error) {
+	auths := make([]domain.Auth, 0)
+	query := r.db.WithContext(ctx).Model(&domain.Auth{}).
+		Where("kb_id = ? AND source_type = ?", kbID, sourceType)
+	if unionID != "" {
+		query = query.Where("union_id = ?", unionID)
+	}
+	if scimUserName != "" {
+		query = query.Where("(LOWER(scim_user_name) = LOWER(?) OR (scim_user_name = '' AND union_id = ?))", scimUserName, scimUserName)
+	}
+	if err := query.Order("id").Find(&auths).Error; err != nil {
+		return nil, err
+	}
+	return auths, nil
+}
+
+func (r *AuthRepo) GetAuthsByIDs(ctx context.Context, kbID string, ids []uint) ([]domain.Auth, error) {
+	auths := make([]domain.Auth, 0)
+	if len(ids) == 0 {
+		return auths, nil
+	}
+	if err := r.db.WithContext(ctx).Model(&domain.Auth{}).
+		Where("kb_id = ? AND id IN (?)", kbID, ids).
+		Where("source_type NOT IN (?)", consts.BotSourceTypes).
+		Find(&auths).Error; err != nil {
+		return nil, err
+	}
+	return auths, nil
+}
+
+// CreateSCIMAuth creates a reader pushed by the IdP, counted in the license limit of
+// readers like the ones created at login.
+func (r *AuthRepo) CreateSCIMAuth(ctx context.Context, auth *domain.Auth) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&domain.Auth{}).
+			Where("kb_id = ?", auth.KBID).
+			Where("source_type NOT IN (?)", consts.BotSourceTypes).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) >= domain.GetBaseEditionLimitation(ctx).MaxSSOUser {
+			return fmt.Errorf("exceed max auth limit for kb %s, current count: %d, max limit: %d", auth.KBID, count, domain.GetBaseEditionLimitation(ctx).MaxSSOUser)
+		}
+		return tx.Create(auth).Error
+	})
+}
+
+// UpdateSCIMAuth saves the attributes of a reader managed by the IdP.
+func (r *AuthRepo) UpdateSCIMAuth(ctx context.Context, auth *domain.Auth) error {
+	return r.db.WithContext(ctx).Model(&domain.Auth{}).
+		Where("kb_id = ? AND id = ?", auth.KBID, auth.ID).
+		Updates(map[string]any{
+			"union_id":       auth.UnionID,
+			"scim_user_name": auth.ScimUserName,
+			"user_info":      auth.UserInfo,
+			"disabled":       auth.Disabled,
+			"updated_at":     time.Now(),
+		}).Error
+}
+
+// DeleteAuthWithMemberships deletes a reader and removes it from the auth groups of the kb.
+func (r *AuthRepo) DeleteAuthWithMemberships(ctx context.Context, kbID string, authID uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.AuthGroup{}).
+			Where("kb_id = ?", kbID).
+			Where("? = ANY(auth_ids)", authID).
+			Updates(map[string]any{
+				"auth_ids":   gorm.Expr("array_remove(auth_ids, ?)", authID),
+				"updated_at": time.Now(),
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Where("kb_id = ? AND id = ?", kbID, authID).Delete(&domain.Auth{}).Error
+	})
+}
+
+// RevokeAuthSessions invalidates the share sessions of a reader issued until now. Sessions
+// live in redis keyed by their own id, so the revocation time is checked against the login
+// time of every session instead.
+func (r *AuthRepo) RevokeAuthSessions(ctx context.Context, authID uint) error {
+	return r.cache.Set(ctx, fmt.Sprintf("%s%d", authRevokedKeyPrefix, authID), time.Now().Unix(), authRevokedTTL).Err()
+}
+
+// IsAuthSessionRevoked reports whether a session of the reader logged in at loginAt, a unix
+// time, was revoked afterwards.
+func (r *AuthRepo) IsAuthSessionRevoked(ctx context.Context, authID uint, loginAt int64) (bool, error) {
+	value, err := r.cache.Get(ctx, fmt.Sprintf("%s%d", authRevokedKeyPrefix, authID)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return false, nil
+		}
+		return false, err
+	}
+	revokedAt, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	// a session of the same second as the revocation is rejected as well
+	return loginAt <= revokedAt, nil
+}
+
+func (r *AuthRepo) ListAuthGroupsBySource(ctx context.Context, kbID string, sourceType consts.SourceType) ([]domain.AuthGroup, error) {
+	groups := make([]domain.AuthGroup, 0)
+	if err := r.db.WithContext(ctx).Model(&domain.AuthGroup{}).
+		Where("kb_id = ? AND source_type = ?", kbID, sourceType).
+		Order("id").
+		Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *AuthRepo) GetAuthGroupBySource(ctx context.Context, kbID string, sourceType consts.SourceType, id uint) (*domain.AuthGroup, error) {
+	var group domain.AuthGroup
+	if err := r.db.WithContext(ctx).Model(&domain.AuthGroup{}).
+		Where("kb_id = ? AND source_type = ? AND id = ?", kbID, sourceType, id).
+		First(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// CreateAuthGroup creates a group at the root, after the existing groups of the kb.
+func (r *AuthRepo) CreateAuthGroup(ctx context.Context, group *domain.AuthGroup) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var maxPosition float64
+		if err := tx.Model(&domain.AuthGroup{}).Where("kb_id = ?", group.KbID).
+			Select("COALESCE(MAX(position), 0)").Scan(&maxPosition).Error; err != nil {
+			return err
+		}
+		group.Position = maxPosition + 1000
+		return tx.Create(group).Error
+	})
+}
+
+func (r *AuthRepo) UpdateAuthGroup(ctx context.Context, group *domain.AuthGroup) error {
+	return r.db.WithContext(ctx).Model(&domain.AuthGroup{}).
+		Where("kb_id = ? AND id = ?", group.KbID, group.ID).
+		Updates(map[string]any{
+			"name":       group.Name,
+			"sync_id":    group.SyncId,
+			"auth_ids":   group.AuthIDs,
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// DeleteAuthGroup deletes a group with its node permissions, its child groups move to the
+// root.
+func (r *AuthRepo) DeleteAuthGroup(ctx context.Context, kbID string, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("auth_group_id = ?", id).Delete(&domain.NodeAuthGroup{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&domain.AuthGroup{}).
+			Where("kb_id = ? AND parent_id = ?", kbID, id).
+			Update("parent_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Where("kb_id = ? AND id = ?", kbID, id).Delete(&domain.AuthGroup{}).Error
+	})
+}
@@ -2,6 +2,7 @@ package pg
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"strconv"
 	"time"
@@ -66,8 +67,10 @@ func (r *ConversationRepository) CreateConversation(ctx context.Context, convers
 	return r.db.WithContext(ctx).Create(conversation).Error
 }
 
-func (r *ConversationRepository) GetConversationList(ctx context.Context, request *domain.ConversationListReq) ([]*domain.ConversationListItem, uint64, error) {
-	conversations := []*domain.ConversationListItem{}
+const ungroundedConversationSQL = "EXISTS (SELECT 1 FROM conversation_messages WHERE conversation_messages.conversation_id = conversations.id AND conversation_messages.ungrounded)"
+
+// conversationListQuery applies the filters of request.
+func (r *ConversationRepository) conversationListQuery(ctx context.Context, request *domain.ConversationListReq) *gorm.DB {
 	query := r.db.WithContext(ctx).
 		Model(&domain.Conversation{}).
 		Where("conversations.kb_id = ?", request.KBID)
@@ -81,13 +84,22 @@ func (r *ConversationRepository) GetConversationList(ctx context.Context, reques
 	if request.RemoteIP != nil && *request.RemoteIP != "" {
 		query = query.Where("conversations.remote_ip like ?", "%"+*request.RemoteIP+"%")
 	}
+	if request.Ungrounded {
+		query = query.Where(ungroundedConversationSQL)
+	}
+	return query
+}
+
+func (r *ConversationRepository) GetConversationList(ctx context.Context, request *domain.ConversationListReq) ([]*domain.ConversationListItem, uint64, error) {
+	conversations := []*domain.ConversationListItem{}
+	query := r.conversationListQuery(ctx, request)
 	var count int64
 	if err := query.Count(&count).Error; err != nil {
 		return nil, 0, err
 	}
 	if err := query.
 		Joins("left join apps on conversations.app_id = apps.id").
-		Select("conversations.*, apps.name as app_name, apps.type as app_type").
+		Select("conversations.*, apps.name as app_name, apps.type as app_type, " + ungroundedConversationSQL + " as ungrounded").
 		Offset(request.Offset()).
 		Limit(request.Limit()).
 		Order("conversations.created_at DESC").
@@ -97,6 +109,45 @@ func (r *ConversationRepository) GetConversationList(ctx context.Context, reques
 	return conversations, uint64(count), nil
 }
 
+// GetConversationExportList returns a batch of the conversations GetConversationList lists,
+// in the same order.
+func (r *ConversationRepository) GetConversationExportList(ctx context.Context, request *domain.ConversationListReq, offset, limit int) ([]*domain.ConversationListItem, error) {
+	conversations := []*domain.ConversationListItem{}
+	if err := r.conversationListQuery(ctx, request).
+		Joins("left join apps on conversations.app_id = apps.id").
+		Select("conversations.*, apps.name as app_name, apps.type as app_type, " + ungroundedConversationSQL + " as ungrounded").
+		Offset(offset).
+		Limit(limit).
+		Order("conversations.created_at DESC, conversations.id").
+		Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+func (r *ConversationRepository) GetConversationMessagesByIDs(ctx context.Context, conversationIDs []string) ([]*domain.ConversationMessage, error) {
+	messages := []*domain.ConversationMessage{}
+	if err := r.db.WithContext(ctx).
+		Model(&domain.ConversationMessage{}).
+		Where("conversation_id IN ?", conversationIDs).
+		Order("created_at asc").
+		Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *ConversationRepository) GetConversationReferencesByIDs(ctx context.Context, conversationIDs []string) ([]*domain.ConversationReference, error) {
+	references := []*domain.ConversationReference{}
+	if err := r.db.WithContext(ctx).
+		Model(&domain.ConversationReference{}).
+		Where("conversation_id IN ?", conversationIDs).
+		Find(&references).Error; err != nil {
+		return nil, err
+	}
+	return references, nil
+}
+
 func (r *ConversationRepository) GetConversationDetail(ctx context.Context, kbID, conversationID string) (*domain.ConversationDetailResp, error) {
 	conversation := &domain.ConversationDetailResp{}
 	query := r.db.WithContext(ctx).
@@ -112,6 +163,14 @@ func (r *ConversationRepository) GetConversationDetail(ctx context.Context, kbID
 	return conversation, nil
 }
 
+func (r *ConversationRepository) GetConversationByID(ctx context.Context, conversationID string) (*domain.Conversation, error) {
+	var conversation domain.Conversation
+	if err := r.db.WithContext(ctx).Where("id = ?", conversationID).First(&conversation).Error; err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
 func (r *ConversationRepository) GetConversationReferences(ctx context.Context, conversationID string) ([]*domain.ConversationReference, error) {
 	references := []*domain.ConversationReference{}
 	if err := r.db.WithContext(ctx).
@@ -196,6 +255,16 @@ func (r *ConversationRepository) GetConversationMessagesDetailByKbID(ctx context
 	return message, nil
 }
 
+// UpdateMessageCitations records the grounding of an assistant answer.
+func (r *ConversationRepository) UpdateMessageCitations(ctx context.Context, messageID string, citations domain.AnswerCitations) error {
+	return r.db.WithContext(ctx).Model(&domain.ConversationMessage{}).
+		Where("id = ?", messageID).
+		Updates(map[string]any{
+			"citations":  citations,
+			"ungrounded": citations.Ungrounded(),
+		}).Error
+}
+
 // 更新反馈信息
 func (r *ConversationRepository) UpdateMessageFeedback(ctx context.Context, feedback *domain.FeedbackRequest) error {
 	// 更新字段
@@ -320,3 +389,126 @@ func (r *ConversationRepository) GetConversationCountByAppType(ctx context.Conte
 	}
 	return result, nil
 }
+
+// GetRetentionSettings returns the kb conversation retention settings, or disabled settings
+// when not configured.
+func (r *ConversationRepository) GetRetentionSettings(ctx context.Context, kbID string) (*domain.ConversationRetentionSettings, error) {
+	var setting domain.Setting
+	err := r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingConversationRetention).
+		First(&setting).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &domain.ConversationRetentionSettings{}, nil
+		}
+		return nil, err
+	}
+	var settings domain.ConversationRetentionSettings
+	if err := json.Unmarshal(setting.Value, &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (r *ConversationRepository) UpsertRetentionSettings(ctx context.Context, kbID string, settings *domain.ConversationRetentionSettings) error {
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	result := r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingConversationRetention).
+		Updates(map[string]any{
+			"value":      value,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Table("settings").Create(&domain.Setting{
+		KBID:  kbID,
+		Key:   domain.SettingConversationRetention,
+		Value: value,
+	}).Error
+}
+
+// ListRetentionSettings returns the enabled retention settings by kb id.
+func (r *ConversationRepository) ListRetentionSettings(ctx context.Context) (map[string]*domain.ConversationRetentionSettings, error) {
+	var settings []*domain.Setting
+	if err := r.db.WithContext(ctx).Table("settings").
+		Where("key = ?", domain.SettingConversationRetention).
+		Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string]*domain.ConversationRetentionSettings)
+	for _, setting := range settings {
+		var retention domain.ConversationRetentionSettings
+		if err := json.Unmarshal(setting.Value, &retention); err != nil {
+			r.logger.Error("invalid conversation retention settings", log.String("kb_id", setting.KBID), log.Error(err))
+			continue
+		}
+		if retention.Enabled && retention.Check() == nil {
+			result[setting.KBID] = &retention
+		}
+	}
+	return result, nil
+}
+
+// expiredConversationIDs selects the conversations of the kb without messages since before.
+func (r *ConversationRepository) expiredConversationIDs(tx *gorm.DB, kbID string, before time.Time) *gorm.DB {
+	return tx.Model(&domain.Conversation{}).
+		Select("id").
+		Where("kb_id = ? AND created_at < ?", kbID, before).
+		Where("NOT EXISTS (SELECT 1 FROM conversation_messages WHERE conversation_messages.conversation_id = conversations.id AND conversation_messages.created_at >= ?)", before)
+}
+
+// DeleteConversationsBefore deletes the conversations of the kb without messages since before,
+// with their messages and references.
+func (r *ConversationRepository) DeleteConversationsBefore(ctx context.Context, kbID string, before time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id IN (?)", r.expiredConversationIDs(tx, kbID, before)).
+			Delete(&domain.ConversationReference{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id IN (?)", r.expiredConversationIDs(tx, kbID, before)).
+			Delete(&domain.ConversationMessage{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id IN (?)", r.expiredConversationIDs(tx, kbID, before)).Delete(&domain.Conversation{})
+		if result.Error != nil {
+			return result.Error
+		}
+		count = result.RowsAffected
+		return nil
+	})
+	return count, err
+}
+
+// AnonymizeConversationsBefore masks the remote ip and user info of the conversations of the
+// kb without messages since before. Only where the user info came from is kept.
+func (r *ConversationRepository) AnonymizeConversationsBefore(ctx context.Context, kbID string, before time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.ConversationMessage{}).
+			Where("conversation_id IN (?) AND remote_ip <> ''", r.expiredConversationIDs(tx, kbID, before).Where("NOT anonymized")).
+			Update("remote_ip", "").Error; err != nil {
+			return err
+		}
+		result := tx.Model(&domain.Conversation{}).
+			Where("id IN (?)", r.expiredConversationIDs(tx, kbID, before).Where("NOT anonymized")).
+			Updates(map[string]any{
+				"remote_ip":  "",
+				"info":       gorm.Expr("jsonb_build_object('user_info', jsonb_strip_nulls(jsonb_build_object('from', info->'user_info'->'from')))"),
+				"anonymized": true,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		count = result.RowsAffected
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,198 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
+)
+
+type GitSyncRepository struct {
+	db     *pg.DB
+	logger *log.Logger
+}
+
+func NewGitSyncRepository(db *pg.DB, logger *log.Logger) *GitSyncRepository {
+	return &GitSyncRepository{
+		db:     db,
+		logger: logger.WithModule("repo.pg.git_sync"),
+	}
+}
+
+// GetSettings returns the kb git sync settings, or empty settings when not configured.
+func (r *GitSyncRepository) GetSettings(ctx context.Context, kbID string) (*domain.GitSyncSettings, error) {
+	var setting domain.Setting
+	err := r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingGitSync).
+		First(&setting).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &domain.GitSyncSettings{}, nil
+		}
+		return nil, err
+	}
+	var settings domain.GitSyncSettings
+	if err := json.Unmarshal(setting.Value, &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (r *GitSyncRepository) UpsertSettings(ctx context.Context, kbID string, settings *domain.GitSyncSettings) error {
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	var setting domain.Setting
+	err = r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingGitSync).
+		First(&setting).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return r.db.WithContext(ctx).Table("settings").Create(&domain.Setting{
+				KBID:  kbID,
+				Key:   domain.SettingGitSync,
+				Value: value,
+			}).Error
+		}
+		return err
+	}
+
+	return r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingGitSync).
+		Updates(map[string]any{
+			"value":      value,
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// ListEnabledSettings returns the settings of every kb with scheduled sync enabled, keyed by kb id.
+func (r *GitSyncRepository) ListEnabledSettings(ctx context.Context) (map[string]*domain.GitSyncSettings, error) {
+	var settings []*domain.Setting
+	if err := r.db.WithContext(ctx).Table("settings").
+		Where("key = ?", domain.SettingGitSync).
+		Where("value->>'enabled' = 'true'").
+		Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string]*domain.GitSyncSettings, len(settings))
+	for _, setting := range settings {
+		var s domain.GitSyncSettings
+		if err := json.Unmarshal(setting.Value, &s); err != nil {
+			r.logger.Warn("invalid git sync settings", log.String("kb_id", setting.KBID), log.Error(err))
+			continue
+		}
+		result[setting.KBID] = &s
+	}
+	return result, nil
+}
+
+// GetNodes returns the path -> node mapping of a kb.
+func (r *GitSyncRepository) GetNodes(ctx context.Context, kbID string) (map[string]*domain.GitSyncNode, error) {
+	var nodes []*domain.GitSyncNode
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ?", kbID).
+		Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string]*domain.GitSyncNode, len(nodes))
+	for _, node := range nodes {
+		result[node.Path] = node
+	}
+	return result, nil
+}
+
+// SaveNode records the mapping of a single path, replacing the node it pointed to before.
+func (r *GitSyncRepository) SaveNode(ctx context.Context, node *domain.GitSyncNode) error {
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "kb_id"}, {Name: "path"}},
+			DoUpdates: clause.AssignmentColumns([]string{"node_id", "hash", "updated_at"}),
+		}).
+		Create(node).Error
+}
+
+// ReplaceNodes swaps the whole mapping of a kb for nodes.
+func (r *GitSyncRepository) ReplaceNodes(ctx context.Context, kbID string, nodes []*domain.GitSyncNode) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("kb_id = ?", kbID).Delete(&domain.GitSyncNode{}).Error; err != nil {
+			return err
+		}
+		if len(nodes) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(nodes, 1000).Error
+	})
+}
+
+func (r *GitSyncRepository) CreateRun(ctx context.Context, run *domain.GitSyncRun) error {
+	return r.db.WithContext(ctx).Create(run).Error
+}
+
+func (r *GitSyncRepository) UpdateRun(ctx context.Context, run *domain.GitSyncRun) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.GitSyncRun{}).
+		Where("id = ?", run.ID).
+		Updates(map[string]any{
+			"commit":      run.Commit,
+			"status":      run.Status,
+			"error":       run.Error,
+			"result":      run.Result,
+			"finished_at": run.FinishedAt,
+		}).Error
+}
+
+func (r *GitSyncRepository) ListRuns(ctx context.Context, req *domain.GitSyncRunListReq) (int64, []*domain.GitSyncRun, error) {
+	query := r.db.WithContext(ctx).
+		Model(&domain.GitSyncRun{}).
+		Where("kb_id = ?", req.KBID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return 0, nil, err
+	}
+	var runs []*domain.GitSyncRun
+	if err := query.
+		Order("created_at DESC").
+		Offset(req.Offset()).
+		Limit(req.Limit()).
+		Find(&runs).Error; err != nil {
+		return 0, nil, err
+	}
+	return total, runs, nil
+}
+
+// GetLatestRunTimes returns when each kb last started a sync in direction.
+func (r *GitSyncRepository) GetLatestRunTimes(ctx context.Context, direction domain.GitSyncDirection) (map[string]time.Time, error) {
+	var rows []struct {
+		KBID      string
+		CreatedAt time.Time
+	}
+	if err := r.db.WithContext(ctx).
+		Model(&domain.GitSyncRun{}).
+		Select("kb_id, MAX(created_at) AS created_at").
+		Where("direction = ?", direction).
+		Group("kb_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		result[row.KBID] = row.CreatedAt
+	}
+	return result, nil
+}
+
+func (r *GitSyncRepository) DeleteRunsBefore(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).
+		Where("created_at < ?", before).
+		Delete(&domain.GitSyncRun{}).Error
+}
@@ -0,0 +1,139 @@
+package pg
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
+)
+
+type HandoffRepository struct {
+	db     *pg.DB
+	logger *log.Logger
+}
+
+func NewHandoffRepository(db *pg.DB, logger *log.Logger) *HandoffRepository {
+	return &HandoffRepository{
+		db:     db,
+		logger: logger.WithModule("repo.pg.handoff"),
+	}
+}
+
+// GetPending returns the pending handoff of the user in the chat.
+func (r *HandoffRepository) GetPending(ctx context.Context, appID, channelID, remoteUserID string) (*domain.ConversationHandoff, error) {
+	var handoff domain.ConversationHandoff
+	if err := r.db.WithContext(ctx).
+		Where("app_id = ? AND channel_id = ? AND remote_user_id = ? AND status = ?", appID, channelID, remoteUserID, domain.HandoffStatusPending).
+		First(&handoff).Error; err != nil {
+		return nil, err
+	}
+	return &handoff, nil
+}
+
+// Create stores the handoff with its first message. It returns false without creating
+// anything when the user already has a pending handoff in the chat.
+func (r *HandoffRepository) Create(ctx context.Context, handoff *domain.ConversationHandoff, message *domain.HandoffMessage) (bool, error) {
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(handoff)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		created = true
+		return tx.Create(message).Error
+	})
+	return created, err
+}
+
+// AddMessage appends the message to the handoff.
+func (r *HandoffRepository) AddMessage(ctx context.Context, message *domain.HandoffMessage) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		return tx.Model(&domain.ConversationHandoff{}).
+			Where("id = ?", message.HandoffID).
+			Update("last_message_at", message.CreatedAt).Error
+	})
+}
+
+func (r *HandoffRepository) Get(ctx context.Context, kbID, id string) (*domain.ConversationHandoff, error) {
+	var handoff domain.ConversationHandoff
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ? AND id = ?", kbID, id).
+		First(&handoff).Error; err != nil {
+		return nil, err
+	}
+	return &handoff, nil
+}
+
+// List returns the handoffs of the kb, the ones with the latest messages first.
+func (r *HandoffRepository) List(ctx context.Context, kbID string, status domain.HandoffStatus, offset, limit int) (int64, []*domain.ConversationHandoff, error) {
+	query := r.db.WithContext(ctx).Model(&domain.ConversationHandoff{}).Where("kb_id = ?", kbID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return 0, nil, err
+	}
+	handoffs := make([]*domain.ConversationHandoff, 0)
+	if err := query.
+		Order("last_message_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&handoffs).Error; err != nil {
+		return 0, nil, err
+	}
+	return total, handoffs, nil
+}
+
+func (r *HandoffRepository) ListMessages(ctx context.Context, handoffID string) ([]*domain.HandoffMessage, error) {
+	messages := make([]*domain.HandoffMessage, 0)
+	if err := r.db.WithContext(ctx).
+		Where("handoff_id = ?", handoffID).
+		Order("created_at ASC").
+		Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Release unmutes the AI for the handoff, it returns false when the handoff was already
+// released.
+func (r *HandoffRepository) Release(ctx context.Context, id, userID string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&domain.ConversationHandoff{}).
+		Where("id = ? AND status = ?", id, domain.HandoffStatusPending).
+		Updates(map[string]any{
+			"status":      domain.HandoffStatusReleased,
+			"released_by": userID,
+			"released_at": time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountDislikes counts the answers the user disliked in the chat since the given time.
+func (r *HandoffRepository) CountDislikes(ctx context.Context, appID, channelID, remoteUserID string, since time.Time) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).
+		Table("conversation_messages m").
+		Joins("JOIN conversations c ON c.id = m.conversation_id").
+		Where("c.app_id = ? AND c.info->>'channel_id' = ? AND COALESCE(c.info->'user_info'->>'user_id', '') = ?", appID, channelID, remoteUserID).
+		Where("m.created_at >= ? AND (m.info->>'score')::int = ?", since, domain.DisLike).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,302 @@
+package pg
+
+import (
+	"context"
+	"time"
+
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
+)
+
+type KBArchiveRepository struct {
+	db     *pg.DB
+	logger *log.Logger
+}
+
+func NewKBArchiveRepository(db *pg.DB, logger *log.Logger) *KBArchiveRepository {
+	return &KBArchiveRepository{
+		db:     db,
+		logger: logger.WithModule("repo.pg.kb_archive"),
+	}
+}
+
+// archiveNode adds the nav_id column, which domain.Node doesn't carry.
+type archiveNode struct {
+	domain.Node `gorm:"embedded"`
+	NavID       string `gorm:"column:nav_id"`
+}
+
+func (archiveNode) TableName() string {
+	return "nodes"
+}
+
+// GetKBArchive reads everything an archive holds for kbID. Only node releases referenced
+// by a kb release are included.
+func (r *KBArchiveRepository) GetKBArchive(ctx context.Context, kbID string) (*domain.KBArchive, error) {
+	db := r.db.WithContext(ctx)
+	archive := &domain.KBArchive{}
+
+	var nodes []*archiveNode
+	if err := db.Where("kb_id = ?", kbID).Order("created_at ASC").Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	var authGroups []struct {
+		NodeID    string
+		GroupName string
+		Perm      string
+	}
+	if err := db.Table("node_auth_groups AS nag").
+		Select("nag.node_id, ag.name AS group_name, nag.perm").
+		Joins("INNER JOIN auth_groups AS ag ON ag.id = nag.auth_group_id").
+		Joins("INNER JOIN nodes AS n ON n.id = nag.node_id").
+		Where("n.kb_id = ?", kbID).
+		Scan(&authGroups).Error; err != nil {
+		return nil, err
+	}
+	nodeAuthGroups := make(map[string][]domain.KBArchiveNodeAuthGroup)
+	for _, g := range authGroups {
+		nodeAuthGroups[g.NodeID] = append(nodeAuthGroups[g.NodeID], domain.KBArchiveNodeAuthGroup{
+			GroupName: g.GroupName,
+			Perm:      consts.NodePermName(g.Perm),
+		})
+	}
+	for _, n := range nodes {
+		archive.Nodes = append(archive.Nodes, &domain.KBArchiveNode{
+			ID:          n.ID,
+			Type:        n.Type,
+			Status:      n.Status,
+			Name:        n.Name,
+			Content:     n.Content,
+			Meta:        n.Meta,
+			ParentID:    n.ParentID,
+			Position:    n.Position,
+			NavID:       n.NavID,
+			Permissions: n.Permissions,
+			AuthGroups:  nodeAuthGroups[n.ID],
+			CreatedAt:   n.CreatedAt,
+			UpdatedAt:   n.UpdatedAt,
+		})
+	}
+
+	if err := db.Where("kb_id = ?", kbID).Order("position ASC").Find(&archive.Navs).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("kb_id = ?", kbID).Order("created_at ASC").Find(&archive.NavReleases).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("kb_id = ?", kbID).Find(&archive.Apps).Error; err != nil {
+		return nil, err
+	}
+	var settings []*domain.Setting
+	if err := db.Table("settings").
+		Where("kb_id = ? AND key IN ?", kbID, domain.KBArchiveSettingKeys).
+		Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	for _, s := range settings {
+		archive.Settings = append(archive.Settings, &domain.KBArchiveSetting{Key: s.Key, Value: s.Value})
+	}
+	if err := db.Where("kb_id = ?", kbID).Order("version ASC").Find(&archive.Prompts).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("kb_id = ?", kbID).Order("created_at ASC").Find(&archive.Releases).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("kb_id = ?", kbID).Find(&archive.ReleaseNodes).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("kb_id = ?", kbID).
+		Where("id IN (?)", db.Model(&domain.KBReleaseNodeRelease{}).Select("node_release_id").Where("kb_id = ?", kbID)).
+		Order("created_at ASC").
+		Find(&archive.NodeReleases).Error; err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func (r *KBArchiveRepository) GetNavs(ctx context.Context, kbID string) ([]*domain.Nav, error) {
+	var navs []*domain.Nav
+	if err := r.db.WithContext(ctx).Where("kb_id = ?", kbID).Find(&navs).Error; err != nil {
+		return nil, err
+	}
+	return navs, nil
+}
+
+// CreateKBArchive writes an archive whose ids have already been remapped into kbID, in one transaction.
+// Apps replace the settings of the kb app of the same type, settings are upserted by key and
+// auth groups are matched by name in kbID; it returns how many auth group grants had no match.
+// Navs already present in kbID are expected to be left out of archive.Navs.
+func (r *KBArchiveRepository) CreateKBArchive(ctx context.Context, kbID string, archive *domain.KBArchive) (int, error) {
+	skipped := 0
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(archive.Navs) > 0 {
+			if err := tx.CreateInBatches(archive.Navs, 1000).Error; err != nil {
+				return err
+			}
+		}
+
+		var groups []*domain.AuthGroup
+		if err := tx.Where("kb_id = ?", kbID).Find(&groups).Error; err != nil {
+			return err
+		}
+		groupIDs := lo.SliceToMap(groups, func(g *domain.AuthGroup) (string, uint) { return g.Name, g.ID })
+
+		now := time.Now()
+		nodes := make([]*archiveNode, 0, len(archive.Nodes))
+		grants := make([]*domain.NodeAuthGroup, 0)
+		for _, n := range archive.Nodes {
+			nodes = append(nodes, &archiveNode{
+				Node: domain.Node{
+					ID:          n.ID,
+					KBID:        kbID,
+					Type:        n.Type,
+					Status:      n.Status,
+					RagInfo:     domain.RagInfo{Status: consts.NodeRagStatusPending},
+					Name:        n.Name,
+					Content:     n.Content,
+					Meta:        n.Meta,
+					ParentID:    n.ParentID,
+					Position:    n.Position,
+					Permissions: n.Permissions,
+					EditTime:    now,
+					CreatedAt:   n.CreatedAt,
+					UpdatedAt:   n.UpdatedAt,
+				},
+				NavID: n.NavID,
+			})
+			for _, g := range n.AuthGroups {
+				groupID, ok := groupIDs[g.GroupName]
+				if !ok {
+					skipped++
+					continue
+				}
+				grants = append(grants, &domain.NodeAuthGroup{
+					NodeID:      n.ID,
+					AuthGroupID: int(groupID),
+					Perm:        g.Perm,
+					CreatedAt:   now,
+				})
+			}
+		}
+		if len(nodes) > 0 {
+			if err := tx.CreateInBatches(nodes, 500).Error; err != nil {
+				return err
+			}
+		}
+		if len(grants) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(grants, 1000).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, app := range archive.Apps {
+			result := tx.Model(&domain.App{}).
+				Where("kb_id = ? AND type = ?", kbID, app.Type).
+				Updates(map[string]any{"name": app.Name, "settings": app.Settings, "updated_at": now})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				if err := tx.Create(app).Error; err != nil {
+					return err
+				}
+			}
+		}
+		for _, s := range archive.Settings {
+			result := tx.Table("settings").
+				Where("kb_id = ? AND key = ?", kbID, s.Key).
+				Updates(map[string]any{"value": []byte(s.Value), "updated_at": now})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				if err := tx.Table("settings").Create(&domain.Setting{
+					KBID:      kbID,
+					Key:       s.Key,
+					Value:     s.Value,
+					CreatedAt: now,
+					UpdatedAt: now,
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if len(archive.Prompts) > 0 {
+			if err := tx.CreateInBatches(archive.Prompts, 1000).Error; err != nil {
+				return err
+			}
+		}
+		if len(archive.NodeReleases) > 0 {
+			if err := tx.CreateInBatches(archive.NodeReleases, 500).Error; err != nil {
+				return err
+			}
+		}
+		if len(archive.Releases) > 0 {
+			if err := tx.CreateInBatches(archive.Releases, 1000).Error; err != nil {
+				return err
+			}
+		}
+		if len(archive.ReleaseNodes) > 0 {
+			if err := tx.CreateInBatches(archive.ReleaseNodes, 2000).Error; err != nil {
+				return err
+			}
+		}
+		if len(archive.NavReleases) > 0 {
+			if err := tx.CreateInBatches(archive.NavReleases, 2000).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return skipped, nil
+}
+
+func (r *KBArchiveRepository) CreateImportJob(ctx context.Context, job *domain.KBImportJob) error {
+	return r.db.WithContext(ctx).Create(job).Error
+}
+
+func (r *KBArchiveRepository) GetImportJob(ctx context.Context, id string) (*domain.KBImportJob, error) {
+	var job domain.KBImportJob
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FailStaleImportJobs fails the jobs still running without progress since before
+// with message, and returns them.
+func (r *KBArchiveRepository) FailStaleImportJobs(ctx context.Context, before time.Time, message string) ([]*domain.KBImportJob, error) {
+	var jobs []*domain.KBImportJob
+	now := time.Now()
+	if err := r.db.WithContext(ctx).
+		Model(&jobs).
+		Clauses(clause.Returning{}).
+		Where("status = ?", domain.KBImportJobStatusRunning).
+		Where("updated_at <= ?", before).
+		Updates(map[string]any{
+			"status":      domain.KBImportJobStatusFailed,
+			"error":       message,
+			"finished_at": now,
+			"updated_at":  now,
+		}).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *KBArchiveRepository) UpdateImportJob(ctx context.Context, id string, updates map[string]any) error {
+	updates["updated_at"] = time.Now()
+	return r.db.WithContext(ctx).
+		Model(&domain.KBImportJob{}).
+		Where("id = ?", id).
+		Updates(updates).Error
+}
@@ -636,9 +636,12 @@ func (r *KnowledgeBaseRepository) CreateKBRelease(ctx context.Context, release *
 		if err := tx.Create(release).Error; err != nil {
 			return err
 		}
-		// create release node for all released nodes
+		// create release node for all released nodes, unpublished ones are left out
 		var nodeReleases []*domain.NodeRelease
 		if err := tx.Where("kb_id = ?", release.KBID).
+			Where("node_id NOT IN (?)", tx.Model(&domain.Node{}).
+				Select("id").
+				Where("kb_id = ? AND status = ?", release.KBID, domain.NodeStatusUnreleased)).
 			Select("DISTINCT ON (node_id) id, node_id").
 			Order("node_id, updated_at DESC").
 			Find(&nodeReleases).Error; err != nil {
@@ -793,6 +796,16 @@ func (r *KnowledgeBaseRepository) getKBReleaseDocsByReleaseID(ctx context.Contex
 	return docs, nil
 }
 
+func (r *KnowledgeBaseRepository) GetKBReleaseByID(ctx context.Context, kbID, releaseID string) (*domain.KBRelease, error) {
+	var release domain.KBRelease
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ? AND id = ?", kbID, releaseID).
+		First(&release).Error; err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
 func (r *KnowledgeBaseRepository) GetLatestRelease(ctx context.Context, kbID string) (*domain.KBRelease, error) {
 	var release domain.KBRelease
 	if err := r.db.WithContext(ctx).
@@ -0,0 +1,168 @@
+package pg
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
+)
+
+type KnowledgeGapRepository struct {
+	db     *pg.DB
+	logger *log.Logger
+}
+
+func NewKnowledgeGapRepository(db *pg.DB, logger *log.Logger) *KnowledgeGapRepository {
+	return &KnowledgeGapRepository{
+		db:     db,
+		logger: logger.WithModule("repo.pg.knowledge_gap"),
+	}
+}
+
+func (r *KnowledgeGapRepository) CreateReport(ctx context.Context, report *domain.KnowledgeGapReport) error {
+	return r.db.WithContext(ctx).Create(report).Error
+}
+
+// GetReport returns the report, of any kb when kbID is empty.
+func (r *KnowledgeGapRepository) GetReport(ctx context.Context, kbID, id string) (*domain.KnowledgeGapReport, error) {
+	var report domain.KnowledgeGapReport
+	query := r.db.WithContext(ctx).Where("id = ?", id)
+	if kbID != "" {
+		query = query.Where("kb_id = ?", kbID)
+	}
+	if err := query.First(&report).Error; err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (r *KnowledgeGapRepository) ListReports(ctx context.Context, kbID string, offset, limit int) (int64, []*domain.KnowledgeGapReport, error) {
+	query := r.db.WithContext(ctx).Model(&domain.KnowledgeGapReport{}).Where("kb_id = ?", kbID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return 0, nil, err
+	}
+	reports := make([]*domain.KnowledgeGapReport, 0)
+	if err := query.
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&reports).Error; err != nil {
+		return 0, nil, err
+	}
+	return total, reports, nil
+}
+
+// ListPendingReportIDs returns the reports waiting to run, oldest first.
+func (r *KnowledgeGapRepository) ListPendingReportIDs(ctx context.Context) ([]string, error) {
+	ids := make([]string, 0)
+	if err := r.db.WithContext(ctx).
+		Model(&domain.KnowledgeGapReport{}).
+		Where("status = ?", domain.KnowledgeGapReportStatusPending).
+		Order("created_at ASC").
+		Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *KnowledgeGapRepository) UpdateReportIfStatus(ctx context.Context, id string, status domain.KnowledgeGapReportStatus, updates map[string]any) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&domain.KnowledgeGapReport{}).
+		Where("id = ? AND status = ?", id, status).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *KnowledgeGapRepository) UpdateReport(ctx context.Context, id string, updates map[string]any) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.KnowledgeGapReport{}).
+		Where("id = ?", id).
+		Updates(updates).Error
+}
+
+// FailStaleReports fails the reports still running after the timeout, their consumer is gone.
+func (r *KnowledgeGapRepository) FailStaleReports(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.KnowledgeGapReport{}).
+		Where("status = ? AND created_at < ?", domain.KnowledgeGapReportStatusRunning, before).
+		Updates(map[string]any{
+			"status":      domain.KnowledgeGapReportStatusFailed,
+			"error":       "report timed out",
+			"finished_at": time.Now(),
+		}).Error
+}
+
+func (r *KnowledgeGapRepository) CreateGaps(ctx context.Context, gaps []*domain.KnowledgeGap) error {
+	if len(gaps) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(gaps).Error
+}
+
+func (r *KnowledgeGapRepository) ListGaps(ctx context.Context, reportID string) ([]*domain.KnowledgeGap, error) {
+	gaps := make([]*domain.KnowledgeGap, 0)
+	if err := r.db.WithContext(ctx).
+		Where("report_id = ?", reportID).
+		Order("rank ASC").
+		Find(&gaps).Error; err != nil {
+		return nil, err
+	}
+	return gaps, nil
+}
+
+func (r *KnowledgeGapRepository) GetGap(ctx context.Context, kbID, id string) (*domain.KnowledgeGap, error) {
+	var gap domain.KnowledgeGap
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ? AND id = ?", kbID, id).
+		First(&gap).Error; err != nil {
+		return nil, err
+	}
+	return &gap, nil
+}
+
+// SetGapNode records the draft node of the gap unless one was created already.
+func (r *KnowledgeGapRepository) SetGapNode(ctx context.Context, id, nodeID string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&domain.KnowledgeGap{}).
+		Where("id = ? AND node_id = ''", id).
+		Update("node_id", nodeID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReleaseGapNode forgets the draft node of the gap when it is still nodeID.
+func (r *KnowledgeGapRepository) ReleaseGapNode(ctx context.Context, id, nodeID string) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.KnowledgeGap{}).
+		Where("id = ? AND node_id = ?", id, nodeID).
+		Update("node_id", "").Error
+}
+
+// ListRecentQuestions returns the user questions of the kb since the given time, newest first,
+// with the retrieval, feedback and grounding of their answers.
+func (r *KnowledgeGapRepository) ListRecentQuestions(ctx context.Context, kbID string, since time.Time, limit int) ([]*domain.KnowledgeGapQuestion, error) {
+	questions := make([]*domain.KnowledgeGapQuestion, 0)
+	if err := r.db.WithContext(ctx).
+		Table("conversation_messages AS q").
+		Select(`q.id AS message_id, q.content AS question, a.retrieved_chunks,
+			COALESCE((a.info->>'score')::int, 0) AS score, COALESCE(a.ungrounded, false) AS ungrounded`).
+		Joins("LEFT JOIN conversation_messages AS a ON a.parent_id = q.id AND a.role = ?", schema.Assistant).
+		Where("q.kb_id = ? AND q.role = ? AND q.created_at >= ?", kbID, schema.User, since).
+		Where("q.content <> ''").
+		Order("q.created_at DESC").
+		Limit(limit).
+		Scan(&questions).Error; err != nil {
+		return nil, err
+	}
+	return questions, nil
+}
@@ -0,0 +1,268 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
+)
+
+type LDAPSyncRepository struct {
+	db     *pg.DB
+	logger *log.Logger
+}
+
+func NewLDAPSyncRepository(db *pg.DB, logger *log.Logger) *LDAPSyncRepository {
+	return &LDAPSyncRepository{
+		db:     db,
+		logger: logger.WithModule("repo.pg.ldap_sync"),
+	}
+}
+
+// GetSettings returns the kb LDAP sync settings, or empty settings when not configured.
+func (r *LDAPSyncRepository) GetSettings(ctx context.Context, kbID string) (*domain.LDAPSyncSettings, error) {
+	var setting domain.Setting
+	err := r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingLDAPSync).
+		First(&setting).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &domain.LDAPSyncSettings{}, nil
+		}
+		return nil, err
+	}
+	var settings domain.LDAPSyncSettings
+	if err := json.Unmarshal(setting.Value, &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (r *LDAPSyncRepository) UpsertSettings(ctx context.Context, kbID string, settings *domain.LDAPSyncSettings) error {
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	var setting domain.Setting
+	err = r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingLDAPSync).
+		First(&setting).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return r.db.WithContext(ctx).Table("settings").Create(&domain.Setting{
+				KBID:  kbID,
+				Key:   domain.SettingLDAPSync,
+				Value: value,
+			}).Error
+		}
+		return err
+	}
+
+	return r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingLDAPSync).
+		Updates(map[string]any{
+			"value":      value,
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// ListEnabledSettings returns the settings of every kb with scheduled sync enabled, keyed by kb id.
+func (r *LDAPSyncRepository) ListEnabledSettings(ctx context.Context) (map[string]*domain.LDAPSyncSettings, error) {
+	var settings []*domain.Setting
+	if err := r.db.WithContext(ctx).Table("settings").
+		Where("key = ?", domain.SettingLDAPSync).
+		Where("value->>'enabled' = 'true'").
+		Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string]*domain.LDAPSyncSettings, len(settings))
+	for _, setting := range settings {
+		var s domain.LDAPSyncSettings
+		if err := json.Unmarshal(setting.Value, &s); err != nil {
+			r.logger.Warn("invalid LDAP sync settings", log.String("kb_id", setting.KBID), log.Error(err))
+			continue
+		}
+		result[setting.KBID] = &s
+	}
+	return result, nil
+}
+
+// ApplyPlan writes the readers and auth groups of a sync in one transaction.
+func (r *LDAPSyncRepository) ApplyPlan(ctx context.Context, kbID string, plan *domain.LDAPSyncPlan) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// serialize with the logins syncing the groups of their reader
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", fmt.Sprintf("auth_groups:%s:%s", kbID, consts.SourceTypeLDAP)).Error; err != nil {
+			return err
+		}
+
+		if len(plan.CreateAuths) > 0 {
+			var count int64
+			if err := tx.Model(&domain.Auth{}).
+				Where("kb_id = ?", kbID).
+				Where("source_type NOT IN (?)", consts.BotSourceTypes).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			maxCount := domain.GetBaseEditionLimitation(ctx).MaxSSOUser
+			if int(count)+len(plan.CreateAuths) > maxCount {
+				return fmt.Errorf("exceed max auth limit for kb %s, current count: %d, to create: %d, max limit: %d", kbID, count, len(plan.CreateAuths), maxCount)
+			}
+			if err := tx.CreateInBatches(plan.CreateAuths, 500).Error; err != nil {
+				return err
+			}
+		}
+		for _, auth := range plan.UpdateAuths {
+			if err := tx.Model(&domain.Auth{}).
+				Where("kb_id = ? AND id = ?", kbID, auth.ID).
+				Updates(map[string]any{
+					"user_info":  auth.UserInfo,
+					"updated_at": time.Now(),
+				}).Error; err != nil {
+				return err
+			}
+		}
+
+		var auths []domain.Auth
+		if err := tx.Model(&domain.Auth{}).
+			Select("id, union_id").
+			Where("kb_id = ? AND source_type = ?", kbID, consts.SourceTypeLDAP).
+			Find(&auths).Error; err != nil {
+			return err
+		}
+		authIDs := make(map[string]int64, len(auths))
+		for _, auth := range auths {
+			authIDs[auth.UnionID] = int64(auth.ID)
+		}
+
+		var maxPosition float64
+		if err := tx.Model(&domain.AuthGroup{}).Where("kb_id = ?", kbID).
+			Select("COALESCE(MAX(position), 0)").Scan(&maxPosition).Error; err != nil {
+			return err
+		}
+		groupIDs := make(map[string]uint, len(plan.Groups))
+		for _, group := range plan.Groups {
+			if group.ID == 0 {
+				maxPosition += 1000
+				created := &domain.AuthGroup{
+					Name:       group.Name,
+					KbID:       kbID,
+					Position:   maxPosition,
+					SyncId:     group.DN,
+					SourceType: consts.SourceTypeLDAP,
+				}
+				if err := tx.Create(created).Error; err != nil {
+					return err
+				}
+				group.ID = created.ID
+			}
+			groupIDs[group.DN] = group.ID
+		}
+
+		for _, group := range plan.Groups {
+			var parentID *uint
+			if id, ok := groupIDs[group.ParentDN]; ok {
+				parentID = &id
+			}
+			members := make([]int64, 0, len(group.MemberUnionIDs))
+			for _, unionID := range group.MemberUnionIDs {
+				if id, ok := authIDs[unionID]; ok {
+					members = append(members, id)
+				}
+			}
+			if err := tx.Model(&domain.AuthGroup{}).
+				Where("kb_id = ? AND id = ?", kbID, group.ID).
+				Updates(map[string]any{
+					"name":           group.Name,
+					"sync_id":        group.DN,
+					"parent_id":      parentID,
+					"sync_parent_id": group.ParentDN,
+					"auth_ids":       pq.Int64Array(members),
+					"updated_at":     time.Now(),
+				}).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(plan.RemoveGroupIDs) > 0 {
+			if err := tx.Where("auth_group_id IN (?)", plan.RemoveGroupIDs).Delete(&domain.NodeAuthGroup{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&domain.AuthGroup{}).
+				Where("kb_id = ? AND parent_id IN (?)", kbID, plan.RemoveGroupIDs).
+				Update("parent_id", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("kb_id = ? AND id IN (?)", kbID, plan.RemoveGroupIDs).Delete(&domain.AuthGroup{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *LDAPSyncRepository) CreateRun(ctx context.Context, run *domain.LDAPSyncRun) error {
+	return r.db.WithContext(ctx).Create(run).Error
+}
+
+func (r *LDAPSyncRepository) UpdateRun(ctx context.Context, run *domain.LDAPSyncRun) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.LDAPSyncRun{}).
+		Where("id = ?", run.ID).
+		Updates(map[string]any{
+			"status":      run.Status,
+			"error":       run.Error,
+			"result":      run.Result,
+			"finished_at": run.FinishedAt,
+		}).Error
+}
+
+func (r *LDAPSyncRepository) ListRuns(ctx context.Context, req *domain.LDAPSyncRunListReq) (int64, []*domain.LDAPSyncRun, error) {
+	query := r.db.WithContext(ctx).
+		Model(&domain.LDAPSyncRun{}).
+		Where("kb_id = ?", req.KBID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return 0, nil, err
+	}
+	var runs []*domain.LDAPSyncRun
+	if err := query.
+		Order("created_at DESC").
+		Offset(req.Offset()).
+		Limit(req.Limit()).
+		Find(&runs).Error; err != nil {
+		return 0, nil, err
+	}
+	return total, runs, nil
+}
+
+// GetLatestRunTimes returns when each kb last started a sync, dry runs aside.
+func (r *LDAPSyncRepository) GetLatestRunTimes(ctx context.Context) (map[string]time.Time, error) {
+	var rows []struct {
+		KBID      string
+		CreatedAt time.Time
+	}
+	if err := r.db.WithContext(ctx).
+		Model(&domain.LDAPSyncRun{}).
+		Select("kb_id, MAX(created_at) AS created_at").
+		Where("dry_run = ?", false).
+		Group("kb_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		result[row.KBID] = row.CreatedAt
+	}
+	return result, nil
+}
@@ -34,12 +34,15 @@ func NewNodeRepository(db *pg.DB, logger *log.Logger) *NodeRepository {
 }
 
 func (r *NodeRepository) Create(ctx context.Context, req *domain.CreateNodeReq, userId string) (string, error) {
-	nodeID, err := uuid.NewV7()
-	if err != nil {
-		return "", err
+	nodeIDStr := req.ID
+	if nodeIDStr == "" {
+		nodeID, err := uuid.NewV7()
+		if err != nil {
+			return "", err
+		}
+		nodeIDStr = nodeID.String()
 	}
-	nodeIDStr := nodeID.String()
-	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var maxPos float64
 		query := tx.WithContext(ctx).
 			Model(&domain.Node{}).
@@ -178,7 +181,11 @@ func (r *NodeRepository) GetNodeReleasePublisherMap(ctx context.Context, kbID st
 	return publisherMap, nil
 }
 
-func (r *NodeRepository) UpdateNodeContent(ctx context.Context, req *domain.UpdateNodeReq, userId string) error {
+// UpdateNodeContent applies an edit and returns the node version after it. A req.Version other than
+// the current one fails with domain.ErrNodeVersionMismatch, every edit that changes the node bumps
+// the version and stores a revision.
+func (r *NodeRepository) UpdateNodeContent(ctx context.Context, req *domain.UpdateNodeReq, userId string) (int64, error) {
+	var version int64
 	// Use transaction to ensure data consistency
 	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Get current node data with row-level lock
@@ -191,6 +198,10 @@ func (r *NodeRepository) UpdateNodeContent(ctx context.Context, req *domain.Upda
 			First(&currentNode).Error; err != nil {
 			return err
 		}
+		version = currentNode.Version
+		if req.Version != nil && *req.Version != currentNode.Version {
+			return domain.ErrNodeVersionMismatch
+		}
 
 		updateMap := make(map[string]any)
 		updateStatus := false
@@ -266,19 +277,103 @@ func (r *NodeRepository) UpdateNodeContent(ctx context.Context, req *domain.Upda
 			updateMap["edit_time"] = time.Now()
 		}
 
+		if updateStatus {
+			version++
+			updateMap["version"] = version
+		}
+
 		// Perform update if there are changes
 		if len(updateMap) > 0 {
 			// Use the transaction's DB instance for the update
-			return tx.Model(&domain.Node{}).
+			var updatedNode domain.Node
+			if err := tx.Model(&updatedNode).
+				Clauses(clause.Returning{}).
 				Where("id = ?", req.ID).
 				Where("kb_id = ?", req.KBID).
-				Updates(updateMap).Error
+				Updates(updateMap).Error; err != nil {
+				return err
+			}
+			if updateStatus {
+				revisions := make([]*domain.NodeRevision, 0, 2)
+				if currentNode.Version == 0 {
+					// nodes start without revisions, keep the original as the base of the first edits
+					revisions = append(revisions, &domain.NodeRevision{
+						KBID:     currentNode.KBID,
+						NodeID:   currentNode.ID,
+						Name:     currentNode.Name,
+						Content:  currentNode.Content,
+						Meta:     currentNode.Meta,
+						EditorID: currentNode.EditorId,
+					})
+				}
+				revisions = append(revisions, &domain.NodeRevision{
+					KBID:     updatedNode.KBID,
+					NodeID:   updatedNode.ID,
+					Version:  version,
+					Name:     updatedNode.Name,
+					Content:  updatedNode.Content,
+					Meta:     updatedNode.Meta,
+					EditorID: userId,
+				})
+				return tx.Create(revisions).Error
+			}
 		}
 		return nil
 	})
 
 	// Return any error from the transaction
-	return err
+	return version, err
+}
+
+// GetNodeRevision returns the node as of version.
+func (r *NodeRepository) GetNodeRevision(ctx context.Context, kbID, nodeID string, version int64) (*domain.NodeRevision, error) {
+	var revision domain.NodeRevision
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ? AND node_id = ? AND version = ?", kbID, nodeID, version).
+		First(&revision).Error; err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// DeleteOldNodeRevisions deletes the superseded revisions created before before, in batches. See
+// NodeRevisionCandidate.Prunable for the revisions that are kept.
+func (r *NodeRepository) DeleteOldNodeRevisions(ctx context.Context, before time.Time) error {
+	const batchSize = 1000
+	var lastID int64
+	for {
+		var candidates []*domain.NodeRevisionCandidate
+		if err := r.db.WithContext(ctx).
+			Table("node_revisions AS r").
+			Select(`r.id, r.node_id, r.version, r.created_at, n.version AS node_version,
+				(SELECT MAX(l.version) FROM node_revisions l WHERE l.node_id = r.node_id) AS latest_version`).
+			Joins("LEFT JOIN nodes n ON n.id = r.node_id").
+			Where("r.created_at < ? AND r.id > ?", before, lastID).
+			Order("r.id ASC").
+			Limit(batchSize).
+			Scan(&candidates).Error; err != nil {
+			return err
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+		lastID = candidates[len(candidates)-1].ID
+
+		ids := make([]int64, 0, len(candidates))
+		for _, c := range candidates {
+			if c.Prunable(before) {
+				ids = append(ids, c.ID)
+			}
+		}
+		if len(ids) > 0 {
+			if err := r.db.WithContext(ctx).Where("id IN ?", ids).Delete(&domain.NodeRevision{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(candidates) < batchSize {
+			return nil
+		}
+	}
 }
 
 func (r *NodeRepository) GetByID(ctx context.Context, id, kbId string) (*v1.NodeDetailResp, error) {
@@ -501,6 +596,20 @@ func (r *NodeRepository) GetNodeReleaseByID(ctx context.Context, id string) (*do
 	return nodeRelease, nil
 }
 
+func (r *NodeRepository) GetNodeReleasesByIDs(ctx context.Context, ids []string) ([]*domain.NodeRelease, error) {
+	var nodeReleases []*domain.NodeRelease
+	if len(ids) == 0 {
+		return nodeReleases, nil
+	}
+	if err := r.db.WithContext(ctx).
+		Model(&domain.NodeRelease{}).
+		Where("id IN ?", ids).
+		Find(&nodeReleases).Error; err != nil {
+		return nil, err
+	}
+	return nodeReleases, nil
+}
+
 func (r *NodeRepository) GetLatestNodeReleaseByNodeID(ctx context.Context, nodeID string) (*domain.NodeRelease, error) {
 	var nodeRelease *domain.NodeRelease
 	if err := r.db.WithContext(ctx).
@@ -809,6 +918,61 @@ func (r *NodeRepository) GetNodeReleasesWithPathsByDocIDs(ctx context.Context, i
 	return result, nil
 }
 
+// nodeReleaseSearchVector must match idx_node_releases_search_vector so the GIN index is used
+const nodeReleaseSearchVector = `setweight(to_tsvector('simple', coalesce(nr.name, '')), 'A') || setweight(to_tsvector('simple', coalesce(nr.content, '')), 'D')`
+
+// SearchNodeReleasesByKeyword runs a full-text keyword search over the node releases of the latest kb release.
+// Query terms are OR-ed and ranked by ts_rank_cd, so exact identifiers like error codes score high.
+// Each hit carries a highlighted excerpt of the content as its chunk.
+func (r *NodeRepository) SearchNodeReleasesByKeyword(ctx context.Context, kbID, query string, groupIDs []int, limit int) ([]*domain.NodeContentChunk, error) {
+	if strings.TrimSpace(query) == "" || limit <= 0 {
+		return nil, nil
+	}
+	sql := `
+		WITH q AS (
+			SELECT to_tsquery('simple', string_agg(quote_literal(lexeme), ' | ')) AS query
+			FROM unnest(to_tsvector('simple', @query))
+			WHERE length(lexeme) > 1
+		), latest AS (
+			SELECT id FROM kb_releases WHERE kb_id = @kb_id ORDER BY created_at DESC LIMIT 1
+		)
+		SELECT
+			nr.id,
+			nr.kb_id,
+			nr.doc_id,
+			nr.name,
+			ts_headline('simple', nr.content, q.query, 'MaxFragments=3, MaxWords=60, MinWords=20, StartSel="", StopSel="", FragmentDelimiter=" ... "') AS content
+		FROM kb_release_node_releases krnr
+		JOIN latest ON latest.id = krnr.release_id
+		JOIN node_releases nr ON nr.id = krnr.node_release_id
+		JOIN nodes n ON n.id = krnr.node_id
+		CROSS JOIN q
+		WHERE nr.doc_id != ''
+			AND (` + nodeReleaseSearchVector + `) @@ q.query
+			AND coalesce(n.permissions->>'answerable', '') != @closed
+			AND (coalesce(n.permissions->>'answerable', '') != @partial OR EXISTS (
+				SELECT 1 FROM node_auth_groups nag
+				WHERE nag.node_id = n.id AND nag.perm = @perm AND nag.auth_group_id = ANY(@group_ids)
+			))
+		ORDER BY ts_rank_cd(` + nodeReleaseSearchVector + `, q.query) DESC
+		LIMIT @limit
+	`
+
+	var chunks []*domain.NodeContentChunk
+	if err := r.db.WithContext(ctx).Raw(sql, map[string]any{
+		"query":     query,
+		"kb_id":     kbID,
+		"closed":    consts.NodeAccessPermClosed,
+		"partial":   consts.NodeAccessPermPartial,
+		"perm":      consts.NodePermNameAnswerable,
+		"group_ids": pq.Array(groupIDs),
+		"limit":     limit,
+	}).Scan(&chunks).Error; err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
 // NodePathInfo contains path information for a node
 type NodePathInfo struct {
 	DocID     string
@@ -1218,6 +1382,67 @@ func (r *NodeRepository) CreateNodeReleases(ctx context.Context, kbID, userId st
 	return releaseIDs, nil
 }
 
+// UnpublishNodes takes released nodes offline: they go back to unreleased so the next kb release
+// leaves them out, and the doc ids of their releases are cleared and returned for vector removal.
+func (r *NodeRepository) UnpublishNodes(ctx context.Context, kbID, userID string, nodeIDs []string) ([]string, error) {
+	docIDs := make([]string, 0)
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var updatedNodes []*domain.Node
+		if err := tx.Model(&updatedNodes).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+			Where("kb_id = ?", kbID).
+			Where("id IN ?", nodeIDs).
+			Where("status != ?", domain.NodeStatusUnreleased).
+			Update("status", domain.NodeStatusUnreleased).Error; err != nil {
+			return err
+		}
+		if len(updatedNodes) == 0 {
+			return nil
+		}
+		updatedIDs := lo.Map(updatedNodes, func(node *domain.Node, _ int) string {
+			return node.ID
+		})
+
+		var nodeReleases []*domain.NodeRelease
+		if err := tx.Model(&nodeReleases).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "doc_id"}}}).
+			Where("node_id IN ?", updatedIDs).
+			Where("doc_id != ''").
+			Omit("updated_at").
+			Update("doc_id", "").Error; err != nil {
+			return err
+		}
+		for _, nodeRelease := range nodeReleases {
+			docIDs = append(docIDs, nodeRelease.DocID)
+		}
+
+		audits := make([]*domain.NodeReleaseAudit, 0, len(updatedIDs))
+		for _, nodeID := range updatedIDs {
+			detail, err := json.Marshal(map[string]any{
+				"node_id":     nodeID,
+				"operator_id": userID,
+				"source": map[string]any{
+					"flow": "UnpublishNodes",
+				},
+			})
+			if err != nil {
+				return err
+			}
+			audits = append(audits, &domain.NodeReleaseAudit{
+				KBID:           kbID,
+				NodeID:         nodeID,
+				Action:         domain.NodeReleaseAuditActionUnpublish,
+				OperatorUserID: userID,
+				Detail:         detail,
+			})
+		}
+		return tx.CreateInBatches(audits, 100).Error
+	}); err != nil {
+		return nil, err
+	}
+	return docIDs, nil
+}
+
 func (r *NodeRepository) GetOldNodeDocIDsByNodeID(ctx context.Context, nodeReleaseID, nodeID string) ([]string, error) {
 	var docIDs []string
 	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
@@ -0,0 +1,222 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
+)
+
+type NodeReviewRepository struct {
+	db     *pg.DB
+	logger *log.Logger
+}
+
+func NewNodeReviewRepository(db *pg.DB, logger *log.Logger) *NodeReviewRepository {
+	return &NodeReviewRepository{
+		db:     db,
+		logger: logger.WithModule("repo.pg.node_review"),
+	}
+}
+
+// GetSettings returns the kb review workflow settings, or disabled settings when not configured.
+func (r *NodeReviewRepository) GetSettings(ctx context.Context, kbID string) (*domain.ReviewWorkflowSettings, error) {
+	var setting domain.Setting
+	err := r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingReviewWorkflow).
+		First(&setting).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &domain.ReviewWorkflowSettings{}, nil
+		}
+		return nil, err
+	}
+	var settings domain.ReviewWorkflowSettings
+	if err := json.Unmarshal(setting.Value, &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (r *NodeReviewRepository) UpsertSettings(ctx context.Context, kbID string, settings *domain.ReviewWorkflowSettings) error {
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	var setting domain.Setting
+	err = r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingReviewWorkflow).
+		First(&setting).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return r.db.WithContext(ctx).Table("settings").Create(&domain.Setting{
+				KBID:  kbID,
+				Key:   domain.SettingReviewWorkflow,
+				Value: value,
+			}).Error
+		}
+		return err
+	}
+
+	return r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingReviewWorkflow).
+		Updates(map[string]any{
+			"value":      value,
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// GetSubtreeNodeIDs returns the given folders and every node below them.
+func (r *NodeReviewRepository) GetSubtreeNodeIDs(ctx context.Context, kbID string, folderIDs []string) ([]string, error) {
+	var ids []string
+	if len(folderIDs) == 0 {
+		return ids, nil
+	}
+	if err := r.db.WithContext(ctx).Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM nodes WHERE kb_id = ? AND id IN ?
+			UNION
+			SELECT n.id FROM nodes n INNER JOIN subtree s ON n.parent_id = s.id WHERE n.kb_id = ?
+		)
+		SELECT id FROM subtree`, kbID, folderIDs, kbID).
+		Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Create stores a new review for a node, replacing any review of the node still pending or
+// approved, and records the submission in the release audit log.
+func (r *NodeReviewRepository) Create(ctx context.Context, review *domain.NodeReview, audit *domain.NodeReleaseAudit) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&domain.NodeReview{}).
+			Where("kb_id = ? AND node_id = ?", review.KBID, review.NodeID).
+			Where("status IN ?", []domain.NodeReviewStatus{domain.NodeReviewStatusPending, domain.NodeReviewStatusApproved}).
+			Updates(map[string]any{
+				"status":      domain.NodeReviewStatusWithdrawn,
+				"updated_at":  now,
+				"finished_at": now,
+			}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(review).Error; err != nil {
+			return err
+		}
+		return tx.Create(audit).Error
+	})
+}
+
+func (r *NodeReviewRepository) Get(ctx context.Context, kbID, id string) (*domain.NodeReviewListItem, error) {
+	var review domain.NodeReviewListItem
+	if err := r.db.WithContext(ctx).
+		Model(&domain.NodeReview{}).
+		Select("node_reviews.*, users.account AS submitter_account").
+		Joins("LEFT JOIN users ON users.id = node_reviews.submitter_id").
+		Where("node_reviews.kb_id = ? AND node_reviews.id = ?", kbID, id).
+		First(&review).Error; err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+func (r *NodeReviewRepository) List(ctx context.Context, req *domain.NodeReviewListReq) (int64, []*domain.NodeReviewListItem, error) {
+	query := r.db.WithContext(ctx).Model(&domain.NodeReview{}).Where("node_reviews.kb_id = ?", req.KBID)
+	if req.NodeID != "" {
+		query = query.Where("node_reviews.node_id = ?", req.NodeID)
+	}
+	if req.Status != "" {
+		query = query.Where("node_reviews.status = ?", req.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return 0, nil, err
+	}
+	var items []*domain.NodeReviewListItem
+	if err := query.
+		Select("node_reviews.*, users.account AS submitter_account").
+		Joins("LEFT JOIN users ON users.id = node_reviews.submitter_id").
+		Order("node_reviews.updated_at DESC").
+		Offset(req.Offset()).
+		Limit(req.Limit()).
+		Find(&items).Error; err != nil {
+		return 0, nil, err
+	}
+	return total, items, nil
+}
+
+// Transition applies updates only while the review is still in status at stage, so two reviewers
+// can't pass the same stage twice. The audit row is written with the change, it reports whether
+// the review changed.
+func (r *NodeReviewRepository) Transition(ctx context.Context, review *domain.NodeReview, updates map[string]any, audit *domain.NodeReleaseAudit) (bool, error) {
+	updated := false
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updates["updated_at"] = time.Now()
+		result := tx.Model(&domain.NodeReview{}).
+			Where("id = ? AND status = ? AND stage = ?", review.ID, review.Status, review.Stage).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		updated = true
+		return tx.Create(audit).Error
+	}); err != nil {
+		return false, err
+	}
+	return updated, nil
+}
+
+// GetApproved returns the approved review of each of the nodes that has one, keyed by node id.
+func (r *NodeReviewRepository) GetApproved(ctx context.Context, kbID string, nodeIDs []string) (map[string]*domain.NodeReview, error) {
+	var reviews []*domain.NodeReview
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ? AND node_id IN ?", kbID, nodeIDs).
+		Where("status = ?", domain.NodeReviewStatusApproved).
+		Find(&reviews).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string]*domain.NodeReview, len(reviews))
+	for _, review := range reviews {
+		result[review.NodeID] = review
+	}
+	return result, nil
+}
+
+// MarkReleased closes the approved reviews of nodes that went out with a kb release.
+func (r *NodeReviewRepository) MarkReleased(ctx context.Context, kbID string, nodeIDs []string, releaseID string) error {
+	now := time.Now()
+	return r.db.WithContext(ctx).
+		Model(&domain.NodeReview{}).
+		Where("kb_id = ? AND node_id IN ?", kbID, nodeIDs).
+		Where("status = ?", domain.NodeReviewStatusApproved).
+		Updates(map[string]any{
+			"status":      domain.NodeReviewStatusReleased,
+			"release_id":  releaseID,
+			"updated_at":  now,
+			"finished_at": now,
+		}).Error
+}
+
+// ListAudits returns the release audit entries written for a review, oldest first.
+func (r *NodeReviewRepository) ListAudits(ctx context.Context, kbID, reviewID string) ([]*domain.NodeReleaseAudit, error) {
+	var audits []*domain.NodeReleaseAudit
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ?", kbID).
+		Where("detail->>'review_id' = ?", reviewID).
+		Order("created_at ASC, id ASC").
+		Find(&audits).Error; err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
@@ -20,6 +20,7 @@ var ProviderSet = wire.NewSet(
 	NewCommentRepository,
 	NewPromptRepo,
 	NewBlockWordRepo,
+	NewRetrievalSettingRepo,
 	NewAuthRepo,
 	NewWechatRepository,
 	NewAPITokenRepo,
@@ -27,4 +28,14 @@ var ProviderSet = wire.NewSet(
 	NewSystemSettingRepo,
 	NewMCPRepository,
 	NewNavRepository,
+	NewWebhookRepository,
+	NewGitSyncRepository,
+	NewKBArchiveRepository,
+	NewReleaseScheduleRepository,
+	NewNodeReviewRepository,
+	NewRAGEvalRepository,
+	NewAnswerCacheRepo,
+	NewKnowledgeGapRepository,
+	NewHandoffRepository,
+	NewLDAPSyncRepository,
 )
@@ -0,0 +1,204 @@
+package pg
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
+)
+
+type RAGEvalRepository struct {
+	db     *pg.DB
+	logger *log.Logger
+}
+
+func NewRAGEvalRepository(db *pg.DB, logger *log.Logger) *RAGEvalRepository {
+	return &RAGEvalRepository{
+		db:     db,
+		logger: logger.WithModule("repo.pg.rag_eval"),
+	}
+}
+
+func (r *RAGEvalRepository) CreateDataset(ctx context.Context, dataset *domain.RAGEvalDataset) error {
+	return r.db.WithContext(ctx).Create(dataset).Error
+}
+
+func (r *RAGEvalRepository) GetDataset(ctx context.Context, kbID, id string) (*domain.RAGEvalDataset, error) {
+	var dataset domain.RAGEvalDataset
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ? AND id = ?", kbID, id).
+		First(&dataset).Error; err != nil {
+		return nil, err
+	}
+	return &dataset, nil
+}
+
+func (r *RAGEvalRepository) UpdateDataset(ctx context.Context, kbID, id string, updates map[string]any) error {
+	updates["updated_at"] = time.Now()
+	result := r.db.WithContext(ctx).
+		Model(&domain.RAGEvalDataset{}).
+		Where("kb_id = ? AND id = ?", kbID, id).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *RAGEvalRepository) ListDatasets(ctx context.Context, kbID string) ([]*domain.RAGEvalDatasetListItem, error) {
+	items := make([]*domain.RAGEvalDatasetListItem, 0)
+	if err := r.db.WithContext(ctx).
+		Model(&domain.RAGEvalDataset{}).
+		Select("rag_eval_datasets.*, (SELECT COUNT(*) FROM rag_eval_cases WHERE rag_eval_cases.dataset_id = rag_eval_datasets.id) AS case_count").
+		Where("rag_eval_datasets.kb_id = ?", kbID).
+		Order("rag_eval_datasets.created_at DESC").
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// DeleteDataset removes the dataset with its cases and runs.
+func (r *RAGEvalRepository) DeleteDataset(ctx context.Context, kbID, id string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("kb_id = ? AND id = ?", kbID, id).Delete(&domain.RAGEvalDataset{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Where("dataset_id = ?", id).Delete(&domain.RAGEvalCase{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("run_id IN (?)", tx.Model(&domain.RAGEvalRun{}).Select("id").Where("dataset_id = ?", id)).
+			Delete(&domain.RAGEvalResult{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("dataset_id = ?", id).Delete(&domain.RAGEvalRun{}).Error
+	})
+}
+
+func (r *RAGEvalRepository) CreateCases(ctx context.Context, cases []*domain.RAGEvalCase) error {
+	return r.db.WithContext(ctx).CreateInBatches(cases, 100).Error
+}
+
+func (r *RAGEvalRepository) GetCase(ctx context.Context, kbID, id string) (*domain.RAGEvalCase, error) {
+	var evalCase domain.RAGEvalCase
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ? AND id = ?", kbID, id).
+		First(&evalCase).Error; err != nil {
+		return nil, err
+	}
+	return &evalCase, nil
+}
+
+func (r *RAGEvalRepository) UpdateCase(ctx context.Context, evalCase *domain.RAGEvalCase) error {
+	return r.db.WithContext(ctx).
+		Model(evalCase).
+		Select("question", "expected_answer", "expected_node_ids", "updated_at").
+		Updates(evalCase).Error
+}
+
+func (r *RAGEvalRepository) DeleteCase(ctx context.Context, kbID, id string) error {
+	result := r.db.WithContext(ctx).Where("kb_id = ? AND id = ?", kbID, id).Delete(&domain.RAGEvalCase{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *RAGEvalRepository) ListCases(ctx context.Context, datasetID string) ([]*domain.RAGEvalCase, error) {
+	cases := make([]*domain.RAGEvalCase, 0)
+	if err := r.db.WithContext(ctx).
+		Where("dataset_id = ?", datasetID).
+		Order("created_at ASC, id ASC").
+		Find(&cases).Error; err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+func (r *RAGEvalRepository) CreateRun(ctx context.Context, run *domain.RAGEvalRun) error {
+	return r.db.WithContext(ctx).Create(run).Error
+}
+
+// GetRun looks a run up by id alone when kbID is empty, as the consumer does.
+func (r *RAGEvalRepository) GetRun(ctx context.Context, kbID, id string) (*domain.RAGEvalRun, error) {
+	var run domain.RAGEvalRun
+	query := r.db.WithContext(ctx).Where("id = ?", id)
+	if kbID != "" {
+		query = query.Where("kb_id = ?", kbID)
+	}
+	if err := query.First(&run).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// UpdateRunIfStatus applies updates only while the run is still in status, it reports whether the
+// row changed so a redelivered task can't run twice.
+func (r *RAGEvalRepository) UpdateRunIfStatus(ctx context.Context, id string, status domain.RAGEvalRunStatus, updates map[string]any) (bool, error) {
+	updates["updated_at"] = time.Now()
+	result := r.db.WithContext(ctx).
+		Model(&domain.RAGEvalRun{}).
+		Where("id = ? AND status = ?", id, status).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *RAGEvalRepository) UpdateRun(ctx context.Context, id string, updates map[string]any) error {
+	updates["updated_at"] = time.Now()
+	return r.db.WithContext(ctx).
+		Model(&domain.RAGEvalRun{}).
+		Where("id = ?", id).
+		Updates(updates).Error
+}
+
+func (r *RAGEvalRepository) ListRuns(ctx context.Context, kbID, datasetID string, offset, limit int) (int64, []*domain.RAGEvalRun, error) {
+	query := r.db.WithContext(ctx).Model(&domain.RAGEvalRun{}).Where("kb_id = ?", kbID)
+	if datasetID != "" {
+		query = query.Where("dataset_id = ?", datasetID)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return 0, nil, err
+	}
+	runs := make([]*domain.RAGEvalRun, 0)
+	if err := query.
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&runs).Error; err != nil {
+		return 0, nil, err
+	}
+	return total, runs, nil
+}
+
+func (r *RAGEvalRepository) CreateResult(ctx context.Context, result *domain.RAGEvalResult) error {
+	return r.db.WithContext(ctx).Create(result).Error
+}
+
+func (r *RAGEvalRepository) ListResults(ctx context.Context, runID string) ([]*domain.RAGEvalResult, error) {
+	results := make([]*domain.RAGEvalResult, 0)
+	if err := r.db.WithContext(ctx).
+		Where("run_id = ?", runID).
+		Order("id ASC").
+		Find(&results).Error; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,123 @@
+package pg
+
+import (
+	"context"
+	"time"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
+)
+
+type ReleaseScheduleRepository struct {
+	db     *pg.DB
+	logger *log.Logger
+}
+
+func NewReleaseScheduleRepository(db *pg.DB, logger *log.Logger) *ReleaseScheduleRepository {
+	return &ReleaseScheduleRepository{
+		db:     db,
+		logger: logger.WithModule("repo.pg.release_schedule"),
+	}
+}
+
+func (r *ReleaseScheduleRepository) Create(ctx context.Context, schedule *domain.ReleaseSchedule) error {
+	return r.db.WithContext(ctx).Create(schedule).Error
+}
+
+func (r *ReleaseScheduleRepository) Get(ctx context.Context, kbID, id string) (*domain.ReleaseSchedule, error) {
+	var schedule domain.ReleaseSchedule
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ? AND id = ?", kbID, id).
+		First(&schedule).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// List returns the kb schedules by publish time. Unless all is set only the ones still waiting
+// for publish_at or unpublish_at are included.
+func (r *ReleaseScheduleRepository) List(ctx context.Context, kbID string, all bool, offset, limit int) (int64, []*domain.ReleaseScheduleListItem, error) {
+	query := r.db.WithContext(ctx).Model(&domain.ReleaseSchedule{}).Where("release_schedules.kb_id = ?", kbID)
+	if !all {
+		query = query.Where("release_schedules.status IN ? OR (release_schedules.status = ? AND release_schedules.unpublish_at IS NOT NULL)",
+			[]domain.ReleaseScheduleStatus{domain.ReleaseScheduleStatusPending, domain.ReleaseScheduleStatusRunning},
+			domain.ReleaseScheduleStatusPublished)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return 0, nil, err
+	}
+	var items []*domain.ReleaseScheduleListItem
+	if err := query.
+		Select("release_schedules.*, users.account AS creator_account").
+		Joins("LEFT JOIN users ON users.id = release_schedules.creator_id").
+		Order("release_schedules.publish_at ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&items).Error; err != nil {
+		return 0, nil, err
+	}
+	return total, items, nil
+}
+
+// ListDue returns pending schedules past publish_at, published ones past unpublish_at and running
+// ones whose claim is older than domain.ReleaseScheduleLease, their consumer is gone.
+func (r *ReleaseScheduleRepository) ListDue(ctx context.Context, now time.Time) ([]*domain.ReleaseSchedule, error) {
+	var schedules []*domain.ReleaseSchedule
+	if err := r.db.WithContext(ctx).
+		Where("(status = ? AND publish_at <= ?) OR (status = ? AND unpublish_at <= ?) OR (status = ? AND updated_at <= ?)",
+			domain.ReleaseScheduleStatusPending, now,
+			domain.ReleaseScheduleStatusPublished, now,
+			domain.ReleaseScheduleStatusRunning, now.Add(-domain.ReleaseScheduleLease)).
+		Order("publish_at ASC").
+		Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// Claim marks a due schedule as running, it only succeeds while the row is unchanged since it was
+// listed, so a stale running schedule is reclaimed by one consumer only. updated_at holds the time
+// of the claim, it is returned for UpdateIfClaimed.
+func (r *ReleaseScheduleRepository) Claim(ctx context.Context, schedule *domain.ReleaseSchedule) (time.Time, bool, error) {
+	// postgres keeps microseconds, the claim has to compare equal when read back
+	claimedAt := time.Now().Truncate(time.Microsecond)
+	result := r.db.WithContext(ctx).
+		Model(&domain.ReleaseSchedule{}).
+		Where("id = ? AND status = ? AND updated_at = ?", schedule.ID, schedule.Status, schedule.UpdatedAt).
+		Updates(map[string]any{"status": domain.ReleaseScheduleStatusRunning, "updated_at": claimedAt})
+	if result.Error != nil {
+		return time.Time{}, false, result.Error
+	}
+	return claimedAt, result.RowsAffected > 0, nil
+}
+
+// UpdateIfClaimed records the outcome of a claimed schedule, unless the claim expired and another
+// consumer took the schedule over meanwhile.
+func (r *ReleaseScheduleRepository) UpdateIfClaimed(ctx context.Context, id string, claimedAt time.Time, updates map[string]any) (bool, error) {
+	updates["updated_at"] = time.Now()
+	result := r.db.WithContext(ctx).
+		Model(&domain.ReleaseSchedule{}).
+		Where("id = ? AND status = ? AND updated_at = ?", id, domain.ReleaseScheduleStatusRunning, claimedAt).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateIfStatus applies updates only while the schedule is still in status, it reports whether
+// the row changed. It is how users edit a schedule without racing the cron.
+func (r *ReleaseScheduleRepository) UpdateIfStatus(ctx context.Context, id string, status domain.ReleaseScheduleStatus, updates map[string]any) (bool, error) {
+	updates["updated_at"] = time.Now()
+	result := r.db.WithContext(ctx).
+		Model(&domain.ReleaseSchedule{}).
+		Where("id = ? AND status = ?", id, status).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,74 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
+)
+
+type RetrievalSettingRepo struct {
+	db     *pg.DB
+	logger *log.Logger
+}
+
+func NewRetrievalSettingRepo(db *pg.DB, logger *log.Logger) *RetrievalSettingRepo {
+	return &RetrievalSettingRepo{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// GetRetrievalSettings returns the kb retrieval settings, or defaults when not configured.
+func (r *RetrievalSettingRepo) GetRetrievalSettings(ctx context.Context, kbID string) (*domain.RetrievalSettings, error) {
+	var setting domain.Setting
+	err := r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingRetrieval).
+		First(&setting).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.DefaultRetrievalSettings(), nil
+		}
+		return nil, err
+	}
+	settings := domain.DefaultRetrievalSettings()
+	if err := json.Unmarshal(setting.Value, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (r *RetrievalSettingRepo) UpsertRetrievalSettings(ctx context.Context, kbID string, settings *domain.RetrievalSettings) error {
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	var setting domain.Setting
+	err = r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingRetrieval).
+		First(&setting).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return r.db.WithContext(ctx).Table("settings").Create(&domain.Setting{
+				KBID:  kbID,
+				Key:   domain.SettingRetrieval,
+				Value: value,
+			}).Error
+		}
+		return err
+	}
+
+	return r.db.WithContext(ctx).Table("settings").
+		Where("kb_id = ? AND key = ?", kbID, domain.SettingRetrieval).
+		Updates(map[string]any{
+			"value":      value,
+			"updated_at": time.Now(),
+		}).Error
+}
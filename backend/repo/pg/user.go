@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/google/uuid"
 	"github.com/samber/lo"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -102,6 +103,7 @@ func (r *UserRepository) ListUsers(ctx context.Context) ([]v1.UserListItemResp,
 	var users []v1.UserListItemResp
 	err := r.db.WithContext(ctx).
 		Model(&domain.User{}).
+		Select("users.*, (users.totp_enabled OR EXISTS (SELECT 1 FROM user_webauthn_credentials c WHERE c.user_id = users.id)) AS two_factor_enabled").
 		Order("created_at DESC").
 		Find(&users).Error
 	if err != nil {
@@ -160,5 +162,75 @@ func (r *UserRepository) DeleteUser(ctx context.Context, userID string) error {
 	if err := r.db.WithContext(ctx).Model(&domain.KBUsers{}).Where("user_id = ?", userID).Delete(&domain.KBUsers{}).Error; err != nil {
 		return err
 	}
+
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&domain.UserWebAuthnCredential{}).Error; err != nil {
+		return err
+	}
 	return nil
 }
+
+// UpsertSSOUser creates the user of an IdP identity on its first login and replaces its role
+// and kb permissions with the ones mapped from the groups of the IdP on every login. A local
+// or other IdP user of the same account is never taken over.
+func (r *UserRepository) UpsertSSOUser(ctx context.Context, user *domain.User, kbPerms map[string]consts.UserKBPermission) (*domain.User, error) {
+	var result domain.User
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("source_type = ? AND union_id = ?", user.SourceType, user.UnionID).First(&result).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			var count int64
+			if err := tx.Model(&domain.User{}).Where("account = ?", user.Account).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("account %s already exists", user.Account)
+			}
+			if err := tx.Model(&domain.User{}).Count(&count).Error; err != nil {
+				return err
+			}
+			if count >= domain.GetBaseEditionLimitation(ctx).MaxAdmin {
+				return fmt.Errorf("exceed max admin limit, current count: %d, max limit: %d", count, domain.GetBaseEditionLimitation(ctx).MaxAdmin)
+			}
+			// the password is never told to anyone, SSO users can not log in with it
+			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(uuid.New().String()), bcrypt.DefaultCost)
+			if err != nil {
+				return fmt.Errorf("failed to hash password: %w", err)
+			}
+			user.Password = string(hashedPassword)
+			if err := tx.Create(user).Error; err != nil {
+				return err
+			}
+			result = *user
+		case err != nil:
+			return err
+		default:
+			if err := tx.Model(&result).Update("role", user.Role).Error; err != nil {
+				return err
+			}
+			result.Role = user.Role
+		}
+
+		if err := tx.Where("user_id = ?", result.ID).Delete(&domain.KBUsers{}).Error; err != nil {
+			return err
+		}
+		if len(kbPerms) == 0 {
+			return nil
+		}
+		// the kb of a stale mapping may have been deleted
+		var kbIDs []string
+		if err := tx.Model(&domain.KnowledgeBase{}).Where("id IN ?", lo.Keys(kbPerms)).Pluck("id", &kbIDs).Error; err != nil {
+			return err
+		}
+		if len(kbIDs) == 0 {
+			return nil
+		}
+		kbUsers := lo.Map(kbIDs, func(kbID string, _ int) domain.KBUsers {
+			return domain.KBUsers{KBId: kbID, UserId: result.ID, Perm: kbPerms[kbID]}
+		})
+		return tx.Create(&kbUsers).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -1,6 +1,8 @@
 package pg
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -13,10 +15,20 @@ import (
 	"github.com/chaitin/panda-wiki/store/pg"
 )
 
+// adminSSOCacheTTL is how long the admin SSO setting and the SSO users checked on every
+// request are cached.
+const adminSSOCacheTTL = 10 * time.Second
+
 type UserAccessRepository struct {
 	db        *pg.DB
 	logger    *log.Logger
 	accessMap sync.Map
+
+	adminSSOMutex    sync.Mutex
+	adminSSO         domain.AdminSSOSetting
+	adminSSOLoadedAt time.Time
+	// ssoUsers holds the time the SSO users were last found valid
+	ssoUsers sync.Map
 }
 
 func NewUserAccessRepository(db *pg.DB, logger *log.Logger) *UserAccessRepository {
@@ -149,3 +161,72 @@ func (r *UserAccessRepository) ValidateKBPerm(kbId, userId string, perm consts.U
 
 	return false, nil
 }
+
+// ValidatePasswordLogin reports whether the admin SSO setting allows the user to use a token
+// of a local password login. The built-in admin account is always allowed.
+func (r *UserAccessRepository) ValidatePasswordLogin(userID string) (bool, error) {
+	setting, err := r.getAdminSSOSetting()
+	if err != nil {
+		return false, err
+	}
+	if !setting.Enabled || !setting.DisablePasswordLogin {
+		return true, nil
+	}
+
+	var user domain.User
+	if err := r.db.Model(&domain.User{}).Where("id = ?", userID).First(&user).Error; err != nil {
+		return false, fmt.Errorf("get user failed %s", err)
+	}
+	return user.Account == domain.DefaultAdminAccount && user.SourceType == "", nil
+}
+
+// ValidateSSOLogin reports whether the token of an admin SSO login with the IdP of source is
+// still good: the user has not been deleted and the IdP is still the enabled one.
+func (r *UserAccessRepository) ValidateSSOLogin(userID string, source consts.SourceType) (bool, error) {
+	setting, err := r.getAdminSSOSetting()
+	if err != nil {
+		return false, err
+	}
+	if !setting.Enabled || setting.SourceType != source {
+		return false, nil
+	}
+
+	if value, ok := r.ssoUsers.Load(userID); ok && time.Since(value.(time.Time)) < adminSSOCacheTTL {
+		return true, nil
+	}
+	var count int64
+	if err := r.db.Model(&domain.User{}).Where("id = ? AND source_type = ?", userID, source).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("get user failed %s", err)
+	}
+	if count == 0 {
+		r.ssoUsers.Delete(userID)
+		return false, nil
+	}
+	r.ssoUsers.Store(userID, time.Now())
+	return true, nil
+}
+
+func (r *UserAccessRepository) getAdminSSOSetting() (domain.AdminSSOSetting, error) {
+	r.adminSSOMutex.Lock()
+	defer r.adminSSOMutex.Unlock()
+
+	if time.Since(r.adminSSOLoadedAt) < adminSSOCacheTTL {
+		return r.adminSSO, nil
+	}
+
+	var setting domain.AdminSSOSetting
+	var systemSetting domain.SystemSetting
+	err := r.db.Where("key = ?", consts.SystemSettingAdminSSO).First(&systemSetting).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	case err != nil:
+		return setting, fmt.Errorf("get admin sso setting failed %s", err)
+	default:
+		if err := json.Unmarshal(systemSetting.Value, &setting); err != nil {
+			return setting, fmt.Errorf("unmarshal admin sso setting failed %s", err)
+		}
+	}
+	r.adminSSO = setting
+	r.adminSSOLoadedAt = time.Now()
+	return setting, nil
+}
@@ -0,0 +1,132 @@
+package pg
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/domain"
+)
+
+// EnableTOTP saves the verified secret of the user, recoveryCodes replace the saved ones
+// unless nil.
+func (r *UserRepository) EnableTOTP(ctx context.Context, userID, secret string, recoveryCodes []string) error {
+	updates := map[string]any{
+		"totp_secret":  secret,
+		"totp_enabled": true,
+	}
+	if recoveryCodes != nil {
+		updates["recovery_codes"] = pq.StringArray(recoveryCodes)
+	}
+	return r.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", userID).Updates(updates).Error
+}
+
+func (r *UserRepository) DisableTOTP(ctx context.Context, userID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.User{}).Where("id = ?", userID).Updates(map[string]any{
+			"totp_secret":  "",
+			"totp_enabled": false,
+		}).Error; err != nil {
+			return err
+		}
+		return clearUnusedRecoveryCodes(tx, userID)
+	})
+}
+
+func (r *UserRepository) UpdateRecoveryCodes(ctx context.Context, userID string, recoveryCodes []string) error {
+	return r.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", userID).
+		Update("recovery_codes", pq.StringArray(recoveryCodes)).Error
+}
+
+// UseRecoveryCode removes the hash of a recovery code and reports whether it was unused, so
+// concurrent logins can not use the same code twice.
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, userID, hash string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&domain.User{}).
+		Where("id = ? AND ? = ANY(recovery_codes)", userID, hash).
+		Update("recovery_codes", gorm.Expr("array_remove(recovery_codes, ?)", hash))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *UserRepository) ListWebAuthnCredentials(ctx context.Context, userID string) ([]*domain.UserWebAuthnCredential, error) {
+	var credentials []*domain.UserWebAuthnCredential
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// CreateWebAuthnCredential saves a registered credential, recoveryCodes replace the saved
+// ones unless nil.
+func (r *UserRepository) CreateWebAuthnCredential(ctx context.Context, credential *domain.UserWebAuthnCredential, recoveryCodes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(credential).Error; err != nil {
+			return err
+		}
+		if recoveryCodes == nil {
+			return nil
+		}
+		return tx.Model(&domain.User{}).Where("id = ?", credential.UserID).
+			Update("recovery_codes", pq.StringArray(recoveryCodes)).Error
+	})
+}
+
+// UpdateWebAuthnCredentialUsage records a login with the credential. The update is refused
+// when another login raced it to the same sign count, authenticators without a counter
+// always report zero.
+func (r *UserRepository) UpdateWebAuthnCredentialUsage(ctx context.Context, id string, signCount uint32) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&domain.UserWebAuthnCredential{}).
+		Where("id = ? AND (sign_count < ? OR ? = 0)", id, signCount, signCount).
+		Updates(map[string]any{
+			"sign_count":   signCount,
+			"last_used_at": time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *UserRepository) DeleteWebAuthnCredential(ctx context.Context, userID, id string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&domain.UserWebAuthnCredential{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return clearUnusedRecoveryCodes(tx, userID)
+	})
+}
+
+// ResetTwoFactor removes every second factor of the user, for admins to recover users who
+// lost them.
+func (r *UserRepository) ResetTwoFactor(ctx context.Context, userID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&domain.UserWebAuthnCredential{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&domain.User{}).Where("id = ?", userID).Updates(map[string]any{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"recovery_codes": pq.StringArray{},
+		}).Error
+	})
+}
+
+// clearUnusedRecoveryCodes drops the recovery codes of a user left without a second factor,
+// they would otherwise come back to life with the next factor enrolled.
+func clearUnusedRecoveryCodes(tx *gorm.DB, userID string) error {
+	return tx.Model(&domain.User{}).
+		Where("id = ? AND NOT totp_enabled", userID).
+		Where("NOT EXISTS (SELECT 1 FROM user_webauthn_credentials c WHERE c.user_id = users.id)").
+		Update("recovery_codes", pq.StringArray{}).Error
+}
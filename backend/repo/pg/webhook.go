@@ -0,0 +1,143 @@
+package pg
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
+)
+
+type WebhookRepository struct {
+	db     *pg.DB
+	logger *log.Logger
+}
+
+func NewWebhookRepository(db *pg.DB, logger *log.Logger) *WebhookRepository {
+	return &WebhookRepository{
+		db:     db,
+		logger: logger.WithModule("repo.pg.webhook"),
+	}
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, webhook *domain.Webhook) error {
+	return r.db.WithContext(ctx).Create(webhook).Error
+}
+
+func (r *WebhookRepository) GetByID(ctx context.Context, kbID, id string) (*domain.Webhook, error) {
+	var webhook domain.Webhook
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ? AND id = ?", kbID, id).
+		First(&webhook).Error; err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *WebhookRepository) List(ctx context.Context, kbID string) ([]*domain.Webhook, error) {
+	var webhooks []*domain.Webhook
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ?", kbID).
+		Order("created_at ASC").
+		Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// ListSubscribed returns the enabled webhooks of kbID whose event filter contains event.
+func (r *WebhookRepository) ListSubscribed(ctx context.Context, kbID string, event domain.WebhookEventType) ([]*domain.Webhook, error) {
+	var webhooks []*domain.Webhook
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ? AND enabled = ? AND events @> ?", kbID, true, pq.StringArray{string(event)}).
+		Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (r *WebhookRepository) Update(ctx context.Context, kbID, id string, updates map[string]any) error {
+	updates["updated_at"] = time.Now()
+	return r.db.WithContext(ctx).
+		Model(&domain.Webhook{}).
+		Where("kb_id = ? AND id = ?", kbID, id).
+		Updates(updates).Error
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, kbID, id string) error {
+	return r.db.WithContext(ctx).
+		Where("kb_id = ? AND id = ?", kbID, id).
+		Delete(&domain.Webhook{}).Error
+}
+
+func (r *WebhookRepository) CreateDeliveries(ctx context.Context, deliveries []*domain.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(&deliveries).Error
+}
+
+func (r *WebhookRepository) GetDeliveryByID(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	var delivery domain.WebhookDelivery
+	if err := r.db.WithContext(ctx).
+		Where("id = ?", id).
+		First(&delivery).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (r *WebhookRepository) GetDeliveryByKBID(ctx context.Context, kbID, id string) (*domain.WebhookDelivery, error) {
+	var delivery domain.WebhookDelivery
+	if err := r.db.WithContext(ctx).
+		Where("kb_id = ? AND id = ?", kbID, id).
+		First(&delivery).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (r *WebhookRepository) UpdateDelivery(ctx context.Context, id string, updates map[string]any) error {
+	updates["updated_at"] = time.Now()
+	return r.db.WithContext(ctx).
+		Model(&domain.WebhookDelivery{}).
+		Where("id = ?", id).
+		Updates(updates).Error
+}
+
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, req *domain.WebhookDeliveryListReq) (int64, []*domain.WebhookDelivery, error) {
+	query := r.db.WithContext(ctx).
+		Model(&domain.WebhookDelivery{}).
+		Where("kb_id = ?", req.KBID)
+	if req.WebhookID != "" {
+		query = query.Where("webhook_id = ?", req.WebhookID)
+	}
+	if req.Status != "" {
+		query = query.Where("status = ?", req.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return 0, nil, err
+	}
+	var deliveries []*domain.WebhookDelivery
+	if err := query.
+		Order("created_at DESC").
+		Offset(req.Offset()).
+		Limit(req.Limit()).
+		Find(&deliveries).Error; err != nil {
+		return 0, nil, err
+	}
+	return total, deliveries, nil
+}
+
+// DeleteDeliveriesBefore removes delivery logs older than t.
+func (r *WebhookRepository) DeleteDeliveriesBefore(ctx context.Context, t time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("created_at < ?", t).
+		Delete(&domain.WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_node_releases_search_vector;
@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS idx_node_releases_search_vector
+ON node_releases USING GIN (
+    (setweight(to_tsvector('simple', coalesce(name, '')), 'A') || setweight(to_tsvector('simple', coalesce(content, '')), 'D'))
+);
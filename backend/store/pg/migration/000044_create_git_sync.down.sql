@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS git_sync_runs;
+DROP TABLE IF EXISTS git_sync_nodes;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS git_sync_nodes (
+    kb_id TEXT NOT NULL,
+    path TEXT NOT NULL,
+    node_id TEXT NOT NULL,
+    hash TEXT NOT NULL DEFAULT '',
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (kb_id, path)
+);
+
+CREATE TABLE IF NOT EXISTS git_sync_runs (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    direction TEXT NOT NULL,
+    trigger TEXT NOT NULL,
+    release_id TEXT NOT NULL DEFAULT '',
+    commit TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    result JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_git_sync_runs_kb_id_created_at ON git_sync_runs(kb_id, created_at DESC);
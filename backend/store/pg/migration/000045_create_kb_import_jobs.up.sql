@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS kb_import_jobs (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    mode TEXT NOT NULL,
+    archive_key TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    stage TEXT NOT NULL DEFAULT '',
+    progress INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    result JSONB NOT NULL DEFAULT '{}'::jsonb,
+    creator_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_kb_import_jobs_kb_id_created_at ON kb_import_jobs(kb_id, created_at DESC);
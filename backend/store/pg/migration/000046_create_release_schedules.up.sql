@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS release_schedules (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    node_ids TEXT[] NOT NULL DEFAULT '{}',
+    publish_at timestamptz NOT NULL,
+    unpublish_at timestamptz,
+    status TEXT NOT NULL,
+    release_id TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    creator_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    published_at timestamptz,
+    unpublished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_release_schedules_kb_id_publish_at ON release_schedules(kb_id, publish_at);
+CREATE INDEX IF NOT EXISTS idx_release_schedules_status_publish_at ON release_schedules(status, publish_at);
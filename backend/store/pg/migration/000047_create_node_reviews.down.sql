@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_node_release_audits_review_id;
+DROP TABLE IF EXISTS node_reviews;
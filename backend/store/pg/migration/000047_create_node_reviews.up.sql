@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS node_reviews (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    node_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    stage INT NOT NULL DEFAULT 0,
+    stage_count INT NOT NULL DEFAULT 1,
+    name TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    meta JSONB NOT NULL DEFAULT '{}'::jsonb,
+    digest TEXT NOT NULL,
+    base_release_id TEXT NOT NULL DEFAULT '',
+    submitter_id TEXT NOT NULL DEFAULT '',
+    comment TEXT NOT NULL DEFAULT '',
+    release_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_reviews_kb_id_updated_at ON node_reviews(kb_id, updated_at DESC);
+CREATE INDEX IF NOT EXISTS idx_node_reviews_kb_id_node_id_status ON node_reviews(kb_id, node_id, status);
+CREATE INDEX IF NOT EXISTS idx_node_release_audits_review_id ON node_release_audits((detail->>'review_id'));
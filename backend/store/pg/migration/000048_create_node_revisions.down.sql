@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS node_revisions;
+ALTER TABLE nodes DROP COLUMN IF EXISTS version;
@@ -0,0 +1,16 @@
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS node_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    node_id TEXT NOT NULL,
+    version BIGINT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    meta JSONB NOT NULL DEFAULT '{}'::jsonb,
+    editor_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_node_revisions_node_id_version ON node_revisions(node_id, version);
+CREATE INDEX IF NOT EXISTS idx_node_revisions_created_at ON node_revisions(created_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS rag_eval_results;
+DROP TABLE IF EXISTS rag_eval_runs;
+DROP TABLE IF EXISTS rag_eval_cases;
+DROP TABLE IF EXISTS rag_eval_datasets;
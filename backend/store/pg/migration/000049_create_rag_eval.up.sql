@@ -0,0 +1,67 @@
+CREATE TABLE IF NOT EXISTS rag_eval_datasets (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    creator_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rag_eval_datasets_kb_id ON rag_eval_datasets(kb_id);
+
+CREATE TABLE IF NOT EXISTS rag_eval_cases (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    dataset_id TEXT NOT NULL,
+    question TEXT NOT NULL,
+    expected_answer TEXT NOT NULL DEFAULT '',
+    expected_node_ids TEXT[] NOT NULL DEFAULT '{}',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rag_eval_cases_dataset_id ON rag_eval_cases(dataset_id, created_at);
+
+CREATE TABLE IF NOT EXISTS rag_eval_runs (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    dataset_id TEXT NOT NULL,
+    prompt_version INT NOT NULL DEFAULT 0,
+    prompt TEXT NOT NULL DEFAULT '',
+    model_id TEXT NOT NULL DEFAULT '',
+    model_name TEXT NOT NULL DEFAULT '',
+    scorer TEXT NOT NULL,
+    top_k INT NOT NULL,
+    status TEXT NOT NULL,
+    progress INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    metrics JSONB NOT NULL DEFAULT '{}'::jsonb,
+    creator_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_rag_eval_runs_kb_id_created_at ON rag_eval_runs(kb_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_rag_eval_runs_dataset_id_created_at ON rag_eval_runs(dataset_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS rag_eval_results (
+    id BIGSERIAL PRIMARY KEY,
+    run_id TEXT NOT NULL,
+    case_id TEXT NOT NULL,
+    question TEXT NOT NULL,
+    expected_answer TEXT NOT NULL DEFAULT '',
+    expected_node_ids TEXT[] NOT NULL DEFAULT '{}',
+    answer TEXT NOT NULL DEFAULT '',
+    retrieved_node_ids TEXT[] NOT NULL DEFAULT '{}',
+    recall DOUBLE PRECISION,
+    answer_score DOUBLE PRECISION,
+    judge_reason TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    total_tokens INT NOT NULL DEFAULT 0,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rag_eval_results_run_id ON rag_eval_results(run_id);
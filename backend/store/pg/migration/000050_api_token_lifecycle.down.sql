@@ -0,0 +1,16 @@
+-- only the hashes of the tokens are stored, the raw values can not be restored and every
+-- token has to be created again
+DELETE FROM api_tokens;
+
+ALTER TABLE api_tokens DROP COLUMN IF EXISTS monthly_token_quota;
+ALTER TABLE api_tokens DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE api_tokens DROP COLUMN IF EXISTS scopes;
+
+DROP INDEX IF EXISTS idx_api_tokens_previous_token_hash;
+ALTER TABLE api_tokens DROP COLUMN IF EXISTS previous_expires_at;
+ALTER TABLE api_tokens DROP COLUMN IF EXISTS previous_token_hash;
+
+DROP INDEX IF EXISTS idx_api_tokens_token_hash;
+ALTER TABLE api_tokens DROP COLUMN IF EXISTS token_prefix;
+ALTER TABLE api_tokens DROP COLUMN IF EXISTS token_hash;
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS token TEXT NOT NULL UNIQUE;
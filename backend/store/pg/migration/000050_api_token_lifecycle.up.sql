@@ -0,0 +1,29 @@
+-- tokens are stored as sha256 hashes from now on, the raw values are dropped
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS token_hash TEXT;
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS token_prefix TEXT NOT NULL DEFAULT '';
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'api_tokens' AND column_name = 'token'
+    ) THEN
+        UPDATE api_tokens
+        SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex'),
+            token_prefix = left(token, 8)
+        WHERE token_hash IS NULL;
+        ALTER TABLE api_tokens DROP COLUMN token;
+    END IF;
+END $$;
+
+ALTER TABLE api_tokens ALTER COLUMN token_hash SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_token_hash ON api_tokens(token_hash);
+
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS previous_token_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS previous_expires_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_api_tokens_previous_token_hash
+ON api_tokens(previous_token_hash) WHERE previous_token_hash <> '';
+
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS monthly_token_quota BIGINT NOT NULL DEFAULT 0;
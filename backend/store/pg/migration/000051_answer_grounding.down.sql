@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_conversation_messages_ungrounded;
+ALTER TABLE conversation_messages DROP COLUMN IF EXISTS ungrounded;
+ALTER TABLE conversation_messages DROP COLUMN IF EXISTS citations;
@@ -0,0 +1,5 @@
+-- sentence level citations of assistant answers and the unsupported claims check
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS citations JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS ungrounded BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_conversation_messages_ungrounded
+ON conversation_messages(conversation_id) WHERE ungrounded;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS answer_cache_stats;
+DROP TABLE IF EXISTS answer_cache_entries;
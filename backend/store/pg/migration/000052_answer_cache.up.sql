@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS answer_cache_entries (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    group_key TEXT NOT NULL DEFAULT '',
+    question TEXT NOT NULL,
+    -- the embedding column is added on startup where the vector extension is available
+    answer TEXT NOT NULL,
+    node_ids TEXT[] NOT NULL DEFAULT '{}',
+    "references" JSONB NOT NULL DEFAULT '[]',
+    citations JSONB NOT NULL DEFAULT '[]',
+    total_tokens BIGINT NOT NULL DEFAULT 0,
+    hit_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_hit_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_answer_cache_entries_kb_group
+ON answer_cache_entries(kb_id, group_key, created_at);
+CREATE INDEX IF NOT EXISTS idx_answer_cache_entries_node_ids
+ON answer_cache_entries USING GIN(node_ids);
+
+CREATE TABLE IF NOT EXISTS answer_cache_stats (
+    kb_id TEXT NOT NULL,
+    day DATE NOT NULL,
+    lookups BIGINT NOT NULL DEFAULT 0,
+    hits BIGINT NOT NULL DEFAULT 0,
+    saved_tokens BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (kb_id, day)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_conversation_messages_conversation_id_created_at;
+DROP INDEX IF EXISTS idx_conversations_kb_id_created_at;
+ALTER TABLE conversations DROP COLUMN IF EXISTS anonymized;
@@ -0,0 +1,4 @@
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS anonymized BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_conversations_kb_id_created_at ON conversations(kb_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_conversation_messages_conversation_id_created_at
+ON conversation_messages(conversation_id, created_at);
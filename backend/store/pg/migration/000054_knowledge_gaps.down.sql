@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS knowledge_gaps;
+DROP TABLE IF EXISTS knowledge_gap_reports;
+DROP INDEX IF EXISTS idx_conversation_messages_parent_id;
+ALTER TABLE conversation_messages DROP COLUMN IF EXISTS retrieved_chunks;
@@ -0,0 +1,38 @@
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS retrieved_chunks INT;
+CREATE INDEX IF NOT EXISTS idx_conversation_messages_parent_id ON conversation_messages(parent_id);
+
+CREATE TABLE IF NOT EXISTS knowledge_gap_reports (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    days INT NOT NULL,
+    status TEXT NOT NULL,
+    question_count INT NOT NULL DEFAULT 0,
+    cluster_count INT NOT NULL DEFAULT 0,
+    gap_count INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    creator_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_knowledge_gap_reports_kb_id_created_at ON knowledge_gap_reports(kb_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_knowledge_gap_reports_status ON knowledge_gap_reports(status);
+
+CREATE TABLE IF NOT EXISTS knowledge_gaps (
+    id TEXT PRIMARY KEY,
+    report_id TEXT NOT NULL,
+    kb_id TEXT NOT NULL,
+    rank INT NOT NULL,
+    questions TEXT[] NOT NULL DEFAULT '{}',
+    question_count INT NOT NULL DEFAULT 0,
+    few_chunk_count INT NOT NULL DEFAULT 0,
+    dislike_count INT NOT NULL DEFAULT 0,
+    ungrounded_count INT NOT NULL DEFAULT 0,
+    score DOUBLE PRECISION NOT NULL DEFAULT 0,
+    title TEXT NOT NULL DEFAULT '',
+    outline TEXT NOT NULL DEFAULT '',
+    node_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_knowledge_gaps_report_id_rank ON knowledge_gaps(report_id, rank);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS conversation_handoff_messages;
+DROP TABLE IF EXISTS conversation_handoffs;
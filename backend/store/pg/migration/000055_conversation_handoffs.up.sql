@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS conversation_handoffs (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    app_id TEXT NOT NULL,
+    app_type SMALLINT NOT NULL,
+    channel_id TEXT NOT NULL,
+    remote_user_id TEXT NOT NULL DEFAULT '',
+    nickname TEXT NOT NULL DEFAULT '',
+    avatar TEXT NOT NULL DEFAULT '',
+    conversation_id TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    question TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    released_by TEXT NOT NULL DEFAULT '',
+    released_at timestamptz,
+    last_message_at timestamptz NOT NULL DEFAULT NOW(),
+    created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+-- a user of a bot chat has at most one pending handoff
+CREATE UNIQUE INDEX IF NOT EXISTS idx_uniq_conversation_handoffs_pending ON conversation_handoffs(app_id, channel_id, remote_user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_conversation_handoffs_kb_id_last_message_at ON conversation_handoffs(kb_id, last_message_at DESC);
+
+CREATE TABLE IF NOT EXISTS conversation_handoff_messages (
+    id TEXT PRIMARY KEY,
+    handoff_id TEXT NOT NULL,
+    role TEXT NOT NULL,
+    content TEXT NOT NULL,
+    user_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_handoff_messages_handoff_id_created_at ON conversation_handoff_messages(handoff_id, created_at);
@@ -0,0 +1,5 @@
+DELETE FROM system_settings WHERE key = 'admin_sso';
+
+DROP INDEX IF EXISTS idx_uniq_users_source_type_union_id;
+ALTER TABLE "public"."users" DROP COLUMN IF EXISTS "union_id";
+ALTER TABLE "public"."users" DROP COLUMN IF EXISTS "source_type";
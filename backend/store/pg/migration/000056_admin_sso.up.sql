@@ -0,0 +1,10 @@
+-- users provisioned by admin SSO keep the identity of their IdP user
+ALTER TABLE "public"."users" ADD COLUMN IF NOT EXISTS "source_type" text NOT NULL DEFAULT '';
+ALTER TABLE "public"."users" ADD COLUMN IF NOT EXISTS "union_id" text NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_uniq_users_source_type_union_id ON "public"."users" ("source_type", "union_id") WHERE "source_type" <> '';
+
+INSERT INTO system_settings (key, value, description)
+SELECT 'admin_sso', '{"enabled": false}'::jsonb, 'Admin console SSO configuration'
+WHERE NOT EXISTS (
+    SELECT 1 FROM system_settings WHERE key = 'admin_sso'
+);
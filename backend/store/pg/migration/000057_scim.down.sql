@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_auths_kb_id_source_type;
+ALTER TABLE "public"."auths" DROP COLUMN IF EXISTS "disabled";
+ALTER TABLE "public"."auths" DROP COLUMN IF EXISTS "scim_user_name";
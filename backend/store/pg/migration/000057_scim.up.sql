@@ -0,0 +1,4 @@
+-- readers provisioned over SCIM keep their userName and can be deactivated by the IdP
+ALTER TABLE "public"."auths" ADD COLUMN IF NOT EXISTS "scim_user_name" text NOT NULL DEFAULT '';
+ALTER TABLE "public"."auths" ADD COLUMN IF NOT EXISTS "disabled" boolean NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS idx_auths_kb_id_source_type ON "public"."auths" ("kb_id", "source_type");
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS ldap_sync_runs (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    trigger TEXT NOT NULL,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    status TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    result JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_ldap_sync_runs_kb_id_created_at ON ldap_sync_runs(kb_id, created_at DESC);
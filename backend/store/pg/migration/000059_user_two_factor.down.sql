@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS user_webauthn_credentials;
+ALTER TABLE "public"."users" DROP COLUMN IF EXISTS "recovery_codes";
+ALTER TABLE "public"."users" DROP COLUMN IF EXISTS "totp_enabled";
+ALTER TABLE "public"."users" DROP COLUMN IF EXISTS "totp_secret";
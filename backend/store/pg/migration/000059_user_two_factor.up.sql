@@ -0,0 +1,19 @@
+-- second factors of password logins, recovery_codes holds sha256 hashes of the unused codes
+ALTER TABLE "public"."users" ADD COLUMN IF NOT EXISTS "totp_secret" text NOT NULL DEFAULT '';
+ALTER TABLE "public"."users" ADD COLUMN IF NOT EXISTS "totp_enabled" boolean NOT NULL DEFAULT false;
+ALTER TABLE "public"."users" ADD COLUMN IF NOT EXISTS "recovery_codes" text[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS user_webauthn_credentials (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    credential_id TEXT NOT NULL,
+    public_key BYTEA NOT NULL,
+    rp_id TEXT NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    last_used_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_uniq_user_webauthn_credentials_credential_id ON user_webauthn_credentials(credential_id);
+CREATE INDEX IF NOT EXISTS idx_user_webauthn_credentials_user_id ON user_webauthn_credentials(user_id);
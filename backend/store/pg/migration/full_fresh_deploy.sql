@@ -752,6 +752,451 @@ SET settings = jsonb_set(
 WHERE (settings->'stats_setting'->'pv_enable') IS NULL;
 -- <<< END 000041_set_default_stats_pv_enable.up.sql
 
+-- >>> BEGIN 000042_create_node_release_search_index.up.sql
+CREATE INDEX IF NOT EXISTS idx_node_releases_search_vector
+ON node_releases USING GIN (
+    (setweight(to_tsvector('simple', coalesce(name, '')), 'A') || setweight(to_tsvector('simple', coalesce(content, '')), 'D'))
+);
+-- <<< END 000042_create_node_release_search_index.up.sql
+
+-- >>> BEGIN 000043_create_webhooks.up.sql
+CREATE TABLE IF NOT EXISTS webhooks (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT[] NOT NULL DEFAULT ARRAY[]::TEXT[],
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_kb_id ON webhooks(kb_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    webhook_id TEXT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    kb_id TEXT NOT NULL,
+    event TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_code INTEGER NOT NULL DEFAULT 0,
+    response_body TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    replay_of TEXT NOT NULL DEFAULT '',
+    next_retry_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_kb_id_created_at
+ON webhook_deliveries(kb_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id_created_at
+ON webhook_deliveries(webhook_id, created_at DESC);
+-- <<< END 000043_create_webhooks.up.sql
+
+-- >>> BEGIN 000044_create_git_sync.up.sql
+CREATE TABLE IF NOT EXISTS git_sync_nodes (
+    kb_id TEXT NOT NULL,
+    path TEXT NOT NULL,
+    node_id TEXT NOT NULL,
+    hash TEXT NOT NULL DEFAULT '',
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (kb_id, path)
+);
+
+CREATE TABLE IF NOT EXISTS git_sync_runs (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    direction TEXT NOT NULL,
+    trigger TEXT NOT NULL,
+    release_id TEXT NOT NULL DEFAULT '',
+    commit TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    result JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_git_sync_runs_kb_id_created_at ON git_sync_runs(kb_id, created_at DESC);
+-- <<< END 000044_create_git_sync.up.sql
+
+-- >>> BEGIN 000045_create_kb_import_jobs.up.sql
+CREATE TABLE IF NOT EXISTS kb_import_jobs (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    mode TEXT NOT NULL,
+    archive_key TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    stage TEXT NOT NULL DEFAULT '',
+    progress INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    result JSONB NOT NULL DEFAULT '{}'::jsonb,
+    creator_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_kb_import_jobs_kb_id_created_at ON kb_import_jobs(kb_id, created_at DESC);
+-- <<< END 000045_create_kb_import_jobs.up.sql
+
+-- >>> BEGIN 000046_create_release_schedules.up.sql
+CREATE TABLE IF NOT EXISTS release_schedules (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    node_ids TEXT[] NOT NULL DEFAULT '{}',
+    publish_at timestamptz NOT NULL,
+    unpublish_at timestamptz,
+    status TEXT NOT NULL,
+    release_id TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    creator_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    published_at timestamptz,
+    unpublished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_release_schedules_kb_id_publish_at ON release_schedules(kb_id, publish_at);
+CREATE INDEX IF NOT EXISTS idx_release_schedules_status_publish_at ON release_schedules(status, publish_at);
+-- <<< END 000046_create_release_schedules.up.sql
+
+-- >>> BEGIN 000047_create_node_reviews.up.sql
+CREATE TABLE IF NOT EXISTS node_reviews (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    node_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    stage INT NOT NULL DEFAULT 0,
+    stage_count INT NOT NULL DEFAULT 1,
+    name TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    meta JSONB NOT NULL DEFAULT '{}'::jsonb,
+    digest TEXT NOT NULL,
+    base_release_id TEXT NOT NULL DEFAULT '',
+    submitter_id TEXT NOT NULL DEFAULT '',
+    comment TEXT NOT NULL DEFAULT '',
+    release_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_reviews_kb_id_updated_at ON node_reviews(kb_id, updated_at DESC);
+CREATE INDEX IF NOT EXISTS idx_node_reviews_kb_id_node_id_status ON node_reviews(kb_id, node_id, status);
+CREATE INDEX IF NOT EXISTS idx_node_release_audits_review_id ON node_release_audits((detail->>'review_id'));
+-- <<< END 000047_create_node_reviews.up.sql
+
+-- >>> BEGIN 000048_create_node_revisions.up.sql
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS node_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    node_id TEXT NOT NULL,
+    version BIGINT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    meta JSONB NOT NULL DEFAULT '{}'::jsonb,
+    editor_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_node_revisions_node_id_version ON node_revisions(node_id, version);
+CREATE INDEX IF NOT EXISTS idx_node_revisions_created_at ON node_revisions(created_at);
+-- <<< END 000048_create_node_revisions.up.sql
+
+-- >>> BEGIN 000049_create_rag_eval.up.sql
+CREATE TABLE IF NOT EXISTS rag_eval_datasets (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    creator_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rag_eval_datasets_kb_id ON rag_eval_datasets(kb_id);
+
+CREATE TABLE IF NOT EXISTS rag_eval_cases (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    dataset_id TEXT NOT NULL,
+    question TEXT NOT NULL,
+    expected_answer TEXT NOT NULL DEFAULT '',
+    expected_node_ids TEXT[] NOT NULL DEFAULT '{}',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rag_eval_cases_dataset_id ON rag_eval_cases(dataset_id, created_at);
+
+CREATE TABLE IF NOT EXISTS rag_eval_runs (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    dataset_id TEXT NOT NULL,
+    prompt_version INT NOT NULL DEFAULT 0,
+    prompt TEXT NOT NULL DEFAULT '',
+    model_id TEXT NOT NULL DEFAULT '',
+    model_name TEXT NOT NULL DEFAULT '',
+    scorer TEXT NOT NULL,
+    top_k INT NOT NULL,
+    status TEXT NOT NULL,
+    progress INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    metrics JSONB NOT NULL DEFAULT '{}'::jsonb,
+    creator_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_rag_eval_runs_kb_id_created_at ON rag_eval_runs(kb_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_rag_eval_runs_dataset_id_created_at ON rag_eval_runs(dataset_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS rag_eval_results (
+    id BIGSERIAL PRIMARY KEY,
+    run_id TEXT NOT NULL,
+    case_id TEXT NOT NULL,
+    question TEXT NOT NULL,
+    expected_answer TEXT NOT NULL DEFAULT '',
+    expected_node_ids TEXT[] NOT NULL DEFAULT '{}',
+    answer TEXT NOT NULL DEFAULT '',
+    retrieved_node_ids TEXT[] NOT NULL DEFAULT '{}',
+    recall DOUBLE PRECISION,
+    answer_score DOUBLE PRECISION,
+    judge_reason TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    total_tokens INT NOT NULL DEFAULT 0,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rag_eval_results_run_id ON rag_eval_results(run_id);
+-- <<< END 000049_create_rag_eval.up.sql
+
+-- >>> BEGIN 000050_api_token_lifecycle.up.sql
+-- tokens are stored as sha256 hashes from now on, the raw values are dropped
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS token_hash TEXT;
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS token_prefix TEXT NOT NULL DEFAULT '';
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'api_tokens' AND column_name = 'token'
+    ) THEN
+        UPDATE api_tokens
+        SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex'),
+            token_prefix = left(token, 8)
+        WHERE token_hash IS NULL;
+        ALTER TABLE api_tokens DROP COLUMN token;
+    END IF;
+END $$;
+
+ALTER TABLE api_tokens ALTER COLUMN token_hash SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_token_hash ON api_tokens(token_hash);
+
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS previous_token_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS previous_expires_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_api_tokens_previous_token_hash
+ON api_tokens(previous_token_hash) WHERE previous_token_hash <> '';
+
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS monthly_token_quota BIGINT NOT NULL DEFAULT 0;
+-- <<< END 000050_api_token_lifecycle.up.sql
+
+-- >>> BEGIN 000051_answer_grounding.up.sql
+-- sentence level citations of assistant answers and the unsupported claims check
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS citations JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS ungrounded BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_conversation_messages_ungrounded
+ON conversation_messages(conversation_id) WHERE ungrounded;
+-- <<< END 000051_answer_grounding.up.sql
+
+-- >>> BEGIN 000052_answer_cache.up.sql
+CREATE TABLE IF NOT EXISTS answer_cache_entries (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    group_key TEXT NOT NULL DEFAULT '',
+    question TEXT NOT NULL,
+    -- the embedding column is added on startup where the vector extension is available
+    answer TEXT NOT NULL,
+    node_ids TEXT[] NOT NULL DEFAULT '{}',
+    "references" JSONB NOT NULL DEFAULT '[]',
+    citations JSONB NOT NULL DEFAULT '[]',
+    total_tokens BIGINT NOT NULL DEFAULT 0,
+    hit_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_hit_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_answer_cache_entries_kb_group
+ON answer_cache_entries(kb_id, group_key, created_at);
+CREATE INDEX IF NOT EXISTS idx_answer_cache_entries_node_ids
+ON answer_cache_entries USING GIN(node_ids);
+
+CREATE TABLE IF NOT EXISTS answer_cache_stats (
+    kb_id TEXT NOT NULL,
+    day DATE NOT NULL,
+    lookups BIGINT NOT NULL DEFAULT 0,
+    hits BIGINT NOT NULL DEFAULT 0,
+    saved_tokens BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (kb_id, day)
+);
+-- <<< END 000052_answer_cache.up.sql
+
+-- >>> BEGIN 000053_conversation_retention.up.sql
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS anonymized BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_conversations_kb_id_created_at ON conversations(kb_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_conversation_messages_conversation_id_created_at
+ON conversation_messages(conversation_id, created_at);
+-- <<< END 000053_conversation_retention.up.sql
+
+-- >>> BEGIN 000054_knowledge_gaps.up.sql
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS retrieved_chunks INT;
+CREATE INDEX IF NOT EXISTS idx_conversation_messages_parent_id ON conversation_messages(parent_id);
+
+CREATE TABLE IF NOT EXISTS knowledge_gap_reports (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    days INT NOT NULL,
+    status TEXT NOT NULL,
+    question_count INT NOT NULL DEFAULT 0,
+    cluster_count INT NOT NULL DEFAULT 0,
+    gap_count INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    creator_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_knowledge_gap_reports_kb_id_created_at ON knowledge_gap_reports(kb_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_knowledge_gap_reports_status ON knowledge_gap_reports(status);
+
+CREATE TABLE IF NOT EXISTS knowledge_gaps (
+    id TEXT PRIMARY KEY,
+    report_id TEXT NOT NULL,
+    kb_id TEXT NOT NULL,
+    rank INT NOT NULL,
+    questions TEXT[] NOT NULL DEFAULT '{}',
+    question_count INT NOT NULL DEFAULT 0,
+    few_chunk_count INT NOT NULL DEFAULT 0,
+    dislike_count INT NOT NULL DEFAULT 0,
+    ungrounded_count INT NOT NULL DEFAULT 0,
+    score DOUBLE PRECISION NOT NULL DEFAULT 0,
+    title TEXT NOT NULL DEFAULT '',
+    outline TEXT NOT NULL DEFAULT '',
+    node_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_knowledge_gaps_report_id_rank ON knowledge_gaps(report_id, rank);
+-- <<< END 000054_knowledge_gaps.up.sql
+
+-- >>> BEGIN 000055_conversation_handoffs.up.sql
+CREATE TABLE IF NOT EXISTS conversation_handoffs (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    app_id TEXT NOT NULL,
+    app_type SMALLINT NOT NULL,
+    channel_id TEXT NOT NULL,
+    remote_user_id TEXT NOT NULL DEFAULT '',
+    nickname TEXT NOT NULL DEFAULT '',
+    avatar TEXT NOT NULL DEFAULT '',
+    conversation_id TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    question TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    released_by TEXT NOT NULL DEFAULT '',
+    released_at timestamptz,
+    last_message_at timestamptz NOT NULL DEFAULT NOW(),
+    created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+-- a user of a bot chat has at most one pending handoff
+CREATE UNIQUE INDEX IF NOT EXISTS idx_uniq_conversation_handoffs_pending ON conversation_handoffs(app_id, channel_id, remote_user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_conversation_handoffs_kb_id_last_message_at ON conversation_handoffs(kb_id, last_message_at DESC);
+
+CREATE TABLE IF NOT EXISTS conversation_handoff_messages (
+    id TEXT PRIMARY KEY,
+    handoff_id TEXT NOT NULL,
+    role TEXT NOT NULL,
+    content TEXT NOT NULL,
+    user_id TEXT NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_handoff_messages_handoff_id_created_at ON conversation_handoff_messages(handoff_id, created_at);
+-- <<< END 000055_conversation_handoffs.up.sql
+
+-- >>> BEGIN 000056_admin_sso.up.sql
+-- users provisioned by admin SSO keep the identity of their IdP user
+ALTER TABLE "public"."users" ADD COLUMN IF NOT EXISTS "source_type" text NOT NULL DEFAULT '';
+ALTER TABLE "public"."users" ADD COLUMN IF NOT EXISTS "union_id" text NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_uniq_users_source_type_union_id ON "public"."users" ("source_type", "union_id") WHERE "source_type" <> '';
+
+INSERT INTO system_settings (key, value, description)
+SELECT 'admin_sso', '{"enabled": false}'::jsonb, 'Admin console SSO configuration'
+WHERE NOT EXISTS (
+    SELECT 1 FROM system_settings WHERE key = 'admin_sso'
+);
+-- <<< END 000056_admin_sso.up.sql
+
+-- >>> BEGIN 000057_scim.up.sql
+-- readers provisioned over SCIM keep their userName and can be deactivated by the IdP
+ALTER TABLE "public"."auths" ADD COLUMN IF NOT EXISTS "scim_user_name" text NOT NULL DEFAULT '';
+ALTER TABLE "public"."auths" ADD COLUMN IF NOT EXISTS "disabled" boolean NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS idx_auths_kb_id_source_type ON "public"."auths" ("kb_id", "source_type");
+-- <<< END 000057_scim.up.sql
+
+-- >>> BEGIN 000058_create_ldap_sync_runs.up.sql
+CREATE TABLE IF NOT EXISTS ldap_sync_runs (
+    id TEXT PRIMARY KEY,
+    kb_id TEXT NOT NULL,
+    trigger TEXT NOT NULL,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    status TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    result JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_ldap_sync_runs_kb_id_created_at ON ldap_sync_runs(kb_id, created_at DESC);
+-- <<< END 000058_create_ldap_sync_runs.up.sql
+
+-- >>> BEGIN 000059_user_two_factor.up.sql
+-- second factors of password logins, recovery_codes holds sha256 hashes of the unused codes
+ALTER TABLE "public"."users" ADD COLUMN IF NOT EXISTS "totp_secret" text NOT NULL DEFAULT '';
+ALTER TABLE "public"."users" ADD COLUMN IF NOT EXISTS "totp_enabled" boolean NOT NULL DEFAULT false;
+ALTER TABLE "public"."users" ADD COLUMN IF NOT EXISTS "recovery_codes" text[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS user_webauthn_credentials (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    credential_id TEXT NOT NULL,
+    public_key BYTEA NOT NULL,
+    rp_id TEXT NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    last_used_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_uniq_user_webauthn_credentials_credential_id ON user_webauthn_credentials(credential_id);
+CREATE INDEX IF NOT EXISTS idx_user_webauthn_credentials_user_id ON user_webauthn_credentials(user_id);
+-- <<< END 000059_user_two_factor.up.sql
+
 -- Ensure migration version is recorded for fresh deployments.
 DO $$
 BEGIN
@@ -763,5 +1208,5 @@ BEGIN
     END IF;
 
     DELETE FROM public.schema_migrations;
-    INSERT INTO public.schema_migrations (version, dirty) VALUES (41, FALSE);
+    INSERT INTO public.schema_migrations (version, dirty) VALUES (59, FALSE);
 END $$;
@@ -0,0 +1,144 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chaitin/panda-wiki/domain"
+)
+
+const embeddingBatchSize = 32
+
+// Embedder calls an OpenAI-compatible /embeddings endpoint of the configured embedding model.
+type Embedder struct {
+	httpClient *http.Client
+}
+
+func NewEmbedder() *Embedder {
+	return &Embedder{
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage *struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Embed returns one vector per input text, in input order.
+func (e *Embedder) Embed(ctx context.Context, model *domain.Model, texts []string) ([][]float32, error) {
+	vectors, _, err := e.EmbedWithUsage(ctx, model, texts)
+	return vectors, err
+}
+
+// EmbedWithUsage is Embed that also returns the prompt tokens the model reported.
+func (e *Embedder) EmbedWithUsage(ctx context.Context, model *domain.Model, texts []string) ([][]float32, int, error) {
+	if model == nil {
+		return nil, 0, fmt.Errorf("embedding model is not configured")
+	}
+	vectors := make([][]float32, 0, len(texts))
+	promptTokens := 0
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		end := min(start+embeddingBatchSize, len(texts))
+		batch, tokens, err := e.embedBatch(ctx, model, texts[start:end])
+		if err != nil {
+			return nil, 0, err
+		}
+		vectors = append(vectors, batch...)
+		promptTokens += tokens
+	}
+	return vectors, promptTokens, nil
+}
+
+func (e *Embedder) embedBatch(ctx context.Context, model *domain.Model, texts []string) ([][]float32, int, error) {
+	body, err := json.Marshal(embeddingRequest{Model: model.Model, Input: texts})
+	if err != nil {
+		return nil, 0, err
+	}
+	endpoint := strings.TrimRight(model.BaseURL, "/") + "/embeddings"
+	if model.APIVersion != "" {
+		endpoint += "?" + url.Values{"api-version": {model.APIVersion}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, fmt.Errorf("create embedding request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if model.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+model.APIKey)
+		// azure openai authenticates with api-key
+		if model.APIVersion != "" {
+			req.Header.Set("api-key", model.APIKey)
+		}
+	}
+	for key, value := range parseAPIHeader(model.APIHeader) {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("request embedding failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read embedding response failed: %w", err)
+	}
+	var result embeddingResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, 0, fmt.Errorf("decode embedding response failed (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if result.Error != nil && result.Error.Message != "" {
+			return nil, 0, fmt.Errorf("embedding request failed (status %d): %s", resp.StatusCode, result.Error.Message)
+		}
+		return nil, 0, fmt.Errorf("embedding request failed with status %d", resp.StatusCode)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, 0, fmt.Errorf("embedding count mismatch: want %d, got %d", len(texts), len(result.Data))
+	}
+	sort.Slice(result.Data, func(i, j int) bool { return result.Data[i].Index < result.Data[j].Index })
+	vectors := make([][]float32, len(result.Data))
+	for i, item := range result.Data {
+		vectors[i] = item.Embedding
+	}
+	if result.Usage == nil {
+		return vectors, 0, nil
+	}
+	return vectors, result.Usage.PromptTokens, nil
+}
+
+// parseAPIHeader reads the extra headers configured on a model, one key=value per line, the
+// same format the chat models take.
+func parseAPIHeader(header string) map[string]string {
+	headers := make(map[string]string)
+	for _, line := range strings.Split(header, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if key = strings.TrimSpace(key); ok && key != "" {
+			headers[key] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
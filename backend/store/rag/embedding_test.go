@@ -0,0 +1,66 @@
+package rag
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaitin/panda-wiki/domain"
+)
+
+func TestEmbedderSendsModelHeaders(t *testing.T) {
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		var req embeddingRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		data := make([]map[string]any, len(req.Input))
+		for i := range req.Input {
+			data[i] = map[string]any{"index": i, "embedding": []float32{float32(i)}}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer server.Close()
+
+	model := &domain.Model{
+		Model:     "text-embedding",
+		BaseURL:   server.URL + "/v1/",
+		APIKey:    "sk-test",
+		APIHeader: "X-Tenant=wiki\n\n X-Trace = 1 \ninvalid",
+	}
+	vectors, err := NewEmbedder().Embed(t.Context(), model, []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{0}, {1}}, vectors)
+	assert.Equal(t, "/v1/embeddings", received.URL.Path)
+	assert.Empty(t, received.URL.RawQuery)
+	assert.Equal(t, "Bearer sk-test", received.Header.Get("Authorization"))
+	assert.Equal(t, "wiki", received.Header.Get("X-Tenant"))
+	assert.Equal(t, "1", received.Header.Get("X-Trace"))
+	assert.Empty(t, received.Header.Get("api-key"))
+
+	model.APIVersion = "2024-02-01"
+	_, err = NewEmbedder().Embed(t.Context(), model, []string{"a"})
+	require.NoError(t, err)
+	assert.Equal(t, "2024-02-01", received.URL.Query().Get("api-version"))
+	assert.Equal(t, "sk-test", received.Header.Get("api-key"))
+}
+
+func TestEmbedderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+	}))
+	defer server.Close()
+
+	_, err := NewEmbedder().Embed(t.Context(), &domain.Model{BaseURL: server.URL}, []string{"a"})
+	require.ErrorContains(t, err, "invalid api key")
+}
+
+func TestParseAPIHeader(t *testing.T) {
+	assert.Empty(t, parseAPIHeader(""))
+	assert.Equal(t, map[string]string{"A": "1", "B": "x=y"}, parseAPIHeader("A=1\r\nB=x=y\n=skipped"))
+}
@@ -0,0 +1,478 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/config"
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
+	"github.com/chaitin/panda-wiki/utils"
+)
+
+// pgvectorSchema is applied on startup instead of a versioned migration so
+// that deployments using the CT provider never require the vector extension.
+// The embeddings have the dimensions of whichever model made them, they are
+// indexed per dimension by ensureEmbeddingIndex.
+var pgvectorSchema = []string{
+	`CREATE EXTENSION IF NOT EXISTS vector`,
+	`CREATE TABLE IF NOT EXISTS rag_datasets (
+		id text PRIMARY KEY,
+		created_at timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS rag_documents (
+		id text PRIMARY KEY,
+		dataset_id text NOT NULL,
+		name text NOT NULL DEFAULT '',
+		title text NOT NULL DEFAULT '',
+		status text NOT NULL DEFAULT 'PENDING',
+		progress_msg text NOT NULL DEFAULT '',
+		group_ids int8[],
+		tags text[],
+		created_at timestamptz NOT NULL DEFAULT now(),
+		updated_at timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_rag_documents_dataset_id ON rag_documents (dataset_id)`,
+	`CREATE TABLE IF NOT EXISTS rag_chunks (
+		id text PRIMARY KEY,
+		dataset_id text NOT NULL,
+		document_id text NOT NULL REFERENCES rag_documents (id) ON DELETE CASCADE,
+		seq int NOT NULL,
+		content text NOT NULL,
+		embedding vector NOT NULL,
+		created_at timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_rag_chunks_dataset_id ON rag_chunks (dataset_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_rag_chunks_document_id ON rag_chunks (document_id)`,
+	`CREATE TABLE IF NOT EXISTS rag_models (
+		type text PRIMARY KEY,
+		model jsonb NOT NULL,
+		updated_at timestamptz NOT NULL DEFAULT now()
+	)`,
+}
+
+// pgvectorIndexMaxDims is the most dimensions an hnsw index supports.
+const pgvectorIndexMaxDims = 2000
+
+// PGVectorRAG is a RAGService backed by PostgreSQL with the pgvector extension.
+// Documents are chunked locally and embedded through the configured embedding model.
+type PGVectorRAG struct {
+	db       *pg.DB
+	logger   *log.Logger
+	mdConv   *converter.Converter
+	embedder *Embedder
+	config   config.PGVectorConfig
+	// indexedDims holds the embedding dimensions having an index
+	indexedDims sync.Map
+}
+
+type pgvectorDocument struct {
+	ID          string         `gorm:"column:id"`
+	DatasetID   string         `gorm:"column:dataset_id"`
+	Name        string         `gorm:"column:name"`
+	Title       string         `gorm:"column:title"`
+	Status      string         `gorm:"column:status"`
+	ProgressMsg string         `gorm:"column:progress_msg"`
+	GroupIDs    pq.Int64Array  `gorm:"column:group_ids"` // nil: open to all, empty: closed
+	Tags        pq.StringArray `gorm:"column:tags"`
+	CreatedAt   time.Time      `gorm:"column:created_at"`
+	UpdatedAt   time.Time      `gorm:"column:updated_at"`
+}
+
+type pgvectorChunk struct {
+	ID         string  `gorm:"column:id"`
+	DocumentID string  `gorm:"column:document_id"`
+	Content    string  `gorm:"column:content"`
+	Score      float64 `gorm:"column:score"`
+}
+
+func NewPGVectorRAG(config *config.Config, db *pg.DB, logger *log.Logger) (*PGVectorRAG, error) {
+	if db == nil {
+		return nil, fmt.Errorf("pgvector rag requires a database connection")
+	}
+	for _, stmt := range pgvectorSchema {
+		if err := db.Exec(stmt).Error; err != nil {
+			return nil, fmt.Errorf("init pgvector schema failed: %w", err)
+		}
+	}
+	return &PGVectorRAG{
+		db:       db,
+		logger:   logger.WithModule("store.vector.pgvector"),
+		mdConv:   NewHTML2MDConverter(),
+		embedder: NewEmbedder(),
+		config:   config.RAG.PGVector,
+	}, nil
+}
+
+func (s *PGVectorRAG) CreateKnowledgeBase(ctx context.Context) (string, error) {
+	datasetID := uuid.New().String()
+	if err := s.db.WithContext(ctx).
+		Exec("INSERT INTO rag_datasets (id) VALUES (?)", datasetID).Error; err != nil {
+		return "", fmt.Errorf("create dataset failed: %w", err)
+	}
+	return datasetID, nil
+}
+
+func (s *PGVectorRAG) DeleteKnowledgeBase(ctx context.Context, datasetID string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM rag_chunks WHERE dataset_id = ?", datasetID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM rag_documents WHERE dataset_id = ?", datasetID).Error; err != nil {
+			return err
+		}
+		return tx.Exec("DELETE FROM rag_datasets WHERE id = ?", datasetID).Error
+	})
+}
+
+func (s *PGVectorRAG) UpsertRecords(ctx context.Context, req *UpsertRecordsRequest) (string, error) {
+	markdown := req.Content
+	// if the content is html, convert it to markdown first
+	if utils.IsLikelyHTML(req.Content) {
+		var err error
+		markdown, err = s.mdConv.ConvertString(req.Content)
+		if err != nil {
+			return "", fmt.Errorf("convert html to markdown failed: %w", err)
+		}
+	}
+	docID := req.DocID
+	if docID == "" {
+		docID = uuid.New().String()
+	}
+	doc := &pgvectorDocument{
+		ID:        docID,
+		DatasetID: req.DatasetID,
+		Name:      fmt.Sprintf("%s.md", req.ID),
+		Title:     req.Title,
+		Status:    string(consts.NodeRagStatusRunning),
+		GroupIDs:  toInt64Array(req.GroupIDs),
+		Tags:      pq.StringArray(req.Tags),
+	}
+	if err := s.saveDocument(ctx, doc); err != nil {
+		return "", err
+	}
+
+	chunks := SplitText(markdown, s.config.ChunkSize, s.config.ChunkOverlap)
+	vectors, err := s.embedChunks(ctx, req.Title, chunks)
+	if err != nil {
+		if err := s.updateDocumentStatus(ctx, docID, consts.NodeRagStatusFailed, err.Error()); err != nil {
+			return "", err
+		}
+		// the document stays behind as failed, its id is returned to report that status
+		return docID, fmt.Errorf("embed document chunks failed: %w", err)
+	}
+	if len(vectors) > 0 {
+		s.ensureEmbeddingIndex(ctx, len(vectors[0]))
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM rag_chunks WHERE document_id = ?", docID).Error; err != nil {
+			return err
+		}
+		for i, chunk := range chunks {
+			if err := tx.Exec(
+				"INSERT INTO rag_chunks (id, dataset_id, document_id, seq, content, embedding) VALUES (?, ?, ?, ?, ?, ?::vector)",
+				uuid.New().String(), req.DatasetID, docID, i, chunk, vectorLiteral(vectors[i]),
+			).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Exec("UPDATE rag_documents SET status = ?, progress_msg = '', updated_at = now() WHERE id = ?",
+			string(consts.NodeRagStatusSucceeded), docID).Error
+	})
+	if err != nil {
+		if err := s.updateDocumentStatus(ctx, docID, consts.NodeRagStatusFailed, err.Error()); err != nil {
+			return "", err
+		}
+		return docID, fmt.Errorf("save document chunks failed: %w", err)
+	}
+	return docID, nil
+}
+
+func (s *PGVectorRAG) QueryRecords(ctx context.Context, req *QueryRecordsRequest) (string, []*domain.NodeContentChunk, error) {
+	model, err := s.getModel(ctx, domain.ModelTypeEmbedding)
+	if err != nil {
+		return "", nil, err
+	}
+	vectors, err := s.embedder.Embed(ctx, model, []string{req.Query})
+	if err != nil {
+		return "", nil, fmt.Errorf("embed query failed: %w", err)
+	}
+	topK := s.config.TopK
+	if topK <= 0 {
+		topK = 10
+	}
+	// over-fetch so that per-document limits do not starve the result
+	limit := topK
+	if req.MaxChunksPerDoc > 0 {
+		limit = topK * 4
+	}
+	queryVector := vectorLiteral(vectors[0])
+	// the chunks embedded by another model can not be compared, and the cast to the
+	// dimensions of the query lets the index of those be used
+	dims := len(vectors[0])
+	distance := fmt.Sprintf("c.embedding::vector(%d) <=> ?::vector(%d)", dims, dims)
+	query := s.db.WithContext(ctx).
+		Table("rag_chunks AS c").
+		Select("c.id, c.document_id, c.content, 1 - ("+distance+") AS score", queryVector).
+		Joins("JOIN rag_documents AS d ON d.id = c.document_id").
+		Where("c.dataset_id = ?", req.DatasetID).
+		Where(fmt.Sprintf("vector_dims(c.embedding) = %d", dims)).
+		Where("d.group_ids IS NULL OR d.group_ids && ?::int8[]", toInt64Array(req.GroupIDs))
+	if len(req.Tags) > 0 {
+		query = query.Where("d.tags && ?::text[]", pq.StringArray(req.Tags))
+	}
+	var rows []pgvectorChunk
+	if err := query.
+		Order(gorm.Expr(distance, queryVector)).
+		Limit(limit).
+		Scan(&rows).Error; err != nil {
+		return "", nil, fmt.Errorf("query chunks failed: %w", err)
+	}
+
+	perDoc := make(map[string]int)
+	nodeChunks := make([]*domain.NodeContentChunk, 0, topK)
+	for _, row := range rows {
+		if row.Score < req.SimilarityThreshold {
+			continue
+		}
+		if req.MaxChunksPerDoc > 0 && perDoc[row.DocumentID] >= req.MaxChunksPerDoc {
+			continue
+		}
+		perDoc[row.DocumentID]++
+		nodeChunks = append(nodeChunks, &domain.NodeContentChunk{
+			ID:      row.ID,
+			Content: row.Content,
+			DocID:   row.DocumentID,
+		})
+		if len(nodeChunks) >= topK {
+			break
+		}
+	}
+	s.logger.Info("retrieve chunks result", log.Int("chunks count", len(nodeChunks)), log.String("query", req.Query))
+	return req.Query, nodeChunks, nil
+}
+
+func (s *PGVectorRAG) DeleteRecords(ctx context.Context, datasetID string, docIDs []string) error {
+	if len(docIDs) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM rag_chunks WHERE dataset_id = ? AND document_id IN ?", datasetID, docIDs).Error; err != nil {
+			return err
+		}
+		return tx.Exec("DELETE FROM rag_documents WHERE dataset_id = ? AND id IN ?", datasetID, docIDs).Error
+	})
+}
+
+func (s *PGVectorRAG) UpdateDocumentGroupIDs(ctx context.Context, datasetID string, docID string, groupIds []int) error {
+	if err := s.db.WithContext(ctx).
+		Exec("UPDATE rag_documents SET group_ids = ?, updated_at = now() WHERE dataset_id = ? AND id = ?", toInt64Array(groupIds), datasetID, docID).
+		Error; err != nil {
+		return fmt.Errorf("update document group IDs failed: %w", err)
+	}
+	return nil
+}
+
+func (s *PGVectorRAG) ListDocuments(ctx context.Context, datasetID string, documentIDs []string) ([]Document, error) {
+	query := s.db.WithContext(ctx).Table("rag_documents").Where("dataset_id = ?", datasetID)
+	if len(documentIDs) > 0 {
+		query = query.Where("id IN ?", documentIDs)
+	}
+	var rows []pgvectorDocument
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	documents := make([]Document, len(rows))
+	for i, row := range rows {
+		var groupIDs []int
+		if row.GroupIDs != nil {
+			groupIDs = make([]int, len(row.GroupIDs))
+			for j, id := range row.GroupIDs {
+				groupIDs[j] = int(id)
+			}
+		}
+		documents[i] = Document{
+			ID:          row.ID,
+			Name:        row.Name,
+			DatasetID:   row.DatasetID,
+			Status:      row.Status,
+			ProgressMsg: row.ProgressMsg,
+			Tags:        row.Tags,
+			MetaData:    DocumentMetadata{GroupIDs: groupIDs},
+		}
+	}
+	return documents, nil
+}
+
+// Models are stored per type; the active embedding model drives chunk and query vectors.
+
+func (s *PGVectorRAG) GetModelList(ctx context.Context) ([]*domain.Model, error) {
+	var rows []struct {
+		Model []byte `gorm:"column:model"`
+	}
+	if err := s.db.WithContext(ctx).Table("rag_models").Select("model").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	models := make([]*domain.Model, 0, len(rows))
+	for _, row := range rows {
+		var model domain.Model
+		if err := json.Unmarshal(row.Model, &model); err != nil {
+			return nil, fmt.Errorf("decode rag model failed: %w", err)
+		}
+		models = append(models, &model)
+	}
+	return models, nil
+}
+
+func (s *PGVectorRAG) AddModel(ctx context.Context, model *domain.Model) (string, error) {
+	if err := s.UpsertModel(ctx, model); err != nil {
+		return "", err
+	}
+	return model.ID, nil
+}
+
+func (s *PGVectorRAG) UpdateModel(ctx context.Context, model *domain.Model) error {
+	return s.UpsertModel(ctx, model)
+}
+
+func (s *PGVectorRAG) UpsertModel(ctx context.Context, model *domain.Model) error {
+	data, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Exec(
+		`INSERT INTO rag_models (type, model, updated_at) VALUES (?, ?, now())
+		ON CONFLICT (type) DO UPDATE SET model = EXCLUDED.model, updated_at = now()`,
+		string(model.Type), string(data),
+	).Error
+}
+
+func (s *PGVectorRAG) DeleteModel(ctx context.Context, model *domain.Model) error {
+	return s.db.WithContext(ctx).
+		Exec("DELETE FROM rag_models WHERE type = ? AND model->>'id' = ?", string(model.Type), model.ID).
+		Error
+}
+
+func (s *PGVectorRAG) getModel(ctx context.Context, modelType domain.ModelType) (*domain.Model, error) {
+	var row struct {
+		Model []byte `gorm:"column:model"`
+	}
+	err := s.db.WithContext(ctx).Table("rag_models").Select("model").Where("type = ?", string(modelType)).Take(&row).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%s model is not configured", modelType)
+		}
+		return nil, err
+	}
+	var model domain.Model
+	if err := json.Unmarshal(row.Model, &model); err != nil {
+		return nil, fmt.Errorf("decode rag model failed: %w", err)
+	}
+	return &model, nil
+}
+
+func (s *PGVectorRAG) embedChunks(ctx context.Context, title string, chunks []string) ([][]float32, error) {
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+	model, err := s.getModel(ctx, domain.ModelTypeEmbedding)
+	if err != nil {
+		return nil, err
+	}
+	// prefix the title so that short chunks keep their document context
+	inputs := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		if title != "" {
+			inputs[i] = title + "\n\n" + chunk
+		} else {
+			inputs[i] = chunk
+		}
+	}
+	return s.embedder.Embed(ctx, model, inputs)
+}
+
+// ensureEmbeddingIndex creates the index of the chunks with dims dimensions, an hnsw
+// index needs the dimensions of the vectors and the embedding model may change.
+func (s *PGVectorRAG) ensureEmbeddingIndex(ctx context.Context, dims int) {
+	if dims == 0 || dims > pgvectorIndexMaxDims {
+		return
+	}
+	if _, ok := s.indexedDims.Load(dims); ok {
+		return
+	}
+	if err := s.db.WithContext(ctx).Exec(fmt.Sprintf(
+		"CREATE INDEX IF NOT EXISTS idx_rag_chunks_embedding_%d ON rag_chunks "+
+			"USING hnsw ((embedding::vector(%d)) vector_cosine_ops) WHERE vector_dims(embedding) = %d",
+		dims, dims, dims)).Error; err != nil {
+		s.logger.Warn("create chunk embedding index failed", log.Int("dims", dims), log.Error(err))
+		return
+	}
+	s.indexedDims.Store(dims, true)
+}
+
+func (s *PGVectorRAG) saveDocument(ctx context.Context, doc *pgvectorDocument) error {
+	if err := s.db.WithContext(ctx).Exec(
+		`INSERT INTO rag_documents (id, dataset_id, name, title, status, progress_msg, group_ids, tags, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, '', ?, ?, now(), now())
+		ON CONFLICT (id) DO UPDATE SET
+			dataset_id = EXCLUDED.dataset_id,
+			name = EXCLUDED.name,
+			title = EXCLUDED.title,
+			status = EXCLUDED.status,
+			progress_msg = '',
+			group_ids = EXCLUDED.group_ids,
+			tags = EXCLUDED.tags,
+			updated_at = now()`,
+		doc.ID, doc.DatasetID, doc.Name, doc.Title, doc.Status, doc.GroupIDs, doc.Tags,
+	).Error; err != nil {
+		return fmt.Errorf("save document failed: %w", err)
+	}
+	return nil
+}
+
+func (s *PGVectorRAG) updateDocumentStatus(ctx context.Context, docID string, status consts.NodeRagInfoStatus, msg string) error {
+	return s.db.WithContext(ctx).
+		Exec("UPDATE rag_documents SET status = ?, progress_msg = ?, updated_at = now() WHERE id = ?", string(status), msg, docID).
+		Error
+}
+
+// toInt64Array keeps the nil/empty distinction of node group IDs.
+func toInt64Array(ids []int) pq.Int64Array {
+	if ids == nil {
+		return nil
+	}
+	arr := make(pq.Int64Array, len(ids))
+	for i, id := range ids {
+		arr[i] = int64(id)
+	}
+	return arr
+}
+
+// vectorLiteral formats an embedding in pgvector's text input format.
+func vectorLiteral(v []float32) string {
+	var b strings.Builder
+	b.Grow(len(v) * 10)
+	b.WriteByte('[')
+	for i, f := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'f', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
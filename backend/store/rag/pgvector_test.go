@@ -0,0 +1,44 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitTextKeepsParagraphs(t *testing.T) {
+	text := "# Title\n\nfirst paragraph\n\nsecond paragraph"
+	chunks := SplitText(text, 100, 0)
+	assert.Equal(t, []string{text}, chunks)
+
+	chunks = SplitText(text, 20, 0)
+	assert.Equal(t, []string{"# Title", "first paragraph", "second paragraph"}, chunks)
+}
+
+func TestSplitTextLongParagraph(t *testing.T) {
+	text := strings.Repeat("文档", 50)
+	chunks := SplitText(text, 30, 5)
+	assert.Greater(t, len(chunks), 3)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, utf8.RuneCountInString(chunk), 30)
+	}
+	// adjacent chunks share the overlap
+	assert.True(t, strings.HasPrefix(chunks[1], string([]rune(chunks[0])[25:])))
+}
+
+func TestSplitTextEmpty(t *testing.T) {
+	assert.Nil(t, SplitText("  \n\n ", 100, 10))
+}
+
+func TestVectorLiteral(t *testing.T) {
+	assert.Equal(t, "[]", vectorLiteral(nil))
+	assert.Equal(t, "[0.5,-1,0.25]", vectorLiteral([]float32{0.5, -1, 0.25}))
+}
+
+func TestToInt64Array(t *testing.T) {
+	assert.Nil(t, toInt64Array(nil))
+	assert.NotNil(t, toInt64Array([]int{}))
+	assert.Equal(t, []int64{1, 2}, []int64(toInt64Array([]int{1, 2})))
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/chaitin/panda-wiki/config"
 	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/store/pg"
 )
 
 type QueryRecordsRequest struct {
@@ -48,6 +49,8 @@ type Document struct {
 
 type RAGService interface {
 	CreateKnowledgeBase(ctx context.Context) (string, error)
+	// UpsertRecords returns the document id, also along with an error once the document is
+	// recorded as failed.
 	UpsertRecords(ctx context.Context, req *UpsertRecordsRequest) (string, error)
 	QueryRecords(ctx context.Context, req *QueryRecordsRequest) (string, []*domain.NodeContentChunk, error)
 	DeleteRecords(ctx context.Context, datasetID string, docIDs []string) error
@@ -62,10 +65,12 @@ type RAGService interface {
 	DeleteModel(ctx context.Context, model *domain.Model) error
 }
 
-func NewRAGService(config *config.Config, logger *log.Logger) (RAGService, error) {
+func NewRAGService(config *config.Config, db *pg.DB, logger *log.Logger) (RAGService, error) {
 	switch config.RAG.Provider {
 	case "ct":
 		return NewCTRAG(config, logger)
+	case "pgvector":
+		return NewPGVectorRAG(config, db, logger)
 	default:
 		return nil, fmt.Errorf("unsupported vector provider: %s", config.RAG.Provider)
 	}
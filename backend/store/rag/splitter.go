@@ -0,0 +1,66 @@
+package rag
+
+import (
+	"strings"
+)
+
+// SplitText splits markdown into chunks of at most chunkSize runes.
+// Paragraphs are kept together when they fit; longer paragraphs are cut
+// by rune count. Adjacent chunks share up to overlap trailing runes.
+func SplitText(text string, chunkSize, overlap int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if chunkSize <= 0 {
+		return []string{text}
+	}
+	if overlap < 0 || overlap >= chunkSize/2 {
+		overlap = 0
+	}
+
+	var (
+		chunks  []string
+		current []rune
+		pending bool // current holds runes not yet emitted
+	)
+	flush := func() {
+		if trimmed := strings.TrimSpace(string(current)); trimmed != "" {
+			chunks = append(chunks, trimmed)
+		}
+		if overlap > 0 && len(current) > overlap {
+			current = append([]rune{}, current[len(current)-overlap:]...)
+		} else {
+			current = current[:0]
+		}
+		pending = false
+	}
+
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		runes := []rune(strings.TrimSpace(paragraph))
+		if len(runes) == 0 {
+			continue
+		}
+		if pending && len(current)+len(runes)+2 > chunkSize {
+			flush()
+		}
+		if len(current) > 0 {
+			current = append(current, '\n', '\n')
+		}
+		for len(runes) > 0 {
+			room := max(chunkSize-len(current), 1)
+			if len(runes) <= room {
+				current = append(current, runes...)
+				pending = true
+				break
+			}
+			current = append(current, runes[:room]...)
+			runes = runes[room:]
+			flush()
+		}
+	}
+	if pending {
+		flush()
+	}
+	return chunks
+}
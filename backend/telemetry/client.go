@@ -323,6 +323,7 @@ func (c *Client) reportData() error {
 		event.OpenAIAPIConversationCount = int(totals[domain.AppTypeOpenAIAPI])
 		event.WecomAIBotConversationCount = int(totals[domain.AppTypeWecomAIBot])
 		event.LarkBotConversationCount = int(totals[domain.AppTypeLarkBot])
+		event.SlackBotConversationCount = int(totals[domain.AppTypeSlackBot])
 	} else {
 		c.logger.Error("get conversation count by app type failed", log.Error(err))
 	}
@@ -421,4 +422,5 @@ type DailyReportEvent struct {
 	WecomAIBotConversationCount            int    `json:"wecom_ai_bot_conversation_count"`            // 企业微信智能机器人对话次数
 	LarkBotConversationCount               int    `json:"lark_bot_conversation_count"`                // 飞书机器人对话次数
 	McpServerConversationCount             int    `json:"mcp_server_conversation_count"`              // MCP 对话次数
+	SlackBotConversationCount              int    `json:"slack_bot_conversation_count"`               // Slack 机器人对话次数
 }
@@ -18,6 +18,9 @@ import (
 	"github.com/chaitin/panda-wiki/pkg/bot/discord"
 	"github.com/chaitin/panda-wiki/pkg/bot/feishu"
 	"github.com/chaitin/panda-wiki/pkg/bot/lark"
+	"github.com/chaitin/panda-wiki/pkg/bot/slack"
+	"github.com/chaitin/panda-wiki/pkg/bot/wechat"
+	"github.com/chaitin/panda-wiki/pkg/bot/wechat_service"
 	"github.com/chaitin/panda-wiki/repo/pg"
 	"github.com/chaitin/panda-wiki/store/cache"
 )
@@ -32,6 +35,7 @@ type AppUsecase struct {
 	nodeUsecase   *NodeUsecase
 	chatUsecase   *ChatUsecase
 	pushUsecase   *PushUsecase
+	handoff       *HandoffUsecase
 	logger        *log.Logger
 	config        *config.Config
 	cache         *cache.Cache
@@ -43,6 +47,8 @@ type AppUsecase struct {
 	larkMutex     sync.RWMutex
 	discordBots   map[string]*discord.DiscordClient
 	discordMutex  sync.RWMutex
+	slackBots     map[string]*slack.SlackClient
+	slackMutex    sync.RWMutex
 }
 
 func NewAppUsecase(
@@ -55,6 +61,7 @@ func NewAppUsecase(
 	config *config.Config,
 	chatUsecase *ChatUsecase,
 	pushUsecase *PushUsecase,
+	handoff *HandoffUsecase,
 	cache *cache.Cache,
 ) *AppUsecase {
 	u := &AppUsecase{
@@ -62,6 +69,7 @@ func NewAppUsecase(
 		nodeUsecase:  nodeUsecase,
 		chatUsecase:  chatUsecase,
 		pushUsecase:  pushUsecase,
+		handoff:      handoff,
 		authRepo:     authRepo,
 		nodeRepo:     nodeRepo,
 		kbRepo:       kbRepo,
@@ -72,10 +80,12 @@ func NewAppUsecase(
 		feishuBots:   make(map[string]*feishu.FeishuClient),
 		larkBots:     make(map[string]*lark.LarkClient),
 		discordBots:  make(map[string]*discord.DiscordClient),
+		slackBots:    make(map[string]*slack.SlackClient),
 	}
 
-	// Initialize all valid DingTalkBot, FeishuBot, LarkBot and DiscordBot instances
-	apps, err := u.repo.GetAppsByTypes(context.Background(), []domain.AppType{domain.AppTypeDingTalkBot, domain.AppTypeFeishuBot, domain.AppTypeLarkBot, domain.AppTypeDisCordBot})
+	// Initialize all valid DingTalkBot, FeishuBot, LarkBot, DiscordBot and SlackBot instances,
+	// and the handoff senders of the wechat bots
+	apps, err := u.repo.GetAppsByTypes(context.Background(), []domain.AppType{domain.AppTypeDingTalkBot, domain.AppTypeFeishuBot, domain.AppTypeLarkBot, domain.AppTypeDisCordBot, domain.AppTypeSlackBot, domain.AppTypeWechatBot, domain.AppTypeWechatServiceBot})
 	if err != nil {
 		u.logger.Error("failed to get dingtalk bot apps", log.Error(err))
 		return u
@@ -91,6 +101,10 @@ func NewAppUsecase(
 			u.updateLarkBot(app)
 		case domain.AppTypeDisCordBot:
 			u.updateDisCordBot(app)
+		case domain.AppTypeSlackBot:
+			u.updateSlackBot(app)
+		case domain.AppTypeWechatBot, domain.AppTypeWechatServiceBot:
+			u.updateWechatSender(app)
 		}
 	}
 
@@ -205,6 +219,10 @@ func (u *AppUsecase) UpdateApp(ctx context.Context, id string, appRequest *domai
 			u.updateLarkBot(app)
 		case domain.AppTypeDisCordBot:
 			u.updateDisCordBot(app)
+		case domain.AppTypeSlackBot:
+			u.updateSlackBot(app)
+		case domain.AppTypeWechatBot, domain.AppTypeWechatServiceBot:
+			u.updateWechatSender(app)
 		}
 	}
 	return nil
@@ -225,6 +243,9 @@ func (u *AppUsecase) normalizeConversationSettings(settings *domain.AppSettings)
 
 func (u *AppUsecase) getQAFunc(kbID string, appType domain.AppType) bot.GetQAFun {
 	return func(ctx context.Context, msg string, info domain.ConversationInfo, ConversationID string) (chan string, error) {
+		if notice, muted := u.handoff.Intercept(ctx, kbID, appType, msg, info); muted {
+			return handoffNotice(notice), nil
+		}
 		auth, err := u.authRepo.GetAuthByKBIDAndSourceType(ctx, kbID, appType.ToSourceType())
 		if err != nil {
 			u.logger.Error("get auth failed", log.Error(err))
@@ -277,6 +298,9 @@ func (u *AppUsecase) getQAFunc(kbID string, appType domain.AppType) bot.GetQAFun
 					messageId = event.Content
 				}
 			}
+			if notice := u.handoff.CheckAnswer(ctx, kbID, appType, msg, info, messageId); notice != "" {
+				contentCh <- "\n\n" + notice
+			}
 			// check again
 			// contact --> send
 			if kb != nil && (appinfo.Settings.AIFeedbackSettings.AIFeedbackIsEnabled == nil || *appinfo.Settings.AIFeedbackSettings.AIFeedbackIsEnabled) { // open
@@ -304,6 +328,7 @@ func (u *AppUsecase) updateFeishuBot(app *domain.App) {
 
 	if (app.Settings.FeishuBotIsEnabled != nil && !*app.Settings.FeishuBotIsEnabled) || app.Settings.FeishuBotAppID == "" || app.Settings.FeishuBotAppSecret == "" {
 		u.pushUsecase.UnregisterNotifier(app.ID)
+		u.handoff.UnregisterSender(app.ID)
 		return
 	}
 
@@ -331,6 +356,7 @@ func (u *AppUsecase) updateFeishuBot(app *domain.App) {
 	u.feishuBots[app.ID] = feishuClient
 	// Feishu push uses webhook-based notifier (chat_id = webhook URL configured in KBUpdatePushChatIDs)
 	u.pushUsecase.RegisterNotifier(app.ID, feishu.NewFeishuWebhookNotifier())
+	u.handoff.RegisterSender(app.ID, feishuClient)
 }
 
 func (u *AppUsecase) updateLarkBot(app *domain.App) {
@@ -346,6 +372,7 @@ func (u *AppUsecase) updateLarkBot(app *domain.App) {
 
 	if (app.Settings.LarkBotSettings.IsEnabled != nil && !*app.Settings.LarkBotSettings.IsEnabled) || app.Settings.LarkBotSettings.AppID == "" || app.Settings.LarkBotSettings.AppSecret == "" {
 		u.pushUsecase.UnregisterNotifier(app.ID)
+		u.handoff.UnregisterSender(app.ID)
 		return
 	}
 
@@ -380,6 +407,7 @@ func (u *AppUsecase) updateLarkBot(app *domain.App) {
 	u.larkBots[app.ID] = larkClient
 	// Lark push uses the same webhook-based notifier as Feishu
 	u.pushUsecase.RegisterNotifier(app.ID, feishu.NewFeishuWebhookNotifier())
+	u.handoff.RegisterSender(app.ID, larkClient)
 }
 
 func (u *AppUsecase) updateDingTalkBot(app *domain.App) {
@@ -396,6 +424,7 @@ func (u *AppUsecase) updateDingTalkBot(app *domain.App) {
 
 	if (app.Settings.DingTalkBotIsEnabled != nil && !*app.Settings.DingTalkBotIsEnabled) || app.Settings.DingTalkBotClientID == "" || app.Settings.DingTalkBotClientSecret == "" {
 		u.pushUsecase.UnregisterNotifier(app.ID)
+		u.handoff.UnregisterSender(app.ID)
 		return
 	}
 
@@ -429,6 +458,7 @@ func (u *AppUsecase) updateDingTalkBot(app *domain.App) {
 	u.dingTalkBots[app.ID] = dingTalkClient
 	// DingTalk push uses webhook-based notifier (chat_id = webhook URL configured in KBUpdatePushChatIDs)
 	u.pushUsecase.RegisterNotifier(app.ID, dingtalk.NewDingTalkPushNotifier(u.logger))
+	u.handoff.RegisterSender(app.ID, dingTalkClient)
 }
 
 func (u *AppUsecase) updateDisCordBot(app *domain.App) {
@@ -445,6 +475,7 @@ func (u *AppUsecase) updateDisCordBot(app *domain.App) {
 	}
 	token := app.Settings.DiscordBotToken
 	if (app.Settings.DiscordBotIsEnabled != nil && !*app.Settings.DiscordBotIsEnabled) || token == "" {
+		u.handoff.UnregisterSender(app.ID)
 		return
 	}
 
@@ -465,6 +496,111 @@ func (u *AppUsecase) updateDisCordBot(app *domain.App) {
 
 	u.logger.Info("discord bot is starting", log.String("token", token))
 	u.discordBots[app.ID] = discordBots
+	u.handoff.RegisterSender(app.ID, discordBots)
+}
+
+func (u *AppUsecase) updateSlackBot(app *domain.App) {
+	u.slackMutex.Lock()
+	defer u.slackMutex.Unlock()
+
+	if bot, exists := u.slackBots[app.ID]; exists {
+		if bot != nil {
+			bot.Stop()
+			delete(u.slackBots, app.ID)
+		}
+	}
+
+	settings := app.Settings.SlackBotSettings
+	if (settings.IsEnabled != nil && !*settings.IsEnabled) || settings.BotToken == "" || settings.SigningSecret == "" {
+		u.pushUsecase.UnregisterNotifier(app.ID)
+		u.handoff.UnregisterSender(app.ID)
+		return
+	}
+
+	getQA := u.getQAFunc(app.KBID, app.Type)
+
+	botCtx, cancel := context.WithCancel(context.Background())
+	slackClient := slack.NewSlackClient(
+		botCtx,
+		cancel,
+		settings.BotToken,
+		settings.SigningSecret,
+		u.logger,
+		getQA,
+	)
+
+	go func() {
+		u.logger.Info("slack bot is starting", log.String("app_id", app.ID))
+		err := slackClient.Start()
+		if err != nil {
+			u.logger.Error("failed to start slack client", log.Error(err))
+			cancel()
+			u.unregisterSlackBot(app.ID, slackClient)
+			return
+		}
+	}()
+
+	u.slackBots[app.ID] = slackClient
+	// Slack pushes through the bot itself (chat_id = channel ID configured in KBUpdatePushChatIDs)
+	u.pushUsecase.RegisterNotifier(app.ID, slackClient)
+	u.handoff.RegisterSender(app.ID, slackClient)
+}
+
+// unregisterSlackBot drops a slack client that failed to start, unless the app has been
+// given another one since.
+func (u *AppUsecase) unregisterSlackBot(appID string, client *slack.SlackClient) {
+	u.slackMutex.Lock()
+	defer u.slackMutex.Unlock()
+
+	if u.slackBots[appID] != client {
+		return
+	}
+	delete(u.slackBots, appID)
+	u.pushUsecase.UnregisterNotifier(appID)
+	u.handoff.UnregisterSender(appID)
+}
+
+// updateWechatSender registers the handoff sender of a wechat bot. Wechat bots answer
+// callbacks instead of running a client, their configs only send messages.
+func (u *AppUsecase) updateWechatSender(app *domain.App) {
+	switch app.Type {
+	case domain.AppTypeWechatBot:
+		if (app.Settings.WeChatAppIsEnabled != nil && !*app.Settings.WeChatAppIsEnabled) || app.Settings.WeChatAppCorpID == "" || app.Settings.WeChatAppSecret == "" {
+			u.handoff.UnregisterSender(app.ID)
+			return
+		}
+		wechatConfig, err := wechat.NewWechatAppConfig(context.Background(), u.logger, app.KBID,
+			app.Settings.WeChatAppCorpID,
+			app.Settings.WeChatAppToken,
+			app.Settings.WeChatAppEncodingAESKey,
+			app.Settings.WeChatAppSecret,
+			app.Settings.WeChatAppAgentID,
+		)
+		if err != nil {
+			u.logger.Error("failed to create wechat app config", log.Error(err))
+			return
+		}
+		u.handoff.RegisterSender(app.ID, wechatConfig)
+	case domain.AppTypeWechatServiceBot:
+		if (app.Settings.WeChatServiceIsEnabled != nil && !*app.Settings.WeChatServiceIsEnabled) || app.Settings.WeChatServiceCorpID == "" || app.Settings.WeChatServiceSecret == "" {
+			u.handoff.UnregisterSender(app.ID)
+			return
+		}
+		serviceConfig, err := wechat_service.NewWechatServiceConfig(context.Background(), u.logger, app.KBID,
+			app.Settings.WeChatServiceCorpID,
+			app.Settings.WeChatServiceToken,
+			app.Settings.WeChatServiceEncodingAESKey,
+			app.Settings.WeChatServiceSecret,
+			app.Settings.WechatServiceLogo,
+			app.Settings.WechatServiceContainKeywords,
+			app.Settings.WechatServiceEqualKeywords,
+		)
+		if err != nil {
+			u.logger.Error("failed to create wechat service config", log.Error(err))
+			return
+		}
+		u.handoff.RegisterSender(app.ID, bot.MessageSenderFunc(serviceConfig.SendTextMessage))
+	}
 }
 
 func (u *AppUsecase) DeleteApp(ctx context.Context, id, kbID string) error {
@@ -480,6 +616,15 @@ func (u *AppUsecase) GetLarkBotClient(appID string) (*lark.LarkClient, bool) {
 	return client, ok
 }
 
+// GetSlackBotClient returns the Slack bot client for a given app ID
+// This is used to handle the Events API callbacks
+func (u *AppUsecase) GetSlackBotClient(appID string) (*slack.SlackClient, bool) {
+	u.slackMutex.RLock()
+	defer u.slackMutex.RUnlock()
+	client, ok := u.slackBots[appID]
+	return client, ok
+}
+
 func (u *AppUsecase) GetAppDetailByKBIDAndAppType(ctx context.Context, kbID string, appType domain.AppType) (*domain.AppDetailResp, error) {
 	app, err := u.repo.GetOrCreateAppByKBIDAndType(ctx, kbID, appType)
 	if err != nil {
@@ -544,6 +689,8 @@ func (u *AppUsecase) GetAppDetailByKBIDAndAppType(ctx context.Context, kbID stri
 		FeishuBotAppSecret: app.Settings.FeishuBotAppSecret,
 		// LarkBot
 		LarkBotSettings: app.Settings.LarkBotSettings,
+		// SlackBot
+		SlackBotSettings: app.Settings.SlackBotSettings,
 		// WechatBot
 		WeChatAppIsEnabled:       app.Settings.WeChatAppIsEnabled,
 		WeChatAppToken:           app.Settings.WeChatAppToken,
@@ -585,6 +732,14 @@ func (u *AppUsecase) GetAppDetailByKBIDAndAppType(ctx context.Context, kbID stri
 		DocumentFeedBackIsEnabled: app.Settings.DocumentFeedBackIsEnabled,
 		// AI Feedback
 		AIFeedbackSettings: app.Settings.AIFeedbackSettings,
+		// agent mode
+		AgentSettings: app.Settings.AgentSettings,
+		// answer cache
+		AnswerCacheSettings: app.Settings.AnswerCacheSettings,
+		// grounding check
+		GroundingSettings: app.Settings.GroundingSettings,
+		// human handoff
+		HandoffSettings: app.Settings.HandoffSettings,
 		// WebApp Custom Settings
 		WebAppCustomSettings: app.Settings.WebAppCustomSettings,
 		// openai api settings
@@ -755,6 +910,10 @@ func (u *AppUsecase) ShareGetWebAppInfo(ctx context.Context, kbID string, authId
 			DocumentFeedBackIsEnabled: app.Settings.DocumentFeedBackIsEnabled,
 			// AI Feedback
 			AIFeedbackSettings: app.Settings.AIFeedbackSettings,
+			// agent mode
+			AgentSettings: app.Settings.AgentSettings,
+			// answer cache
+			AnswerCacheSettings: app.Settings.AnswerCacheSettings,
 			// WebApp Custom Settings
 			WebAppCustomSettings: app.Settings.WebAppCustomSettings,
 			// Disclaimer Settings
@@ -1040,6 +1199,14 @@ func (u *AppUsecase) handleBotAuths(ctx context.Context, id string, newSettings
 		}
 	}
 
+	// Handle Slack Bot
+	if currentApp.Settings.SlackBotSettings.IsEnabled != newSettings.SlackBotSettings.IsEnabled {
+		if err := u.handleBotAuth(ctx, currentApp.KBID, currentApp.ID, currentApp.Settings.SlackBotSettings.IsEnabled,
+			newSettings.SlackBotSettings.IsEnabled, consts.SourceTypeSlackBot); err != nil {
+			u.logger.Error("failed to handle slack bot auth", log.Error(err))
+		}
+	}
+
 	// Handle WeChat Bot
 	if currentApp.Settings.WeChatAppIsEnabled != newSettings.WeChatAppIsEnabled {
 		if err := u.handleBotAuth(ctx, currentApp.KBID, currentApp.ID, currentApp.Settings.WeChatAppIsEnabled,
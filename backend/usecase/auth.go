@@ -18,6 +18,7 @@ import (
 	"github.com/chaitin/panda-wiki/consts"
 	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/pkg/oidc"
 	"github.com/chaitin/panda-wiki/repo/pg"
 	"github.com/chaitin/panda-wiki/store/cache"
 )
@@ -43,6 +44,8 @@ type StateInfo struct {
 	KbId        string `json:"kb_id"`
 	RedirectUrl string `json:"redirect_url"`
 	Verifier    string `json:"verifier"`
+	Nonce       string `json:"nonce,omitempty"`
+	RequestID   string `json:"request_id,omitempty"`
 }
 
 func (u *AuthUsecase) GetAuthBySourceType(ctx context.Context, sourceType consts.SourceType) (*domain.Auth, error) {
@@ -54,14 +57,29 @@ func (u *AuthUsecase) DeleteAuth(ctx context.Context, req v1.AuthDeleteReq) erro
 }
 
 func (u *AuthUsecase) SetAuth(ctx context.Context, req v1.AuthSetReq) error {
+	authSetting := domain.AuthSetting{
+		ClientID:     req.ClientID,
+		ClientSecret: req.ClientSecret,
+		Proxy:        req.Proxy,
+	}
+	switch req.SourceType {
+	case consts.SourceTypeOIDC:
+		if req.Issuer == "" || req.ClientID == "" {
+			return errors.New("issuer and client_id are required for OIDC")
+		}
+		authSetting.Issuer = req.Issuer
+		authSetting.Scopes = req.Scopes
+		authSetting.GroupsClaim = req.GroupsClaim
+	case consts.SourceTypeSAML:
+		if err := u.setSAMLSetting(ctx, req, &authSetting); err != nil {
+			return err
+		}
+	}
+
 	if err := u.AuthRepo.CreateAuthConfig(ctx, &domain.AuthConfig{
-		AuthSetting: domain.AuthSetting{
-			ClientID:     req.ClientID,
-			ClientSecret: req.ClientSecret,
-			Proxy:        req.Proxy,
-		},
-		KbID:       req.KBID,
-		SourceType: req.SourceType,
+		AuthSetting: authSetting,
+		KbID:        req.KBID,
+		SourceType:  req.SourceType,
 	}); err != nil {
 		return err
 	}
@@ -111,6 +129,30 @@ func (u *AuthUsecase) GetAuth(ctx context.Context, kbID string, sourceType const
 		SourceType:   authConfig.SourceType,
 		Proxy:        authConfig.AuthSetting.Proxy,
 		Auths:        as,
+		Issuer:       authConfig.AuthSetting.Issuer,
+		Scopes:       authConfig.AuthSetting.Scopes,
+		GroupsClaim:  authConfig.AuthSetting.GroupsClaim,
+	}
+
+	switch sourceType {
+	case consts.SourceTypeSAML, consts.SourceTypeOIDC:
+		kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, kbID)
+		if err != nil {
+			return nil, err
+		}
+		baseUrl := kb.AccessSettings.GetBaseUrl()
+		if sourceType == consts.SourceTypeOIDC {
+			if baseUrl != "" {
+				resp.RedirectURI, _ = url.JoinPath(baseUrl, oidc.CallbackPath)
+			}
+			break
+		}
+		resp.IdPMetadataURL = authConfig.AuthSetting.IdPMetadataURL
+		resp.IdPMetadata = authConfig.AuthSetting.IdPMetadata
+		resp.SPCertificate = authConfig.AuthSetting.SPCertificate
+		if baseUrl != "" {
+			resp.SPEntityID, resp.SPACSURL = samlEndpoints(baseUrl, kbID)
+		}
 	}
 	return resp, nil
 
@@ -152,6 +194,29 @@ func (u *AuthUsecase) genState(ctx context.Context, stateInfo StateInfo) (string
 	return state, nil
 }
 
+// takeStateInfo reads the state and deletes it so that it can only be used once.
+func (u *AuthUsecase) takeStateInfo(ctx context.Context, state string) (*StateInfo, error) {
+	statInfo, err := u.getStateInfo(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.cache.Del(ctx, state).Err(); err != nil {
+		return nil, err
+	}
+	return statInfo, nil
+}
+
+// syncAuthGroups maps the group claims of the IdP to auth groups when the config asks for it.
+func (u *AuthUsecase) syncAuthGroups(ctx context.Context, authSetting domain.AuthSetting, auth *domain.Auth, groups []string) error {
+	if authSetting.GroupsClaim == "" {
+		return nil
+	}
+	if err := u.AuthRepo.SyncAuthGroups(ctx, auth.KBID, auth.ID, auth.SourceType, domain.NormalizeGroupClaims(groups)); err != nil {
+		return fmt.Errorf("sync auth groups failed: %w", err)
+	}
+	return nil
+}
+
 func (u *AuthUsecase) SaveNewSession(c echo.Context, auth *domain.Auth) error {
 	s := c.Get(domain.SessionCacheKey)
 	if s == nil {
@@ -170,6 +235,8 @@ func (u *AuthUsecase) SaveNewSession(c echo.Context, auth *domain.Auth) error {
 
 	newSess.Values["user_id"] = auth.ID
 	newSess.Values["kb_id"] = auth.KBID
+	// sessions issued before the auth was deprovisioned are rejected by the share auth middleware
+	newSess.Values["login_at"] = time.Now().Unix()
 
 	if err := newSess.Save(c.Request(), c.Response()); err != nil {
 		return err
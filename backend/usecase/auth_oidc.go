@@ -0,0 +1,96 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+
+	shareV1 "github.com/chaitin/panda-wiki/api/share/v1"
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/pkg/oidc"
+)
+
+func (u *AuthUsecase) getOIDCClient(ctx context.Context, kbId string) (*oidc.Client, *domain.AuthSetting, error) {
+	authConfig, err := u.AuthRepo.GetAuthConfig(ctx, kbId, consts.SourceTypeOIDC)
+	if err != nil {
+		return nil, nil, err
+	}
+	kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, kbId)
+	if err != nil {
+		return nil, nil, err
+	}
+	baseUrl := kb.AccessSettings.GetBaseUrl()
+	if baseUrl == "" {
+		return nil, nil, errors.New("base url of the knowledge base is required for OIDC")
+	}
+
+	authSetting := authConfig.AuthSetting
+	client, err := oidc.NewClient(ctx, u.logger, baseUrl, authSetting.Issuer, authSetting.ClientID, authSetting.ClientSecret, authSetting.Proxy, authSetting.Scopes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, &authSetting, nil
+}
+
+func (u *AuthUsecase) GenerateOIDCAuthUrl(ctx context.Context, req shareV1.AuthOIDCReq) (string, error) {
+	oidcClient, _, err := u.getOIDCClient(ctx, req.KbID)
+	if err != nil {
+		return "", fmt.Errorf("get oidcClient failed: %w", err)
+	}
+
+	stateInfo := StateInfo{
+		KbId:        req.KbID,
+		RedirectUrl: req.RedirectUrl,
+		Verifier:    oauth2.GenerateVerifier(),
+		Nonce:       uuid.New().String(),
+	}
+	state, err := u.genState(ctx, stateInfo)
+	if err != nil {
+		return "", fmt.Errorf("gen state failed: %w", err)
+	}
+
+	return oidcClient.GetAuthorizeURL(state, stateInfo.Nonce, stateInfo.Verifier), nil
+}
+
+func (u *AuthUsecase) OIDCCallback(ctx context.Context, req shareV1.OIDCCallbackReq) (*domain.Auth, string, error) {
+	statInfo, err := u.takeStateInfo(ctx, req.State)
+	if err != nil {
+		return nil, "", err
+	}
+
+	oidcClient, authSetting, err := u.getOIDCClient(ctx, statInfo.KbId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	userInfo, err := oidcClient.GetUserInfo(req.Code, statInfo.Nonce, statInfo.Verifier, authSetting.GroupsClaim)
+	if err != nil {
+		return nil, "", err
+	}
+
+	auth := &domain.Auth{
+		UserInfo: domain.AuthUserInfo{
+			Username:  userInfo.Name,
+			AvatarUrl: userInfo.AvatarUrl,
+			Email:     userInfo.Email,
+		},
+		KBID:       statInfo.KbId,
+		UnionID:    userInfo.Subject,
+		SourceType: consts.SourceTypeOIDC,
+	}
+
+	auth, err = u.AuthRepo.GetOrCreateAuth(ctx, auth, consts.SourceTypeOIDC)
+	if err != nil {
+		return nil, "", fmt.Errorf("create auth failed: %w", err)
+	}
+
+	if err := u.syncAuthGroups(ctx, *authSetting, auth, userInfo.Groups); err != nil {
+		return nil, "", err
+	}
+
+	return auth, statInfo.RedirectUrl, nil
+}
@@ -0,0 +1,173 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	v1 "github.com/chaitin/panda-wiki/api/auth/v1"
+	shareV1 "github.com/chaitin/panda-wiki/api/share/v1"
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/pkg/saml"
+)
+
+// attributes commonly used by IdPs for the email and display name of the user
+var (
+	samlEmailAttributes = []string{
+		"email", "mail", "emailaddress",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+	}
+	samlNameAttributes = []string{
+		"displayName", "name", "cn",
+		"http://schemas.microsoft.com/identity/claims/displayname",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+		"urn:oid:2.5.4.3",
+	}
+)
+
+// samlEndpoints returns the entity ID, which is also the metadata url, and the ACS url of
+// the SP of the kb.
+func samlEndpoints(baseUrl, kbID string) (string, string) {
+	entityID, _ := url.JoinPath(baseUrl, "/share/v1/openapi/saml", kbID, "metadata")
+	acsURL, _ := url.JoinPath(baseUrl, "/share/v1/openapi/saml", kbID, "acs")
+	return entityID, acsURL
+}
+
+// setSAMLSetting validates the IdP metadata and keeps the SP key pair of the existing config,
+// a new one is generated on the first save.
+func (u *AuthUsecase) setSAMLSetting(ctx context.Context, req v1.AuthSetReq, authSetting *domain.AuthSetting) error {
+	authSetting.IdPMetadataURL = req.IdPMetadataURL
+	authSetting.IdPMetadata = req.IdPMetadata
+	authSetting.GroupsClaim = req.GroupsClaim
+
+	if req.IdPMetadataURL != "" {
+		metadata, err := saml.FetchIdPMetadata(ctx, req.IdPMetadataURL, req.Proxy)
+		if err != nil {
+			return fmt.Errorf("fetch idp metadata failed: %w", err)
+		}
+		authSetting.IdPMetadata = string(metadata)
+	}
+	if authSetting.IdPMetadata == "" {
+		return errors.New("idp metadata is required for SAML")
+	}
+	if _, err := saml.ParseIdPMetadata([]byte(authSetting.IdPMetadata)); err != nil {
+		return err
+	}
+
+	existing, err := u.AuthRepo.GetAuthConfig(ctx, req.KBID, consts.SourceTypeSAML)
+	if err == nil && existing.AuthSetting.SPPrivateKey != "" {
+		authSetting.SPCertificate = existing.AuthSetting.SPCertificate
+		authSetting.SPPrivateKey = existing.AuthSetting.SPPrivateKey
+		return nil
+	}
+	authSetting.SPCertificate, authSetting.SPPrivateKey, err = saml.GenerateKeyPair("PandaWiki SAML SP")
+	if err != nil {
+		return fmt.Errorf("generate sp key pair failed: %w", err)
+	}
+	return nil
+}
+
+func (u *AuthUsecase) getSAMLServiceProvider(ctx context.Context, kbID string) (*saml.ServiceProvider, *domain.AuthSetting, error) {
+	authConfig, err := u.AuthRepo.GetAuthConfig(ctx, kbID, consts.SourceTypeSAML)
+	if err != nil {
+		return nil, nil, err
+	}
+	kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, kbID)
+	if err != nil {
+		return nil, nil, err
+	}
+	baseUrl := kb.AccessSettings.GetBaseUrl()
+	if baseUrl == "" {
+		return nil, nil, errors.New("base url of the knowledge base is required for SAML")
+	}
+
+	authSetting := authConfig.AuthSetting
+	idp, err := saml.ParseIdPMetadata([]byte(authSetting.IdPMetadata))
+	if err != nil {
+		return nil, nil, err
+	}
+	entityID, acsURL := samlEndpoints(baseUrl, kbID)
+	sp, err := saml.NewServiceProvider(entityID, acsURL, authSetting.SPCertificate, authSetting.SPPrivateKey, idp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sp, &authSetting, nil
+}
+
+func (u *AuthUsecase) GetSAMLMetadata(ctx context.Context, kbID string) ([]byte, error) {
+	sp, _, err := u.getSAMLServiceProvider(ctx, kbID)
+	if err != nil {
+		return nil, err
+	}
+	return sp.Metadata(), nil
+}
+
+func (u *AuthUsecase) GenerateSAMLAuthUrl(ctx context.Context, req shareV1.AuthSAMLReq) (string, error) {
+	sp, _, err := u.getSAMLServiceProvider(ctx, req.KbID)
+	if err != nil {
+		return "", fmt.Errorf("get saml service provider failed: %w", err)
+	}
+
+	stateInfo := StateInfo{
+		KbId:        req.KbID,
+		RedirectUrl: req.RedirectUrl,
+		RequestID:   saml.NewRequestID(),
+	}
+	// the state travels as the RelayState
+	state, err := u.genState(ctx, stateInfo)
+	if err != nil {
+		return "", fmt.Errorf("gen state failed: %w", err)
+	}
+	return sp.AuthnRequestURL(stateInfo.RequestID, state, time.Now())
+}
+
+// SAMLCallback handles the response posted to the ACS. The NameID is the identity of the
+// user, so the IdP should send a persistent one.
+func (u *AuthUsecase) SAMLCallback(ctx context.Context, req shareV1.SAMLACSReq) (*domain.Auth, string, error) {
+	statInfo, err := u.takeStateInfo(ctx, req.RelayState)
+	if err != nil {
+		return nil, "", err
+	}
+	if statInfo.KbId != req.KbID || statInfo.RequestID == "" {
+		return nil, "", errors.New("invalid relay state")
+	}
+
+	sp, authSetting, err := u.getSAMLServiceProvider(ctx, statInfo.KbId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	assertion, err := sp.ParseResponse(req.SAMLResponse, statInfo.RequestID, time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+
+	auth := &domain.Auth{
+		UserInfo: domain.AuthUserInfo{
+			Username: assertion.Value(samlNameAttributes...),
+			Email:    assertion.Value(samlEmailAttributes...),
+		},
+		KBID:       statInfo.KbId,
+		UnionID:    assertion.NameID,
+		SourceType: consts.SourceTypeSAML,
+	}
+	if auth.UserInfo.Username == "" {
+		auth.UserInfo.Username = assertion.NameID
+	}
+
+	auth, err = u.AuthRepo.GetOrCreateAuth(ctx, auth, consts.SourceTypeSAML)
+	if err != nil {
+		return nil, "", fmt.Errorf("create auth failed: %w", err)
+	}
+
+	if err := u.syncAuthGroups(ctx, *authSetting, auth, assertion.Attributes[authSetting.GroupsClaim]); err != nil {
+		return nil, "", err
+	}
+
+	return auth, statInfo.RedirectUrl, nil
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
 	modelkit "github.com/chaitin/ModelKit/v2/usecase"
 	"github.com/cloudwego/eino/schema"
 	"github.com/google/uuid"
@@ -17,6 +18,7 @@ import (
 	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/log"
 	"github.com/chaitin/panda-wiki/repo/pg"
+	"github.com/chaitin/panda-wiki/store/rag"
 	"github.com/chaitin/panda-wiki/utils"
 )
 
@@ -28,14 +30,16 @@ type ChatUsecase struct {
 	blockWordRepo       *pg.BlockWordRepo
 	kbRepo              *pg.KnowledgeBaseRepository
 	nodeRepo            *pg.NodeRepository
+	answerCacheRepo     *pg.AnswerCacheRepo
 	AuthRepo            *pg.AuthRepo
 	logger              *log.Logger
 	modelkit            *modelkit.ModelKit
+	mdConv              *converter.Converter
 	llmSemaphore        chan struct{} // limits concurrent LLM calls
 }
 
 func NewChatUsecase(llmUsecase *LLMUsecase, kbRepo *pg.KnowledgeBaseRepository, conversationUsecase *ConversationUsecase, modelUsecase *ModelUsecase, appRepo *pg.AppRepository,
-	blockWordRepo *pg.BlockWordRepo, nodeRepo *pg.NodeRepository, authRepo *pg.AuthRepo, logger *log.Logger) (*ChatUsecase, error) {
+	blockWordRepo *pg.BlockWordRepo, nodeRepo *pg.NodeRepository, answerCacheRepo *pg.AnswerCacheRepo, authRepo *pg.AuthRepo, logger *log.Logger) (*ChatUsecase, error) {
 	modelkit := modelkit.NewModelKit(logger.Logger)
 	u := &ChatUsecase{
 		llmUsecase:          llmUsecase,
@@ -45,9 +49,11 @@ func NewChatUsecase(llmUsecase *LLMUsecase, kbRepo *pg.KnowledgeBaseRepository,
 		blockWordRepo:       blockWordRepo,
 		kbRepo:              kbRepo,
 		nodeRepo:            nodeRepo,
+		answerCacheRepo:     answerCacheRepo,
 		AuthRepo:            authRepo,
 		logger:              logger.WithModule("usecase.chat"),
 		modelkit:            modelkit,
+		mdConv:              rag.NewHTML2MDConverter(),
 		llmSemaphore:        make(chan struct{}, 50),
 	}
 	if err := u.initDFA(); err != nil {
@@ -234,7 +240,26 @@ func (u *ChatUsecase) Chat(ctx context.Context, req *domain.ChatRequest) (<-chan
 			return
 		}
 
-		messages, rankedNodes, err := u.llmUsecase.BuildConversationMessageWithRAG(ctx, req.ConversationID, req.KBID, groupIds, req.Prompt)
+		// the first question of a conversation may be answered from the cache
+		var cacheLookup *answerCacheLookup
+		if req.OpenAI == nil && app.Settings.AnswerCacheSettings.IsEnabled {
+			cacheLookup = u.lookupAnswerCache(ctx, req, app.Settings.AnswerCacheSettings, groupIds)
+			if cacheLookup != nil && cacheLookup.hit != nil {
+				u.serveCachedAnswer(ctx, req, cacheLookup.hit, messageId, userMessageId, eventCh)
+				return
+			}
+		}
+
+		// agent mode retrieves while it answers
+		agentMode := req.OpenAI == nil && app.Settings.AgentSettings.IsEnabled
+		var messages []*schema.Message
+		var rankedNodes []*domain.RankedNodeChunks
+		switch {
+		case req.OpenAI != nil:
+			messages, rankedNodes, err = u.llmUsecase.BuildOpenAIMessages(ctx, req.KBID, groupIds, req.Prompt, req.Message, req.OpenAI)
+		case !agentMode:
+			messages, rankedNodes, err = u.llmUsecase.BuildConversationMessageWithRAG(ctx, req.ConversationID, req.KBID, groupIds, req.Prompt)
+		}
 		if err != nil {
 			u.logger.Error("build messages failed", log.Error(err))
 			eventCh <- domain.SSEEvent{Type: "error", Content: err.Error()}
@@ -242,15 +267,7 @@ func (u *ChatUsecase) Chat(ctx context.Context, req *domain.ChatRequest) (<-chan
 		}
 
 		u.logger.Debug("message:", log.Any("schema", messages))
-		for _, node := range rankedNodes {
-			chunkResult := domain.NodeContentChunkSSE{
-				NodeID:        node.NodeID,
-				Name:          node.NodeName,
-				Summary:       node.NodeSummary,
-				NodePathNames: node.NodePathNames,
-			}
-			eventCh <- domain.SSEEvent{Type: "chunk_result", ChunkResult: &chunkResult}
-		}
+		u.sendChunkResults(eventCh, rankedNodes)
 		// 5. LLM inference (streaming callback), message storage, token statistics
 		answer := ""
 		usage := schema.TokenUsage{}
@@ -271,7 +288,16 @@ func (u *ChatUsecase) Chat(ctx context.Context, req *domain.ChatRequest) (<-chan
 		// get words
 		onChunkAC, flushBuffer := u.CreateAcOnChunk(ctx, req.KBID, &answer, eventCh, blockWords)
 
-		chatErr := u.llmUsecase.ChatWithAgent(ctx, chatModel, messages, &usage, onChunkAC)
+		var chatErr error
+		finishReason := ""
+		switch {
+		case agentMode:
+			rankedNodes, chatErr = u.chatAgent(ctx, req, app.Settings.AgentSettings, chatModel, groupIds, &usage, onChunkAC, eventCh)
+		case req.OpenAI != nil && (req.OpenAI.UseTools() || req.OpenAI.WantsJSON()):
+			finishReason, chatErr = u.chatOpenAI(ctx, req, chatModel, messages, groupIds, &usage, onChunkAC, eventCh)
+		default:
+			chatErr = u.llmUsecase.ChatWithAgent(ctx, chatModel, messages, &usage, onChunkAC)
+		}
 
 		// 处理缓冲区中剩余的内容
 		if flushBuffer != nil {
@@ -294,6 +320,9 @@ func (u *ChatUsecase) Chat(ctx context.Context, req *domain.ChatRequest) (<-chan
 			TotalTokens:      usage.TotalTokens,
 			RemoteIP:         req.RemoteIP,
 			ParentID:         userMessageId,
+			RetrievedChunks: lo.ToPtr(lo.SumBy(rankedNodes, func(node *domain.RankedNodeChunks) int {
+				return len(node.Chunks)
+			})),
 		}); err != nil {
 			u.logger.Error("failed to save assistant answer to conversation message", log.Error(err))
 			eventCh <- domain.SSEEvent{Type: "error", Content: "failed to save assistant answer to conversation message"}
@@ -319,11 +348,35 @@ func (u *ChatUsecase) Chat(ctx context.Context, req *domain.ChatRequest) (<-chan
 				TotalTokens:      int(usage.TotalTokens),
 			},
 		}
-		eventCh <- domain.SSEEvent{Type: "done"}
+		// the OpenAI-compatible api reports the finish reason, empty means "stop"
+		eventCh <- domain.SSEEvent{Type: "done", Content: finishReason}
+
+		// the answer is out, the client may have gone away already
+		ctx = context.WithoutCancel(ctx)
+		var citations domain.AnswerCitations
+		// the OpenAI-compatible api has no citations
+		if app.Settings.GroundingSettings.IsEnabled && req.OpenAI == nil && len(rankedNodes) > 0 {
+			citations = u.groundAnswerMessage(ctx, req, chatModel, messageId, answer, rankedNodes)
+		}
+		if cacheLookup != nil && answer != "" && len(rankedNodes) > 0 && !citations.Ungrounded() {
+			u.storeAnswerCache(ctx, req, cacheLookup, answer, rankedNodes, citations, &usage)
+		}
 	}()
 	return eventCh, nil
 }
 
+func (u *ChatUsecase) sendChunkResults(eventCh chan<- domain.SSEEvent, rankedNodes []*domain.RankedNodeChunks) {
+	for _, node := range rankedNodes {
+		chunkResult := domain.NodeContentChunkSSE{
+			NodeID:        node.NodeID,
+			Name:          node.NodeName,
+			Summary:       node.NodeSummary,
+			NodePathNames: node.NodePathNames,
+		}
+		eventCh <- domain.SSEEvent{Type: "chunk_result", ChunkResult: &chunkResult}
+	}
+}
+
 func (u *ChatUsecase) ChatRagOnly(ctx context.Context, req *domain.ChatRagOnlyRequest) (<-chan domain.SSEEvent, error) {
 	eventCh := make(chan domain.SSEEvent, 100)
 	go func() {
@@ -375,6 +428,7 @@ func (u *ChatUsecase) ChatRagOnly(ctx context.Context, req *domain.ChatRagOnlyRe
 			return
 		}
 		_, rankedNodes, err := u.llmUsecase.GetRankNodes(ctx, GetRankNodesRequest{
+			KBID:                req.KBID,
 			DatasetID:           kb.DatasetID,
 			Question:            req.Message,
 			GroupIDs:            groupIds,
@@ -469,6 +523,7 @@ func (u *ChatUsecase) Search(ctx context.Context, req *domain.ChatSearchReq) (*d
 		return nil, err
 	}
 	_, rankedNodes, err := u.llmUsecase.GetRankNodes(ctx, GetRankNodesRequest{
+		KBID:                req.KBID,
 		DatasetID:           kb.DatasetID,
 		Question:            req.Message,
 		GroupIDs:            groupIds,
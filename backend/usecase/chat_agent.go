@@ -0,0 +1,314 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/schema"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/utils"
+)
+
+const (
+	agentNodeContentLimit = 8000
+	agentListChildrenMax  = 100
+)
+
+// agentRun is the state of one agent mode answer.
+type agentRun struct {
+	kb       *domain.KnowledgeBase
+	groupIDs []int
+	eventCh  chan<- domain.SSEEvent
+	step     int
+	// documents are all documents retrieved so far, found are their nodes, sent once each as
+	// chunk results
+	documents []*domain.RankedNodeChunks
+	found     map[string]bool
+}
+
+func (r *agentRun) emit(step domain.AgentStep) {
+	r.step++
+	step.Index = r.step
+	r.eventCh <- domain.SSEEvent{Type: "agent_step", AgentStep: &step}
+}
+
+// chatAgent answers in agent mode: the question is rewritten with the conversation history
+// and split into sub-queries, the documents of all sub-queries are given with the question,
+// and the model may search, open nodes and list children for up to settings.Steps() tool
+// calls before it answers. It returns the documents the answer is based on.
+func (u *ChatUsecase) chatAgent(
+	ctx context.Context,
+	req *domain.ChatRequest,
+	settings domain.AgentSettings,
+	chatModel model.BaseChatModel,
+	groupIDs []int,
+	usage *schema.TokenUsage,
+	onChunk func(ctx context.Context, dataType, chunk string) error,
+	eventCh chan<- domain.SSEEvent,
+) ([]*domain.RankedNodeChunks, error) {
+	history, err := u.llmUsecase.GetConversationHistory(ctx, req.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		history = []*schema.Message{schema.UserMessage(req.Message)}
+	}
+	kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, req.KBID)
+	if err != nil {
+		return nil, fmt.Errorf("get kb failed: %w", err)
+	}
+	run := &agentRun{kb: kb, groupIDs: groupIDs, eventCh: eventCh, found: make(map[string]bool)}
+
+	rewrite := u.rewriteQuestion(ctx, chatModel, history, usage)
+	run.emit(domain.AgentStep{Type: domain.AgentStepRewrite, Query: rewrite.Question, SubQueries: rewrite.SubQueries})
+
+	for _, query := range rewrite.SubQueries {
+		if _, err := u.agentSearch(ctx, run, query); err != nil {
+			return nil, err
+		}
+	}
+
+	template := prompt.FromMessages(schema.GoTemplate,
+		schema.SystemMessage(u.llmUsecase.resolveSystemPrompt(ctx, req.KBID, req.Prompt)+domain.AgentToolPrompt),
+		schema.UserMessage(domain.UserQuestionFormatter),
+	)
+	messages, err := template.Format(ctx, map[string]any{
+		"CurrentDate": time.Now().Format("2006-01-02"),
+		"Question":    rewrite.Question,
+		"Documents":   domain.FormatNodeChunks(run.documents, kb.AccessSettings.BaseURL),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("format messages failed: %w", err)
+	}
+	messages = slices.Insert(messages, 1, history[:len(history)-1]...)
+
+	tools := domain.AgentToolInfos()
+	calls := 0
+	for {
+		choice := schema.ToolChoiceAllowed
+		if calls >= settings.Steps() {
+			choice = schema.ToolChoiceForbidden
+		}
+		opts := []model.Option{model.WithTools(tools), model.WithToolChoice(choice)}
+		msg, err := u.streamToolRound(ctx, chatModel, messages, opts, true, usage, onChunk)
+		if err != nil {
+			return run.documents, err
+		}
+		if len(msg.ToolCalls) == 0 {
+			return run.documents, nil
+		}
+		messages = append(messages, schema.AssistantMessage(msg.Content, msg.ToolCalls))
+		for _, call := range msg.ToolCalls {
+			calls++
+			result := u.runAgentTool(ctx, run, call)
+			messages = append(messages, schema.ToolMessage(result, call.ID, schema.WithToolName(call.Function.Name)))
+		}
+	}
+}
+
+// rewriteQuestion asks the model for a standalone question and its sub-queries, failures
+// fall back to the question as it was asked.
+func (u *ChatUsecase) rewriteQuestion(ctx context.Context, chatModel model.BaseChatModel, history []*schema.Message, usage *schema.TokenUsage) *domain.AgentRewrite {
+	question := history[len(history)-1].Content
+	recent := history[max(0, len(history)-1-domain.AgentHistoryMessages):]
+	var conversation strings.Builder
+	for _, msg := range recent[:len(recent)-1] {
+		fmt.Fprintf(&conversation, "%s: %s\n", msg.Role, u.llmUsecase.trimThinking(msg.Content))
+	}
+	fmt.Fprintf(&conversation, "\n用户的最后一个问题：%s", question)
+
+	resp, err := chatModel.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(domain.AgentRewritePrompt),
+		schema.UserMessage(conversation.String()),
+	})
+	if err != nil {
+		u.logger.Warn("rewrite question failed, use the question as asked", log.Error(err))
+		return domain.ParseAgentRewrite("", question)
+	}
+	if resp.ResponseMeta != nil && resp.ResponseMeta.Usage != nil {
+		usage.PromptTokens += resp.ResponseMeta.Usage.PromptTokens
+		usage.CompletionTokens += resp.ResponseMeta.Usage.CompletionTokens
+		usage.TotalTokens += resp.ResponseMeta.Usage.TotalTokens
+	}
+	return domain.ParseAgentRewrite(u.llmUsecase.trimThinking(resp.Content), question)
+}
+
+// runAgentTool runs one tool call of the model and returns the tool result. Failures are
+// reported to the model as the result.
+func (u *ChatUsecase) runAgentTool(ctx context.Context, run *agentRun, call schema.ToolCall) string {
+	switch call.Function.Name {
+	case domain.KBSearchToolName:
+		var args domain.KBSearchArguments
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil || strings.TrimSpace(args.Query) == "" {
+			run.emit(domain.AgentStep{Type: domain.AgentStepSearch, Error: "invalid arguments"})
+			return "error: the query argument is required"
+		}
+		rankedNodes, err := u.agentSearch(ctx, run, strings.TrimSpace(args.Query))
+		if err != nil {
+			u.logger.Error("agent search failed", log.Error(err))
+			return "error: knowledge base search failed"
+		}
+		return "<documents>\n" + domain.FormatNodeChunks(rankedNodes, run.kb.AccessSettings.BaseURL) + "\n</documents>"
+	case domain.AgentOpenNodeToolName:
+		var args domain.AgentNodeArguments
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil || strings.TrimSpace(args.NodeID) == "" {
+			run.emit(domain.AgentStep{Type: domain.AgentStepOpenNode, Error: "invalid arguments"})
+			return "error: the node_id argument is required"
+		}
+		return u.agentOpenNode(ctx, run, strings.TrimSpace(args.NodeID))
+	case domain.AgentListChildrenToolName:
+		var args domain.AgentNodeArguments
+		if call.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+				run.emit(domain.AgentStep{Type: domain.AgentStepListChildren, Error: "invalid arguments"})
+				return "error: invalid arguments"
+			}
+		}
+		return u.agentListChildren(ctx, run, strings.TrimSpace(args.NodeID))
+	default:
+		return fmt.Sprintf("error: unknown tool %s", call.Function.Name)
+	}
+}
+
+func (u *ChatUsecase) agentSearch(ctx context.Context, run *agentRun, query string) ([]*domain.RankedNodeChunks, error) {
+	_, rankedNodes, err := u.llmUsecase.GetRankNodes(ctx, GetRankNodesRequest{
+		KBID:                run.kb.ID,
+		DatasetID:           run.kb.DatasetID,
+		Question:            query,
+		GroupIDs:            run.groupIDs,
+		SimilarityThreshold: 0.2,
+	})
+	if err != nil {
+		run.emit(domain.AgentStep{Type: domain.AgentStepSearch, Query: query, Error: "search failed"})
+		return nil, fmt.Errorf("get rank nodes failed: %w", err)
+	}
+	run.emit(domain.AgentStep{Type: domain.AgentStepSearch, Query: query, Results: len(rankedNodes)})
+	run.documents = append(run.documents, rankedNodes...)
+	u.sendChunkResults(run.eventCh, lo.Filter(rankedNodes, func(node *domain.RankedNodeChunks, _ int) bool {
+		return run.markFound(node.NodeID)
+	}))
+	return rankedNodes, nil
+}
+
+// markFound reports whether nodeID was not found before.
+func (r *agentRun) markFound(nodeID string) bool {
+	if r.found[nodeID] {
+		return false
+	}
+	r.found[nodeID] = true
+	return true
+}
+
+// agentOpenNode returns the released content of a node the user may ask about.
+func (u *ChatUsecase) agentOpenNode(ctx context.Context, run *agentRun, nodeID string) string {
+	node, err := u.nodeRepo.GetNodeReleaseDetailByKBIDAndID(ctx, run.kb.ID, nodeID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			u.logger.Error("agent open node failed", log.String("node_id", nodeID), log.Error(err))
+		}
+		run.emit(domain.AgentStep{Type: domain.AgentStepOpenNode, NodeID: nodeID, Error: "not found"})
+		return "error: document not found"
+	}
+	if !u.canAnswerFromNode(ctx, node.ID, node.Permissions, run.groupIDs) {
+		run.emit(domain.AgentStep{Type: domain.AgentStepOpenNode, NodeID: nodeID, Error: "not found"})
+		return "error: document not found"
+	}
+	if node.Type == domain.NodeTypeFolder {
+		run.emit(domain.AgentStep{Type: domain.AgentStepOpenNode, NodeID: nodeID, NodeName: node.Name})
+		return "this is a folder, use list_children to see its documents"
+	}
+
+	content := node.Content
+	if node.Meta.ContentType != domain.ContentTypeMD && utils.IsLikelyHTML(content) {
+		if markdown, err := u.mdConv.ConvertString(content); err == nil {
+			content = markdown
+		}
+	}
+	rankedNode := &domain.RankedNodeChunks{
+		NodeID:      node.ID,
+		NodeName:    node.Name,
+		NodeSummary: node.Meta.Summary,
+		NodeEmoji:   node.Meta.Emoji,
+		Chunks:      []*domain.NodeContentChunk{{Content: truncateRunes(content, agentNodeContentLimit)}},
+	}
+	run.emit(domain.AgentStep{Type: domain.AgentStepOpenNode, NodeID: nodeID, NodeName: node.Name, Results: 1})
+	run.documents = append(run.documents, rankedNode)
+	if run.markFound(node.ID) {
+		u.sendChunkResults(run.eventCh, []*domain.RankedNodeChunks{rankedNode})
+	}
+	return "<documents>\n" + domain.FormatNodeChunks([]*domain.RankedNodeChunks{rankedNode}, run.kb.AccessSettings.BaseURL) + "\n</documents>"
+}
+
+// agentListChildren lists the released nodes directly under nodeID, the top level when it
+// is empty.
+func (u *ChatUsecase) agentListChildren(ctx context.Context, run *agentRun, nodeID string) string {
+	items, err := u.nodeRepo.GetNodeReleaseListByKBID(ctx, run.kb.ID)
+	if err != nil {
+		u.logger.Error("agent list children failed", log.String("node_id", nodeID), log.Error(err))
+		run.emit(domain.AgentStep{Type: domain.AgentStepListChildren, NodeID: nodeID, Error: "list failed"})
+		return "error: list children failed"
+	}
+	children := lo.Filter(items, func(item *domain.ShareNodeListItemResp, _ int) bool {
+		return item.ParentID == nodeID && item.Permissions.Answerable != consts.NodeAccessPermClosed
+	})
+	slices.SortStableFunc(children, func(a, b *domain.ShareNodeListItemResp) int {
+		switch {
+		case a.Position < b.Position:
+			return -1
+		case a.Position > b.Position:
+			return 1
+		default:
+			return 0
+		}
+	})
+	children = children[:min(len(children), agentListChildrenMax)]
+
+	step := domain.AgentStep{Type: domain.AgentStepListChildren, NodeID: nodeID, Results: len(children)}
+	if parent, ok := lo.Find(items, func(item *domain.ShareNodeListItemResp) bool { return item.ID == nodeID }); ok {
+		step.NodeName = parent.Name
+	}
+	run.emit(step)
+	if len(children) == 0 {
+		return "no documents"
+	}
+	var result strings.Builder
+	for _, child := range children {
+		kind := "document"
+		if child.Type == domain.NodeTypeFolder {
+			kind = "folder"
+		}
+		fmt.Fprintf(&result, "- %s (ID: %s, %s)\n", child.Name, child.ID, kind)
+	}
+	return result.String()
+}
+
+// canAnswerFromNode checks the answerable permission of a node for the groups of the user.
+func (u *ChatUsecase) canAnswerFromNode(ctx context.Context, nodeID string, permissions domain.NodePermissions, groupIDs []int) bool {
+	switch permissions.Answerable {
+	case consts.NodeAccessPermClosed:
+		return false
+	case consts.NodeAccessPermPartial:
+		nodeGroups, err := u.nodeRepo.GetNodeGroupsByGroupIdsPerm(ctx, lo.Map(groupIDs, func(id int, _ int) uint {
+			return uint(id)
+		}), consts.NodePermNameAnswerable)
+		if err != nil {
+			u.logger.Error("get node groups failed", log.Error(err))
+			return false
+		}
+		return lo.ContainsBy(nodeGroups, func(group domain.NodeAuthGroup) bool { return group.NodeID == nodeID })
+	default:
+		return true
+	}
+}
@@ -0,0 +1,133 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+)
+
+// answerCacheLookup is the semantic cache lookup of one question, embedding is kept to store
+// the answer when there is no hit.
+type answerCacheLookup struct {
+	groupKey  string
+	embedding []float32
+	hit       *domain.AnswerCacheEntry
+}
+
+// lookupAnswerCache looks for a cached answer to req. It returns nil when the question can
+// not be cached: it is not the first of the conversation, has images or can not be embedded,
+// or the database has no vector extension.
+func (u *ChatUsecase) lookupAnswerCache(ctx context.Context, req *domain.ChatRequest, settings domain.AnswerCacheSettings, groupIDs []int) *answerCacheLookup {
+	if !u.answerCacheRepo.Enabled() || len(req.ImagePaths) > 0 || strings.TrimSpace(req.Message) == "" {
+		return nil
+	}
+	history, err := u.llmUsecase.GetConversationHistory(ctx, req.ConversationID)
+	if err != nil || len(history) != 1 {
+		return nil
+	}
+	vectors, _, _, err := u.modelUsecase.Embed(ctx, []string{req.Message})
+	if err != nil || len(vectors) == 0 {
+		u.logger.Warn("embed question for answer cache failed", log.Error(err))
+		return nil
+	}
+	lookup := &answerCacheLookup{groupKey: domain.AnswerCacheGroupKey(groupIDs), embedding: vectors[0]}
+
+	id, _, err := u.answerCacheRepo.FindSimilar(ctx, req.KBID, lookup.groupKey, time.Now().Add(-domain.AnswerCacheTTL), lookup.embedding, settings.MinSimilarity())
+	switch {
+	case err == nil:
+		lookup.hit = u.getFreshAnswerCacheEntry(ctx, id)
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		u.logger.Error("find answer cache entry failed", log.Error(err))
+		return nil
+	}
+	if err := u.answerCacheRepo.RecordLookup(ctx, req.KBID, lookup.hit); err != nil {
+		u.logger.Error("record answer cache lookup failed", log.Error(err))
+	}
+	return lookup
+}
+
+// getFreshAnswerCacheEntry returns the entry unless a node it was answered from changed,
+// stale entries are dropped.
+func (u *ChatUsecase) getFreshAnswerCacheEntry(ctx context.Context, id string) *domain.AnswerCacheEntry {
+	entry, err := u.answerCacheRepo.Get(ctx, id)
+	if err != nil {
+		u.logger.Error("get answer cache entry failed", log.Error(err))
+		return nil
+	}
+	stale, err := u.answerCacheRepo.IsStale(ctx, entry)
+	if err != nil {
+		u.logger.Error("check answer cache entry failed", log.Error(err))
+		return nil
+	}
+	if stale {
+		if err := u.answerCacheRepo.Delete(ctx, entry.ID); err != nil {
+			u.logger.Error("delete stale answer cache entry failed", log.Error(err))
+		}
+		return nil
+	}
+	return entry
+}
+
+// serveCachedAnswer sends the cached answer as if it was generated and saves it to the
+// conversation without token usage.
+func (u *ChatUsecase) serveCachedAnswer(ctx context.Context, req *domain.ChatRequest, entry *domain.AnswerCacheEntry, messageID, userMessageID string, eventCh chan<- domain.SSEEvent) {
+	for _, reference := range entry.References {
+		eventCh <- domain.SSEEvent{Type: "chunk_result", ChunkResult: reference}
+	}
+	eventCh <- domain.SSEEvent{Type: "data", Content: entry.Answer}
+	for _, citation := range entry.Citations {
+		eventCh <- domain.SSEEvent{Type: "citation", Citation: citation}
+	}
+	if err := u.conversationUsecase.CreateChatConversationMessage(ctx, req.KBID, &domain.ConversationMessage{
+		ID:             messageID,
+		ConversationID: req.ConversationID,
+		KBID:           req.KBID,
+		AppID:          req.AppID,
+		Role:           schema.Assistant,
+		Content:        entry.Answer,
+		Provider:       req.ModelInfo.Provider,
+		Model:          string(req.ModelInfo.Model),
+		RemoteIP:       req.RemoteIP,
+		ParentID:       userMessageID,
+		Citations:      entry.Citations,
+	}); err != nil {
+		u.logger.Error("failed to save assistant answer to conversation message", log.Error(err))
+		eventCh <- domain.SSEEvent{Type: "error", Content: "failed to save assistant answer to conversation message"}
+		return
+	}
+	eventCh <- domain.SSEEvent{Type: "usage", Usage: &domain.SSETokenUsage{}}
+	eventCh <- domain.SSEEvent{Type: "done"}
+}
+
+// storeAnswerCache caches a grounded answer for the question of lookup.
+func (u *ChatUsecase) storeAnswerCache(ctx context.Context, req *domain.ChatRequest, lookup *answerCacheLookup, answer string, rankedNodes []*domain.RankedNodeChunks, citations domain.AnswerCitations, usage *schema.TokenUsage) {
+	now := time.Now()
+	entry := &domain.AnswerCacheEntry{
+		ID:        uuid.New().String(),
+		KBID:      req.KBID,
+		GroupKey:  lookup.groupKey,
+		Question:  req.Message,
+		Embedding: lookup.embedding,
+		Answer:    answer,
+		NodeIDs: lo.Uniq(lo.Map(rankedNodes, func(node *domain.RankedNodeChunks, _ int) string {
+			return node.NodeID
+		})),
+		References:  domain.AnswerCacheReferencesOf(rankedNodes),
+		Citations:   citations,
+		TotalTokens: int64(usage.TotalTokens),
+		CreatedAt:   now,
+		LastHitAt:   now,
+	}
+	if err := u.answerCacheRepo.Create(ctx, entry); err != nil {
+		u.logger.Error("store answer cache failed", log.Error(err))
+	}
+}
@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+)
+
+// groundAnswerMessage grounds the saved answer messageID and records its citations.
+func (u *ChatUsecase) groundAnswerMessage(
+	ctx context.Context,
+	req *domain.ChatRequest,
+	chatModel model.BaseChatModel,
+	messageID string,
+	answer string,
+	rankedNodes []*domain.RankedNodeChunks,
+) domain.AnswerCitations {
+	usage := schema.TokenUsage{}
+	citations := u.groundAnswer(ctx, req.KBID, chatModel, answer, rankedNodes, &usage)
+	if usage.TotalTokens > 0 {
+		if err := u.modelUsecase.UpdateUsage(ctx, req.ModelInfo.ID, &usage); err != nil {
+			u.logger.Error("failed to update grounding model usage", log.Error(err))
+		}
+	}
+	if citations == nil {
+		return nil
+	}
+	if err := u.conversationUsecase.UpdateMessageCitations(ctx, messageID, citations); err != nil {
+		u.logger.Error("failed to save answer citations", log.String("message_id", messageID), log.Error(err))
+	}
+	return citations
+}
+
+// groundAnswer links each sentence of answer to the retrieved chunk that supports it and
+// flags the claims no chunk supports. It returns nil when there is nothing to ground or the
+// check fails, the answer then counts as grounded.
+func (u *ChatUsecase) groundAnswer(
+	ctx context.Context,
+	kbID string,
+	chatModel model.BaseChatModel,
+	answer string,
+	rankedNodes []*domain.RankedNodeChunks,
+	usage *schema.TokenUsage,
+) domain.AnswerCitations {
+	sentences := domain.AnswerSentences(answer)
+	if len(sentences) == 0 {
+		return nil
+	}
+	kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, kbID)
+	if err != nil {
+		u.logger.Error("get kb for grounding failed", log.Error(err))
+		return nil
+	}
+	chunks := domain.GroundingChunks(rankedNodes, kb.AccessSettings.BaseURL)
+
+	resp, err := chatModel.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(domain.GroundingPrompt),
+		schema.UserMessage(domain.BuildGroundingInput(sentences, chunks)),
+	})
+	if err != nil {
+		u.logger.Warn("ground answer failed", log.Error(err))
+		return nil
+	}
+	if resp.ResponseMeta != nil && resp.ResponseMeta.Usage != nil {
+		usage.PromptTokens += resp.ResponseMeta.Usage.PromptTokens
+		usage.CompletionTokens += resp.ResponseMeta.Usage.CompletionTokens
+		usage.TotalTokens += resp.ResponseMeta.Usage.TotalTokens
+	}
+	citations, err := domain.ParseGroundingJudgements(u.llmUsecase.trimThinking(resp.Content), sentences, chunks)
+	if err != nil {
+		u.logger.Warn("parse grounding answer failed", log.Error(err))
+		return nil
+	}
+	return citations
+}
@@ -0,0 +1,195 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/cloudwego/eino-ext/components/model/deepseek"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+)
+
+// openAIMaxToolRounds bounds the kb searches of one answer, the round after it has to answer
+// without tools.
+const openAIMaxToolRounds = 5
+
+// chatOpenAI answers an OpenAI-compatible request that has tools or a json response format.
+// kb searches are run here and fed back to the model, a round that calls client tools ends
+// the answer with those calls. It returns the finish reason.
+func (u *ChatUsecase) chatOpenAI(
+	ctx context.Context,
+	req *domain.ChatRequest,
+	chatModel model.BaseChatModel,
+	messages []*schema.Message,
+	groupIDs []int,
+	usage *schema.TokenUsage,
+	onChunk func(ctx context.Context, dataType, chunk string) error,
+	eventCh chan<- domain.SSEEvent,
+) (string, error) {
+	options := req.OpenAI
+	repaired := false
+	for round := 0; ; round++ {
+		msg, err := u.streamToolRound(ctx, chatModel, messages, openAIToolOptions(options, round), !options.WantsJSON(), usage, onChunk)
+		if err != nil {
+			return "", err
+		}
+
+		if len(msg.ToolCalls) > 0 {
+			clientCalls := lo.Filter(msg.ToolCalls, func(call schema.ToolCall, _ int) bool {
+				return call.Function.Name != domain.KBSearchToolName
+			})
+			if len(clientCalls) > 0 {
+				eventCh <- domain.SSEEvent{Type: "tool_call", ToolCalls: clientCalls}
+				return domain.OpenAIFinishReasonToolCalls, nil
+			}
+			messages = append(messages, schema.AssistantMessage(msg.Content, msg.ToolCalls))
+			for _, call := range msg.ToolCalls {
+				result := u.searchKB(ctx, req.KBID, groupIDs, call, eventCh)
+				messages = append(messages, schema.ToolMessage(result, call.ID, schema.WithToolName(call.Function.Name)))
+			}
+			continue
+		}
+
+		if !options.WantsJSON() {
+			return domain.OpenAIFinishReasonStop, nil
+		}
+		content := trimJSONCodeFence(u.llmUsecase.trimThinking(msg.Content))
+		validateErr := options.ValidateResponse(content)
+		if validateErr == nil {
+			if err := onChunk(ctx, "data", content); err != nil {
+				return "", err
+			}
+			return domain.OpenAIFinishReasonStop, nil
+		}
+		if repaired {
+			return "", fmt.Errorf("answer does not match response_format: %w", validateErr)
+		}
+		u.logger.Warn("answer does not match response_format, retrying", log.Error(validateErr))
+		repaired = true
+		messages = append(messages,
+			schema.AssistantMessage(msg.Content, nil),
+			schema.UserMessage(fmt.Sprintf(domain.OpenAIJSONRepairPrompt, validateErr)),
+		)
+	}
+}
+
+// openAIToolOptions binds the client tools and the kb search tool. tool_choice only applies
+// to the first round, later rounds follow up on kb searches and may answer freely.
+func openAIToolOptions(options *domain.OpenAIChatOptions, round int) []model.Option {
+	if !options.UseTools() {
+		return nil
+	}
+	tools := append(slices.Clone(options.Tools), domain.KBSearchToolInfo())
+	choice := schema.ToolChoiceAllowed
+	switch {
+	case round >= openAIMaxToolRounds:
+		choice = schema.ToolChoiceForbidden
+	case round == 0 && options.ForcedTool != "":
+		tools = lo.Filter(tools, func(tool *schema.ToolInfo, _ int) bool { return tool.Name == options.ForcedTool })
+		choice = schema.ToolChoiceForced
+	case round == 0 && options.ToolChoice == domain.OpenAIToolChoiceRequired:
+		choice = schema.ToolChoiceForced
+	}
+	return []model.Option{model.WithTools(tools), model.WithToolChoice(choice)}
+}
+
+// streamToolRound runs one model call and returns the whole message. Content goes to onChunk
+// as it arrives when stream is set, reasoning is not passed on.
+func (u *ChatUsecase) streamToolRound(
+	ctx context.Context,
+	chatModel model.BaseChatModel,
+	messages []*schema.Message,
+	opts []model.Option,
+	stream bool,
+	usage *schema.TokenUsage,
+	onChunk func(ctx context.Context, dataType, chunk string) error,
+) (*schema.Message, error) {
+	resp, err := chatModel.Stream(ctx, messages, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("stream failed: %w", err)
+	}
+	defer resp.Close()
+
+	chunks := make([]*schema.Message, 0)
+	var roundUsage *schema.TokenUsage
+	for {
+		msg, err := resp.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("recv failed: %w", err)
+		}
+		if msg.ResponseMeta != nil && msg.ResponseMeta.Usage != nil {
+			roundUsage = msg.ResponseMeta.Usage
+		}
+		if _, ok := deepseek.GetReasoningContent(msg); ok {
+			continue
+		}
+		if stream && msg.Content != "" {
+			if err := onChunk(ctx, "data", msg.Content); err != nil {
+				return nil, fmt.Errorf("on chunk data: %w", err)
+			}
+		}
+		chunks = append(chunks, msg)
+	}
+	if roundUsage != nil {
+		usage.PromptTokens += roundUsage.PromptTokens
+		usage.CompletionTokens += roundUsage.CompletionTokens
+		usage.TotalTokens += roundUsage.TotalTokens
+	}
+	if len(chunks) == 0 {
+		return schema.AssistantMessage("", nil), nil
+	}
+	msg, err := schema.ConcatMessages(chunks)
+	if err != nil {
+		return nil, fmt.Errorf("concat message failed: %w", err)
+	}
+	for i := range msg.ToolCalls {
+		if msg.ToolCalls[i].ID == "" {
+			msg.ToolCalls[i].ID = "call_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+		}
+		msg.ToolCalls[i].Type = "function"
+	}
+	return msg, nil
+}
+
+// searchKB answers a kb search tool call with the documents found for its query. Failures
+// are reported to the model as the tool result.
+func (u *ChatUsecase) searchKB(ctx context.Context, kbID string, groupIDs []int, call schema.ToolCall, eventCh chan<- domain.SSEEvent) string {
+	var args domain.KBSearchArguments
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil || strings.TrimSpace(args.Query) == "" {
+		return "error: the query argument is required"
+	}
+	kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, kbID)
+	if err != nil {
+		u.logger.Error("failed to get kb", log.Error(err))
+		return "error: knowledge base search failed"
+	}
+	_, rankedNodes, err := u.llmUsecase.GetRankNodes(ctx, GetRankNodesRequest{
+		KBID:                kbID,
+		DatasetID:           kb.DatasetID,
+		Question:            args.Query,
+		GroupIDs:            groupIDs,
+		SimilarityThreshold: 0.2,
+	})
+	if err != nil {
+		u.logger.Error("failed to get rank nodes", log.Error(err))
+		return "error: knowledge base search failed"
+	}
+	u.sendChunkResults(eventCh, rankedNodes)
+	if len(rankedNodes) == 0 {
+		return "<documents>\n</documents>"
+	}
+	return "<documents>\n" + domain.FormatNodeChunks(rankedNodes, kb.AccessSettings.BaseURL) + "\n</documents>"
+}
@@ -21,16 +21,18 @@ type CommentUsecase struct {
 	NodeRepo    *pg.NodeRepository
 	ipRepo      *ipdb.IPAddressRepo
 	authRepo    *pg.AuthRepo
+	webhook     *WebhookUsecase
 }
 
 func NewCommentUsecase(commentRepo *pg.CommentRepository, logger *log.Logger,
-	nodeRepo *pg.NodeRepository, ipRepo *ipdb.IPAddressRepo, authRepo *pg.AuthRepo) *CommentUsecase {
+	nodeRepo *pg.NodeRepository, ipRepo *ipdb.IPAddressRepo, authRepo *pg.AuthRepo, webhook *WebhookUsecase) *CommentUsecase {
 	return &CommentUsecase{
 		logger:      logger.WithModule("usecase.comment"),
 		CommentRepo: commentRepo,
 		NodeRepo:    nodeRepo,
 		ipRepo:      ipRepo,
 		authRepo:    authRepo,
+		webhook:     webhook,
 	}
 }
 
@@ -67,6 +69,14 @@ func (u *CommentUsecase) CreateComment(ctx context.Context, commentReq *domain.C
 	if err != nil {
 		return "", err
 	}
+	u.webhook.Dispatch(ctx, KbID, domain.WebhookEventCommentCreated, &domain.WebhookCommentData{
+		CommentID: CommentStr,
+		NodeID:    commentReq.NodeID,
+		ParentID:  commentReq.ParentID,
+		UserName:  commentReq.UserName,
+		Content:   commentReq.Content,
+		Status:    status,
+	})
 
 	// success
 	return CommentStr, nil
@@ -2,7 +2,10 @@ package usecase
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"regexp"
 	"time"
 
@@ -22,6 +25,8 @@ type ConversationUsecase struct {
 	logger       *log.Logger
 	ipRepo       *ipdb.IPAddressRepo
 	authRepo     *pg.AuthRepo
+	webhook      *WebhookUsecase
+	handoff      *HandoffUsecase
 }
 
 func NewConversationUsecase(
@@ -31,6 +36,8 @@ func NewConversationUsecase(
 	logger *log.Logger,
 	ipRepo *ipdb.IPAddressRepo,
 	authRepo *pg.AuthRepo,
+	webhook *WebhookUsecase,
+	handoff *HandoffUsecase,
 ) *ConversationUsecase {
 	return &ConversationUsecase{
 		repo:         repo,
@@ -38,6 +45,8 @@ func NewConversationUsecase(
 		geoCacheRepo: geoCacheRepo,
 		ipRepo:       ipRepo,
 		authRepo:     authRepo,
+		webhook:      webhook,
+		handoff:      handoff,
 		logger:       logger.WithModule("usecase.conversation"),
 	}
 }
@@ -47,6 +56,10 @@ func (u *ConversationUsecase) CreateChatConversationMessage(ctx context.Context,
 	return u.repo.CreateConversationMessage(ctx, conversation, references)
 }
 
+func (u *ConversationUsecase) UpdateMessageCitations(ctx context.Context, messageID string, citations domain.AnswerCitations) error {
+	return u.repo.UpdateMessageCitations(ctx, messageID, citations)
+}
+
 func (u *ConversationUsecase) GetConversationList(ctx context.Context, request *domain.ConversationListReq) (*domain.PaginatedResult[[]*domain.ConversationListItem], error) {
 	conversations, total, err := u.repo.GetConversationList(ctx, request)
 	if err != nil {
@@ -201,6 +214,15 @@ func (u *ConversationUsecase) FeedBack(ctx context.Context, feedback *domain.Fee
 		if err := u.repo.UpdateMessageFeedback(ctx, feedback); err != nil {
 			return err
 		}
+		if feedback.Score == domain.DisLike {
+			u.webhook.Dispatch(ctx, messages.KBID, domain.WebhookEventFeedbackNegative, &domain.WebhookFeedbackData{
+				ConversationID:  messages.ConversationID,
+				MessageID:       messages.ID,
+				Type:            feedback.Type,
+				FeedbackContent: feedback.FeedbackContent,
+			})
+			u.handoff.OnNegativeFeedback(ctx, messages)
+		}
 	} else {
 		return fmt.Errorf("already voted for this message, please do not vote again")
 	}
@@ -293,3 +315,78 @@ func (u *ConversationUsecase) GetShareConversationDetail(ctx context.Context, kb
 	conversation.Messages = messages
 	return &shareConversationDetail, nil
 }
+
+func (u *ConversationUsecase) GetRetentionSettings(ctx context.Context, kbID string) (*domain.ConversationRetentionSettings, error) {
+	return u.repo.GetRetentionSettings(ctx, kbID)
+}
+
+func (u *ConversationUsecase) UpdateRetentionSettings(ctx context.Context, kbID string, settings *domain.ConversationRetentionSettings) error {
+	if err := settings.Check(); err != nil {
+		return err
+	}
+	return u.repo.UpsertRetentionSettings(ctx, kbID, settings)
+}
+
+// ExportConversations writes the conversations matching req with their messages, feedback
+// and references to w, as jsonl with one conversation per line or as csv with one message
+// per row.
+func (u *ConversationUsecase) ExportConversations(ctx context.Context, req *domain.ConversationExportReq, w io.Writer) error {
+	var writeItem func(item *domain.ConversationExportItem) error
+	var flush func() error
+	switch req.Format {
+	case domain.ConversationExportFormatCSV:
+		csvWriter := csv.NewWriter(w)
+		if err := csvWriter.Write(domain.ConversationExportCSVHeader); err != nil {
+			return err
+		}
+		writeItem = func(item *domain.ConversationExportItem) error {
+			return domain.WriteConversationExportCSV(csvWriter, item)
+		}
+		flush = func() error {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+	default:
+		encoder := json.NewEncoder(w)
+		writeItem = func(item *domain.ConversationExportItem) error {
+			return encoder.Encode(item)
+		}
+		flush = func() error { return nil }
+	}
+
+	for offset := 0; ; offset += domain.ConversationExportBatchSize {
+		conversations, err := u.repo.GetConversationExportList(ctx, &req.ConversationListReq, offset, domain.ConversationExportBatchSize)
+		if err != nil {
+			return fmt.Errorf("get conversations failed: %w", err)
+		}
+		if len(conversations) == 0 {
+			return flush()
+		}
+		conversationIDs := lo.Map(conversations, func(c *domain.ConversationListItem, _ int) string { return c.ID })
+		messages, err := u.repo.GetConversationMessagesByIDs(ctx, conversationIDs)
+		if err != nil {
+			return fmt.Errorf("get conversation messages failed: %w", err)
+		}
+		references, err := u.repo.GetConversationReferencesByIDs(ctx, conversationIDs)
+		if err != nil {
+			return fmt.Errorf("get conversation references failed: %w", err)
+		}
+		messageMap := lo.GroupBy(messages, func(m *domain.ConversationMessage) string { return m.ConversationID })
+		referenceMap := lo.GroupBy(references, func(r *domain.ConversationReference) string { return r.ConversationID })
+		for _, conversation := range conversations {
+			if err := writeItem(&domain.ConversationExportItem{
+				ConversationListItem: conversation,
+				Messages:             lo.CoalesceSliceOrEmpty(messageMap[conversation.ID]),
+				References:           lo.CoalesceSliceOrEmpty(referenceMap[conversation.ID]),
+			}); err != nil {
+				return err
+			}
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if len(conversations) < domain.ConversationExportBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,575 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/pkg/gitsync"
+	"github.com/chaitin/panda-wiki/repo/pg"
+	"github.com/chaitin/panda-wiki/store/cache"
+	"github.com/chaitin/panda-wiki/store/rag"
+	"github.com/chaitin/panda-wiki/utils"
+)
+
+const (
+	gitSyncLockTTL     = 30 * time.Minute
+	gitSyncAuthorName  = "PandaWiki"
+	gitSyncAuthorEmail = "panda-wiki@localhost"
+)
+
+// GitSyncUsecase keeps a knowledge base in sync with a git repository of markdown docs.
+// Folders map to folder nodes and .md files to document nodes, keyed by their path in the repository.
+type GitSyncUsecase struct {
+	repo        *pg.GitSyncRepository
+	nodeRepo    *pg.NodeRepository
+	kbRepo      *pg.KnowledgeBaseRepository
+	nodeUsecase *NodeUsecase
+	cache       *cache.Cache
+	mdConv      *converter.Converter
+	logger      *log.Logger
+}
+
+func NewGitSyncUsecase(
+	repo *pg.GitSyncRepository,
+	nodeRepo *pg.NodeRepository,
+	kbRepo *pg.KnowledgeBaseRepository,
+	nodeUsecase *NodeUsecase,
+	cache *cache.Cache,
+	logger *log.Logger,
+) *GitSyncUsecase {
+	return &GitSyncUsecase{
+		repo:        repo,
+		nodeRepo:    nodeRepo,
+		kbRepo:      kbRepo,
+		nodeUsecase: nodeUsecase,
+		cache:       cache,
+		mdConv:      rag.NewHTML2MDConverter(),
+		logger:      logger.WithModule("usecase.git_sync"),
+	}
+}
+
+func (u *GitSyncUsecase) GetSettings(ctx context.Context, kbID string) (*domain.GitSyncSettingsResp, error) {
+	settings, err := u.repo.GetSettings(ctx, kbID)
+	if err != nil {
+		return nil, err
+	}
+	resp := &domain.GitSyncSettingsResp{GitSyncSettings: *settings, HasToken: settings.Token != ""}
+	resp.Token = ""
+	return resp, nil
+}
+
+func (u *GitSyncUsecase) UpdateSettings(ctx context.Context, req *domain.UpdateGitSyncSettingsReq) error {
+	settings := req.GitSyncSettings
+	if settings.RepoURL != "" {
+		if err := validateGitSyncURL(settings.RepoURL); err != nil {
+			return err
+		}
+	} else if settings.Enabled {
+		return fmt.Errorf("repository url is required to enable sync")
+	}
+	if settings.Token == "" {
+		old, err := u.repo.GetSettings(ctx, req.KBID)
+		if err != nil {
+			return err
+		}
+		settings.Token = old.Token
+	}
+	return u.repo.UpsertSettings(ctx, req.KBID, &settings)
+}
+
+func (u *GitSyncUsecase) ListRuns(ctx context.Context, req *domain.GitSyncRunListReq) (*domain.PaginatedResult[[]*domain.GitSyncRun], error) {
+	total, runs, err := u.repo.ListRuns(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewPaginatedResult(runs, uint64(total)), nil
+}
+
+// SyncDue imports every enabled kb whose last import is older than its interval.
+func (u *GitSyncUsecase) SyncDue(ctx context.Context) error {
+	settings, err := u.repo.ListEnabledSettings(ctx)
+	if err != nil {
+		return err
+	}
+	lastRuns, err := u.repo.GetLatestRunTimes(ctx, domain.GitSyncDirectionImport)
+	if err != nil {
+		return err
+	}
+	for kbID, s := range settings {
+		if last, ok := lastRuns[kbID]; ok && time.Since(last) < s.Interval() {
+			continue
+		}
+		if _, err := u.Import(ctx, kbID, domain.GitSyncTriggerSchedule, ""); err != nil && !errors.Is(err, domain.ErrGitSyncRunning) {
+			u.logger.Error("scheduled git sync failed", log.String("kb_id", kbID), log.Error(err))
+		}
+	}
+	return nil
+}
+
+// Import pulls the repository into the kb. Git is the source of truth: docs whose file changed
+// overwrite the node, and nodes whose path disappeared from the repository are deleted.
+func (u *GitSyncUsecase) Import(ctx context.Context, kbID string, trigger domain.GitSyncTrigger, userID string) (*domain.GitSyncRun, error) {
+	return u.run(ctx, kbID, domain.GitSyncDirectionImport, trigger, "", func(repo *gitsync.Repo, root string, run *domain.GitSyncRun) error {
+		entries, err := gitsync.Scan(root)
+		if err != nil {
+			return err
+		}
+		mappings, err := u.repo.GetNodes(ctx, kbID)
+		if err != nil {
+			return err
+		}
+		nodes, err := u.nodeRepo.GetNodesByIDs(ctx, lo.MapToSlice(mappings, func(_ string, m *domain.GitSyncNode) string {
+			return m.NodeID
+		}))
+		if err != nil {
+			return err
+		}
+		if run.Commit, err = repo.Head(ctx); err != nil {
+			return err
+		}
+
+		nodeIDs := make(map[string]string, len(entries))
+		synced := make([]*domain.GitSyncNode, 0, len(entries))
+		for _, entry := range entries {
+			parentID := nodeIDs[entry.Parent]
+			var node *domain.Node
+			if m, ok := mappings[entry.Path]; ok {
+				if n, ok := nodes[m.NodeID]; ok && n.KBID == kbID {
+					node = n
+				}
+			}
+
+			var diffType domain.KBReleaseDocDiffType
+			if node == nil {
+				nodeID, err := u.createNode(ctx, kbID, parentID, entry, userID)
+				if err != nil {
+					return fmt.Errorf("create node for %s: %w", entry.Path, err)
+				}
+				// map the node right away, a run failing later on must not leave it to be created again
+				if err := u.repo.SaveNode(ctx, &domain.GitSyncNode{
+					KBID:      kbID,
+					Path:      entry.Path,
+					NodeID:    nodeID,
+					Hash:      entry.Hash,
+					UpdatedAt: time.Now(),
+				}); err != nil {
+					return fmt.Errorf("map node for %s: %w", entry.Path, err)
+				}
+				nodeIDs[entry.Path] = nodeID
+				diffType = domain.KBReleaseDocDiffAdded
+			} else {
+				nodeIDs[entry.Path] = node.ID
+				changed, err := u.updateNode(ctx, node, mappings[entry.Path], parentID, entry, userID)
+				if err != nil {
+					return fmt.Errorf("update node for %s: %w", entry.Path, err)
+				}
+				diffType = domain.KBReleaseDocDiffUnchanged
+				if changed {
+					diffType = domain.KBReleaseDocDiffChanged
+				}
+			}
+			synced = append(synced, &domain.GitSyncNode{
+				KBID:      kbID,
+				Path:      entry.Path,
+				NodeID:    nodeIDs[entry.Path],
+				Hash:      entry.Hash,
+				UpdatedAt: time.Now(),
+			})
+			if !entry.IsDir {
+				run.Result.Add(&domain.GitSyncDiffItem{Path: entry.Path, NodeID: nodeIDs[entry.Path], Name: entry.Name, DiffType: diffType})
+			}
+		}
+
+		removedIDs := make([]string, 0)
+		for p, m := range mappings {
+			if _, ok := nodeIDs[p]; ok {
+				continue
+			}
+			node, ok := nodes[m.NodeID]
+			if !ok || node.KBID != kbID {
+				continue
+			}
+			removedIDs = append(removedIDs, node.ID)
+			if node.Type == domain.NodeTypeDocument {
+				run.Result.Add(&domain.GitSyncDiffItem{Path: p, NodeID: node.ID, Name: node.Name, DiffType: domain.KBReleaseDocDiffRemoved})
+			}
+		}
+		if len(removedIDs) > 0 {
+			if err := u.nodeUsecase.NodeAction(ctx, &domain.NodeActionReq{KBID: kbID, IDs: removedIDs, Action: "delete"}); err != nil {
+				return err
+			}
+		}
+		return u.repo.ReplaceNodes(ctx, kbID, synced)
+	})
+}
+
+func (u *GitSyncUsecase) createNode(ctx context.Context, kbID, parentID string, entry *gitsync.Entry, userID string) (string, error) {
+	req := &domain.CreateNodeReq{
+		KBID:     kbID,
+		ParentID: parentID,
+		Type:     domain.NodeTypeFolder,
+		Name:     entry.Name,
+		Emoji:    entry.Emoji,
+		Position: lo.ToPtr(entry.Position),
+	}
+	if !entry.IsDir {
+		req.Type = domain.NodeTypeDocument
+		req.Content = entry.Content
+		req.ContentType = lo.ToPtr(domain.ContentTypeMD)
+	}
+	return u.nodeUsecase.Create(ctx, req, userID)
+}
+
+// updateNode applies entry to an already synced node and reports whether anything changed.
+// Docs are only rewritten when their file changed, so edits made in the wiki survive until then.
+func (u *GitSyncUsecase) updateNode(ctx context.Context, node *domain.Node, mapping *domain.GitSyncNode, parentID string, entry *gitsync.Entry, userID string) (bool, error) {
+	moved := node.ParentID != parentID
+	if moved {
+		if err := u.nodeRepo.UpdateNodeByKbID(ctx, node.ID, node.KBID, map[string]any{"parent_id": parentID}); err != nil {
+			return false, err
+		}
+	}
+	req := &domain.UpdateNodeReq{ID: node.ID, KBID: node.KBID}
+	if entry.IsDir {
+		if node.Name == entry.Name {
+			return moved, nil
+		}
+		req.Name = lo.ToPtr(entry.Name)
+	} else {
+		if mapping.Hash == entry.Hash {
+			return moved, nil
+		}
+		req.Name = lo.ToPtr(entry.Name)
+		req.Content = lo.ToPtr(entry.Content)
+		req.Emoji = lo.ToPtr(entry.Emoji)
+		req.Position = lo.ToPtr(entry.Position)
+		req.ContentType = lo.ToPtr(domain.ContentTypeMD)
+	}
+	if _, err := u.nodeUsecase.Update(ctx, req, userID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Export writes the docs of a kb release into the repository and pushes them as one commit.
+// Only files created by the sync are removed, other files in the repository are left alone.
+func (u *GitSyncUsecase) Export(ctx context.Context, kbID, releaseID string, trigger domain.GitSyncTrigger) (*domain.GitSyncRun, error) {
+	release, err := u.kbRepo.GetKBReleaseByID(ctx, kbID, releaseID)
+	if err != nil {
+		return nil, err
+	}
+	return u.run(ctx, kbID, domain.GitSyncDirectionExport, trigger, releaseID, func(repo *gitsync.Repo, root string, run *domain.GitSyncRun) error {
+		_, docs, _, err := u.kbRepo.GetKBReleaseDocs(ctx, kbID, releaseID)
+		if err != nil {
+			return err
+		}
+		nodeReleases, err := u.nodeRepo.GetNodeReleasesByIDs(ctx, lo.Map(docs, func(doc *domain.KBReleaseDocItem, _ int) string {
+			return doc.NodeReleaseID
+		}))
+		if err != nil {
+			return err
+		}
+		mappings, err := u.repo.GetNodes(ctx, kbID)
+		if err != nil {
+			return err
+		}
+		files := exportPaths(nodeReleases, mappings)
+
+		// drop managed files that are no longer part of the release, deepest first
+		stale := make([]string, 0)
+		for p := range mappings {
+			if f, ok := files[mappings[p].NodeID]; !ok || f.path != p {
+				stale = append(stale, p)
+			}
+		}
+		sort.Slice(stale, func(i, j int) bool { return len(stale[i]) > len(stale[j]) })
+		for _, p := range stale {
+			full := filepath.Join(root, filepath.FromSlash(p))
+			info, err := os.Stat(full)
+			if err != nil {
+				continue
+			}
+			if info.IsDir() {
+				_ = os.Remove(full) // only succeeds once the folder is empty
+			} else if err := os.Remove(full); err != nil {
+				return err
+			}
+		}
+
+		synced := make([]*domain.GitSyncNode, 0, len(files))
+		byPath := make(map[string]*domain.NodeRelease, len(files))
+		for _, f := range files {
+			full := filepath.Join(root, filepath.FromSlash(f.path))
+			hash := ""
+			if f.node.Type == domain.NodeTypeFolder {
+				if err := os.MkdirAll(full, 0o755); err != nil {
+					return err
+				}
+			} else {
+				raw, err := u.renderDoc(f)
+				if err != nil {
+					return fmt.Errorf("render %s: %w", f.path, err)
+				}
+				if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+					return err
+				}
+				if err := os.WriteFile(full, raw, 0o644); err != nil {
+					return err
+				}
+				hash = gitsync.HashContent(raw)
+				byPath[f.path] = f.node
+			}
+			synced = append(synced, &domain.GitSyncNode{
+				KBID:      kbID,
+				Path:      f.path,
+				NodeID:    f.node.NodeID,
+				Hash:      hash,
+				UpdatedAt: time.Now(),
+			})
+		}
+
+		settings, err := u.repo.GetSettings(ctx, kbID)
+		if err != nil {
+			return err
+		}
+		message := fmt.Sprintf("Release %s", release.Tag)
+		if release.Message != "" {
+			message += ": " + release.Message
+		}
+		commit, changes, err := repo.CommitAll(ctx, message,
+			lo.CoalesceOrEmpty(settings.AuthorName, gitSyncAuthorName),
+			lo.CoalesceOrEmpty(settings.AuthorEmail, gitSyncAuthorEmail))
+		if err != nil {
+			return err
+		}
+		if commit != "" {
+			if err := repo.Push(ctx); err != nil {
+				return err
+			}
+			run.Commit = commit
+		} else if run.Commit, err = repo.Head(ctx); err != nil {
+			return err
+		}
+
+		prefix, err := filepath.Rel(repo.Dir, root)
+		if err != nil {
+			return err
+		}
+		changed := make(map[string]gitsync.ChangeType, len(changes))
+		for _, change := range changes {
+			p := change.Path
+			if prefix != "." {
+				var ok bool
+				if p, ok = strings.CutPrefix(p, filepath.ToSlash(prefix)+"/"); !ok {
+					continue
+				}
+			}
+			changed[p] = change.Type
+		}
+		for p, node := range byPath {
+			item := &domain.GitSyncDiffItem{Path: p, NodeID: node.NodeID, Name: node.Name, DiffType: domain.KBReleaseDocDiffUnchanged}
+			switch changed[p] {
+			case gitsync.ChangeAdded:
+				item.DiffType = domain.KBReleaseDocDiffAdded
+			case gitsync.ChangeModified:
+				item.DiffType = domain.KBReleaseDocDiffChanged
+			}
+			run.Result.Add(item)
+		}
+		for p, changeType := range changed {
+			if changeType != gitsync.ChangeDeleted || !strings.EqualFold(path.Ext(p), ".md") {
+				continue
+			}
+			item := &domain.GitSyncDiffItem{Path: p, Name: strings.TrimSuffix(path.Base(p), path.Ext(p)), DiffType: domain.KBReleaseDocDiffRemoved}
+			if m, ok := mappings[p]; ok {
+				item.NodeID = m.NodeID
+			}
+			run.Result.Add(item)
+		}
+		sort.Slice(run.Result.Diff, func(i, j int) bool { return run.Result.Diff[i].Path < run.Result.Diff[j].Path })
+
+		return u.repo.ReplaceNodes(ctx, kbID, synced)
+	})
+}
+
+type exportFile struct {
+	path  string
+	order int
+	node  *domain.NodeRelease
+}
+
+// exportPaths lays out release nodes as repository paths. A node keeps its previous file name while
+// it stays in the same folder, so renames in the wiki don't churn the history.
+func exportPaths(nodes []*domain.NodeRelease, mappings map[string]*domain.GitSyncNode) map[string]*exportFile {
+	byID := make(map[string]*domain.NodeRelease, len(nodes))
+	for _, node := range nodes {
+		byID[node.NodeID] = node
+	}
+	previous := make(map[string]string, len(mappings))
+	for p, m := range mappings {
+		previous[m.NodeID] = p
+	}
+	children := make(map[string][]*domain.NodeRelease)
+	for _, node := range nodes {
+		parentID := node.ParentID
+		if _, ok := byID[parentID]; !ok {
+			parentID = ""
+		}
+		children[parentID] = append(children[parentID], node)
+	}
+
+	files := make(map[string]*exportFile, len(nodes))
+	var walk func(parentID, dir string)
+	walk = func(parentID, dir string) {
+		siblings := children[parentID]
+		sort.SliceStable(siblings, func(i, j int) bool {
+			if siblings[i].Position != siblings[j].Position {
+				return siblings[i].Position < siblings[j].Position
+			}
+			return siblings[i].Name < siblings[j].Name
+		})
+		used := make(map[string]bool, len(siblings))
+		for i, node := range siblings {
+			ext := ""
+			if node.Type == domain.NodeTypeDocument {
+				ext = ".md"
+			}
+			base := gitsync.FileName(node.Name) + ext
+			if p, ok := previous[node.NodeID]; ok && path.Dir(p) == lo.CoalesceOrEmpty(dir, ".") && !used[strings.ToLower(path.Base(p))] {
+				base = path.Base(p)
+			}
+			for n := 2; used[strings.ToLower(base)]; n++ {
+				base = fmt.Sprintf("%s (%d)%s", gitsync.FileName(node.Name), n, ext)
+			}
+			used[strings.ToLower(base)] = true
+			p := path.Join(dir, base)
+			files[node.NodeID] = &exportFile{path: p, order: i, node: node}
+			if node.Type == domain.NodeTypeFolder {
+				walk(node.NodeID, p)
+			}
+		}
+	}
+	walk("", "")
+	return files
+}
+
+func (u *GitSyncUsecase) renderDoc(f *exportFile) ([]byte, error) {
+	content := f.node.Content
+	if f.node.Meta.ContentType != domain.ContentTypeMD {
+		md, err := u.mdConv.ConvertString(content)
+		if err != nil {
+			return nil, err
+		}
+		content = md
+	}
+	order := float64(f.order)
+	return gitsync.RenderDoc(gitsync.FrontMatter{
+		Title: f.node.Name,
+		Order: &order,
+		Emoji: f.node.Meta.Emoji,
+	}, content)
+}
+
+// run clones the repository, calls fn with the sync root and records the outcome as a sync run.
+// Only one sync per kb runs at a time.
+func (u *GitSyncUsecase) run(ctx context.Context, kbID string, direction domain.GitSyncDirection, trigger domain.GitSyncTrigger, releaseID string,
+	fn func(repo *gitsync.Repo, root string, run *domain.GitSyncRun) error,
+) (*domain.GitSyncRun, error) {
+	settings, err := u.repo.GetSettings(ctx, kbID)
+	if err != nil {
+		return nil, err
+	}
+	if settings.RepoURL == "" {
+		return nil, fmt.Errorf("git sync is not configured")
+	}
+
+	lockKey := fmt.Sprintf("git_sync:lock:%s", kbID)
+	locked, err := u.cache.SetNX(ctx, lockKey, 1, gitSyncLockTTL).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, domain.ErrGitSyncRunning
+	}
+	defer u.cache.Del(context.Background(), lockKey)
+
+	run := &domain.GitSyncRun{
+		ID:        uuid.New().String(),
+		KBID:      kbID,
+		Direction: direction,
+		Trigger:   trigger,
+		ReleaseID: releaseID,
+		Status:    domain.GitSyncStatusRunning,
+		CreatedAt: time.Now(),
+	}
+	if err := u.repo.CreateRun(ctx, run); err != nil {
+		return nil, err
+	}
+
+	runErr := u.syncRepo(ctx, settings, run, fn)
+	run.Status = domain.GitSyncStatusSuccess
+	if runErr != nil {
+		run.Status = domain.GitSyncStatusFailed
+		run.Error = runErr.Error()
+	}
+	run.FinishedAt = lo.ToPtr(time.Now())
+	if err := u.repo.UpdateRun(ctx, run); err != nil {
+		u.logger.Error("update git sync run failed", log.String("run_id", run.ID), log.Error(err))
+	}
+	if runErr != nil {
+		return run, runErr
+	}
+	return run, nil
+}
+
+func (u *GitSyncUsecase) syncRepo(ctx context.Context, settings *domain.GitSyncSettings, run *domain.GitSyncRun,
+	fn func(repo *gitsync.Repo, root string, run *domain.GitSyncRun) error,
+) error {
+	// the host may resolve to an internal address by now
+	if err := validateGitSyncURL(settings.RepoURL); err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "panda-wiki-git-sync-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	repo, err := gitsync.Clone(ctx, gitsync.Options{
+		URL:      settings.RepoURL,
+		Branch:   settings.Branch,
+		Username: settings.Username,
+		Token:    settings.Token,
+	}, filepath.Join(dir, "repo"))
+	if err != nil {
+		return err
+	}
+	// cleaning against "/" keeps the sub dir inside the working copy
+	root := filepath.Join(repo.Dir, filepath.FromSlash(path.Clean("/"+settings.SubDir)))
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return err
+	}
+	return fn(repo, root, run)
+}
+
+// validateGitSyncURL only lets a sync clone public http(s) hosts, the content of the repository
+// ends up in the kb.
+func validateGitSyncURL(raw string) error {
+	if err := gitsync.ValidateURL(raw); err != nil {
+		return err
+	}
+	return utils.ValidateURLForSSRF(strings.TrimSpace(raw))
+}
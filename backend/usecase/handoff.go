@@ -0,0 +1,296 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/pkg/bot"
+	"github.com/chaitin/panda-wiki/repo/pg"
+)
+
+// HandoffUsecase escalates bot conversations to human agents. Bots ask it before a question
+// reaches the AI and after it was answered, the agents reply from the admin console through
+// the senders the bots register when they start.
+type HandoffUsecase struct {
+	repo        *pg.HandoffRepository
+	convRepo    *pg.ConversationRepository
+	appRepo     *pg.AppRepository
+	webhook     *WebhookUsecase
+	pushUsecase *PushUsecase
+	logger      *log.Logger
+	mu          sync.RWMutex
+	senders     map[string]bot.MessageSender // appID → sender
+}
+
+func NewHandoffUsecase(
+	repo *pg.HandoffRepository,
+	convRepo *pg.ConversationRepository,
+	appRepo *pg.AppRepository,
+	webhook *WebhookUsecase,
+	pushUsecase *PushUsecase,
+	logger *log.Logger,
+) *HandoffUsecase {
+	return &HandoffUsecase{
+		repo:        repo,
+		convRepo:    convRepo,
+		appRepo:     appRepo,
+		webhook:     webhook,
+		pushUsecase: pushUsecase,
+		logger:      logger.WithModule("usecase.handoff"),
+		senders:     make(map[string]bot.MessageSender),
+	}
+}
+
+// RegisterSender registers the sender of human replies for an app.
+// Called by AppUsecase when a bot starts.
+func (u *HandoffUsecase) RegisterSender(appID string, sender bot.MessageSender) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.senders[appID] = sender
+}
+
+func (u *HandoffUsecase) UnregisterSender(appID string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.senders, appID)
+}
+
+// Intercept runs before a bot question reaches the AI. It returns the notice to answer with
+// and true when the user is handed off, either already or by a keyword of the question.
+func (u *HandoffUsecase) Intercept(ctx context.Context, kbID string, appType domain.AppType, question string, info domain.ConversationInfo) (string, bool) {
+	if info.ChannelID == "" {
+		return "", false
+	}
+	app, err := u.appRepo.GetOrCreateAppByKBIDAndType(ctx, kbID, appType)
+	if err != nil {
+		u.logger.Error("get bot app failed", log.String("kb_id", kbID), log.Error(err))
+		return "", false
+	}
+	settings := app.Settings.HandoffSettings
+	if !settings.IsEnabled {
+		return "", false
+	}
+
+	handoff, err := u.repo.GetPending(ctx, app.ID, info.ChannelID, info.UserInfo.UserID)
+	switch {
+	case err == nil:
+		if err := u.repo.AddMessage(ctx, newHandoffMessage(handoff.ID, domain.HandoffMessageRoleUser, question, "")); err != nil {
+			u.logger.Error("add handoff message failed", log.String("handoff_id", handoff.ID), log.Error(err))
+		}
+		return settings.NoticeText(), true
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		u.logger.Error("get pending handoff failed", log.String("app_id", app.ID), log.Error(err))
+		return "", false
+	}
+
+	if !settings.MatchKeyword(question) {
+		return "", false
+	}
+	u.start(ctx, app, info, "", domain.HandoffReasonKeyword, question)
+	return settings.NoticeText(), true
+}
+
+// CheckAnswer runs after the AI answered a bot question. It hands the user off when
+// retrieval found too little for the answer and returns the notice to append to it.
+func (u *HandoffUsecase) CheckAnswer(ctx context.Context, kbID string, appType domain.AppType, question string, info domain.ConversationInfo, messageID string) string {
+	if info.ChannelID == "" || messageID == "" {
+		return ""
+	}
+	app, err := u.appRepo.GetOrCreateAppByKBIDAndType(ctx, kbID, appType)
+	if err != nil {
+		u.logger.Error("get bot app failed", log.String("kb_id", kbID), log.Error(err))
+		return ""
+	}
+	settings := app.Settings.HandoffSettings
+	if !settings.IsEnabled || settings.MinRetrievedChunks <= 0 {
+		return ""
+	}
+	message, err := u.convRepo.GetConversationMessagesDetailByID(ctx, messageID)
+	if err != nil {
+		u.logger.Error("get answer message failed", log.String("message_id", messageID), log.Error(err))
+		return ""
+	}
+	if !settings.LowConfidence(message.RetrievedChunks) {
+		return ""
+	}
+	if !u.start(ctx, app, info, message.ConversationID, domain.HandoffReasonLowConfidence, question) {
+		return ""
+	}
+	return settings.NoticeText()
+}
+
+// OnNegativeFeedback hands the user of a bot conversation off once they disliked
+// DislikeThreshold answers within HandoffDislikeWindow. The notice is pushed through the bot
+// as the answer was already delivered.
+func (u *HandoffUsecase) OnNegativeFeedback(ctx context.Context, message *domain.ConversationMessage) {
+	conversation, err := u.convRepo.GetConversationByID(ctx, message.ConversationID)
+	if err != nil {
+		u.logger.Error("get feedback conversation failed", log.String("conversation_id", message.ConversationID), log.Error(err))
+		return
+	}
+	if conversation.Info.ChannelID == "" {
+		return
+	}
+	app, err := u.appRepo.GetAppDetail(ctx, conversation.AppID)
+	if err != nil {
+		u.logger.Error("get bot app failed", log.String("app_id", conversation.AppID), log.Error(err))
+		return
+	}
+	settings := app.Settings.HandoffSettings
+	if !settings.IsEnabled || settings.DislikeThreshold <= 0 {
+		return
+	}
+	info := conversation.Info
+	count, err := u.repo.CountDislikes(ctx, app.ID, info.ChannelID, info.UserInfo.UserID, time.Now().Add(-domain.HandoffDislikeWindow))
+	if err != nil {
+		u.logger.Error("count handoff dislikes failed", log.String("app_id", app.ID), log.Error(err))
+		return
+	}
+	if count < int64(settings.DislikeThreshold) {
+		return
+	}
+	if !u.start(ctx, app, info, conversation.ID, domain.HandoffReasonNegativeFeedback, conversation.Subject) {
+		return
+	}
+	if err := u.send(ctx, app.ID, info.ChannelID, settings.NoticeText()); err != nil {
+		u.logger.Warn("send handoff notice failed", log.String("app_id", app.ID), log.Error(err))
+	}
+}
+
+// start creates the handoff and notifies the agents, it returns false when the user was
+// already handed off.
+func (u *HandoffUsecase) start(ctx context.Context, app *domain.App, info domain.ConversationInfo, conversationID string, reason domain.HandoffReason, question string) bool {
+	now := time.Now()
+	handoff := &domain.ConversationHandoff{
+		ID:             uuid.New().String(),
+		KBID:           app.KBID,
+		AppID:          app.ID,
+		AppType:        app.Type,
+		ChannelID:      info.ChannelID,
+		RemoteUserID:   info.UserInfo.UserID,
+		Nickname:       info.UserInfo.NickName,
+		Avatar:         info.UserInfo.Avatar,
+		ConversationID: conversationID,
+		Reason:         reason,
+		Question:       question,
+		Status:         domain.HandoffStatusPending,
+		LastMessageAt:  now,
+		CreatedAt:      now,
+	}
+	created, err := u.repo.Create(ctx, handoff, newHandoffMessage(handoff.ID, domain.HandoffMessageRoleUser, question, ""))
+	if err != nil {
+		u.logger.Error("create handoff failed", log.String("app_id", app.ID), log.Error(err))
+		return false
+	}
+	if !created {
+		return false
+	}
+	u.logger.Info("conversation handed off", log.String("handoff_id", handoff.ID), log.String("app_id", app.ID), log.String("reason", string(reason)))
+
+	u.webhook.Dispatch(ctx, app.KBID, domain.WebhookEventHandoffRequested, &domain.WebhookHandoffData{
+		HandoffID:      handoff.ID,
+		ConversationID: conversationID,
+		AppType:        app.Type,
+		Reason:         reason,
+		Question:       question,
+		Nickname:       handoff.Nickname,
+	})
+	if chatIDs := app.Settings.HandoffSettings.NotifyChatIDs; chatIDs != "" {
+		go u.pushUsecase.PushToChats(context.Background(), app.ID, chatIDs, handoff.NotifyText())
+	}
+	return true
+}
+
+func (u *HandoffUsecase) List(ctx context.Context, req *domain.HandoffListReq) (*domain.HandoffListResp, error) {
+	total, handoffs, err := u.repo.List(ctx, req.KBID, req.Status, req.Offset(), req.Limit())
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewPaginatedResult(handoffs, uint64(total)), nil
+}
+
+func (u *HandoffUsecase) Detail(ctx context.Context, kbID, id string) (*domain.HandoffDetailResp, error) {
+	handoff, err := u.repo.Get(ctx, kbID, id)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := u.repo.ListMessages(ctx, handoff.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.HandoffDetailResp{Handoff: handoff, Messages: messages}, nil
+}
+
+// Reply delivers the reply of an agent through the bot the user talks to.
+func (u *HandoffUsecase) Reply(ctx context.Context, req *domain.HandoffReplyReq, userID string) (*domain.HandoffMessage, error) {
+	handoff, err := u.repo.Get(ctx, req.KBID, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if handoff.Status != domain.HandoffStatusPending {
+		return nil, domain.ErrHandoffReleased
+	}
+	if err := u.send(ctx, handoff.AppID, handoff.ChannelID, req.Content); err != nil {
+		return nil, err
+	}
+	message := newHandoffMessage(handoff.ID, domain.HandoffMessageRoleAgent, req.Content, userID)
+	if err := u.repo.AddMessage(ctx, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// Release hands the user back to the AI.
+func (u *HandoffUsecase) Release(ctx context.Context, kbID, id, userID string) error {
+	handoff, err := u.repo.Get(ctx, kbID, id)
+	if err != nil {
+		return err
+	}
+	released, err := u.repo.Release(ctx, handoff.ID, userID)
+	if err != nil {
+		return err
+	}
+	if !released {
+		return domain.ErrHandoffReleased
+	}
+	if err := u.send(ctx, handoff.AppID, handoff.ChannelID, domain.HandoffReleaseNotice); err != nil {
+		u.logger.Warn("send handoff release notice failed", log.String("handoff_id", handoff.ID), log.Error(err))
+	}
+	return nil
+}
+
+func (u *HandoffUsecase) send(ctx context.Context, appID, channelID, content string) error {
+	u.mu.RLock()
+	sender, ok := u.senders[appID]
+	u.mu.RUnlock()
+	if !ok {
+		return domain.ErrHandoffNoSender
+	}
+	return sender.SendMessage(ctx, channelID, content)
+}
+
+func newHandoffMessage(handoffID string, role domain.HandoffMessageRole, content, userID string) *domain.HandoffMessage {
+	return &domain.HandoffMessage{
+		ID:        uuid.New().String(),
+		HandoffID: handoffID,
+		Role:      role,
+		Content:   content,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+}
+
+// handoffNotice answers a muted bot question with the handoff notice.
+func handoffNotice(notice string) chan string {
+	contentCh := make(chan string, 1)
+	contentCh <- notice
+	close(contentCh)
+	return contentCh
+}
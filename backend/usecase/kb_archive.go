@@ -0,0 +1,618 @@
+package usecase
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/samber/lo"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/repo/mq"
+	"github.com/chaitin/panda-wiki/repo/pg"
+	"github.com/chaitin/panda-wiki/store/s3"
+)
+
+// archives waiting for import are kept in a private bucket, not in the public static-file one
+const kbArchiveBucket = "kb-archive"
+
+// KBArchiveUsecase exports a knowledge base as a zip archive and imports such archives,
+// remapping every id so an archive can be imported any number of times on any instance.
+type KBArchiveUsecase struct {
+	repo     kbArchiveRepository
+	kbRepo   *pg.KnowledgeBaseRepository
+	mqRepo   *mq.KBArchiveRepository
+	ragRepo  nodeReleaseVectorRepository
+	s3Client kbArchiveObjectStore
+	logger   *log.Logger
+}
+
+type kbArchiveRepository interface {
+	GetKBArchive(ctx context.Context, kbID string) (*domain.KBArchive, error)
+	GetNavs(ctx context.Context, kbID string) ([]*domain.Nav, error)
+	CreateKBArchive(ctx context.Context, kbID string, archive *domain.KBArchive) (int, error)
+	CreateImportJob(ctx context.Context, job *domain.KBImportJob) error
+	GetImportJob(ctx context.Context, id string) (*domain.KBImportJob, error)
+	UpdateImportJob(ctx context.Context, id string, updates map[string]any) error
+	FailStaleImportJobs(ctx context.Context, before time.Time, message string) ([]*domain.KBImportJob, error)
+}
+
+// kbArchiveObjectStore is the part of the minio client archives and assets go through.
+type kbArchiveObjectStore interface {
+	GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (*minio.Object, error)
+	PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+	RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error
+	BucketExists(ctx context.Context, bucketName string) (bool, error)
+	MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error
+}
+
+func NewKBArchiveUsecase(
+	repo *pg.KBArchiveRepository,
+	kbRepo *pg.KnowledgeBaseRepository,
+	mqRepo *mq.KBArchiveRepository,
+	ragRepo *mq.RAGRepository,
+	s3Client *s3.MinioClient,
+	logger *log.Logger,
+) *KBArchiveUsecase {
+	return &KBArchiveUsecase{
+		repo:     repo,
+		kbRepo:   kbRepo,
+		mqRepo:   mqRepo,
+		ragRepo:  ragRepo,
+		s3Client: s3Client,
+		logger:   logger.WithModule("usecase.kb_archive"),
+	}
+}
+
+// Export writes the archive of kbID to w. Assets that can't be read from S3 are left out.
+func (u *KBArchiveUsecase) Export(ctx context.Context, kbID string, w io.Writer) error {
+	kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, kbID)
+	if err != nil {
+		return err
+	}
+	archive, err := u.repo.GetKBArchive(ctx, kbID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data any
+	}{
+		{domain.KBArchiveNodesFile, archive.Nodes},
+		{domain.KBArchiveNavsFile, archive.Navs},
+		{domain.KBArchiveNavReleasesFile, archive.NavReleases},
+		{domain.KBArchiveAppsFile, archive.Apps},
+		{domain.KBArchiveSettingsFile, archive.Settings},
+		{domain.KBArchivePromptsFile, archive.Prompts},
+		{domain.KBArchiveReleasesFile, archive.Releases},
+		{domain.KBArchiveReleaseNodesFile, archive.ReleaseNodes},
+		{domain.KBArchiveNodeReleasesFile, archive.NodeReleases},
+	}
+	for _, f := range files {
+		if err := writeZipJSON(zw, f.name, f.data); err != nil {
+			return err
+		}
+	}
+
+	assets := make([]string, 0)
+	for _, key := range archiveAssetKeys(archive) {
+		ok, err := u.exportAsset(ctx, zw, key)
+		if err != nil {
+			return err
+		}
+		if ok {
+			assets = append(assets, key)
+		}
+	}
+
+	manifest := &domain.KBArchiveManifest{
+		Version:    domain.KBArchiveVersion,
+		KBID:       kb.ID,
+		KBName:     kb.Name,
+		ExportedAt: time.Now(),
+		Counts: map[string]int{
+			"nodes":         len(archive.Nodes),
+			"navs":          len(archive.Navs),
+			"apps":          len(archive.Apps),
+			"prompts":       len(archive.Prompts),
+			"releases":      len(archive.Releases),
+			"node_releases": len(archive.NodeReleases),
+			"assets":        len(assets),
+		},
+		Assets: assets,
+	}
+	if err := writeZipJSON(zw, domain.KBArchiveManifestFile, manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (u *KBArchiveUsecase) exportAsset(ctx context.Context, zw *zip.Writer, key string) (bool, error) {
+	obj, err := u.s3Client.GetObject(ctx, domain.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		u.logger.Warn("get kb asset failed", log.String("key", key), log.Error(err))
+		return false, nil
+	}
+	defer obj.Close()
+	// GetObject is lazy, stat first so a missing object doesn't leave a half written entry
+	if _, err := obj.Stat(); err != nil {
+		u.logger.Warn("kb asset not found", log.String("key", key), log.Error(err))
+		return false, nil
+	}
+	fw, err := zw.Create(domain.KBArchiveAssetsDir + key)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(fw, obj); err != nil {
+		return false, fmt.Errorf("copy asset %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// CreateImportJob stores the uploaded archive and queues its import into kbID.
+func (u *KBArchiveUsecase) CreateImportJob(ctx context.Context, kbID string, mode domain.KBImportMode, creatorID string, r io.Reader, size int64) (*domain.KBImportJob, error) {
+	if err := u.ensureArchiveBucket(ctx); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	job := &domain.KBImportJob{
+		ID:        uuid.New().String(),
+		KBID:      kbID,
+		Mode:      mode,
+		Status:    domain.KBImportJobStatusPending,
+		CreatorID: creatorID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	job.ArchiveKey = fmt.Sprintf("%s.zip", job.ID)
+	if _, err := u.s3Client.PutObject(ctx, kbArchiveBucket, job.ArchiveKey, r, size, minio.PutObjectOptions{
+		ContentType: "application/zip",
+	}); err != nil {
+		return nil, fmt.Errorf("store archive: %w", err)
+	}
+	if err := u.repo.CreateImportJob(ctx, job); err != nil {
+		return nil, err
+	}
+	if err := u.mqRepo.AsyncImport(ctx, job.ID); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (u *KBArchiveUsecase) GetImportJob(ctx context.Context, id string) (*domain.KBImportJob, error) {
+	return u.repo.GetImportJob(ctx, id)
+}
+
+// RunImportJob runs a queued import. The outcome is recorded on the job, so only
+// errors that prevent recording it are returned.
+func (u *KBArchiveUsecase) RunImportJob(ctx context.Context, jobID string) error {
+	job, err := u.repo.GetImportJob(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	if job.Status != domain.KBImportJobStatusPending {
+		return nil
+	}
+	if err := u.repo.UpdateImportJob(ctx, job.ID, map[string]any{"status": domain.KBImportJobStatusRunning}); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, domain.KBImportTimeout)
+	defer cancel()
+	result, importErr := u.importStored(ctx, job)
+
+	updates := map[string]any{
+		"status":      domain.KBImportJobStatusSuccess,
+		"stage":       "done",
+		"progress":    100,
+		"finished_at": time.Now(),
+	}
+	if result != nil {
+		updates["result"] = *result
+	}
+	if importErr != nil {
+		u.logger.Error("kb import failed", log.String("job_id", job.ID), log.String("kb_id", job.KBID), log.Error(importErr))
+		updates["status"] = domain.KBImportJobStatusFailed
+		updates["error"] = importErr.Error()
+		delete(updates, "stage")
+		delete(updates, "progress")
+	}
+	if err := u.s3Client.RemoveObject(context.Background(), kbArchiveBucket, job.ArchiveKey, minio.RemoveObjectOptions{}); err != nil {
+		u.logger.Warn("remove imported archive failed", log.String("key", job.ArchiveKey), log.Error(err))
+	}
+	return u.repo.UpdateImportJob(context.Background(), job.ID, updates)
+}
+
+// FailStaleImportJobs fails the jobs whose consumer died mid import. Import tasks are
+// not redelivered, and rerunning one would duplicate the nodes it already created.
+func (u *KBArchiveUsecase) FailStaleImportJobs(ctx context.Context) error {
+	jobs, err := u.repo.FailStaleImportJobs(ctx, time.Now().Add(-domain.KBImportLease), "import was interrupted")
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		u.logger.Warn("kb import interrupted", log.String("job_id", job.ID), log.String("kb_id", job.KBID))
+		if err := u.s3Client.RemoveObject(ctx, kbArchiveBucket, job.ArchiveKey, minio.RemoveObjectOptions{}); err != nil {
+			u.logger.Warn("remove imported archive failed", log.String("key", job.ArchiveKey), log.Error(err))
+		}
+	}
+	return nil
+}
+
+func (u *KBArchiveUsecase) importStored(ctx context.Context, job *domain.KBImportJob) (*domain.KBImportResult, error) {
+	obj, err := u.s3Client.GetObject(ctx, kbArchiveBucket, job.ArchiveKey, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return u.Import(ctx, job.KBID, job.Mode, obj, info.Size, func(stage string, progress int) {
+		if err := u.repo.UpdateImportJob(ctx, job.ID, map[string]any{"stage": stage, "progress": progress}); err != nil {
+			u.logger.Warn("update kb import progress failed", log.String("job_id", job.ID), log.Error(err))
+		}
+	})
+}
+
+// Import loads an archive into kbID, reporting its stage and an overall percentage to progress.
+func (u *KBArchiveUsecase) Import(ctx context.Context, kbID string, mode domain.KBImportMode, r io.ReaderAt, size int64,
+	progress func(stage string, percent int),
+) (*domain.KBImportResult, error) {
+	progress("reading", 5)
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	archive, err := readKBArchive(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	progress("remapping", 10)
+	existingNavs := make([]*domain.Nav, 0)
+	if mode == domain.KBImportModeMerge {
+		if existingNavs, err = u.repo.GetNavs(ctx, kbID); err != nil {
+			return nil, err
+		}
+	}
+	assetKeys := remapKBArchive(archive, kbID, mode, existingNavs)
+
+	result := &domain.KBImportResult{}
+	for i, key := range archive.Manifest.Assets {
+		if i%20 == 0 {
+			progress("uploading assets", 15+60*i/len(archive.Manifest.Assets))
+		}
+		ok, err := u.importAsset(ctx, zr, key, assetKeys[key])
+		if err != nil {
+			return result, err
+		}
+		if ok {
+			result.Assets++
+		} else {
+			result.MissingAssets++
+		}
+	}
+
+	progress("writing", 80)
+	skipped, err := u.repo.CreateKBArchive(ctx, kbID, archive)
+	if err != nil {
+		return result, err
+	}
+	result.Nodes = len(archive.Nodes)
+	result.Navs = len(archive.Navs)
+	result.Apps = len(archive.Apps)
+	result.Settings = len(archive.Settings)
+	result.Prompts = len(archive.Prompts)
+	result.Releases = len(archive.Releases)
+	result.SkippedAuthGroups = skipped
+
+	progress("indexing", 90)
+	if err := u.indexReleased(ctx, kbID, archive); err != nil {
+		return result, err
+	}
+	progress("done", 100)
+	return result, nil
+}
+
+func (u *KBArchiveUsecase) importAsset(ctx context.Context, zr *zip.Reader, key, newKey string) (bool, error) {
+	f, err := zr.Open(domain.KBArchiveAssetsDir + key)
+	if err != nil {
+		u.logger.Warn("kb archive asset missing", log.String("key", key), log.Error(err))
+		return false, nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	contentType := mime.TypeByExtension(path.Ext(newKey))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if _, err := u.s3Client.PutObject(ctx, domain.Bucket, newKey, f, info.Size(), minio.PutObjectOptions{
+		ContentType: contentType,
+	}); err != nil {
+		return false, fmt.Errorf("upload asset %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// indexReleased queues the latest release of every imported node for vectorizing, as publishing does.
+func (u *KBArchiveUsecase) indexReleased(ctx context.Context, kbID string, archive *domain.KBArchive) error {
+	latest := make(map[string]*domain.NodeRelease)
+	for _, nr := range archive.NodeReleases {
+		if cur, ok := latest[nr.NodeID]; !ok || nr.UpdatedAt.After(cur.UpdatedAt) {
+			latest[nr.NodeID] = nr
+		}
+	}
+	if len(latest) == 0 {
+		return nil
+	}
+	requests := make([]*domain.NodeReleaseVectorRequest, 0, len(latest))
+	for _, nr := range latest {
+		if nr.Type != domain.NodeTypeDocument {
+			continue
+		}
+		requests = append(requests, &domain.NodeReleaseVectorRequest{
+			KBID:          kbID,
+			NodeReleaseID: nr.ID,
+			Action:        "upsert",
+		})
+	}
+	return u.ragRepo.AsyncUpdateNodeReleaseVector(ctx, requests)
+}
+
+func (u *KBArchiveUsecase) ensureArchiveBucket(ctx context.Context) error {
+	exists, err := u.s3Client.BucketExists(ctx, kbArchiveBucket)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if err := u.s3Client.MakeBucket(ctx, kbArchiveBucket, minio.MakeBucketOptions{Region: "us-east-1"}); err != nil {
+		// another request may have created it meanwhile
+		if exists, existsErr := u.s3Client.BucketExists(ctx, kbArchiveBucket); existsErr == nil && exists {
+			return nil
+		}
+		return fmt.Errorf("make bucket: %w", err)
+	}
+	return nil
+}
+
+func writeZipJSON(zw *zip.Writer, name string, data any) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(fw).Encode(data)
+}
+
+func readZipJSON(zr *zip.Reader, name string, v any) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("decode %s: %w", name, err)
+	}
+	return nil
+}
+
+func readKBArchive(zr *zip.Reader) (*domain.KBArchive, error) {
+	archive := &domain.KBArchive{}
+	f, err := zr.Open(domain.KBArchiveManifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: missing %s", domain.KBArchiveManifestFile)
+	}
+	err = json.NewDecoder(f).Decode(&archive.Manifest)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", domain.KBArchiveManifestFile, err)
+	}
+	if archive.Manifest.Version < 1 || archive.Manifest.Version > domain.KBArchiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", archive.Manifest.Version)
+	}
+
+	files := []struct {
+		name string
+		v    any
+	}{
+		{domain.KBArchiveNodesFile, &archive.Nodes},
+		{domain.KBArchiveNavsFile, &archive.Navs},
+		{domain.KBArchiveNavReleasesFile, &archive.NavReleases},
+		{domain.KBArchiveAppsFile, &archive.Apps},
+		{domain.KBArchiveSettingsFile, &archive.Settings},
+		{domain.KBArchivePromptsFile, &archive.Prompts},
+		{domain.KBArchiveReleasesFile, &archive.Releases},
+		{domain.KBArchiveReleaseNodesFile, &archive.ReleaseNodes},
+		{domain.KBArchiveNodeReleasesFile, &archive.NodeReleases},
+	}
+	for _, f := range files {
+		if err := readZipJSON(zr, f.name, f.v); err != nil {
+			return nil, err
+		}
+	}
+	return archive, nil
+}
+
+// archiveAssetKeys returns the S3 keys referenced from node and node release content.
+func archiveAssetKeys(archive *domain.KBArchive) []string {
+	keys := make([]string, 0)
+	collect := func(content string) {
+		for _, m := range domain.KBArchiveAssetPattern.FindAllStringSubmatch(content, -1) {
+			keys = append(keys, m[1])
+		}
+	}
+	for _, n := range archive.Nodes {
+		collect(n.Content)
+		for _, t := range n.Meta.Translations {
+			collect(t.Content)
+		}
+	}
+	for _, nr := range archive.NodeReleases {
+		collect(nr.Content)
+		for _, t := range nr.Meta.Translations {
+			collect(t.Content)
+		}
+	}
+	return lo.Uniq(keys)
+}
+
+// remapKBArchive rewrites archive in place for an import into kbID: every record gets a new id,
+// references follow, and asset keys move under kbID. In merge mode only nodes and navs are kept,
+// nodes become unreleased and navs are matched by name against existingNavs.
+// It returns the old -> new asset key mapping.
+func remapKBArchive(archive *domain.KBArchive, kbID string, mode domain.KBImportMode, existingNavs []*domain.Nav) map[string]string {
+	now := time.Now()
+	assetKeys := make(map[string]string, len(archive.Manifest.Assets))
+	for _, key := range archive.Manifest.Assets {
+		rest := key
+		if first, after, ok := strings.Cut(key, "/"); ok && first == archive.Manifest.KBID {
+			rest = after
+		}
+		assetKeys[key] = kbID + "/" + rest
+	}
+	navIDs := make(map[string]string, len(archive.Navs))
+	existingByName := lo.SliceToMap(existingNavs, func(n *domain.Nav) (string, string) { return n.Name, n.ID })
+	navs := make([]*domain.Nav, 0, len(archive.Navs))
+	for _, nav := range archive.Navs {
+		if id, ok := existingByName[nav.Name]; ok && mode == domain.KBImportModeMerge {
+			navIDs[nav.ID] = id
+			continue
+		}
+		navIDs[nav.ID] = uuid.New().String()
+		nav.ID = navIDs[nav.ID]
+		nav.KbID = kbID
+		navs = append(navs, nav)
+	}
+	archive.Navs = navs
+
+	nodeIDs := make(map[string]string, len(archive.Nodes))
+	for _, n := range archive.Nodes {
+		id, err := uuid.NewV7()
+		if err != nil {
+			id = uuid.New()
+		}
+		nodeIDs[n.ID] = id.String()
+	}
+
+	// asset urls and links to other nodes in the content point at the new kb,
+	// longer urls go first so one id being a prefix of another doesn't matter
+	links := make(map[string]string, len(assetKeys)+len(nodeIDs))
+	for key, newKey := range assetKeys {
+		links["/"+domain.Bucket+"/"+key] = "/" + domain.Bucket + "/" + newKey
+	}
+	for id, newID := range nodeIDs {
+		links["/node/"+id] = "/node/" + newID
+	}
+	olds := lo.Keys(links)
+	slices.SortFunc(olds, func(a, b string) int { return len(b) - len(a) })
+	replacer := strings.NewReplacer(lo.FlatMap(olds, func(old string, _ int) []string {
+		return []string{old, links[old]}
+	})...)
+	rewriteMeta := func(meta *domain.NodeMeta) {
+		for lang, t := range meta.Translations {
+			t.Content = replacer.Replace(t.Content)
+			meta.Translations[lang] = t
+		}
+	}
+	for _, n := range archive.Nodes {
+		n.ID = nodeIDs[n.ID]
+		n.ParentID = nodeIDs[n.ParentID]
+		n.NavID = navIDs[n.NavID]
+		n.Content = replacer.Replace(n.Content)
+		rewriteMeta(&n.Meta)
+		if mode == domain.KBImportModeMerge {
+			n.Status = domain.NodeStatusUnreleased
+		}
+	}
+
+	if mode == domain.KBImportModeMerge {
+		archive.NavReleases = nil
+		archive.Apps = nil
+		archive.Settings = nil
+		archive.Prompts = nil
+		archive.Releases = nil
+		archive.ReleaseNodes = nil
+		archive.NodeReleases = nil
+		return assetKeys
+	}
+
+	for _, app := range archive.Apps {
+		app.ID = uuid.New().String()
+		app.KBID = kbID
+		app.CreatedAt, app.UpdatedAt = now, now
+	}
+	for _, p := range archive.Prompts {
+		p.ID = 0
+		p.KBID = kbID
+	}
+	nodeReleaseIDs := make(map[string]string, len(archive.NodeReleases))
+	for _, nr := range archive.NodeReleases {
+		nodeReleaseIDs[nr.ID] = uuid.New().String()
+		nr.ID = nodeReleaseIDs[nr.ID]
+		nr.KBID = kbID
+		nr.NodeID = nodeIDs[nr.NodeID]
+		nr.ParentID = nodeIDs[nr.ParentID]
+		nr.DocID = ""
+		nr.PublisherId, nr.EditorId = "", ""
+		nr.Content = replacer.Replace(nr.Content)
+		rewriteMeta(&nr.Meta)
+	}
+	releaseIDs := make(map[string]string, len(archive.Releases))
+	for _, release := range archive.Releases {
+		releaseIDs[release.ID] = uuid.New().String()
+		release.ID = releaseIDs[release.ID]
+		release.KBID = kbID
+		release.PublisherId = ""
+	}
+	for _, rn := range archive.ReleaseNodes {
+		rn.ID = uuid.New().String()
+		rn.KBID = kbID
+		rn.ReleaseID = releaseIDs[rn.ReleaseID]
+		rn.NodeID = nodeIDs[rn.NodeID]
+		rn.NodeReleaseID = nodeReleaseIDs[rn.NodeReleaseID]
+		rn.NavID = navIDs[rn.NavID]
+	}
+	for _, nr := range archive.NavReleases {
+		nr.ID = uuid.New().String()
+		nr.KbID = kbID
+		nr.NavID = navIDs[nr.NavID]
+		nr.ReleaseID = releaseIDs[nr.ReleaseID]
+	}
+	return assetKeys
+}
+
+// ReadManifest validates an archive and returns its manifest.
+func (u *KBArchiveUsecase) ReadManifest(r io.ReaderAt, size int64) (*domain.KBArchiveManifest, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	archive, err := readKBArchive(zr)
+	if err != nil {
+		return nil, err
+	}
+	return &archive.Manifest, nil
+}
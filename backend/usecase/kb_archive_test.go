@@ -0,0 +1,348 @@
+package usecase
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+)
+
+// fakeKBArchiveStore keeps the navs and nodes of every kb and the uploaded objects in memory.
+// CreateKBArchive enforces the primary keys and the nav and parent references like the database.
+type fakeKBArchiveStore struct {
+	navs    map[string][]*domain.Nav
+	nodes   map[string][]*domain.KBArchiveNode
+	written []*domain.KBArchive
+	objects map[string]string
+	vectors []*domain.NodeReleaseVectorRequest
+	jobs    map[string]*domain.KBImportJob
+	removed []string
+}
+
+func newFakeKBArchiveStore() *fakeKBArchiveStore {
+	return &fakeKBArchiveStore{
+		navs:    make(map[string][]*domain.Nav),
+		nodes:   make(map[string][]*domain.KBArchiveNode),
+		objects: make(map[string]string),
+		jobs:    make(map[string]*domain.KBImportJob),
+	}
+}
+
+func (f *fakeKBArchiveStore) GetKBArchive(ctx context.Context, kbID string) (*domain.KBArchive, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeKBArchiveStore) GetNavs(ctx context.Context, kbID string) ([]*domain.Nav, error) {
+	return f.navs[kbID], nil
+}
+
+func (f *fakeKBArchiveStore) CreateKBArchive(ctx context.Context, kbID string, archive *domain.KBArchive) (int, error) {
+	navIDs := make(map[string]bool)
+	nodeIDs := make(map[string]bool)
+	for _, navs := range f.navs {
+		for _, nav := range navs {
+			navIDs[nav.ID] = true
+		}
+	}
+	for _, nodes := range f.nodes {
+		for _, n := range nodes {
+			nodeIDs[n.ID] = true
+		}
+	}
+	for _, nav := range archive.Navs {
+		if navIDs[nav.ID] {
+			return 0, fmt.Errorf("duplicate nav %s", nav.ID)
+		}
+		navIDs[nav.ID] = true
+	}
+	for _, n := range archive.Nodes {
+		if nodeIDs[n.ID] {
+			return 0, fmt.Errorf("duplicate node %s", n.ID)
+		}
+		nodeIDs[n.ID] = true
+	}
+
+	navs := append(f.navs[kbID], archive.Navs...)
+	nodes := append(f.nodes[kbID], archive.Nodes...)
+	for _, n := range archive.Nodes {
+		if !lo.ContainsBy(navs, func(nav *domain.Nav) bool { return nav.ID == n.NavID }) {
+			return 0, fmt.Errorf("node %s references unknown nav %s", n.ID, n.NavID)
+		}
+		if n.ParentID != "" && !lo.ContainsBy(nodes, func(p *domain.KBArchiveNode) bool { return p.ID == n.ParentID }) {
+			return 0, fmt.Errorf("node %s references unknown parent %s", n.ID, n.ParentID)
+		}
+	}
+	f.navs[kbID] = navs
+	f.nodes[kbID] = nodes
+	f.written = append(f.written, archive)
+	return 0, nil
+}
+
+func (f *fakeKBArchiveStore) CreateImportJob(ctx context.Context, job *domain.KBImportJob) error {
+	return nil
+}
+
+func (f *fakeKBArchiveStore) GetImportJob(ctx context.Context, id string) (*domain.KBImportJob, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeKBArchiveStore) UpdateImportJob(ctx context.Context, id string, updates map[string]any) error {
+	return nil
+}
+
+func (f *fakeKBArchiveStore) FailStaleImportJobs(ctx context.Context, before time.Time, message string) ([]*domain.KBImportJob, error) {
+	var failed []*domain.KBImportJob
+	for _, job := range f.jobs {
+		if job.Status == domain.KBImportJobStatusRunning && !job.UpdatedAt.After(before) {
+			job.Status = domain.KBImportJobStatusFailed
+			job.Error = message
+			failed = append(failed, job)
+		}
+	}
+	return failed, nil
+}
+
+func (f *fakeKBArchiveStore) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (*minio.Object, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeKBArchiveStore) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	f.objects[bucketName+"/"+objectName] = string(data)
+	return minio.UploadInfo{Bucket: bucketName, Key: objectName, Size: int64(len(data))}, nil
+}
+
+func (f *fakeKBArchiveStore) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	f.removed = append(f.removed, objectName)
+	return nil
+}
+
+func (f *fakeKBArchiveStore) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeKBArchiveStore) MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error {
+	return nil
+}
+
+func (f *fakeKBArchiveStore) AsyncUpdateNodeReleaseVector(ctx context.Context, request []*domain.NodeReleaseVectorRequest) error {
+	f.vectors = append(f.vectors, request...)
+	return nil
+}
+
+func newFakeKBArchiveUsecase() (*KBArchiveUsecase, *fakeKBArchiveStore) {
+	f := newFakeKBArchiveStore()
+	return &KBArchiveUsecase{
+		repo:     f,
+		ragRepo:  f,
+		s3Client: f,
+		logger:   &log.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))},
+	}, f
+}
+
+const testArchiveContent = "![diagram](/" + domain.Bucket + "/src/img.png) see [questions](/node/d2)"
+
+// testKBArchive is the zip of kb src: a Docs nav holding folder f1 with the released doc d1 that
+// embeds an image and links to d2, and a FAQ nav holding the doc d2.
+func testKBArchive(t *testing.T) *bytes.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	now := time.Now()
+	files := []struct {
+		name string
+		data any
+	}{
+		{domain.KBArchiveManifestFile, &domain.KBArchiveManifest{Version: domain.KBArchiveVersion, KBID: "src", KBName: "Source", Assets: []string{"src/img.png"}}},
+		{domain.KBArchiveNavsFile, []*domain.Nav{
+			{ID: "nav-docs", Name: "Docs", KbID: "src"},
+			{ID: "nav-faq", Name: "FAQ", KbID: "src", Position: 1},
+		}},
+		{domain.KBArchiveNodesFile, []*domain.KBArchiveNode{
+			{ID: "f1", Type: domain.NodeTypeFolder, Status: domain.NodeStatusReleased, Name: "Guides", NavID: "nav-docs"},
+			{ID: "d1", Type: domain.NodeTypeDocument, Status: domain.NodeStatusReleased, Name: "Install", ParentID: "f1", NavID: "nav-docs", Content: testArchiveContent,
+				Meta: domain.NodeMeta{Translations: map[string]domain.NodeTranslationContent{"en": {Content: testArchiveContent}}}},
+			{ID: "d2", Type: domain.NodeTypeDocument, Status: domain.NodeStatusReleased, Name: "Questions", NavID: "nav-faq"},
+		}},
+		{domain.KBArchiveNodeReleasesFile, []*domain.NodeRelease{
+			{ID: "nr0", KBID: "src", NodeID: "d1", ParentID: "f1", DocID: "doc0", Type: domain.NodeTypeDocument, UpdatedAt: now.Add(-time.Hour)},
+			{ID: "nr1", KBID: "src", NodeID: "d1", ParentID: "f1", DocID: "doc1", Type: domain.NodeTypeDocument, Content: testArchiveContent, UpdatedAt: now},
+		}},
+		{domain.KBArchiveReleasesFile, []*domain.KBRelease{{ID: "r1", KBID: "src", Tag: "v1", PublisherId: "u1"}}},
+		{domain.KBArchiveReleaseNodesFile, []*domain.KBReleaseNodeRelease{{ID: "rn1", KBID: "src", ReleaseID: "r1", NodeID: "d1", NodeReleaseID: "nr1", NavID: "nav-docs"}}},
+		{domain.KBArchiveNavReleasesFile, []*domain.NavRelease{{ID: "navr1", NavID: "nav-docs", ReleaseID: "r1", KbID: "src", Name: "Docs"}}},
+		{domain.KBArchiveAppsFile, []*domain.App{{ID: "a1", KBID: "src", Name: "web", Type: domain.AppTypeWeb}}},
+		{domain.KBArchivePromptsFile, []*domain.PromptVersion{{ID: 7, KBID: "src", Version: 1, Content: "be brief"}}},
+	}
+	for _, f := range files {
+		require.NoError(t, writeZipJSON(zw, f.name, f.data))
+	}
+	fw, err := zw.Create(domain.KBArchiveAssetsDir + "src/img.png")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("png"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func importTestKBArchive(t *testing.T, u *KBArchiveUsecase, kbID string, mode domain.KBImportMode) *domain.KBImportResult {
+	r := testKBArchive(t)
+	result, err := u.Import(t.Context(), kbID, mode, r, r.Size(), func(string, int) {})
+	require.NoError(t, err)
+	return result
+}
+
+func archiveNodeByName(nodes []*domain.KBArchiveNode, name string) *domain.KBArchiveNode {
+	return lo.FindOrElse(nodes, nil, func(n *domain.KBArchiveNode) bool { return n.Name == name })
+}
+
+func TestKBArchiveImportNew(t *testing.T) {
+	u, f := newFakeKBArchiveUsecase()
+	result := importTestKBArchive(t, u, "dst", domain.KBImportModeNew)
+	require.Equal(t, &domain.KBImportResult{Nodes: 3, Navs: 2, Apps: 1, Prompts: 1, Releases: 1, Assets: 1}, result)
+
+	archive := f.written[0]
+	navs := lo.SliceToMap(archive.Navs, func(n *domain.Nav) (string, *domain.Nav) { return n.Name, n })
+	folder := archiveNodeByName(archive.Nodes, "Guides")
+	doc := archiveNodeByName(archive.Nodes, "Install")
+	faq := archiveNodeByName(archive.Nodes, "Questions")
+
+	// every id is new and the references follow
+	for _, n := range archive.Nodes {
+		require.NotContains(t, []string{"f1", "d1", "d2"}, n.ID)
+		require.Equal(t, domain.NodeStatusReleased, n.Status)
+	}
+	for _, nav := range archive.Navs {
+		require.NotContains(t, []string{"nav-docs", "nav-faq"}, nav.ID)
+		require.Equal(t, "dst", nav.KbID)
+	}
+	require.Empty(t, folder.ParentID)
+	require.Equal(t, folder.ID, doc.ParentID)
+	require.Empty(t, faq.ParentID)
+	require.Equal(t, navs["Docs"].ID, folder.NavID)
+	require.Equal(t, navs["Docs"].ID, doc.NavID)
+	require.Equal(t, navs["FAQ"].ID, faq.NavID)
+
+	// assets move under the new kb and links follow the linked node
+	newContent := "![diagram](/" + domain.Bucket + "/dst/img.png) see [questions](/node/" + faq.ID + ")"
+	require.Equal(t, newContent, doc.Content)
+	require.Equal(t, newContent, doc.Meta.Translations["en"].Content)
+	require.Equal(t, map[string]string{domain.Bucket + "/dst/img.png": "png"}, f.objects)
+
+	release := archive.Releases[0]
+	require.NotEqual(t, "r1", release.ID)
+	require.Equal(t, "dst", release.KBID)
+	require.Empty(t, release.PublisherId)
+	latest := archive.NodeReleases[1]
+	require.NotEqual(t, "nr1", latest.ID)
+	require.Equal(t, doc.ID, latest.NodeID)
+	require.Equal(t, folder.ID, latest.ParentID)
+	require.Empty(t, latest.DocID)
+	require.Equal(t, newContent, latest.Content)
+	require.Equal(t, &domain.KBReleaseNodeRelease{
+		ID: archive.ReleaseNodes[0].ID, KBID: "dst", ReleaseID: release.ID, NodeID: doc.ID, NodeReleaseID: latest.ID, NavID: navs["Docs"].ID,
+	}, archive.ReleaseNodes[0])
+	require.Equal(t, navs["Docs"].ID, archive.NavReleases[0].NavID)
+	require.Equal(t, release.ID, archive.NavReleases[0].ReleaseID)
+	require.Equal(t, "dst", archive.Apps[0].KBID)
+	require.Zero(t, archive.Prompts[0].ID)
+
+	// only the latest release of the doc is indexed
+	require.Equal(t, []*domain.NodeReleaseVectorRequest{{KBID: "dst", NodeReleaseID: latest.ID, Action: "upsert"}}, f.vectors)
+
+	// the same archive imports again side by side
+	importTestKBArchive(t, u, "dst", domain.KBImportModeNew)
+	require.Len(t, f.nodes["dst"], 6)
+	require.Len(t, f.navs["dst"], 4)
+}
+
+func TestKBArchiveImportMerge(t *testing.T) {
+	u, f := newFakeKBArchiveUsecase()
+	f.navs["dst"] = []*domain.Nav{{ID: "dst-docs", Name: "Docs", KbID: "dst"}}
+	existing := &domain.KBArchiveNode{ID: "dst-node", Type: domain.NodeTypeDocument, Status: domain.NodeStatusReleased, Name: "Existing", NavID: "dst-docs"}
+	f.nodes["dst"] = []*domain.KBArchiveNode{existing}
+
+	result := importTestKBArchive(t, u, "dst", domain.KBImportModeMerge)
+	require.Equal(t, &domain.KBImportResult{Nodes: 3, Navs: 1, Assets: 1}, result)
+
+	archive := f.written[0]
+	// the Docs nav of the kb is reused, only FAQ is created
+	require.Len(t, archive.Navs, 1)
+	require.Equal(t, "FAQ", archive.Navs[0].Name)
+	folder := archiveNodeByName(archive.Nodes, "Guides")
+	doc := archiveNodeByName(archive.Nodes, "Install")
+	faq := archiveNodeByName(archive.Nodes, "Questions")
+	require.Equal(t, "dst-docs", folder.NavID)
+	require.Equal(t, "dst-docs", doc.NavID)
+	require.Equal(t, folder.ID, doc.ParentID)
+	require.Equal(t, archive.Navs[0].ID, faq.NavID)
+	require.Equal(t, "![diagram](/"+domain.Bucket+"/dst/img.png) see [questions](/node/"+faq.ID+")", doc.Content)
+
+	// merged nodes wait for the next release, nothing of the archived releases is kept
+	for _, n := range archive.Nodes {
+		require.Equal(t, domain.NodeStatusUnreleased, n.Status)
+	}
+	require.Empty(t, archive.Releases)
+	require.Empty(t, archive.ReleaseNodes)
+	require.Empty(t, archive.NodeReleases)
+	require.Empty(t, archive.NavReleases)
+	require.Empty(t, archive.Apps)
+	require.Empty(t, archive.Prompts)
+	require.Empty(t, f.vectors)
+
+	// the nodes already in the kb are kept as they were
+	require.Len(t, f.nodes["dst"], 4)
+	require.Equal(t, existing, f.nodes["dst"][0])
+	require.Equal(t, &domain.KBArchiveNode{ID: "dst-node", Type: domain.NodeTypeDocument, Status: domain.NodeStatusReleased, Name: "Existing", NavID: "dst-docs"}, existing)
+
+	// merging twice adds a second copy, still under the same navs
+	importTestKBArchive(t, u, "dst", domain.KBImportModeMerge)
+	require.Len(t, f.nodes["dst"], 7)
+	require.Len(t, f.navs["dst"], 2)
+}
+
+func TestKBArchiveImportInvalid(t *testing.T) {
+	u, _ := newFakeKBArchiveUsecase()
+	_, err := u.Import(t.Context(), "dst", domain.KBImportModeNew, bytes.NewReader([]byte("not a zip")), 9, func(string, int) {})
+	require.ErrorContains(t, err, "invalid archive")
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	require.NoError(t, writeZipJSON(zw, domain.KBArchiveManifestFile, &domain.KBArchiveManifest{Version: domain.KBArchiveVersion + 1}))
+	require.NoError(t, zw.Close())
+	_, err = u.Import(t.Context(), "dst", domain.KBImportModeNew, bytes.NewReader(buf.Bytes()), int64(buf.Len()), func(string, int) {})
+	require.ErrorContains(t, err, "unsupported archive version")
+}
+
+func TestKBArchiveFailStaleImportJobs(t *testing.T) {
+	u, f := newFakeKBArchiveUsecase()
+	now := time.Now()
+	f.jobs = map[string]*domain.KBImportJob{
+		// the consumer died mid import
+		"stale": {ID: "stale", Status: domain.KBImportJobStatusRunning, ArchiveKey: "imports/stale.zip", UpdatedAt: now.Add(-domain.KBImportLease - time.Minute)},
+		// still reporting progress
+		"running": {ID: "running", Status: domain.KBImportJobStatusRunning, ArchiveKey: "imports/running.zip", UpdatedAt: now.Add(-time.Minute)},
+		"pending": {ID: "pending", Status: domain.KBImportJobStatusPending, UpdatedAt: now.Add(-2 * domain.KBImportLease)},
+	}
+
+	require.NoError(t, u.FailStaleImportJobs(t.Context()))
+	require.Equal(t, domain.KBImportJobStatusFailed, f.jobs["stale"].Status)
+	require.NotEmpty(t, f.jobs["stale"].Error)
+	require.Equal(t, domain.KBImportJobStatusRunning, f.jobs["running"].Status)
+	require.Equal(t, domain.KBImportJobStatusPending, f.jobs["pending"].Status)
+	require.Equal(t, []string{"imports/stale.zip"}, f.removed)
+}
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/samber/lo"
 	"gorm.io/gorm"
 
 	v1 "github.com/chaitin/panda-wiki/api/kb/v1"
@@ -27,25 +29,31 @@ type KnowledgeBaseUsecase struct {
 	ragRepo   *mq.RAGRepository
 	userRepo  *pg.UserRepository
 	tokenRepo *pg.APITokenRepo
+	cacheRepo *pg.AnswerCacheRepo
 	rag       rag.RAGService
 	kbCache   *cache.KBRepo
 	push      *PushUsecase
+	webhook   *WebhookUsecase
+	review    *NodeReviewUsecase
 	logger    *log.Logger
 	config    *config.Config
 }
 
-func NewKnowledgeBaseUsecase(repo *pg.KnowledgeBaseRepository, nodeRepo *pg.NodeRepository, ragRepo *mq.RAGRepository, userRepo *pg.UserRepository, tokenRepo *pg.APITokenRepo, rag rag.RAGService, kbCache *cache.KBRepo, push *PushUsecase, logger *log.Logger, config *config.Config) (*KnowledgeBaseUsecase, error) {
+func NewKnowledgeBaseUsecase(repo *pg.KnowledgeBaseRepository, nodeRepo *pg.NodeRepository, ragRepo *mq.RAGRepository, userRepo *pg.UserRepository, tokenRepo *pg.APITokenRepo, cacheRepo *pg.AnswerCacheRepo, rag rag.RAGService, kbCache *cache.KBRepo, push *PushUsecase, webhook *WebhookUsecase, review *NodeReviewUsecase, logger *log.Logger, config *config.Config) (*KnowledgeBaseUsecase, error) {
 	u := &KnowledgeBaseUsecase{
 		repo:      repo,
 		nodeRepo:  nodeRepo,
 		ragRepo:   ragRepo,
 		userRepo:  userRepo,
 		tokenRepo: tokenRepo,
+		cacheRepo: cacheRepo,
 		rag:       rag,
 		logger:    logger.WithModule("usecase.knowledge_base"),
 		config:    config,
 		kbCache:   kbCache,
 		push:      push,
+		webhook:   webhook,
+		review:    review,
 	}
 	return u, nil
 }
@@ -154,11 +162,39 @@ func (u *KnowledgeBaseUsecase) DeleteKnowledgeBase(ctx context.Context, kbID str
 }
 
 func (u *KnowledgeBaseUsecase) CreateKBRelease(ctx context.Context, req *domain.CreateKBReleaseReq, userId string) (string, error) {
+	release, err := u.PublishKBRelease(ctx, req, userId)
+	if err != nil {
+		return "", err
+	}
+
+	// async push notification to configured group chats
+	if u.push != nil {
+		go func() {
+			pushCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+			defer cancel()
+			u.push.NotifyKBUpdate(pushCtx, req.KBID, release)
+		}()
+	}
+	return release.ID, nil
+}
+
+// PublishKBRelease publishes req.NodeIDs and creates the kb release without pushing it to group chats,
+// the bots only run in the api server.
+func (u *KnowledgeBaseUsecase) PublishKBRelease(ctx context.Context, req *domain.CreateKBReleaseReq, userId string) (*domain.KBRelease, error) {
+	// with the review workflow on, drafts only go out once approved
+	reviewedNodeIDs, err := u.review.CheckRelease(ctx, req.KBID, req.NodeIDs)
+	if err != nil {
+		return nil, err
+	}
 	if len(req.NodeIDs) > 0 {
 		// create published nodes
 		releaseIDs, err := u.nodeRepo.CreateNodeReleases(ctx, req.KBID, userId, req.NodeIDs)
 		if err != nil {
-			return "", fmt.Errorf("failed to create published nodes: %w", err)
+			return nil, fmt.Errorf("failed to create published nodes: %w", err)
+		}
+		// cached answers of the released nodes are out of date
+		if err := u.cacheRepo.DeleteByNodeIDs(ctx, req.KBID, req.NodeIDs); err != nil {
+			u.logger.Error("invalidate answer cache failed", log.String("kb_id", req.KBID), log.Error(err))
 		}
 		if len(releaseIDs) > 0 {
 			// async upsert vector content via mq
@@ -171,7 +207,7 @@ func (u *KnowledgeBaseUsecase) CreateKBRelease(ctx context.Context, req *domain.
 				})
 			}
 			if err := u.ragRepo.AsyncUpdateNodeReleaseVector(ctx, nodeContentVectorRequests); err != nil {
-				return "", err
+				return nil, err
 			}
 		}
 	}
@@ -185,19 +221,20 @@ func (u *KnowledgeBaseUsecase) CreateKBRelease(ctx context.Context, req *domain.
 		CreatedAt:   time.Now(),
 	}
 	if err := u.repo.CreateKBRelease(ctx, release); err != nil {
-		return "", fmt.Errorf("failed to create kb release: %w", err)
+		return nil, fmt.Errorf("failed to create kb release: %w", err)
 	}
-
-	// async push notification to configured group chats
-	if u.push != nil {
-		go func() {
-			pushCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-			defer cancel()
-			u.push.NotifyKBUpdate(pushCtx, req.KBID, release)
-		}()
+	if err := u.review.MarkReleased(ctx, req.KBID, reviewedNodeIDs, release.ID); err != nil {
+		u.logger.Error("mark node reviews released failed", log.String("release_id", release.ID), log.Error(err))
 	}
 
-	return release.ID, nil
+	u.webhook.Dispatch(ctx, req.KBID, domain.WebhookEventReleaseCreated, &domain.WebhookReleaseData{
+		ReleaseID: release.ID,
+		Tag:       release.Tag,
+		Message:   release.Message,
+		UserID:    userId,
+	})
+
+	return release, nil
 }
 
 func (u *KnowledgeBaseUsecase) GetKBReleaseList(ctx context.Context, req *domain.GetKBReleaseListReq) (*domain.GetKBReleaseListResp, error) {
@@ -297,6 +334,11 @@ func (u *KnowledgeBaseUsecase) RollbackKBRelease(ctx context.Context, req *domai
 		seen[nodeID] = struct{}{}
 		rollbackNodeID = append(rollbackNodeID, nodeID)
 	}
+	u.webhook.Dispatch(ctx, req.KBID, domain.WebhookEventReleaseRolledBack, &domain.WebhookReleaseData{
+		ReleaseID:      req.ReleaseID,
+		UserID:         userID,
+		RollbackNodeID: rollbackNodeID,
+	})
 
 	return &domain.RollbackKBReleaseResp{
 		ReleaseID:      req.ReleaseID,
@@ -407,22 +449,29 @@ func (u *KnowledgeBaseUsecase) CreateAPIToken(ctx context.Context, req *domain.C
 	if req.Name == "" {
 		return nil, fmt.Errorf("api token name is required")
 	}
+	now := time.Now()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("api token expires_at must be in the future")
+	}
 
 	token, err := domain.GenerateAPITokenValue()
 	if err != nil {
 		return nil, err
 	}
 
-	now := time.Now()
 	apiToken := &domain.APIToken{
 		ID:                 uuid.New().String(),
 		Name:               req.Name,
 		UserID:             authInfo.UserId,
-		Token:              token,
+		TokenHash:          domain.HashAPIToken(token),
+		TokenPrefix:        domain.APITokenPrefix(token),
 		KbId:               req.KBID,
 		Permission:         req.Permission,
+		Scopes:             apiTokenScopes(req.Scopes),
+		ExpiresAt:          req.ExpiresAt,
 		RateLimitPerMinute: req.RateLimitPerMinute,
 		DailyQuota:         req.DailyQuota,
+		MonthlyTokenQuota:  req.MonthlyTokenQuota,
 		CreatedAt:          now,
 		UpdatedAt:          now,
 	}
@@ -431,16 +480,9 @@ func (u *KnowledgeBaseUsecase) CreateAPIToken(ctx context.Context, req *domain.C
 		return nil, err
 	}
 
-	return &domain.APITokenListItem{
-		ID:                 apiToken.ID,
-		Name:               apiToken.Name,
-		Token:              apiToken.Token,
-		Permission:         apiToken.Permission,
-		RateLimitPerMinute: apiToken.RateLimitPerMinute,
-		DailyQuota:         apiToken.DailyQuota,
-		CreatedAt:          apiToken.CreatedAt,
-		UpdatedAt:          apiToken.UpdatedAt,
-	}, nil
+	item := apiToken.ToListItem()
+	item.Token = token
+	return item, nil
 }
 
 func (u *KnowledgeBaseUsecase) ListAPIToken(ctx context.Context, req domain.APITokenListReq) ([]*domain.APITokenListItem, error) {
@@ -455,16 +497,7 @@ func (u *KnowledgeBaseUsecase) ListAPIToken(ctx context.Context, req domain.APIT
 
 	items := make([]*domain.APITokenListItem, 0, len(apiTokens))
 	for _, item := range apiTokens {
-		items = append(items, &domain.APITokenListItem{
-			ID:                 item.ID,
-			Name:               item.Name,
-			Token:              item.Token,
-			Permission:         item.Permission,
-			RateLimitPerMinute: item.RateLimitPerMinute,
-			DailyQuota:         item.DailyQuota,
-			CreatedAt:          item.CreatedAt,
-			UpdatedAt:          item.UpdatedAt,
-		})
+		items = append(items, item.ToListItem())
 	}
 	return items, nil
 }
@@ -485,6 +518,9 @@ func (u *KnowledgeBaseUsecase) UpdateAPIToken(ctx context.Context, req *domain.U
 		}
 		req.Name = &trimmedName
 	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("api token expires_at must be in the future")
+	}
 
 	if err := u.tokenRepo.Update(ctx, req, authInfo.UserId); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -509,6 +545,52 @@ func (u *KnowledgeBaseUsecase) DeleteAPIToken(ctx context.Context, req domain.De
 	return nil
 }
 
+// RotateAPIToken issues a new token value, the previous value keeps working for the overlap.
+func (u *KnowledgeBaseUsecase) RotateAPIToken(ctx context.Context, req *domain.RotateAPITokenReq) (*domain.APITokenListItem, error) {
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return nil, fmt.Errorf("authInfo not found in context")
+	}
+
+	token, err := domain.GenerateAPITokenValue()
+	if err != nil {
+		return nil, err
+	}
+	var previousExpiresAt *time.Time
+	if req.OverlapMinutes > 0 {
+		previousExpiresAt = lo.ToPtr(time.Now().Add(time.Duration(req.OverlapMinutes) * time.Minute))
+	}
+
+	apiToken, err := u.tokenRepo.Rotate(ctx, req.ID, req.KBID, authInfo.UserId, domain.HashAPIToken(token), domain.APITokenPrefix(token), previousExpiresAt)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("api token not found")
+		}
+		return nil, err
+	}
+	if apiToken == nil {
+		return nil, fmt.Errorf("api token not found")
+	}
+	item := apiToken.ToListItem()
+	item.Token = token
+	return item, nil
+}
+
+func (u *KnowledgeBaseUsecase) GetAPITokenUsage(ctx context.Context, req *domain.APITokenUsageReq) ([]*domain.APITokenUsageItem, error) {
+	authInfo := domain.GetAuthInfoFromCtx(ctx)
+	if authInfo == nil {
+		return nil, fmt.Errorf("authInfo not found in context")
+	}
+	if req.Interval == "" {
+		req.Interval = "day"
+	}
+	return u.tokenRepo.UsageReport(ctx, req, authInfo.UserId)
+}
+
+func apiTokenScopes(scopes []consts.APITokenScope) pq.StringArray {
+	return lo.Uniq(lo.Map(scopes, func(scope consts.APITokenScope, _ int) string { return string(scope) }))
+}
+
 func (u *KnowledgeBaseUsecase) GetContributeList(ctx context.Context, req *domain.ContributeListReq) (*domain.ContributeListResp, error) {
 	items, total, err := u.nodeRepo.GetContributeList(ctx, req)
 	if err != nil {
@@ -621,7 +703,7 @@ func (u *KnowledgeBaseUsecase) AuditContribute(ctx context.Context, req *domain.
 			content := contribute.Content
 			emoji := contribute.Meta.Emoji
 
-			if err := u.nodeRepo.UpdateNodeContent(ctx, &domain.UpdateNodeReq{
+			if _, err := u.nodeRepo.UpdateNodeContent(ctx, &domain.UpdateNodeReq{
 				ID:          node.ID,
 				KBID:        req.KBID,
 				Name:        &nodeName,
@@ -644,6 +726,14 @@ func (u *KnowledgeBaseUsecase) AuditContribute(ctx context.Context, req *domain.
 	if affectedRows == 0 {
 		return nil, fmt.Errorf("contribute has already been audited")
 	}
+	u.webhook.Dispatch(ctx, req.KBID, domain.WebhookEventContributeAudited, &domain.WebhookContributeData{
+		ContributeID: contribute.Id,
+		Type:         contribute.Type,
+		Status:       req.Status,
+		NodeID:       lo.FromPtr(approvedNodeID),
+		Name:         contribute.Name,
+		AuditUserID:  auditUserID,
+	})
 
 	return &domain.ContributeAuditResp{
 		Message: "success",
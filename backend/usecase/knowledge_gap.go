@@ -0,0 +1,261 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/repo/pg"
+)
+
+// KnowledgeGapUsecase mines recent user questions for topics the kb answers badly: the
+// questions are clustered by embedding, clusters with few retrieved chunks, dislikes or
+// ungrounded answers are ranked as gaps and the model drafts a document outline for each.
+type KnowledgeGapUsecase struct {
+	repo         *pg.KnowledgeGapRepository
+	llmUsecase   *LLMUsecase
+	modelUsecase *ModelUsecase
+	nodeUsecase  *NodeUsecase
+	logger       *log.Logger
+}
+
+func NewKnowledgeGapUsecase(
+	repo *pg.KnowledgeGapRepository,
+	llmUsecase *LLMUsecase,
+	modelUsecase *ModelUsecase,
+	nodeUsecase *NodeUsecase,
+	logger *log.Logger,
+) *KnowledgeGapUsecase {
+	return &KnowledgeGapUsecase{
+		repo:         repo,
+		llmUsecase:   llmUsecase,
+		modelUsecase: modelUsecase,
+		nodeUsecase:  nodeUsecase,
+		logger:       logger.WithModule("usecase.knowledge_gap"),
+	}
+}
+
+// CreateReport stores a pending report, the consumer picks it up within minutes.
+func (u *KnowledgeGapUsecase) CreateReport(ctx context.Context, req *domain.CreateKnowledgeGapReportReq, creatorID string) (*domain.KnowledgeGapReport, error) {
+	report := &domain.KnowledgeGapReport{
+		ID:        uuid.New().String(),
+		KBID:      req.KBID,
+		Days:      req.Days,
+		Status:    domain.KnowledgeGapReportStatusPending,
+		CreatorID: creatorID,
+		CreatedAt: time.Now(),
+	}
+	if report.Days == 0 {
+		report.Days = domain.KnowledgeGapDefaultDays
+	}
+	if err := u.repo.CreateReport(ctx, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (u *KnowledgeGapUsecase) ListReports(ctx context.Context, req *domain.KnowledgeGapReportListReq) (*domain.KnowledgeGapReportListResp, error) {
+	total, reports, err := u.repo.ListReports(ctx, req.KBID, req.Offset(), req.Limit())
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewPaginatedResult(reports, uint64(total)), nil
+}
+
+func (u *KnowledgeGapUsecase) GetReport(ctx context.Context, kbID, id string) (*domain.KnowledgeGapReportDetailResp, error) {
+	report, err := u.repo.GetReport(ctx, kbID, id)
+	if err != nil {
+		return nil, err
+	}
+	gaps, err := u.repo.ListGaps(ctx, report.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.KnowledgeGapReportDetailResp{Report: report, Gaps: gaps}, nil
+}
+
+// CreateDraft creates a draft document from the outline of the gap.
+func (u *KnowledgeGapUsecase) CreateDraft(ctx context.Context, req *domain.CreateKnowledgeGapDraftReq, userID string) (string, error) {
+	gap, err := u.repo.GetGap(ctx, req.KBID, req.GapID)
+	if err != nil {
+		return "", err
+	}
+	if gap.NodeID != "" {
+		return "", domain.ErrKnowledgeGapDrafted
+	}
+	// claim the gap with the id of the draft first, so concurrent requests create one draft
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	nodeID := id.String()
+	claimed, err := u.repo.SetGapNode(ctx, gap.ID, nodeID)
+	if err != nil {
+		return "", err
+	}
+	if !claimed {
+		return "", domain.ErrKnowledgeGapDrafted
+	}
+	content := gap.Outline
+	if len(gap.Questions) > 0 {
+		content += "\n\n## 用户提问\n\n- " + strings.Join(gap.Questions, "\n- ")
+	}
+	if _, err := u.nodeUsecase.Create(ctx, &domain.CreateNodeReq{
+		ID:          nodeID,
+		KBID:        req.KBID,
+		ParentID:    req.ParentID,
+		Type:        domain.NodeTypeDocument,
+		Name:        gap.Title,
+		Content:     content,
+		ContentType: lo.ToPtr(domain.ContentTypeMD),
+	}, userID); err != nil {
+		if err := u.repo.ReleaseGapNode(context.Background(), gap.ID, nodeID); err != nil {
+			u.logger.Error("release knowledge gap draft failed", log.String("gap_id", gap.ID), log.Error(err))
+		}
+		return "", err
+	}
+	return nodeID, nil
+}
+
+// ExecutePendingReports runs the pending reports one by one.
+func (u *KnowledgeGapUsecase) ExecutePendingReports(ctx context.Context) error {
+	if err := u.repo.FailStaleReports(ctx, time.Now().Add(-2*domain.KnowledgeGapTimeout)); err != nil {
+		u.logger.Warn("fail stale knowledge gap reports failed", log.Error(err))
+	}
+	ids, err := u.repo.ListPendingReportIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := u.ExecuteReport(ctx, id); err != nil {
+			u.logger.Error("execute knowledge gap report failed", log.String("report_id", id), log.Error(err))
+		}
+	}
+	return nil
+}
+
+// ExecuteReport runs a pending report to completion. The outcome is recorded on the report,
+// so only errors that prevent recording it are returned.
+func (u *KnowledgeGapUsecase) ExecuteReport(ctx context.Context, id string) error {
+	report, err := u.repo.GetReport(ctx, "", id)
+	if err != nil {
+		return err
+	}
+	claimed, err := u.repo.UpdateReportIfStatus(ctx, report.ID, domain.KnowledgeGapReportStatusPending, map[string]any{
+		"status": domain.KnowledgeGapReportStatusRunning,
+	})
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, domain.KnowledgeGapTimeout)
+	defer cancel()
+	runErr := u.execute(ctx, report)
+
+	updates := map[string]any{
+		"status":         domain.KnowledgeGapReportStatusSuccess,
+		"question_count": report.QuestionCount,
+		"cluster_count":  report.ClusterCount,
+		"gap_count":      report.GapCount,
+		"finished_at":    time.Now(),
+	}
+	if runErr != nil {
+		u.logger.Error("knowledge gap report failed", log.String("report_id", report.ID), log.String("kb_id", report.KBID), log.Error(runErr))
+		updates["status"] = domain.KnowledgeGapReportStatusFailed
+		updates["error"] = runErr.Error()
+	}
+	return u.repo.UpdateReport(context.Background(), report.ID, updates)
+}
+
+func (u *KnowledgeGapUsecase) execute(ctx context.Context, report *domain.KnowledgeGapReport) error {
+	since := report.CreatedAt.AddDate(0, 0, -report.Days)
+	questions, err := u.repo.ListRecentQuestions(ctx, report.KBID, since, domain.KnowledgeGapMaxQuestions)
+	if err != nil {
+		return fmt.Errorf("list recent questions: %w", err)
+	}
+	report.QuestionCount = len(questions)
+	if len(questions) == 0 {
+		return nil
+	}
+
+	vectors := make([][]float32, 0, len(questions))
+	for batch := range slices.Chunk(questions, domain.KnowledgeGapEmbedBatch) {
+		texts := lo.Map(batch, func(q *domain.KnowledgeGapQuestion, _ int) string { return q.Question })
+		batchVectors, _, _, err := u.modelUsecase.Embed(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("embed questions: %w", err)
+		}
+		vectors = append(vectors, batchVectors...)
+	}
+	if len(vectors) != len(questions) {
+		return fmt.Errorf("embed questions: got %d vectors for %d questions", len(vectors), len(questions))
+	}
+
+	clusters := domain.ClusterEmbeddings(vectors, domain.KnowledgeGapClusterThreshold)
+	report.ClusterCount = len(clusters)
+	gaps := make([]*domain.KnowledgeGap, 0)
+	for _, cluster := range clusters {
+		gap := domain.NewKnowledgeGap(lo.Map(cluster, func(i int, _ int) *domain.KnowledgeGapQuestion { return questions[i] }))
+		if gap != nil {
+			gaps = append(gaps, gap)
+		}
+	}
+	gaps = domain.RankKnowledgeGaps(gaps)
+	report.GapCount = len(gaps)
+	if len(gaps) == 0 {
+		return nil
+	}
+
+	chatModel, err := u.getChatModel(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, gap := range gaps {
+		gap.ID = uuid.New().String()
+		gap.ReportID = report.ID
+		gap.KBID = report.KBID
+		gap.CreatedAt = now
+		outline := u.draftOutline(ctx, chatModel, gap)
+		gap.Title, gap.Outline = outline.Title, outline.Outline
+	}
+	return u.repo.CreateGaps(ctx, gaps)
+}
+
+// draftOutline asks the model for a document closing the gap, failures leave the outline
+// empty so the gap is still reported.
+func (u *KnowledgeGapUsecase) draftOutline(ctx context.Context, chatModel model.BaseChatModel, gap *domain.KnowledgeGap) *domain.KnowledgeGapOutline {
+	content, err := u.llmUsecase.Generate(ctx, chatModel, []*schema.Message{
+		schema.SystemMessage(domain.KnowledgeGapOutlinePrompt),
+		schema.UserMessage("- " + strings.Join(gap.Questions, "\n- ")),
+	})
+	if err != nil {
+		u.logger.Warn("draft knowledge gap outline failed", log.Error(err))
+		return domain.ParseKnowledgeGapOutline("", gap)
+	}
+	return domain.ParseKnowledgeGapOutline(u.llmUsecase.trimThinking(content), gap)
+}
+
+func (u *KnowledgeGapUsecase) getChatModel(ctx context.Context) (model.BaseChatModel, error) {
+	m, err := u.modelUsecase.GetChatModel(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get chat model: %w", err)
+	}
+	modelkitModel, err := m.ToModelkitModel()
+	if err != nil {
+		return nil, fmt.Errorf("convert model: %w", err)
+	}
+	return u.llmUsecase.modelkit.GetChatModel(ctx, modelkitModel)
+}
@@ -0,0 +1,322 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/pkg/ldap"
+	"github.com/chaitin/panda-wiki/repo/pg"
+	"github.com/chaitin/panda-wiki/store/cache"
+)
+
+const ldapSyncLockTTL = 30 * time.Minute
+
+// LDAPSyncUsecase mirrors the groups of a directory into the auth groups of a knowledge base.
+// Directory groups map to LDAP auth groups keyed by their DN, nested groups to child groups,
+// and the members of every group are pre-provisioned as LDAP readers.
+type LDAPSyncUsecase struct {
+	repo     *pg.LDAPSyncRepository
+	authRepo *pg.AuthRepo
+	kbRepo   *pg.KnowledgeBaseRepository
+	cache    *cache.Cache
+	logger   *log.Logger
+}
+
+func NewLDAPSyncUsecase(
+	repo *pg.LDAPSyncRepository,
+	authRepo *pg.AuthRepo,
+	kbRepo *pg.KnowledgeBaseRepository,
+	cache *cache.Cache,
+	logger *log.Logger,
+) *LDAPSyncUsecase {
+	return &LDAPSyncUsecase{
+		repo:     repo,
+		authRepo: authRepo,
+		kbRepo:   kbRepo,
+		cache:    cache,
+		logger:   logger.WithModule("usecase.ldap_sync"),
+	}
+}
+
+func (u *LDAPSyncUsecase) GetSettings(ctx context.Context, kbID string) (*domain.LDAPSyncSettingsResp, error) {
+	settings, err := u.repo.GetSettings(ctx, kbID)
+	if err != nil {
+		return nil, err
+	}
+	resp := &domain.LDAPSyncSettingsResp{LDAPSyncSettings: *settings, HasBindPassword: settings.BindPassword != ""}
+	resp.BindPassword = ""
+	return resp, nil
+}
+
+func (u *LDAPSyncUsecase) UpdateSettings(ctx context.Context, req *domain.UpdateLDAPSyncSettingsReq) error {
+	settings := req.LDAPSyncSettings
+	if settings.Enabled && (settings.ServerURL == "" || settings.BindDN == "" || settings.UserBaseDN == "") {
+		return fmt.Errorf("server url, bind dn and user base dn are required to enable sync")
+	}
+	if settings.BindPassword == "" {
+		old, err := u.repo.GetSettings(ctx, req.KBID)
+		if err != nil {
+			return err
+		}
+		settings.BindPassword = old.BindPassword
+	}
+	return u.repo.UpsertSettings(ctx, req.KBID, &settings)
+}
+
+func (u *LDAPSyncUsecase) ListRuns(ctx context.Context, req *domain.LDAPSyncRunListReq) (*domain.PaginatedResult[[]*domain.LDAPSyncRun], error) {
+	total, runs, err := u.repo.ListRuns(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewPaginatedResult(runs, uint64(total)), nil
+}
+
+// SyncDue syncs every enabled kb whose last sync is older than its interval.
+func (u *LDAPSyncUsecase) SyncDue(ctx context.Context) error {
+	settings, err := u.repo.ListEnabledSettings(ctx)
+	if err != nil {
+		return err
+	}
+	lastRuns, err := u.repo.GetLatestRunTimes(ctx)
+	if err != nil {
+		return err
+	}
+	for kbID, s := range settings {
+		if last, ok := lastRuns[kbID]; ok && time.Since(last) < s.Interval() {
+			continue
+		}
+		if _, err := u.Sync(ctx, kbID, domain.LDAPSyncTriggerSchedule, false); err != nil && !errors.Is(err, domain.ErrLDAPSyncRunning) {
+			u.logger.Error("scheduled LDAP sync failed", log.String("kb_id", kbID), log.Error(err))
+		}
+	}
+	return nil
+}
+
+// Sync pulls the directory and applies it to the LDAP auth groups of the kb. The directory is
+// the source of truth: memberships missing from it are removed, and so are the LDAP auth
+// groups whose directory group is gone. A dry run only records the diff.
+func (u *LDAPSyncUsecase) Sync(ctx context.Context, kbID string, trigger domain.LDAPSyncTrigger, dryRun bool) (*domain.LDAPSyncRun, error) {
+	settings, err := u.repo.GetSettings(ctx, kbID)
+	if err != nil {
+		return nil, err
+	}
+	if settings.ServerURL == "" {
+		return nil, fmt.Errorf("LDAP sync is not configured")
+	}
+	kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, kbID)
+	if err != nil {
+		return nil, err
+	}
+	if kb.AccessSettings.SourceType != consts.SourceTypeLDAP {
+		return nil, fmt.Errorf("enterprise auth of the knowledge base is not LDAP")
+	}
+
+	if !dryRun {
+		lockKey := fmt.Sprintf("ldap_sync:lock:%s", kbID)
+		locked, err := u.cache.SetNX(ctx, lockKey, 1, ldapSyncLockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if !locked {
+			return nil, domain.ErrLDAPSyncRunning
+		}
+		defer u.cache.Del(context.Background(), lockKey)
+	}
+
+	run := &domain.LDAPSyncRun{
+		ID:        uuid.New().String(),
+		KBID:      kbID,
+		Trigger:   trigger,
+		DryRun:    dryRun,
+		Status:    domain.LDAPSyncStatusRunning,
+		CreatedAt: time.Now(),
+	}
+	if err := u.repo.CreateRun(ctx, run); err != nil {
+		return nil, err
+	}
+
+	runErr := u.sync(ctx, kbID, settings, run)
+	run.Status = domain.LDAPSyncStatusSuccess
+	if runErr != nil {
+		run.Status = domain.LDAPSyncStatusFailed
+		run.Error = runErr.Error()
+	}
+	run.FinishedAt = lo.ToPtr(time.Now())
+	if err := u.repo.UpdateRun(ctx, run); err != nil {
+		u.logger.Error("update LDAP sync run failed", log.String("run_id", run.ID), log.Error(err))
+	}
+	if runErr != nil {
+		return run, runErr
+	}
+	return run, nil
+}
+
+func (u *LDAPSyncUsecase) sync(ctx context.Context, kbID string, settings *domain.LDAPSyncSettings, run *domain.LDAPSyncRun) error {
+	client, err := ldap.NewClient(ctx, u.logger, ldap.Config{
+		ServerURL:       settings.ServerURL,
+		BindDN:          settings.BindDN,
+		BindPassword:    settings.BindPassword,
+		UserBaseDN:      settings.UserBaseDN,
+		UserFilter:      settings.UserFilter,
+		UserIDAttr:      settings.UserIDAttr,
+		UserNameAttr:    settings.UserNameAttr,
+		UserEmailAttr:   settings.UserEmailAttr,
+		GroupBaseDN:     settings.GroupBaseDN,
+		GroupFilter:     settings.GroupFilter,
+		GroupNameAttr:   settings.GroupNameAttr,
+		GroupMemberAttr: settings.GroupMemberAttr,
+	})
+	if err != nil {
+		return err
+	}
+	dir, err := client.Snapshot()
+	if err != nil {
+		return err
+	}
+	auths, err := u.authRepo.ListAuthsBySource(ctx, kbID, consts.SourceTypeLDAP, "", "")
+	if err != nil {
+		return err
+	}
+	groups, err := u.authRepo.ListAuthGroupsBySource(ctx, kbID, consts.SourceTypeLDAP)
+	if err != nil {
+		return err
+	}
+
+	plan := planLDAPSync(kbID, dir, auths, groups, &run.Result)
+	if run.DryRun {
+		return nil
+	}
+	return u.repo.ApplyPlan(ctx, kbID, plan)
+}
+
+// planLDAPSync diffs the directory against the LDAP readers and auth groups of the kb. Readers
+// are matched by union id, the user id or the DN without one like at login, and groups by DN.
+func planLDAPSync(kbID string, dir *ldap.Directory, auths []domain.Auth, groups []domain.AuthGroup, result *domain.LDAPSyncResult) *domain.LDAPSyncPlan {
+	plan := &domain.LDAPSyncPlan{}
+	result.Warnings = append(result.Warnings, dir.Warnings...)
+
+	authsByUnionID := lo.SliceToMap(auths, func(a domain.Auth) (string, domain.Auth) { return a.UnionID, a })
+	authsByID := lo.SliceToMap(auths, func(a domain.Auth) (uint, domain.Auth) { return a.ID, a })
+
+	users := make(map[string]*ldap.UserInfo, len(dir.Users))
+	unionIDs := make(map[string]string, len(dir.Users))
+	for _, user := range dir.Users {
+		unionID := lo.CoalesceOrEmpty(user.ID, user.DN)
+		if existing, ok := users[unionID]; ok {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s has the same id as %s, skipped", user.DN, existing.DN))
+			continue
+		}
+		users[unionID] = user
+		unionIDs[ldap.NormalizeDN(user.DN)] = unionID
+	}
+
+	// only the members of the synced groups are provisioned
+	memberUnionIDs := make(map[string][]string, len(dir.Groups))
+	provisioned := make(map[string]bool)
+	for _, group := range dir.Groups {
+		ids := make([]string, 0, len(group.UserDNs))
+		for _, dn := range group.UserDNs {
+			if unionID, ok := unionIDs[ldap.NormalizeDN(dn)]; ok {
+				ids = append(ids, unionID)
+				provisioned[unionID] = true
+			}
+		}
+		sort.Strings(ids)
+		memberUnionIDs[group.DN] = lo.Uniq(ids)
+	}
+	provisionedIDs := lo.Keys(provisioned)
+	sort.Strings(provisionedIDs)
+	for _, unionID := range provisionedIDs {
+		user := users[unionID]
+		existing, ok := authsByUnionID[unionID]
+		if !ok {
+			plan.CreateAuths = append(plan.CreateAuths, &domain.Auth{
+				KBID:       kbID,
+				UnionID:    unionID,
+				SourceType: consts.SourceTypeLDAP,
+				UserInfo:   domain.AuthUserInfo{Username: user.Username, Email: user.Email},
+			})
+			result.Add(&domain.LDAPSyncChange{Type: domain.LDAPSyncChangeUser, DiffType: domain.KBReleaseDocDiffAdded, DN: user.DN, Name: user.Username})
+			continue
+		}
+		if existing.UserInfo.Username == user.Username && existing.UserInfo.Email == user.Email {
+			continue
+		}
+		updated := existing
+		updated.UserInfo.Username = user.Username
+		updated.UserInfo.Email = user.Email
+		plan.UpdateAuths = append(plan.UpdateAuths, &updated)
+		result.Add(&domain.LDAPSyncChange{Type: domain.LDAPSyncChangeUser, DiffType: domain.KBReleaseDocDiffChanged, DN: user.DN, Name: user.Username})
+	}
+
+	existingGroups := make(map[string]domain.AuthGroup, len(groups))
+	for _, group := range groups {
+		key := ldap.NormalizeDN(group.SyncId)
+		if _, ok := existingGroups[key]; !ok {
+			existingGroups[key] = group
+		}
+	}
+	kept := make(map[uint]bool, len(dir.Groups))
+	for _, group := range dir.Groups {
+		synced := &domain.LDAPSyncGroup{
+			DN:             group.DN,
+			Name:           lo.Substring(group.Name, 0, 100),
+			ParentDN:       group.ParentDN,
+			MemberUnionIDs: memberUnionIDs[group.DN],
+		}
+		plan.Groups = append(plan.Groups, synced)
+
+		var oldMembers []string
+		existing, ok := existingGroups[ldap.NormalizeDN(group.DN)]
+		if !ok {
+			result.Add(&domain.LDAPSyncChange{Type: domain.LDAPSyncChangeGroup, DiffType: domain.KBReleaseDocDiffAdded, DN: group.DN, Name: synced.Name})
+		} else {
+			synced.ID = existing.ID
+			kept[existing.ID] = true
+			if existing.Name != synced.Name || existing.SyncId != group.DN ||
+				ldap.NormalizeDN(existing.SyncParentId) != ldap.NormalizeDN(group.ParentDN) {
+				result.Add(&domain.LDAPSyncChange{Type: domain.LDAPSyncChangeGroup, DiffType: domain.KBReleaseDocDiffChanged, DN: group.DN, Name: synced.Name})
+			}
+			for _, id := range existing.AuthIDs {
+				auth, ok := authsByID[uint(id)]
+				if !ok {
+					// readers of other sources added by hand are not members of the directory group
+					result.Add(&domain.LDAPSyncChange{Type: domain.LDAPSyncChangeMembership, DiffType: domain.KBReleaseDocDiffRemoved, Name: fmt.Sprintf("#%d", id), Group: group.DN})
+					continue
+				}
+				oldMembers = append(oldMembers, auth.UnionID)
+			}
+		}
+
+		added, removed := lo.Difference(synced.MemberUnionIDs, oldMembers)
+		for _, unionID := range added {
+			user := users[unionID]
+			result.Add(&domain.LDAPSyncChange{Type: domain.LDAPSyncChangeMembership, DiffType: domain.KBReleaseDocDiffAdded, DN: user.DN, Name: user.Username, Group: group.DN})
+		}
+		for _, unionID := range removed {
+			change := &domain.LDAPSyncChange{Type: domain.LDAPSyncChangeMembership, DiffType: domain.KBReleaseDocDiffRemoved, Name: authsByUnionID[unionID].UserInfo.Username, Group: group.DN}
+			if user, ok := users[unionID]; ok {
+				change.DN = user.DN
+			}
+			result.Add(change)
+		}
+	}
+
+	for _, group := range groups {
+		if kept[group.ID] {
+			continue
+		}
+		plan.RemoveGroupIDs = append(plan.RemoveGroupIDs, group.ID)
+		result.Add(&domain.LDAPSyncChange{Type: domain.LDAPSyncChangeGroup, DiffType: domain.KBReleaseDocDiffRemoved, DN: group.SyncId, Name: group.Name})
+	}
+	return plan
+}
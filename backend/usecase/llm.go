@@ -34,11 +34,16 @@ type LLMUsecase struct {
 	nodeRepo         *pg.NodeRepository
 	modelRepo        *pg.ModelRepository
 	promptRepo       *pg.PromptRepo
+	retrievalRepo    *pg.RetrievalSettingRepo
 	config           *config.Config
 	logger           *log.Logger
 	modelkit         *modelkit.ModelKit
 }
 
+const (
+	keywordSearchLimit = 10 // max node releases returned by keyword retrieval
+)
+
 const (
 	summaryChunkTokenLimit = 30720 // 30KB tokens per chunk
 	summaryMaxChunks       = 4     // max chunks to process for summary
@@ -61,7 +66,7 @@ var promptTemplateVariableWhitelistSet = func() map[string]struct{} {
 	return set
 }()
 
-func NewLLMUsecase(config *config.Config, rag rag.RAGService, conversationRepo *pg.ConversationRepository, kbRepo *pg.KnowledgeBaseRepository, nodeRepo *pg.NodeRepository, modelRepo *pg.ModelRepository, promptRepo *pg.PromptRepo, logger *log.Logger) *LLMUsecase {
+func NewLLMUsecase(config *config.Config, rag rag.RAGService, conversationRepo *pg.ConversationRepository, kbRepo *pg.KnowledgeBaseRepository, nodeRepo *pg.NodeRepository, modelRepo *pg.ModelRepository, promptRepo *pg.PromptRepo, retrievalRepo *pg.RetrievalSettingRepo, logger *log.Logger) *LLMUsecase {
 	tiktoken.SetBpeLoader(&utils.Localloader{})
 	modelkit := modelkit.NewModelKit(logger.Logger)
 	return &LLMUsecase{
@@ -72,6 +77,7 @@ func NewLLMUsecase(config *config.Config, rag rag.RAGService, conversationRepo *
 		nodeRepo:         nodeRepo,
 		modelRepo:        modelRepo,
 		promptRepo:       promptRepo,
+		retrievalRepo:    retrievalRepo,
 		logger:           logger.WithModule("usecase.llm"),
 		modelkit:         modelkit,
 	}
@@ -84,76 +90,154 @@ func (u *LLMUsecase) BuildConversationMessageWithRAG(
 	groupIDs []int,
 	systemPrompt string,
 ) ([]*schema.Message, []*domain.RankedNodeChunks, error) {
-	messages := make([]*schema.Message, 0)
-	rankedNodes := make([]*domain.RankedNodeChunks, 0)
+	historyMessages, err := u.GetConversationHistory(ctx, conversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return u.BuildMessageWithRAG(ctx, kbID, groupIDs, systemPrompt, historyMessages)
+}
 
+// GetConversationHistory returns the user and assistant messages of the conversation, the
+// last one is the question being answered.
+func (u *LLMUsecase) GetConversationHistory(ctx context.Context, conversationID string) ([]*schema.Message, error) {
 	msgs, err := u.conversationRepo.GetConversationMessagesByID(ctx, conversationID)
 	if err != nil {
 		u.logger.Error("get conversation messages failed", log.Error(err))
-		return nil, nil, errors.New("get conversation messages failed")
-	}
-	if len(msgs) > 0 {
-		historyMessages := make([]*schema.Message, 0)
-		for _, msg := range msgs {
-			switch msg.Role {
-			case schema.Assistant:
-				historyMessages = append(historyMessages, schema.AssistantMessage(msg.Content, nil))
-			case schema.User:
-				content := u.formatMessageWithImages(msg.Content, msg.ImagePaths)
-				historyMessages = append(historyMessages, schema.UserMessage(content))
-			default:
-				continue
-			}
+		return nil, errors.New("get conversation messages failed")
+	}
+	historyMessages := make([]*schema.Message, 0)
+	for _, msg := range msgs {
+		switch msg.Role {
+		case schema.Assistant:
+			historyMessages = append(historyMessages, schema.AssistantMessage(msg.Content, nil))
+		case schema.User:
+			content := u.formatMessageWithImages(msg.Content, msg.ImagePaths)
+			historyMessages = append(historyMessages, schema.UserMessage(content))
+		default:
+			continue
 		}
-		if len(historyMessages) > 0 {
-			question := historyMessages[len(historyMessages)-1].Content
-			var rewrittenQuery string
-			if systemPrompt == "" {
-				if settingPrompt, err := u.promptRepo.GetPromptContent(ctx, kbID); err != nil {
-					u.logger.Error("get prompt from settings failed", log.Error(err))
-				} else {
-					if settingPrompt != "" {
-						systemPrompt = settingPrompt
-					} else {
-						systemPrompt = domain.SystemDefaultPrompt
-					}
-				}
-			}
+	}
+	return historyMessages, nil
+}
 
-			template := prompt.FromMessages(schema.GoTemplate,
-				schema.SystemMessage(systemPrompt),
-				schema.UserMessage(domain.UserQuestionFormatter),
-			)
-			kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, kbID)
-			if err != nil {
-				u.logger.Error("get kb failed", log.Error(err))
-				return nil, nil, errors.New("get kb failed")
-			}
-			rewrittenQuery, rankedNodes, err = u.GetRankNodes(ctx, GetRankNodesRequest{
-				DatasetID:           kb.DatasetID,
-				Question:            question,
-				GroupIDs:            groupIDs,
-				SimilarityThreshold: 0.2,
-				HistoryMessages:     historyMessages[:len(historyMessages)-1],
-			})
-			if err != nil {
-				u.logger.Error("get rank nodes failed", log.Error(err))
-				return nil, nil, errors.New("get rank nodes failed")
-			}
-			documents := domain.FormatNodeChunks(rankedNodes, kb.AccessSettings.BaseURL)
-			u.logger.Debug("documents", log.String("documents", documents))
-
-			formattedMessages, err := template.Format(ctx, map[string]any{
-				"CurrentDate": time.Now().Format("2006-01-02"),
-				"Question":    rewrittenQuery,
-				"Documents":   documents,
-			})
-			if err != nil {
-				u.logger.Error("format messages failed", log.Error(err))
-				return nil, nil, errors.New("format messages failed")
-			}
-			messages = slices.Insert(formattedMessages, 1, historyMessages[:len(historyMessages)-1]...)
+// BuildMessageWithRAG answers the last of historyMessages, which must be the user question,
+// with the documents retrieved for it. An empty systemPrompt uses the prompt of the kb.
+func (u *LLMUsecase) BuildMessageWithRAG(
+	ctx context.Context,
+	kbID string,
+	groupIDs []int,
+	systemPrompt string,
+	historyMessages []*schema.Message,
+) ([]*schema.Message, []*domain.RankedNodeChunks, error) {
+	messages := make([]*schema.Message, 0)
+	rankedNodes := make([]*domain.RankedNodeChunks, 0)
+	if len(historyMessages) == 0 {
+		return messages, rankedNodes, nil
+	}
+
+	question := historyMessages[len(historyMessages)-1].Content
+	var rewrittenQuery string
+	template := prompt.FromMessages(schema.GoTemplate,
+		schema.SystemMessage(u.resolveSystemPrompt(ctx, kbID, systemPrompt)),
+		schema.UserMessage(domain.UserQuestionFormatter),
+	)
+	kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, kbID)
+	if err != nil {
+		u.logger.Error("get kb failed", log.Error(err))
+		return nil, nil, errors.New("get kb failed")
+	}
+	rewrittenQuery, rankedNodes, err = u.GetRankNodes(ctx, GetRankNodesRequest{
+		KBID:                kbID,
+		DatasetID:           kb.DatasetID,
+		Question:            question,
+		GroupIDs:            groupIDs,
+		SimilarityThreshold: 0.2,
+		HistoryMessages:     historyMessages[:len(historyMessages)-1],
+	})
+	if err != nil {
+		u.logger.Error("get rank nodes failed", log.Error(err))
+		return nil, nil, errors.New("get rank nodes failed")
+	}
+	documents := domain.FormatNodeChunks(rankedNodes, kb.AccessSettings.BaseURL)
+	u.logger.Debug("documents", log.String("documents", documents))
+
+	formattedMessages, err := template.Format(ctx, map[string]any{
+		"CurrentDate": time.Now().Format("2006-01-02"),
+		"Question":    rewrittenQuery,
+		"Documents":   documents,
+	})
+	if err != nil {
+		u.logger.Error("format messages failed", log.Error(err))
+		return nil, nil, errors.New("format messages failed")
+	}
+	messages = slices.Insert(formattedMessages, 1, historyMessages[:len(historyMessages)-1]...)
+	return messages, rankedNodes, nil
+}
+
+// resolveSystemPrompt falls back to the prompt of the kb when systemPrompt is empty.
+func (u *LLMUsecase) resolveSystemPrompt(ctx context.Context, kbID, systemPrompt string) string {
+	if systemPrompt != "" {
+		return systemPrompt
+	}
+	settingPrompt, err := u.promptRepo.GetPromptContent(ctx, kbID)
+	if err != nil {
+		u.logger.Error("get prompt from settings failed", log.Error(err))
+		return ""
+	}
+	if settingPrompt != "" {
+		return settingPrompt
+	}
+	return domain.SystemDefaultPrompt
+}
+
+// BuildOpenAIMessages puts the system prompt in front of the messages of an OpenAI-compatible
+// request. Without tools the documents for the last user message are retrieved up front like
+// in a normal chat, with tools the model searches the kb itself.
+func (u *LLMUsecase) BuildOpenAIMessages(
+	ctx context.Context,
+	kbID string,
+	groupIDs []int,
+	systemPrompt string,
+	question string,
+	options *domain.OpenAIChatOptions,
+) ([]*schema.Message, []*domain.RankedNodeChunks, error) {
+	var messages []*schema.Message
+	var rankedNodes []*domain.RankedNodeChunks
+	last := options.Messages[len(options.Messages)-1]
+	if !options.UseTools() && last.Role == schema.User {
+		var err error
+		messages, rankedNodes, err = u.BuildMessageWithRAG(ctx, kbID, groupIDs, systemPrompt, options.Messages)
+		if err != nil {
+			return nil, nil, err
 		}
+	} else {
+		template := prompt.FromMessages(schema.GoTemplate,
+			schema.SystemMessage(u.resolveSystemPrompt(ctx, kbID, systemPrompt)),
+		)
+		formattedMessages, err := template.Format(ctx, map[string]any{
+			"CurrentDate": time.Now().Format("2006-01-02"),
+			"Question":    question,
+			"Documents":   "",
+		})
+		if err != nil {
+			u.logger.Error("format messages failed", log.Error(err))
+			return nil, nil, errors.New("format messages failed")
+		}
+		if options.UseTools() {
+			formattedMessages[0].Content += domain.OpenAIToolPrompt
+		}
+		messages = append(formattedMessages, options.Messages...)
+	}
+
+	switch options.ResponseFormat {
+	case domain.OpenAIResponseFormatJSONObject:
+		messages[0].Content += domain.OpenAIJSONObjectPrompt
+	case domain.OpenAIResponseFormatJSONSchema:
+		jsonSchema, err := json.Marshal(options.JSONSchema.Schema)
+		if err != nil {
+			return nil, nil, err
+		}
+		messages[0].Content += fmt.Sprintf(domain.OpenAIJSONSchemaPrompt, jsonSchema)
 	}
 	return messages, rankedNodes, nil
 }
@@ -431,6 +515,24 @@ func (u *LLMUsecase) UpdatePromptSettings(ctx context.Context, req *domain.Updat
 	return u.GetPromptSettings(ctx, req.KBID)
 }
 
+func (u *LLMUsecase) GetRetrievalSettings(ctx context.Context, kbID string) (*domain.RetrievalSettings, error) {
+	return u.retrievalRepo.GetRetrievalSettings(ctx, kbID)
+}
+
+func (u *LLMUsecase) UpdateRetrievalSettings(ctx context.Context, req *domain.UpdateRetrievalSettingsReq) (*domain.RetrievalSettings, error) {
+	if req.VectorWeight == 0 && req.KeywordWeight == 0 {
+		return nil, domain.ErrInvalidRetrievalWeights
+	}
+	settings := req.RetrievalSettings
+	if settings.RRFK == 0 {
+		settings.RRFK = domain.DefaultRRFK
+	}
+	if err := u.retrievalRepo.UpsertRetrievalSettings(ctx, req.KBID, &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
 func (u *LLMUsecase) RollbackPromptVersion(ctx context.Context, req *domain.RollbackPromptVersionReq, operatorUserID string) (*domain.RollbackPromptVersionResp, error) {
 	version, err := u.promptRepo.GetPromptVersionDetail(ctx, req.KBID, req.Version)
 	if err != nil {
@@ -590,6 +692,7 @@ func (u *LLMUsecase) SplitByTokenLimit(text string, maxTokens int) ([]string, er
 }
 
 type GetRankNodesRequest struct {
+	KBID                string // enables keyword retrieval and per-kb fusion weights
 	DatasetID           string
 	Question            string
 	GroupIDs            []int
@@ -613,6 +716,8 @@ func (u *LLMUsecase) GetRankNodes(ctx context.Context, req GetRankNodesRequest)
 		return "", nil, fmt.Errorf("get records from raglite failed: %w", err)
 	}
 	u.logger.Info("get related documents from raglite", log.Any("record_count", len(records)))
+	keywordRecords, settings := u.getKeywordRecords(ctx, req)
+	records = fuseRecords(records, keywordRecords, settings, req.MaxChunksPerDoc)
 	rankedNodesMap := make(map[string]*domain.RankedNodeChunks)
 	// get raw node by doc_id
 	if len(records) > 0 {
@@ -647,6 +752,54 @@ func (u *LLMUsecase) GetRankNodes(ctx context.Context, req GetRankNodesRequest)
 	return rewrittenQuery, rankedNodes, nil
 }
 
+// getKeywordRecords runs the full-text retriever when the kb has it enabled.
+// Failures only degrade to vector-only retrieval.
+func (u *LLMUsecase) getKeywordRecords(ctx context.Context, req GetRankNodesRequest) ([]*domain.NodeContentChunk, *domain.RetrievalSettings) {
+	if req.KBID == "" {
+		return nil, domain.DefaultRetrievalSettings()
+	}
+	settings, err := u.retrievalRepo.GetRetrievalSettings(ctx, req.KBID)
+	if err != nil {
+		u.logger.Warn("get retrieval settings failed, use defaults", log.String("kb_id", req.KBID), log.Error(err))
+		settings = domain.DefaultRetrievalSettings()
+	}
+	if settings.KeywordWeight <= 0 {
+		return nil, settings
+	}
+	records, err := u.nodeRepo.SearchNodeReleasesByKeyword(ctx, req.KBID, req.Question, req.GroupIDs, keywordSearchLimit)
+	if err != nil {
+		u.logger.Warn("keyword search failed", log.String("kb_id", req.KBID), log.Error(err))
+		return nil, settings
+	}
+	u.logger.Info("get related documents from keyword search", log.Any("record_count", len(records)))
+	return records, settings
+}
+
+// fuseRecords reorders vector chunks by reciprocal-rank fusion with keyword hits.
+// Chunks of one doc stay together; keyword excerpts are appended to a doc
+// while it has fewer than maxChunksPerDoc chunks (0 means no limit).
+func fuseRecords(vectorRecords, keywordRecords []*domain.NodeContentChunk, settings *domain.RetrievalSettings, maxChunksPerDoc int) []*domain.NodeContentChunk {
+	chunksByDoc := make(map[string][]*domain.NodeContentChunk)
+	vectorDocIDs := make([]string, 0, len(vectorRecords))
+	for _, record := range vectorRecords {
+		vectorDocIDs = append(vectorDocIDs, record.DocID)
+		chunksByDoc[record.DocID] = append(chunksByDoc[record.DocID], record)
+	}
+	keywordDocIDs := make([]string, 0, len(keywordRecords))
+	for _, record := range keywordRecords {
+		keywordDocIDs = append(keywordDocIDs, record.DocID)
+		if chunks := chunksByDoc[record.DocID]; maxChunksPerDoc <= 0 || len(chunks) < maxChunksPerDoc {
+			chunksByDoc[record.DocID] = append(chunks, record)
+		}
+	}
+
+	fused := make([]*domain.NodeContentChunk, 0, len(vectorRecords)+len(keywordRecords))
+	for _, docID := range settings.Fuse(vectorDocIDs, keywordDocIDs) {
+		fused = append(fused, chunksByDoc[docID]...)
+	}
+	return fused
+}
+
 // formatMessageWithImages converts image paths to markdown format and appends to message
 func (u *LLMUsecase) formatMessageWithImages(message string, imagePaths []string) string {
 	if len(imagePaths) == 0 {
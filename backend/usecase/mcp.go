@@ -0,0 +1,276 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/repo/pg"
+	"github.com/chaitin/panda-wiki/store/rag"
+	"github.com/chaitin/panda-wiki/utils"
+)
+
+const (
+	mcpSnippetLimit      = 300
+	mcpResourcesPageSize = 100
+)
+
+// MCPUsecase serves the tools and resources of the public MCP server.
+// The MCP client is anonymous, so only nodes open to everyone are exposed.
+type MCPUsecase struct {
+	llmUsecase  *LLMUsecase
+	chatUsecase *ChatUsecase
+	nodeUsecase *NodeUsecase
+	kbRepo      *pg.KnowledgeBaseRepository
+	nodeRepo    *pg.NodeRepository
+	mdConv      *converter.Converter
+	logger      *log.Logger
+}
+
+func NewMCPUsecase(
+	llmUsecase *LLMUsecase,
+	chatUsecase *ChatUsecase,
+	nodeUsecase *NodeUsecase,
+	kbRepo *pg.KnowledgeBaseRepository,
+	nodeRepo *pg.NodeRepository,
+	logger *log.Logger,
+) *MCPUsecase {
+	return &MCPUsecase{
+		llmUsecase:  llmUsecase,
+		chatUsecase: chatUsecase,
+		nodeUsecase: nodeUsecase,
+		kbRepo:      kbRepo,
+		nodeRepo:    nodeRepo,
+		mdConv:      rag.NewHTML2MDConverter(),
+		logger:      logger.WithModule("usecase.mcp"),
+	}
+}
+
+// SearchDocs retrieves the released docs most relevant to query with the same hybrid retrieval as chat.
+func (u *MCPUsecase) SearchDocs(ctx context.Context, kbID, query string, limit int) ([]*domain.MCPDoc, error) {
+	kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, kbID)
+	if err != nil {
+		return nil, err
+	}
+	_, rankedNodes, err := u.llmUsecase.GetRankNodes(ctx, GetRankNodesRequest{
+		KBID:                kbID,
+		DatasetID:           kb.DatasetID,
+		Question:            query,
+		SimilarityThreshold: 0.2,
+		MaxChunksPerDoc:     1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	nodesMap, err := u.nodeRepo.GetNodesByIDs(ctx, lo.Map(rankedNodes, func(node *domain.RankedNodeChunks, _ int) string {
+		return node.NodeID
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]*domain.MCPDoc, 0, limit)
+	for _, node := range rankedNodes {
+		if len(docs) >= limit {
+			break
+		}
+		if nodeInfo, ok := nodesMap[node.NodeID]; !ok || nodeInfo.Permissions.Visitable != consts.NodeAccessPermOpen {
+			continue
+		}
+		doc := &domain.MCPDoc{
+			NodeID:    node.NodeID,
+			Name:      node.NodeName,
+			PathNames: node.NodePathNames,
+			Summary:   node.NodeSummary,
+			URL:       node.GetURL(kb.AccessSettings.BaseURL),
+		}
+		if len(node.Chunks) > 0 {
+			doc.Snippet = truncateRunes(node.Chunks[0].Content, mcpSnippetLimit)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// GetNode returns the released content of a public node as markdown.
+func (u *MCPUsecase) GetNode(ctx context.Context, kbID, nodeID string) (*domain.MCPNode, error) {
+	node, err := u.nodeRepo.GetNodeReleaseDetailByKBIDAndID(ctx, kbID, nodeID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrMCPNodeNotFound
+		}
+		return nil, err
+	}
+	if node.Permissions.Visitable != consts.NodeAccessPermOpen {
+		return nil, domain.ErrMCPNodeNotFound
+	}
+	kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, kbID)
+	if err != nil {
+		return nil, err
+	}
+
+	content := node.Content
+	if node.Meta.ContentType != domain.ContentTypeMD && utils.IsLikelyHTML(content) {
+		markdown, err := u.mdConv.ConvertString(content)
+		if err != nil {
+			u.logger.Warn("convert node html to markdown failed", log.String("node_id", nodeID), log.Error(err))
+		} else {
+			content = markdown
+		}
+	}
+	return &domain.MCPNode{
+		NodeID:    node.ID,
+		Name:      node.Name,
+		Summary:   node.Meta.Summary,
+		Content:   content,
+		URL:       fmt.Sprintf("%s/node/%s", kb.AccessSettings.BaseURL, node.ID),
+		UpdatedAt: node.UpdatedAt,
+	}, nil
+}
+
+// ListTree returns the released nav tree visible to anonymous users.
+// With parentID set only that subtree is returned.
+func (u *MCPUsecase) ListTree(ctx context.Context, kbID, parentID string) ([]*domain.MCPTreeNode, error) {
+	items, err := u.nodeUsecase.GetNodeReleaseListByKBID(ctx, kbID, 0)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(items, func(a, b *domain.ShareNodeListItemResp) int {
+		switch {
+		case a.Position < b.Position:
+			return -1
+		case a.Position > b.Position:
+			return 1
+		default:
+			return 0
+		}
+	})
+	children := make(map[string][]*domain.ShareNodeListItemResp)
+	for _, item := range items {
+		children[item.ParentID] = append(children[item.ParentID], item)
+	}
+	var build func(parentID string, depth int) []*domain.MCPTreeNode
+	build = func(parentID string, depth int) []*domain.MCPTreeNode {
+		if depth > 20 {
+			return nil
+		}
+		nodes := make([]*domain.MCPTreeNode, 0, len(children[parentID]))
+		for _, item := range children[parentID] {
+			nodes = append(nodes, &domain.MCPTreeNode{
+				NodeID:   item.ID,
+				Name:     item.Name,
+				Type:     item.Type,
+				Emoji:    item.Emoji,
+				Children: build(item.ID, depth+1),
+			})
+		}
+		return nodes
+	}
+	return build(parentID, 0), nil
+}
+
+// AskQuestion runs the full RAG chat and collects the streamed answer.
+func (u *MCPUsecase) AskQuestion(ctx context.Context, kbID, question, remoteIP string) (*domain.MCPAnswer, error) {
+	kb, err := u.kbRepo.GetKnowledgeBaseByID(ctx, kbID)
+	if err != nil {
+		return nil, err
+	}
+	eventCh, err := u.chatUsecase.Chat(ctx, &domain.ChatRequest{
+		Message:  question,
+		KBID:     kbID,
+		AppType:  domain.AppTypeMcpServer,
+		RemoteIP: remoteIP,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &domain.MCPAnswer{References: make([]*domain.MCPDoc, 0)}
+	var answer strings.Builder
+	var chatErr error
+	for event := range eventCh {
+		switch event.Type {
+		case "data":
+			answer.WriteString(event.Content)
+		case "chunk_result":
+			if event.ChunkResult != nil {
+				result.References = append(result.References, &domain.MCPDoc{
+					NodeID:    event.ChunkResult.NodeID,
+					Name:      event.ChunkResult.Name,
+					PathNames: event.ChunkResult.NodePathNames,
+					Summary:   event.ChunkResult.Summary,
+					URL:       fmt.Sprintf("%s/node/%s", kb.AccessSettings.BaseURL, event.ChunkResult.NodeID),
+				})
+			}
+		case "error":
+			if chatErr == nil {
+				chatErr = errors.New(event.Content)
+			}
+		}
+	}
+	if chatErr != nil {
+		return nil, chatErr
+	}
+	result.Answer = stripThink(answer.String())
+	return result, nil
+}
+
+// ListResources pages through the public released docs as MCP resources.
+// offset is the nextCursor of the previous page; the returned next offset is 0 on the last page.
+func (u *MCPUsecase) ListResources(ctx context.Context, kbID string, offset int) ([]*domain.MCPResource, int, error) {
+	items, err := u.nodeUsecase.GetNodeReleaseListByKBID(ctx, kbID, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	docs := lo.Filter(items, func(item *domain.ShareNodeListItemResp, _ int) bool {
+		return item.Type == domain.NodeTypeDocument && item.Permissions.Visitable == consts.NodeAccessPermOpen
+	})
+	slices.SortStableFunc(docs, func(a, b *domain.ShareNodeListItemResp) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	if offset < 0 || offset >= len(docs) {
+		return make([]*domain.MCPResource, 0), 0, nil
+	}
+	end := min(offset+mcpResourcesPageSize, len(docs))
+	resources := make([]*domain.MCPResource, 0, end-offset)
+	for _, doc := range docs[offset:end] {
+		resources = append(resources, &domain.MCPResource{
+			URI:         domain.MCPResourceURI(doc.ID),
+			Name:        doc.Name,
+			Description: doc.Meta.Summary,
+			MimeType:    "text/markdown",
+		})
+	}
+	next := 0
+	if end < len(docs) {
+		next = end
+	}
+	return resources, next, nil
+}
+
+func stripThink(answer string) string {
+	if !strings.HasPrefix(answer, "<think>") {
+		return answer
+	}
+	if _, after, ok := strings.Cut(answer, "</think>"); ok {
+		return strings.TrimSpace(after)
+	}
+	return answer
+}
+
+func truncateRunes(s string, limit int) string {
+	runes := []rune(strings.TrimSpace(s))
+	if len(runes) <= limit {
+		return string(runes)
+	}
+	return string(runes[:limit]) + "..."
+}
@@ -3,10 +3,12 @@ package usecase
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/cloudwego/eino/schema"
+	"gorm.io/gorm"
 
 	modelkitDomain "github.com/chaitin/ModelKit/v2/domain"
 	modelkit "github.com/chaitin/ModelKit/v2/usecase"
@@ -30,6 +32,7 @@ type ModelUsecase struct {
 	kbRepo            *pg.KnowledgeBaseRepository
 	systemSettingRepo *pg.SystemSettingRepo
 	modelkit          *modelkit.ModelKit
+	embedder          *rag.Embedder
 }
 
 func NewModelUsecase(modelRepo *pg.ModelRepository, nodeRepo *pg.NodeRepository, ragRepo *mq.RAGRepository, ragStore rag.RAGService, logger *log.Logger, config *config.Config, kbRepo *pg.KnowledgeBaseRepository, settingRepo *pg.SystemSettingRepo) *ModelUsecase {
@@ -44,6 +47,7 @@ func NewModelUsecase(modelRepo *pg.ModelRepository, nodeRepo *pg.NodeRepository,
 		kbRepo:            kbRepo,
 		systemSettingRepo: settingRepo,
 		modelkit:          modelkit,
+		embedder:          rag.NewEmbedder(),
 	}
 	return u
 }
@@ -176,6 +180,28 @@ func (u *ModelUsecase) GetModelByType(ctx context.Context, modelType domain.Mode
 	return u.modelRepo.GetModelByType(ctx, modelType)
 }
 
+// Embed embeds texts with the embedding model and adds the tokens to its usage.
+func (u *ModelUsecase) Embed(ctx context.Context, texts []string) ([][]float32, *domain.Model, int, error) {
+	model, err := u.modelRepo.GetModelByType(ctx, domain.ModelTypeEmbedding)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, 0, domain.ErrEmbeddingModelNotConfigured
+		}
+		return nil, nil, 0, err
+	}
+	vectors, promptTokens, err := u.embedder.EmbedWithUsage(ctx, model, texts)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if promptTokens > 0 {
+		usage := &schema.TokenUsage{PromptTokens: promptTokens, TotalTokens: promptTokens}
+		if err := u.modelRepo.UpdateUsage(ctx, model.ID, usage); err != nil {
+			u.logger.Error("failed to update embedding model usage", log.Error(err))
+		}
+	}
+	return vectors, model, promptTokens, nil
+}
+
 func (u *ModelUsecase) UpdateUsage(ctx context.Context, modelID string, usage *schema.TokenUsage) error {
 	return u.modelRepo.UpdateUsage(ctx, modelID, usage)
 }
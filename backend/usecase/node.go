@@ -22,6 +22,7 @@ import (
 	"github.com/chaitin/panda-wiki/consts"
 	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/pkg/merge"
 	"github.com/chaitin/panda-wiki/repo/mq"
 	"github.com/chaitin/panda-wiki/repo/pg"
 	"github.com/chaitin/panda-wiki/store/rag"
@@ -42,6 +43,8 @@ type NodeUsecase struct {
 	s3Client     *s3.MinioClient
 	rAGService   rag.RAGService
 	modelUsecase *ModelUsecase
+	webhook      *WebhookUsecase
+	review       *NodeReviewUsecase
 }
 
 func NewNodeUsecase(
@@ -57,6 +60,8 @@ func NewNodeUsecase(
 	modelRepo *pg.ModelRepository,
 	authRepo *pg.AuthRepo,
 	modelUsecase *ModelUsecase,
+	webhook *WebhookUsecase,
+	review *NodeReviewUsecase,
 ) *NodeUsecase {
 	return &NodeUsecase{
 		nodeRepo:     nodeRepo,
@@ -71,6 +76,8 @@ func NewNodeUsecase(
 		logger:       logger.WithModule("usecase.node"),
 		s3Client:     s3Client,
 		modelUsecase: modelUsecase,
+		webhook:      webhook,
+		review:       review,
 	}
 }
 
@@ -81,6 +88,12 @@ func (u *NodeUsecase) Create(ctx context.Context, req *domain.CreateNodeReq, use
 	if err != nil {
 		return "", err
 	}
+	u.webhook.Dispatch(ctx, req.KBID, domain.WebhookEventNodeCreated, &domain.WebhookNodeData{
+		NodeID: nodeID,
+		Name:   req.Name,
+		Type:   req.Type,
+		UserID: userId,
+	})
 	return nodeID, nil
 }
 
@@ -154,6 +167,14 @@ func (u *NodeUsecase) SubmitContribute(ctx context.Context, kbID, remoteIP strin
 	}); err != nil {
 		return "", err
 	}
+	u.webhook.Dispatch(ctx, kbID, domain.WebhookEventContributeSubmitted, &domain.WebhookContributeData{
+		ContributeID: contributeIDStr,
+		Type:         req.Type,
+		Status:       consts.ContributeStatusPending,
+		NodeID:       req.NodeID,
+		Name:         req.Name,
+		Reason:       req.Reason,
+	})
 
 	return contributeIDStr, nil
 }
@@ -231,15 +252,79 @@ func (u *NodeUsecase) NodeAction(ctx context.Context, req *domain.NodeActionReq)
 		if err := u.ragRepo.AsyncUpdateNodeReleaseVector(ctx, nodeVectorContentRequests); err != nil {
 			return err
 		}
+		for _, nodeID := range req.IDs {
+			u.webhook.Dispatch(ctx, req.KBID, domain.WebhookEventNodeDeleted, &domain.WebhookNodeData{NodeID: nodeID})
+		}
 	}
 	return nil
 }
 
-func (u *NodeUsecase) Update(ctx context.Context, req *domain.UpdateNodeReq, userId string) error {
-	err := u.nodeRepo.UpdateNodeContent(ctx, req, userId)
+// Update applies an edit. An edit based on an older version is merged three-way with the changes
+// made since, a *domain.NodeConflictError is returned when both touched the same part.
+func (u *NodeUsecase) Update(ctx context.Context, req *domain.UpdateNodeReq, userId string) (*domain.UpdateNodeResp, error) {
+	merged := false
+	for attempt := 0; ; attempt++ {
+		version, err := u.nodeRepo.UpdateNodeContent(ctx, req, userId)
+		if err == nil {
+			u.webhook.Dispatch(ctx, req.KBID, domain.WebhookEventNodeUpdated, &domain.WebhookNodeData{
+				NodeID: req.ID,
+				Name:   lo.FromPtr(req.Name),
+				UserID: userId,
+			})
+			return &domain.UpdateNodeResp{Version: version, Merged: merged}, nil
+		}
+		if !errors.Is(err, domain.ErrNodeVersionMismatch) {
+			return nil, err
+		}
+		if attempt == 3 {
+			return nil, domain.ErrNodeConflict
+		}
+		// the node moved on, rebase the edit onto the current version and retry
+		if err := u.mergeNodeUpdate(ctx, req); err != nil {
+			return nil, err
+		}
+		merged = true
+	}
+}
+
+func (u *NodeUsecase) mergeNodeUpdate(ctx context.Context, req *domain.UpdateNodeReq) error {
+	current, err := u.nodeRepo.GetNodeByID(ctx, req.ID)
 	if err != nil {
 		return err
 	}
+	conflict := &domain.NodeConflictError{
+		Version: current.Version,
+		Name:    current.Name,
+		Content: current.Content,
+		Meta:    current.Meta,
+	}
+	base, err := u.nodeRepo.GetNodeRevision(ctx, req.KBID, req.ID, *req.Version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			conflict.Fields = []string{"version"}
+			return conflict
+		}
+		return err
+	}
+
+	mergeField := func(field string, ours *string, base, theirs string) {
+		if ours == nil {
+			return
+		}
+		if merged, ok := merge.Merge3(base, *ours, theirs); ok {
+			*ours = merged
+			return
+		}
+		conflict.Fields = append(conflict.Fields, field)
+	}
+	mergeField("name", req.Name, base.Name, current.Name)
+	mergeField("content", req.Content, base.Content, current.Content)
+	mergeField("emoji", req.Emoji, base.Meta.Emoji, current.Meta.Emoji)
+	mergeField("summary", req.Summary, base.Meta.Summary, current.Meta.Summary)
+	if len(conflict.Fields) > 0 {
+		return conflict
+	}
+	req.Version = &current.Version
 	return nil
 }
 
@@ -952,7 +1037,16 @@ func (u *NodeUsecase) AutoTranslateNode(ctx context.Context, req *v1.NodeAutoTra
 			return nil, err
 		}
 
-		if req.PublishToLatestRelease {
+		publish := req.PublishToLatestRelease
+		if publish {
+			// reviewed nodes keep the translation as a draft to go through review
+			covered, err := u.review.IsCovered(ctx, req.KBID, req.NodeID)
+			if err != nil {
+				return nil, err
+			}
+			publish = !covered
+		}
+		if publish {
 			releaseIDs, err := u.nodeRepo.CreateNodeReleases(ctx, req.KBID, userID, []string{req.NodeID})
 			if err != nil {
 				return nil, fmt.Errorf("create node release failed: %w", err)
@@ -0,0 +1,302 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/repo/mq"
+	"github.com/chaitin/panda-wiki/repo/pg"
+)
+
+const (
+	nodeCollabHeartbeat   = 10 * time.Second
+	nodeCollabPeerTimeout = 3 * nodeCollabHeartbeat
+	nodeCollabSendBuffer  = 256
+)
+
+// NodeCollabConn is an editor connected to this api server. Frames for it are queued on Send,
+// which is closed once the connection leaves or falls too far behind.
+type NodeCollabConn struct {
+	Peer   *domain.NodeCollabPeer
+	Send   chan *domain.NodeCollabFrame
+	closed bool
+}
+
+type nodeCollabRemotePeer struct {
+	peer     *domain.NodeCollabPeer
+	lastSeen time.Time
+}
+
+// NodeCollabUsecase runs the collaboration sessions of the editors connected to this api server.
+// Document updates are relayed verbatim, the CRDT itself (Yjs in the editor) lives in the clients;
+// the server tracks who is editing and fans updates out to the other replicas over NATS.
+type NodeCollabUsecase struct {
+	nodeRepo  *pg.NodeRepository
+	userRepo  *pg.UserRepository
+	mqRepo    *mq.NodeCollabRepository
+	replicaID string
+	logger    *log.Logger
+
+	mutex  sync.Mutex
+	local  map[string]map[string]*NodeCollabConn       // node id -> conn id
+	remote map[string]map[string]*nodeCollabRemotePeer // node id -> conn id
+}
+
+func NewNodeCollabUsecase(nodeRepo *pg.NodeRepository, userRepo *pg.UserRepository, mqRepo *mq.NodeCollabRepository, logger *log.Logger) *NodeCollabUsecase {
+	return &NodeCollabUsecase{
+		nodeRepo:  nodeRepo,
+		userRepo:  userRepo,
+		mqRepo:    mqRepo,
+		replicaID: uuid.New().String(),
+		logger:    logger.WithModule("usecase.node_collab"),
+		local:     make(map[string]map[string]*NodeCollabConn),
+		remote:    make(map[string]map[string]*nodeCollabRemotePeer),
+	}
+}
+
+func (u *NodeCollabUsecase) Join(ctx context.Context, kbID, nodeID, userID string) (*NodeCollabConn, error) {
+	node, err := u.nodeRepo.GetNodeByID(ctx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if node.KBID != kbID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	user, err := u.userRepo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &NodeCollabConn{
+		Peer: &domain.NodeCollabPeer{
+			ConnID:   uuid.New().String(),
+			KBID:     kbID,
+			NodeID:   nodeID,
+			UserID:   userID,
+			Account:  user.Account,
+			JoinedAt: time.Now(),
+		},
+		Send: make(chan *domain.NodeCollabFrame, nodeCollabSendBuffer),
+	}
+	u.mutex.Lock()
+	if u.local[nodeID] == nil {
+		u.local[nodeID] = make(map[string]*NodeCollabConn)
+	}
+	u.local[nodeID][conn.Peer.ConnID] = conn
+	u.broadcastPresence(nodeID)
+	u.mutex.Unlock()
+
+	u.publish(ctx, &domain.NodeCollabEvent{Type: domain.NodeCollabEventJoin, Peer: conn.Peer})
+	return conn, nil
+}
+
+// Leave removes the connection, it is safe to call more than once.
+func (u *NodeCollabUsecase) Leave(ctx context.Context, conn *NodeCollabConn) {
+	u.mutex.Lock()
+	conns := u.local[conn.Peer.NodeID]
+	if _, ok := conns[conn.Peer.ConnID]; !ok {
+		u.mutex.Unlock()
+		return
+	}
+	u.removeConn(conn)
+	u.broadcastPresence(conn.Peer.NodeID)
+	u.mutex.Unlock()
+
+	u.publish(ctx, &domain.NodeCollabEvent{Type: domain.NodeCollabEventLeave, Peer: conn.Peer})
+}
+
+// Relay passes a document update from conn to every other editor of the node.
+func (u *NodeCollabUsecase) Relay(ctx context.Context, conn *NodeCollabConn, data []byte) {
+	u.mutex.Lock()
+	u.deliver(conn.Peer.NodeID, conn.Peer.ConnID, &domain.NodeCollabFrame{Binary: true, Data: data})
+	u.mutex.Unlock()
+
+	u.publish(ctx, &domain.NodeCollabEvent{Type: domain.NodeCollabEventUpdate, Peer: conn.Peer, Data: data})
+}
+
+// Presence lists the editors of a node across all api servers.
+func (u *NodeCollabUsecase) Presence(kbID, nodeID string) []*domain.NodeCollabPeer {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	peers := u.presence(nodeID)
+	result := make([]*domain.NodeCollabPeer, 0, len(peers))
+	for _, peer := range peers {
+		if peer.KBID == kbID {
+			result = append(result, peer)
+		}
+	}
+	return result
+}
+
+// HandleEvent applies an event relayed by another api server.
+func (u *NodeCollabUsecase) HandleEvent(ctx context.Context, event *domain.NodeCollabEvent) {
+	if event.ReplicaID == u.replicaID {
+		return
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	now := time.Now()
+	switch event.Type {
+	case domain.NodeCollabEventJoin:
+		if event.Peer != nil && u.touchRemote(event.Peer, now) {
+			u.broadcastPresence(event.Peer.NodeID)
+		}
+	case domain.NodeCollabEventLeave:
+		if event.Peer == nil {
+			return
+		}
+		if peers := u.remote[event.Peer.NodeID]; peers[event.Peer.ConnID] != nil {
+			delete(peers, event.Peer.ConnID)
+			if len(peers) == 0 {
+				delete(u.remote, event.Peer.NodeID)
+			}
+			u.broadcastPresence(event.Peer.NodeID)
+		}
+	case domain.NodeCollabEventHeartbeat:
+		for _, peer := range event.Peers {
+			if u.touchRemote(peer, now) {
+				u.broadcastPresence(peer.NodeID)
+			}
+		}
+	case domain.NodeCollabEventUpdate:
+		if event.Peer != nil {
+			u.deliver(event.Peer.NodeID, event.Peer.ConnID, &domain.NodeCollabFrame{Binary: true, Data: event.Data})
+		}
+	}
+}
+
+// KeepAlive announces the local editors to the other api servers and expires remote editors whose
+// server stopped announcing them, until ctx is done.
+func (u *NodeCollabUsecase) KeepAlive(ctx context.Context) {
+	ticker := time.NewTicker(nodeCollabHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			u.mutex.Lock()
+			peers := make([]*domain.NodeCollabPeer, 0)
+			for _, conns := range u.local {
+				for _, conn := range conns {
+					peers = append(peers, conn.Peer)
+				}
+			}
+			for nodeID, remotePeers := range u.remote {
+				expired := false
+				for connID, remotePeer := range remotePeers {
+					if now.Sub(remotePeer.lastSeen) > nodeCollabPeerTimeout {
+						delete(remotePeers, connID)
+						expired = true
+					}
+				}
+				if len(remotePeers) == 0 {
+					delete(u.remote, nodeID)
+				}
+				if expired {
+					u.broadcastPresence(nodeID)
+				}
+			}
+			u.mutex.Unlock()
+
+			if len(peers) > 0 {
+				u.publish(ctx, &domain.NodeCollabEvent{Type: domain.NodeCollabEventHeartbeat, Peers: peers})
+			}
+		}
+	}
+}
+
+func (u *NodeCollabUsecase) publish(ctx context.Context, event *domain.NodeCollabEvent) {
+	event.ReplicaID = u.replicaID
+	if err := u.mqRepo.Publish(ctx, event); err != nil {
+		// editors on this server still work together, the others miss the event
+		u.logger.Warn("publish node collab event failed", log.String("type", event.Type), log.Error(err))
+	}
+}
+
+// touchRemote records a remote editor as alive, it reports whether the editor is new.
+// The caller must hold the mutex.
+func (u *NodeCollabUsecase) touchRemote(peer *domain.NodeCollabPeer, now time.Time) bool {
+	peers := u.remote[peer.NodeID]
+	if peers == nil {
+		peers = make(map[string]*nodeCollabRemotePeer)
+		u.remote[peer.NodeID] = peers
+	}
+	if remotePeer, ok := peers[peer.ConnID]; ok {
+		remotePeer.lastSeen = now
+		return false
+	}
+	peers[peer.ConnID] = &nodeCollabRemotePeer{peer: peer, lastSeen: now}
+	return true
+}
+
+// deliver queues a frame for the local editors of a node except the sender. Editors whose queue is
+// full are dropped, the client reconnects and resyncs. The caller must hold the mutex.
+func (u *NodeCollabUsecase) deliver(nodeID, senderConnID string, frame *domain.NodeCollabFrame) {
+	for connID, conn := range u.local[nodeID] {
+		if connID == senderConnID {
+			continue
+		}
+		select {
+		case conn.Send <- frame:
+		default:
+			u.logger.Warn("node collab connection too slow, dropping it",
+				log.String("node_id", nodeID),
+				log.String("conn_id", connID))
+			u.removeConn(conn)
+		}
+	}
+}
+
+// The caller must hold the mutex.
+func (u *NodeCollabUsecase) removeConn(conn *NodeCollabConn) {
+	conns := u.local[conn.Peer.NodeID]
+	delete(conns, conn.Peer.ConnID)
+	if len(conns) == 0 {
+		delete(u.local, conn.Peer.NodeID)
+	}
+	if !conn.closed {
+		conn.closed = true
+		close(conn.Send)
+	}
+}
+
+// The caller must hold the mutex.
+func (u *NodeCollabUsecase) presence(nodeID string) []*domain.NodeCollabPeer {
+	peers := make([]*domain.NodeCollabPeer, 0, len(u.local[nodeID])+len(u.remote[nodeID]))
+	for _, conn := range u.local[nodeID] {
+		peers = append(peers, conn.Peer)
+	}
+	for _, remotePeer := range u.remote[nodeID] {
+		peers = append(peers, remotePeer.peer)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].JoinedAt.Before(peers[j].JoinedAt)
+	})
+	return peers
+}
+
+// broadcastPresence sends the editor list of a node to its local editors.
+// The caller must hold the mutex.
+func (u *NodeCollabUsecase) broadcastPresence(nodeID string) {
+	if len(u.local[nodeID]) == 0 {
+		return
+	}
+	data, err := json.Marshal(&domain.NodeCollabPresenceMsg{Type: "presence", Peers: u.presence(nodeID)})
+	if err != nil {
+		u.logger.Error("marshal node collab presence failed", log.Error(err))
+		return
+	}
+	u.deliver(nodeID, "", &domain.NodeCollabFrame{Data: data})
+}
@@ -0,0 +1,399 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/repo/pg"
+)
+
+type NodeReviewUsecase struct {
+	repo     *pg.NodeReviewRepository
+	nodeRepo *pg.NodeRepository
+	kbRepo   *pg.KnowledgeBaseRepository
+	logger   *log.Logger
+}
+
+func NewNodeReviewUsecase(
+	repo *pg.NodeReviewRepository,
+	nodeRepo *pg.NodeRepository,
+	kbRepo *pg.KnowledgeBaseRepository,
+	logger *log.Logger,
+) *NodeReviewUsecase {
+	return &NodeReviewUsecase{
+		repo:     repo,
+		nodeRepo: nodeRepo,
+		kbRepo:   kbRepo,
+		logger:   logger.WithModule("usecase.node_review"),
+	}
+}
+
+func (u *NodeReviewUsecase) GetSettings(ctx context.Context, kbID string) (*domain.ReviewWorkflowSettings, error) {
+	return u.repo.GetSettings(ctx, kbID)
+}
+
+func (u *NodeReviewUsecase) UpdateSettings(ctx context.Context, kbID string, settings *domain.ReviewWorkflowSettings) error {
+	if err := u.requireFullControl(ctx, kbID); err != nil {
+		return err
+	}
+	for i, stage := range settings.Stages {
+		if strings.TrimSpace(stage.Name) == "" {
+			settings.Stages[i].Name = fmt.Sprintf("stage %d", i+1)
+		}
+		settings.Stages[i].ReviewerIDs = lo.Uniq(stage.ReviewerIDs)
+	}
+	settings.FolderIDs = lo.Uniq(settings.FolderIDs)
+	return u.repo.UpsertSettings(ctx, kbID, settings)
+}
+
+// coveredNodes filters nodeIDs down to the ones the workflow applies to, nil when it is disabled.
+func (u *NodeReviewUsecase) coveredNodes(ctx context.Context, kbID string, settings *domain.ReviewWorkflowSettings, nodeIDs []string) ([]string, error) {
+	if !settings.Enabled || len(nodeIDs) == 0 {
+		return nil, nil
+	}
+	if len(settings.FolderIDs) == 0 {
+		return nodeIDs, nil
+	}
+	subtree, err := u.repo.GetSubtreeNodeIDs(ctx, kbID, settings.FolderIDs)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Intersect(nodeIDs, subtree), nil
+}
+
+// IsCovered reports whether changes to the node have to be reviewed before publishing.
+func (u *NodeReviewUsecase) IsCovered(ctx context.Context, kbID, nodeID string) (bool, error) {
+	settings, err := u.repo.GetSettings(ctx, kbID)
+	if err != nil {
+		return false, err
+	}
+	covered, err := u.coveredNodes(ctx, kbID, settings, []string{nodeID})
+	if err != nil {
+		return false, err
+	}
+	return len(covered) > 0, nil
+}
+
+// CheckRelease makes sure every covered document with unpublished changes among nodeIDs has an
+// approved review of exactly its current content, and returns the nodes those reviews are for.
+// Folders only carry a name and are published without review.
+func (u *NodeReviewUsecase) CheckRelease(ctx context.Context, kbID string, nodeIDs []string) ([]string, error) {
+	settings, err := u.repo.GetSettings(ctx, kbID)
+	if err != nil {
+		return nil, err
+	}
+	covered, err := u.coveredNodes(ctx, kbID, settings, nodeIDs)
+	if err != nil || len(covered) == 0 {
+		return nil, err
+	}
+	nodes, err := u.nodeRepo.GetNodesByIDs(ctx, covered)
+	if err != nil {
+		return nil, err
+	}
+	approved, err := u.repo.GetApproved(ctx, kbID, covered)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewed := make([]string, 0, len(nodes))
+	missing := make([]string, 0)
+	for _, node := range nodes {
+		if node.KBID != kbID || node.Type != domain.NodeTypeDocument || node.Status == domain.NodeStatusReleased {
+			continue
+		}
+		review, ok := approved[node.ID]
+		if !ok || review.Digest != domain.NodeReviewDigest(node.Name, node.Content, node.Meta) {
+			missing = append(missing, node.Name)
+			continue
+		}
+		reviewed = append(reviewed, node.ID)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", domain.ErrNodeReviewRequired, strings.Join(missing, ", "))
+	}
+	return reviewed, nil
+}
+
+// MarkReleased closes the reviews returned by CheckRelease once their release is out.
+func (u *NodeReviewUsecase) MarkReleased(ctx context.Context, kbID string, nodeIDs []string, releaseID string) error {
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+	return u.repo.MarkReleased(ctx, kbID, nodeIDs, releaseID)
+}
+
+// Submit snapshots the draft of a node and opens a review of it at the first stage.
+func (u *NodeReviewUsecase) Submit(ctx context.Context, req *domain.SubmitNodeReviewReq, userID string) (string, error) {
+	settings, err := u.repo.GetSettings(ctx, req.KBID)
+	if err != nil {
+		return "", err
+	}
+	covered, err := u.coveredNodes(ctx, req.KBID, settings, []string{req.NodeID})
+	if err != nil {
+		return "", err
+	}
+	if len(covered) == 0 {
+		return "", domain.ErrNodeReviewNotRequired
+	}
+	node, err := u.nodeRepo.GetNodeByID(ctx, req.NodeID)
+	if err != nil {
+		return "", err
+	}
+	if node.KBID != req.KBID {
+		return "", gorm.ErrRecordNotFound
+	}
+	if node.Type != domain.NodeTypeDocument {
+		return "", domain.ErrNodeReviewNotRequired
+	}
+	if node.Status == domain.NodeStatusReleased {
+		return "", domain.ErrNodeReviewNothingToDo
+	}
+
+	baseReleaseID := ""
+	base, err := u.nodeRepo.GetLatestNodeReleaseByNodeID(ctx, node.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	if base != nil {
+		baseReleaseID = base.ID
+	}
+
+	review := &domain.NodeReview{
+		ID:            uuid.New().String(),
+		KBID:          req.KBID,
+		NodeID:        node.ID,
+		Status:        domain.NodeReviewStatusPending,
+		StageCount:    settings.StageCount(),
+		Name:          node.Name,
+		Content:       node.Content,
+		Meta:          node.Meta,
+		Digest:        domain.NodeReviewDigest(node.Name, node.Content, node.Meta),
+		BaseReleaseID: baseReleaseID,
+		SubmitterID:   userID,
+		Comment:       req.Comment,
+	}
+	audit, err := newNodeReviewAudit(review, domain.NodeReleaseAuditActionReviewSubmit, userID, req.Comment)
+	if err != nil {
+		return "", err
+	}
+	if err := u.repo.Create(ctx, review, audit); err != nil {
+		return "", err
+	}
+	return review.ID, nil
+}
+
+// Act approves, rejects or withdraws a review. Approving passes the current stage, the review is
+// approved once the last stage is passed.
+func (u *NodeReviewUsecase) Act(ctx context.Context, req *domain.NodeReviewActionReq, userID string) error {
+	review, err := u.repo.Get(ctx, req.KBID, req.ID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var (
+		action  string
+		updates map[string]any
+	)
+	switch req.Action {
+	case "approve", "reject":
+		if review.Status != domain.NodeReviewStatusPending {
+			return domain.ErrNodeReviewNotPending
+		}
+		if review.SubmitterID == userID {
+			return domain.ErrNodeReviewSelfApproval
+		}
+		if err := u.requireReviewer(ctx, review.KBID, review.Stage, userID); err != nil {
+			return err
+		}
+		if req.Action == "reject" {
+			action = domain.NodeReleaseAuditActionReviewReject
+			updates = map[string]any{"status": domain.NodeReviewStatusRejected, "finished_at": now}
+			break
+		}
+		action = domain.NodeReleaseAuditActionReviewApprove
+		if review.Stage+1 < review.StageCount {
+			updates = map[string]any{"stage": review.Stage + 1}
+		} else {
+			updates = map[string]any{"status": domain.NodeReviewStatusApproved, "finished_at": now}
+		}
+	case "withdraw":
+		if review.Status != domain.NodeReviewStatusPending && review.Status != domain.NodeReviewStatusApproved {
+			return domain.ErrNodeReviewNotPending
+		}
+		if review.SubmitterID != userID {
+			if err := u.requireFullControl(ctx, review.KBID); err != nil {
+				return err
+			}
+		}
+		action = domain.NodeReleaseAuditActionReviewWithdraw
+		updates = map[string]any{"status": domain.NodeReviewStatusWithdrawn, "finished_at": now}
+	default:
+		return fmt.Errorf("unknown review action %s", req.Action)
+	}
+
+	audit, err := newNodeReviewAudit(&review.NodeReview, action, userID, req.Comment)
+	if err != nil {
+		return err
+	}
+	ok, err := u.repo.Transition(ctx, &review.NodeReview, updates, audit)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrNodeReviewNotPending
+	}
+	return nil
+}
+
+func (u *NodeReviewUsecase) List(ctx context.Context, req *domain.NodeReviewListReq) (*domain.NodeReviewListResp, error) {
+	total, items, err := u.repo.List(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewPaginatedResult(items, uint64(total)), nil
+}
+
+// Detail returns a review with the diff of its snapshot against the release it was based on, in
+// the shape of the node release diff.
+func (u *NodeReviewUsecase) Detail(ctx context.Context, req *domain.NodeReviewDetailReq) (*domain.NodeReviewDetailResp, error) {
+	review, err := u.repo.Get(ctx, req.KBID, req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := &domain.GetNodeReleaseDetailResp{
+		NodeID:  review.NodeID,
+		Name:    review.Name,
+		Content: review.Content,
+		Meta:    review.Meta,
+	}
+	var previous *domain.GetNodeReleaseDetailResp
+	if review.BaseReleaseID != "" {
+		previous, err = u.nodeRepo.GetProNodeReleaseDetail(ctx, review.KBID, review.BaseReleaseID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	if previous != nil {
+		current.CreatorID, current.CreatorAccount = previous.CreatorID, previous.CreatorAccount
+	}
+	current.EditorID, current.EditorAccount = review.SubmitterID, review.SubmitterAccount
+
+	changedFields := make([]string, 0)
+	if previous == nil {
+		changedFields = append(changedFields, "name", "content")
+	} else {
+		if previous.Name != current.Name {
+			changedFields = append(changedFields, "name")
+		}
+		if previous.Content != current.Content {
+			changedFields = append(changedFields, "content")
+		}
+		if previous.Meta.Summary != current.Meta.Summary {
+			changedFields = append(changedFields, "summary")
+		}
+		if previous.Meta.Emoji != current.Meta.Emoji {
+			changedFields = append(changedFields, "emoji")
+		}
+		if previous.Meta.ContentType != current.Meta.ContentType {
+			changedFields = append(changedFields, "content_type")
+		}
+	}
+
+	outdated := false
+	if review.Status == domain.NodeReviewStatusPending || review.Status == domain.NodeReviewStatusApproved {
+		node, err := u.nodeRepo.GetNodeByID(ctx, review.NodeID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		outdated = node == nil || domain.NodeReviewDigest(node.Name, node.Content, node.Meta) != review.Digest
+	}
+
+	history, err := u.repo.ListAudits(ctx, review.KBID, review.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.NodeReviewDetailResp{
+		Review: review,
+		Diff: &domain.GetNodeReleaseDiffResp{
+			Current:       current,
+			Previous:      previous,
+			HasDiff:       len(changedFields) > 0,
+			ChangedFields: changedFields,
+		},
+		Outdated: outdated,
+		History:  history,
+	}, nil
+}
+
+// requireReviewer passes users with full control of the kb and the designated reviewers of stage.
+func (u *NodeReviewUsecase) requireReviewer(ctx context.Context, kbID string, stage int, userID string) error {
+	perm, err := u.kbRepo.GetKBPermByUserId(ctx, kbID)
+	if err != nil {
+		return err
+	}
+	if perm == consts.UserKBPermissionFullControl {
+		return nil
+	}
+	settings, err := u.repo.GetSettings(ctx, kbID)
+	if err != nil {
+		return err
+	}
+	if !settings.CanReview(stage, userID) {
+		return domain.ErrNodeReviewNotReviewer
+	}
+	return nil
+}
+
+func (u *NodeReviewUsecase) requireFullControl(ctx context.Context, kbID string) error {
+	perm, err := u.kbRepo.GetKBPermByUserId(ctx, kbID)
+	if err != nil {
+		return err
+	}
+	if perm != consts.UserKBPermissionFullControl {
+		return domain.ErrPermissionDenied
+	}
+	return nil
+}
+
+func newNodeReviewAudit(review *domain.NodeReview, action, userID, comment string) (*domain.NodeReleaseAudit, error) {
+	detail, err := json.Marshal(map[string]any{
+		"review_id":   review.ID,
+		"node_id":     review.NodeID,
+		"stage":       review.Stage,
+		"stage_count": review.StageCount,
+		"digest":      review.Digest,
+		"comment":     comment,
+		"source": map[string]any{
+			"flow": "NodeReview",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var sourceVersion *string
+	if review.BaseReleaseID != "" {
+		sourceVersion = &review.BaseReleaseID
+	}
+	return &domain.NodeReleaseAudit{
+		KBID:           review.KBID,
+		NodeID:         review.NodeID,
+		Action:         action,
+		OperatorUserID: userID,
+		SourceVersion:  sourceVersion,
+		Detail:         detail,
+	}, nil
+}
@@ -37,4 +37,16 @@ var ProviderSet = wire.NewSet(
 	NewWechatAppUsecase,
 	NewAuthUsecase,
 	NewNavUsecase,
+	NewMCPUsecase,
+	NewWebhookUsecase,
+	NewGitSyncUsecase,
+	NewKBArchiveUsecase,
+	NewReleaseScheduleUsecase,
+	NewNodeReviewUsecase,
+	NewNodeCollabUsecase,
+	NewRAGEvalUsecase,
+	NewKnowledgeGapUsecase,
+	NewHandoffUsecase,
+	NewSCIMUsecase,
+	NewLDAPSyncUsecase,
 )
@@ -74,39 +74,57 @@ func (u *PushUsecase) NotifyKBUpdate(ctx context.Context, kbID string, release *
 			continue
 		}
 
-		u.mu.RLock()
-		notifier, ok := u.notifiers[app.ID]
-		u.mu.RUnlock()
-		if !ok {
-			u.logger.Debug("push: no notifier for app", log.String("app_id", app.ID))
-			continue
+		content := u.renderTemplate(app.Settings.KBUpdatePushContent, kb, release)
+		if !u.PushToChats(ctx, app.ID, app.Settings.KBUpdatePushChatIDs, content) {
+			return
 		}
+	}
+}
 
-		content := u.renderTemplate(app.Settings.KBUpdatePushContent, kb, release)
-		chatIDs := strings.Split(app.Settings.KBUpdatePushChatIDs, ",")
-		for _, chatID := range chatIDs {
-			chatID = strings.TrimSpace(chatID)
-			if chatID == "" {
-				continue
-			}
-			if err := notifier.SendTextMessage(ctx, chatID, content); err != nil {
-				u.logger.Error("push: send failed",
-					log.String("app_id", app.ID),
-					log.String("chat_id", chatID),
-					log.Error(err))
-			} else {
-				u.logger.Info("push: sent successfully",
-					log.String("app_id", app.ID),
-					log.String("chat_id", chatID))
-			}
-			// rate limit: 1 second between sends
-			select {
-			case <-ctx.Done():
-				return
-			case <-time.After(time.Second):
-			}
+// PushToChats sends content to the comma separated chatIDs with the notifier of the app.
+// Errors are logged, not returned. It returns false when ctx was cancelled.
+func (u *PushUsecase) PushToChats(ctx context.Context, appID, chatIDs, content string) bool {
+	u.mu.RLock()
+	notifier, ok := u.notifiers[appID]
+	u.mu.RUnlock()
+	if !ok {
+		u.logger.Debug("push: no notifier for app", log.String("app_id", appID))
+		return true
+	}
+
+	for _, chatID := range strings.Split(chatIDs, ",") {
+		chatID = strings.TrimSpace(chatID)
+		if chatID == "" {
+			continue
+		}
+		if err := notifier.SendTextMessage(ctx, chatID, content); err != nil {
+			u.logger.Error("push: send failed",
+				log.String("app_id", appID),
+				log.String("chat_id", chatID),
+				log.Error(err))
+		} else {
+			u.logger.Info("push: sent successfully",
+				log.String("app_id", appID),
+				log.String("chat_id", chatID))
 		}
+		// rate limit: 1 second between sends
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Second):
+		}
+	}
+	return true
+}
+
+// NotifyKBRelease pushes a release created elsewhere, such as a scheduled release executed by the consumer.
+func (u *PushUsecase) NotifyKBRelease(ctx context.Context, kbID, releaseID string) {
+	release, err := u.kbRepo.GetKBReleaseByID(ctx, kbID, releaseID)
+	if err != nil {
+		u.logger.Error("push: failed to get kb release", log.String("kb_id", kbID), log.String("release_id", releaseID), log.Error(err))
+		return
 	}
+	u.NotifyKBUpdate(ctx, kbID, release)
 }
 
 func (u *PushUsecase) renderTemplate(tmpl string, kb *domain.KnowledgeBase, release *domain.KBRelease) string {
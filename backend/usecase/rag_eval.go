@@ -0,0 +1,455 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/repo/mq"
+	"github.com/chaitin/panda-wiki/repo/pg"
+	"github.com/chaitin/panda-wiki/store/rag"
+)
+
+const ragEvalJudgePrompt = `你是问答质量评估员。请对比"参考答案"评估"待评答案"对"问题"的回答质量，并严格遵循以下规则：
+1. 只关注事实是否与参考答案一致、是否完整覆盖参考答案的要点，不关注措辞与格式。
+2. 待评答案包含与参考答案矛盾的内容时应大幅扣分。
+3. 评分为 0 到 10 的整数，10 表示与参考答案完全一致。
+4. 输出必须是 JSON 对象，且仅包含键 score/reason，reason 用一句话说明理由，不允许附加任何解释。`
+
+// RAGEvalUsecase keeps golden question sets per kb and runs them through the chat pipeline,
+// scoring retrieval against the expected nodes and the answer against the expected answer.
+type RAGEvalUsecase struct {
+	repo         *pg.RAGEvalRepository
+	mqRepo       *mq.RAGEvalRepository
+	promptRepo   *pg.PromptRepo
+	modelRepo    *pg.ModelRepository
+	llmUsecase   *LLMUsecase
+	modelUsecase *ModelUsecase
+	embedder     *rag.Embedder
+	logger       *log.Logger
+}
+
+func NewRAGEvalUsecase(
+	repo *pg.RAGEvalRepository,
+	mqRepo *mq.RAGEvalRepository,
+	promptRepo *pg.PromptRepo,
+	modelRepo *pg.ModelRepository,
+	llmUsecase *LLMUsecase,
+	modelUsecase *ModelUsecase,
+	logger *log.Logger,
+) *RAGEvalUsecase {
+	return &RAGEvalUsecase{
+		repo:         repo,
+		mqRepo:       mqRepo,
+		promptRepo:   promptRepo,
+		modelRepo:    modelRepo,
+		llmUsecase:   llmUsecase,
+		modelUsecase: modelUsecase,
+		embedder:     rag.NewEmbedder(),
+		logger:       logger.WithModule("usecase.rag_eval"),
+	}
+}
+
+func (u *RAGEvalUsecase) CreateDataset(ctx context.Context, req *domain.CreateRAGEvalDatasetReq, creatorID string) (*domain.RAGEvalDataset, error) {
+	now := time.Now()
+	dataset := &domain.RAGEvalDataset{
+		ID:          uuid.New().String(),
+		KBID:        req.KBID,
+		Name:        req.Name,
+		Description: req.Description,
+		CreatorID:   creatorID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := u.repo.CreateDataset(ctx, dataset); err != nil {
+		return nil, err
+	}
+	return dataset, nil
+}
+
+func (u *RAGEvalUsecase) UpdateDataset(ctx context.Context, req *domain.UpdateRAGEvalDatasetReq) error {
+	return u.repo.UpdateDataset(ctx, req.KBID, req.ID, map[string]any{
+		"name":        req.Name,
+		"description": req.Description,
+	})
+}
+
+func (u *RAGEvalUsecase) ListDatasets(ctx context.Context, kbID string) ([]*domain.RAGEvalDatasetListItem, error) {
+	return u.repo.ListDatasets(ctx, kbID)
+}
+
+func (u *RAGEvalUsecase) DeleteDataset(ctx context.Context, kbID, id string) error {
+	return u.repo.DeleteDataset(ctx, kbID, id)
+}
+
+func (u *RAGEvalUsecase) AddCases(ctx context.Context, req *domain.AddRAGEvalCasesReq) ([]*domain.RAGEvalCase, error) {
+	if _, err := u.repo.GetDataset(ctx, req.KBID, req.DatasetID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cases := make([]*domain.RAGEvalCase, 0, len(req.Cases))
+	for i, input := range req.Cases {
+		// keep the input order, cases are listed by created_at
+		createdAt := now.Add(time.Duration(i) * time.Microsecond)
+		cases = append(cases, &domain.RAGEvalCase{
+			ID:              uuid.New().String(),
+			KBID:            req.KBID,
+			DatasetID:       req.DatasetID,
+			Question:        strings.TrimSpace(input.Question),
+			ExpectedAnswer:  strings.TrimSpace(input.ExpectedAnswer),
+			ExpectedNodeIDs: lo.Uniq(input.ExpectedNodeIDs),
+			CreatedAt:       createdAt,
+			UpdatedAt:       createdAt,
+		})
+	}
+	if err := u.repo.CreateCases(ctx, cases); err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+func (u *RAGEvalUsecase) UpdateCase(ctx context.Context, req *domain.UpdateRAGEvalCaseReq) error {
+	evalCase, err := u.repo.GetCase(ctx, req.KBID, req.ID)
+	if err != nil {
+		return err
+	}
+	evalCase.Question = strings.TrimSpace(req.Question)
+	evalCase.ExpectedAnswer = strings.TrimSpace(req.ExpectedAnswer)
+	evalCase.ExpectedNodeIDs = lo.Uniq(req.ExpectedNodeIDs)
+	evalCase.UpdatedAt = time.Now()
+	return u.repo.UpdateCase(ctx, evalCase)
+}
+
+func (u *RAGEvalUsecase) DeleteCase(ctx context.Context, kbID, id string) error {
+	return u.repo.DeleteCase(ctx, kbID, id)
+}
+
+func (u *RAGEvalUsecase) ListCases(ctx context.Context, kbID, datasetID string) ([]*domain.RAGEvalCase, error) {
+	if _, err := u.repo.GetDataset(ctx, kbID, datasetID); err != nil {
+		return nil, err
+	}
+	return u.repo.ListCases(ctx, datasetID)
+}
+
+// CreateRun stores a pending run and queues it for the consumer.
+func (u *RAGEvalUsecase) CreateRun(ctx context.Context, req *domain.CreateRAGEvalRunReq, creatorID string) (*domain.RAGEvalRun, error) {
+	run, err := u.NewRun(ctx, req, creatorID)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.mqRepo.AsyncRun(ctx, run.ID); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// NewRun stores a pending run, resolving the prompt and model it is evaluated with so later
+// changes to the kb settings don't change what the run measures.
+func (u *RAGEvalUsecase) NewRun(ctx context.Context, req *domain.CreateRAGEvalRunReq, creatorID string) (*domain.RAGEvalRun, error) {
+	if _, err := u.repo.GetDataset(ctx, req.KBID, req.DatasetID); err != nil {
+		return nil, err
+	}
+
+	run := &domain.RAGEvalRun{
+		ID:            uuid.New().String(),
+		KBID:          req.KBID,
+		DatasetID:     req.DatasetID,
+		PromptVersion: req.PromptVersion,
+		Scorer:        req.Scorer,
+		TopK:          req.TopK,
+		Status:        domain.RAGEvalRunStatusPending,
+		CreatorID:     creatorID,
+	}
+	if run.Scorer == "" {
+		run.Scorer = domain.RAGEvalScorerLLM
+	}
+	if run.TopK == 0 {
+		run.TopK = domain.RAGEvalDefaultTopK
+	}
+
+	if req.PromptVersion > 0 {
+		version, err := u.promptRepo.GetPromptVersionDetail(ctx, req.KBID, req.PromptVersion)
+		if err != nil {
+			return nil, err
+		}
+		if version == nil {
+			return nil, domain.ErrRAGEvalPromptVersion
+		}
+		run.Prompt = version.Content
+	} else {
+		prompt, err := u.promptRepo.GetPromptContent(ctx, req.KBID)
+		if err != nil {
+			return nil, err
+		}
+		run.Prompt = prompt
+		versions, err := u.promptRepo.GetPromptVersionList(ctx, req.KBID)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) > 0 {
+			run.PromptVersion = versions[0].Version
+		}
+	}
+	if strings.TrimSpace(run.Prompt) == "" {
+		run.Prompt = domain.SystemDefaultPrompt
+	}
+
+	chatModel, err := u.getRunModel(ctx, req.ModelID)
+	if err != nil {
+		return nil, err
+	}
+	run.ModelID = chatModel.ID
+	run.ModelName = chatModel.Model
+	if run.Scorer == domain.RAGEvalScorerEmbedding {
+		if _, err := u.getEmbeddingModel(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	run.CreatedAt, run.UpdatedAt = now, now
+	if err := u.repo.CreateRun(ctx, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func (u *RAGEvalUsecase) ListRuns(ctx context.Context, req *domain.RAGEvalRunListReq) (*domain.RAGEvalRunListResp, error) {
+	total, runs, err := u.repo.ListRuns(ctx, req.KBID, req.DatasetID, req.Offset(), req.Limit())
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewPaginatedResult(runs, uint64(total)), nil
+}
+
+func (u *RAGEvalUsecase) GetRun(ctx context.Context, kbID, id string) (*domain.RAGEvalRunDetailResp, error) {
+	run, err := u.repo.GetRun(ctx, kbID, id)
+	if err != nil {
+		return nil, err
+	}
+	results, err := u.repo.ListResults(ctx, run.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.RAGEvalRunDetailResp{Run: run, Results: results}, nil
+}
+
+// ExecuteRun runs a pending run to completion. The outcome is recorded on the run, so only errors
+// that prevent recording it are returned.
+func (u *RAGEvalUsecase) ExecuteRun(ctx context.Context, runID string) error {
+	run, err := u.repo.GetRun(ctx, "", runID)
+	if err != nil {
+		return err
+	}
+	claimed, err := u.repo.UpdateRunIfStatus(ctx, run.ID, domain.RAGEvalRunStatusPending, map[string]any{
+		"status": domain.RAGEvalRunStatusRunning,
+	})
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, domain.RAGEvalTimeout)
+	defer cancel()
+	metrics, runErr := u.execute(ctx, run)
+
+	updates := map[string]any{
+		"status":      domain.RAGEvalRunStatusSuccess,
+		"progress":    100,
+		"finished_at": time.Now(),
+	}
+	if metrics != nil {
+		updates["metrics"] = *metrics
+	}
+	if runErr != nil {
+		u.logger.Error("rag eval run failed", log.String("run_id", run.ID), log.String("kb_id", run.KBID), log.Error(runErr))
+		updates["status"] = domain.RAGEvalRunStatusFailed
+		updates["error"] = runErr.Error()
+		delete(updates, "progress")
+	}
+	return u.repo.UpdateRun(context.Background(), run.ID, updates)
+}
+
+func (u *RAGEvalUsecase) execute(ctx context.Context, run *domain.RAGEvalRun) (*domain.RAGEvalMetrics, error) {
+	cases, err := u.repo.ListCases(ctx, run.DatasetID)
+	if err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return nil, domain.ErrRAGEvalDatasetEmpty
+	}
+	modelInfo, err := u.getRunModel(ctx, run.ModelID)
+	if err != nil {
+		return nil, err
+	}
+	chatModel, err := u.getChatModel(ctx, modelInfo)
+	if err != nil {
+		return nil, err
+	}
+	var embeddingModel *domain.Model
+	if run.Scorer == domain.RAGEvalScorerEmbedding {
+		if embeddingModel, err = u.getEmbeddingModel(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]*domain.RAGEvalResult, 0, len(cases))
+	for i, evalCase := range cases {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result := u.runCase(ctx, run, evalCase, chatModel, embeddingModel)
+		if err := u.repo.CreateResult(ctx, result); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+		if err := u.repo.UpdateRun(ctx, run.ID, map[string]any{"progress": (i + 1) * 100 / len(cases)}); err != nil {
+			u.logger.Warn("update rag eval progress failed", log.String("run_id", run.ID), log.Error(err))
+		}
+	}
+	metrics := domain.SummarizeRAGEvalResults(results)
+	return &metrics, nil
+}
+
+// runCase asks the question the way the chat does and scores the answer. Failures are recorded
+// on the result, the run goes on with the next case.
+func (u *RAGEvalUsecase) runCase(ctx context.Context, run *domain.RAGEvalRun, evalCase *domain.RAGEvalCase,
+	chatModel model.BaseChatModel, embeddingModel *domain.Model,
+) *domain.RAGEvalResult {
+	start := time.Now()
+	result := &domain.RAGEvalResult{
+		RunID:           run.ID,
+		CaseID:          evalCase.ID,
+		Question:        evalCase.Question,
+		ExpectedAnswer:  evalCase.ExpectedAnswer,
+		ExpectedNodeIDs: evalCase.ExpectedNodeIDs,
+		CreatedAt:       start,
+	}
+	defer func() {
+		result.DurationMS = time.Since(start).Milliseconds()
+	}()
+
+	messages, rankedNodes, err := u.llmUsecase.BuildMessageWithRAG(ctx, run.KBID, nil, run.Prompt,
+		[]*schema.Message{schema.UserMessage(evalCase.Question)})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.RetrievedNodeIDs = lo.Map(rankedNodes, func(node *domain.RankedNodeChunks, _ int) string {
+		return node.NodeID
+	})
+	result.Recall = domain.RecallAtK(evalCase.ExpectedNodeIDs, result.RetrievedNodeIDs, run.TopK)
+
+	answer := strings.Builder{}
+	usage := schema.TokenUsage{}
+	if err := u.llmUsecase.ChatWithAgent(ctx, chatModel, messages, &usage, func(ctx context.Context, dataType, chunk string) error {
+		answer.WriteString(chunk)
+		return nil
+	}); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Answer = u.llmUsecase.trimThinking(answer.String())
+	result.TotalTokens = usage.TotalTokens
+
+	if evalCase.ExpectedAnswer == "" {
+		return result
+	}
+	switch run.Scorer {
+	case domain.RAGEvalScorerEmbedding:
+		vectors, err := u.embedder.Embed(ctx, embeddingModel, []string{evalCase.ExpectedAnswer, result.Answer})
+		if err != nil {
+			result.Error = fmt.Sprintf("score answer: %s", err)
+			return result
+		}
+		score := domain.CosineSimilarity(vectors[0], vectors[1])
+		result.AnswerScore = &score
+	default:
+		score, reason, err := u.judgeAnswer(ctx, chatModel, evalCase, result.Answer)
+		if err != nil {
+			result.Error = fmt.Sprintf("score answer: %s", err)
+			return result
+		}
+		result.AnswerScore, result.JudgeReason = &score, reason
+	}
+	return result
+}
+
+// judgeAnswer asks the model to grade answer against the expected answer, the score is in [0, 1].
+func (u *RAGEvalUsecase) judgeAnswer(ctx context.Context, chatModel model.BaseChatModel, evalCase *domain.RAGEvalCase, answer string) (float64, string, error) {
+	input, err := json.Marshal(map[string]string{
+		"问题":   evalCase.Question,
+		"参考答案": evalCase.ExpectedAnswer,
+		"待评答案": answer,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	content, err := u.llmUsecase.Generate(ctx, chatModel, []*schema.Message{
+		schema.SystemMessage(ragEvalJudgePrompt),
+		schema.UserMessage(string(input)),
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	content, err = extractJSONObject(trimJSONCodeFence(u.llmUsecase.trimThinking(content)))
+	if err != nil {
+		return 0, "", err
+	}
+	var verdict struct {
+		Score  float64 `json:"score"`
+		Reason string  `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(content), &verdict); err != nil {
+		return 0, "", fmt.Errorf("unmarshal judge verdict: %w", err)
+	}
+	return min(max(verdict.Score, 0), 10) / 10, verdict.Reason, nil
+}
+
+// getRunModel returns the model a run answers with, the chat model of the instance unless modelID
+// picks another one.
+func (u *RAGEvalUsecase) getRunModel(ctx context.Context, modelID string) (*domain.Model, error) {
+	if modelID == "" {
+		return u.modelUsecase.GetChatModel(ctx)
+	}
+	m, err := u.modelRepo.GetModelByID(ctx, modelID)
+	if err != nil {
+		return nil, err
+	}
+	if m.Type != domain.ModelTypeChat {
+		return nil, domain.ErrRAGEvalNotChatModel
+	}
+	return m, nil
+}
+
+func (u *RAGEvalUsecase) getChatModel(ctx context.Context, m *domain.Model) (model.BaseChatModel, error) {
+	modelkitModel, err := m.ToModelkitModel()
+	if err != nil {
+		return nil, fmt.Errorf("convert model: %w", err)
+	}
+	return u.llmUsecase.modelkit.GetChatModel(ctx, modelkitModel)
+}
+
+func (u *RAGEvalUsecase) getEmbeddingModel(ctx context.Context) (*domain.Model, error) {
+	m, err := u.modelRepo.GetModelByType(ctx, domain.ModelTypeEmbedding)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrRAGEvalNoEmbeddingModel
+		}
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,283 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/repo/mq"
+	"github.com/chaitin/panda-wiki/repo/pg"
+)
+
+type releaseScheduleRepository interface {
+	Create(ctx context.Context, schedule *domain.ReleaseSchedule) error
+	Get(ctx context.Context, kbID, id string) (*domain.ReleaseSchedule, error)
+	List(ctx context.Context, kbID string, all bool, offset, limit int) (int64, []*domain.ReleaseScheduleListItem, error)
+	ListDue(ctx context.Context, now time.Time) ([]*domain.ReleaseSchedule, error)
+	Claim(ctx context.Context, schedule *domain.ReleaseSchedule) (time.Time, bool, error)
+	UpdateIfClaimed(ctx context.Context, id string, claimedAt time.Time, updates map[string]any) (bool, error)
+	UpdateIfStatus(ctx context.Context, id string, status domain.ReleaseScheduleStatus, updates map[string]any) (bool, error)
+}
+
+type releaseScheduleNodeRepository interface {
+	UnpublishNodes(ctx context.Context, kbID, userID string, nodeIDs []string) ([]string, error)
+}
+
+type releasePushRepository interface {
+	AsyncPushRelease(ctx context.Context, kbID, releaseID string) error
+}
+
+type nodeReleaseVectorRepository interface {
+	AsyncUpdateNodeReleaseVector(ctx context.Context, request []*domain.NodeReleaseVectorRequest) error
+}
+
+type kbReleasePublisher interface {
+	PublishKBRelease(ctx context.Context, req *domain.CreateKBReleaseReq, userId string) (*domain.KBRelease, error)
+}
+
+type ReleaseScheduleUsecase struct {
+	repo      releaseScheduleRepository
+	nodeRepo  releaseScheduleNodeRepository
+	mqRepo    releasePushRepository
+	ragRepo   nodeReleaseVectorRepository
+	kbUsecase kbReleasePublisher
+	logger    *log.Logger
+}
+
+func NewReleaseScheduleUsecase(
+	repo *pg.ReleaseScheduleRepository,
+	nodeRepo *pg.NodeRepository,
+	mqRepo *mq.ReleaseScheduleRepository,
+	ragRepo *mq.RAGRepository,
+	kbUsecase *KnowledgeBaseUsecase,
+	logger *log.Logger,
+) *ReleaseScheduleUsecase {
+	return &ReleaseScheduleUsecase{
+		repo:      repo,
+		nodeRepo:  nodeRepo,
+		mqRepo:    mqRepo,
+		ragRepo:   ragRepo,
+		kbUsecase: kbUsecase,
+		logger:    logger.WithModule("usecase.release_schedule"),
+	}
+}
+
+func (u *ReleaseScheduleUsecase) Create(ctx context.Context, req *domain.CreateReleaseScheduleReq, userID string) (string, error) {
+	if req.UnpublishAt != nil {
+		if len(req.NodeIDs) == 0 {
+			return "", domain.ErrReleaseScheduleNoNodes
+		}
+		if !req.UnpublishAt.After(req.PublishAt) {
+			return "", domain.ErrReleaseScheduleInvalidAt
+		}
+	}
+	schedule := &domain.ReleaseSchedule{
+		ID:          uuid.New().String(),
+		KBID:        req.KBID,
+		Tag:         req.Tag,
+		Message:     req.Message,
+		NodeIDs:     req.NodeIDs,
+		PublishAt:   req.PublishAt,
+		UnpublishAt: req.UnpublishAt,
+		Status:      domain.ReleaseScheduleStatusPending,
+		CreatorID:   userID,
+	}
+	if err := u.repo.Create(ctx, schedule); err != nil {
+		return "", err
+	}
+	return schedule.ID, nil
+}
+
+func (u *ReleaseScheduleUsecase) List(ctx context.Context, req *domain.ReleaseScheduleListReq) (*domain.ReleaseScheduleListResp, error) {
+	total, items, err := u.repo.List(ctx, req.KBID, req.All, req.Offset(), req.Limit())
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewPaginatedResult(items, uint64(total)), nil
+}
+
+// Update reschedules a pending schedule, or moves or drops the expiry of a published one.
+func (u *ReleaseScheduleUsecase) Update(ctx context.Context, req *domain.UpdateReleaseScheduleReq) error {
+	schedule, err := u.repo.Get(ctx, req.KBID, req.ID)
+	if err != nil {
+		return err
+	}
+	publishAt := schedule.PublishAt
+	switch schedule.Status {
+	case domain.ReleaseScheduleStatusPending:
+		if req.PublishAt != nil {
+			publishAt = *req.PublishAt
+		}
+	case domain.ReleaseScheduleStatusPublished:
+		if req.PublishAt != nil && !req.PublishAt.Equal(schedule.PublishAt) {
+			return fmt.Errorf("a published schedule can't be moved: %w", domain.ErrReleaseScheduleNotPending)
+		}
+		if schedule.UnpublishAt == nil && req.UnpublishAt != nil {
+			return fmt.Errorf("expiry can't be added after publishing: %w", domain.ErrReleaseScheduleNotPending)
+		}
+		publishAt = time.Now()
+	default:
+		return domain.ErrReleaseScheduleNotPending
+	}
+	if req.UnpublishAt != nil {
+		if len(schedule.NodeIDs) == 0 {
+			return domain.ErrReleaseScheduleNoNodes
+		}
+		if !req.UnpublishAt.After(publishAt) {
+			return domain.ErrReleaseScheduleInvalidAt
+		}
+	}
+
+	updates := map[string]any{"unpublish_at": req.UnpublishAt}
+	if schedule.Status == domain.ReleaseScheduleStatusPending {
+		updates["publish_at"] = publishAt
+	}
+	ok, err := u.repo.UpdateIfStatus(ctx, schedule.ID, schedule.Status, updates)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrReleaseScheduleNotPending
+	}
+	return nil
+}
+
+// Cancel drops a pending schedule, or the expiry of a published one.
+func (u *ReleaseScheduleUsecase) Cancel(ctx context.Context, kbID, id string) error {
+	schedule, err := u.repo.Get(ctx, kbID, id)
+	if err != nil {
+		return err
+	}
+	var updates map[string]any
+	switch {
+	case schedule.Status == domain.ReleaseScheduleStatusPending:
+		updates = map[string]any{"status": domain.ReleaseScheduleStatusCanceled}
+	case schedule.Status == domain.ReleaseScheduleStatusPublished && schedule.UnpublishAt != nil:
+		updates = map[string]any{"unpublish_at": nil}
+	default:
+		return domain.ErrReleaseScheduleNotPending
+	}
+	ok, err := u.repo.UpdateIfStatus(ctx, schedule.ID, schedule.Status, updates)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrReleaseScheduleNotPending
+	}
+	return nil
+}
+
+// ExecuteDue publishes and unpublishes every schedule that has come due. Each one is claimed
+// first, so concurrent consumers never execute a schedule twice; a schedule left running by a
+// dead consumer is claimed again once its lease expired.
+func (u *ReleaseScheduleUsecase) ExecuteDue(ctx context.Context) error {
+	now := time.Now()
+	schedules, err := u.repo.ListDue(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, schedule := range schedules {
+		unpublish := schedule.DueUnpublish(now)
+		if schedule.Status == domain.ReleaseScheduleStatusRunning {
+			u.logger.Warn("release schedule lease expired, executing it again",
+				log.String("schedule_id", schedule.ID),
+				log.Any("claimed_at", schedule.UpdatedAt))
+		}
+		claimedAt, ok, err := u.repo.Claim(ctx, schedule)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		var updates map[string]any
+		if unpublish {
+			updates, err = u.unpublish(ctx, schedule)
+		} else {
+			updates, err = u.publish(ctx, schedule)
+		}
+		if err != nil {
+			u.logger.Error("execute release schedule failed",
+				log.String("schedule_id", schedule.ID),
+				log.String("kb_id", schedule.KBID),
+				log.Error(err))
+			updates = map[string]any{"status": domain.ReleaseScheduleStatusFailed, "error": err.Error()}
+		}
+		if _, err := u.repo.UpdateIfClaimed(ctx, schedule.ID, claimedAt, updates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// release publishes a kb release and hands it to the api servers for the group chat push, the
+// same as a release created by hand.
+func (u *ReleaseScheduleUsecase) release(ctx context.Context, req *domain.CreateKBReleaseReq, userID string) (*domain.KBRelease, error) {
+	release, err := u.kbUsecase.PublishKBRelease(ctx, req, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.mqRepo.AsyncPushRelease(ctx, req.KBID, release.ID); err != nil {
+		// the release is live already, a lost push is not worth failing it
+		u.logger.Warn("queue kb release push failed", log.String("release_id", release.ID), log.Error(err))
+	}
+	return release, nil
+}
+
+func (u *ReleaseScheduleUsecase) publish(ctx context.Context, schedule *domain.ReleaseSchedule) (map[string]any, error) {
+	release, err := u.release(ctx, &domain.CreateKBReleaseReq{
+		KBID:    schedule.KBID,
+		Message: schedule.Message,
+		Tag:     schedule.Tag,
+		NodeIDs: schedule.NodeIDs,
+	}, schedule.CreatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	u.logger.Info("scheduled release published", log.String("schedule_id", schedule.ID), log.String("release_id", release.ID))
+	return map[string]any{
+		"status":       domain.ReleaseScheduleStatusPublished,
+		"release_id":   release.ID,
+		"published_at": time.Now(),
+	}, nil
+}
+
+func (u *ReleaseScheduleUsecase) unpublish(ctx context.Context, schedule *domain.ReleaseSchedule) (map[string]any, error) {
+	docIDs, err := u.nodeRepo.UnpublishNodes(ctx, schedule.KBID, schedule.CreatorID, schedule.NodeIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(docIDs) > 0 {
+		requests := make([]*domain.NodeReleaseVectorRequest, 0, len(docIDs))
+		for _, docID := range docIDs {
+			requests = append(requests, &domain.NodeReleaseVectorRequest{
+				KBID:   schedule.KBID,
+				DocID:  docID,
+				Action: "delete",
+			})
+		}
+		if err := u.ragRepo.AsyncUpdateNodeReleaseVector(ctx, requests); err != nil {
+			return nil, err
+		}
+	}
+	// a new release without the nodes takes them off the published site
+	if _, err := u.release(ctx, &domain.CreateKBReleaseReq{
+		KBID:    schedule.KBID,
+		Message: fmt.Sprintf("Unpublish expired nodes of release %s", schedule.Tag),
+		Tag:     schedule.Tag + "-expired",
+	}, schedule.CreatorID); err != nil {
+		return nil, err
+	}
+
+	u.logger.Info("scheduled release unpublished", log.String("schedule_id", schedule.ID), log.Int("docs", len(docIDs)))
+	return map[string]any{
+		"status":         domain.ReleaseScheduleStatusUnpublished,
+		"unpublished_at": time.Now(),
+	}, nil
+}
@@ -0,0 +1,230 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+)
+
+// fakeReleaseScheduleDeps keeps the schedules in memory and records what the usecase published,
+// unpublished and pushed.
+type fakeReleaseScheduleDeps struct {
+	schedules   map[string]*domain.ReleaseSchedule
+	releases    []*domain.CreateKBReleaseReq
+	pushed      []string
+	unpublished []string
+	vectors     []*domain.NodeReleaseVectorRequest
+	publishErr  error
+}
+
+func (f *fakeReleaseScheduleDeps) Create(ctx context.Context, schedule *domain.ReleaseSchedule) error {
+	f.schedules[schedule.ID] = schedule
+	return nil
+}
+
+func (f *fakeReleaseScheduleDeps) Get(ctx context.Context, kbID, id string) (*domain.ReleaseSchedule, error) {
+	return f.schedules[id], nil
+}
+
+func (f *fakeReleaseScheduleDeps) List(ctx context.Context, kbID string, all bool, offset, limit int) (int64, []*domain.ReleaseScheduleListItem, error) {
+	return 0, nil, nil
+}
+
+func (f *fakeReleaseScheduleDeps) ListDue(ctx context.Context, now time.Time) ([]*domain.ReleaseSchedule, error) {
+	var due []*domain.ReleaseSchedule
+	for _, s := range f.schedules {
+		switch {
+		case s.Status == domain.ReleaseScheduleStatusPending && !s.PublishAt.After(now),
+			s.DueUnpublish(now),
+			s.Status == domain.ReleaseScheduleStatusRunning && !s.UpdatedAt.After(now.Add(-domain.ReleaseScheduleLease)):
+			copied := *s
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeReleaseScheduleDeps) Claim(ctx context.Context, schedule *domain.ReleaseSchedule) (time.Time, bool, error) {
+	s := f.schedules[schedule.ID]
+	if s.Status != schedule.Status || !s.UpdatedAt.Equal(schedule.UpdatedAt) {
+		return time.Time{}, false, nil
+	}
+	s.Status = domain.ReleaseScheduleStatusRunning
+	s.UpdatedAt = time.Now()
+	return s.UpdatedAt, true, nil
+}
+
+func (f *fakeReleaseScheduleDeps) UpdateIfClaimed(ctx context.Context, id string, claimedAt time.Time, updates map[string]any) (bool, error) {
+	s := f.schedules[id]
+	if s.Status != domain.ReleaseScheduleStatusRunning || !s.UpdatedAt.Equal(claimedAt) {
+		return false, nil
+	}
+	for k, v := range updates {
+		switch k {
+		case "status":
+			s.Status = v.(domain.ReleaseScheduleStatus)
+		case "release_id":
+			s.ReleaseID = v.(string)
+		case "error":
+			s.Error = v.(string)
+		case "published_at":
+			at := v.(time.Time)
+			s.PublishedAt = &at
+		case "unpublished_at":
+			at := v.(time.Time)
+			s.UnpublishedAt = &at
+		}
+	}
+	s.UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (f *fakeReleaseScheduleDeps) UpdateIfStatus(ctx context.Context, id string, status domain.ReleaseScheduleStatus, updates map[string]any) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeReleaseScheduleDeps) UnpublishNodes(ctx context.Context, kbID, userID string, nodeIDs []string) ([]string, error) {
+	f.unpublished = append(f.unpublished, nodeIDs...)
+	docIDs := make([]string, 0, len(nodeIDs))
+	for _, id := range nodeIDs {
+		docIDs = append(docIDs, "doc-"+id)
+	}
+	return docIDs, nil
+}
+
+func (f *fakeReleaseScheduleDeps) AsyncPushRelease(ctx context.Context, kbID, releaseID string) error {
+	f.pushed = append(f.pushed, releaseID)
+	return nil
+}
+
+func (f *fakeReleaseScheduleDeps) AsyncUpdateNodeReleaseVector(ctx context.Context, request []*domain.NodeReleaseVectorRequest) error {
+	f.vectors = append(f.vectors, request...)
+	return nil
+}
+
+func (f *fakeReleaseScheduleDeps) PublishKBRelease(ctx context.Context, req *domain.CreateKBReleaseReq, userId string) (*domain.KBRelease, error) {
+	if f.publishErr != nil {
+		return nil, f.publishErr
+	}
+	f.releases = append(f.releases, req)
+	return &domain.KBRelease{ID: fmt.Sprintf("release-%d", len(f.releases)), KBID: req.KBID, Tag: req.Tag}, nil
+}
+
+func newFakeReleaseScheduleUsecase(schedules ...*domain.ReleaseSchedule) (*ReleaseScheduleUsecase, *fakeReleaseScheduleDeps) {
+	f := &fakeReleaseScheduleDeps{schedules: make(map[string]*domain.ReleaseSchedule)}
+	for _, s := range schedules {
+		f.schedules[s.ID] = s
+	}
+	return &ReleaseScheduleUsecase{
+		repo:      f,
+		nodeRepo:  f,
+		mqRepo:    f,
+		ragRepo:   f,
+		kbUsecase: f,
+		logger:    &log.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))},
+	}, f
+}
+
+func TestReleaseScheduleExecutePublish(t *testing.T) {
+	now := time.Now()
+	unpublishAt := now.Add(time.Hour)
+	u, f := newFakeReleaseScheduleUsecase(
+		&domain.ReleaseSchedule{ID: "due", KBID: "kb", Tag: "v1", NodeIDs: []string{"n1"}, PublishAt: now.Add(-time.Minute), UnpublishAt: &unpublishAt, Status: domain.ReleaseScheduleStatusPending},
+		&domain.ReleaseSchedule{ID: "later", KBID: "kb", Tag: "v2", PublishAt: now.Add(time.Hour), Status: domain.ReleaseScheduleStatusPending},
+	)
+
+	require.NoError(t, u.ExecuteDue(t.Context()))
+	require.Len(t, f.releases, 1)
+	require.Equal(t, "v1", f.releases[0].Tag)
+	require.Equal(t, []string{"n1"}, f.releases[0].NodeIDs)
+	require.Equal(t, []string{"release-1"}, f.pushed)
+
+	due := f.schedules["due"]
+	require.Equal(t, domain.ReleaseScheduleStatusPublished, due.Status)
+	require.Equal(t, "release-1", due.ReleaseID)
+	require.NotNil(t, due.PublishedAt)
+	require.Equal(t, domain.ReleaseScheduleStatusPending, f.schedules["later"].Status)
+
+	// the expiry is not due yet
+	require.NoError(t, u.ExecuteDue(t.Context()))
+	require.Len(t, f.releases, 1)
+	require.Empty(t, f.unpublished)
+}
+
+func TestReleaseScheduleExecuteUnpublish(t *testing.T) {
+	now := time.Now()
+	publishedAt := now.Add(-time.Hour)
+	unpublishAt := now.Add(-time.Minute)
+	u, f := newFakeReleaseScheduleUsecase(&domain.ReleaseSchedule{
+		ID: "expired", KBID: "kb", Tag: "v1", NodeIDs: []string{"n1", "n2"},
+		PublishAt: publishedAt, UnpublishAt: &unpublishAt, PublishedAt: &publishedAt,
+		Status: domain.ReleaseScheduleStatusPublished, ReleaseID: "release-0",
+	})
+
+	require.NoError(t, u.ExecuteDue(t.Context()))
+	require.Equal(t, []string{"n1", "n2"}, f.unpublished)
+	require.Equal(t, []*domain.NodeReleaseVectorRequest{
+		{KBID: "kb", DocID: "doc-n1", Action: "delete"},
+		{KBID: "kb", DocID: "doc-n2", Action: "delete"},
+	}, f.vectors)
+	// the release without the nodes goes to the group chats like any other
+	require.Len(t, f.releases, 1)
+	require.Equal(t, "v1-expired", f.releases[0].Tag)
+	require.Empty(t, f.releases[0].NodeIDs)
+	require.Equal(t, []string{"release-1"}, f.pushed)
+
+	expired := f.schedules["expired"]
+	require.Equal(t, domain.ReleaseScheduleStatusUnpublished, expired.Status)
+	require.Equal(t, "release-0", expired.ReleaseID)
+	require.NotNil(t, expired.UnpublishedAt)
+}
+
+func TestReleaseScheduleExecuteFailure(t *testing.T) {
+	u, f := newFakeReleaseScheduleUsecase(&domain.ReleaseSchedule{
+		ID: "due", KBID: "kb", Tag: "v1", PublishAt: time.Now().Add(-time.Minute), Status: domain.ReleaseScheduleStatusPending,
+	})
+	f.publishErr = errors.New("node not found")
+
+	require.NoError(t, u.ExecuteDue(t.Context()))
+	due := f.schedules["due"]
+	require.Equal(t, domain.ReleaseScheduleStatusFailed, due.Status)
+	require.Equal(t, "node not found", due.Error)
+	require.Empty(t, f.pushed)
+
+	// a failed schedule is not retried
+	f.publishErr = nil
+	require.NoError(t, u.ExecuteDue(t.Context()))
+	require.Empty(t, f.releases)
+}
+
+func TestReleaseScheduleExecuteStaleRunning(t *testing.T) {
+	now := time.Now()
+	stale := now.Add(-domain.ReleaseScheduleLease - time.Minute)
+	publishedAt := now.Add(-time.Hour)
+	unpublishAt := now.Add(-time.Minute)
+	u, f := newFakeReleaseScheduleUsecase(
+		// the consumer died while publishing
+		&domain.ReleaseSchedule{ID: "publishing", KBID: "kb", Tag: "v1", PublishAt: now.Add(-time.Hour), Status: domain.ReleaseScheduleStatusRunning, UpdatedAt: stale},
+		// and while unpublishing
+		&domain.ReleaseSchedule{ID: "unpublishing", KBID: "kb", Tag: "v2", NodeIDs: []string{"n1"}, PublishAt: publishedAt, PublishedAt: &publishedAt, UnpublishAt: &unpublishAt, Status: domain.ReleaseScheduleStatusRunning, UpdatedAt: stale},
+		// a consumer still holds the lease
+		&domain.ReleaseSchedule{ID: "running", KBID: "kb", Tag: "v3", PublishAt: now.Add(-time.Minute), Status: domain.ReleaseScheduleStatusRunning, UpdatedAt: now},
+	)
+
+	require.NoError(t, u.ExecuteDue(t.Context()))
+	require.Equal(t, domain.ReleaseScheduleStatusPublished, f.schedules["publishing"].Status)
+	require.Equal(t, domain.ReleaseScheduleStatusUnpublished, f.schedules["unpublishing"].Status)
+	require.Equal(t, []string{"n1"}, f.unpublished)
+	require.Equal(t, domain.ReleaseScheduleStatusRunning, f.schedules["running"].Status)
+	require.Len(t, f.releases, 2)
+	require.Len(t, f.pushed, 2)
+}
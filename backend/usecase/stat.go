@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"time"
 
 	"github.com/jinzhu/copier"
 	"github.com/samber/lo"
@@ -30,9 +31,10 @@ type StatUseCase struct {
 	logger           *log.Logger
 	geoCacheRepo     *cache.GeoRepo
 	authRepo         *pg.AuthRepo
+	answerCacheRepo  *pg.AnswerCacheRepo
 }
 
-func NewStatUseCase(repo *pg.StatRepository, nodeRepo *pg.NodeRepository, conversationRepo *pg.ConversationRepository, appRepo *pg.AppRepository, ipRepo *ipdb.IPAddressRepo, geoCacheRepo *cache.GeoRepo, authRepo *pg.AuthRepo, kbRepo *pg.KnowledgeBaseRepository, logger *log.Logger) *StatUseCase {
+func NewStatUseCase(repo *pg.StatRepository, nodeRepo *pg.NodeRepository, conversationRepo *pg.ConversationRepository, appRepo *pg.AppRepository, ipRepo *ipdb.IPAddressRepo, geoCacheRepo *cache.GeoRepo, authRepo *pg.AuthRepo, kbRepo *pg.KnowledgeBaseRepository, answerCacheRepo *pg.AnswerCacheRepo, logger *log.Logger) *StatUseCase {
 	return &StatUseCase{
 		repo:             repo,
 		nodeRepo:         nodeRepo,
@@ -42,6 +44,7 @@ func NewStatUseCase(repo *pg.StatRepository, nodeRepo *pg.NodeRepository, conver
 		geoCacheRepo:     geoCacheRepo,
 		authRepo:         authRepo,
 		kbRepo:           kbRepo,
+		answerCacheRepo:  answerCacheRepo,
 		logger:           logger.WithModule("usecase.stats"),
 	}
 }
@@ -242,6 +245,14 @@ func (u *StatUseCase) GetStatCount(ctx context.Context, kbID string, day consts.
 	return count, nil
 }
 
+// GetAnswerCacheStat returns the hit ratio and estimated token savings of the answer cache.
+func (u *StatUseCase) GetAnswerCacheStat(ctx context.Context, kbID string, day consts.StatDay) (*v1.StatAnswerCacheResp, error) {
+	if day == 0 {
+		day = consts.StatDay1
+	}
+	return u.answerCacheRepo.GetStat(ctx, kbID, time.Now().AddDate(0, 0, -int(day)+1))
+}
+
 func (u *StatUseCase) GetStatFunnel(ctx context.Context, kbID string, day consts.StatDay) (*v1.StatFunnelResp, error) {
 	count, err := u.GetStatCount(ctx, kbID, day)
 	if err != nil {
@@ -14,19 +14,22 @@ import (
 	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/log"
 	"github.com/chaitin/panda-wiki/repo/pg"
+	"github.com/chaitin/panda-wiki/store/cache"
 )
 
 type UserUsecase struct {
-	repo   *pg.UserRepository
-	logger *log.Logger
-	config *config.Config
+	repo              *pg.UserRepository
+	systemSettingRepo *pg.SystemSettingRepo
+	cache             *cache.Cache
+	logger            *log.Logger
+	config            *config.Config
 }
 
-func NewUserUsecase(repo *pg.UserRepository, logger *log.Logger, config *config.Config) (*UserUsecase, error) {
+func NewUserUsecase(repo *pg.UserRepository, systemSettingRepo *pg.SystemSettingRepo, cache *cache.Cache, logger *log.Logger, config *config.Config) (*UserUsecase, error) {
 	if config.AdminPassword != "" {
 		if err := repo.UpsertDefaultUser(context.Background(), &domain.User{
 			ID:       uuid.New().String(),
-			Account:  "admin",
+			Account:  domain.DefaultAdminAccount,
 			Password: config.AdminPassword,
 			Role:     consts.UserRoleAdmin,
 		}); err != nil {
@@ -34,9 +37,11 @@ func NewUserUsecase(repo *pg.UserRepository, logger *log.Logger, config *config.
 		}
 	}
 	return &UserUsecase{
-		repo:   repo,
-		logger: logger.WithModule("usecase.user"),
-		config: config,
+		repo:              repo,
+		systemSettingRepo: systemSettingRepo,
+		cache:             cache,
+		logger:            logger.WithModule("usecase.user"),
+		config:            config,
 	}, nil
 }
 
@@ -44,17 +49,40 @@ func (u *UserUsecase) CreateUser(ctx context.Context, user *domain.User, edition
 	return u.repo.CreateUser(ctx, user, edition)
 }
 
-func (u *UserUsecase) VerifyUserAndGenerateToken(ctx context.Context, req v1.LoginReq) (string, error) {
+// VerifyUserAndGenerateToken verifies the password of the user. The token is only issued
+// here to users without a second factor, the others get the challenge to complete with
+// VerifyTwoFactorAndGenerateToken.
+func (u *UserUsecase) VerifyUserAndGenerateToken(ctx context.Context, req v1.LoginReq) (*v1.LoginResp, error) {
 	var user *domain.User
 	var err error
 	user, err = u.repo.VerifyUser(ctx, req.Account, req.Password)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if user.Account != domain.DefaultAdminAccount || user.SourceType != "" {
+		setting, err := u.GetSSOSetting(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if setting.Enabled && setting.DisablePasswordLogin {
+			return nil, domain.ErrPasswordLoginDisabled
+		}
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":  user.ID,
+
+	return u.loginResp(ctx, user)
+}
+
+// generateToken signs the token of the user, sso is the IdP of admin SSO logins.
+func (u *UserUsecase) generateToken(userID string, sso consts.SourceType) (string, error) {
+	claims := jwt.MapClaims{
+		"id":  userID,
 		"exp": time.Now().Add(time.Hour * 24).Unix(),
-	})
+	}
+	if sso != "" {
+		claims[domain.JWTClaimSSO] = string(sso)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	return token.SignedString([]byte(u.config.Auth.JWT.Secret))
 }
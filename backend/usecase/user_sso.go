@@ -0,0 +1,310 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	v1 "github.com/chaitin/panda-wiki/api/user/v1"
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/pkg/cas"
+	"github.com/chaitin/panda-wiki/pkg/ldap"
+	"github.com/chaitin/panda-wiki/pkg/oauth"
+)
+
+const (
+	AdminSSOOAuthCallbackPath = "/api/v1/user/sso/oauth/callback"
+	AdminSSOCASCallbackPath   = "/api/v1/user/sso/cas/callback"
+
+	adminSSOLoginPath      = "/login"
+	adminSSOStateKeyPrefix = "admin_sso_state:"
+	adminSSOCodeKeyPrefix  = "admin_sso_code:"
+	adminSSOStateTTL       = 15 * time.Minute
+	adminSSOCodeTTL        = time.Minute
+)
+
+func (u *UserUsecase) GetSSOSetting(ctx context.Context) (*domain.AdminSSOSetting, error) {
+	var setting domain.AdminSSOSetting
+	systemSetting, err := u.systemSettingRepo.GetSystemSetting(ctx, consts.SystemSettingAdminSSO)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &setting, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(systemSetting.Value, &setting); err != nil {
+		return nil, fmt.Errorf("unmarshal admin sso setting failed: %w", err)
+	}
+	return &setting, nil
+}
+
+func (u *UserUsecase) SetSSOSetting(ctx context.Context, setting *domain.AdminSSOSetting) error {
+	if setting.DisablePasswordLogin && !setting.Enabled {
+		return errors.New("password login can only be disabled with SSO enabled")
+	}
+	if setting.Enabled {
+		var err error
+		switch setting.SourceType {
+		case consts.SourceTypeLDAP:
+			_, err = ldap.NewClient(ctx, u.logger, ldapConfig(setting))
+		case consts.SourceTypeOAuth:
+			if setting.OAuth.ClientID == "" || setting.OAuth.AuthorizeURL == "" || setting.OAuth.TokenURL == "" ||
+				setting.OAuth.UserInfoURL == "" || setting.OAuth.IDField == "" {
+				err = errors.New("client id, authorize url, token url, user info url and id field are required for OAuth")
+			}
+		case consts.SourceTypeCAS:
+			if setting.CAS.ServerURL == "" {
+				err = errors.New("server url is required for CAS")
+			}
+		default:
+			err = errors.New("source type is required")
+		}
+		if err != nil {
+			return err
+		}
+		if setting.SourceType != consts.SourceTypeLDAP && setting.BaseURL == "" {
+			return errors.New("base url of the admin console is required")
+		}
+	}
+
+	value, err := json.Marshal(setting)
+	if err != nil {
+		return err
+	}
+	return u.systemSettingRepo.UpdateSystemSetting(ctx, string(consts.SystemSettingAdminSSO), string(value))
+}
+
+// GetSSOInfo returns the part of the setting the login page needs.
+func (u *UserUsecase) GetSSOInfo(ctx context.Context) (*v1.SSOInfoResp, error) {
+	setting, err := u.GetSSOSetting(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !setting.Enabled {
+		return &v1.SSOInfoResp{}, nil
+	}
+	return &v1.SSOInfoResp{
+		Enabled:              true,
+		SourceType:           setting.SourceType,
+		DisablePasswordLogin: setting.DisablePasswordLogin,
+	}, nil
+}
+
+func (u *UserUsecase) getEnabledSSOSetting(ctx context.Context, sourceType consts.SourceType) (*domain.AdminSSOSetting, error) {
+	setting, err := u.GetSSOSetting(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !setting.Enabled || setting.SourceType != sourceType {
+		return nil, fmt.Errorf("%s SSO is not enabled", sourceType)
+	}
+	return setting, nil
+}
+
+// GenerateSSOLoginURL returns the url of the IdP login page for OAuth and CAS.
+func (u *UserUsecase) GenerateSSOLoginURL(ctx context.Context) (string, error) {
+	setting, err := u.GetSSOSetting(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !setting.Enabled || setting.SourceType == consts.SourceTypeLDAP {
+		return "", errors.New("SSO with a login url is not enabled")
+	}
+
+	state := uuid.New().String()
+	if err := u.cache.SetNX(ctx, adminSSOStateKeyPrefix+state, string(setting.SourceType), adminSSOStateTTL).Err(); err != nil {
+		return "", err
+	}
+
+	switch setting.SourceType {
+	case consts.SourceTypeOAuth:
+		client, err := oauth.NewClient(ctx, u.logger, setting.BaseURL, oauthConfig(setting))
+		if err != nil {
+			return "", err
+		}
+		return client.GetAuthorizeURL(state), nil
+	case consts.SourceTypeCAS:
+		client, err := cas.NewClient(ctx, u.logger, casConfig(setting))
+		if err != nil {
+			return "", err
+		}
+		return client.GetLoginURL(state), nil
+	default:
+		return "", fmt.Errorf("%s SSO has no login url", setting.SourceType)
+	}
+}
+
+// SSOCallback provisions the user of an OAuth or CAS callback and returns the url of the
+// admin console login page with a one-time code to exchange for the token.
+func (u *UserUsecase) SSOCallback(ctx context.Context, sourceType consts.SourceType, req v1.SSOCallbackReq) (string, error) {
+	stateSource, err := u.cache.GetDel(ctx, adminSSOStateKeyPrefix+req.State).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", errors.New("invalid state")
+		}
+		return "", err
+	}
+	if stateSource != string(sourceType) {
+		return "", errors.New("invalid state")
+	}
+	setting, err := u.getEnabledSSOSetting(ctx, sourceType)
+	if err != nil {
+		return "", err
+	}
+
+	var unionID, account string
+	var groups []string
+	switch sourceType {
+	case consts.SourceTypeOAuth:
+		client, err := oauth.NewClient(ctx, u.logger, setting.BaseURL, oauthConfig(setting))
+		if err != nil {
+			return "", err
+		}
+		userInfo, err := client.GetUserInfo(req.Code)
+		if err != nil {
+			return "", fmt.Errorf("get oauth user info failed: %w", err)
+		}
+		unionID, groups = userInfo.ID, userInfo.Groups
+		// the email is more likely to be unique than the name
+		account = lo.CoalesceOrEmpty(userInfo.Email, userInfo.Name, userInfo.ID)
+	case consts.SourceTypeCAS:
+		client, err := cas.NewClient(ctx, u.logger, casConfig(setting))
+		if err != nil {
+			return "", err
+		}
+		userInfo, err := client.ValidateTicket(req.Ticket, req.State)
+		if err != nil {
+			return "", err
+		}
+		unionID, account, groups = userInfo.Username, userInfo.Username, userInfo.Groups
+	default:
+		return "", fmt.Errorf("%s SSO has no callback", sourceType)
+	}
+
+	user, err := u.provisionSSOUser(ctx, setting, sourceType, unionID, account, groups)
+	if err != nil {
+		return "", err
+	}
+	token, err := u.generateToken(user.ID, sourceType)
+	if err != nil {
+		return "", err
+	}
+
+	code := uuid.New().String()
+	if err := u.cache.SetNX(ctx, adminSSOCodeKeyPrefix+code, token, adminSSOCodeTTL).Err(); err != nil {
+		return "", err
+	}
+	redirectURL, err := url.JoinPath(setting.BaseURL, adminSSOLoginPath)
+	if err != nil {
+		return "", err
+	}
+	return redirectURL + "?" + url.Values{"sso_code": {code}}.Encode(), nil
+}
+
+// ExchangeSSOCode returns the token of a code issued by SSOCallback, a code works once.
+func (u *UserUsecase) ExchangeSSOCode(ctx context.Context, code string) (string, error) {
+	token, err := u.cache.GetDel(ctx, adminSSOCodeKeyPrefix+code).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", errors.New("invalid code")
+		}
+		return "", err
+	}
+	return token, nil
+}
+
+// LDAPLogin verifies the password against the directory, the login then asks for the second
+// factor like a password login does.
+func (u *UserUsecase) LDAPLogin(ctx context.Context, req v1.SSOLDAPLoginReq) (*v1.LoginResp, error) {
+	setting, err := u.getEnabledSSOSetting(ctx, consts.SourceTypeLDAP)
+	if err != nil {
+		return nil, err
+	}
+	client, err := ldap.NewClient(ctx, u.logger, ldapConfig(setting))
+	if err != nil {
+		return nil, err
+	}
+	userInfo, err := client.Authenticate(req.Account, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	// the id attribute outlives the DN when the user moves in the directory
+	unionID := lo.CoalesceOrEmpty(userInfo.ID, userInfo.DN)
+	user, err := u.provisionSSOUser(ctx, setting, consts.SourceTypeLDAP, unionID, lo.CoalesceOrEmpty(userInfo.ID, req.Account), userInfo.Groups)
+	if err != nil {
+		return nil, err
+	}
+	return u.loginResp(ctx, user)
+}
+
+func (u *UserUsecase) provisionSSOUser(ctx context.Context, setting *domain.AdminSSOSetting, sourceType consts.SourceType, unionID, account string, groups []string) (*domain.User, error) {
+	if unionID == "" || account == "" {
+		return nil, errors.New("the IdP returned no user id")
+	}
+	role, kbPerms, ok := setting.ResolveGroups(groups)
+	if !ok {
+		u.logger.Info("sso user not allowed", log.String("source_type", string(sourceType)), log.String("account", account), log.Any("groups", groups))
+		return nil, domain.ErrSSOUserNotAllowed
+	}
+
+	user, err := u.repo.UpsertSSOUser(ctx, &domain.User{
+		ID:         uuid.New().String(),
+		Account:    account,
+		Role:       role,
+		SourceType: sourceType,
+		UnionID:    unionID,
+	}, kbPerms)
+	if err != nil {
+		return nil, fmt.Errorf("provision sso user failed: %w", err)
+	}
+	return user, nil
+}
+
+func ldapConfig(setting *domain.AdminSSOSetting) ldap.Config {
+	return ldap.Config{
+		ServerURL:     setting.LDAP.ServerURL,
+		BindDN:        setting.LDAP.BindDN,
+		BindPassword:  setting.LDAP.BindPassword,
+		UserBaseDN:    setting.LDAP.UserBaseDN,
+		UserFilter:    setting.LDAP.UserFilter,
+		UserIDAttr:    setting.LDAP.UserIDAttr,
+		UserNameAttr:  setting.LDAP.UserNameAttr,
+		UserEmailAttr: setting.LDAP.UserEmailAttr,
+		GroupAttr:     setting.LDAP.GroupAttr,
+	}
+}
+
+func oauthConfig(setting *domain.AdminSSOSetting) oauth.Config {
+	return oauth.Config{
+		ClientID:     setting.OAuth.ClientID,
+		ClientSecret: setting.OAuth.ClientSecret,
+		Scopes:       setting.OAuth.Scopes,
+		AuthorizeURL: setting.OAuth.AuthorizeURL,
+		TokenURL:     setting.OAuth.TokenURL,
+		UserInfoURL:  setting.OAuth.UserInfoURL,
+		IDField:      setting.OAuth.IDField,
+		NameField:    setting.OAuth.NameField,
+		EmailField:   setting.OAuth.EmailField,
+		GroupsField:  setting.OAuth.GroupsField,
+		CallbackPath: AdminSSOOAuthCallbackPath,
+	}
+}
+
+func casConfig(setting *domain.AdminSSOSetting) cas.Config {
+	return cas.Config{
+		ServerURL:    setting.CAS.ServerURL,
+		ServiceURL:   setting.BaseURL,
+		Version:      setting.CAS.Version,
+		CallbackPath: AdminSSOCASCallbackPath,
+	}
+}
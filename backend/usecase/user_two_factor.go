@@ -0,0 +1,763 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	v1 "github.com/chaitin/panda-wiki/api/user/v1"
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/pkg/totp"
+	"github.com/chaitin/panda-wiki/pkg/webauthn"
+)
+
+const (
+	twoFactorIssuer = "PandaWiki"
+
+	twoFactorChallengeKeyPrefix   = "user_2fa_challenge:"
+	twoFactorAttemptsKeyPrefix    = "user_2fa_attempts:"
+	twoFactorTOTPSetupKeyPrefix   = "user_2fa_totp_setup:"
+	twoFactorTOTPUsedKeyPrefix    = "user_2fa_totp_used:"
+	twoFactorWebAuthnRegKeyPrefix = "user_2fa_webauthn_reg:"
+	twoFactorChallengeTTL         = 5 * time.Minute
+	twoFactorTOTPSetupTTL         = 10 * time.Minute
+	twoFactorWebAuthnRegTTL       = 5 * time.Minute
+	// a TOTP code is valid for up to three periods with the accepted clock skew
+	twoFactorTOTPUsedTTL = 3 * totp.Period * time.Second
+
+	defaultWebAuthnCredentialName = "Security key"
+)
+
+var errTwoFactorSSOUser = errors.New("the second factor of OAuth, OIDC and CAS users is managed by their IdP")
+
+// twoFactorChallenge is the state of a password login waiting for its second factor.
+type twoFactorChallenge struct {
+	UserID string `json:"user_id"`
+	// Setup is set when the 2FA policy requires the user to enroll a factor first
+	Setup bool `json:"setup"`
+	// WebAuthnChallenge and RPID are the ones of the last webauthn request options
+	WebAuthnChallenge []byte `json:"webauthn_challenge,omitempty"`
+	RPID              string `json:"rp_id,omitempty"`
+}
+
+type webAuthnRegistration struct {
+	Challenge []byte `json:"challenge"`
+	RPID      string `json:"rp_id"`
+}
+
+func (u *UserUsecase) GetTwoFactorPolicy(ctx context.Context) (*domain.TwoFactorPolicy, error) {
+	var policy domain.TwoFactorPolicy
+	systemSetting, err := u.systemSettingRepo.GetSystemSetting(ctx, consts.SystemSettingTwoFactor)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &policy, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(systemSetting.Value, &policy); err != nil {
+		return nil, fmt.Errorf("unmarshal two factor policy failed: %w", err)
+	}
+	return &policy, nil
+}
+
+func (u *UserUsecase) SetTwoFactorPolicy(ctx context.Context, policy *domain.TwoFactorPolicy) error {
+	value, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	return u.systemSettingRepo.UpdateSystemSetting(ctx, string(consts.SystemSettingTwoFactor), string(value))
+}
+
+// loginResp issues the token of a user whose password was verified, or the challenge of
+// the second factor the user has enrolled or, under the 2FA policy, has to enroll. LDAP
+// logins pass here too, the directory only verifies the password.
+func (u *UserUsecase) loginResp(ctx context.Context, user *domain.User) (*v1.LoginResp, error) {
+	methods, err := u.twoFactorMethods(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := u.GetTwoFactorPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if challenge := loginChallenge(user, methods, policy); challenge != nil {
+		token, err := u.newTwoFactorChallenge(ctx, challenge)
+		if err != nil {
+			return nil, err
+		}
+		if challenge.Setup {
+			return &v1.LoginResp{TwoFactorSetupRequired: true, ChallengeToken: token}, nil
+		}
+		return &v1.LoginResp{TwoFactorRequired: true, Methods: methods, ChallengeToken: token}, nil
+	}
+
+	token, err := u.generateToken(user.ID, user.SourceType)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.LoginResp{Token: token}, nil
+}
+
+// loginChallenge returns the challenge the login of the user has to pass before its token is
+// issued, nil when the password is enough.
+func loginChallenge(user *domain.User, methods []domain.TwoFactorMethod, policy *domain.TwoFactorPolicy) *twoFactorChallenge {
+	if len(methods) > 0 {
+		return &twoFactorChallenge{UserID: user.ID}
+	}
+	if policy.RequireForAdmins && twoFactorApplies(user) {
+		return &twoFactorChallenge{UserID: user.ID, Setup: true}
+	}
+	return nil
+}
+
+// twoFactorApplies reports whether the 2FA policy covers the user. OAuth, OIDC and CAS users log in
+// at their IdP, which enforces its own second factor.
+func twoFactorApplies(user *domain.User) bool {
+	return user.Role == consts.UserRoleAdmin && !idpManagesTwoFactor(user.SourceType)
+}
+
+func idpManagesTwoFactor(sourceType consts.SourceType) bool {
+	switch sourceType {
+	case consts.SourceTypeOAuth, consts.SourceTypeOIDC, consts.SourceTypeCAS:
+		return true
+	}
+	return false
+}
+
+func (u *UserUsecase) twoFactorMethods(ctx context.Context, user *domain.User) ([]domain.TwoFactorMethod, error) {
+	var methods []domain.TwoFactorMethod
+	if user.TOTPEnabled {
+		methods = append(methods, domain.TwoFactorMethodTOTP)
+	}
+	credentials, err := u.repo.ListWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(credentials) > 0 {
+		methods = append(methods, domain.TwoFactorMethodWebAuthn)
+	}
+	if len(methods) > 0 && len(user.RecoveryCodes) > 0 {
+		methods = append(methods, domain.TwoFactorMethodRecoveryCode)
+	}
+	return methods, nil
+}
+
+func (u *UserUsecase) newTwoFactorChallenge(ctx context.Context, challenge *twoFactorChallenge) (string, error) {
+	value, err := json.Marshal(challenge)
+	if err != nil {
+		return "", err
+	}
+	token := uuid.New().String()
+	if err := u.cache.Set(ctx, twoFactorChallengeKeyPrefix+token, value, twoFactorChallengeTTL).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// countTwoFactorAttempt counts a wrong code of the challenge and returns the count so far.
+// The count is kept apart from the challenge so concurrent attempts are all counted.
+func (u *UserUsecase) countTwoFactorAttempt(ctx context.Context, token string) (int64, error) {
+	key := twoFactorAttemptsKeyPrefix + token
+	attempts, err := u.cache.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if attempts == 1 {
+		// the count expires with the login, like the challenge
+		if err := u.cache.Expire(ctx, key, twoFactorChallengeTTL).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return attempts, nil
+}
+
+func (u *UserUsecase) getTwoFactorChallenge(ctx context.Context, token string) (*twoFactorChallenge, error) {
+	value, err := u.cache.Get(ctx, twoFactorChallengeKeyPrefix+token).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, domain.ErrTwoFactorChallengeExpired
+		}
+		return nil, err
+	}
+	var challenge twoFactorChallenge
+	if err := json.Unmarshal(value, &challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (u *UserUsecase) saveTwoFactorChallenge(ctx context.Context, token string, challenge *twoFactorChallenge) error {
+	value, err := json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+	// the challenge expires with the login, whatever happens to it
+	err = u.cache.SetArgs(ctx, twoFactorChallengeKeyPrefix+token, value, redis.SetArgs{KeepTTL: true, Mode: "XX"}).Err()
+	if errors.Is(err, redis.Nil) {
+		return domain.ErrTwoFactorChallengeExpired
+	}
+	return err
+}
+
+// consumeTwoFactorChallenge deletes the challenge once its login completes, only one of
+// concurrent requests gets a token for it.
+func (u *UserUsecase) consumeTwoFactorChallenge(ctx context.Context, token string) error {
+	deleted, err := u.cache.Del(ctx, twoFactorChallengeKeyPrefix+token).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return domain.ErrTwoFactorChallengeExpired
+	}
+	if err := u.cache.Del(ctx, twoFactorAttemptsKeyPrefix+token).Err(); err != nil {
+		u.logger.Warn("failed to delete two factor attempts", "error", err)
+	}
+	return nil
+}
+
+// BeginWebAuthnLogin returns the options of navigator.credentials.get for the security keys
+// the user registered on the host of the admin console.
+func (u *UserUsecase) BeginWebAuthnLogin(ctx context.Context, challengeToken, rpID string) (*webauthn.RequestOptions, error) {
+	challenge, err := u.getTwoFactorChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.Setup {
+		return nil, errors.New("a second factor has to be enrolled first")
+	}
+	credentials, err := u.repo.ListWebAuthnCredentials(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := webAuthnCredentialIDs(credentials, rpID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no security key is registered for %s", rpID)
+	}
+
+	challenge.WebAuthnChallenge, err = randomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	challenge.RPID = rpID
+	if err := u.saveTwoFactorChallenge(ctx, challengeToken, challenge); err != nil {
+		return nil, err
+	}
+	return webauthn.NewRequestOptions(rpID, challenge.WebAuthnChallenge, ids), nil
+}
+
+// VerifyTwoFactorAndGenerateToken completes a password login with its second factor. The
+// challenge is dropped after too many wrong codes, the password has to be entered again.
+func (u *UserUsecase) VerifyTwoFactorAndGenerateToken(ctx context.Context, req v1.TwoFactorLoginReq) (string, error) {
+	challenge, err := u.getTwoFactorChallenge(ctx, req.ChallengeToken)
+	if err != nil {
+		return "", err
+	}
+	if challenge.Setup {
+		return "", errors.New("a second factor has to be enrolled first")
+	}
+	user, err := u.repo.GetUser(ctx, challenge.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	var ok bool
+	switch req.Method {
+	case domain.TwoFactorMethodTOTP:
+		if user.TOTPEnabled {
+			ok, err = u.validateTOTP(ctx, user.ID, user.TOTPSecret, req.Code)
+		}
+	case domain.TwoFactorMethodRecoveryCode:
+		if code := normalizeRecoveryCode(req.Code); code != "" {
+			ok, err = u.repo.UseRecoveryCode(ctx, user.ID, hashRecoveryCode(code))
+		}
+	case domain.TwoFactorMethodWebAuthn:
+		if req.Credential != nil && challenge.WebAuthnChallenge != nil {
+			ok, err = u.verifyWebAuthnAssertion(ctx, user.ID, challenge, req.Credential)
+		}
+		// the options of an assertion are good for a single attempt
+		challenge.WebAuthnChallenge = nil
+	default:
+		return "", fmt.Errorf("unsupported two factor method %s", req.Method)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		attempts, err := u.countTwoFactorAttempt(ctx, req.ChallengeToken)
+		switch {
+		case err != nil:
+		case attempts >= domain.TwoFactorMaxAttempts:
+			err = u.cache.Del(ctx, twoFactorChallengeKeyPrefix+req.ChallengeToken, twoFactorAttemptsKeyPrefix+req.ChallengeToken).Err()
+		case req.Method == domain.TwoFactorMethodWebAuthn:
+			// the used assertion options are dropped
+			err = u.saveTwoFactorChallenge(ctx, req.ChallengeToken, challenge)
+		}
+		if err != nil {
+			u.logger.Error("failed to update two factor challenge", "error", err, "user_id", user.ID)
+		}
+		return "", domain.ErrInvalidTwoFactorCode
+	}
+
+	if err := u.consumeTwoFactorChallenge(ctx, req.ChallengeToken); err != nil {
+		return "", err
+	}
+	return u.generateToken(user.ID, user.SourceType)
+}
+
+// validateTOTP checks a code of the secret, each code is accepted once even within its period.
+func (u *UserUsecase) validateTOTP(ctx context.Context, userID, secret, code string) (bool, error) {
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return u.cache.SetNX(ctx, fmt.Sprintf("%s%s:%d", twoFactorTOTPUsedKeyPrefix, userID, step), 1, twoFactorTOTPUsedTTL).Result()
+}
+
+func (u *UserUsecase) verifyWebAuthnAssertion(ctx context.Context, userID string, challenge *twoFactorChallenge, resp *webauthn.AssertionResponse) (bool, error) {
+	credentials, err := u.repo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	credentialID := base64.RawURLEncoding.EncodeToString(resp.RawID)
+	credential, found := lo.Find(credentials, func(c *domain.UserWebAuthnCredential) bool {
+		return c.CredentialID == credentialID && c.RPID == challenge.RPID
+	})
+	if !found {
+		return false, nil
+	}
+	signCount, err := webauthn.VerifyAssertion(resp, challenge.WebAuthnChallenge, credential.RPID, &webauthn.Credential{
+		ID:        resp.RawID,
+		PublicKey: credential.PublicKey,
+		SignCount: uint32(credential.SignCount),
+	})
+	if err != nil {
+		u.logger.Warn("webauthn assertion rejected", "error", err, "user_id", userID, "credential", credential.ID)
+		return false, nil
+	}
+	return u.repo.UpdateWebAuthnCredentialUsage(ctx, credential.ID, signCount)
+}
+
+// twoFactorSetupUser returns the user of a login which has to enroll a second factor.
+func (u *UserUsecase) twoFactorSetupUser(ctx context.Context, challengeToken string) (string, error) {
+	challenge, err := u.getTwoFactorChallenge(ctx, challengeToken)
+	if err != nil {
+		return "", err
+	}
+	if !challenge.Setup {
+		return "", errors.New("the login does not require a second factor to be enrolled")
+	}
+	return challenge.UserID, nil
+}
+
+func (u *UserUsecase) LoginBeginTOTPSetup(ctx context.Context, challengeToken string) (*v1.TOTPSetupResp, error) {
+	userID, err := u.twoFactorSetupUser(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	return u.BeginTOTPSetup(ctx, userID)
+}
+
+// LoginEnableTOTP enrolls the TOTP required by the 2FA policy and completes the login.
+func (u *UserUsecase) LoginEnableTOTP(ctx context.Context, req v1.TwoFactorLoginSetupTOTPReq) (*v1.TwoFactorSetupLoginResp, error) {
+	userID, err := u.twoFactorSetupUser(ctx, req.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+	recoveryCodes, err := u.EnableTOTP(ctx, userID, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	return u.completeTwoFactorSetupLogin(ctx, req.ChallengeToken, userID, recoveryCodes)
+}
+
+func (u *UserUsecase) LoginBeginWebAuthnRegistration(ctx context.Context, challengeToken, rpID string) (*webauthn.CreationOptions, error) {
+	userID, err := u.twoFactorSetupUser(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	return u.BeginWebAuthnRegistration(ctx, userID, rpID)
+}
+
+// LoginRegisterWebAuthn enrolls the security key required by the 2FA policy and completes
+// the login.
+func (u *UserUsecase) LoginRegisterWebAuthn(ctx context.Context, req v1.TwoFactorLoginSetupWebAuthnReq, rpID string) (*v1.TwoFactorSetupLoginResp, error) {
+	userID, err := u.twoFactorSetupUser(ctx, req.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+	recoveryCodes, err := u.RegisterWebAuthn(ctx, userID, rpID, req.Name, req.Credential)
+	if err != nil {
+		return nil, err
+	}
+	return u.completeTwoFactorSetupLogin(ctx, req.ChallengeToken, userID, recoveryCodes)
+}
+
+func (u *UserUsecase) completeTwoFactorSetupLogin(ctx context.Context, challengeToken, userID string, recoveryCodes []string) (*v1.TwoFactorSetupLoginResp, error) {
+	if err := u.consumeTwoFactorChallenge(ctx, challengeToken); err != nil {
+		return nil, err
+	}
+	user, err := u.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	token, err := u.generateToken(user.ID, user.SourceType)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.TwoFactorSetupLoginResp{Token: token, RecoveryCodes: recoveryCodes}, nil
+}
+
+func (u *UserUsecase) GetTwoFactorStatus(ctx context.Context, userID string) (*v1.TwoFactorStatusResp, error) {
+	user, err := u.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := u.repo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	required, err := u.twoFactorRequired(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.TwoFactorStatusResp{
+		TOTPEnabled: user.TOTPEnabled,
+		WebAuthnCredentials: lo.Map(credentials, func(c *domain.UserWebAuthnCredential, _ int) v1.WebAuthnCredentialResp {
+			return v1.WebAuthnCredentialResp{
+				ID:         c.ID,
+				Name:       c.Name,
+				RPID:       c.RPID,
+				CreatedAt:  c.CreatedAt,
+				LastUsedAt: c.LastUsedAt,
+			}
+		}),
+		RecoveryCodesLeft: len(user.RecoveryCodes),
+		Required:          required,
+	}, nil
+}
+
+// BeginTOTPSetup generates the secret to add to an authenticator app, it is saved once a
+// code of it is verified by EnableTOTP.
+func (u *UserUsecase) BeginTOTPSetup(ctx context.Context, userID string) (*v1.TOTPSetupResp, error) {
+	user, err := u.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if idpManagesTwoFactor(user.SourceType) {
+		return nil, errTwoFactorSSOUser
+	}
+	if user.TOTPEnabled {
+		return nil, errors.New("TOTP is already enabled")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := u.cache.Set(ctx, twoFactorTOTPSetupKeyPrefix+userID, secret, twoFactorTOTPSetupTTL).Err(); err != nil {
+		return nil, err
+	}
+	return &v1.TOTPSetupResp{
+		Secret: secret,
+		URL:    totp.URL(twoFactorIssuer, user.Account, secret),
+	}, nil
+}
+
+// EnableTOTP verifies a code of the secret of BeginTOTPSetup and enables it. The recovery
+// codes are returned when it is the first factor of the user.
+func (u *UserUsecase) EnableTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	secret, err := u.cache.Get(ctx, twoFactorTOTPSetupKeyPrefix+userID).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errors.New("TOTP setup expired, please start over")
+		}
+		return nil, err
+	}
+	ok, err := u.validateTOTP(ctx, userID, secret, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrInvalidTwoFactorCode
+	}
+
+	user, err := u.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	recoveryCodes, hashes, err := u.firstFactorRecoveryCodes(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.repo.EnableTOTP(ctx, userID, secret, hashes); err != nil {
+		return nil, err
+	}
+	if err := u.cache.Del(ctx, twoFactorTOTPSetupKeyPrefix+userID).Err(); err != nil {
+		u.logger.Warn("failed to delete totp setup", "error", err, "user_id", userID)
+	}
+	return recoveryCodes, nil
+}
+
+func (u *UserUsecase) DisableTOTP(ctx context.Context, userID, password string) error {
+	user, err := u.verifyUserPassword(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return errors.New("TOTP is not enabled")
+	}
+	if err := u.checkFactorRemovable(ctx, user); err != nil {
+		return err
+	}
+	return u.repo.DisableTOTP(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, the old ones stop working.
+func (u *UserUsecase) RegenerateRecoveryCodes(ctx context.Context, userID, password string) ([]string, error) {
+	user, err := u.verifyUserPassword(ctx, userID, password)
+	if err != nil {
+		return nil, err
+	}
+	methods, err := u.twoFactorMethods(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("two-factor authentication is not enabled")
+	}
+	recoveryCodes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := u.repo.UpdateRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+// BeginWebAuthnRegistration returns the options of navigator.credentials.create for a new
+// security key of the user, scoped to the host of the admin console.
+func (u *UserUsecase) BeginWebAuthnRegistration(ctx context.Context, userID, rpID string) (*webauthn.CreationOptions, error) {
+	user, err := u.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if idpManagesTwoFactor(user.SourceType) {
+		return nil, errTwoFactorSSOUser
+	}
+	credentials, err := u.repo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	excludeIDs, err := webAuthnCredentialIDs(credentials, rpID)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := randomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(webAuthnRegistration{Challenge: challenge, RPID: rpID})
+	if err != nil {
+		return nil, err
+	}
+	if err := u.cache.Set(ctx, twoFactorWebAuthnRegKeyPrefix+userID, value, twoFactorWebAuthnRegTTL).Err(); err != nil {
+		return nil, err
+	}
+	return webauthn.NewCreationOptions(
+		webauthn.RelyingParty{ID: rpID, Name: twoFactorIssuer},
+		webauthn.User{ID: []byte(user.ID), Name: user.Account, DisplayName: user.Account},
+		challenge,
+		excludeIDs,
+	), nil
+}
+
+// RegisterWebAuthn verifies and saves the credential created with the options of
+// BeginWebAuthnRegistration. The recovery codes are returned when it is the first factor
+// of the user.
+func (u *UserUsecase) RegisterWebAuthn(ctx context.Context, userID, rpID, name string, resp *webauthn.AttestationResponse) ([]string, error) {
+	value, err := u.cache.GetDel(ctx, twoFactorWebAuthnRegKeyPrefix+userID).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errors.New("security key registration expired, please start over")
+		}
+		return nil, err
+	}
+	var registration webAuthnRegistration
+	if err := json.Unmarshal(value, &registration); err != nil {
+		return nil, err
+	}
+	if registration.RPID != rpID {
+		return nil, errors.New("security key registration started on another host")
+	}
+	credential, err := webauthn.VerifyRegistration(resp, registration.Challenge, rpID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := u.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	recoveryCodes, hashes, err := u.firstFactorRecoveryCodes(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultWebAuthnCredentialName
+	}
+	if err := u.repo.CreateWebAuthnCredential(ctx, &domain.UserWebAuthnCredential{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		Name:         name,
+		CredentialID: base64.RawURLEncoding.EncodeToString(credential.ID),
+		PublicKey:    credential.PublicKey,
+		RPID:         rpID,
+		SignCount:    int64(credential.SignCount),
+	}, hashes); err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+func (u *UserUsecase) DeleteWebAuthnCredential(ctx context.Context, userID, id, password string) error {
+	user, err := u.verifyUserPassword(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+	if err := u.checkFactorRemovable(ctx, user); err != nil {
+		return err
+	}
+	return u.repo.DeleteWebAuthnCredential(ctx, userID, id)
+}
+
+// ResetTwoFactor removes every second factor of a user who lost them.
+func (u *UserUsecase) ResetTwoFactor(ctx context.Context, userID string) error {
+	if err := u.repo.ResetTwoFactor(ctx, userID); err != nil {
+		return err
+	}
+	return u.cache.Del(ctx, twoFactorTOTPSetupKeyPrefix+userID, twoFactorWebAuthnRegKeyPrefix+userID).Err()
+}
+
+func (u *UserUsecase) twoFactorRequired(ctx context.Context, user *domain.User) (bool, error) {
+	if !twoFactorApplies(user) {
+		return false, nil
+	}
+	policy, err := u.GetTwoFactorPolicy(ctx)
+	if err != nil {
+		return false, err
+	}
+	return policy.RequireForAdmins, nil
+}
+
+// checkFactorRemovable refuses to remove the last factor of a user required to have one.
+func (u *UserUsecase) checkFactorRemovable(ctx context.Context, user *domain.User) error {
+	credentials, err := u.repo.ListWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	factors := len(credentials)
+	if user.TOTPEnabled {
+		factors++
+	}
+	if factors > 1 {
+		return nil
+	}
+	required, err := u.twoFactorRequired(ctx, user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return domain.ErrTwoFactorRequired
+	}
+	return nil
+}
+
+// firstFactorRecoveryCodes generates the recovery codes of a user enrolling the first factor,
+// users with a factor keep theirs and get none.
+func (u *UserUsecase) firstFactorRecoveryCodes(ctx context.Context, user *domain.User) ([]string, []string, error) {
+	methods, err := u.twoFactorMethods(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(methods) > 0 {
+		return nil, nil, nil
+	}
+	return generateRecoveryCodes()
+}
+
+func (u *UserUsecase) verifyUserPassword(ctx context.Context, userID, password string) (*domain.User, error) {
+	user, err := u.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := u.repo.VerifyUser(ctx, user.Account, password); err != nil {
+		return nil, errors.New("invalid password")
+	}
+	return user, nil
+}
+
+func webAuthnCredentialIDs(credentials []*domain.UserWebAuthnCredential, rpID string) ([][]byte, error) {
+	var ids [][]byte
+	for _, credential := range credentials {
+		if credential.RPID != rpID {
+			continue
+		}
+		id, err := webauthn.DecodeString(credential.CredentialID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webauthn credential %s: %w", credential.ID, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// generateRecoveryCodes returns the recovery codes to show to the user and their hashes to save.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, domain.RecoveryCodeCount)
+	hashes := make([]string, 0, domain.RecoveryCodeCount)
+	for range domain.RecoveryCodeCount {
+		b, err := randomBytes(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
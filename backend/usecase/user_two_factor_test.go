@@ -0,0 +1,36 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaitin/panda-wiki/consts"
+	"github.com/chaitin/panda-wiki/domain"
+)
+
+func TestLoginChallenge(t *testing.T) {
+	required := &domain.TwoFactorPolicy{RequireForAdmins: true}
+	optional := &domain.TwoFactorPolicy{}
+	totp := []domain.TwoFactorMethod{domain.TwoFactorMethodTOTP}
+
+	for _, c := range []struct {
+		description string
+		user        *domain.User
+		methods     []domain.TwoFactorMethod
+		policy      *domain.TwoFactorPolicy
+		challenge   *twoFactorChallenge
+	}{
+		{"password admin", &domain.User{ID: "u", Role: consts.UserRoleAdmin}, nil, required, &twoFactorChallenge{UserID: "u", Setup: true}},
+		{"ldap admin", &domain.User{ID: "u", Role: consts.UserRoleAdmin, SourceType: consts.SourceTypeLDAP}, nil, required, &twoFactorChallenge{UserID: "u", Setup: true}},
+		{"ldap admin with totp", &domain.User{ID: "u", Role: consts.UserRoleAdmin, SourceType: consts.SourceTypeLDAP}, totp, optional, &twoFactorChallenge{UserID: "u"}},
+		{"ldap admin without policy", &domain.User{ID: "u", Role: consts.UserRoleAdmin, SourceType: consts.SourceTypeLDAP}, nil, optional, nil},
+		{"oauth admin", &domain.User{ID: "u", Role: consts.UserRoleAdmin, SourceType: consts.SourceTypeOAuth}, nil, required, nil},
+		{"oidc admin", &domain.User{ID: "u", Role: consts.UserRoleAdmin, SourceType: consts.SourceTypeOIDC}, nil, required, nil},
+		{"cas admin", &domain.User{ID: "u", Role: consts.UserRoleAdmin, SourceType: consts.SourceTypeCAS}, nil, required, nil},
+		{"ldap user", &domain.User{ID: "u", Role: consts.UserRoleUser, SourceType: consts.SourceTypeLDAP}, nil, required, nil},
+		{"user with totp", &domain.User{ID: "u", Role: consts.UserRoleUser}, totp, required, &twoFactorChallenge{UserID: "u"}},
+	} {
+		require.Equal(t, c.challenge, loginChallenge(c.user, c.methods, c.policy), c.description)
+	}
+}
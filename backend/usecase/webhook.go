@@ -0,0 +1,360 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+	"github.com/chaitin/panda-wiki/repo/mq"
+	"github.com/chaitin/panda-wiki/repo/pg"
+	"github.com/chaitin/panda-wiki/utils"
+)
+
+const (
+	webhookResponseBodySize = 2048
+)
+
+// WebhookUsecase records knowledge base events as webhook deliveries and
+// sends them through the mq consumer, which retries failed sends with backoff.
+type WebhookUsecase struct {
+	repo   *pg.WebhookRepository
+	mqRepo *mq.WebhookRepository
+	client *http.Client
+	logger *log.Logger
+}
+
+func NewWebhookUsecase(repo *pg.WebhookRepository, mqRepo *mq.WebhookRepository, logger *log.Logger) *WebhookUsecase {
+	return &WebhookUsecase{
+		repo:   repo,
+		mqRepo: mqRepo,
+		client: newWebhookClient(),
+		logger: logger.WithModule("usecase.webhook"),
+	}
+}
+
+// newWebhookClient returns the client posting to webhook urls, it only connects to public
+// addresses and does not follow redirects so a webhook can not reach the internal network.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: domain.WebhookTimeout,
+		// the address is checked once resolved, a host can not pass the validation of its url
+		// and then resolve to an internal address
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if utils.IsPrivateOrReservedIP(host) {
+				return fmt.Errorf("webhook address %s is not allowed", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   domain.WebhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func (u *WebhookUsecase) List(ctx context.Context, kbID string) ([]*domain.WebhookResp, error) {
+	webhooks, err := u.repo.List(ctx, kbID)
+	if err != nil {
+		return nil, err
+	}
+	resp := make([]*domain.WebhookResp, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		resp = append(resp, domain.NewWebhookResp(webhook, false))
+	}
+	return resp, nil
+}
+
+// Create returns the webhook with its secret, it is never shown again.
+func (u *WebhookUsecase) Create(ctx context.Context, req *domain.CreateWebhookReq) (*domain.WebhookResp, error) {
+	if err := domain.ValidateWebhookEvents(req.Events); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateURLForSSRF(req.URL); err != nil {
+		return nil, err
+	}
+	secret := req.Secret
+	if secret == "" {
+		var err error
+		if secret, err = domain.GenerateWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	webhook := &domain.Webhook{
+		ID:        uuid.New().String(),
+		KBID:      req.KBID,
+		Name:      req.Name,
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    req.Events,
+		Enabled:   req.Enabled,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := u.repo.Create(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return domain.NewWebhookResp(webhook, true), nil
+}
+
+func (u *WebhookUsecase) Update(ctx context.Context, req *domain.UpdateWebhookReq) error {
+	if _, err := u.repo.GetByID(ctx, req.KBID, req.ID); err != nil {
+		return err
+	}
+	updates := make(map[string]any)
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.URL != nil {
+		if err := utils.ValidateURLForSSRF(*req.URL); err != nil {
+			return err
+		}
+		updates["url"] = *req.URL
+	}
+	if req.Events != nil {
+		if len(req.Events) == 0 {
+			return fmt.Errorf("events cannot be empty")
+		}
+		if err := domain.ValidateWebhookEvents(req.Events); err != nil {
+			return err
+		}
+		updates["events"] = pq.StringArray(req.Events)
+	}
+	if req.Enabled != nil {
+		updates["enabled"] = *req.Enabled
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return u.repo.Update(ctx, req.KBID, req.ID, updates)
+}
+
+// RotateSecret replaces the signing secret and returns the webhook with the new secret, it is
+// never shown again.
+func (u *WebhookUsecase) RotateSecret(ctx context.Context, req *domain.RotateWebhookSecretReq) (*domain.WebhookResp, error) {
+	webhook, err := u.repo.GetByID(ctx, req.KBID, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = domain.GenerateWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+	if err := u.repo.Update(ctx, req.KBID, req.ID, map[string]any{"secret": secret}); err != nil {
+		return nil, err
+	}
+	webhook.Secret = secret
+	return domain.NewWebhookResp(webhook, true), nil
+}
+
+func (u *WebhookUsecase) Delete(ctx context.Context, req *domain.DeleteWebhookReq) error {
+	return u.repo.Delete(ctx, req.KBID, req.ID)
+}
+
+func (u *WebhookUsecase) ListDeliveries(ctx context.Context, req *domain.WebhookDeliveryListReq) (*domain.PaginatedResult[[]*domain.WebhookDelivery], error) {
+	total, deliveries, err := u.repo.ListDeliveries(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewPaginatedResult(deliveries, uint64(total)), nil
+}
+
+// Replay queues a fresh delivery of a logged payload. The payload keeps its
+// event id so receivers can deduplicate.
+func (u *WebhookUsecase) Replay(ctx context.Context, req *domain.ReplayWebhookDeliveryReq) (string, error) {
+	origin, err := u.repo.GetDeliveryByKBID(ctx, req.KBID, req.ID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := u.repo.GetByID(ctx, req.KBID, origin.WebhookID); err != nil {
+		return "", err
+	}
+	delivery := &domain.WebhookDelivery{
+		ID:        uuid.New().String(),
+		WebhookID: origin.WebhookID,
+		KBID:      origin.KBID,
+		Event:     origin.Event,
+		Payload:   origin.Payload,
+		Status:    domain.WebhookDeliveryStatusPending,
+		ReplayOf:  origin.ID,
+	}
+	if err := u.repo.CreateDeliveries(ctx, []*domain.WebhookDelivery{delivery}); err != nil {
+		return "", err
+	}
+	if err := u.mqRepo.AsyncDeliver(ctx, []string{delivery.ID}); err != nil {
+		return "", err
+	}
+	return delivery.ID, nil
+}
+
+// Dispatch queues event for every enabled webhook of kbID that subscribes to it.
+// Webhooks must never fail the action that raised the event, so errors are logged, not returned.
+func (u *WebhookUsecase) Dispatch(ctx context.Context, kbID string, event domain.WebhookEventType, data any) {
+	webhooks, err := u.repo.ListSubscribed(ctx, kbID, event)
+	if err != nil {
+		u.logger.Error("list subscribed webhooks failed", log.String("kb_id", kbID), log.String("event", string(event)), log.Error(err))
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(&domain.WebhookPayload{
+		ID:        uuid.New().String(),
+		Event:     event,
+		KBID:      kbID,
+		CreatedAt: time.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		u.logger.Error("marshal webhook payload failed", log.String("event", string(event)), log.Error(err))
+		return
+	}
+	deliveries := make([]*domain.WebhookDelivery, 0, len(webhooks))
+	deliveryIDs := make([]string, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		delivery := &domain.WebhookDelivery{
+			ID:        uuid.New().String(),
+			WebhookID: webhook.ID,
+			KBID:      kbID,
+			Event:     event,
+			Payload:   payload,
+			Status:    domain.WebhookDeliveryStatusPending,
+		}
+		deliveries = append(deliveries, delivery)
+		deliveryIDs = append(deliveryIDs, delivery.ID)
+	}
+	if err := u.repo.CreateDeliveries(ctx, deliveries); err != nil {
+		u.logger.Error("create webhook deliveries failed", log.String("kb_id", kbID), log.String("event", string(event)), log.Error(err))
+		return
+	}
+	if err := u.mqRepo.AsyncDeliver(ctx, deliveryIDs); err != nil {
+		u.logger.Error("queue webhook deliveries failed", log.String("kb_id", kbID), log.String("event", string(event)), log.Error(err))
+	}
+}
+
+// Deliver sends one delivery and records the attempt. A non-nil error asks
+// the mq to redeliver the task later; it is only returned while attempts remain.
+func (u *WebhookUsecase) Deliver(ctx context.Context, deliveryID string) error {
+	delivery, err := u.repo.GetDeliveryByID(ctx, deliveryID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			u.logger.Warn("webhook delivery not found", log.String("delivery_id", deliveryID))
+			return nil
+		}
+		return err
+	}
+	if delivery.Status == domain.WebhookDeliveryStatusSuccess || delivery.Status == domain.WebhookDeliveryStatusFailed {
+		return nil
+	}
+	webhook, err := u.repo.GetByID(ctx, delivery.KBID, delivery.WebhookID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return u.repo.UpdateDelivery(ctx, delivery.ID, map[string]any{
+				"status": domain.WebhookDeliveryStatusFailed,
+				"error":  "webhook has been deleted",
+			})
+		}
+		return err
+	}
+	if !webhook.Enabled {
+		return u.repo.UpdateDelivery(ctx, delivery.ID, map[string]any{
+			"status": domain.WebhookDeliveryStatusFailed,
+			"error":  "webhook is disabled",
+		})
+	}
+
+	attempts := delivery.Attempts + 1
+	code, body, sendErr := u.send(ctx, webhook, delivery)
+	updates, retry := webhookAttemptUpdates(attempts, code, body, sendErr, time.Now())
+	if err := u.repo.UpdateDelivery(ctx, delivery.ID, updates); err != nil {
+		return err
+	}
+	if retry {
+		return sendErr
+	}
+	return nil
+}
+
+// webhookAttemptUpdates returns the updates recording the attempt of a delivery, and whether
+// the delivery is retried.
+func webhookAttemptUpdates(attempts, code int, body string, sendErr error, now time.Time) (map[string]any, bool) {
+	updates := map[string]any{
+		"attempts":      attempts,
+		"response_code": code,
+		"response_body": body,
+		"error":         "",
+		"next_retry_at": nil,
+	}
+	switch {
+	case sendErr == nil:
+		updates["status"] = domain.WebhookDeliveryStatusSuccess
+		return updates, false
+	case attempts >= domain.WebhookMaxAttempts():
+		updates["status"] = domain.WebhookDeliveryStatusFailed
+		updates["error"] = sendErr.Error()
+		return updates, false
+	default:
+		updates["status"] = domain.WebhookDeliveryStatusRetrying
+		updates["error"] = sendErr.Error()
+		updates["next_retry_at"] = now.Add(domain.WebhookRetryDelay(attempts))
+		return updates, true
+	}
+}
+
+func (u *WebhookUsecase) send(ctx context.Context, webhook *domain.Webhook, delivery *domain.WebhookDelivery) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, domain.WebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PandaWiki-Webhook")
+	req.Header.Set(domain.WebhookHeaderEvent, string(delivery.Event))
+	req.Header.Set(domain.WebhookHeaderDelivery, delivery.ID)
+	req.Header.Set(domain.WebhookHeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(domain.WebhookHeaderSignature, domain.SignWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseBodySize))
+	// the body is stored in a text column, which rejects NUL and invalid utf-8
+	body := strings.ReplaceAll(strings.ToValidUTF8(string(raw), ""), "\x00", "")
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, body, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, body, nil
+}
@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaitin/panda-wiki/domain"
+)
+
+// newLoopbackWebhookUsecase posts with the webhook client, except that it may connect to the
+// loopback test servers.
+func newLoopbackWebhookUsecase() *WebhookUsecase {
+	client := newWebhookClient()
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: domain.WebhookTimeout}).DialContext
+	client.Transport = transport
+	return &WebhookUsecase{client: client}
+}
+
+func TestWebhookSend(t *testing.T) {
+	webhook := &domain.Webhook{ID: "w1", Secret: "whsec_test"}
+	delivery := &domain.WebhookDelivery{ID: "d1", Event: domain.WebhookEventNodeCreated, Payload: []byte(`{"id":"1"}`)}
+
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	webhook.URL = server.URL
+
+	code, respBody, err := newLoopbackWebhookUsecase().send(t.Context(), webhook, delivery)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok", respBody)
+	require.Equal(t, string(delivery.Payload), string(body))
+	require.Equal(t, string(domain.WebhookEventNodeCreated), received.Header.Get(domain.WebhookHeaderEvent))
+	require.Equal(t, "d1", received.Header.Get(domain.WebhookHeaderDelivery))
+	timestamp, err := strconv.ParseInt(received.Header.Get(domain.WebhookHeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	require.Equal(t, domain.SignWebhookPayload("whsec_test", timestamp, body), received.Header.Get(domain.WebhookHeaderSignature))
+}
+
+func TestWebhookSendFailures(t *testing.T) {
+	delivery := &domain.WebhookDelivery{ID: "d1", Event: domain.WebhookEventNodeCreated, Payload: []byte(`{}`)}
+	redirected := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, target.URL, http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	u := newLoopbackWebhookUsecase()
+
+	code, _, err := u.send(t.Context(), &domain.Webhook{URL: server.URL + "/redirect"}, delivery)
+	require.Error(t, err)
+	require.Equal(t, http.StatusFound, code)
+	require.False(t, redirected, "redirects are not followed")
+
+	code, _, err = u.send(t.Context(), &domain.Webhook{URL: server.URL}, delivery)
+	require.Error(t, err)
+	require.Equal(t, http.StatusInternalServerError, code)
+
+	// the real client never connects to internal addresses
+	port := strconv.Itoa(server.Listener.Addr().(*net.TCPAddr).Port)
+	for _, url := range []string{server.URL, "http://localhost:" + port, "http://169.254.169.254/latest/meta-data"} {
+		_, _, err = (&WebhookUsecase{client: newWebhookClient()}).send(t.Context(), &domain.Webhook{URL: url}, delivery)
+		require.ErrorContains(t, err, "is not allowed", url)
+	}
+}
+
+func TestWebhookAttemptUpdates(t *testing.T) {
+	now := time.Now()
+	sendErr := errors.New("unexpected status code 500")
+
+	updates, retry := webhookAttemptUpdates(1, http.StatusOK, "ok", nil, now)
+	require.False(t, retry)
+	require.Equal(t, domain.WebhookDeliveryStatusSuccess, updates["status"])
+	require.Nil(t, updates["next_retry_at"])
+
+	for attempts := 1; attempts < domain.WebhookMaxAttempts(); attempts++ {
+		updates, retry = webhookAttemptUpdates(attempts, http.StatusInternalServerError, "", sendErr, now)
+		require.True(t, retry)
+		require.Equal(t, domain.WebhookDeliveryStatusRetrying, updates["status"])
+		require.Equal(t, now.Add(domain.WebhookRetryBackoff[attempts-1]), updates["next_retry_at"])
+		require.Equal(t, sendErr.Error(), updates["error"])
+	}
+
+	updates, retry = webhookAttemptUpdates(domain.WebhookMaxAttempts(), http.StatusInternalServerError, "", sendErr, now)
+	require.False(t, retry)
+	require.Equal(t, domain.WebhookDeliveryStatusFailed, updates["status"])
+	require.Equal(t, sendErr.Error(), updates["error"])
+}
@@ -67,6 +67,9 @@ func (u *WechatServiceUsecase) NewWechatServiceConfig(ctx context.Context, kbID
 
 func (u *WechatServiceUsecase) getQAFunc(kbID string, appType domain.AppType) bot.GetQAFun {
 	return func(ctx context.Context, msg string, info domain.ConversationInfo, ConversationID string) (chan string, error) {
+		if notice, muted := u.AppUsecase.handoff.Intercept(ctx, kbID, appType, msg, info); muted {
+			return handoffNotice(notice), nil
+		}
 		auth, err := u.authRepo.GetAuthBySourceType(ctx, domain.AppTypeWechatServiceBot.ToSourceType())
 		if err != nil {
 			u.logger.Error("get auth failed", log.Error(err))
@@ -88,6 +91,7 @@ func (u *WechatServiceUsecase) getQAFunc(kbID string, appType domain.AppType) bo
 		contentCh := make(chan string, 10)
 		go func() {
 			defer close(contentCh)
+			var messageID string
 			for event := range eventCh {
 				if event.Type == "done" || event.Type == "error" {
 					break
@@ -95,6 +99,12 @@ func (u *WechatServiceUsecase) getQAFunc(kbID string, appType domain.AppType) bo
 				if event.Type == "data" {
 					contentCh <- event.Content
 				}
+				if event.Type == "message_id" {
+					messageID = event.Content
+				}
+			}
+			if notice := u.AppUsecase.handoff.CheckAnswer(ctx, kbID, appType, msg, info, messageID); notice != "" {
+				contentCh <- "\n\n" + notice
 			}
 		}()
 		return contentCh, nil